@@ -0,0 +1,78 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client
+
+import (
+	"net/url"
+	"time"
+)
+
+// AuditEntry is the audit log record of a state-changing request made
+// to snapd.
+type AuditEntry struct {
+	Time time.Time `json:"time"`
+	// PID and UID are those of the process that made the request,
+	// if known.
+	PID *int32  `json:"pid,omitempty"`
+	UID *uint32 `json:"uid,omitempty"`
+	// UserID, Username and Email are those of the snapd user that
+	// made the request, if it was authenticated.
+	UserID   int    `json:"user-id,omitempty"`
+	Username string `json:"username,omitempty"`
+	Email    string `json:"email,omitempty"`
+
+	Method   string   `json:"method"`
+	Route    string   `json:"route"`
+	Path     string   `json:"path"`
+	Action   string   `json:"action,omitempty"`
+	Snaps    []string `json:"snaps,omitempty"`
+	Status   int      `json:"status"`
+	Err      string   `json:"err,omitempty"`
+	ChangeID string   `json:"change-id,omitempty"`
+}
+
+// AuditOptions selects the audit log entries to return.
+type AuditOptions struct {
+	Since time.Time // if zero, no filtering by start time is done
+	Until time.Time // if zero, no filtering by end time is done
+	// User, if set, selects the requests made by the snapd user with
+	// the given username or email, or from the given uid.
+	User string
+}
+
+// Audit returns the entries of the snapd audit log, oldest first.
+func (client *Client) Audit(opts *AuditOptions) ([]*AuditEntry, error) {
+	query := url.Values{}
+	if opts != nil {
+		if !opts.Since.IsZero() {
+			query.Set("since", opts.Since.Format(time.RFC3339))
+		}
+		if !opts.Until.IsZero() {
+			query.Set("until", opts.Until.Format(time.RFC3339))
+		}
+		if opts.User != "" {
+			query.Set("user", opts.User)
+		}
+	}
+
+	var entries []*AuditEntry
+	_, err := client.doSync("GET", "/v2/audit", query, nil, nil, &entries)
+	return entries, err
+}
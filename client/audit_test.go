@@ -0,0 +1,69 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client_test
+
+import (
+	"net/url"
+	"time"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/client"
+)
+
+func (cs *clientSuite) TestClientAudit(c *check.C) {
+	cs.rsp = `{"type": "sync", "result": [{"time": "2019-03-11T10:00:00Z", "pid": 100, "uid": 0, "method": "POST", "route": "/v2/snaps/{name}", "path": "/v2/snaps/foo", "action": "install", "snaps": ["foo"], "status": 202, "change-id": "42"}]}`
+
+	entries, err := cs.cli.Audit(&client.AuditOptions{
+		Since: time.Date(2019, 3, 11, 0, 0, 0, 0, time.UTC),
+		Until: time.Date(2019, 3, 12, 0, 0, 0, 0, time.UTC),
+		User:  "foo@example.com",
+	})
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/audit")
+	c.Check(cs.req.URL.Query(), check.DeepEquals, url.Values{
+		"since": []string{"2019-03-11T00:00:00Z"},
+		"until": []string{"2019-03-12T00:00:00Z"},
+		"user":  []string{"foo@example.com"},
+	})
+
+	pid, uid := int32(100), uint32(0)
+	c.Check(entries, check.DeepEquals, []*client.AuditEntry{{
+		Time:     time.Date(2019, 3, 11, 10, 0, 0, 0, time.UTC),
+		PID:      &pid,
+		UID:      &uid,
+		Method:   "POST",
+		Route:    "/v2/snaps/{name}",
+		Path:     "/v2/snaps/foo",
+		Action:   "install",
+		Snaps:    []string{"foo"},
+		Status:   202,
+		ChangeID: "42",
+	}})
+}
+
+func (cs *clientSuite) TestClientAuditNoOptions(c *check.C) {
+	cs.rsp = `{"type": "sync", "result": []}`
+	entries, err := cs.cli.Audit(nil)
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.URL.RawQuery, check.Equals, "")
+	c.Check(entries, check.HasLen, 0)
+}
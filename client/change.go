@@ -36,9 +36,14 @@ type Change struct {
 	Tasks   []*Task `json:"tasks,omitempty"`
 	Ready   bool    `json:"ready"`
 	Err     string  `json:"err,omitempty"`
+	// Paused is whether no further tasks of the change are started
+	// until it's resumed.
+	Paused bool `json:"paused,omitempty"`
 
 	SpawnTime time.Time `json:"spawn-time,omitempty"`
 	ReadyTime time.Time `json:"ready-time,omitempty"`
+	// ScheduledTime is when a change scheduled to run later starts.
+	ScheduledTime time.Time `json:"scheduled-time,omitempty"`
 
 	data map[string]*json.RawMessage
 }
@@ -62,6 +67,7 @@ type Task struct {
 	Status   string       `json:"status"`
 	Log      []string     `json:"log,omitempty"`
 	Progress TaskProgress `json:"progress"`
+	Retries  int          `json:"retries,omitempty"`
 
 	SpawnTime time.Time `json:"spawn-time,omitempty"`
 	ReadyTime time.Time `json:"ready-time,omitempty"`
@@ -92,10 +98,42 @@ func (client *Client) Change(id string) (*Change, error) {
 
 // Abort attempts to abort a change that is in not yet ready.
 func (client *Client) Abort(id string) (*Change, error) {
+	return client.changeAction(id, "abort")
+}
+
+// Pause holds off starting further tasks of a change that is not yet
+// ready, letting those already running finish.
+func (client *Client) Pause(id string) (*Change, error) {
+	return client.changeAction(id, "pause")
+}
+
+// Resume lets the tasks of a paused change be started again.
+func (client *Client) Resume(id string) (*Change, error) {
+	return client.changeAction(id, "resume")
+}
+
+// Rollback starts a change taking the snaps, connections and aliases
+// affected by a completed change back to what they were before it, and
+// returns the ID of the new change.
+func (client *Client) Rollback(id string) (changeID string, err error) {
+	var postData struct {
+		Action string `json:"action"`
+	}
+	postData.Action = "rollback"
+
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(postData); err != nil {
+		return "", err
+	}
+
+	return client.doAsync("POST", "/v2/changes/"+id, nil, nil, &body)
+}
+
+func (client *Client) changeAction(id, action string) (*Change, error) {
 	var postData struct {
 		Action string `json:"action"`
 	}
-	postData.Action = "abort"
+	postData.Action = action
 
 	var body bytes.Buffer
 	if err := json.NewEncoder(&body).Encode(postData); err != nil {
@@ -120,6 +158,8 @@ func (c ChangeSelector) String() string {
 		return "ready"
 	case ChangesAll:
 		return "all"
+	case ChangesArchived:
+		return "archived"
 	}
 
 	panic(fmt.Sprintf("unknown ChangeSelector %d", c))
@@ -131,9 +171,17 @@ const (
 	ChangesAll = ChangesReady | ChangesInProgress
 )
 
+// ChangesArchived selects the changes kept in the change journal,
+// including those already pruned from the state.
+const ChangesArchived ChangeSelector = 1 << 2
+
 type ChangesOptions struct {
 	SnapName string // if empty, no filtering by name is done
 	Selector ChangeSelector
+
+	// Since and Kind only apply when querying archived changes
+	Since time.Time // if zero, no filtering by time is done
+	Kind  string    // if empty, no filtering by kind is done
 }
 
 func (client *Client) Changes(opts *ChangesOptions) ([]*Change, error) {
@@ -145,6 +193,12 @@ func (client *Client) Changes(opts *ChangesOptions) ([]*Change, error) {
 		if opts.SnapName != "" {
 			query.Set("for", opts.SnapName)
 		}
+		if !opts.Since.IsZero() {
+			query.Set("since", opts.Since.Format(time.RFC3339))
+		}
+		if opts.Kind != "" {
+			query.Set("kind", opts.Kind)
+		}
 	}
 
 	var chgds []changeAndData
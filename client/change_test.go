@@ -24,6 +24,7 @@ import (
 
 	"github.com/snapcore/snapd/client"
 	"io/ioutil"
+	"net/url"
 	"time"
 )
 
@@ -60,6 +61,22 @@ func (cs *clientSuite) TestClientChange(c *check.C) {
 	})
 }
 
+func (cs *clientSuite) TestClientChangeScheduled(c *check.C) {
+	cs.rsp = `{"type": "sync", "result": {
+  "id":   "uno",
+  "kind": "refresh-snap",
+  "summary": "...",
+  "status": "Do",
+  "ready": false,
+  "spawn-time": "2016-04-21T01:02:03Z",
+  "scheduled-time": "2016-04-25T10:00:00Z"
+}}`
+
+	chg, err := cs.cli.Change("uno")
+	c.Assert(err, check.IsNil)
+	c.Check(chg.ScheduledTime, check.DeepEquals, time.Date(2016, 04, 25, 10, 0, 0, 0, time.UTC))
+}
+
 func (cs *clientSuite) TestClientChangeData(c *check.C) {
 	cs.rsp = `{"type": "sync", "result": {
   "id":   "uno",
@@ -134,6 +151,7 @@ func (cs *clientSuite) TestClientChangesString(c *check.C) {
 		client.ChangesAll:        "all",
 		client.ChangesReady:      "ready",
 		client.ChangesInProgress: "in-progress",
+		client.ChangesArchived:   "archived",
 	} {
 		c.Check(k.String(), check.Equals, v)
 	}
@@ -178,6 +196,39 @@ func (cs *clientSuite) TestClientChanges(c *check.C) {
 
 }
 
+func (cs *clientSuite) TestClientChangesArchived(c *check.C) {
+	cs.rsp = `{"type": "sync", "result": [{
+  "id":   "uno",
+  "kind": "foo",
+  "summary": "...",
+  "status": "Done",
+  "ready": true,
+  "ready-time": "2019-03-11T11:00:00Z"
+}]}`
+
+	chgs, err := cs.cli.Changes(&client.ChangesOptions{
+		Selector: client.ChangesArchived,
+		SnapName: "some-snap",
+		Since:    time.Date(2019, 3, 11, 10, 0, 0, 0, time.UTC),
+		Kind:     "foo",
+	})
+	c.Assert(err, check.IsNil)
+	c.Check(chgs, check.DeepEquals, []*client.Change{{
+		ID:        "uno",
+		Kind:      "foo",
+		Summary:   "...",
+		Status:    "Done",
+		Ready:     true,
+		ReadyTime: time.Date(2019, 3, 11, 11, 0, 0, 0, time.UTC),
+	}})
+	c.Check(cs.req.URL.Query(), check.DeepEquals, url.Values{
+		"select": []string{"archived"},
+		"for":    []string{"some-snap"},
+		"since":  []string{"2019-03-11T10:00:00Z"},
+		"kind":   []string{"foo"},
+	})
+}
+
 func (cs *clientSuite) TestClientChangesData(c *check.C) {
 	cs.rsp = `{"type": "sync", "result": [{
   "id":   "uno",
@@ -231,3 +282,52 @@ func (cs *clientSuite) TestClientAbort(c *check.C) {
 
 	c.Assert(string(body), check.Equals, "{\"action\":\"abort\"}\n")
 }
+
+func (cs *clientSuite) TestClientRollback(c *check.C) {
+	cs.status = 202
+	cs.rsp = `{"type": "async", "status-code": 202, "change": "43"}`
+
+	id, err := cs.cli.Rollback("42")
+	c.Assert(err, check.IsNil)
+	c.Check(id, check.Equals, "43")
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/changes/42")
+	body, err := ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, check.IsNil)
+	c.Check(string(body), check.Equals, "{\"action\":\"rollback\"}\n")
+}
+
+func (cs *clientSuite) TestClientPauseResume(c *check.C) {
+	cs.rsp = `{"type": "sync", "result": {
+  "id":   "uno",
+  "kind": "foo",
+  "summary": "...",
+  "status": "Doing",
+  "ready": false,
+  "paused": true,
+  "spawn-time": "2016-04-21T01:02:03Z"
+}}`
+
+	chg, err := cs.cli.Pause("uno")
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/changes/uno")
+	c.Check(chg, check.DeepEquals, &client.Change{
+		ID:      "uno",
+		Kind:    "foo",
+		Summary: "...",
+		Status:  "Doing",
+		Paused:  true,
+
+		SpawnTime: time.Date(2016, 04, 21, 1, 2, 3, 0, time.UTC),
+	})
+	body, err := ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, check.IsNil)
+	c.Check(string(body), check.Equals, "{\"action\":\"pause\"}\n")
+
+	_, err = cs.cli.Resume("uno")
+	c.Assert(err, check.IsNil)
+	body, err = ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, check.IsNil)
+	c.Check(string(body), check.Equals, "{\"action\":\"resume\"}\n")
+}
@@ -448,6 +448,8 @@ const (
 
 	ErrorKindSystemRestart = "system-restart"
 	ErrorKindDaemonRestart = "daemon-restart"
+
+	ErrorKindAccessDenied = "access-denied"
 )
 
 // IsRetryable returns true if the given error is an error
@@ -32,6 +32,9 @@ type Connection struct {
 	Manual bool `json:"manual"`
 	// Gadget is set for connections that were enabled by the gadget snap.
 	Gadget bool `json:"gadget"`
+	// LocalPolicy is set for connections that were established
+	// automatically because the local interface policy allows them.
+	LocalPolicy bool `json:"local-policy,omitempty"`
 	// SlotAttrs is the list of attributes of the slot side of the connection.
 	SlotAttrs map[string]interface{} `json:"slot-attrs,omitempty"`
 	// PlugAttrs is the list of attributes of the plug side of the connection.
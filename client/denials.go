@@ -0,0 +1,75 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client
+
+import (
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DenialSuggestion is an interface whose connected plug would grant the
+// access a snap was denied.
+type DenialSuggestion struct {
+	Interface string `json:"interface"`
+	// Plug is the disconnected plug of the snap for the interface,
+	// if it has one used by the denied app or hook.
+	Plug string `json:"plug,omitempty"`
+}
+
+// Denial aggregates the AppArmor or seccomp denials of the same access
+// by the same snap app or hook.
+type Denial struct {
+	// Kind is "apparmor" or "seccomp".
+	Kind string `json:"kind"`
+	Snap string `json:"snap"`
+	// App or Hook is the denied app or hook, if known.
+	App  string `json:"app,omitempty"`
+	Hook string `json:"hook,omitempty"`
+
+	// Operation is the AppArmor operation, e.g. "open" or "capable".
+	Operation  string `json:"operation,omitempty"`
+	Path       string `json:"path,omitempty"`
+	Mask       string `json:"mask,omitempty"`
+	Capability string `json:"capability,omitempty"`
+	Family     string `json:"family,omitempty"`
+	SockType   string `json:"sock-type,omitempty"`
+	// Syscall is the system call seccomp denied.
+	Syscall string `json:"syscall,omitempty"`
+
+	Count     int       `json:"count"`
+	FirstSeen time.Time `json:"first-seen"`
+	LastSeen  time.Time `json:"last-seen"`
+
+	Suggestions []DenialSuggestion `json:"suggestions,omitempty"`
+}
+
+// Denials returns the sandbox denials of the given snaps, or of all
+// snaps if none are given, least recently seen first.
+func (client *Client) Denials(snaps []string) ([]*Denial, error) {
+	query := url.Values{}
+	if len(snaps) > 0 {
+		query.Set("snaps", strings.Join(snaps, ","))
+	}
+
+	var denials []*Denial
+	_, err := client.doSync("GET", "/v2/denials", query, nil, nil, &denials)
+	return denials, err
+}
@@ -0,0 +1,64 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client_test
+
+import (
+	"net/url"
+	"time"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/client"
+)
+
+func (cs *clientSuite) TestClientDenials(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"result": [{
+			"kind": "seccomp",
+			"snap": "foo",
+			"app": "app",
+			"syscall": "bpf",
+			"count": 2,
+			"first-seen": "2019-03-11T10:00:00Z",
+			"last-seen": "2019-03-11T11:00:00Z",
+			"suggestions": [{"interface": "system-trace", "plug": "trace"}]
+		}]
+	}`
+	denials, err := cs.cli.Denials([]string{"foo", "bar"})
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/denials")
+	c.Check(cs.req.URL.Query(), check.DeepEquals, url.Values{"snaps": []string{"foo,bar"}})
+	c.Check(denials, check.DeepEquals, []*client.Denial{{
+		Kind:        "seccomp",
+		Snap:        "foo",
+		App:         "app",
+		Syscall:     "bpf",
+		Count:       2,
+		FirstSeen:   time.Date(2019, 3, 11, 10, 0, 0, 0, time.UTC),
+		LastSeen:    time.Date(2019, 3, 11, 11, 0, 0, 0, time.UTC),
+		Suggestions: []client.DenialSuggestion{{Interface: "system-trace", Plug: "trace"}},
+	}})
+
+	_, err = cs.cli.Denials(nil)
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.URL.Query(), check.DeepEquals, url.Values{})
+}
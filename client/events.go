@@ -0,0 +1,171 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// The types of events sent by snapd.
+const (
+	EventChange    = "change"
+	EventTask      = "task"
+	EventProgress  = "progress"
+	EventWarning   = "warning"
+	EventInterface = "interface"
+)
+
+// An Event is something that happened in snapd.
+type Event struct {
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+
+	// Change is set for EventChange.
+	Change *ChangeEvent `json:"change,omitempty"`
+	// Task is set for EventTask and EventProgress.
+	Task *TaskEvent `json:"task,omitempty"`
+	// Warning is set for EventWarning.
+	Warning *Warning `json:"warning,omitempty"`
+	// Interface is set for EventInterface.
+	Interface *InterfaceEvent `json:"interface,omitempty"`
+}
+
+// A ChangeEvent describes the new status of a change.
+type ChangeEvent struct {
+	ID        string `json:"id"`
+	Kind      string `json:"kind"`
+	Summary   string `json:"summary"`
+	Status    string `json:"status"`
+	OldStatus string `json:"old-status,omitempty"`
+	Ready     bool   `json:"ready"`
+	Err       string `json:"err,omitempty"`
+}
+
+// A TaskEvent describes the new status or progress of a task.
+type TaskEvent struct {
+	ID        string       `json:"id"`
+	ChangeID  string       `json:"change-id,omitempty"`
+	Kind      string       `json:"kind"`
+	Summary   string       `json:"summary"`
+	Status    string       `json:"status"`
+	OldStatus string       `json:"old-status,omitempty"`
+	Progress  TaskProgress `json:"progress"`
+}
+
+// An InterfaceEvent describes a plug being connected to or
+// disconnected from a slot.
+type InterfaceEvent struct {
+	// Action is either "connect" or "disconnect".
+	Action   string  `json:"action"`
+	Plug     PlugRef `json:"plug"`
+	Slot     SlotRef `json:"slot"`
+	ChangeID string  `json:"change-id,omitempty"`
+}
+
+type jsonEvent struct {
+	Event
+	Warning *jsonWarning `json:"warning,omitempty"`
+}
+
+// EventsOptions selects the events to subscribe to.
+type EventsOptions struct {
+	// Types of the events wanted; if empty, all of them.
+	Types []string
+	// ChangeID, if set, selects only the events about that change.
+	ChangeID string
+}
+
+// An EventSubscription receives events from snapd until closed.
+type EventSubscription struct {
+	body    io.ReadCloser
+	scanner *bufio.Scanner
+}
+
+// Events subscribes to the events happening in snapd.
+func (client *Client) Events(opts *EventsOptions) (*EventSubscription, error) {
+	query := url.Values{}
+	if opts != nil {
+		if len(opts.Types) > 0 {
+			query.Set("types", strings.Join(opts.Types, ","))
+		}
+		if opts.ChangeID != "" {
+			query.Set("change-id", opts.ChangeID)
+		}
+	}
+
+	rsp, err := client.raw("GET", "/v2/events", query, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if rsp.StatusCode != 200 {
+		var r response
+		defer rsp.Body.Close()
+		if err := decodeInto(rsp.Body, &r); err != nil {
+			return nil, err
+		}
+		return nil, r.err(client)
+	}
+
+	return &EventSubscription{
+		body:    rsp.Body,
+		scanner: bufio.NewScanner(rsp.Body),
+	}, nil
+}
+
+// Next waits for and returns the next event. It returns io.EOF once
+// snapd ends the stream, e.g. because it is restarting.
+func (sub *EventSubscription) Next() (*Event, error) {
+	// events come in application/json-seq, described in RFC7464;
+	// see Logs for details.
+	for sub.scanner.Scan() {
+		buf := sub.scanner.Bytes()
+		idx := bytes.IndexByte(buf, 0x1E)
+		if idx < 0 {
+			continue
+		}
+		var jev jsonEvent
+		if err := json.Unmarshal(buf[idx+1:], &jev); err != nil {
+			continue
+		}
+		ev := jev.Event
+		if jw := jev.Warning; jw != nil {
+			ev.Warning = &jw.Warning
+			ev.Warning.ExpireAfter, _ = time.ParseDuration(jw.ExpireAfter)
+			ev.Warning.RepeatAfter, _ = time.ParseDuration(jw.RepeatAfter)
+		}
+		return &ev, nil
+	}
+	if err := sub.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// Close ends the subscription.
+func (sub *EventSubscription) Close() error {
+	return sub.body.Close()
+}
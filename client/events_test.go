@@ -0,0 +1,108 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client_test
+
+import (
+	"io"
+	"net/url"
+	"time"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/client"
+)
+
+func (cs *clientSuite) TestClientEvents(c *check.C) {
+	cs.rsp = "\x1e" + `{"type":"change","time":"2019-03-11T10:00:00Z","change":{"id":"42","kind":"install-snap","summary":"...","status":"Doing","old-status":"Do","ready":false}}
+this line is junk
+` + "\x1e" + `{"type":"progress","time":"2019-03-11T10:00:01Z","task":{"id":"7","change-id":"42","kind":"download-snap","summary":"...","status":"Doing","progress":{"label":"foo","done":5,"total":10}}}
+` + "\x1e" + `{"type":"warning","time":"2019-03-11T10:00:02Z","warning":{"message":"hello","first-added":"2019-03-11T10:00:02Z","last-added":"2019-03-11T10:00:02Z","expire-after":"672h0m0s","repeat-after":"24h0m0s"}}
+` + "\x1e" + `{"type":"interface","time":"2019-03-11T10:00:03Z","interface":{"action":"connect","plug":{"snap":"foo","plug":"bar"},"slot":{"snap":"core","slot":"bar"}}}
+`
+
+	sub, err := cs.cli.Events(&client.EventsOptions{
+		Types:    []string{client.EventChange, client.EventProgress},
+		ChangeID: "42",
+	})
+	c.Assert(err, check.IsNil)
+	defer sub.Close()
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/events")
+	c.Check(cs.req.URL.Query(), check.DeepEquals, url.Values{
+		"types":     []string{"change,progress"},
+		"change-id": []string{"42"},
+	})
+
+	ev, err := sub.Next()
+	c.Assert(err, check.IsNil)
+	c.Check(ev, check.DeepEquals, &client.Event{
+		Type: client.EventChange,
+		Time: time.Date(2019, 3, 11, 10, 0, 0, 0, time.UTC),
+		Change: &client.ChangeEvent{
+			ID:        "42",
+			Kind:      "install-snap",
+			Summary:   "...",
+			Status:    "Doing",
+			OldStatus: "Do",
+		},
+	})
+
+	ev, err = sub.Next()
+	c.Assert(err, check.IsNil)
+	c.Check(ev.Type, check.Equals, client.EventProgress)
+	c.Check(ev.Task, check.DeepEquals, &client.TaskEvent{
+		ID:       "7",
+		ChangeID: "42",
+		Kind:     "download-snap",
+		Summary:  "...",
+		Status:   "Doing",
+		Progress: client.TaskProgress{Label: "foo", Done: 5, Total: 10},
+	})
+
+	ev, err = sub.Next()
+	c.Assert(err, check.IsNil)
+	c.Check(ev.Type, check.Equals, client.EventWarning)
+	c.Check(ev.Warning, check.DeepEquals, &client.Warning{
+		Message:     "hello",
+		FirstAdded:  time.Date(2019, 3, 11, 10, 0, 2, 0, time.UTC),
+		LastAdded:   time.Date(2019, 3, 11, 10, 0, 2, 0, time.UTC),
+		ExpireAfter: 28 * 24 * time.Hour,
+		RepeatAfter: 24 * time.Hour,
+	})
+
+	ev, err = sub.Next()
+	c.Assert(err, check.IsNil)
+	c.Check(ev.Type, check.Equals, client.EventInterface)
+	c.Check(ev.Interface, check.DeepEquals, &client.InterfaceEvent{
+		Action: "connect",
+		Plug:   client.PlugRef{Snap: "foo", Name: "bar"},
+		Slot:   client.SlotRef{Snap: "core", Name: "bar"},
+	})
+
+	_, err = sub.Next()
+	c.Check(err, check.Equals, io.EOF)
+}
+
+func (cs *clientSuite) TestClientEventsError(c *check.C) {
+	cs.rsp = `{"type":"error","status-code":400,"status":"Bad Request","result":{"message":"unknown event type \"foo\""}}`
+	cs.status = 400
+	_, err := cs.cli.Events(&client.EventsOptions{Types: []string{"foo"}})
+	c.Check(err, check.ErrorMatches, `unknown event type "foo"`)
+}
@@ -0,0 +1,94 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client
+
+import (
+	"net/url"
+)
+
+// PolicyTraceStep is a step of the evaluation of the interface policy.
+type PolicyTraceStep struct {
+	// Rule describes the declaration rule that was considered.
+	Rule string `json:"rule,omitempty"`
+	// Constraint names the constraints of the rule that were checked,
+	// e.g. "deny-auto-connection".
+	Constraint string `json:"constraint,omitempty"`
+	// Alternative is the 1-based index of the alternative constraints
+	// that were checked, or 0 if the step is about the rule as a whole.
+	Alternative int  `json:"alternative,omitempty"`
+	Matched     bool `json:"matched"`
+	// Detail explains the outcome, e.g. which attribute did not match.
+	Detail string `json:"detail,omitempty"`
+}
+
+// PolicyCheck is the outcome of one of the interface policy checks.
+type PolicyCheck struct {
+	// Check is one of "installation", "connection" or "auto-connection".
+	Check string `json:"check"`
+	// Snap is the snap whose installation was checked.
+	Snap    string `json:"snap,omitempty"`
+	Allowed bool   `json:"allowed"`
+	// Skipped explains why snapd does not make the check, if so.
+	Skipped string            `json:"skipped,omitempty"`
+	Error   string            `json:"error,omitempty"`
+	Trace   []PolicyTraceStep `json:"trace,omitempty"`
+}
+
+// ConnectionExplanation explains how the interface policy decides on
+// installing the snaps of a plug and slot and on connecting them.
+type ConnectionExplanation struct {
+	Plug      PlugRef        `json:"plug"`
+	Slot      SlotRef        `json:"slot"`
+	Interface string         `json:"interface"`
+	Checks    []*PolicyCheck `json:"checks"`
+}
+
+// ExplainOptions gives snaps that are not installed to explain the
+// connection for.
+type ExplainOptions struct {
+	// SnapFiles are paths to snap files to use instead of the
+	// installed snaps of the same name.
+	SnapFiles []string
+	// AssertionFiles are paths to files with the snap declarations
+	// of the snap files.
+	AssertionFiles []string
+}
+
+// ExplainConnection explains how the interface policy decides on the
+// given plug and slot. An empty slot snap means the system snap.
+func (client *Client) ExplainConnection(plug PlugRef, slot SlotRef, opts *ExplainOptions) (*ConnectionExplanation, error) {
+	query := url.Values{}
+	query.Set("plug", plug.Snap+":"+plug.Name)
+	query.Set("slot", slot.Snap+":"+slot.Name)
+	if opts != nil {
+		for _, fn := range opts.SnapFiles {
+			query.Add("snap-file", fn)
+		}
+		for _, fn := range opts.AssertionFiles {
+			query.Add("assertion-file", fn)
+		}
+	}
+
+	var explanation ConnectionExplanation
+	if _, err := client.doSync("GET", "/v2/interfaces/explain", query, nil, nil, &explanation); err != nil {
+		return nil, err
+	}
+	return &explanation, nil
+}
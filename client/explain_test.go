@@ -0,0 +1,78 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client_test
+
+import (
+	"net/url"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/client"
+)
+
+func (cs *clientSuite) TestClientExplainConnection(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"result": {
+			"plug": {"snap": "foo", "plug": "network"},
+			"slot": {"snap": "core", "slot": "network"},
+			"interface": "network",
+			"checks": [
+				{"check": "installation", "snap": "foo", "allowed": true, "skipped": "snap has no snap-id, its installation is not checked"},
+				{"check": "auto-connection", "allowed": false, "error": "auto-connection not allowed", "trace": [
+					{"rule": "base-declaration slot rule of interface \"network\"", "constraint": "deny-auto-connection", "alternative": 1, "matched": true}
+				]}
+			]
+		}
+	}`
+	explanation, err := cs.cli.ExplainConnection(client.PlugRef{Snap: "foo", Name: "network"}, client.SlotRef{Name: "network"}, &client.ExplainOptions{
+		SnapFiles:      []string{"/tmp/foo.snap"},
+		AssertionFiles: []string{"/tmp/foo.assert", "/tmp/bar.assert"},
+	})
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/interfaces/explain")
+	c.Check(cs.req.URL.Query(), check.DeepEquals, url.Values{
+		"plug":           []string{"foo:network"},
+		"slot":           []string{":network"},
+		"snap-file":      []string{"/tmp/foo.snap"},
+		"assertion-file": []string{"/tmp/foo.assert", "/tmp/bar.assert"},
+	})
+	c.Check(explanation, check.DeepEquals, &client.ConnectionExplanation{
+		Plug:      client.PlugRef{Snap: "foo", Name: "network"},
+		Slot:      client.SlotRef{Snap: "core", Name: "network"},
+		Interface: "network",
+		Checks: []*client.PolicyCheck{{
+			Check:   "installation",
+			Snap:    "foo",
+			Allowed: true,
+			Skipped: "snap has no snap-id, its installation is not checked",
+		}, {
+			Check: "auto-connection",
+			Error: "auto-connection not allowed",
+			Trace: []client.PolicyTraceStep{{
+				Rule:        `base-declaration slot rule of interface "network"`,
+				Constraint:  "deny-auto-connection",
+				Alternative: 1,
+				Matched:     true,
+			}},
+		}},
+	})
+}
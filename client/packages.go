@@ -63,6 +63,7 @@ type Snap struct {
 	License          string        `json:"license,omitempty"`
 	CommonIDs        []string      `json:"common-ids,omitempty"`
 	MountedFrom      string        `json:"mounted-from,omitempty"`
+	Health           *SnapHealth   `json:"health,omitempty"`
 
 	Prices      map[string]float64    `json:"prices,omitempty"`
 	Screenshots []snap.ScreenshotInfo `json:"screenshots,omitempty"`
@@ -75,6 +76,15 @@ type Snap struct {
 	Tracks []string `json:"tracks,omitempty"`
 }
 
+// SnapHealth is the health the snap reports about itself.
+type SnapHealth struct {
+	Revision  snap.Revision `json:"revision"`
+	Timestamp time.Time     `json:"timestamp"`
+	Status    string        `json:"status"`
+	Message   string        `json:"message,omitempty"`
+	Code      string        `json:"code,omitempty"`
+}
+
 func (s *Snap) MarshalJSON() ([]byte, error) {
 	type auxSnap Snap // use auxiliary type so that Go does not call Snap.MarshalJSON()
 	// separate type just for marshalling
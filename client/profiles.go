@@ -0,0 +1,57 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// SecurityProfile is a file generated by a security backend for a snap,
+// such as an AppArmor profile or a udev rules file.
+type SecurityProfile struct {
+	// Backend is the security backend, e.g. "apparmor" or "udev".
+	Backend string `json:"backend"`
+	Path    string `json:"path"`
+	// Content is the content of the file, when not diffing.
+	Content string `json:"content,omitempty"`
+	// Diff is how the file would change, as a unified diff.
+	Diff string `json:"diff,omitempty"`
+}
+
+// SecurityProfiles returns the security profiles of the given snap.
+//
+// With a non-empty diffWith only the profiles that would change are
+// returned, with their differences. diffWith is one of:
+//
+//	connect:<snap>:<plug>[,<snap>:<slot>]
+//	disconnect:<snap>:<plug>[,<snap>:<slot>]
+//	refresh:<path of a snap file>
+func (client *Client) SecurityProfiles(snapName, diffWith string) ([]*SecurityProfile, error) {
+	query := url.Values{}
+	if diffWith != "" {
+		query.Set("diff-with", diffWith)
+	}
+
+	var profiles []*SecurityProfile
+	path := fmt.Sprintf("/v2/snaps/%s/security-profiles", snapName)
+	_, err := client.doSync("GET", path, query, nil, nil, &profiles)
+	return profiles, err
+}
@@ -0,0 +1,69 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client_test
+
+import (
+	"net/url"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/client"
+)
+
+func (cs *clientSuite) TestClientSecurityProfiles(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"result": [{
+			"backend": "kmod",
+			"path": "/etc/modules-load.d/snap.foo.conf",
+			"content": "# This file is automatically generated.\nbar\n"
+		}]
+	}`
+	profiles, err := cs.cli.SecurityProfiles("foo", "")
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/snaps/foo/security-profiles")
+	c.Check(cs.req.URL.Query(), check.DeepEquals, url.Values{})
+	c.Check(profiles, check.DeepEquals, []*client.SecurityProfile{{
+		Backend: "kmod",
+		Path:    "/etc/modules-load.d/snap.foo.conf",
+		Content: "# This file is automatically generated.\nbar\n",
+	}})
+}
+
+func (cs *clientSuite) TestClientSecurityProfilesDiff(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"result": [{
+			"backend": "udev",
+			"path": "/etc/udev/rules.d/70-snap.foo.rules",
+			"diff": "--- a\n+++ b\n@@ -0,0 +1 @@\n+rule\n"
+		}]
+	}`
+	profiles, err := cs.cli.SecurityProfiles("foo", "connect:foo:camera")
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/snaps/foo/security-profiles")
+	c.Check(cs.req.URL.Query(), check.DeepEquals, url.Values{"diff-with": []string{"connect:foo:camera"}})
+	c.Check(profiles, check.DeepEquals, []*client.SecurityProfile{{
+		Backend: "udev",
+		Path:    "/etc/udev/rules.d/70-snap.foo.rules",
+		Diff:    "--- a\n+++ b\n@@ -0,0 +1 @@\n+rule\n",
+	}})
+}
@@ -27,6 +27,8 @@ import (
 	"mime/multipart"
 	"os"
 	"path/filepath"
+	"reflect"
+	"time"
 )
 
 type SnapOptions struct {
@@ -39,10 +41,24 @@ type SnapOptions struct {
 	Dangerous        bool   `json:"dangerous,omitempty"`
 	IgnoreValidation bool   `json:"ignore-validation,omitempty"`
 	Unaliased        bool   `json:"unaliased,omitempty"`
+	Purge            bool   `json:"purge,omitempty"`
+	// Schedule, if set, delays the operation until the next window
+	// of the given schedule, e.g. "mon,10:00-12:00", which must open
+	// within six days. If snapd is down when the window opens, the
+	// operation starts once it is back, window or not.
+	Schedule string `json:"schedule,omitempty"`
 
 	Users []string `json:"users,omitempty"`
 }
 
+// onlySchedule returns whether the options set nothing but a schedule,
+// which is all multi-snap actions support.
+func (opts *SnapOptions) onlySchedule() bool {
+	rest := *opts
+	rest.Schedule = ""
+	return reflect.DeepEqual(rest, SnapOptions{})
+}
+
 func writeFieldBool(mw *multipart.Writer, key string, val bool) error {
 	if !val {
 		return nil
@@ -77,13 +93,20 @@ type actionData struct {
 	Action   string `json:"action"`
 	Name     string `json:"name,omitempty"`
 	SnapPath string `json:"snap-path,omitempty"`
+	DryRun   bool   `json:"dry-run,omitempty"`
 	*SnapOptions
 }
 
 type multiActionData struct {
-	Action string   `json:"action"`
-	Snaps  []string `json:"snaps,omitempty"`
-	Users  []string `json:"users,omitempty"`
+	Action        string     `json:"action"`
+	Snaps         []string   `json:"snaps,omitempty"`
+	Users         []string   `json:"users,omitempty"`
+	HoldUntil     *time.Time `json:"hold-until,omitempty"`
+	Compression   string     `json:"compression,omitempty"`
+	BaseSetID     uint64     `json:"base-set-id,omitempty"`
+	EncryptionKey string     `json:"encryption-key,omitempty"`
+	Schedule      string     `json:"schedule,omitempty"`
+	DryRun        bool       `json:"dry-run,omitempty"`
 }
 
 // Install adds the snap with the given name from the given channel (or
@@ -133,9 +156,34 @@ func (client *Client) Switch(name string, options *SnapOptions) (changeID string
 	return client.doSnapAction("switch", name, options)
 }
 
-// SnapshotMany snapshots many snaps (all, if names empty) for many users (all, if users is empty).
-func (client *Client) SnapshotMany(names []string, users []string) (setID uint64, changeID string, err error) {
-	result, changeID, err := client.doMultiSnapActionFull("snapshot", names, &SnapOptions{Users: users})
+// SnapshotOptions holds the options for SnapshotMany.
+type SnapshotOptions struct {
+	// Users whose data to save; all of them, if empty.
+	Users []string
+	// Compression to use for the archives ("none", "gzip" or "gzip-fast");
+	// the server picks the default if empty.
+	Compression string
+	// BaseSetID, if non-zero, makes the snapshots incremental on
+	// the ones in that snapshot set.
+	BaseSetID uint64
+	// EncryptionKey, if not empty, is the hex-encoded key to encrypt
+	// the snapshots with, instead of the server's configured one.
+	EncryptionKey string
+}
+
+// SnapshotMany snapshots many snaps (all, if names empty) for many users (all, if options.Users is empty).
+func (client *Client) SnapshotMany(names []string, options *SnapshotOptions) (setID uint64, changeID string, err error) {
+	action := multiActionData{
+		Action: "snapshot",
+		Snaps:  names,
+	}
+	if options != nil {
+		action.Users = options.Users
+		action.Compression = options.Compression
+		action.BaseSetID = options.BaseSetID
+		action.EncryptionKey = options.EncryptionKey
+	}
+	result, changeID, err := client.doMultiSnapActionData(&action)
 	if err != nil {
 		return 0, "", err
 	}
@@ -151,6 +199,99 @@ func (client *Client) SnapshotMany(names []string, users []string) (setID uint64
 	return x.SetID, changeID, nil
 }
 
+// HoldRefreshes holds the auto-refreshes of the given snaps until the
+// given time, or indefinitely if until is the zero time.
+func (client *Client) HoldRefreshes(names []string, until time.Time) (changeID string, err error) {
+	action := multiActionData{
+		Action: "hold",
+		Snaps:  names,
+	}
+	if !until.IsZero() {
+		action.HoldUntil = &until
+	}
+	_, changeID, err = client.doMultiSnapActionData(&action)
+	return changeID, err
+}
+
+// UnholdRefreshes removes the auto-refresh holds of the given snaps.
+func (client *Client) UnholdRefreshes(names []string) (changeID string, err error) {
+	return client.doMultiSnapAction("unhold", names, nil)
+}
+
+// A SnapOpPlan describes what a snap operation would do.
+type SnapOpPlan struct {
+	Summary  string   `json:"summary"`
+	Affected []string `json:"affected,omitempty"`
+	// Tasks are the tasks the change would have, in order.
+	Tasks []*PlannedTask `json:"tasks"`
+	// Downloads are the snaps that would be fetched from the store.
+	Downloads    []*PlannedDownload `json:"downloads,omitempty"`
+	DownloadSize int64              `json:"download-size"`
+	// Services are the services of installed snaps that would be
+	// stopped or started.
+	Services []string `json:"services,omitempty"`
+}
+
+// A PlannedTask is a task a snap operation would run.
+type PlannedTask struct {
+	// ID identifies the task within the plan only.
+	ID      string   `json:"id"`
+	Kind    string   `json:"kind"`
+	Summary string   `json:"summary"`
+	WaitFor []string `json:"wait-for,omitempty"`
+	Snap    string   `json:"snap,omitempty"`
+}
+
+// A PlannedDownload is a snap a snap operation would fetch.
+type PlannedDownload struct {
+	// Action is the store action, either "install" or "refresh".
+	Action   string `json:"action"`
+	Snap     string `json:"snap"`
+	SnapID   string `json:"snap-id,omitempty"`
+	Revision string `json:"revision"`
+	Channel  string `json:"channel,omitempty"`
+	Size     int64  `json:"size,omitempty"`
+}
+
+// DryRun reports what installing, refreshing or removing the given
+// snaps would do, without doing it. Options are only supported with
+// exactly one snap; with none, a refresh considers all snaps.
+func (client *Client) DryRun(actionName string, names []string, options *SnapOptions) (*SnapOpPlan, error) {
+	var path string
+	var data []byte
+	var err error
+	if len(names) == 1 {
+		path = fmt.Sprintf("/v2/snaps/%s", names[0])
+		data, err = json.Marshal(&actionData{
+			Action:      actionName,
+			DryRun:      true,
+			SnapOptions: options,
+		})
+	} else {
+		if options != nil && !options.onlySchedule() {
+			return nil, fmt.Errorf("cannot use options for multi-action")
+		}
+		path = "/v2/snaps"
+		data, err = json.Marshal(&multiActionData{
+			Action: actionName,
+			Snaps:  names,
+			DryRun: true,
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal snap action: %s", err)
+	}
+
+	headers := map[string]string{
+		"Content-Type": "application/json",
+	}
+	var plan SnapOpPlan
+	if _, err := client.doSync("POST", path, nil, headers, bytes.NewBuffer(data), &plan); err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
 var ErrDangerousNotApplicable = fmt.Errorf("dangerous option only meaningful when installing from a local file")
 
 func (client *Client) doSnapAction(actionName string, snapName string, options *SnapOptions) (changeID string, err error) {
@@ -175,7 +316,7 @@ func (client *Client) doSnapAction(actionName string, snapName string, options *
 }
 
 func (client *Client) doMultiSnapAction(actionName string, snaps []string, options *SnapOptions) (changeID string, err error) {
-	if options != nil {
+	if options != nil && !options.onlySchedule() {
 		return "", fmt.Errorf("cannot use options for multi-action") // (yet)
 	}
 	_, changeID, err = client.doMultiSnapActionFull(actionName, snaps, options)
@@ -190,8 +331,13 @@ func (client *Client) doMultiSnapActionFull(actionName string, snaps []string, o
 	}
 	if options != nil {
 		action.Users = options.Users
+		action.Schedule = options.Schedule
 	}
-	data, err := json.Marshal(&action)
+	return client.doMultiSnapActionData(&action)
+}
+
+func (client *Client) doMultiSnapActionData(action *multiActionData) (result json.RawMessage, changeID string, err error) {
+	data, err := json.Marshal(action)
 	if err != nil {
 		return nil, "", fmt.Errorf("cannot marshal multi-snap action: %s", err)
 	}
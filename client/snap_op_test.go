@@ -28,6 +28,7 @@ import (
 	"mime"
 	"mime/multipart"
 	"path/filepath"
+	"time"
 
 	"gopkg.in/check.v1"
 
@@ -177,6 +178,100 @@ func (cs *clientSuite) TestClientMultiOpSnap(c *check.C) {
 	}
 }
 
+func (cs *clientSuite) TestClientMultiOpSnapScheduled(c *check.C) {
+	cs.rsp = `{
+		"change": "d728",
+		"status-code": 202,
+		"type": "async"
+	}`
+	for _, s := range multiOps {
+		_, err := s.op(cs.cli, []string{pkgName}, &client.SnapOptions{Schedule: "mon,10:00-12:00"})
+		c.Assert(err, check.IsNil, check.Commentf(s.action))
+
+		body, err := ioutil.ReadAll(cs.req.Body)
+		c.Assert(err, check.IsNil, check.Commentf(s.action))
+		jsonBody := make(map[string]interface{})
+		err = json.Unmarshal(body, &jsonBody)
+		c.Assert(err, check.IsNil, check.Commentf(s.action))
+		c.Check(jsonBody, check.DeepEquals, map[string]interface{}{
+			"action":   s.action,
+			"snaps":    []interface{}{pkgName},
+			"schedule": "mon,10:00-12:00",
+		}, check.Commentf(s.action))
+	}
+}
+
+func (cs *clientSuite) TestClientMultiOpSnapOtherOptions(c *check.C) {
+	for _, s := range multiOps {
+		_, err := s.op(cs.cli, []string{pkgName}, &client.SnapOptions{Schedule: "mon", Channel: "edge"})
+		c.Check(err, check.ErrorMatches, "cannot use options for multi-action", check.Commentf(s.action))
+	}
+}
+
+func (cs *clientSuite) TestClientDryRunOne(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"result": {
+			"summary": "Refresh foo",
+			"affected": ["foo"],
+			"tasks": [
+				{"id": "1", "kind": "download-snap", "summary": "Download foo", "snap": "foo"},
+				{"id": "2", "kind": "link-snap", "summary": "Link foo", "wait-for": ["1"], "snap": "foo"}
+			],
+			"downloads": [{"action": "refresh", "snap": "foo", "snap-id": "foo-id", "revision": "7", "channel": "beta", "size": 1024}],
+			"download-size": 1024,
+			"services": ["snap.foo.svc.service"]
+		}
+	}`
+	plan, err := cs.cli.DryRun("refresh", []string{"foo"}, &client.SnapOptions{Channel: "beta"})
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/snaps/foo")
+	body, err := ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, check.IsNil)
+	var jsonBody map[string]interface{}
+	c.Assert(json.Unmarshal(body, &jsonBody), check.IsNil)
+	c.Check(jsonBody, check.DeepEquals, map[string]interface{}{
+		"action":  "refresh",
+		"dry-run": true,
+		"channel": "beta",
+	})
+
+	c.Check(plan, check.DeepEquals, &client.SnapOpPlan{
+		Summary:  "Refresh foo",
+		Affected: []string{"foo"},
+		Tasks: []*client.PlannedTask{
+			{ID: "1", Kind: "download-snap", Summary: "Download foo", Snap: "foo"},
+			{ID: "2", Kind: "link-snap", Summary: "Link foo", WaitFor: []string{"1"}, Snap: "foo"},
+		},
+		Downloads: []*client.PlannedDownload{
+			{Action: "refresh", Snap: "foo", SnapID: "foo-id", Revision: "7", Channel: "beta", Size: 1024},
+		},
+		DownloadSize: 1024,
+		Services:     []string{"snap.foo.svc.service"},
+	})
+}
+
+func (cs *clientSuite) TestClientDryRunMany(c *check.C) {
+	cs.rsp = `{"type": "sync", "result": {"summary": "Refresh all snaps: no updates", "tasks": []}}`
+	plan, err := cs.cli.DryRun("refresh", nil, nil)
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/snaps")
+	body, err := ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, check.IsNil)
+	var jsonBody map[string]interface{}
+	c.Assert(json.Unmarshal(body, &jsonBody), check.IsNil)
+	c.Check(jsonBody, check.DeepEquals, map[string]interface{}{
+		"action":  "refresh",
+		"dry-run": true,
+	})
+	c.Check(plan.Summary, check.Equals, "Refresh all snaps: no updates")
+	c.Check(plan.Tasks, check.HasLen, 0)
+
+	_, err = cs.cli.DryRun("refresh", []string{"foo", "bar"}, &client.SnapOptions{Channel: "beta"})
+	c.Check(err, check.ErrorMatches, "cannot use options for multi-action")
+}
+
 func (cs *clientSuite) TestClientMultiSnapshot(c *check.C) {
 	// Note body is essentially the same as TestClientMultiOpSnap; keep in sync
 	cs.rsp = `{
@@ -202,6 +297,94 @@ func (cs *clientSuite) TestClientMultiSnapshot(c *check.C) {
 	c.Check(changeID, check.Equals, "d728")
 }
 
+func (cs *clientSuite) TestClientMultiSnapshotOptions(c *check.C) {
+	cs.rsp = `{
+		"result": {"set-id": 43},
+		"change": "d728",
+		"status-code": 202,
+		"type": "async"
+	}`
+	setID, _, err := cs.cli.SnapshotMany([]string{pkgName}, &client.SnapshotOptions{
+		Users:         []string{"a-user"},
+		Compression:   "none",
+		BaseSetID:     42,
+		EncryptionKey: "0123",
+	})
+	c.Assert(err, check.IsNil)
+	c.Check(setID, check.Equals, uint64(43))
+
+	body, err := ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, check.IsNil)
+	jsonBody := make(map[string]interface{})
+	err = json.Unmarshal(body, &jsonBody)
+	c.Assert(err, check.IsNil)
+	c.Check(jsonBody, check.DeepEquals, map[string]interface{}{
+		"action":         "snapshot",
+		"snaps":          []interface{}{pkgName},
+		"users":          []interface{}{"a-user"},
+		"compression":    "none",
+		"base-set-id":    42.,
+		"encryption-key": "0123",
+	})
+}
+
+func (cs *clientSuite) TestClientHoldRefreshes(c *check.C) {
+	cs.rsp = `{
+		"change": "d728",
+		"status-code": 202,
+		"type": "async"
+	}`
+	until := time.Date(2019, 4, 1, 10, 0, 0, 0, time.UTC)
+	for _, t := range []struct {
+		until time.Time
+		body  map[string]interface{}
+	}{
+		{time.Time{}, map[string]interface{}{
+			"action": "hold",
+			"snaps":  []interface{}{pkgName},
+		}},
+		{until, map[string]interface{}{
+			"action":     "hold",
+			"snaps":      []interface{}{pkgName},
+			"hold-until": "2019-04-01T10:00:00Z",
+		}},
+	} {
+		changeID, err := cs.cli.HoldRefreshes([]string{pkgName}, t.until)
+		c.Assert(err, check.IsNil)
+		c.Check(changeID, check.Equals, "d728")
+		c.Check(cs.req.URL.Path, check.Equals, "/v2/snaps")
+		c.Check(cs.req.Header.Get("Content-Type"), check.Equals, "application/json")
+
+		body, err := ioutil.ReadAll(cs.req.Body)
+		c.Assert(err, check.IsNil)
+		jsonBody := make(map[string]interface{})
+		err = json.Unmarshal(body, &jsonBody)
+		c.Assert(err, check.IsNil)
+		c.Check(jsonBody, check.DeepEquals, t.body)
+	}
+}
+
+func (cs *clientSuite) TestClientUnholdRefreshes(c *check.C) {
+	cs.rsp = `{
+		"change": "d728",
+		"status-code": 202,
+		"type": "async"
+	}`
+	changeID, err := cs.cli.UnholdRefreshes([]string{pkgName})
+	c.Assert(err, check.IsNil)
+	c.Check(changeID, check.Equals, "d728")
+
+	body, err := ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, check.IsNil)
+	jsonBody := make(map[string]interface{})
+	err = json.Unmarshal(body, &jsonBody)
+	c.Assert(err, check.IsNil)
+	c.Check(jsonBody, check.DeepEquals, map[string]interface{}{
+		"action": "unhold",
+		"snaps":  []interface{}{pkgName},
+	})
+}
+
 func (cs *clientSuite) TestClientOpInstallPath(c *check.C) {
 	cs.rsp = `{
 		"change": "66b3",
@@ -328,6 +511,27 @@ func (cs *clientSuite) TestClientOpInstallUnaliased(c *check.C) {
 	c.Assert(string(body), check.Matches, "(?s).*Content-Disposition: form-data; name=\"unaliased\"\r\n\r\ntrue\r\n.*")
 }
 
+func (cs *clientSuite) TestClientOpRemovePurge(c *check.C) {
+	cs.rsp = `{
+		"change": "66b3",
+		"status-code": 202,
+		"type": "async"
+	}`
+
+	_, err := cs.cli.Remove("foo", &client.SnapOptions{Purge: true})
+	c.Assert(err, check.IsNil)
+
+	body, err := ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, check.IsNil)
+	jsonBody := make(map[string]interface{})
+	err = json.Unmarshal(body, &jsonBody)
+	c.Assert(err, check.IsNil, check.Commentf("body: %v", string(body)))
+	c.Check(jsonBody, check.DeepEquals, map[string]interface{}{
+		"action": "remove",
+		"purge":  true,
+	})
+}
+
 func formToMap(c *check.C, mr *multipart.Reader) map[string]string {
 	formData := map[string]string{}
 	for {
@@ -24,7 +24,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/url"
+	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -32,6 +34,9 @@ import (
 	"github.com/snapcore/snapd/snap"
 )
 
+// SnapshotExportMediaType is the media type of an exported snapshot set.
+const SnapshotExportMediaType = "application/x.snapd.snapshot"
+
 var (
 	ErrSnapshotSetNotFound   = errors.New("no snapshot set with the given ID")
 	ErrSnapshotSnapsNotFound = errors.New("no snapshot for the requested snaps found in the set with the given ID")
@@ -43,6 +48,10 @@ type snapshotAction struct {
 	Action string   `json:"action"`
 	Snaps  []string `json:"snaps,omitempty"`
 	Users  []string `json:"users,omitempty"`
+	Paths  []string `json:"paths,omitempty"`
+	Target string   `json:"target,omitempty"`
+
+	EncryptionKey string `json:"encryption-key,omitempty"`
 }
 
 // A Snapshot is a collection of archives with a simple metadata json file
@@ -61,12 +70,16 @@ type Snapshot struct {
 	Summary  string        `json:"summary"`
 	Version  string        `json:"version"`
 
-	// the snap's configuration at snapshot time
+	// the snap's configuration at snapshot time (for an encrypted
+	// snapshot it is only available once the snapshot is decrypted)
 	Conf map[string]interface{} `json:"conf,omitempty"`
 
 	// the hash of the archives' data, keyed by archive path
-	// (either 'archive.tgz' for the system archive, or
-	// user/<username>.tgz for each user)
+	// (either 'archive.tgz' or 'archive.tar' for the system archive,
+	// or user/<username>.tgz or user/<username>.tar for each user,
+	// plus a matching '.snar' entry for each archive that can be used
+	// as the base of an incremental snapshot, and 'config.json' for
+	// the configuration of an encrypted snapshot)
 	SHA3_384 map[string]string `json:"sha3-384"`
 	// the sum of the archive sizes
 	Size int64 `json:"size,omitempty"`
@@ -75,6 +88,12 @@ type Snapshot struct {
 
 	// set if the snapshot was created automatically on snap removal
 	Auto bool `json:"auto,omitempty"`
+	// if set, the snapshot only holds the changes since the snapshot
+	// of the same snap in this snapshot set
+	BaseSetID uint64 `json:"base-set-id,omitempty"`
+	// if set, the snapshot's data is encrypted, with the key this
+	// identifies
+	KeyID string `json:"key-id,omitempty"`
 }
 
 // IsValid checks whether the snapshot is missing information that
@@ -141,26 +160,50 @@ func (client *Client) ForgetSnapshots(setID uint64, snaps []string) (changeID st
 // CheckSnapshots verifies the archive checksums in the given snapshot set.
 //
 // If snaps or users are non-empty, limit to checking only those
-// archives of the snapshot.
-func (client *Client) CheckSnapshots(setID uint64, snaps []string, users []string) (changeID string, err error) {
+// archives of the snapshot. If encryptionKey is not empty, it is the
+// hex-encoded key to check encrypted snapshots with, instead of the
+// server's configured one; with a key the data is also authenticated.
+func (client *Client) CheckSnapshots(setID uint64, snaps []string, users []string, encryptionKey string) (changeID string, err error) {
 	return client.snapshotAction(&snapshotAction{
-		SetID:  setID,
-		Action: "check",
-		Snaps:  snaps,
-		Users:  users,
+		SetID:         setID,
+		Action:        "check",
+		Snaps:         snaps,
+		Users:         users,
+		EncryptionKey: encryptionKey,
 	})
 }
 
 // RestoreSnapshots extracts the given snapshot set.
 //
 // If snaps or users are non-empty, limit to checking only those
-// archives of the snapshot.
-func (client *Client) RestoreSnapshots(setID uint64, snaps []string, users []string) (changeID string, err error) {
+// archives of the snapshot. If encryptionKey is not empty, it is the
+// hex-encoded key to decrypt encrypted snapshots with, instead of the
+// server's configured one.
+func (client *Client) RestoreSnapshots(setID uint64, snaps []string, users []string, encryptionKey string) (changeID string, err error) {
 	return client.snapshotAction(&snapshotAction{
-		SetID:  setID,
-		Action: "restore",
-		Snaps:  snaps,
-		Users:  users,
+		SetID:         setID,
+		Action:        "restore",
+		Snaps:         snaps,
+		Users:         users,
+		EncryptionKey: encryptionKey,
+	})
+}
+
+// RestoreSnapshotFiles extracts the files matching the given glob
+// patterns from the given snapshot set into the target directory, instead
+// of replacing the snaps' data.
+//
+// If snaps or users are non-empty, limit to only those archives of the
+// snapshot. The encryptionKey is as for RestoreSnapshots.
+func (client *Client) RestoreSnapshotFiles(setID uint64, snaps []string, users []string, paths []string, target string, encryptionKey string) (changeID string, err error) {
+	return client.snapshotAction(&snapshotAction{
+		SetID:         setID,
+		Action:        "restore",
+		Snaps:         snaps,
+		Users:         users,
+		Paths:         paths,
+		Target:        target,
+		EncryptionKey: encryptionKey,
 	})
 }
 
@@ -176,3 +219,82 @@ func (client *Client) snapshotAction(action *snapshotAction) (changeID string, e
 
 	return client.doAsync("POST", "/v2/snapshots", nil, headers, bytes.NewBuffer(data))
 }
+
+// A SnapshotFile is a file, directory, or symlink in a snapshot.
+type SnapshotFile struct {
+	// User is the user whose data the file is in; empty for system data.
+	User string `json:"user,omitempty"`
+	// Path is relative to the snap's data directory for the user
+	// (e.g. "42/config.yaml", or "common/cache").
+	Path    string      `json:"path"`
+	Size    int64       `json:"size"`
+	Mode    os.FileMode `json:"mode"`
+	ModTime time.Time   `json:"mtime"`
+	// Link is the target of a symlink.
+	Link string `json:"link,omitempty"`
+	// SetID is the snapshot set the file's contents are in; it is
+	// that of a base set if the file did not change since then.
+	SetID uint64 `json:"set"`
+}
+
+// SnapshotFiles lists the files in the snapshot of the given snap in the
+// given set, limited to those of the given users (if non-empty). The
+// encryptionKey is as for RestoreSnapshots.
+func (client *Client) SnapshotFiles(setID uint64, snap string, users []string, encryptionKey string) ([]SnapshotFile, error) {
+	q := make(url.Values)
+	if len(users) > 0 {
+		q.Add("users", strings.Join(users, ","))
+	}
+	var headers map[string]string
+	if encryptionKey != "" {
+		headers = map[string]string{"X-Snapshot-Encryption-Key": encryptionKey}
+	}
+
+	var files []SnapshotFile
+	_, err := client.doSync("GET", fmt.Sprintf("/v2/snapshots/%d/%s/files", setID, snap), q, headers, nil, &files)
+	return files, err
+}
+
+// A SnapshotImportSet is the result of importing a snapshot set.
+type SnapshotImportSet struct {
+	// ID is the ID of the newly created snapshot set
+	ID uint64 `json:"set-id"`
+	// Snaps are the snaps with snapshots in the imported set
+	Snaps []string `json:"snaps"`
+}
+
+// SnapshotExport streams the requested snapshot set.
+//
+// The caller must close the returned reader when done.
+func (client *Client) SnapshotExport(setID uint64) (io.ReadCloser, error) {
+	rsp, err := client.raw("GET", fmt.Sprintf("/v2/snapshots/%d/export", setID), nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if rsp.StatusCode != 200 {
+		defer rsp.Body.Close()
+		return nil, parseError(rsp)
+	}
+	if contentType := rsp.Header.Get("Content-Type"); contentType != SnapshotExportMediaType {
+		rsp.Body.Close()
+		return nil, fmt.Errorf("unexpected snapshot export content type %q", contentType)
+	}
+
+	return rsp.Body, nil
+}
+
+// SnapshotImport imports an exported snapshot set as a new snapshot set.
+func (client *Client) SnapshotImport(exportStream io.Reader) (*SnapshotImportSet, error) {
+	headers := map[string]string{
+		"Content-Type": SnapshotExportMediaType,
+	}
+
+	q := url.Values{"action": []string{"import"}}
+
+	var importSet SnapshotImportSet
+	if _, err := client.doSync("POST", "/v2/snapshots", q, headers, exportStream, &importSet); err != nil {
+		return nil, err
+	}
+
+	return &importSet, nil
+}
@@ -20,7 +20,10 @@
 package client_test
 
 import (
+	"io/ioutil"
+	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
 	"gopkg.in/check.v1"
@@ -123,9 +126,9 @@ func (cs *clientSuite) TestClientForgetSnapshot(c *check.C) {
 	})
 }
 
-func (cs *clientSuite) testClientSnapshotAction(c *check.C, action string, f func(uint64, []string, []string) (string, error)) {
+func (cs *clientSuite) testClientSnapshotAction(c *check.C, action string, f func(uint64, []string, []string, string) (string, error)) {
 	cs.testClientSnapshotActionFull(c, action, []string{"auser", "buser"}, func() (string, error) {
-		return f(42, []string{"asnap", "bsnap"}, []string{"auser", "buser"})
+		return f(42, []string{"asnap", "bsnap"}, []string{"auser", "buser"}, "")
 	})
 }
 
@@ -136,3 +139,108 @@ func (cs *clientSuite) TestClientCheckSnapshots(c *check.C) {
 func (cs *clientSuite) TestClientRestoreSnapshots(c *check.C) {
 	cs.testClientSnapshotAction(c, "restore", cs.cli.RestoreSnapshots)
 }
+
+func (cs *clientSuite) TestClientSnapshotActionEncryptionKey(c *check.C) {
+	cs.rsp = `{
+		"status-code": 202,
+		"type": "async",
+		"change": "1too3"
+	}`
+	_, err := cs.cli.RestoreSnapshots(42, nil, nil, "0123")
+	c.Assert(err, check.IsNil)
+
+	act, err := client.UnmarshalSnapshotAction(cs.req.Body)
+	c.Assert(err, check.IsNil)
+	c.Check(act.Action, check.Equals, "restore")
+	c.Check(act.EncryptionKey, check.Equals, "0123")
+}
+
+func (cs *clientSuite) TestClientRestoreSnapshotFiles(c *check.C) {
+	cs.rsp = `{
+		"status-code": 202,
+		"type": "async",
+		"change": "1too3"
+	}`
+	id, err := cs.cli.RestoreSnapshotFiles(42, []string{"asnap"}, []string{"auser"}, []string{"42/*"}, "/tmp/restored", "")
+	c.Assert(err, check.IsNil)
+	c.Check(id, check.Equals, "1too3")
+
+	act, err := client.UnmarshalSnapshotAction(cs.req.Body)
+	c.Assert(err, check.IsNil)
+	c.Check(act.SetID, check.Equals, uint64(42))
+	c.Check(act.Action, check.Equals, "restore")
+	c.Check(act.Snaps, check.DeepEquals, []string{"asnap"})
+	c.Check(act.Users, check.DeepEquals, []string{"auser"})
+	c.Check(act.Paths, check.DeepEquals, []string{"42/*"})
+	c.Check(act.Target, check.Equals, "/tmp/restored")
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/snapshots")
+}
+
+func (cs *clientSuite) TestClientSnapshotFiles(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"result": [
+			{"user": "auser", "path": "42/foo", "size": 5, "mode": 420, "mtime": "2019-06-01T12:00:00Z", "set": 41},
+			{"path": "common/bar", "size": 0, "mode": 511, "mtime": "2019-06-01T12:00:00Z", "link": "foo", "set": 42}
+		]
+	}`
+	files, err := cs.cli.SnapshotFiles(42, "asnap", []string{"auser"}, "0123")
+	c.Assert(err, check.IsNil)
+	c.Check(files, check.DeepEquals, []client.SnapshotFile{
+		{User: "auser", Path: "42/foo", Size: 5, Mode: 0644, ModTime: time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC), SetID: 41},
+		{Path: "common/bar", Mode: 0777, ModTime: time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC), Link: "foo", SetID: 42},
+	})
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/snapshots/42/asnap/files")
+	c.Check(cs.req.Header.Get("X-Snapshot-Encryption-Key"), check.Equals, "0123")
+	c.Check(cs.req.URL.Query(), check.DeepEquals, url.Values{
+		"users": []string{"auser"},
+	})
+}
+
+func (cs *clientSuite) TestClientSnapshotExport(c *check.C) {
+	cs.header = http.Header{"Content-Type": []string{client.SnapshotExportMediaType}}
+	cs.rsp = "exported snapshot set"
+	r, err := cs.cli.SnapshotExport(42)
+	c.Assert(err, check.IsNil)
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	c.Assert(err, check.IsNil)
+	c.Check(string(data), check.Equals, "exported snapshot set")
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/snapshots/42/export")
+}
+
+func (cs *clientSuite) TestClientSnapshotExportError(c *check.C) {
+	cs.header = http.Header{"Content-Type": []string{"application/json"}}
+	cs.status = 404
+	cs.rsp = `{"type": "error", "status-code": 404, "result": {"message": "no snapshot set with the given ID"}}`
+	_, err := cs.cli.SnapshotExport(42)
+	c.Check(err, check.ErrorMatches, "no snapshot set with the given ID")
+}
+
+func (cs *clientSuite) TestClientSnapshotExportBadContentType(c *check.C) {
+	cs.header = http.Header{"Content-Type": []string{"text/plain"}}
+	cs.rsp = "hello"
+	_, err := cs.cli.SnapshotExport(42)
+	c.Check(err, check.ErrorMatches, `unexpected snapshot export content type "text/plain"`)
+}
+
+func (cs *clientSuite) TestClientSnapshotImport(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"result": {"set-id": 7, "snaps": ["asnap", "bsnap"]}
+	}`
+	importSet, err := cs.cli.SnapshotImport(strings.NewReader("exported snapshot set"))
+	c.Assert(err, check.IsNil)
+	c.Check(importSet, check.DeepEquals, &client.SnapshotImportSet{ID: 7, Snaps: []string{"asnap", "bsnap"}})
+
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/snapshots")
+	c.Check(cs.req.URL.Query(), check.DeepEquals, url.Values{"action": []string{"import"}})
+	c.Check(cs.req.Header.Get("Content-Type"), check.Equals, client.SnapshotExportMediaType)
+	data, err := ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, check.IsNil)
+	c.Check(string(data), check.Equals, "exported snapshot set")
+}
@@ -23,6 +23,8 @@ import (
 	"fmt"
 	"regexp"
 	"sort"
+	"strings"
+	"time"
 
 	"github.com/snapcore/snapd/client"
 	"github.com/snapcore/snapd/i18n"
@@ -34,6 +36,10 @@ var shortChangesHelp = i18n.G("List system changes")
 var shortTasksHelp = i18n.G("List a change's tasks")
 var longChangesHelp = i18n.G(`
 The changes command displays a summary of system changes performed recently.
+
+With --archived, changes are instead looked up in the journal of changes
+that were completed, which keeps them after they are no longer shown
+otherwise.
 `)
 var longTasksHelp = i18n.G(`
 The tasks command displays a summary of tasks associated with an individual
@@ -43,6 +49,9 @@ change.
 type cmdChanges struct {
 	clientMixin
 	timeMixin
+	Archived   bool   `long:"archived"`
+	Since      string `long:"since"`
+	Kind       string `long:"kind"`
 	Positional struct {
 		Snap string `positional-arg-name:"<snap>"`
 	} `positional-args:"yes"`
@@ -55,7 +64,14 @@ type cmdTasks struct {
 
 func init() {
 	addCommand("changes", shortChangesHelp, longChangesHelp,
-		func() flags.Commander { return &cmdChanges{} }, timeDescs, nil)
+		func() flags.Commander { return &cmdChanges{} }, timeDescs.also(map[string]string{
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"archived": i18n.G("Show changes from the journal of completed changes"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"since": i18n.G("Only show archived changes completed since the given time (RFC 3339) or duration ago (e.g. 24h)"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"kind": i18n.G("Only show archived changes of the given kind"),
+		}), nil)
 	addCommand("tasks", shortTasksHelp, longTasksHelp,
 		func() flags.Commander { return &cmdTasks{} },
 		changeIDMixinOptDesc.also(timeDescs),
@@ -81,6 +97,12 @@ func queryChanges(cli *client.Client, opts *client.ChangesOptions) ([]*client.Ch
 	return chgs, nil
 }
 
+// isScheduled returns whether the change is waiting for its schedule
+// to start.
+func isScheduled(chg *client.Change) bool {
+	return !chg.Ready && chg.Status == "Do" && chg.ScheduledTime.After(timeNow())
+}
+
 func (c *cmdChanges) Execute(args []string) error {
 	if len(args) > 0 {
 		return ErrExtraArgs
@@ -100,6 +122,19 @@ func (c *cmdChanges) Execute(args []string) error {
 		SnapName: c.Positional.Snap,
 		Selector: client.ChangesAll,
 	}
+	if c.Archived {
+		opts.Selector = client.ChangesArchived
+		opts.Kind = c.Kind
+		if c.Since != "" {
+			since, err := parseTimeAgo("--since", c.Since)
+			if err != nil {
+				return err
+			}
+			opts.Since = since
+		}
+	} else if c.Since != "" || c.Kind != "" {
+		return fmt.Errorf(i18n.G("--since and --kind can only be used with --archived"))
+	}
 
 	changes, err := queryChanges(c.client, &opts)
 	if err != nil {
@@ -121,7 +156,14 @@ func (c *cmdChanges) Execute(args []string) error {
 		if chg.ReadyTime.IsZero() {
 			readyTime = "-"
 		}
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", chg.ID, chg.Status, spawnTime, readyTime, chg.Summary)
+		status := chg.Status
+		switch {
+		case chg.Paused:
+			status = i18n.G("Paused")
+		case isScheduled(chg):
+			status = i18n.G("Scheduled")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s%s\n", chg.ID, status, spawnTime, readyTime, chg.Summary, refreshHealth(chg))
 	}
 
 	w.Flush()
@@ -130,6 +172,38 @@ func (c *cmdChanges) Execute(args []string) error {
 	return nil
 }
 
+// refreshHealth returns the outcome of the health checks of the snaps
+// refreshed by a staged refresh change, if any.
+func refreshHealth(chg *client.Change) string {
+	var health map[string]string
+	if err := chg.Get("refresh-health", &health); err != nil || len(health) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(health))
+	for name := range health {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	outcomes := make([]string, len(names))
+	for i, name := range names {
+		outcomes[i] = fmt.Sprintf("%s: %s", name, health[name])
+	}
+	return " (" + strings.Join(outcomes, ", ") + ")"
+}
+
+// parseTimeAgo parses the value of the given option as either a time
+// or a duration ago.
+func parseTimeAgo(opt, s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return time.Time{}, fmt.Errorf(i18n.G(`cannot use %s %q: expected a time in RFC 3339 format or a positive duration (e.g. 24h)`), opt, s)
+	}
+	return timeNow().Add(-d), nil
+}
+
 func (c *cmdTasks) Execute([]string) error {
 	chid, err := c.GetChangeID()
 	if err != nil {
@@ -159,9 +233,22 @@ func (c *cmdTasks) showChange(chid string) error {
 		return err
 	}
 
+	// only bother with retries when some task had them
+	showRetries := false
+	for _, t := range chg.Tasks {
+		if t.Retries > 0 {
+			showRetries = true
+			break
+		}
+	}
+
 	w := tabWriter()
 
-	fmt.Fprintf(w, i18n.G("Status\tSpawn\tReady\tSummary\n"))
+	if showRetries {
+		fmt.Fprintf(w, i18n.G("Status\tSpawn\tReady\tRetries\tSummary\n"))
+	} else {
+		fmt.Fprintf(w, i18n.G("Status\tSpawn\tReady\tSummary\n"))
+	}
 	for _, t := range chg.Tasks {
 		spawnTime := c.fmtTime(t.SpawnTime)
 		readyTime := c.fmtTime(t.ReadyTime)
@@ -172,7 +259,11 @@ func (c *cmdTasks) showChange(chid string) error {
 		if t.Status == "Doing" && t.Progress.Total > 1 {
 			summary = fmt.Sprintf("%s (%.2f%%)", summary, float64(t.Progress.Done)/float64(t.Progress.Total)*100.0)
 		}
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", t.Status, spawnTime, readyTime, summary)
+		if showRetries {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", t.Status, spawnTime, readyTime, t.Retries, summary)
+		} else {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", t.Status, spawnTime, readyTime, summary)
+		}
 	}
 
 	w.Flush()
@@ -22,7 +22,9 @@ package main_test
 import (
 	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
+	"time"
 
 	"gopkg.in/check.v1"
 
@@ -131,6 +133,34 @@ var mockChangesJSON = `{"type": "sync", "result": [
   }
 ]}`
 
+func (s *SnapSuite) TestChangeRetries(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "GET")
+		c.Check(r.URL.Path, check.Equals, "/v2/changes/42")
+		fmt.Fprintln(w, `{"type": "sync", "result": {
+  "id":   "42",
+  "kind": "foo",
+  "summary": "...",
+  "status": "Doing",
+  "ready": false,
+  "spawn-time": "2016-04-21T01:02:03Z",
+  "tasks": [
+    {"kind": "bar", "summary": "some summary", "status": "Done", "progress": {"done": 1, "total": 1}, "spawn-time": "2016-04-21T01:02:03Z", "ready-time": "2016-04-21T01:02:04Z"},
+    {"kind": "baz", "summary": "other summary", "status": "Doing", "progress": {"done": 0, "total": 1}, "retries": 3, "spawn-time": "2016-04-21T01:02:03Z"}
+  ]
+}}`)
+	})
+	expectedChange := `(?ms)Status +Spawn +Ready +Retries +Summary
+Done +2016-04-21T01:02:03Z +2016-04-21T01:02:04Z +0 +some summary
+Doing +2016-04-21T01:02:03Z +- +3 +other summary
+`
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"tasks", "--abs-time", "42"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.DeepEquals, []string{})
+	c.Check(s.Stdout(), check.Matches, expectedChange)
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
 func (s *SnapSuite) TestTasksLast(c *check.C) {
 	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
 		c.Check(r.Method, check.Equals, "GET")
@@ -231,3 +261,160 @@ Doing +2016-04-21T01:02:03Z +2016-04-21T01:02:04Z +some summary \(50.00%\)
 `)
 	c.Check(s.Stderr(), check.Equals, "")
 }
+
+func (s *SnapSuite) TestChangesArchived(c *check.C) {
+	restore := snap.MockTimeNow(func() time.Time {
+		return time.Date(2016, 4, 22, 1, 2, 3, 0, time.UTC)
+	})
+	defer restore()
+
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch n {
+		case 0:
+			c.Check(r.Method, check.Equals, "GET")
+			c.Check(r.URL.Path, check.Equals, "/v2/changes")
+			c.Check(r.URL.Query(), check.DeepEquals, url.Values{
+				"select": []string{"archived"},
+				"for":    []string{"some-snap"},
+				"since":  []string{"2016-04-21T01:02:03Z"},
+				"kind":   []string{"install-snap"},
+			})
+			fmt.Fprintln(w, `{"type": "sync", "result": [{
+  "id": "two",
+  "kind": "install-snap",
+  "summary": "Install some-snap",
+  "status": "Done",
+  "ready": true,
+  "spawn-time": "2016-04-21T01:02:03Z",
+  "ready-time": "2016-04-21T01:02:04Z"
+}]}`)
+		default:
+			c.Fatalf("expected to get 1 request, now on %d", n+1)
+		}
+		n++
+	})
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"changes", "--archived", "--since=24h", "--kind=install-snap", "--abs-time", "some-snap"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.DeepEquals, []string{})
+	c.Check(s.Stdout(), check.Matches, `(?ms)ID +Status +Spawn +Ready +Summary
+two +Done +2016-04-21T01:02:03Z +2016-04-21T01:02:04Z +Install some-snap
+`)
+	c.Check(s.Stderr(), check.Equals, "")
+	c.Check(n, check.Equals, 1)
+}
+
+func (s *SnapSuite) TestChangesScheduled(c *check.C) {
+	restore := snap.MockTimeNow(func() time.Time {
+		return time.Date(2016, 4, 22, 1, 2, 3, 0, time.UTC)
+	})
+	defer restore()
+
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch n {
+		case 0:
+			c.Check(r.Method, check.Equals, "GET")
+			c.Check(r.URL.Path, check.Equals, "/v2/changes")
+			fmt.Fprintln(w, `{"type": "sync", "result": [{
+  "id": "one",
+  "kind": "refresh-snap",
+  "summary": "Refresh some-snap",
+  "status": "Do",
+  "ready": false,
+  "spawn-time": "2016-04-21T01:02:03Z",
+  "scheduled-time": "2016-04-25T10:00:00Z"
+}, {
+  "id": "two",
+  "kind": "refresh-snap",
+  "summary": "Refresh other-snap",
+  "status": "Doing",
+  "ready": false,
+  "spawn-time": "2016-04-21T01:02:04Z",
+  "scheduled-time": "2016-04-21T10:00:00Z"
+}]}`)
+		default:
+			c.Fatalf("expected to get 1 request, now on %d", n+1)
+		}
+		n++
+	})
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"changes", "--abs-time"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.DeepEquals, []string{})
+	c.Check(s.Stdout(), check.Matches, `(?ms)ID +Status +Spawn +Ready +Summary
+one +Scheduled +2016-04-21T01:02:03Z +- +Refresh some-snap
+two +Doing +2016-04-21T01:02:04Z +- +Refresh other-snap
+`)
+	c.Check(n, check.Equals, 1)
+}
+
+func (s *SnapSuite) TestChangesPaused(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "GET")
+		c.Check(r.URL.Path, check.Equals, "/v2/changes")
+		fmt.Fprintln(w, `{"type": "sync", "result": [{
+  "id": "one",
+  "kind": "refresh-snap",
+  "summary": "Refresh some-snap",
+  "status": "Doing",
+  "ready": false,
+  "paused": true,
+  "spawn-time": "2016-04-21T01:02:03Z"
+}]}`)
+	})
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"changes", "--abs-time"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.DeepEquals, []string{})
+	c.Check(s.Stdout(), check.Matches, `(?ms)ID +Status +Spawn +Ready +Summary
+one +Paused +2016-04-21T01:02:03Z +- +Refresh some-snap
+`)
+}
+
+func (s *SnapSuite) TestChangesRefreshHealth(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "GET")
+		c.Check(r.URL.Path, check.Equals, "/v2/changes")
+		fmt.Fprintln(w, `{"type": "sync", "result": [{
+  "id": "one",
+  "kind": "auto-refresh",
+  "summary": "Auto-refresh snaps \"foo\", \"bar\"",
+  "status": "Error",
+  "ready": true,
+  "spawn-time": "2016-04-21T01:02:03Z",
+  "ready-time": "2016-04-21T01:02:04Z",
+  "data": {"snap-names": ["foo", "bar"], "refresh-health": {"foo": "reverted", "bar": "healthy"}}
+}]}`)
+	})
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"changes", "--abs-time"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.DeepEquals, []string{})
+	c.Check(s.Stdout(), check.Matches, `(?ms)ID +Status +Spawn +Ready +Summary
+one +Error +2016-04-21T01:02:03Z +2016-04-21T01:02:04Z +Auto-refresh snaps "foo", "bar" \(bar: healthy, foo: reverted\)
+`)
+}
+
+func (s *SnapSuite) TestChangesArchivedSinceRFC3339(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Query().Get("since"), check.Equals, "2016-04-21T01:02:03Z")
+		fmt.Fprintln(w, `{"type": "sync", "result": []}`)
+	})
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"changes", "--archived", "--since=2016-04-21T01:02:03Z"})
+	c.Assert(err, check.ErrorMatches, "no changes found")
+}
+
+func (s *SnapSuite) TestChangesArchivedErrors(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Fatalf("unexpected request")
+	})
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"changes", "--archived", "--since=yesterday"})
+	c.Check(err, check.ErrorMatches, `cannot use --since "yesterday": expected a time in RFC 3339 format or a positive duration \(e.g. 24h\)`)
+
+	_, err = snap.Parser(snap.Client()).ParseArgs([]string{"changes", "--kind=install-snap"})
+	c.Check(err, check.ErrorMatches, `--since and --kind can only be used with --archived`)
+}
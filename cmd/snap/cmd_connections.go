@@ -84,6 +84,7 @@ type connection struct {
 	interfaceDeterminant string
 	manual               bool
 	gadget               bool
+	localPolicy          bool
 }
 
 func (cn connection) String() string {
@@ -94,6 +95,9 @@ func (cn connection) String() string {
 	if cn.gadget {
 		opts = append(opts, "gadget")
 	}
+	if cn.localPolicy {
+		opts = append(opts, "local-policy")
+	}
 	if len(opts) == 0 {
 		return "-"
 	}
@@ -169,6 +173,7 @@ func (x *cmdConnections) Execute(args []string) error {
 			slot:                 endpoint(conn.Slot.Snap, conn.Slot.Name),
 			manual:               conn.Manual,
 			gadget:               conn.Gadget,
+			localPolicy:          conn.LocalPolicy,
 			interfaceName:        conn.Interface,
 			interfaceDeterminant: interfaceDeterminant(&conn),
 		})
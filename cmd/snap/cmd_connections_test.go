@@ -277,6 +277,46 @@ func (s *SnapSuite) TestConnectionsSomeConnected(c *C) {
 	c.Assert(s.Stderr(), Equals, "")
 }
 
+func (s *SnapSuite) TestConnectionsLocalPolicy(c *C) {
+	result := client.Connections{
+		Established: []client.Connection{
+			{
+				Plug:        client.PlugRef{Snap: "our-agent", Name: "hardware-observe"},
+				Slot:        client.SlotRef{Snap: "core", Name: "hardware-observe"},
+				Interface:   "hardware-observe",
+				LocalPolicy: true,
+			},
+		},
+		Plugs: []client.Plug{
+			{
+				Snap:      "our-agent",
+				Name:      "hardware-observe",
+				Interface: "hardware-observe",
+				Connections: []client.SlotRef{{
+					Snap: "core",
+					Name: "hardware-observe",
+				}},
+			},
+		},
+	}
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, Equals, "GET")
+		c.Check(r.URL.Path, Equals, "/v2/connections")
+		EncodeResponseBody(c, w, map[string]interface{}{
+			"type":   "sync",
+			"result": result,
+		})
+	})
+	rest, err := Parser(Client()).ParseArgs([]string{"connections"})
+	c.Assert(err, IsNil)
+	c.Assert(rest, DeepEquals, []string{})
+	expectedStdout := "" +
+		"Interface         Plug                        Slot               Notes\n" +
+		"hardware-observe  our-agent:hardware-observe  :hardware-observe  local-policy\n"
+	c.Assert(s.Stdout(), Equals, expectedStdout)
+	c.Assert(s.Stderr(), Equals, "")
+}
+
 func (s *SnapSuite) TestConnectionsSomeDisconnected(c *C) {
 	result := client.Connections{
 		Established: []client.Connection{
@@ -0,0 +1,122 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/i18n"
+)
+
+type cmdDebugAudit struct {
+	clientMixin
+	timeMixin
+	Since string `long:"since"`
+	Until string `long:"until"`
+	User  string `long:"user"`
+}
+
+func init() {
+	addDebugCommand("audit",
+		i18n.G("Show the audit log of requests made to snapd"),
+		i18n.G(`
+The audit command displays the requests that asked snapd to change
+something, who made them and what came of them.
+`),
+		func() flags.Commander {
+			return &cmdDebugAudit{}
+		}, timeDescs.also(map[string]string{
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"since": i18n.G("Only show requests made since the given time (RFC 3339) or duration ago (e.g. 24h)"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"until": i18n.G("Only show requests made until the given time (RFC 3339) or duration ago (e.g. 24h)"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"user": i18n.G("Only show requests made by the given snapd user (username or email) or uid"),
+		}), nil)
+}
+
+func auditUser(entry *client.AuditEntry) string {
+	switch {
+	case entry.Username != "":
+		return entry.Username
+	case entry.Email != "":
+		return entry.Email
+	case entry.UID != nil:
+		return "uid " + strconv.FormatUint(uint64(*entry.UID), 10)
+	}
+	return "-"
+}
+
+func (x *cmdDebugAudit) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	opts := client.AuditOptions{User: x.User}
+	if x.Since != "" {
+		since, err := parseTimeAgo("--since", x.Since)
+		if err != nil {
+			return err
+		}
+		opts.Since = since
+	}
+	if x.Until != "" {
+		until, err := parseTimeAgo("--until", x.Until)
+		if err != nil {
+			return err
+		}
+		opts.Until = until
+	}
+
+	entries, err := x.client.Audit(&opts)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Fprintln(Stderr, i18n.G("No matching requests."))
+		return nil
+	}
+
+	w := tabWriter()
+	fmt.Fprintln(w, i18n.G("Time\tUser\tRequest\tAction\tSnaps\tStatus\tChange"))
+	for _, entry := range entries {
+		action, snaps, change := "-", "-", "-"
+		if entry.Action != "" {
+			action = entry.Action
+		}
+		if len(entry.Snaps) > 0 {
+			snaps = strings.Join(entry.Snaps, ",")
+		}
+		if entry.ChangeID != "" {
+			change = entry.ChangeID
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s %s\t%s\t%s\t%d\t%s\n",
+			x.fmtTime(entry.Time), auditUser(entry), entry.Method, entry.Path,
+			action, snaps, entry.Status, change)
+	}
+	w.Flush()
+
+	return nil
+}
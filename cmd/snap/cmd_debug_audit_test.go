@@ -0,0 +1,85 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"gopkg.in/check.v1"
+
+	snap "github.com/snapcore/snapd/cmd/snap"
+)
+
+func (s *SnapSuite) TestDebugAudit(c *check.C) {
+	restore := snap.MockTimeNow(func() time.Time {
+		return time.Date(2019, 3, 12, 10, 0, 0, 0, time.UTC)
+	})
+	defer restore()
+
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch n {
+		case 0:
+			c.Check(r.Method, check.Equals, "GET")
+			c.Check(r.URL.Path, check.Equals, "/v2/audit")
+			c.Check(r.URL.Query(), check.DeepEquals, url.Values{
+				"since": []string{"2019-03-11T10:00:00Z"},
+				"until": []string{"2019-03-12T00:00:00Z"},
+				"user":  []string{"1000"},
+			})
+			fmt.Fprintln(w, `{"type": "sync", "result": [
+{"time": "2019-03-11T11:00:00Z", "pid": 100, "uid": 1000, "method": "POST", "route": "/v2/snaps/{name}", "path": "/v2/snaps/foo", "action": "install", "snaps": ["foo"], "status": 202, "change-id": "42"},
+{"time": "2019-03-11T12:00:00Z", "pid": 101, "uid": 1000, "email": "foo@example.com", "method": "PUT", "route": "/v2/snaps/{name}/conf", "path": "/v2/snaps/foo/conf", "status": 401, "err": "access denied"}
+]}`)
+		default:
+			c.Fatalf("expected to get 1 request, now on %d", n+1)
+		}
+		n++
+	})
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"debug", "audit", "--since=24h", "--until=2019-03-12T00:00:00Z", "--user=1000", "--abs-time"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.DeepEquals, []string{})
+	c.Check(s.Stdout(), check.Equals, `Time                  User             Request                 Action   Snaps  Status  Change
+2019-03-11T11:00:00Z  uid 1000         POST /v2/snaps/foo      install  foo    202     42
+2019-03-11T12:00:00Z  foo@example.com  PUT /v2/snaps/foo/conf  -        -      401     -
+`)
+	c.Check(s.Stderr(), check.Equals, "")
+	c.Check(n, check.Equals, 1)
+}
+
+func (s *SnapSuite) TestDebugAuditEmpty(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"type": "sync", "result": []}`)
+	})
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"debug", "audit"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "")
+	c.Check(s.Stderr(), check.Equals, "No matching requests.\n")
+}
+
+func (s *SnapSuite) TestDebugAuditBadTime(c *check.C) {
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"debug", "audit", "--until=tomorrow"})
+	c.Assert(err, check.ErrorMatches, `cannot use --until "tomorrow": expected a time in RFC 3339 format or a positive duration \(e.g. 24h\)`)
+}
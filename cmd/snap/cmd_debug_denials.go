@@ -0,0 +1,118 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/i18n"
+)
+
+type cmdDebugDenials struct {
+	clientMixin
+	timeMixin
+	Positional struct {
+		Snaps []installedSnapName `positional-arg-name:"<snap>"`
+	} `positional-args:"yes"`
+}
+
+func init() {
+	addDebugCommand("denials",
+		i18n.G("Show the sandbox denials of snaps"),
+		i18n.G(`
+The denials command displays the accesses AppArmor and seccomp denied to
+the given snaps, or to all snaps, as logged by the kernel.
+
+For each denial it suggests the interfaces that would grant the access:
+plugs of the snap that would grant it once connected are shown as
+<snap>:<plug>, other interfaces by name.
+`),
+		func() flags.Commander {
+			return &cmdDebugDenials{}
+		}, timeDescs, nil)
+}
+
+func denialSubject(d *client.Denial) string {
+	switch {
+	case d.App != "":
+		return d.Snap + "." + d.App
+	case d.Hook != "":
+		return fmt.Sprintf(i18n.G("%s (%s hook)"), d.Snap, d.Hook)
+	}
+	return d.Snap
+}
+
+func denialAccess(d *client.Denial) string {
+	switch {
+	case d.Syscall != "":
+		return "syscall " + d.Syscall
+	case d.Capability != "":
+		return "capability " + d.Capability
+	case d.Family != "":
+		return strings.TrimSpace("network " + d.Family + " " + d.SockType)
+	case d.Mask != "":
+		return fmt.Sprintf("%s %s (%s)", d.Operation, d.Path, d.Mask)
+	}
+	return strings.TrimSpace(d.Operation + " " + d.Path)
+}
+
+func denialSuggestions(d *client.Denial) string {
+	if len(d.Suggestions) == 0 {
+		return "-"
+	}
+	suggestions := make([]string, len(d.Suggestions))
+	for i, suggestion := range d.Suggestions {
+		if suggestion.Plug != "" {
+			suggestions[i] = d.Snap + ":" + suggestion.Plug
+		} else {
+			suggestions[i] = suggestion.Interface
+		}
+	}
+	return strings.Join(suggestions, ",")
+}
+
+func (x *cmdDebugDenials) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	denials, err := x.client.Denials(installedSnapNames(x.Positional.Snaps))
+	if err != nil {
+		return err
+	}
+	if len(denials) == 0 {
+		fmt.Fprintln(Stderr, i18n.G("No denials."))
+		return nil
+	}
+
+	w := tabWriter()
+	fmt.Fprintln(w, i18n.G("Snap\tDenied\tCount\tLast seen\tSuggested"))
+	for _, d := range denials {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", denialSubject(d), denialAccess(d),
+			d.Count, x.fmtTime(d.LastSeen), denialSuggestions(d))
+	}
+	w.Flush()
+
+	return nil
+}
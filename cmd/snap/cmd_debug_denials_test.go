@@ -0,0 +1,77 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"gopkg.in/check.v1"
+
+	snap "github.com/snapcore/snapd/cmd/snap"
+)
+
+func (s *SnapSuite) TestDebugDenials(c *check.C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch n {
+		case 0:
+			c.Check(r.Method, check.Equals, "GET")
+			c.Check(r.URL.Path, check.Equals, "/v2/denials")
+			c.Check(r.URL.Query(), check.DeepEquals, url.Values{
+				"snaps": []string{"foo,bar"},
+			})
+			fmt.Fprintln(w, `{"type": "sync", "result": [
+{"kind": "apparmor", "snap": "foo", "app": "app", "operation": "open", "path": "/dev/video0", "mask": "r", "count": 2, "first-seen": "2019-03-11T10:00:00Z", "last-seen": "2019-03-11T11:00:00Z", "suggestions": [{"interface": "camera", "plug": "cam"}]},
+{"kind": "apparmor", "snap": "foo", "hook": "configure", "operation": "capable", "capability": "net_admin", "count": 1, "first-seen": "2019-03-11T12:00:00Z", "last-seen": "2019-03-11T12:00:00Z", "suggestions": [{"interface": "firewall-control"}, {"interface": "network-control"}]},
+{"kind": "apparmor", "snap": "bar", "app": "app", "operation": "create", "family": "netlink", "sock-type": "raw", "count": 1, "first-seen": "2019-03-11T12:30:00Z", "last-seen": "2019-03-11T12:30:00Z"},
+{"kind": "seccomp", "snap": "bar", "syscall": "bpf", "count": 3, "first-seen": "2019-03-11T13:00:00Z", "last-seen": "2019-03-11T13:00:00Z"}
+]}`)
+		default:
+			c.Fatalf("expected to get 1 request, now on %d", n+1)
+		}
+		n++
+	})
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"debug", "denials", "--abs-time", "foo", "bar"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.DeepEquals, []string{})
+	c.Check(s.Stdout(), check.Equals, `Snap                  Denied                Count  Last seen             Suggested
+foo.app               open /dev/video0 (r)  2      2019-03-11T11:00:00Z  foo:cam
+foo (configure hook)  capability net_admin  1      2019-03-11T12:00:00Z  firewall-control,network-control
+bar.app               network netlink raw   1      2019-03-11T12:30:00Z  -
+bar                   syscall bpf           3      2019-03-11T13:00:00Z  -
+`)
+	c.Check(s.Stderr(), check.Equals, "")
+	c.Check(n, check.Equals, 1)
+}
+
+func (s *SnapSuite) TestDebugDenialsNone(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Query(), check.DeepEquals, url.Values{})
+		fmt.Fprintln(w, `{"type": "sync", "result": []}`)
+	})
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"debug", "denials"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "")
+	c.Check(s.Stderr(), check.Equals, "No denials.\n")
+}
@@ -0,0 +1,165 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/i18n"
+)
+
+type cmdDebugExplainConnection struct {
+	clientMixin
+	SnapFiles      []string `long:"snap-file"`
+	AssertionFiles []string `long:"assertion"`
+	Positionals    struct {
+		PlugSpec connectPlugSpec `required:"yes"`
+		SlotSpec connectSlotSpec
+	} `positional-args:"true"`
+}
+
+func init() {
+	addDebugCommand("explain-connection",
+		i18n.G("Explain how the interface policy decides on a connection"),
+		i18n.G(`
+The explain-connection command shows how the base and snap declarations,
+and the local interface policy, decide on installing the snaps of a plug
+and slot, and on connecting them manually and automatically.
+
+$ snap debug explain-connection <snap>:<plug> <snap>:<slot>
+
+Without a slot, the slot of the system snap with the name of the plug is
+used. Snaps that are not installed can be given with --snap-file, along
+with their snap declaration with --assertion; the account of their
+publisher must already be known to the system.
+`),
+		func() flags.Commander {
+			return &cmdDebugExplainConnection{}
+		}, map[string]string{
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"snap-file": i18n.G("Use the given snap file instead of the installed snap of the same name"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"assertion": i18n.G("Use the snap declarations in the given file for the snap files"),
+		}, []argDesc{
+			// TRANSLATORS: This needs to begin with < and end with >
+			{name: i18n.G("<snap>:<plug>")},
+			// TRANSLATORS: This needs to begin with < and end with >
+			{name: i18n.G("<snap>:<slot>")},
+		})
+}
+
+func absPaths(fns []string) ([]string, error) {
+	abs := make([]string, len(fns))
+	for i, fn := range fns {
+		var err error
+		abs[i], err = filepath.Abs(fn)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return abs, nil
+}
+
+func fmtPolicyCheck(check *client.PolicyCheck) string {
+	what := check.Check
+	if check.Snap != "" {
+		what = fmt.Sprintf(i18n.G("%s of %q"), check.Check, check.Snap)
+	}
+	switch {
+	case check.Skipped != "":
+		return fmt.Sprintf(i18n.G("%s: not checked: %s"), what, check.Skipped)
+	case check.Allowed:
+		return fmt.Sprintf(i18n.G("%s: allowed"), what)
+	default:
+		return fmt.Sprintf(i18n.G("%s: not allowed"), what)
+	}
+}
+
+func fmtTraceStep(step *client.PolicyTraceStep) string {
+	s := step.Constraint
+	if step.Rule != "" {
+		s = step.Rule + ": " + s
+	}
+	if step.Alternative != 0 {
+		// constraints of a rule, matched or not
+		outcome := i18n.G("not matched")
+		if step.Matched {
+			outcome = i18n.G("matched")
+		}
+		s += fmt.Sprintf(" #%d: %s", step.Alternative, outcome)
+	}
+	if step.Detail != "" {
+		s += ": " + step.Detail
+	}
+	return s
+}
+
+func (x *cmdDebugExplainConnection) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	plug := x.Positionals.PlugSpec
+	if plug.Name == "" {
+		return fmt.Errorf(i18n.G("the plug must be given as <snap>:<plug>"))
+	}
+	slot := x.Positionals.SlotSpec
+	switch {
+	case slot.Snap == "" && slot.Name == "":
+		slot.Name = plug.Name
+	case slot.Name == "":
+		return fmt.Errorf(i18n.G("the slot must be given as <snap>:<slot>"))
+	}
+
+	var opts client.ExplainOptions
+	var err error
+	if opts.SnapFiles, err = absPaths(x.SnapFiles); err != nil {
+		return err
+	}
+	if opts.AssertionFiles, err = absPaths(x.AssertionFiles); err != nil {
+		return err
+	}
+
+	explanation, err := x.client.ExplainConnection(
+		client.PlugRef{Snap: plug.Snap, Name: plug.Name},
+		client.SlotRef{Snap: slot.Snap, Name: slot.Name}, &opts)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(Stdout, "plug:      %s\n", endpoint(explanation.Plug.Snap, explanation.Plug.Name))
+	fmt.Fprintf(Stdout, "slot:      %s\n", endpoint(explanation.Slot.Snap, explanation.Slot.Name))
+	fmt.Fprintf(Stdout, "interface: %s\n", explanation.Interface)
+	for _, check := range explanation.Checks {
+		fmt.Fprintf(Stdout, "\n%s\n", fmtPolicyCheck(check))
+		for i := range check.Trace {
+			fmt.Fprintf(Stdout, "  %s\n", fmtTraceStep(&check.Trace[i]))
+		}
+		if check.Error != "" {
+			fmt.Fprintf(Stdout, "  => %s\n", check.Error)
+		}
+	}
+
+	return nil
+}
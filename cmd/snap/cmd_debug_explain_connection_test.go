@@ -0,0 +1,100 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/check.v1"
+
+	snap "github.com/snapcore/snapd/cmd/snap"
+)
+
+func (s *SnapSuite) TestDebugExplainConnection(c *check.C) {
+	cwd, err := os.Getwd()
+	c.Assert(err, check.IsNil)
+
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch n {
+		case 0:
+			c.Check(r.Method, check.Equals, "GET")
+			c.Check(r.URL.Path, check.Equals, "/v2/interfaces/explain")
+			c.Check(r.URL.Query(), check.DeepEquals, url.Values{
+				"plug":           []string{"foo:network-control"},
+				"slot":           []string{":network-control"},
+				"snap-file":      []string{filepath.Join(cwd, "foo_1.snap")},
+				"assertion-file": []string{"/tmp/foo.assert"},
+			})
+			fmt.Fprintln(w, `{"type": "sync", "result": {
+"plug": {"snap": "foo", "plug": "network-control"},
+"slot": {"snap": "core", "slot": "network-control"},
+"interface": "network-control",
+"checks": [
+{"check": "installation", "snap": "foo", "allowed": true, "trace": [{"rule": "base-declaration \"network-control\" plug rule of interface \"network-control\"", "constraint": "installation", "detail": "no rule for plug \"network-control\" of interface \"network-control\", allowed"}]},
+{"check": "installation", "snap": "core", "allowed": true, "skipped": "snap has no snap-id, its installation is not checked"},
+{"check": "connection", "allowed": true, "trace": [{"rule": "base-declaration slot rule of interface \"network-control\"", "constraint": "allow-connection", "alternative": 1, "matched": true}]},
+{"check": "auto-connection", "allowed": false, "error": "auto-connection denied by slot rule of interface \"network-control\"", "trace": [
+  {"rule": "base-declaration slot rule of interface \"network-control\"", "constraint": "deny-auto-connection", "alternative": 1, "matched": true}
+]}
+]}}`)
+		default:
+			c.Fatalf("expected to get 1 request, now on %d", n+1)
+		}
+		n++
+	})
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"debug", "explain-connection", "--snap-file=foo_1.snap", "--assertion=/tmp/foo.assert", "foo:network-control"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.DeepEquals, []string{})
+	c.Check(s.Stdout(), check.Equals, `plug:      foo:network-control
+slot:      :network-control
+interface: network-control
+
+installation of "foo": allowed
+  base-declaration "network-control" plug rule of interface "network-control": installation: no rule for plug "network-control" of interface "network-control", allowed
+
+installation of "core": not checked: snap has no snap-id, its installation is not checked
+
+connection: allowed
+  base-declaration slot rule of interface "network-control": allow-connection #1: matched
+
+auto-connection: not allowed
+  base-declaration slot rule of interface "network-control": deny-auto-connection #1: matched
+  => auto-connection denied by slot rule of interface "network-control"
+`)
+	c.Check(s.Stderr(), check.Equals, "")
+	c.Check(n, check.Equals, 1)
+}
+
+func (s *SnapSuite) TestDebugExplainConnectionBadSpecs(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Fatalf("unexpected request")
+	})
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"debug", "explain-connection", "foo"})
+	c.Check(err, check.ErrorMatches, `the plug must be given as <snap>:<plug>`)
+	_, err = snap.Parser(snap.Client()).ParseArgs([]string{"debug", "explain-connection", "foo:bar", "baz"})
+	c.Check(err, check.ErrorMatches, `the slot must be given as <snap>:<slot>`)
+}
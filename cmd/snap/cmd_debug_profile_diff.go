@@ -0,0 +1,119 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/snapcore/snapd/i18n"
+)
+
+type cmdDebugProfileDiff struct {
+	clientMixin
+	Connect    string `long:"connect" value-name:"<snap>:<plug>[,<snap>:<slot>]"`
+	Disconnect string `long:"disconnect" value-name:"<snap>:<plug>[,<snap>:<slot>]"`
+	Refresh    string `long:"refresh" value-name:"<snap file>"`
+	Positional struct {
+		Snap installedSnapName `positional-arg-name:"<snap>" required:"yes"`
+	} `positional-args:"yes"`
+}
+
+func init() {
+	addDebugCommand("profile-diff",
+		i18n.G("Show how the security profiles of a snap would change"),
+		i18n.G(`
+The profile-diff command shows how the AppArmor and seccomp profiles,
+udev rules, DBus policy and the other files generated for the security
+of the given snap would change if a connection was made or removed, or
+if the snap was refreshed to the given snap file, as unified diffs by
+security backend.
+
+$ snap debug profile-diff <snap> --connect=<snap>:<plug>[,<snap>:<slot>]
+
+Nothing is connected, disconnected or refreshed.
+`),
+		func() flags.Commander {
+			return &cmdDebugProfileDiff{}
+		}, map[string]string{
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"connect": i18n.G("Show the changes connecting the plug and slot would make"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"disconnect": i18n.G("Show the changes disconnecting the plug and slot would make"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"refresh": i18n.G("Show the changes refreshing to the given snap file would make"),
+		}, nil)
+}
+
+func (x *cmdDebugProfileDiff) diffWith() (string, error) {
+	var diffWith string
+	n := 0
+	if x.Connect != "" {
+		diffWith = "connect:" + x.Connect
+		n++
+	}
+	if x.Disconnect != "" {
+		diffWith = "disconnect:" + x.Disconnect
+		n++
+	}
+	if x.Refresh != "" {
+		path, err := filepath.Abs(x.Refresh)
+		if err != nil {
+			return "", err
+		}
+		diffWith = "refresh:" + path
+		n++
+	}
+	if n != 1 {
+		return "", fmt.Errorf(i18n.G("need exactly one of --connect, --disconnect or --refresh"))
+	}
+	return diffWith, nil
+}
+
+func (x *cmdDebugProfileDiff) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	diffWith, err := x.diffWith()
+	if err != nil {
+		return err
+	}
+	profiles, err := x.client.SecurityProfiles(string(x.Positional.Snap), diffWith)
+	if err != nil {
+		return err
+	}
+	if len(profiles) == 0 {
+		fmt.Fprintln(Stderr, i18n.G("No changes to the security profiles."))
+		return nil
+	}
+
+	backend := ""
+	for _, profile := range profiles {
+		if profile.Backend != backend {
+			backend = profile.Backend
+			fmt.Fprintf(Stdout, "# %s\n", backend)
+		}
+		fmt.Fprint(Stdout, profile.Diff)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/check.v1"
+
+	snap "github.com/snapcore/snapd/cmd/snap"
+)
+
+func (s *SnapSuite) TestDebugProfileDiff(c *check.C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch n {
+		case 0:
+			c.Check(r.Method, check.Equals, "GET")
+			c.Check(r.URL.Path, check.Equals, "/v2/snaps/foo/security-profiles")
+			c.Check(r.URL.Query(), check.DeepEquals, url.Values{
+				"diff-with": []string{"connect:foo:cam,core:camera"},
+			})
+			fmt.Fprintln(w, `{"type": "sync", "result": [
+{"backend": "apparmor", "path": "/var/lib/snapd/apparmor/profiles/snap.foo.app", "diff": "--- a\n+++ a\n@@ -1 +1,2 @@\n x\n+/dev/video0 rw,\n"},
+{"backend": "apparmor", "path": "/var/lib/snapd/apparmor/profiles/snap.foo.other", "diff": "--- b\n+++ b\n@@ -1 +1,2 @@\n y\n+/dev/video0 rw,\n"},
+{"backend": "udev", "path": "/etc/udev/rules.d/70-snap.foo.rules", "diff": "--- /dev/null\n+++ c\n@@ -0,0 +1 @@\n+rule\n"}
+]}`)
+		default:
+			c.Fatalf("expected to get 1 request, now on %d", n+1)
+		}
+		n++
+	})
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"debug", "profile-diff", "foo", "--connect", "foo:cam,core:camera"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.DeepEquals, []string{})
+	c.Check(s.Stdout(), check.Equals, `# apparmor
+--- a
++++ a
+@@ -1 +1,2 @@
+ x
++/dev/video0 rw,
+--- b
++++ b
+@@ -1 +1,2 @@
+ y
++/dev/video0 rw,
+# udev
+--- /dev/null
++++ c
+@@ -0,0 +1 @@
++rule
+`)
+	c.Check(s.Stderr(), check.Equals, "")
+	c.Check(n, check.Equals, 1)
+}
+
+func (s *SnapSuite) TestDebugProfileDiffRefreshNoChanges(c *check.C) {
+	cwd, err := os.Getwd()
+	c.Assert(err, check.IsNil)
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Query(), check.DeepEquals, url.Values{
+			"diff-with": []string{"refresh:" + filepath.Join(cwd, "foo_2.snap")},
+		})
+		fmt.Fprintln(w, `{"type": "sync", "result": []}`)
+	})
+
+	_, err = snap.Parser(snap.Client()).ParseArgs([]string{"debug", "profile-diff", "foo", "--refresh", "foo_2.snap"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "")
+	c.Check(s.Stderr(), check.Equals, "No changes to the security profiles.\n")
+}
+
+func (s *SnapSuite) TestDebugProfileDiffNeedsOneChange(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Fatalf("unexpected request")
+	})
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"debug", "profile-diff", "foo"})
+	c.Check(err, check.ErrorMatches, "need exactly one of --connect, --disconnect or --refresh")
+	_, err = snap.Parser(snap.Client()).ParseArgs([]string{"debug", "profile-diff", "foo", "--connect", "foo:a", "--disconnect", "foo:b"})
+	c.Check(err, check.ErrorMatches, "need exactly one of --connect, --disconnect or --refresh")
+}
@@ -113,6 +113,19 @@ func maybePrintID(w io.Writer, snap *client.Snap) {
 	}
 }
 
+// fmtHealth formats the health reported by a snap as its status
+// followed by the message and code, if any.
+func fmtHealth(health *client.SnapHealth) string {
+	s := health.Status
+	if health.Message != "" {
+		s += ": " + health.Message
+	}
+	if health.Code != "" {
+		s += " (" + health.Code + ")"
+	}
+	return s
+}
+
 func maybePrintBase(w io.Writer, base string, verbose bool) {
 	if verbose && base != "" {
 		fmt.Fprintf(w, "base:\t%s\n", base)
@@ -532,6 +545,9 @@ func (x *infoCmd) Execute([]string) error {
 			if !local.InstallDate.IsZero() {
 				fmt.Fprintf(w, "refresh-date:\t%s\n", x.fmtTime(local.InstallDate))
 			}
+			if local.Health != nil {
+				fmt.Fprintf(w, "health:\t%s\n", fmtHealth(local.Health))
+			}
 		}
 
 		chInfos := channelInfos{
@@ -128,8 +128,22 @@ func (x *cmdList) Execute(args []string) error {
 	esc := x.getEscapes()
 	w := tabWriter()
 
-	// TRANSLATORS: the %s is to insert a filler escape sequence (please keep it flush to the column header, with no extra spaces)
-	fmt.Fprintf(w, i18n.G("Name\tVersion\tRev\tTracking\tPublisher%s\tNotes\n"), fillerPublisher(esc))
+	// the health column is only shown if some snap reports its health
+	withHealth := false
+	for _, snap := range snaps {
+		if snap.Health != nil {
+			withHealth = true
+			break
+		}
+	}
+
+	if withHealth {
+		// TRANSLATORS: the %s is to insert a filler escape sequence (please keep it flush to the column header, with no extra spaces)
+		fmt.Fprintf(w, i18n.G("Name\tVersion\tRev\tTracking\tPublisher%s\tNotes\tHealth\n"), fillerPublisher(esc))
+	} else {
+		// TRANSLATORS: the %s is to insert a filler escape sequence (please keep it flush to the column header, with no extra spaces)
+		fmt.Fprintf(w, i18n.G("Name\tVersion\tRev\tTracking\tPublisher%s\tNotes\n"), fillerPublisher(esc))
+	}
 
 	for _, snap := range snaps {
 		// doing it this way because otherwise it's a sea of %s\t%s\t%s
@@ -141,6 +155,13 @@ func (x *cmdList) Execute(args []string) error {
 			shortPublisher(esc, snap.Publisher),
 			NotesFromLocal(snap).String(),
 		}
+		if withHealth {
+			health := "-"
+			if snap.Health != nil {
+				health = snap.Health.Status
+			}
+			line = append(line, health)
+		}
 		fmt.Fprintln(w, strings.Join(line, "\t"))
 	}
 	w.Flush()
@@ -209,6 +209,25 @@ func (s *SnapSuite) TestListWithNotes(c *check.C) {
 	c.Check(s.Stderr(), check.Equals, "")
 }
 
+func (s *SnapSuite) TestListWithHealth(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "GET")
+		c.Check(r.URL.Path, check.Equals, "/v2/snaps")
+		fmt.Fprintln(w, `{"type": "sync", "result": [
+{"name": "foo", "status": "active", "version": "4.2", "revision":17, "health": {"revision": "17", "timestamp": "2019-05-01T10:00:00Z", "status": "blocked", "message": "waiting for the network"}}
+,{"name": "bar", "status": "active", "version": "5", "revision":1}
+]}`)
+	})
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"list"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.DeepEquals, []string{})
+	c.Check(s.Stdout(), check.Matches, `Name +Version +Rev +Tracking +Publisher +Notes +Health
+bar +5 +1 +- +- +- +-
+foo +4.2 +17 +- +- +- +blocked
+`)
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
 func (s *SnapSuite) TestFormatChannel(c *check.C) {
 	type tableT struct {
 		channel  string
@@ -0,0 +1,76 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/snapcore/snapd/i18n"
+)
+
+type cmdRollback struct {
+	waitMixin
+	Positional struct {
+		ID changeID `positional-arg-name:"<change-id>" required:"yes"`
+	} `positional-args:"yes"`
+}
+
+var shortRollbackHelp = i18n.G("Roll back a completed change")
+var longRollbackHelp = i18n.G(`
+The rollback command takes the snaps, interface connections and aliases
+affected by a completed install, refresh, connect or alias change back to
+what they were before it, as a new change.
+`)
+
+func init() {
+	addCommand("rollback",
+		shortRollbackHelp,
+		longRollbackHelp,
+		func() flags.Commander {
+			return &cmdRollback{}
+		},
+		waitDescs,
+		changeIDMixinArgDesc,
+	)
+}
+
+func (x *cmdRollback) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	id, err := x.client.Rollback(string(x.Positional.ID))
+	if err != nil {
+		return err
+	}
+
+	if _, err := x.wait(id); err != nil {
+		if err == noWait {
+			return nil
+		}
+		return err
+	}
+
+	// TRANSLATORS: the %s is a change ID
+	fmt.Fprintf(Stdout, i18n.G("Change %s rolled back\n"), x.Positional.ID)
+	return nil
+}
@@ -36,6 +36,7 @@ import (
 	"github.com/snapcore/snapd/i18n"
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/strutil"
 )
 
 var (
@@ -72,6 +73,10 @@ The remove command removes the named snap instance from the system.
 By default all the snap revisions are removed, including their data and the
 common data directory. When a --revision option is passed only the specified
 revision is removed.
+
+Unless automatic snapshots are disabled, a snapshot of all the snap's data is
+saved before it is removed (see 'snap help saved'). The --purge option removes
+the snap without saving that snapshot.
 `)
 
 var longRefreshHelp = i18n.G(`
@@ -86,6 +91,20 @@ have developer access to the snap, either directly or through the
 store's collaboration feature, and to be logged in (see 'snap help login').
 
 Note a later refresh will typically undo a revision override.
+
+The --hold option postpones the automatic refreshes of the given snaps,
+either for the given duration or indefinitely, while other snaps keep
+being refreshed; --unhold lifts such a hold. Holding does not prevent
+refreshing the snaps explicitly.
+
+The --at option schedules the refresh for the next window of the given
+schedule, using the same syntax as the refresh.timer system option,
+instead of refreshing right away; 'snap abort' cancels it. The window
+must open within six days. If snapd is not running when it opens, the
+refresh starts as soon as snapd is back, even if the window closed.
+
+The --dry-run option shows the tasks the refresh would run, what it
+would download and the services it would affect, without refreshing.
 `)
 
 var longTryHelp = i18n.G(`
@@ -113,6 +132,7 @@ type cmdRemove struct {
 	waitMixin
 
 	Revision   string `long:"revision"`
+	Purge      bool   `long:"purge"`
 	Positional struct {
 		Snaps []installedSnapName `positional-arg-name:"<snap>" required:"1"`
 	} `positional-args:"yes" required:"yes"`
@@ -184,7 +204,7 @@ func (x *cmdRemove) removeMany(opts *client.SnapOptions) error {
 }
 
 func (x *cmdRemove) Execute([]string) error {
-	opts := &client.SnapOptions{Revision: x.Revision}
+	opts := &client.SnapOptions{Revision: x.Revision, Purge: x.Purge}
 	if len(x.Positional.Snaps) == 1 {
 		return x.removeOne(opts)
 	}
@@ -192,6 +212,9 @@ func (x *cmdRemove) Execute([]string) error {
 	if x.Revision != "" {
 		return errors.New(i18n.G("a single snap name is needed to specify the revision"))
 	}
+	if x.Purge {
+		return errors.New(i18n.G("a single snap name is needed to use --purge"))
+	}
 	return x.removeMany(nil)
 }
 
@@ -570,6 +593,10 @@ type cmdRefresh struct {
 	List             bool   `long:"list"`
 	Time             bool   `long:"time"`
 	IgnoreValidation bool   `long:"ignore-validation"`
+	Hold             string `long:"hold" optional:"true" optional-value:"forever"`
+	Unhold           bool   `long:"unhold"`
+	At               string `long:"at"`
+	DryRun           bool   `long:"dry-run"`
 	Positional       struct {
 		Snaps []installedSnapName `positional-arg-name:"<snap>"`
 	} `positional-args:"yes"`
@@ -581,6 +608,12 @@ func (x *cmdRefresh) refreshMany(snaps []string, opts *client.SnapOptions) error
 		return err
 	}
 
+	if opts != nil && opts.Schedule != "" {
+		if scheduled, err := x.showScheduled(changeID); err != nil || scheduled {
+			return err
+		}
+	}
+
 	chg, err := x.wait(changeID)
 	if err != nil {
 		if err == noWait {
@@ -614,6 +647,12 @@ func (x *cmdRefresh) refreshOne(name string, opts *client.SnapOptions) error {
 		return nil
 	}
 
+	if opts.Schedule != "" {
+		if scheduled, err := x.showScheduled(changeID); err != nil || scheduled {
+			return err
+		}
+	}
+
 	if _, err := x.wait(changeID); err != nil {
 		if err == noWait {
 			return nil
@@ -624,6 +663,138 @@ func (x *cmdRefresh) refreshOne(name string, opts *client.SnapOptions) error {
 	return showDone(x.client, []string{name}, "refresh", opts, x.getEscapes())
 }
 
+// showScheduled tells when the given change is scheduled to start, and
+// returns whether it is indeed waiting for its schedule rather than
+// running already.
+func (x *cmdRefresh) showScheduled(changeID string) (bool, error) {
+	chg, err := x.client.Change(changeID)
+	if err != nil {
+		return false, err
+	}
+	if chg.ScheduledTime.IsZero() {
+		return false, nil
+	}
+	// TRANSLATORS: the first %s is a change id, the second one a time
+	fmt.Fprintf(Stdout, i18n.G("Change %s scheduled to start %s.\n"), changeID, x.fmtTime(chg.ScheduledTime))
+	return true, nil
+}
+
+func (x *cmdRefresh) holdRefreshes(names []string) error {
+	var until time.Time
+	if x.Hold != "forever" {
+		d, err := time.ParseDuration(x.Hold)
+		if err != nil || d <= 0 {
+			return fmt.Errorf(i18n.G(`cannot use hold duration %q: expected a positive duration (e.g. 72h) or "forever"`), x.Hold)
+		}
+		until = timeNow().Add(d)
+	}
+
+	changeID, err := x.client.HoldRefreshes(names, until)
+	if err != nil {
+		return err
+	}
+	if _, err := x.wait(changeID); err != nil {
+		if err == noWait {
+			return nil
+		}
+		return err
+	}
+
+	if until.IsZero() {
+		// TRANSLATORS: the %s is a comma-separated list of quoted snap names
+		fmt.Fprintf(Stdout, i18n.NG("Auto-refresh of snap %s held indefinitely.\n", "Auto-refresh of snaps %s held indefinitely.\n", len(names)), strutil.Quoted(names))
+	} else {
+		// TRANSLATORS: the first %s is a comma-separated list of quoted snap names, the second one a time
+		fmt.Fprintf(Stdout, i18n.NG("Auto-refresh of snap %s held until %s.\n", "Auto-refresh of snaps %s held until %s.\n", len(names)), strutil.Quoted(names), x.fmtTime(until))
+	}
+	return nil
+}
+
+func (x *cmdRefresh) unholdRefreshes(names []string) error {
+	changeID, err := x.client.UnholdRefreshes(names)
+	if err != nil {
+		return err
+	}
+	if _, err := x.wait(changeID); err != nil {
+		if err == noWait {
+			return nil
+		}
+		return err
+	}
+
+	// TRANSLATORS: the %s is a comma-separated list of quoted snap names
+	fmt.Fprintf(Stdout, i18n.NG("Auto-refresh of snap %s no longer held.\n", "Auto-refresh of snaps %s no longer held.\n", len(names)), strutil.Quoted(names))
+	return nil
+}
+
+func (x *cmdRefresh) dryRun(names []string, opts *client.SnapOptions) error {
+	plan, err := x.client.DryRun("refresh", names, opts)
+	if err != nil {
+		return err
+	}
+	showPlan(plan)
+	return nil
+}
+
+// showPlan writes out the tasks of the plan as a tree, grouped by the
+// snap they are about, followed by what would be downloaded and which
+// services would be affected.
+func showPlan(plan *client.SnapOpPlan) {
+	fmt.Fprintln(Stdout, plan.Summary)
+
+	var snaps []string
+	bySnap := make(map[string][]*client.PlannedTask)
+	for _, t := range plan.Tasks {
+		if _, ok := bySnap[t.Snap]; !ok {
+			snaps = append(snaps, t.Snap)
+		}
+		bySnap[t.Snap] = append(bySnap[t.Snap], t)
+	}
+
+	for i, name := range snaps {
+		branch, indent := "├─", "│  "
+		if i == len(snaps)-1 {
+			branch, indent = "└─", "   "
+		}
+		if name == "" {
+			// TRANSLATORS: groups the tasks not about a particular snap
+			name = i18n.G("(other)")
+		}
+		fmt.Fprintf(Stdout, "%s %s\n", branch, name)
+		tasks := bySnap[snaps[i]]
+		for j, t := range tasks {
+			leaf := "├─"
+			if j == len(tasks)-1 {
+				leaf = "└─"
+			}
+			fmt.Fprintf(Stdout, "%s%s %s %s", indent, leaf, t.ID, t.Summary)
+			if len(t.WaitFor) > 0 {
+				// TRANSLATORS: the %s is a comma-separated list of task ids
+				fmt.Fprintf(Stdout, i18n.G(" (after %s)"), strings.Join(t.WaitFor, ", "))
+			}
+			fmt.Fprintln(Stdout)
+		}
+	}
+
+	if len(plan.Downloads) > 0 {
+		fmt.Fprintln(Stdout, i18n.G("Downloads:"))
+		w := tabWriter()
+		for _, dl := range plan.Downloads {
+			channel := dl.Channel
+			if channel == "" {
+				channel = "-"
+			}
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\n", dl.Snap, dl.Revision, channel, strutil.SizeToStr(dl.Size), dl.Action)
+		}
+		w.Flush()
+		fmt.Fprintf(Stdout, i18n.G("Download size: %s\n"), strutil.SizeToStr(plan.DownloadSize))
+	}
+	if len(plan.Services) > 0 {
+		// TRANSLATORS: the %s is a comma-separated list of service names
+		fmt.Fprintf(Stdout, i18n.G("Affected services: %s\n"), strings.Join(plan.Services, ", "))
+	}
+}
+
 func parseSysinfoTime(s string) time.Time {
 	t, err := time.Parse(time.RFC3339, s)
 	if err != nil {
@@ -722,6 +893,30 @@ func (x *cmdRefresh) Execute([]string) error {
 		return x.listRefresh()
 	}
 
+	if x.Hold != "" || x.Unhold {
+		if x.At != "" || x.DryRun {
+			return errors.New(i18n.G("cannot use --at or --dry-run with --hold or --unhold"))
+		}
+		if x.Hold != "" && x.Unhold {
+			return errors.New(i18n.G("cannot use --hold and --unhold together"))
+		}
+		if x.asksForMode() || x.asksForChannel() || x.Revision != "" || x.Amend || x.IgnoreValidation {
+			return errors.New(i18n.G("--hold and --unhold do not take mode, channel, revision, amend or validation flags"))
+		}
+		names := installedSnapNames(x.Positional.Snaps)
+		if len(names) == 0 {
+			return errors.New(i18n.G("--hold and --unhold need at least one snap name"))
+		}
+		if x.Unhold {
+			return x.unholdRefreshes(names)
+		}
+		return x.holdRefreshes(names)
+	}
+
+	if x.At != "" && x.DryRun {
+		return errors.New(i18n.G("cannot use --at and --dry-run together"))
+	}
+
 	if len(x.Positional.Snaps) == 0 && os.Getenv("SNAP_REFRESH_FROM_TIMER") == "1" {
 		fmt.Fprintf(Stdout, "Ignoring `snap refresh` from the systemd timer")
 		return nil
@@ -734,8 +929,12 @@ func (x *cmdRefresh) Execute([]string) error {
 			Channel:          x.Channel,
 			IgnoreValidation: x.IgnoreValidation,
 			Revision:         x.Revision,
+			Schedule:         x.At,
 		}
 		x.setModes(opts)
+		if x.DryRun {
+			return x.dryRun(names, opts)
+		}
 		return x.refreshOne(names[0], opts)
 	}
 
@@ -747,7 +946,15 @@ func (x *cmdRefresh) Execute([]string) error {
 		return errors.New(i18n.G("a single snap name must be specified when ignoring validation"))
 	}
 
-	return x.refreshMany(names, nil)
+	if x.DryRun {
+		return x.dryRun(names, nil)
+	}
+
+	var opts *client.SnapOptions
+	if x.At != "" {
+		opts = &client.SnapOptions{Schedule: x.At}
+	}
+	return x.refreshMany(names, opts)
 }
 
 type cmdTry struct {
@@ -991,6 +1198,8 @@ func init() {
 		waitDescs.also(map[string]string{
 			// TRANSLATORS: This should not start with a lowercase letter.
 			"revision": i18n.G("Remove only the given revision"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"purge": i18n.G("Remove the snap without saving a snapshot of its data"),
 		}), nil)
 	addCommand("install", shortInstallHelp, longInstallHelp, func() flags.Commander { return &cmdInstall{} },
 		colorDescs.also(waitDescs).also(channelDescs).also(modeDescs).also(map[string]string{
@@ -1017,6 +1226,14 @@ func init() {
 			"time": i18n.G("Show auto refresh information but do not perform a refresh"),
 			// TRANSLATORS: This should not start with a lowercase letter.
 			"ignore-validation": i18n.G("Ignore validation by other snaps blocking the refresh"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"hold": i18n.G("Hold auto-refreshes of the given snaps for the given duration (e.g. 72h), or forever if none is given"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"unhold": i18n.G("Remove any auto-refresh hold of the given snaps"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"at": i18n.G("Refresh during the next window of the given schedule (e.g. mon,10:00-12:00) instead of right away"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"dry-run": i18n.G("Show what the refresh would do, without doing it"),
 		}), nil)
 	addCommand("try", shortTryHelp, longTryHelp, func() flags.Commander { return &cmdTry{} }, waitDescs.also(modeDescs), nil)
 	addCommand("enable", shortEnableHelp, longEnableHelp, func() flags.Commander { return &cmdEnable{} }, waitDescs, nil)
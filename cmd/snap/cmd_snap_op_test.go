@@ -1321,6 +1321,209 @@ func (s *SnapOpSuite) TestRefreshOneAmend(c *check.C) {
 	c.Assert(err, check.IsNil)
 }
 
+func (s *SnapOpSuite) testRefreshHoldUnhold(c *check.C, args []string, body map[string]interface{}, expectedStdout string) {
+	total := 2
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch n {
+		case 0:
+			c.Check(r.Method, check.Equals, "POST")
+			c.Check(r.URL.Path, check.Equals, "/v2/snaps")
+			c.Check(DecodedRequestBody(c, r), check.DeepEquals, body)
+			w.WriteHeader(202)
+			fmt.Fprintln(w, `{"type":"async", "change": "42", "status-code": 202}`)
+		case 1:
+			c.Check(r.Method, check.Equals, "GET")
+			c.Check(r.URL.Path, check.Equals, "/v2/changes/42")
+			fmt.Fprintln(w, `{"type": "sync", "result": {"ready": true, "status": "Done"}}`)
+		default:
+			c.Fatalf("expected to get %d requests, now on %d", total, n+1)
+		}
+
+		n++
+	})
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs(args)
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.DeepEquals, []string{})
+	c.Check(s.Stdout(), check.Equals, expectedStdout)
+	c.Check(s.Stderr(), check.Equals, "")
+	c.Check(n, check.Equals, total)
+}
+
+func (s *SnapOpSuite) TestRefreshHoldForever(c *check.C) {
+	s.testRefreshHoldUnhold(c, []string{"refresh", "--hold", "one", "two"}, map[string]interface{}{
+		"action": "hold",
+		"snaps":  []interface{}{"one", "two"},
+	}, "Auto-refresh of snaps \"one\", \"two\" held indefinitely.\n")
+}
+
+func (s *SnapOpSuite) TestRefreshHoldDuration(c *check.C) {
+	now := time.Date(2019, 4, 1, 10, 0, 0, 0, time.UTC)
+	restore := snap.MockTimeNow(func() time.Time { return now })
+	defer restore()
+
+	s.testRefreshHoldUnhold(c, []string{"refresh", "--hold=72h", "--abs-time", "one"}, map[string]interface{}{
+		"action":     "hold",
+		"snaps":      []interface{}{"one"},
+		"hold-until": "2019-04-04T10:00:00Z",
+	}, "Auto-refresh of snap \"one\" held until 2019-04-04T10:00:00Z.\n")
+}
+
+func (s *SnapOpSuite) TestRefreshUnhold(c *check.C) {
+	s.testRefreshHoldUnhold(c, []string{"refresh", "--unhold", "one"}, map[string]interface{}{
+		"action": "unhold",
+		"snaps":  []interface{}{"one"},
+	}, "Auto-refresh of snap \"one\" no longer held.\n")
+}
+
+func (s *SnapOpSuite) TestRefreshHoldErrors(c *check.C) {
+	s.RedirectClientToTestServer(nil)
+	for _, t := range []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"refresh", "--hold"}, `--hold and --unhold need at least one snap name`},
+		{[]string{"refresh", "--unhold"}, `--hold and --unhold need at least one snap name`},
+		{[]string{"refresh", "--hold", "--unhold", "one"}, `cannot use --hold and --unhold together`},
+		{[]string{"refresh", "--hold", "--beta", "one"}, `--hold and --unhold do not take mode, channel, revision, amend or validation flags`},
+		{[]string{"refresh", "--hold=-1h", "one"}, `cannot use hold duration "-1h": expected a positive duration \(e.g. 72h\) or "forever"`},
+		{[]string{"refresh", "--hold=soon", "one"}, `cannot use hold duration "soon": .*`},
+	} {
+		_, err := snap.Parser(snap.Client()).ParseArgs(t.args)
+		c.Check(err, check.ErrorMatches, t.err, check.Commentf("%v", t.args))
+	}
+}
+
+func (s *SnapOpSuite) testRefreshAt(c *check.C, args []string, path string, body map[string]interface{}) {
+	total := 2
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch n {
+		case 0:
+			c.Check(r.Method, check.Equals, "POST")
+			c.Check(r.URL.Path, check.Equals, path)
+			c.Check(DecodedRequestBody(c, r), check.DeepEquals, body)
+			w.WriteHeader(202)
+			fmt.Fprintln(w, `{"type":"async", "change": "42", "status-code": 202}`)
+		case 1:
+			c.Check(r.Method, check.Equals, "GET")
+			c.Check(r.URL.Path, check.Equals, "/v2/changes/42")
+			fmt.Fprintln(w, `{"type": "sync", "result": {"ready": false, "status": "Do", "scheduled-time": "2019-04-01T22:00:00Z"}}`)
+		default:
+			c.Fatalf("expected to get %d requests, now on %d", total, n+1)
+		}
+
+		n++
+	})
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs(args)
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.DeepEquals, []string{})
+	c.Check(s.Stdout(), check.Equals, "Change 42 scheduled to start 2019-04-01T22:00:00Z.\n")
+	c.Check(s.Stderr(), check.Equals, "")
+	c.Check(n, check.Equals, total)
+}
+
+func (s *SnapOpSuite) TestRefreshAtOne(c *check.C) {
+	s.testRefreshAt(c, []string{"refresh", "--at=22:00-23:00", "--abs-time", "foo"}, "/v2/snaps/foo", map[string]interface{}{
+		"action":   "refresh",
+		"schedule": "22:00-23:00",
+	})
+}
+
+func (s *SnapOpSuite) TestRefreshAtMany(c *check.C) {
+	s.testRefreshAt(c, []string{"refresh", "--at=22:00-23:00", "--abs-time", "one", "two"}, "/v2/snaps", map[string]interface{}{
+		"action":   "refresh",
+		"snaps":    []interface{}{"one", "two"},
+		"schedule": "22:00-23:00",
+	})
+}
+
+func (s *SnapOpSuite) TestRefreshAtWindowOpen(c *check.C) {
+	s.RedirectClientToTestServer(s.srv.handle)
+	s.srv.checker = func(r *http.Request) {
+		c.Check(r.Method, check.Equals, "POST")
+		c.Check(r.URL.Path, check.Equals, "/v2/snaps/foo")
+		c.Check(DecodedRequestBody(c, r), check.DeepEquals, map[string]interface{}{
+			"action":   "refresh",
+			"schedule": "00:00-24:00",
+		})
+	}
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"refresh", "--at=00:00-24:00", "foo"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Matches, `(?sm).*foo 1.0 from Bar refreshed`)
+}
+
+func (s *SnapOpSuite) TestRefreshAtHold(c *check.C) {
+	s.RedirectClientToTestServer(nil)
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"refresh", "--at=mon", "--hold", "foo"})
+	c.Check(err, check.ErrorMatches, `cannot use --at or --dry-run with --hold or --unhold`)
+}
+
+func (s *SnapOpSuite) TestRefreshDryRun(c *check.C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch n {
+		case 0:
+			c.Check(r.Method, check.Equals, "POST")
+			c.Check(r.URL.Path, check.Equals, "/v2/snaps")
+			c.Check(DecodedRequestBody(c, r), check.DeepEquals, map[string]interface{}{
+				"action":  "refresh",
+				"snaps":   []interface{}{"foo", "bar"},
+				"dry-run": true,
+			})
+			fmt.Fprintln(w, `{"type": "sync", "result": {
+  "summary": "Refresh snaps \"foo\", \"bar\"",
+  "affected": ["foo", "bar"],
+  "tasks": [
+    {"id": "1", "kind": "download-snap", "summary": "Download foo", "snap": "foo"},
+    {"id": "2", "kind": "link-snap", "summary": "Link foo", "wait-for": ["1"], "snap": "foo"},
+    {"id": "3", "kind": "download-snap", "summary": "Download bar", "wait-for": ["2"], "snap": "bar"},
+    {"id": "4", "kind": "run-hook", "summary": "Run hook", "wait-for": ["3"]}
+  ],
+  "downloads": [
+    {"action": "refresh", "snap": "foo", "revision": "7", "channel": "stable", "size": 2000},
+    {"action": "install", "snap": "bar", "revision": "3", "size": 1000}
+  ],
+  "download-size": 3000,
+  "services": ["snap.foo.one.service", "snap.foo.two.service"]
+}}`)
+		default:
+			c.Fatalf("expected to get 1 request, now on %d", n+1)
+		}
+		n++
+	})
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"refresh", "--dry-run", "foo", "bar"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.DeepEquals, []string{})
+	c.Check(s.Stdout(), check.Equals, `Refresh snaps "foo", "bar"
+├─ foo
+│  ├─ 1 Download foo
+│  └─ 2 Link foo (after 1)
+├─ bar
+│  └─ 3 Download bar (after 2)
+└─ (other)
+   └─ 4 Run hook (after 3)
+Downloads:
+  foo  7    stable  2kB  refresh
+  bar  3    -       1kB  install
+Download size: 3kB
+Affected services: snap.foo.one.service, snap.foo.two.service
+`)
+	c.Check(s.Stderr(), check.Equals, "")
+	c.Check(n, check.Equals, 1)
+}
+
+func (s *SnapOpSuite) TestRefreshDryRunErrors(c *check.C) {
+	s.RedirectClientToTestServer(nil)
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"refresh", "--dry-run", "--at=mon", "foo"})
+	c.Check(err, check.ErrorMatches, `cannot use --at and --dry-run together`)
+	_, err = snap.Parser(snap.Client()).ParseArgs([]string{"refresh", "--dry-run", "--beta", "foo", "bar"})
+	c.Check(err, check.ErrorMatches, `a single snap name is needed to specify mode or channel flags`)
+}
+
 func (s *SnapOpSuite) runTryTest(c *check.C, opts *client.SnapOptions) {
 	// pass relative path to cmd
 	tryDir := "some-dir"
@@ -1580,6 +1783,32 @@ func (s *SnapOpSuite) TestRemoveRevision(c *check.C) {
 	c.Check(s.srv.n, check.Equals, s.srv.total)
 }
 
+func (s *SnapOpSuite) TestRemovePurge(c *check.C) {
+	s.srv.total = 3
+	s.srv.checker = func(r *http.Request) {
+		c.Check(r.URL.Path, check.Equals, "/v2/snaps/foo")
+		c.Check(DecodedRequestBody(c, r), check.DeepEquals, map[string]interface{}{
+			"action": "remove",
+			"purge":  true,
+		})
+	}
+
+	s.RedirectClientToTestServer(s.srv.handle)
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"remove", "--purge", "foo"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.DeepEquals, []string{})
+	c.Check(s.Stdout(), check.Matches, `(?sm).*foo removed`)
+	c.Check(s.Stderr(), check.Equals, "")
+	// ensure that the fake server api was actually hit
+	c.Check(s.srv.n, check.Equals, s.srv.total)
+}
+
+func (s *SnapOpSuite) TestRemoveManyPurge(c *check.C) {
+	s.RedirectClientToTestServer(nil)
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"remove", "--purge", "one", "two"})
+	c.Assert(err, check.ErrorMatches, `a single snap name is needed to use --purge`)
+}
+
 func (s *SnapOpSuite) TestRemoveManyRevision(c *check.C) {
 	s.RedirectClientToTestServer(nil)
 	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"remove", "--revision=17", "one", "two"})
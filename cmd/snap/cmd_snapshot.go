@@ -21,12 +21,18 @@ package main
 
 import (
 	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 
 	"github.com/jessevdk/go-flags"
 
+	"github.com/snapcore/snapd/client"
 	"github.com/snapcore/snapd/i18n"
+	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/strutil"
 	"github.com/snapcore/snapd/strutil/quantity"
 )
@@ -35,17 +41,44 @@ func fmtSize(size int64) string {
 	return quantity.FormatAmount(uint64(size), -1) + "B"
 }
 
+type encryptionKeyMixin struct {
+	EncryptionKeyFile flags.Filename `long:"encryption-key-file"`
+}
+
+var encryptionKeyDescs = mixinDescs{
+	// TRANSLATORS: This should not start with a lowercase letter.
+	"encryption-key-file": i18n.G("File with the hex-encoded key to use for encrypted snapshots (default: the system's configured key)"),
+}
+
+// encryptionKey returns the hex-encoded key from the given file, if any.
+func (mx encryptionKeyMixin) encryptionKey() (string, error) {
+	if mx.EncryptionKeyFile == "" {
+		return "", nil
+	}
+	buf, err := ioutil.ReadFile(string(mx.EncryptionKeyFile))
+	if err != nil {
+		return "", fmt.Errorf(i18n.G("cannot read encryption key: %v"), err)
+	}
+	return strings.TrimSpace(string(buf)), nil
+}
+
 var (
 	shortSavedHelp   = i18n.G("List currently stored snapshots")
 	shortSaveHelp    = i18n.G("Save a snapshot of the current data")
 	shortForgetHelp  = i18n.G("Delete a snapshot")
 	shortCheckHelp   = i18n.G("Check a snapshot")
 	shortRestoreHelp = i18n.G("Restore a snapshot")
+	shortExportHelp  = i18n.G("Export a snapshot")
+	shortImportHelp  = i18n.G("Import a snapshot")
 )
 
 var longSavedHelp = i18n.G(`
 The saved command displays a list of snapshots that have been created
-previously with the 'save' command.
+previously with the 'save' command. Encrypted snapshots are noted as
+such.
+
+With --files, the files in the snapshot of the given snap in the set
+given with --id are listed instead.
 `)
 var longSaveHelp = i18n.G(`
 The save command creates a snapshot of the current user, system and
@@ -58,6 +91,20 @@ for which users, or a combination of these.
 If a snap is included in a save operation, excluding its system and
 configuration data from the snapshot is not currently possible. This
 restriction may be lifted in the future.
+
+The data is compressed with gzip, unless asked otherwise with
+--compression: gzip-fast compresses faster than gzip, but less; zstd is
+not offered, as snapd does not ship an implementation of it.
+
+With --base, only the data that changed since the given snapshot is
+saved; restoring such a snapshot needs the snapshot it is based on to
+still be around.
+
+Snapshots are encrypted with the key in the file given with
+--encryption-key-file, or if not given with the one in the file set via
+the snapshots.encryption-key-file system option, if any. The key is 32
+hex-encoded bytes; it is needed to restore the snapshot, and is not kept
+with it.
 `)
 var longForgetHelp = i18n.G(`
 The forget command deletes a snapshot. This operation can not be
@@ -96,12 +143,35 @@ for which users, or a combination of these.
 If a snap is included in a restore operation, excluding its system and
 configuration data from the restore is not currently possible. This
 restriction may be lifted in the future.
+
+With --path, only the files matching the given glob patterns (as listed
+by 'snap saved --files') are restored, into the directory given with
+--target instead of over the snap's data. System data is put in
+<target>/<snap>/, and user data in <target>/<snap>/user/<username>/.
+`)
+var longExportHelp = i18n.G(`
+The export-snapshot command writes the given snapshot to a single file,
+so that it can be copied to another machine and imported there with
+the 'import-snapshot' command.
+
+The export includes the data of all the snaps and users in the
+snapshot.
+`)
+var longImportHelp = i18n.G(`
+The import-snapshot command adds a snapshot previously written with
+the 'export-snapshot' command to the snapshots on this system.
+
+The integrity of the imported data is verified before the snapshot is
+added. The imported snapshot gets a new, unused ID.
 `)
 
 type savedCmd struct {
 	clientMixin
 	durationMixin
+	encryptionKeyMixin
 	ID         snapshotID `long:"id"`
+	Files      bool       `long:"files"`
+	Users      string     `long:"users"`
 	Positional struct {
 		Snaps []installedSnapName `positional-arg-name:"<snap>"`
 	} `positional-args:"yes"`
@@ -117,6 +187,18 @@ func (x *savedCmd) Execute([]string) error {
 		}
 	}
 	snaps := installedSnapNames(x.Positional.Snaps)
+	if x.Files {
+		if setID == 0 || len(snaps) != 1 {
+			return fmt.Errorf(i18n.G("--files needs a snapshot set given with --id, and a single snap"))
+		}
+		return x.showFiles(setID, snaps[0])
+	}
+	if x.Users != "" {
+		return fmt.Errorf(i18n.G("--users can only be used with --files"))
+	}
+	if x.EncryptionKeyFile != "" {
+		return fmt.Errorf(i18n.G("--encryption-key-file can only be used with --files"))
+	}
 	list, err := x.client.SnapshotSets(setID, snaps)
 	if err != nil {
 		return err
@@ -146,6 +228,12 @@ func (x *savedCmd) Execute([]string) error {
 			if sh.Auto {
 				notes = append(notes, "auto")
 			}
+			if sh.BaseSetID != 0 {
+				notes = append(notes, fmt.Sprintf("base: %d", sh.BaseSetID))
+			}
+			if sh.KeyID != "" {
+				notes = append(notes, "encrypted")
+			}
 			if sh.Broken != "" {
 				notes = append(notes, "broken: "+sh.Broken)
 			}
@@ -161,19 +249,74 @@ func (x *savedCmd) Execute([]string) error {
 	return nil
 }
 
+func (x *savedCmd) showFiles(setID uint64, snap string) error {
+	key, err := x.encryptionKey()
+	if err != nil {
+		return err
+	}
+	files, err := x.client.SnapshotFiles(setID, snap, strutil.CommaSeparatedList(x.Users), key)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		fmt.Fprintln(Stdout, i18n.G("No files found."))
+		return nil
+	}
+	w := tabWriter()
+	defer w.Flush()
+
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+		i18n.G("Mode"),
+		i18n.G("User"),
+		i18n.G("Size"),
+		// TRANSLATORS: 'Set' as in group or bag of things
+		i18n.G("Set"),
+		i18n.G("Path"))
+	for _, f := range files {
+		user := f.User
+		if user == "" {
+			user = "-"
+		}
+		path := f.Path
+		if f.Link != "" {
+			path += " -> " + f.Link
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", f.Mode, user, fmtSize(f.Size), f.SetID, path)
+	}
+	return nil
+}
+
 type saveCmd struct {
 	waitMixin
 	durationMixin
-	Users      string `long:"users"`
-	Positional struct {
+	encryptionKeyMixin
+	Users       string     `long:"users"`
+	Compression string     `long:"compression" choice:"none" choice:"gzip" choice:"gzip-fast"`
+	Base        snapshotID `long:"base"`
+	Positional  struct {
 		Snaps []installedSnapName `positional-arg-name:"<snap>"`
 	} `positional-args:"yes"`
 }
 
 func (x *saveCmd) Execute([]string) error {
 	snaps := installedSnapNames(x.Positional.Snaps)
-	users := strutil.CommaSeparatedList(x.Users)
-	setID, changeID, err := x.client.SnapshotMany(snaps, users)
+	opts := &client.SnapshotOptions{
+		Users:       strutil.CommaSeparatedList(x.Users),
+		Compression: x.Compression,
+	}
+	if x.Base != "" {
+		baseSetID, err := x.Base.ToUint()
+		if err != nil {
+			return err
+		}
+		opts.BaseSetID = baseSetID
+	}
+	key, err := x.encryptionKey()
+	if err != nil {
+		return err
+	}
+	opts.EncryptionKey = key
+	setID, changeID, err := x.client.SnapshotMany(snaps, opts)
 	if err != nil {
 		return err
 	}
@@ -229,6 +372,7 @@ func (x *forgetCmd) Execute([]string) error {
 
 type checkSnapshotCmd struct {
 	waitMixin
+	encryptionKeyMixin
 	Users      string `long:"users"`
 	Positional struct {
 		ID    snapshotID          `positional-arg-name:"<id>"`
@@ -243,7 +387,11 @@ func (x *checkSnapshotCmd) Execute([]string) error {
 	}
 	snaps := installedSnapNames(x.Positional.Snaps)
 	users := strutil.CommaSeparatedList(x.Users)
-	changeID, err := x.client.CheckSnapshots(setID, snaps, users)
+	key, err := x.encryptionKey()
+	if err != nil {
+		return err
+	}
+	changeID, err := x.client.CheckSnapshots(setID, snaps, users, key)
 	if err != nil {
 		return err
 	}
@@ -268,7 +416,10 @@ func (x *checkSnapshotCmd) Execute([]string) error {
 
 type restoreCmd struct {
 	waitMixin
-	Users      string `long:"users"`
+	encryptionKeyMixin
+	Users      string   `long:"users"`
+	Paths      []string `long:"path"`
+	Target     string   `long:"target"`
 	Positional struct {
 		ID    snapshotID          `positional-arg-name:"<id>"`
 		Snaps []installedSnapName `positional-arg-name:"<snap>"`
@@ -282,7 +433,17 @@ func (x *restoreCmd) Execute([]string) error {
 	}
 	snaps := installedSnapNames(x.Positional.Snaps)
 	users := strutil.CommaSeparatedList(x.Users)
-	changeID, err := x.client.RestoreSnapshots(setID, snaps, users)
+	key, err := x.encryptionKey()
+	if err != nil {
+		return err
+	}
+	if len(x.Paths) > 0 {
+		return x.restoreFiles(setID, snaps, users, key)
+	}
+	if x.Target != "" {
+		return fmt.Errorf(i18n.G("--target can only be used with --path"))
+	}
+	changeID, err := x.client.RestoreSnapshots(setID, snaps, users, key)
 	if err != nil {
 		return err
 	}
@@ -305,6 +466,100 @@ func (x *restoreCmd) Execute([]string) error {
 	return nil
 }
 
+func (x *restoreCmd) restoreFiles(setID uint64, snaps []string, users []string, key string) error {
+	target := x.Target
+	if target == "" {
+		target = "."
+	}
+	target, err := filepath.Abs(target)
+	if err != nil {
+		return err
+	}
+	changeID, err := x.client.RestoreSnapshotFiles(setID, snaps, users, x.Paths, target, key)
+	if err != nil {
+		return err
+	}
+	_, err = x.wait(changeID)
+	if err == noWait {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(Stdout, i18n.G("Restored files from snapshot #%s into %q.\n"), x.Positional.ID, target)
+	return nil
+}
+
+type exportSnapshotCmd struct {
+	clientMixin
+	Positional struct {
+		ID       snapshotID     `positional-arg-name:"<id>"`
+		Filename flags.Filename `positional-arg-name:"<filename>"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func (x *exportSnapshotCmd) Execute([]string) (err error) {
+	setID, err := x.Positional.ID.ToUint()
+	if err != nil {
+		return err
+	}
+
+	exportStream, err := x.client.SnapshotExport(setID)
+	if err != nil {
+		return err
+	}
+	defer exportStream.Close()
+
+	filename := string(x.Positional.Filename)
+	aw, err := osutil.NewAtomicFile(filename, 0600, 0, osutil.NoChown, osutil.NoChown)
+	if err != nil {
+		return err
+	}
+	// Cancel is a NOP once Commit succeeded
+	defer aw.Cancel()
+
+	if _, err := io.Copy(aw, exportStream); err != nil {
+		return fmt.Errorf(i18n.G("cannot export snapshot #%s: %v"), x.Positional.ID, err)
+	}
+	if err := aw.Commit(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(Stdout, i18n.G("Exported snapshot #%s into %q.\n"), x.Positional.ID, filename)
+	return nil
+}
+
+type importSnapshotCmd struct {
+	clientMixin
+	durationMixin
+	Positional struct {
+		Filename flags.Filename `positional-arg-name:"<filename>"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func (x *importSnapshotCmd) Execute([]string) error {
+	f, err := os.Open(string(x.Positional.Filename))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	importSet, err := x.client.SnapshotImport(f)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(Stdout, i18n.G("Imported snapshot as #%d.\n"), importSet.ID)
+
+	y := &savedCmd{
+		clientMixin:   x.clientMixin,
+		durationMixin: x.durationMixin,
+		ID:            snapshotID(strconv.FormatUint(importSet.ID, 10)),
+	}
+	return y.Execute(nil)
+}
+
 func init() {
 	addCommand("saved",
 		shortSavedHelp,
@@ -312,9 +567,13 @@ func init() {
 		func() flags.Commander {
 			return &savedCmd{}
 		},
-		durationDescs.also(map[string]string{
+		durationDescs.also(encryptionKeyDescs).also(map[string]string{
 			// TRANSLATORS: This should not start with a lowercase letter.
 			"id": i18n.G("Show only a specific snapshot."),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"files": i18n.G("List the files in the snapshot of the given snap"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"users": i18n.G("With --files, list files of only specific users (comma-separated) (default: all users)"),
 		}),
 		nil)
 
@@ -323,9 +582,13 @@ func init() {
 		longSaveHelp,
 		func() flags.Commander {
 			return &saveCmd{}
-		}, durationDescs.also(waitDescs).also(map[string]string{
+		}, durationDescs.also(waitDescs).also(encryptionKeyDescs).also(map[string]string{
 			// TRANSLATORS: This should not start with a lowercase letter.
 			"users": i18n.G("Snapshot data of only specific users (comma-separated) (default: all users)"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"compression": i18n.G("Compression to use for the snapshot's archives (default: gzip; gzip-fast is faster, but compresses less)"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"base": i18n.G("Only save what changed since the snapshot with the given set id"),
 		}), nil)
 
 	addCommand("restore",
@@ -333,9 +596,13 @@ func init() {
 		longRestoreHelp,
 		func() flags.Commander {
 			return &restoreCmd{}
-		}, waitDescs.also(map[string]string{
+		}, waitDescs.also(encryptionKeyDescs).also(map[string]string{
 			// TRANSLATORS: This should not start with a lowercase letter.
 			"users": i18n.G("Restore data of only specific users (comma-separated) (default: all users)"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"path": i18n.G("Restore only the files matching the given glob pattern, into --target (can be repeated)"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"target": i18n.G("Directory to restore the files given with --path into (default: the current directory)"),
 		}), nil)
 
 	addCommand("forget",
@@ -350,8 +617,22 @@ func init() {
 		longCheckHelp,
 		func() flags.Commander {
 			return &checkSnapshotCmd{}
-		}, waitDescs.also(map[string]string{
+		}, waitDescs.also(encryptionKeyDescs).also(map[string]string{
 			// TRANSLATORS: This should not start with a lowercase letter.
 			"users": i18n.G("Check data of only specific users (comma-separated) (default: all users)"),
 		}), nil)
+
+	addCommand("export-snapshot",
+		shortExportHelp,
+		longExportHelp,
+		func() flags.Commander {
+			return &exportSnapshotCmd{}
+		}, nil, nil)
+
+	addCommand("import-snapshot",
+		shortImportHelp,
+		longImportHelp,
+		func() flags.Commander {
+			return &importSnapshotCmd{}
+		}, durationDescs, nil)
 }
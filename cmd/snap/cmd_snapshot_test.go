@@ -20,13 +20,18 @@
 package main_test
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"path/filepath"
 	"strings"
 
 	. "gopkg.in/check.v1"
 
+	"github.com/snapcore/snapd/client"
 	"github.com/snapcore/snapd/cmd/snap"
+	"github.com/snapcore/snapd/testutil"
 )
 
 var snapshotsTests = []getCmdArgs{{
@@ -107,3 +112,265 @@ func (s *SnapSuite) mockSnapshotsServer(c *C) {
 		}
 	})
 }
+
+func (s *SnapSuite) TestSaveIncremental(c *C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		switch n {
+		case 1:
+			c.Check(r.Method, Equals, "POST")
+			c.Check(r.URL.Path, Equals, "/v2/snaps")
+			c.Check(DecodedRequestBody(c, r), DeepEquals, map[string]interface{}{
+				"action":      "snapshot",
+				"snaps":       []interface{}{"htop"},
+				"compression": "none",
+				"base-set-id": json.Number("3"),
+			})
+			fmt.Fprintln(w, `{"type":"async", "status-code": 202, "change": "9", "result": {"set-id": 4}}`)
+		case 2:
+			c.Check(r.URL.Path, Equals, "/v2/changes/9")
+			fmt.Fprintln(w, `{"type": "sync", "result": {"ready": true, "status": "Done", "data": {}}}`)
+		case 3:
+			c.Check(r.URL.Path, Equals, "/v2/snapshots")
+			c.Check(r.URL.Query().Get("set"), Equals, "4")
+			fmt.Fprintln(w, `{"type":"sync","status-code":200,"status":"OK","result":[{"id":4,"snapshots":[{"set":4,"time":"2019-03-18T16:15:20.48905909Z","snap":"htop","revision":"1168","snap-id":"Z","base-set-id":3,"epoch":{"read":[0],"write":[0]},"summary":"","version":"2","sha3-384":{"archive.tar":""},"size":1}]}]}`)
+		default:
+			c.Fatalf("unexpected request %d: %s %s", n, r.Method, r.URL.Path)
+		}
+	})
+
+	restore := main.MockIsStdinTTY(true)
+	defer restore()
+
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"save", "--compression=none", "--base=3", "htop"})
+	c.Assert(err, IsNil)
+	c.Check(s.Stdout(), Matches, "Set  Snap  Age    Version  Rev   Size    Notes\n4    htop  .*  2        1168      1B  base: 3\n")
+	c.Check(s.Stderr(), Equals, "")
+	c.Check(n, Equals, 3)
+}
+
+func (s *SnapSuite) TestSaveBadBase(c *C) {
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"save", "--base=x"})
+	c.Check(err, ErrorMatches, "invalid argument for set id: expected a non-negative integer argument")
+
+	_, err = main.Parser(main.Client()).ParseArgs([]string{"save", "--compression=lzma"})
+	c.Check(err, ErrorMatches, "(?s).*Invalid value `lzma' for option `--compression'.*")
+}
+
+func (s *SnapSuite) TestSaveEncrypted(c *C) {
+	key := strings.Repeat("ab", 32)
+	keyFile := filepath.Join(c.MkDir(), "key")
+	c.Assert(ioutil.WriteFile(keyFile, []byte(key+"\n"), 0600), IsNil)
+
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		switch n {
+		case 1:
+			c.Check(r.Method, Equals, "POST")
+			c.Check(r.URL.Path, Equals, "/v2/snaps")
+			c.Check(DecodedRequestBody(c, r), DeepEquals, map[string]interface{}{
+				"action":         "snapshot",
+				"snaps":          []interface{}{"htop"},
+				"encryption-key": key,
+			})
+			fmt.Fprintln(w, `{"type":"async", "status-code": 202, "change": "9", "result": {"set-id": 4}}`)
+		case 2:
+			c.Check(r.URL.Path, Equals, "/v2/changes/9")
+			fmt.Fprintln(w, `{"type": "sync", "result": {"ready": true, "status": "Done", "data": {}}}`)
+		case 3:
+			c.Check(r.URL.Path, Equals, "/v2/snapshots")
+			fmt.Fprintln(w, `{"type":"sync","status-code":200,"status":"OK","result":[{"id":4,"snapshots":[{"set":4,"time":"2019-03-18T16:15:20.48905909Z","snap":"htop","revision":"1168","snap-id":"Z","key-id":"0123456789abcdef","epoch":{"read":[0],"write":[0]},"summary":"","version":"2","sha3-384":{"archive.tgz":""},"size":1}]}]}`)
+		default:
+			c.Fatalf("unexpected request %d: %s %s", n, r.Method, r.URL.Path)
+		}
+	})
+
+	restore := main.MockIsStdinTTY(true)
+	defer restore()
+
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"save", "--encryption-key-file=" + keyFile, "htop"})
+	c.Assert(err, IsNil)
+	c.Check(s.Stdout(), Matches, "Set  Snap  Age    Version  Rev   Size    Notes\n4    htop  .*  2        1168      1B  encrypted\n")
+	c.Check(s.Stderr(), Equals, "")
+	c.Check(n, Equals, 3)
+}
+
+func (s *SnapSuite) TestCheckSnapshotEncrypted(c *C) {
+	key := strings.Repeat("ab", 32)
+	keyFile := filepath.Join(c.MkDir(), "key")
+	c.Assert(ioutil.WriteFile(keyFile, []byte(key), 0600), IsNil)
+
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		switch n {
+		case 1:
+			c.Check(r.URL.Path, Equals, "/v2/snapshots")
+			c.Check(DecodedRequestBody(c, r), DeepEquals, map[string]interface{}{
+				"set":            json.Number("4"),
+				"action":         "check",
+				"encryption-key": key,
+			})
+			fmt.Fprintln(w, `{"type":"async", "status-code": 202, "change": "9"}`)
+		case 2:
+			c.Check(r.URL.Path, Equals, "/v2/changes/9")
+			fmt.Fprintln(w, `{"type": "sync", "result": {"ready": true, "status": "Done", "data": {}}}`)
+		default:
+			c.Fatalf("unexpected request %d: %s %s", n, r.Method, r.URL.Path)
+		}
+	})
+
+	restore := main.MockIsStdinTTY(true)
+	defer restore()
+
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"check-snapshot", "--encryption-key-file=" + keyFile, "4"})
+	c.Assert(err, IsNil)
+	c.Check(s.Stdout(), Equals, "Snapshot #4 verified successfully.\n")
+	c.Check(n, Equals, 2)
+}
+
+func (s *SnapSuite) TestEncryptionKeyFileErrors(c *C) {
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"restore", "--encryption-key-file=/does/not/exist", "4"})
+	c.Check(err, ErrorMatches, "cannot read encryption key: open /does/not/exist: no such file or directory")
+
+	_, err = main.Parser(main.Client()).ParseArgs([]string{"saved", "--encryption-key-file=/some/key"})
+	c.Check(err, ErrorMatches, "--encryption-key-file can only be used with --files")
+}
+
+func (s *SnapSuite) TestSavedFiles(c *C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		c.Check(r.Method, Equals, "GET")
+		c.Check(r.URL.Path, Equals, "/v2/snapshots/3/htop/files")
+		c.Check(r.URL.Query().Get("users"), Equals, "joe")
+		c.Check(r.Header.Get("X-Snapshot-Encryption-Key"), Equals, "0123")
+		fmt.Fprintln(w, `{"type":"sync","status-code":200,"status":"OK","result":[
+			{"path":"1168","size":0,"mode":2147484141,"mtime":"2019-03-18T16:15:20Z","set":2},
+			{"path":"1168/config","size":2048,"mode":420,"mtime":"2019-03-18T16:15:20Z","set":3},
+			{"user":"joe","path":"common/current","size":0,"mode":134218239,"mtime":"2019-03-18T16:15:20Z","link":"1168","set":2}
+		]}`)
+	})
+
+	keyFile := filepath.Join(c.MkDir(), "key")
+	c.Assert(ioutil.WriteFile(keyFile, []byte("0123"), 0600), IsNil)
+
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"saved", "--id=3", "--files", "--users=joe", "--encryption-key-file=" + keyFile, "htop"})
+	c.Assert(err, IsNil)
+	c.Check(s.Stdout(), Equals, `Mode        User  Size    Set  Path
+drwxr-xr-x  -         0B  2    1168
+-rw-r--r--  -      2048B  3    1168/config
+Lrwxrwxrwx  joe       0B  2    common/current -> 1168
+`)
+	c.Check(s.Stderr(), Equals, "")
+	c.Check(n, Equals, 1)
+}
+
+func (s *SnapSuite) TestSavedFilesErrors(c *C) {
+	for _, args := range [][]string{
+		{"saved", "--files", "htop"},
+		{"saved", "--id=3", "--files"},
+		{"saved", "--id=3", "--files", "htop", "vlc"},
+	} {
+		_, err := main.Parser(main.Client()).ParseArgs(args)
+		c.Check(err, ErrorMatches, "--files needs a snapshot set given with --id, and a single snap")
+	}
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"saved", "--users=joe"})
+	c.Check(err, ErrorMatches, "--users can only be used with --files")
+}
+
+func (s *SnapSuite) TestRestorePaths(c *C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		switch n {
+		case 1:
+			c.Check(r.Method, Equals, "POST")
+			c.Check(r.URL.Path, Equals, "/v2/snapshots")
+			c.Check(DecodedRequestBody(c, r), DeepEquals, map[string]interface{}{
+				"set":    json.Number("3"),
+				"action": "restore",
+				"snaps":  []interface{}{"htop"},
+				"paths":  []interface{}{"1168/config", "common/*"},
+				"target": "/tmp/restored",
+			})
+			fmt.Fprintln(w, `{"type":"async", "status-code": 202, "change": "9"}`)
+		case 2:
+			c.Check(r.URL.Path, Equals, "/v2/changes/9")
+			fmt.Fprintln(w, `{"type": "sync", "result": {"ready": true, "status": "Done", "data": {}}}`)
+		default:
+			c.Fatalf("unexpected request %d: %s %s", n, r.Method, r.URL.Path)
+		}
+	})
+
+	restore := main.MockIsStdinTTY(true)
+	defer restore()
+
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"restore", "--path=1168/config", "--path=common/*", "--target=/tmp/restored/", "3", "htop"})
+	c.Assert(err, IsNil)
+	c.Check(s.Stdout(), Equals, "Restored files from snapshot #3 into \"/tmp/restored\".\n")
+	c.Check(s.Stderr(), Equals, "")
+	c.Check(n, Equals, 2)
+}
+
+func (s *SnapSuite) TestRestoreTargetWithoutPath(c *C) {
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"restore", "--target=/tmp", "3"})
+	c.Check(err, ErrorMatches, "--target can only be used with --path")
+}
+
+func (s *SnapSuite) TestSnapshotExport(c *C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, Equals, "GET")
+		c.Check(r.URL.Path, Equals, "/v2/snapshots/3/export")
+		w.Header().Set("Content-Type", client.SnapshotExportMediaType)
+		fmt.Fprint(w, "exported snapshot set")
+	})
+
+	filename := filepath.Join(c.MkDir(), "export.snapshot")
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"export-snapshot", "3", filename})
+	c.Assert(err, IsNil)
+	c.Check(s.Stdout(), Equals, fmt.Sprintf("Exported snapshot #3 into %q.\n", filename))
+	c.Check(s.Stderr(), Equals, "")
+	c.Check(filename, testutil.FileEquals, "exported snapshot set")
+}
+
+func (s *SnapSuite) TestSnapshotExportError(c *C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(404)
+		fmt.Fprintln(w, `{"type": "error", "status-code": 404, "result": {"message": "no snapshot set with the given ID"}}`)
+	})
+
+	filename := filepath.Join(c.MkDir(), "export.snapshot")
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"export-snapshot", "3", filename})
+	c.Assert(err, ErrorMatches, "no snapshot set with the given ID")
+	c.Check(filename, testutil.FileAbsent)
+}
+
+func (s *SnapSuite) TestSnapshotImport(c *C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, Equals, "/v2/snapshots")
+		switch r.Method {
+		case "POST":
+			c.Check(r.Header.Get("Content-Type"), Equals, client.SnapshotExportMediaType)
+			data, err := ioutil.ReadAll(r.Body)
+			c.Assert(err, IsNil)
+			c.Check(string(data), Equals, "exported snapshot set")
+			fmt.Fprintln(w, `{"type": "sync", "result": {"set-id": 3, "snaps": ["htop"]}}`)
+		case "GET":
+			c.Check(r.URL.Query().Get("set"), Equals, "3")
+			fmt.Fprintln(w, `{"type":"sync","status-code":200,"status":"OK","result":[{"id":3,"snapshots":[{"set":3,"time":"2019-03-18T16:15:20.48905909Z","snap":"htop","revision":"1168","snap-id":"Z","epoch":{"read":[0],"write":[0]},"summary":"","version":"2","sha3-384":{"archive.tgz":""},"size":1}]}]}`)
+		default:
+			c.Errorf("unexpected method %q", r.Method)
+		}
+	})
+
+	filename := filepath.Join(c.MkDir(), "export.snapshot")
+	c.Assert(ioutil.WriteFile(filename, []byte("exported snapshot set"), 0600), IsNil)
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"import-snapshot", filename})
+	c.Assert(err, IsNil)
+	c.Check(s.Stdout(), Matches, "Imported snapshot as #3.\nSet  Snap  Age    Version  Rev   Size    Notes\n3    htop  .*  2        1168      1B  -\n")
+	c.Check(s.Stderr(), Equals, "")
+}
@@ -22,7 +22,10 @@ package main
 import (
 	"github.com/jessevdk/go-flags"
 
+	"github.com/snapcore/snapd/client"
 	"github.com/snapcore/snapd/i18n"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/progress"
 )
 
 type cmdWatch struct{ changeIDMixin }
@@ -55,7 +58,70 @@ func (x *cmdWatch) Execute(args []string) error {
 	// without --no-wait), so we fake it here.
 	wmx := &waitMixin{skipAbort: true}
 	wmx.client = x.client
-	_, err = wmx.wait(id)
 
+	sub, err := x.client.Events(&client.EventsOptions{
+		Types:    []string{client.EventChange, client.EventTask, client.EventProgress},
+		ChangeID: id,
+	})
+	if err != nil {
+		// snapd too old to send events, or the change is gone; polling
+		// handles both
+		logger.Debugf("cannot subscribe to events of change %s: %v", id, err)
+		_, err = wmx.wait(id)
+		return err
+	}
+	defer sub.Close()
+
+	if err := x.follow(id, sub); err != nil {
+		return err
+	}
+
+	// the change is ready (or snapd went away), get the outcome
+	_, err = wmx.wait(id)
 	return err
 }
+
+// follow shows the progress of the change with the given id as events
+// about it come in, until it is ready or the events stop.
+func (x *cmdWatch) follow(id string, sub *client.EventSubscription) error {
+	// subscribed first so nothing is missed, but the change might
+	// already be done
+	chg, err := queryChange(x.client, id)
+	if err != nil {
+		return err
+	}
+	if chg.Ready {
+		return nil
+	}
+
+	pb := progress.MakeProgressBar()
+	defer pb.Finished()
+
+	var lastID string
+	for {
+		ev, err := sub.Next()
+		if err != nil {
+			logger.Debugf("cannot get events of change %s: %v", id, err)
+			return nil
+		}
+		switch ev.Type {
+		case client.EventChange:
+			if ev.Change.Ready {
+				return nil
+			}
+		case client.EventTask, client.EventProgress:
+			t := ev.Task
+			switch {
+			case t.Status != "Doing":
+				continue
+			case t.Progress.Total == 1:
+				pb.Spin(t.Summary)
+			case t.ID == lastID:
+				pb.Set(float64(t.Progress.Done))
+			default:
+				pb.Start(t.Summary, float64(t.Progress.Total))
+				lastID = t.ID
+			}
+		}
+	}
+}
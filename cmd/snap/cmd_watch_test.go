@@ -40,6 +40,8 @@ var fmtWatchChangeJSON = `{"type": "sync", "result": {
   "tasks": [{"id": "84", "kind": "bar", "summary": "some summary", "status": "Doing", "progress": {"label": "my-snap", "done": %d, "total": %d}, "spawn-time": "2016-04-21T01:02:03Z", "ready-time": "2016-04-21T01:02:04Z"}]
 }}`
 
+var fmtWatchProgressEvent = "\x1e" + `{"type": "progress", "time": "2016-04-21T01:02:03Z", "task": {"id": "84", "change-id": "two", "kind": "bar", "summary": "some summary", "status": "Doing", "progress": {"label": "my-snap", "done": %d, "total": %d}}}` + "\n"
+
 func (s *SnapSuite) TestCmdWatch(c *C) {
 	meter := &progresstest.Meter{}
 	defer progress.MockMeter(meter)()
@@ -52,12 +54,16 @@ func (s *SnapSuite) TestCmdWatch(c *C) {
 		switch n {
 		case 1:
 			c.Check(r.Method, Equals, "GET")
-			c.Check(r.URL.Path, Equals, "/v2/changes/two")
-			fmt.Fprintf(w, fmtWatchChangeJSON, 0, 100*1024)
+			c.Check(r.URL.Path, Equals, "/v2/events")
+			c.Check(r.URL.Query().Get("change-id"), Equals, "two")
+			c.Check(r.URL.Query().Get("types"), Equals, "change,task,progress")
+			fmt.Fprintf(w, fmtWatchProgressEvent, 0, 100*1024)
+			fmt.Fprintf(w, fmtWatchProgressEvent, 50*1024, 100*1024)
+			fmt.Fprintln(w, "\x1e"+`{"type": "change", "time": "2016-04-21T01:02:04Z", "change": {"id": "two", "status": "Done", "ready": true}}`)
 		case 2:
 			c.Check(r.Method, Equals, "GET")
 			c.Check(r.URL.Path, Equals, "/v2/changes/two")
-			fmt.Fprintf(w, fmtWatchChangeJSON, 50*1024, 100*1024)
+			fmt.Fprintf(w, fmtWatchChangeJSON, 0, 100*1024)
 		case 3:
 			c.Check(r.Method, Equals, "GET")
 			c.Check(r.URL.Path, Equals, "/v2/changes/two")
@@ -71,11 +77,71 @@ func (s *SnapSuite) TestCmdWatch(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(rest, HasLen, 0)
 	c.Check(n, Equals, 3)
+	c.Check(meter.Labels, DeepEquals, []string{"some summary"})
 	c.Check(meter.Values, DeepEquals, []float64{51200})
 	c.Check(s.Stdout(), Equals, "")
 	c.Check(s.Stderr(), Equals, "")
 }
 
+func (s *SnapSuite) TestCmdWatchError(c *C) {
+	meter := &progresstest.Meter{}
+	defer progress.MockMeter(meter)()
+	defer snap.MockMaxGoneTime(time.Millisecond)()
+	defer snap.MockPollTime(time.Millisecond)()
+
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		switch n {
+		case 1:
+			c.Check(r.URL.Path, Equals, "/v2/events")
+			fmt.Fprintln(w, "\x1e"+`{"type": "change", "time": "2016-04-21T01:02:04Z", "change": {"id": "two", "status": "Error", "ready": true}}`)
+		case 2:
+			c.Check(r.URL.Path, Equals, "/v2/changes/two")
+			fmt.Fprintf(w, fmtWatchChangeJSON, 0, 100*1024)
+		case 3:
+			c.Check(r.URL.Path, Equals, "/v2/changes/two")
+			fmt.Fprintln(w, `{"type": "sync", "result": {"id": "two", "ready": true, "status": "Error", "err": "boom"}}`)
+		default:
+			c.Errorf("expected 3 queries, currently on %d", n)
+		}
+	})
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"watch", "two"})
+	c.Assert(err, ErrorMatches, "boom")
+	c.Check(n, Equals, 3)
+}
+
+func (s *SnapSuite) TestCmdWatchEventsEndEarly(c *C) {
+	meter := &progresstest.Meter{}
+	defer progress.MockMeter(meter)()
+	defer snap.MockMaxGoneTime(time.Millisecond)()
+	defer snap.MockPollTime(time.Millisecond)()
+
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		switch n {
+		case 1:
+			// snapd goes away before the change is ready
+			c.Check(r.URL.Path, Equals, "/v2/events")
+			fmt.Fprintf(w, fmtWatchProgressEvent, 0, 100*1024)
+		case 2, 3:
+			c.Check(r.URL.Path, Equals, "/v2/changes/two")
+			fmt.Fprintf(w, fmtWatchChangeJSON, 50*1024, 100*1024)
+		case 4:
+			c.Check(r.URL.Path, Equals, "/v2/changes/two")
+			fmt.Fprintln(w, `{"type": "sync", "result": {"id": "two", "ready": true, "status": "Done"}}`)
+		default:
+			c.Errorf("expected 4 queries, currently on %d", n)
+		}
+	})
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"watch", "two"})
+	c.Assert(err, IsNil)
+	c.Check(n, Equals, 4)
+}
+
 func (s *SnapSuite) TestWatchLast(c *C) {
 	meter := &progresstest.Meter{}
 	defer progress.MockMeter(meter)()
@@ -91,25 +157,31 @@ func (s *SnapSuite) TestWatchLast(c *C) {
 			c.Check(r.URL.Path, Equals, "/v2/changes")
 			fmt.Fprintln(w, mockChangesJSON)
 		case 2:
+			// snapd without events support
+			c.Check(r.Method, Equals, "GET")
+			c.Check(r.URL.Path, Equals, "/v2/events")
+			w.WriteHeader(404)
+			fmt.Fprintln(w, `{"type": "error", "status-code": 404, "result": {"message": "not found"}}`)
+		case 3:
 			c.Check(r.Method, Equals, "GET")
 			c.Check(r.URL.Path, Equals, "/v2/changes/two")
 			fmt.Fprintf(w, fmtWatchChangeJSON, 0, 100*1024)
-		case 3:
+		case 4:
 			c.Check(r.Method, Equals, "GET")
 			c.Check(r.URL.Path, Equals, "/v2/changes/two")
 			fmt.Fprintf(w, fmtWatchChangeJSON, 50*1024, 100*1024)
-		case 4:
+		case 5:
 			c.Check(r.Method, Equals, "GET")
 			c.Check(r.URL.Path, Equals, "/v2/changes/two")
 			fmt.Fprintln(w, `{"type": "sync", "result": {"id": "two", "ready": true, "status": "Done"}}`)
 		default:
-			c.Errorf("expected 4 queries, currently on %d", n)
+			c.Errorf("expected 5 queries, currently on %d", n)
 		}
 	})
 	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"watch", "--last=install"})
 	c.Assert(err, IsNil)
 	c.Assert(rest, HasLen, 0)
-	c.Check(n, Equals, 4)
+	c.Check(n, Equals, 5)
 	c.Check(meter.Values, DeepEquals, []float64{51200})
 	c.Check(s.Stdout(), Equals, "")
 	c.Check(s.Stderr(), Equals, "")
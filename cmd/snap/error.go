@@ -222,6 +222,17 @@ If you understand and want to proceed repeat the command including --classic.
 		isError = false
 		usesSnapName = false
 		msg = i18n.G("snapd is about to reboot the system")
+	case client.ErrorKindAccessDenied:
+		usesSnapName = false
+		msg = err.Message
+		if v, ok := err.Value.(map[string]interface{}); ok {
+			role, _ := v["role"].(string)
+			required, _ := v["required"].(string)
+			if role != "" && required != "" {
+				// TRANSLATORS: %s is an error message, %q are roles from the snapd access policy (e.g. "viewer")
+				msg = fmt.Sprintf(i18n.G(`%s (needs the %q role, you have %q)`), err.Message, required, role)
+			}
+		}
 	default:
 		usesSnapName = false
 		msg = err.Message
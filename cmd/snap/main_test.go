@@ -226,6 +226,19 @@ func (s *SnapSuite) TestAccessDeniedHint(c *C) {
 	c.Check(err.Error(), Equals, `access denied (try with sudo)`)
 }
 
+func (s *SnapSuite) TestAccessDeniedByPolicy(c *C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"type": "error", "result": {"message": "access denied", "kind": "access-denied", "value": {"role": "viewer", "required": "operator"}}, "status-code": 403}`)
+	})
+
+	restore := mockArgs("snap", "refresh", "foo")
+	defer restore()
+
+	err := snap.RunMain()
+	c.Assert(err, NotNil)
+	c.Check(err.Error(), Equals, `access denied (needs the "operator" role, you have "viewer")`)
+}
+
 func (s *SnapSuite) TestExtraArgs(c *C) {
 	restore := mockArgs("snap", "abort", "1", "xxx", "zzz")
 	defer restore()
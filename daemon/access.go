@@ -0,0 +1,260 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"os/user"
+	"strconv"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+// accessRole is what an access policy lets a user do; each role can do
+// everything the ones before it can.
+type accessRole int
+
+const (
+	roleNone accessRole = iota
+	// roleViewer can GET from the routes any user can GET from
+	roleViewer
+	// roleOperator can also use the routes and snap actions that
+	// are OperatorOK, e.g. to start and stop services, and refresh
+	roleOperator
+	// roleAdmin can do anything
+	roleAdmin
+)
+
+var roleNames = map[accessRole]string{
+	roleNone:     "none",
+	roleViewer:   "viewer",
+	roleOperator: "operator",
+	roleAdmin:    "admin",
+}
+
+func (r accessRole) String() string {
+	return roleNames[r]
+}
+
+func parseAccessRole(s string) (accessRole, error) {
+	for role, name := range roleNames {
+		if role != roleNone && name == s {
+			return role, nil
+		}
+	}
+	return roleNone, fmt.Errorf("unknown role %q", s)
+}
+
+// operatorSnapActions are the snap actions an operator can do.
+var operatorSnapActions = map[string]bool{
+	"refresh": true,
+}
+
+// accessPolicy maps Unix groups and snapd users to roles. Requests
+// from users it gives a role to are allowed exactly what the role
+// allows, except for root, which can always do everything; other
+// requests are checked as usual.
+type accessPolicy struct {
+	groups map[string]accessRole
+	users  map[string]accessRole
+}
+
+type accessPolicyYaml struct {
+	// Groups maps Unix group names to roles.
+	Groups map[string]string `yaml:"groups"`
+	// Users maps the username or email of snapd users to roles.
+	Users map[string]string `yaml:"users"`
+}
+
+// loadAccessPolicy reads the access policy in the given file, or
+// returns nil if there is none. As the policy hands out roles, the
+// file must be owned by root and not writable by anybody else.
+func loadAccessPolicy(fn string) (*accessPolicy, error) {
+	data, err := osutil.ReadProtectedFile(fn)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot use access policy %s: %v", fn, err)
+	}
+
+	var py accessPolicyYaml
+	if err := yaml.Unmarshal(data, &py); err != nil {
+		return nil, fmt.Errorf("cannot parse access policy: %v", err)
+	}
+
+	policy := &accessPolicy{
+		groups: make(map[string]accessRole, len(py.Groups)),
+		users:  make(map[string]accessRole, len(py.Users)),
+	}
+	for group, name := range py.Groups {
+		role, err := parseAccessRole(name)
+		if err != nil {
+			return nil, fmt.Errorf("cannot use access policy: group %q: %v", group, err)
+		}
+		policy.groups[group] = role
+	}
+	for u, name := range py.Users {
+		role, err := parseAccessRole(name)
+		if err != nil {
+			return nil, fmt.Errorf("cannot use access policy: user %q: %v", u, err)
+		}
+		policy.users[u] = role
+	}
+	return policy, nil
+}
+
+// loadSystemAccessPolicy loads the system access policy; if it cannot
+// be used, it is ignored as if there was none, with a warning.
+func loadSystemAccessPolicy(st *state.State) *accessPolicy {
+	policy, err := loadAccessPolicy(dirs.SnapAccessPolicyFile)
+	if err != nil {
+		logger.Noticef("Cannot load access policy from %s, ignoring it: %v", dirs.SnapAccessPolicyFile, err)
+		if st != nil {
+			st.Lock()
+			st.Warnf("cannot use access policy %s, ignoring it: %v", dirs.SnapAccessPolicyFile, err)
+			st.Unlock()
+		}
+		return nil
+	}
+	return policy
+}
+
+var userGroupNames = func(uid uint32) ([]string, error) {
+	u, err := user.LookupId(strconv.FormatUint(uint64(uid), 10))
+	if err != nil {
+		return nil, err
+	}
+	gids, err := u.GroupIds()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(gids))
+	for _, gid := range gids {
+		g, err := user.LookupGroupId(gid)
+		if err != nil {
+			continue
+		}
+		names = append(names, g.Name)
+	}
+	return names, nil
+}
+
+// roleFor returns the role the policy gives to the sender of the
+// request, if any. Root and snaps are never given a role.
+func (p *accessPolicy) roleFor(r *http.Request, u *auth.UserState) accessRole {
+	_, uid, socket, err := ucrednetGet(r.RemoteAddr)
+	if err == nil && (uid == 0 || socket == dirs.SnapSocket) {
+		return roleNone
+	}
+
+	role := roleNone
+	if u != nil {
+		for _, key := range []string{u.Username, u.Email} {
+			if key == "" {
+				continue
+			}
+			if ur, ok := p.users[key]; ok && ur > role {
+				role = ur
+			}
+		}
+	}
+	if err != nil {
+		return role
+	}
+
+	groups, err := userGroupNames(uid)
+	if err != nil {
+		logger.Debugf("cannot get groups of uid %d: %v", uid, err)
+		return role
+	}
+	for _, g := range groups {
+		if gr, ok := p.groups[g]; ok && gr > role {
+			role = gr
+		}
+	}
+	return role
+}
+
+// requiredRole returns the role needed to use the command with the
+// given method. Viewers can only GET what any user can; the other
+// routes can expose the data of all users, or be reserved to root.
+func (c *Command) requiredRole(method string) accessRole {
+	switch {
+	case method == "GET" && (c.GuestOK || c.UserOK):
+		return roleViewer
+	case c.OperatorOK:
+		return roleOperator
+	default:
+		return roleAdmin
+	}
+}
+
+// checkSnapActionRole denies the given snap action to the sender of
+// the request if the access policy gives it a role that cannot do it.
+func checkSnapActionRole(c *Command, r *http.Request, u *auth.UserState, action string) Response {
+	role := c.restrictedRole(r, u)
+	if role == roleNone || operatorSnapActions[action] {
+		return nil
+	}
+	logger.Noticef("Access denied to %s %s (action %q) for role %s.", r.Method, c.Path, action, role)
+	return AccessDenied(role, roleAdmin, "cannot %s snaps: access denied by the access policy", action)
+}
+
+// checkSnapInstructionRole is like checkSnapActionRole but also denies
+// the options of the instruction that only an admin can use: an
+// operator can refresh snaps, but not change their confinement or skip
+// their validation.
+func checkSnapInstructionRole(c *Command, r *http.Request, u *auth.UserState, inst *snapInstruction) Response {
+	if rsp := checkSnapActionRole(c, r, u, inst.Action); rsp != nil {
+		return rsp
+	}
+	role := c.restrictedRole(r, u)
+	if role == roleNone {
+		return nil
+	}
+	if inst.DevMode || inst.JailMode || inst.Classic || inst.IgnoreValidation {
+		logger.Noticef("Access denied to %s %s (action %q with confinement or validation options) for role %s.", r.Method, c.Path, inst.Action, role)
+		return AccessDenied(role, roleAdmin, "cannot %s snaps with devmode, jailmode, classic or ignore-validation: access denied by the access policy", inst.Action)
+	}
+	return nil
+}
+
+// restrictedRole returns the role the access policy gives to the
+// sender of the request if it is less than admin, or roleNone if
+// the request is not restricted by the policy.
+func (c *Command) restrictedRole(r *http.Request, u *auth.UserState) accessRole {
+	if c.d.accessPolicy == nil {
+		return roleNone
+	}
+	role := c.d.accessPolicy.roleFor(r, u)
+	if role >= roleAdmin {
+		return roleNone
+	}
+	return role
+}
@@ -0,0 +1,367 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/osutil/sys"
+	"github.com/snapcore/snapd/overlord/auth"
+)
+
+type accessSuite struct {
+	restore func()
+}
+
+var _ = check.Suite(&accessSuite{})
+
+func (s *accessSuite) SetUpTest(c *check.C) {
+	dirs.SetRootDir(c.MkDir())
+	s.restore = mockUserGroupNames(testUserGroupNames)
+}
+
+func (s *accessSuite) TearDownTest(c *check.C) {
+	s.restore()
+	dirs.SetRootDir("")
+}
+
+func testUserGroupNames(uid uint32) ([]string, error) {
+	groups := map[uint32][]string{
+		42: {"users", "ops"},
+		43: {"users"},
+	}
+	return groups[uid], nil
+}
+
+func writeAccessPolicy(c *check.C, content string) {
+	c.Assert(os.MkdirAll(filepath.Dir(dirs.SnapAccessPolicyFile), 0755), check.IsNil)
+	c.Assert(ioutil.WriteFile(dirs.SnapAccessPolicyFile, []byte(content), 0644), check.IsNil)
+}
+
+const testAccessPolicy = `
+groups:
+  users: viewer
+  ops: operator
+users:
+  boss@example.com: admin
+`
+
+func (s *accessSuite) TestLoadAccessPolicyMissing(c *check.C) {
+	policy, err := loadAccessPolicy(dirs.SnapAccessPolicyFile)
+	c.Assert(err, check.IsNil)
+	c.Check(policy, check.IsNil)
+	c.Check(loadSystemAccessPolicy(nil), check.IsNil)
+}
+
+func (s *accessSuite) TestLoadAccessPolicy(c *check.C) {
+	writeAccessPolicy(c, testAccessPolicy)
+
+	policy, err := loadAccessPolicy(dirs.SnapAccessPolicyFile)
+	c.Assert(err, check.IsNil)
+	c.Check(policy, check.DeepEquals, &accessPolicy{
+		groups: map[string]accessRole{"users": roleViewer, "ops": roleOperator},
+		users:  map[string]accessRole{"boss@example.com": roleAdmin},
+	})
+}
+
+func (s *accessSuite) TestLoadAccessPolicyErrors(c *check.C) {
+	for _, t := range []struct {
+		policy string
+		err    string
+	}{
+		{"groups: [", `cannot parse access policy: .*`},
+		{"groups: {users: root}", `cannot use access policy: group "users": unknown role "root"`},
+		{"users: {foo: none}", `cannot use access policy: user "foo": unknown role "none"`},
+	} {
+		writeAccessPolicy(c, t.policy)
+		_, err := loadAccessPolicy(dirs.SnapAccessPolicyFile)
+		c.Check(err, check.ErrorMatches, t.err)
+
+		// a broken policy is ignored
+		c.Check(loadSystemAccessPolicy(nil), check.IsNil)
+	}
+}
+
+func (s *accessSuite) TestLoadAccessPolicyUnsafeFile(c *check.C) {
+	writeAccessPolicy(c, testAccessPolicy)
+
+	c.Assert(os.Chmod(dirs.SnapAccessPolicyFile, 0664), check.IsNil)
+	_, err := loadAccessPolicy(dirs.SnapAccessPolicyFile)
+	c.Check(err, check.ErrorMatches, `cannot use access policy .*: writable by group or others`)
+	c.Check(loadSystemAccessPolicy(nil), check.IsNil)
+
+	c.Assert(os.Chmod(dirs.SnapAccessPolicyFile, 0644), check.IsNil)
+	restore := osutil.MockGeteuid(func() sys.UserID { return sys.UserID(os.Geteuid() + 1) })
+	defer restore()
+	_, err = loadAccessPolicy(dirs.SnapAccessPolicyFile)
+	c.Check(err, check.ErrorMatches, `cannot use access policy .*: not owned by root`)
+	c.Check(loadSystemAccessPolicy(nil), check.IsNil)
+}
+
+func (s *accessSuite) TestRoleFor(c *check.C) {
+	writeAccessPolicy(c, testAccessPolicy)
+	policy, err := loadAccessPolicy(dirs.SnapAccessPolicyFile)
+	c.Assert(err, check.IsNil)
+
+	req := func(remoteAddr string) *http.Request {
+		return &http.Request{Method: "GET", RemoteAddr: remoteAddr}
+	}
+	boss := &auth.UserState{Email: "boss@example.com"}
+
+	c.Check(policy.roleFor(req("pid=100;uid=42;socket=;"), nil), check.Equals, roleOperator)
+	c.Check(policy.roleFor(req("pid=100;uid=43;socket=;"), nil), check.Equals, roleViewer)
+	c.Check(policy.roleFor(req("pid=100;uid=44;socket=;"), nil), check.Equals, roleNone)
+	// the highest role wins
+	c.Check(policy.roleFor(req("pid=100;uid=43;socket=;"), boss), check.Equals, roleAdmin)
+	c.Check(policy.roleFor(req(""), boss), check.Equals, roleAdmin)
+	// root and snaps are never given a role
+	c.Check(policy.roleFor(req("pid=100;uid=0;socket=;"), boss), check.Equals, roleNone)
+	c.Check(policy.roleFor(req("pid=100;uid=42;socket="+dirs.SnapSocket+";"), nil), check.Equals, roleNone)
+}
+
+func (s *daemonSuite) TestCanAccessWithPolicy(c *check.C) {
+	restore := mockUserGroupNames(testUserGroupNames)
+	defer restore()
+	writeAccessPolicy(c, testAccessPolicy)
+	d := newTestDaemon(c)
+	d.accessPolicy = loadSystemAccessPolicy(nil)
+
+	req := func(method, remoteAddr string) *http.Request {
+		return &http.Request{Method: method, RemoteAddr: remoteAddr}
+	}
+	const viewer = "pid=100;uid=43;socket=;"
+	const operator = "pid=100;uid=42;socket=;"
+	const other = "pid=100;uid=44;socket=;"
+
+	cmd := &Command{d: d, UserOK: true}
+	c.Check(cmd.canAccess(req("GET", viewer), nil), check.Equals, accessOK)
+	c.Check(cmd.canAccess(req("POST", viewer), nil), check.Equals, accessDenied)
+
+	// routes no user can GET from are for admins only
+	cmd = &Command{d: d}
+	c.Check(cmd.canAccess(req("GET", viewer), nil), check.Equals, accessDenied)
+	c.Check(cmd.canAccess(req("GET", operator), nil), check.Equals, accessDenied)
+	c.Check(cmd.canAccess(req("GET", other), &auth.UserState{Email: "boss@example.com"}), check.Equals, accessOK)
+	c.Check(cmd.canAccess(req("POST", viewer), nil), check.Equals, accessDenied)
+	c.Check(cmd.canAccess(req("POST", operator), nil), check.Equals, accessDenied)
+	c.Check(cmd.canAccess(req("POST", other), &auth.UserState{Email: "boss@example.com"}), check.Equals, accessOK)
+	// users without a role are checked as usual, and being logged in
+	// is still enough
+	c.Check(cmd.canAccess(req("GET", other), nil), check.Equals, accessUnauthorized)
+	c.Check(cmd.canAccess(req("POST", other), nil), check.Equals, accessUnauthorized)
+	c.Check(cmd.canAccess(req("POST", other), &auth.UserState{Email: "nobody@example.com"}), check.Equals, accessOK)
+	c.Check(cmd.canAccess(req("POST", "pid=100;uid=0;socket=;"), nil), check.Equals, accessOK)
+
+	cmd = &Command{d: d, OperatorOK: true}
+	c.Check(cmd.canAccess(req("POST", viewer), nil), check.Equals, accessDenied)
+	c.Check(cmd.canAccess(req("POST", operator), nil), check.Equals, accessOK)
+
+	// the routes viewers were never given
+	for _, routeCmd := range []*Command{snapshotExportCmd, snapshotFilesCmd, snapConfCmd, logsCmd, usersCmd} {
+		cmd := *routeCmd
+		cmd.d = d
+		c.Check(cmd.canAccess(req("GET", viewer), nil), check.Equals, accessDenied, check.Commentf(cmd.Path))
+		c.Check(cmd.canAccess(req("GET", operator), nil), check.Equals, accessDenied, check.Commentf(cmd.Path))
+	}
+}
+
+func (s *daemonSuite) TestCanAccessWithBrokenPolicy(c *check.C) {
+	restore := mockUserGroupNames(testUserGroupNames)
+	defer restore()
+	writeAccessPolicy(c, "groups: {users: root}")
+	d := newTestDaemon(c)
+	st := d.overlord.State()
+	d.accessPolicy = loadSystemAccessPolicy(st)
+	c.Assert(d.accessPolicy, check.IsNil)
+
+	// it is as if there was no policy
+	req := func(method, remoteAddr string) *http.Request {
+		return &http.Request{Method: method, RemoteAddr: remoteAddr}
+	}
+	cmd := &Command{d: d, UserOK: true}
+	c.Check(cmd.canAccess(req("GET", "pid=100;uid=43;socket=;"), nil), check.Equals, accessOK)
+	c.Check(cmd.canAccess(req("POST", "pid=100;uid=43;socket=;"), nil), check.Equals, accessUnauthorized)
+	c.Check(cmd.canAccess(req("POST", "pid=100;uid=43;socket=;"), &auth.UserState{Email: "boss@example.com"}), check.Equals, accessOK)
+
+	// and the problem is reported
+	st.Lock()
+	defer st.Unlock()
+	warnings := st.AllWarnings()
+	c.Assert(warnings, check.HasLen, 1)
+	c.Check(warnings[0].String(), check.Matches, `cannot use access policy .*, ignoring it: cannot use access policy: group "users": unknown role "root"`)
+}
+
+func (s *daemonSuite) TestServeHTTPAccessDenied(c *check.C) {
+	restore := mockUserGroupNames(testUserGroupNames)
+	defer restore()
+	writeAccessPolicy(c, testAccessPolicy)
+	d := newTestDaemon(c)
+	d.accessPolicy = loadSystemAccessPolicy(nil)
+
+	cmd := &Command{d: d, OperatorOK: true, POST: func(*Command, *http.Request, *auth.UserState) Response {
+		c.Fatalf("should not be reached")
+		return nil
+	}}
+	req := &http.Request{Method: "POST", RemoteAddr: "pid=100;uid=43;socket=;", Header: http.Header{}}
+	rec := httptest.NewRecorder()
+	cmd.ServeHTTP(rec, req)
+	c.Check(rec.Code, check.Equals, 403)
+	c.Check(rec.Body.String(), check.Matches, `.*"kind":"access-denied".*`)
+	c.Check(rec.Body.String(), check.Matches, `.*"value":{"required":"operator","role":"viewer"}.*`)
+}
+
+func (s *apiSuite) TestPostSnapActionAccessDenied(c *check.C) {
+	d := s.daemonWithOverlordMock(c)
+	d.accessPolicy = &accessPolicy{groups: map[string]accessRole{"ops": roleOperator}}
+	restore := mockUserGroupNames(func(uint32) ([]string, error) { return []string{"ops"}, nil })
+	defer restore()
+	s.vars = map[string]string{"name": "foo"}
+
+	buf := bytes.NewBufferString(`{"action": "remove"}`)
+	req, err := http.NewRequest("POST", "/v2/snaps/foo", buf)
+	c.Assert(err, check.IsNil)
+	req.RemoteAddr = "pid=100;uid=42;socket=;"
+
+	rsp := postSnap(snapCmd, req, nil).(*resp)
+	c.Check(rsp.Status, check.Equals, 403)
+	c.Check(rsp.Result, check.DeepEquals, &errorResult{
+		Message: "cannot remove snaps: access denied by the access policy",
+		Kind:    errorKindAccessDenied,
+		Value:   map[string]string{"role": "operator", "required": "admin"},
+	})
+
+	buf = bytes.NewBufferString(`{"action": "remove", "snaps": ["foo"]}`)
+	req, err = http.NewRequest("POST", "/v2/snaps", buf)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = "pid=100;uid=42;socket=;"
+
+	rsp = postSnaps(snapsCmd, req, nil).(*resp)
+	c.Check(rsp.Status, check.Equals, 403)
+	c.Check(rsp.Result.(*errorResult).Kind, check.Equals, errorKindAccessDenied)
+}
+
+func (s *apiSuite) TestPostSnapsMultipartAccessDenied(c *check.C) {
+	d := s.daemonWithOverlordMock(c)
+	d.accessPolicy = &accessPolicy{groups: map[string]accessRole{"ops": roleOperator}}
+	restore := mockUserGroupNames(func(uint32) ([]string, error) { return []string{"ops"}, nil })
+	defer restore()
+
+	for _, body := range []string{
+		// sideload
+		"--hello\r\n" +
+			"Content-Disposition: form-data; name=\"snap\"; filename=\"x\"\r\n" +
+			"\r\n" +
+			"xyzzy\r\n" +
+			"--hello\r\n" +
+			"Content-Disposition: form-data; name=\"dangerous\"\r\n" +
+			"\r\n" +
+			"true\r\n" +
+			"--hello--\r\n",
+		// try
+		"--hello\r\n" +
+			"Content-Disposition: form-data; name=\"action\"\r\n" +
+			"\r\n" +
+			"try\r\n" +
+			"--hello\r\n" +
+			"Content-Disposition: form-data; name=\"snap-path\"\r\n" +
+			"\r\n" +
+			c.MkDir() + "\r\n" +
+			"--hello\r\n" +
+			"Content-Disposition: form-data; name=\"devmode\"\r\n" +
+			"\r\n" +
+			"true\r\n" +
+			"--hello--\r\n",
+	} {
+		req, err := http.NewRequest("POST", "/v2/snaps", bytes.NewBufferString(body))
+		c.Assert(err, check.IsNil)
+		req.Header.Set("Content-Type", "multipart/thing; boundary=hello")
+		req.RemoteAddr = "pid=100;uid=42;socket=;"
+
+		rsp := postSnaps(snapsCmd, req, nil).(*resp)
+		c.Check(rsp.Status, check.Equals, 403)
+		c.Check(rsp.Result, check.DeepEquals, &errorResult{
+			Message: "cannot install snaps: access denied by the access policy",
+			Kind:    errorKindAccessDenied,
+			Value:   map[string]string{"role": "operator", "required": "admin"},
+		})
+	}
+}
+
+func (s *apiSuite) TestPostSnapRefreshFlagsAccessDenied(c *check.C) {
+	d := s.daemonWithOverlordMock(c)
+	d.accessPolicy = &accessPolicy{groups: map[string]accessRole{"ops": roleOperator}}
+	restore := mockUserGroupNames(func(uint32) ([]string, error) { return []string{"ops"}, nil })
+	defer restore()
+	s.vars = map[string]string{"name": "foo"}
+
+	for _, opt := range []string{"devmode", "jailmode", "classic", "ignore-validation"} {
+		buf := bytes.NewBufferString(fmt.Sprintf(`{"action": "refresh", %q: true}`, opt))
+		req, err := http.NewRequest("POST", "/v2/snaps/foo", buf)
+		c.Assert(err, check.IsNil)
+		req.RemoteAddr = "pid=100;uid=42;socket=;"
+
+		rsp := postSnap(snapCmd, req, nil).(*resp)
+		c.Check(rsp.Status, check.Equals, 403, check.Commentf(opt))
+		c.Check(rsp.Result, check.DeepEquals, &errorResult{
+			Message: "cannot refresh snaps with devmode, jailmode, classic or ignore-validation: access denied by the access policy",
+			Kind:    errorKindAccessDenied,
+			Value:   map[string]string{"role": "operator", "required": "admin"},
+		}, check.Commentf(opt))
+	}
+
+	// an admin can
+	d.accessPolicy = &accessPolicy{groups: map[string]accessRole{"ops": roleAdmin}}
+	req := &http.Request{Method: "POST", RemoteAddr: "pid=100;uid=42;socket=;"}
+	c.Check(checkSnapInstructionRole(snapCmd, req, nil, &snapInstruction{Action: "refresh", Classic: true}), check.IsNil)
+}
+
+func (s *apiSuite) TestCheckSnapActionRole(c *check.C) {
+	d := s.daemonWithOverlordMock(c)
+	restore := mockUserGroupNames(func(uint32) ([]string, error) { return []string{"ops"}, nil })
+	defer restore()
+	req := &http.Request{Method: "POST", RemoteAddr: "pid=100;uid=42;socket=;"}
+
+	// no policy, no checks
+	c.Check(checkSnapActionRole(snapCmd, req, nil, "install"), check.IsNil)
+
+	d.accessPolicy = &accessPolicy{groups: map[string]accessRole{"ops": roleOperator}}
+	c.Check(checkSnapActionRole(snapCmd, req, nil, "refresh"), check.IsNil)
+	c.Check(checkSnapActionRole(snapCmd, req, nil, "install"), check.NotNil)
+
+	d.accessPolicy = &accessPolicy{groups: map[string]accessRole{"ops": roleAdmin}}
+	c.Check(checkSnapActionRole(snapCmd, req, nil, "install"), check.IsNil)
+}
+
+func mockUserGroupNames(f func(uint32) ([]string, error)) (restore func()) {
+	old := userGroupNames
+	userGroupNames = f
+	return func() { userGroupNames = old }
+}
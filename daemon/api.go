@@ -55,6 +55,7 @@ import (
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/overlord/assertstate"
 	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/changejournal"
 	"github.com/snapcore/snapd/overlord/configstate"
 	"github.com/snapcore/snapd/overlord/configstate/config"
 	"github.com/snapcore/snapd/overlord/devicestate"
@@ -62,6 +63,7 @@ import (
 	"github.com/snapcore/snapd/overlord/ifacestate"
 	"github.com/snapcore/snapd/overlord/servicestate"
 	"github.com/snapcore/snapd/overlord/snapshotstate"
+	"github.com/snapcore/snapd/overlord/snapshotstate/backend"
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/progress"
@@ -70,6 +72,7 @@ import (
 	"github.com/snapcore/snapd/store"
 	"github.com/snapcore/snapd/strutil"
 	"github.com/snapcore/snapd/systemd"
+	"github.com/snapcore/snapd/timeutil"
 )
 
 var api = []*Command{
@@ -84,6 +87,7 @@ var api = []*Command{
 	snapFileCmd,
 	snapConfCmd,
 	interfacesCmd,
+	interfacesExplainCmd,
 	assertsCmd,
 	assertsFindManyCmd,
 	stateChangeCmd,
@@ -100,8 +104,15 @@ var api = []*Command{
 	warningsCmd,
 	debugCmd,
 	snapshotCmd,
+	snapshotExportCmd,
+	snapshotFilesCmd,
 	connectionsCmd,
 	modelCmd,
+	eventsCmd,
+	auditCmd,
+	denialsCmd,
+	snapProfilesCmd,
+	metricsCmd,
 }
 
 var (
@@ -142,26 +153,29 @@ var (
 	}
 
 	snapsCmd = &Command{
-		Path:     "/v2/snaps",
-		UserOK:   true,
-		PolkitOK: "io.snapcraft.snapd.manage",
-		GET:      getSnapsInfo,
-		POST:     postSnaps,
+		Path:       "/v2/snaps",
+		UserOK:     true,
+		PolkitOK:   "io.snapcraft.snapd.manage",
+		OperatorOK: true,
+		GET:        getSnapsInfo,
+		POST:       postSnaps,
 	}
 
 	snapCmd = &Command{
-		Path:     "/v2/snaps/{name}",
-		UserOK:   true,
-		PolkitOK: "io.snapcraft.snapd.manage",
-		GET:      getSnapInfo,
-		POST:     postSnap,
+		Path:       "/v2/snaps/{name}",
+		UserOK:     true,
+		PolkitOK:   "io.snapcraft.snapd.manage",
+		OperatorOK: true,
+		GET:        getSnapInfo,
+		POST:       postSnap,
 	}
 
 	appsCmd = &Command{
-		Path:   "/v2/apps",
-		UserOK: true,
-		GET:    getAppsInfo,
-		POST:   postApps,
+		Path:       "/v2/apps",
+		UserOK:     true,
+		OperatorOK: true,
+		GET:        getAppsInfo,
+		POST:       postApps,
 	}
 
 	logsCmd = &Command{
@@ -189,7 +203,7 @@ var (
 		UserOK:   true,
 		PolkitOK: "io.snapcraft.snapd.manage",
 		GET:      getChange,
-		POST:     abortChange,
+		POST:     postChange,
 	}
 
 	stateChangesCmd = &Command{
@@ -893,15 +907,31 @@ type snapInstruction struct {
 	Classic          bool          `json:"classic"`
 	IgnoreValidation bool          `json:"ignore-validation"`
 	Unaliased        bool          `json:"unaliased"`
+	Purge            bool          `json:"purge"`
 	// dropping support temporarely until flag confusion is sorted,
 	// this isn't supported by client atm anyway
 	LeaveOld bool         `json:"temp-dropped-leave-old"`
 	License  *licenseData `json:"license"`
 	Snaps    []string     `json:"snaps"`
 	Users    []string     `json:"users"`
+	// HoldUntil is only used by the hold action, the zero time
+	// means holding indefinitely
+	HoldUntil time.Time `json:"hold-until"`
+	// Compression, BaseSetID and EncryptionKey are only used by the
+	// snapshot action
+	Compression   string `json:"compression"`
+	BaseSetID     uint64 `json:"base-set-id"`
+	EncryptionKey string `json:"encryption-key"`
+	// Schedule, if set, delays the change until the next window of
+	// the given schedule, in timeutil.ParseSchedule syntax
+	Schedule string `json:"schedule"`
+	// DryRun asks for a description of what would be done, instead
+	// of doing it
+	DryRun bool `json:"dry-run"`
 
 	// The fields below should not be unmarshalled into. Do not export them.
-	userID int
+	userID        int
+	encryptionKey []byte
 }
 
 func (inst *snapInstruction) modeFlags() (snapstate.Flags, error) {
@@ -934,17 +964,27 @@ var (
 	snapstateUpdate            = snapstate.Update
 	snapstateUpdateMany        = snapstate.UpdateMany
 	snapstateInstallMany       = snapstate.InstallMany
+	snapstateRemove            = snapstate.Remove
 	snapstateRemoveMany        = snapstate.RemoveMany
 	snapstateRevert            = snapstate.Revert
 	snapstateRevertToRevision  = snapstate.RevertToRevision
-
-	snapshotList    = snapshotstate.List
-	snapshotCheck   = snapshotstate.Check
-	snapshotForget  = snapshotstate.Forget
-	snapshotRestore = snapshotstate.Restore
-	snapshotSave    = snapshotstate.Save
+	snapstateRollback          = snapstate.Rollback
+	snapstateHoldRefreshes     = snapstate.HoldRefreshes
+	snapstateUnholdRefreshes   = snapstate.UnholdRefreshes
+
+	snapshotList         = snapshotstate.List
+	snapshotCheck        = snapshotstate.Check
+	snapshotForget       = snapshotstate.Forget
+	snapshotRestore      = snapshotstate.Restore
+	snapshotRestoreFiles = snapshotstate.RestoreFiles
+	snapshotFiles        = snapshotstate.Files
+	snapshotSave         = snapshotstate.Save
+	snapshotExport       = snapshotstate.Export
+	snapshotImport       = snapshotstate.Import
 
 	assertstateRefreshSnapDeclarations = assertstate.RefreshSnapDeclarations
+
+	changejournalRead = changejournal.Read
 )
 
 func ensureStateSoonImpl(st *state.State) {
@@ -1138,8 +1178,60 @@ func snapRemoveMany(inst *snapInstruction, st *state.State) (*snapInstructionRes
 	}, nil
 }
 
+func snapHoldMany(inst *snapInstruction, st *state.State) (*snapInstructionResult, error) {
+	if len(inst.Snaps) == 0 {
+		return nil, fmt.Errorf("cannot hold refreshes of zero snaps")
+	}
+	if err := snapstateHoldRefreshes(st, inst.Snaps, inst.HoldUntil); err != nil {
+		return nil, err
+	}
+
+	var msg string
+	until := inst.HoldUntil.Format(time.RFC3339)
+	switch {
+	case len(inst.Snaps) == 1 && inst.HoldUntil.IsZero():
+		msg = fmt.Sprintf(i18n.G("Hold auto-refreshes of snap %q"), inst.Snaps[0])
+	case len(inst.Snaps) == 1:
+		msg = fmt.Sprintf(i18n.G("Hold auto-refreshes of snap %q until %s"), inst.Snaps[0], until)
+	case inst.HoldUntil.IsZero():
+		// TRANSLATORS: the %s is a comma-separated list of quoted snap names
+		msg = fmt.Sprintf(i18n.G("Hold auto-refreshes of snaps %s"), strutil.Quoted(inst.Snaps))
+	default:
+		// TRANSLATORS: the first %s is a comma-separated list of quoted snap names, the second one a time
+		msg = fmt.Sprintf(i18n.G("Hold auto-refreshes of snaps %s until %s"), strutil.Quoted(inst.Snaps), until)
+	}
+
+	return &snapInstructionResult{
+		Summary:  msg,
+		Affected: inst.Snaps,
+	}, nil
+}
+
+func snapUnholdMany(inst *snapInstruction, st *state.State) (*snapInstructionResult, error) {
+	if len(inst.Snaps) == 0 {
+		return nil, fmt.Errorf("cannot unhold refreshes of zero snaps")
+	}
+	if err := snapstateUnholdRefreshes(st, inst.Snaps); err != nil {
+		return nil, err
+	}
+
+	var msg string
+	if len(inst.Snaps) == 1 {
+		msg = fmt.Sprintf(i18n.G("Remove auto-refresh hold of snap %q"), inst.Snaps[0])
+	} else {
+		// TRANSLATORS: the %s is a comma-separated list of quoted snap names
+		msg = fmt.Sprintf(i18n.G("Remove auto-refresh holds of snaps %s"), strutil.Quoted(inst.Snaps))
+	}
+
+	return &snapInstructionResult{
+		Summary:  msg,
+		Affected: inst.Snaps,
+	}, nil
+}
+
 func snapRemove(inst *snapInstruction, st *state.State) (string, []*state.TaskSet, error) {
-	ts, err := snapstate.Remove(st, inst.Snaps[0], inst.Revision)
+	flags := &snapstate.RemoveFlags{Purge: inst.Purge}
+	ts, err := snapstateRemove(st, inst.Snaps[0], inst.Revision, flags)
 	if err != nil {
 		return "", nil, err
 	}
@@ -1209,7 +1301,12 @@ func snapSwitch(inst *snapInstruction, st *state.State) (string, []*state.TaskSe
 }
 
 func snapshotMany(inst *snapInstruction, st *state.State) (*snapInstructionResult, error) {
-	setID, snapshotted, ts, err := snapshotSave(st, inst.Snaps, inst.Users)
+	flags := &snapshotstate.SaveFlags{
+		Compression:   inst.Compression,
+		BaseSetID:     inst.BaseSetID,
+		EncryptionKey: inst.encryptionKey,
+	}
+	setID, snapshotted, ts, err := snapshotSave(st, inst.Snaps, inst.Users, flags)
 	if err != nil {
 		return nil, err
 	}
@@ -1289,18 +1386,104 @@ func postSnap(c *Command, r *http.Request, user *auth.UserState) Response {
 		return BadRequest("unknown action %s", inst.Action)
 	}
 
+	if rsp := checkSnapInstructionRole(c, r, user, &inst); rsp != nil {
+		return rsp
+	}
+	if inst.DryRun && !dryRunActions[inst.Action] {
+		return BadRequest("cannot dry-run %s", inst.Action)
+	}
+	startTime, rsp := inst.startTime()
+	if rsp != nil {
+		return rsp
+	}
+
 	msg, tsets, err := impl(&inst, state)
 	if err != nil {
 		return inst.errToResponse(err)
 	}
 
+	if inst.DryRun {
+		return SyncResponse(planSnapOp(state, msg, inst.Snaps, tsets), nil)
+	}
+
 	chg := newChange(state, inst.Action+"-snap", msg, tsets, inst.Snaps)
+	scheduleChange(chg, startTime)
 
 	ensureStateSoon(state)
 
 	return AsyncResponse(nil, &Meta{Change: chg.ID()})
 }
 
+// schedulableActions are the snap actions that can be scheduled.
+var schedulableActions = map[string]bool{
+	"install": true,
+	"refresh": true,
+	"revert":  true,
+	"remove":  true,
+}
+
+// startTime returns when the change for the instruction should start,
+// or the zero time if straight away.
+func (inst *snapInstruction) startTime() (time.Time, Response) {
+	if inst.Schedule == "" {
+		return time.Time{}, nil
+	}
+	if !schedulableActions[inst.Action] {
+		return time.Time{}, BadRequest("cannot schedule %s", inst.Action)
+	}
+	t, err := changeStartTime(inst.Schedule)
+	if err != nil {
+		return time.Time{}, BadRequest("%v", err)
+	}
+	return t, nil
+}
+
+// maxScheduleDelay is how far ahead a change can be scheduled to start:
+// the overlord aborts the changes that are not ready a week after they
+// were made, so a scheduled change needs to start early enough to
+// still have time to run.
+var maxScheduleDelay = 6 * 24 * time.Hour
+
+// changeStartTime returns when a change should start according to the
+// given schedule: at the start of its next window, or the zero time if
+// a window is open right now. The windows only decide when the change
+// starts: if snapd is not running when the window opens, the change
+// starts as soon as snapd is back, even if the window closed by then.
+func changeStartTime(schedule string) (time.Time, error) {
+	sched, err := timeutil.ParseSchedule(schedule)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("cannot parse schedule %q: %v", schedule, err)
+	}
+	now := time.Now()
+	var start time.Time
+	for _, s := range sched {
+		if s.Includes(now) {
+			return time.Time{}, nil
+		}
+		if window := s.Next(now); start.IsZero() || window.Start.Before(start) {
+			start = window.Start
+		}
+	}
+	if latest := now.Add(maxScheduleDelay); start.After(latest) {
+		return time.Time{}, fmt.Errorf("cannot schedule %q: its next window opens at %s, after the latest possible start at %s", schedule, start.Format(time.RFC3339), latest.Format(time.RFC3339))
+	}
+	return start, nil
+}
+
+// scheduleChange holds back the change until the given time, if not
+// zero, by holding the tasks that do not wait for any other.
+func scheduleChange(chg *state.Change, when time.Time) {
+	if when.IsZero() {
+		return
+	}
+	for _, t := range chg.Tasks() {
+		if len(t.WaitTasks()) == 0 {
+			t.At(when)
+		}
+	}
+	chg.Set("scheduled-time", when)
+}
+
 func newChange(st *state.State, kind, summary string, tsets []*state.TaskSet, snapNames []string) *state.Change {
 	chg := st.NewChange(kind, summary)
 	for _, ts := range tsets {
@@ -1381,9 +1564,29 @@ func snapsOp(c *Command, r *http.Request, user *auth.UserState) Response {
 		return BadRequest("cannot decode request body into snap instruction: %v", err)
 	}
 
-	if inst.Channel != "" || !inst.Revision.Unset() || inst.DevMode || inst.JailMode {
+	if rsp := checkSnapInstructionRole(c, r, user, &inst); rsp != nil {
+		return rsp
+	}
+	if inst.Channel != "" || !inst.Revision.Unset() || inst.DevMode || inst.JailMode || inst.Purge {
+		return BadRequest("unsupported option provided for multi-snap operation")
+	}
+	if inst.Action != "snapshot" && (inst.Compression != "" || inst.BaseSetID != 0 || inst.EncryptionKey != "") {
 		return BadRequest("unsupported option provided for multi-snap operation")
 	}
+	if inst.DryRun && !dryRunActions[inst.Action] {
+		return BadRequest("cannot dry-run %s", inst.Action)
+	}
+	startTime, rsp := inst.startTime()
+	if rsp != nil {
+		return rsp
+	}
+	if inst.EncryptionKey != "" {
+		key, err := backend.ParseKey(inst.EncryptionKey)
+		if err != nil {
+			return BadRequest("%v", err)
+		}
+		inst.encryptionKey = key
+	}
 
 	st := c.d.overlord.State()
 	st.Lock()
@@ -1404,6 +1607,10 @@ func snapsOp(c *Command, r *http.Request, user *auth.UserState) Response {
 		op = snapRemoveMany
 	case "snapshot":
 		op = snapshotMany
+	case "hold":
+		op = snapHoldMany
+	case "unhold":
+		op = snapUnholdMany
 	default:
 		return BadRequest("unsupported multi-snap operation %q", inst.Action)
 	}
@@ -1412,12 +1619,17 @@ func snapsOp(c *Command, r *http.Request, user *auth.UserState) Response {
 		return inst.errToResponse(err)
 	}
 
+	if inst.DryRun {
+		return SyncResponse(planSnapOp(st, res.Summary, res.Affected, res.Tasksets), nil)
+	}
+
 	var chg *state.Change
 	if len(res.Tasksets) == 0 {
 		chg = st.NewChange(inst.Action+"-snap", res.Summary)
 		chg.SetStatus(state.DoneStatus)
 	} else {
 		chg = newChange(st, inst.Action+"-snap", res.Summary, res.Tasksets, res.Affected)
+		scheduleChange(chg, startTime)
 		ensureStateSoon(st)
 	}
 
@@ -1437,6 +1649,13 @@ func postSnaps(c *Command, r *http.Request, user *auth.UserState) Response {
 		return BadRequest("unknown content type: %s", contentType)
 	}
 
+	// sideloading and trying snaps install them just the same, and
+	// with whatever confinement the form asks for, so check this
+	// before reading a possibly big form
+	if rsp := checkSnapActionRole(c, r, user, "install"); rsp != nil {
+		return rsp
+	}
+
 	route := c.d.router.Get(stateChangeCmd.Path)
 	if route == nil {
 		return InternalError("cannot find route for change")
@@ -1836,6 +2055,14 @@ func changeInterfaces(c *Command, r *http.Request, user *auth.UserState) Respons
 	if len(a.Plugs) == 0 || len(a.Slots) == 0 {
 		return BadRequest("at least one plug and slot is required")
 	}
+	var startTime time.Time
+	if a.Schedule != "" {
+		var err error
+		startTime, err = changeStartTime(a.Schedule)
+		if err != nil {
+			return BadRequest("%v", err)
+		}
+	}
 
 	var summary string
 	var err error
@@ -1902,6 +2129,7 @@ func changeInterfaces(c *Command, r *http.Request, user *auth.UserState) Respons
 	}
 
 	change := newChange(st, a.Action+"-snap", summary, tasksets, affected)
+	scheduleChange(change, startTime)
 	st.EnsureBefore(0)
 
 	return AsyncResponse(nil, &Meta{Change: change.ID()})
@@ -1915,9 +2143,11 @@ type changeInfo struct {
 	Tasks   []*taskInfo `json:"tasks,omitempty"`
 	Ready   bool        `json:"ready"`
 	Err     string      `json:"err,omitempty"`
+	Paused  bool        `json:"paused,omitempty"`
 
-	SpawnTime time.Time  `json:"spawn-time,omitempty"`
-	ReadyTime *time.Time `json:"ready-time,omitempty"`
+	SpawnTime     time.Time  `json:"spawn-time,omitempty"`
+	ReadyTime     *time.Time `json:"ready-time,omitempty"`
+	ScheduledTime *time.Time `json:"scheduled-time,omitempty"`
 
 	Data map[string]*json.RawMessage `json:"data,omitempty"`
 }
@@ -1929,6 +2159,7 @@ type taskInfo struct {
 	Status   string           `json:"status"`
 	Log      []string         `json:"log,omitempty"`
 	Progress taskInfoProgress `json:"progress"`
+	Retries  int              `json:"retries,omitempty"`
 
 	SpawnTime time.Time  `json:"spawn-time,omitempty"`
 	ReadyTime *time.Time `json:"ready-time,omitempty"`
@@ -1948,6 +2179,7 @@ func change2changeInfo(chg *state.Change) *changeInfo {
 		Summary: chg.Summary(),
 		Status:  status.String(),
 		Ready:   status.Ready(),
+		Paused:  !status.Ready() && chg.IsPaused(),
 
 		SpawnTime: chg.SpawnTime(),
 	}
@@ -1955,6 +2187,10 @@ func change2changeInfo(chg *state.Change) *changeInfo {
 	if !readyTime.IsZero() {
 		chgInfo.ReadyTime = &readyTime
 	}
+	var scheduledTime time.Time
+	if err := chg.Get("scheduled-time", &scheduledTime); err == nil {
+		chgInfo.ScheduledTime = &scheduledTime
+	}
 	if err := chg.Err(); err != nil {
 		chgInfo.Err = err.Error()
 	}
@@ -1975,6 +2211,7 @@ func change2changeInfo(chg *state.Change) *changeInfo {
 				Done:  done,
 				Total: total,
 			},
+			Retries:   t.DoingRetries() + t.UndoingRetries(),
 			SpawnTime: t.SpawnTime(),
 		}
 		readyTime := t.ReadyTime()
@@ -2020,8 +2257,10 @@ func getChanges(c *Command, r *http.Request, user *auth.UserState) Response {
 		filter = func(chg *state.Change) bool { return !chg.Status().Ready() }
 	case "ready":
 		filter = func(chg *state.Change) bool { return chg.Status().Ready() }
+	case "archived":
+		return getArchivedChanges(query)
 	default:
-		return BadRequest("select should be one of: all,in-progress,ready")
+		return BadRequest("select should be one of: all,in-progress,ready,archived")
 	}
 
 	if wantedName := query.Get("for"); wantedName != "" {
@@ -2061,7 +2300,30 @@ func getChanges(c *Command, r *http.Request, user *auth.UserState) Response {
 	return SyncResponse(chgInfos, nil)
 }
 
-func abortChange(c *Command, r *http.Request, user *auth.UserState) Response {
+func getArchivedChanges(query url.Values) Response {
+	filter := &changejournal.Filter{
+		Kind: query.Get("kind"),
+		Snap: query.Get("for"),
+	}
+	if since := query.Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			return BadRequest("cannot parse since: %v", err)
+		}
+		filter.Since = t
+	}
+
+	entries, err := changejournalRead(filter)
+	if err != nil {
+		return InternalError("cannot read change journal: %v", err)
+	}
+	if entries == nil {
+		entries = []*changejournal.Entry{}
+	}
+	return SyncResponse(entries, nil)
+}
+
+func postChange(c *Command, r *http.Request, user *auth.UserState) Response {
 	chID := muxVars(r)["id"]
 	state := c.d.overlord.State()
 	state.Lock()
@@ -2080,18 +2342,35 @@ func abortChange(c *Command, r *http.Request, user *auth.UserState) Response {
 		return BadRequest("cannot decode data from request body: %v", err)
 	}
 
-	if reqData.Action != "abort" {
+	switch reqData.Action {
+	case "rollback":
+		return rollbackChange(c, chg)
+	case "abort", "pause", "resume":
+	default:
 		return BadRequest("change action %q is unsupported", reqData.Action)
 	}
 
 	if chg.Status().Ready() {
-		return BadRequest("cannot abort change %s with nothing pending", chID)
+		return BadRequest("cannot %s change %s with nothing pending", reqData.Action, chID)
 	}
 
-	// flag the change
-	chg.Abort()
+	switch reqData.Action {
+	case "abort":
+		// flag the change
+		chg.Abort()
+	case "pause":
+		if chg.IsPaused() {
+			return BadRequest("change %s is already paused", chID)
+		}
+		chg.Pause()
+	case "resume":
+		if !chg.IsPaused() {
+			return BadRequest("change %s is not paused", chID)
+		}
+		chg.Resume()
+	}
 
-	// actually ask to proceed with the abort
+	// actually ask to proceed with the action
 	ensureStateSoon(state)
 
 	return SyncResponse(change2changeInfo(chg), nil)
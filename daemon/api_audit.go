@@ -0,0 +1,64 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/snapcore/snapd/overlord/auth"
+)
+
+var auditCmd = &Command{
+	Path:     "/v2/audit",
+	RootOnly: true,
+	GET:      getAudit,
+}
+
+func getAudit(c *Command, r *http.Request, user *auth.UserState) Response {
+	query := r.URL.Query()
+	filter := &auditFilter{User: query.Get("user")}
+	for _, param := range []struct {
+		name string
+		t    *time.Time
+	}{
+		{"since", &filter.Since},
+		{"until", &filter.Until},
+	} {
+		value := query.Get(param.name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return BadRequest("cannot parse %s: %v", param.name, err)
+		}
+		*param.t = t
+	}
+
+	entries, err := readAudit(filter)
+	if err != nil {
+		return InternalError("cannot read audit log: %v", err)
+	}
+	if entries == nil {
+		entries = []*auditEntry{}
+	}
+	return SyncResponse(entries, nil)
+}
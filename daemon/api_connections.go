@@ -146,13 +146,14 @@ func collectConnections(ifaceMgr *ifacestate.InterfaceManager, filter collectFil
 		slotID := slotRef.String()
 
 		cj := connectionJSON{
-			Slot:      slotRef,
-			Plug:      plugRef,
-			Manual:    cstate.Auto == false,
-			Gadget:    cstate.ByGadget,
-			Interface: cstate.Interface,
-			PlugAttrs: mergeAttrs(cstate.StaticPlugAttrs, cstate.DynamicPlugAttrs),
-			SlotAttrs: mergeAttrs(cstate.StaticSlotAttrs, cstate.DynamicSlotAttrs),
+			Slot:        slotRef,
+			Plug:        plugRef,
+			Manual:      cstate.Auto == false,
+			Gadget:      cstate.ByGadget,
+			LocalPolicy: cstate.ByLocalPolicy,
+			Interface:   cstate.Interface,
+			PlugAttrs:   mergeAttrs(cstate.StaticPlugAttrs, cstate.DynamicPlugAttrs),
+			SlotAttrs:   mergeAttrs(cstate.StaticSlotAttrs, cstate.DynamicSlotAttrs),
 		}
 		if cstate.Undesired {
 			// explicitly disconnected are always manual
@@ -0,0 +1,103 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"net/http"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/interfaces"
+	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/denialstate"
+	"github.com/snapcore/snapd/strutil"
+)
+
+var denialsCmd = &Command{
+	Path:     "/v2/denials",
+	RootOnly: true,
+	GET:      getDenials,
+}
+
+// denialSuggestions turns the interfaces suggested for a denial into
+// suggestions to connect the plugs the denied app or hook has for them.
+// Interfaces with a connected plug are left out, connecting them did
+// not help.
+func denialSuggestions(repo *interfaces.Repository, rec *denialstate.Record) []client.DenialSuggestion {
+	var suggestions []client.DenialSuggestion
+	plugs := repo.Plugs(rec.Snap)
+	for _, iface := range rec.Interfaces {
+		suggestion := client.DenialSuggestion{Interface: iface}
+		connected := false
+		for _, plug := range plugs {
+			if plug.Interface != iface {
+				continue
+			}
+			if (rec.App != "" && plug.Apps[rec.App] == nil) || (rec.Hook != "" && plug.Hooks[rec.Hook] == nil) {
+				continue
+			}
+			if conns, err := repo.Connected(rec.Snap, plug.Name); err == nil && len(conns) > 0 {
+				connected = true
+				break
+			}
+			suggestion.Plug = plug.Name
+		}
+		if !connected {
+			suggestions = append(suggestions, suggestion)
+		}
+	}
+	return suggestions
+}
+
+func getDenials(c *Command, r *http.Request, user *auth.UserState) Response {
+	snaps := strutil.CommaSeparatedList(r.URL.Query().Get("snaps"))
+
+	// the denials are collected by the denial manager, only report
+	// what it found so far
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+	records, err := denialstate.All(st, snaps)
+	if err != nil {
+		return InternalError("cannot get denials: %v", err)
+	}
+
+	repo := c.d.overlord.InterfaceManager().Repository()
+	result := make([]*client.Denial, len(records))
+	for i, rec := range records {
+		result[i] = &client.Denial{
+			Kind:        rec.Kind,
+			Snap:        rec.Snap,
+			App:         rec.App,
+			Hook:        rec.Hook,
+			Operation:   rec.Operation,
+			Path:        rec.Path,
+			Mask:        rec.Mask,
+			Capability:  rec.Capability,
+			Family:      rec.Family,
+			SockType:    rec.SockType,
+			Syscall:     rec.Syscall,
+			Count:       rec.Count,
+			FirstSeen:   rec.FirstSeen,
+			LastSeen:    rec.LastSeen,
+			Suggestions: denialSuggestions(repo, rec),
+		}
+	}
+	return SyncResponse(result, nil)
+}
@@ -0,0 +1,153 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/interfaces"
+	"github.com/snapcore/snapd/overlord/denialstate"
+	"github.com/snapcore/snapd/systemd"
+)
+
+const denialsSnapYaml = `
+name: cam
+version: 1
+apps:
+ app:
+  plugs: [camera]
+ other:
+  plugs: [other-camera]
+plugs:
+ other-camera:
+  interface: camera
+`
+
+func (s *apiSuite) mockDenialsJournal(c *check.C, msgs ...string) (restore func()) {
+	t0 := time.Date(2019, 3, 12, 10, 0, 0, 0, time.UTC)
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for i, msg := range msgs {
+		c.Assert(enc.Encode(map[string]string{
+			"__CURSOR":             fmt.Sprintf("c%d", i),
+			"__REALTIME_TIMESTAMP": strconv.FormatInt(t0.Add(time.Duration(i)*time.Minute).UnixNano()/1000, 10),
+			"MESSAGE":              msg,
+		}), check.IsNil)
+	}
+	return systemd.MockKernelJournalctl(func(afterCursor string, n int) (io.ReadCloser, error) {
+		if afterCursor != "" {
+			return ioutil.NopCloser(&bytes.Buffer{}), nil
+		}
+		return ioutil.NopCloser(bytes.NewReader(buf.Bytes())), nil
+	})
+}
+
+func (s *apiSuite) getDenials(c *check.C, query string) *resp {
+	req, err := http.NewRequest("GET", "/v2/denials"+query, nil)
+	c.Assert(err, check.IsNil)
+	return denialsCmd.GET(denialsCmd, req, nil).(*resp)
+}
+
+func (s *apiSuite) TestDenials(c *check.C) {
+	s.daemon(c)
+	s.mockSnap(c, denialsSnapYaml)
+	restore := s.mockDenialsJournal(c,
+		`apparmor="DENIED" operation="open" profile="snap.cam.app" name="/dev/video0" pid=1 comm="app" requested_mask="r" denied_mask="r" fsuid=0 ouid=0`,
+		`apparmor="DENIED" operation="open" profile="snap.cam.other" name="/dev/video0" pid=2 comm="other" requested_mask="r" denied_mask="r" fsuid=0 ouid=0`,
+		`apparmor="DENIED" operation="open" profile="snap.gone.app" name="/etc/shadow" pid=3 comm="app" requested_mask="r" denied_mask="r" fsuid=0 ouid=0`,
+		`apparmor="DENIED" operation="open" profile="snap.cam.app" name="/dev/video0" pid=1 comm="app" requested_mask="r" denied_mask="r" fsuid=0 ouid=0`,
+	)
+	defer restore()
+
+	s.mockSnap(c, "name: core\nversion: 1\ntype: os\nslots:\n camera:\n")
+
+	st := s.d.overlord.State()
+	c.Assert(denialstate.Collect(st), check.IsNil)
+
+	rsp := s.getDenials(c, "")
+	c.Assert(rsp.Type, check.Equals, ResponseTypeSync, check.Commentf("%v", rsp.Result))
+	denials := rsp.Result.([]*client.Denial)
+	c.Assert(denials, check.HasLen, 3)
+
+	t0 := time.Date(2019, 3, 12, 10, 0, 0, 0, time.UTC)
+	c.Check(denials[0], check.DeepEquals, &client.Denial{
+		Kind:        "apparmor",
+		Snap:        "cam",
+		App:         "other",
+		Operation:   "open",
+		Path:        "/dev/video0",
+		Mask:        "r",
+		Count:       1,
+		FirstSeen:   t0.Add(time.Minute),
+		LastSeen:    t0.Add(time.Minute),
+		Suggestions: []client.DenialSuggestion{{Interface: "camera", Plug: "other-camera"}},
+	})
+	c.Check(denials[1].Snap, check.Equals, "gone")
+	c.Check(denials[1].Suggestions, check.IsNil)
+	c.Check(denials[2], check.DeepEquals, &client.Denial{
+		Kind:        "apparmor",
+		Snap:        "cam",
+		App:         "app",
+		Operation:   "open",
+		Path:        "/dev/video0",
+		Mask:        "r",
+		Count:       2,
+		FirstSeen:   t0,
+		LastSeen:    t0.Add(3 * time.Minute),
+		Suggestions: []client.DenialSuggestion{{Interface: "camera", Plug: "camera"}},
+	})
+
+	// connecting the plug drops the suggestion
+	repo := s.d.overlord.InterfaceManager().Repository()
+	_, err := repo.Connect(&interfaces.ConnRef{
+		PlugRef: interfaces.PlugRef{Snap: "cam", Name: "camera"},
+		SlotRef: interfaces.SlotRef{Snap: "core", Name: "camera"},
+	}, nil, nil, nil, nil, nil)
+	c.Assert(err, check.IsNil)
+	rsp = s.getDenials(c, "?snaps=cam")
+	c.Assert(rsp.Type, check.Equals, ResponseTypeSync, check.Commentf("%v", rsp.Result))
+	denials = rsp.Result.([]*client.Denial)
+	c.Assert(denials, check.HasLen, 2)
+	c.Check(denials[0].Suggestions, check.HasLen, 1)
+	c.Check(denials[1].Suggestions, check.IsNil)
+}
+
+func (s *apiSuite) TestDenialsDoNotReadJournal(c *check.C) {
+	s.daemon(c)
+	restore := systemd.MockKernelJournalctl(func(afterCursor string, n int) (io.ReadCloser, error) {
+		c.Fatalf("unexpected journal read")
+		return nil, fmt.Errorf("no journalctl")
+	})
+	defer restore()
+
+	rsp := s.getDenials(c, "")
+	c.Assert(rsp.Type, check.Equals, ResponseTypeSync, check.Commentf("%v", rsp.Result))
+	c.Check(rsp.Result, check.HasLen, 0)
+}
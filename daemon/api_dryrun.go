@@ -0,0 +1,168 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+)
+
+// dryRunActions are the snap actions that support dry-run.
+var dryRunActions = map[string]bool{
+	"install": true,
+	"refresh": true,
+	"remove":  true,
+}
+
+// snapOpPlan describes what a snap operation would do.
+type snapOpPlan struct {
+	Summary  string   `json:"summary"`
+	Affected []string `json:"affected,omitempty"`
+	// Tasks are the tasks the change would have, in order.
+	Tasks []*planTask `json:"tasks"`
+	// Downloads are the snaps that would be fetched from the store.
+	Downloads    []*planDownload `json:"downloads,omitempty"`
+	DownloadSize int64           `json:"download-size"`
+	// Services are the services of installed snaps that would be
+	// stopped or started.
+	Services []string `json:"services,omitempty"`
+}
+
+type planTask struct {
+	// ID identifies the task within the plan only.
+	ID      string   `json:"id"`
+	Kind    string   `json:"kind"`
+	Summary string   `json:"summary"`
+	WaitFor []string `json:"wait-for,omitempty"`
+	Snap    string   `json:"snap,omitempty"`
+}
+
+type planDownload struct {
+	// Action is the store action, either "install" or "refresh".
+	Action   string        `json:"action"`
+	Snap     string        `json:"snap"`
+	SnapID   string        `json:"snap-id,omitempty"`
+	Revision snap.Revision `json:"revision"`
+	Channel  string        `json:"channel,omitempty"`
+	Size     int64         `json:"size,omitempty"`
+}
+
+// planSnapOp describes what the given task sets would do and discards
+// them, so that nothing is done after all. The state must be locked.
+func planSnapOp(st *state.State, summary string, affected []string, tsets []*state.TaskSet) *snapOpPlan {
+	plan := &snapOpPlan{
+		Summary:  summary,
+		Affected: affected,
+		Tasks:    []*planTask{},
+	}
+
+	var tasks []*state.Task
+	byID := make(map[string]*state.Task)
+	planIDs := make(map[string]string)
+	for _, ts := range tsets {
+		for _, t := range ts.Tasks() {
+			if _, ok := planIDs[t.ID()]; ok {
+				continue
+			}
+			tasks = append(tasks, t)
+			byID[t.ID()] = t
+			planIDs[t.ID()] = strconv.Itoa(len(tasks))
+		}
+	}
+
+	services := make(map[string]bool)
+	for _, t := range tasks {
+		pt := &planTask{
+			ID:      planIDs[t.ID()],
+			Kind:    t.Kind(),
+			Summary: t.Summary(),
+		}
+		for _, wt := range t.WaitTasks() {
+			if id, ok := planIDs[wt.ID()]; ok {
+				pt.WaitFor = append(pt.WaitFor, id)
+			}
+		}
+		plan.Tasks = append(plan.Tasks, pt)
+
+		snapsup := plannedSnapSetup(t, byID)
+		if snapsup == nil || snapsup.SideInfo == nil {
+			continue
+		}
+		pt.Snap = snapsup.InstanceName()
+
+		switch t.Kind() {
+		case "download-snap":
+			dl := planDownload{
+				Action:   "install",
+				Snap:     pt.Snap,
+				SnapID:   snapsup.SideInfo.SnapID,
+				Revision: snapsup.Revision(),
+				Channel:  snapsup.Channel,
+			}
+			if _, err := snapstate.CurrentInfo(st, pt.Snap); err == nil {
+				dl.Action = "refresh"
+			}
+			if snapsup.DownloadInfo != nil {
+				dl.Size = snapsup.DownloadInfo.Size
+			}
+			plan.Downloads = append(plan.Downloads, &dl)
+			plan.DownloadSize += dl.Size
+		case "stop-snap-services", "start-snap-services":
+			info, err := snapstate.CurrentInfo(st, pt.Snap)
+			if err != nil {
+				continue
+			}
+			for _, app := range info.Services() {
+				services[app.ServiceName()] = true
+			}
+		}
+	}
+	for svc := range services {
+		plan.Services = append(plan.Services, svc)
+	}
+	sort.Strings(plan.Services)
+
+	for _, t := range tasks {
+		t.Discard()
+	}
+
+	return plan
+}
+
+// plannedSnapSetup returns the snap setup of a task that is not part of
+// a change, which snapstate.TaskSnapSetup cannot look up, or nil.
+func plannedSnapSetup(t *state.Task, byID map[string]*state.Task) *snapstate.SnapSetup {
+	var snapsup snapstate.SnapSetup
+	if err := t.Get("snap-setup", &snapsup); err == nil {
+		return &snapsup
+	}
+	var id string
+	if err := t.Get("snap-setup-task", &id); err != nil {
+		return nil
+	}
+	if setupTask := byID[id]; setupTask != nil && setupTask.Get("snap-setup", &snapsup) == nil {
+		return &snapsup
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/testutil"
+)
+
+const serviceSnapYaml = `name: svc-snap
+version: 1
+apps:
+ svc:
+  daemon: simple
+ cmd:
+`
+
+func fakeRefreshTasks(st *state.State, name string, rev snap.Revision, size int64) *state.TaskSet {
+	snapsup := &snapstate.SnapSetup{
+		Channel:      "stable",
+		SideInfo:     &snap.SideInfo{RealName: name, SnapID: name + "-id", Revision: rev},
+		DownloadInfo: &snap.DownloadInfo{Size: size},
+	}
+	download := st.NewTask("download-snap", "Download "+name)
+	download.Set("snap-setup", snapsup)
+	stop := st.NewTask("stop-snap-services", "Stop "+name+" services")
+	stop.Set("snap-setup-task", download.ID())
+	stop.WaitFor(download)
+	link := st.NewTask("link-snap", "Make "+name+" available")
+	link.Set("snap-setup-task", download.ID())
+	link.WaitFor(stop)
+	return state.NewTaskSet(download, stop, link)
+}
+
+func (s *apiSuite) TestPostSnapsDryRun(c *check.C) {
+	d := s.daemon(c)
+	s.mockSnap(c, serviceSnapYaml)
+
+	assertstateRefreshSnapDeclarations = func(*state.State, int) error { return nil }
+	snapstateUpdateMany = func(_ context.Context, st *state.State, names []string, userID int, flags *snapstate.Flags) ([]string, []*state.TaskSet, error) {
+		ts1 := fakeRefreshTasks(st, "svc-snap", snap.R(2), 1000)
+		ts2 := fakeRefreshTasks(st, "other-snap", snap.R(7), 500)
+		ts2.WaitAll(ts1)
+		return []string{"svc-snap", "other-snap"}, []*state.TaskSet{ts1, ts2}, nil
+	}
+
+	st := d.overlord.State()
+	st.Lock()
+	tasksBefore := st.TaskCount()
+	st.Unlock()
+
+	buf := bytes.NewBufferString(`{"action": "refresh", "dry-run": true}`)
+	req, err := http.NewRequest("POST", "/v2/snaps", buf)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "application/json")
+
+	rsp := postSnaps(snapsCmd, req, nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeSync)
+	plan := rsp.Result.(*snapOpPlan)
+	c.Check(plan.Summary, check.Equals, `Refresh snaps "svc-snap", "other-snap"`)
+	c.Check(plan.Affected, check.DeepEquals, []string{"svc-snap", "other-snap"})
+	c.Check(plan.Tasks, check.DeepEquals, []*planTask{
+		{ID: "1", Kind: "download-snap", Summary: "Download svc-snap", Snap: "svc-snap"},
+		{ID: "2", Kind: "stop-snap-services", Summary: "Stop svc-snap services", WaitFor: []string{"1"}, Snap: "svc-snap"},
+		{ID: "3", Kind: "link-snap", Summary: "Make svc-snap available", WaitFor: []string{"2"}, Snap: "svc-snap"},
+		{ID: "4", Kind: "download-snap", Summary: "Download other-snap", WaitFor: []string{"1", "2", "3"}, Snap: "other-snap"},
+		{ID: "5", Kind: "stop-snap-services", Summary: "Stop other-snap services", WaitFor: []string{"4", "1", "2", "3"}, Snap: "other-snap"},
+		{ID: "6", Kind: "link-snap", Summary: "Make other-snap available", WaitFor: []string{"5", "1", "2", "3"}, Snap: "other-snap"},
+	})
+	c.Check(plan.Downloads, check.DeepEquals, []*planDownload{
+		{Action: "refresh", Snap: "svc-snap", SnapID: "svc-snap-id", Revision: snap.R(2), Channel: "stable", Size: 1000},
+		{Action: "install", Snap: "other-snap", SnapID: "other-snap-id", Revision: snap.R(7), Channel: "stable", Size: 500},
+	})
+	c.Check(plan.DownloadSize, check.Equals, int64(1500))
+	c.Check(plan.Services, check.DeepEquals, []string{"snap.svc-snap.svc.service"})
+
+	// nothing is left behind
+	st.Lock()
+	defer st.Unlock()
+	c.Check(st.Changes(), check.HasLen, 0)
+	c.Check(st.TaskCount(), check.Equals, tasksBefore)
+}
+
+func (s *apiSuite) TestPostSnapDryRun(c *check.C) {
+	d := s.daemonWithOverlordMock(c)
+	s.vars = map[string]string{"name": "foo"}
+
+	snapInstructionDispTable["remove"] = func(inst *snapInstruction, st *state.State) (string, []*state.TaskSet, error) {
+		t := st.NewTask("unlink-snap", "Make foo unavailable")
+		return "Remove foo", []*state.TaskSet{state.NewTaskSet(t)}, nil
+	}
+	defer func() {
+		snapInstructionDispTable["remove"] = snapRemove
+	}()
+
+	buf := bytes.NewBufferString(`{"action": "remove", "dry-run": true}`)
+	req, err := http.NewRequest("POST", "/v2/snaps/foo", buf)
+	c.Assert(err, check.IsNil)
+
+	rsp := postSnap(snapCmd, req, nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeSync)
+	c.Check(rsp.Result, check.DeepEquals, &snapOpPlan{
+		Summary:  "Remove foo",
+		Affected: []string{"foo"},
+		Tasks:    []*planTask{{ID: "1", Kind: "unlink-snap", Summary: "Make foo unavailable"}},
+	})
+
+	st := d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+	c.Check(st.Changes(), check.HasLen, 0)
+	c.Check(st.TaskCount(), check.Equals, 0)
+}
+
+func (s *apiSuite) TestPostSnapDryRunRemoveKeepsSnapshotSetID(c *check.C) {
+	d := s.daemon(c)
+	s.mkInstalledInState(c, d, "foo", "bar", "v1", snap.R(10), true, "")
+	s.vars = map[string]string{"name": "foo"}
+	snapstateRemove = snapstate.Remove
+
+	st := d.overlord.State()
+	st.Lock()
+	st.Set("last-snapshot-set-id", 41)
+	st.Unlock()
+
+	buf := bytes.NewBufferString(`{"action": "remove", "dry-run": true}`)
+	req, err := http.NewRequest("POST", "/v2/snaps/foo", buf)
+	c.Assert(err, check.IsNil)
+
+	rsp := postSnap(snapCmd, req, nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeSync)
+	var kinds []string
+	for _, t := range rsp.Result.(*snapOpPlan).Tasks {
+		kinds = append(kinds, t.Kind)
+	}
+	c.Check(kinds, testutil.Contains, "save-snapshot")
+
+	// planning the automatic snapshot uses up no snapshot set ID
+	st.Lock()
+	defer st.Unlock()
+	var lastSetID uint64
+	c.Assert(st.Get("last-snapshot-set-id", &lastSetID), check.IsNil)
+	c.Check(lastSetID, check.Equals, uint64(41))
+	c.Check(st.Changes(), check.HasLen, 0)
+}
+
+func (s *apiSuite) TestPostSnapDryRunUnsupported(c *check.C) {
+	s.daemonWithOverlordMock(c)
+	s.vars = map[string]string{"name": "foo"}
+
+	buf := bytes.NewBufferString(`{"action": "enable", "dry-run": true}`)
+	req, err := http.NewRequest("POST", "/v2/snaps/foo", buf)
+	c.Assert(err, check.IsNil)
+	rsp := postSnap(snapCmd, req, nil).(*resp)
+	c.Check(rsp.Status, check.Equals, 400)
+	c.Check(rsp.Result.(*errorResult).Message, check.Equals, "cannot dry-run enable")
+
+	buf = bytes.NewBufferString(`{"action": "snapshot", "dry-run": true}`)
+	req, err = http.NewRequest("POST", "/v2/snaps", buf)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "application/json")
+	rsp = postSnaps(snapsCmd, req, nil).(*resp)
+	c.Check(rsp.Status, check.Equals, 400)
+	c.Check(rsp.Result.(*errorResult).Message, check.Equals, "cannot dry-run snapshot")
+}
@@ -0,0 +1,372 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/snapcore/snapd/interfaces"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+var eventsCmd = &Command{
+	Path:   "/v2/events",
+	UserOK: true,
+	GET:    getEvents,
+}
+
+const (
+	eventTypeChange    = "change"
+	eventTypeTask      = "task"
+	eventTypeProgress  = "progress"
+	eventTypeWarning   = "warning"
+	eventTypeInterface = "interface"
+)
+
+var eventTypes = map[string]bool{
+	eventTypeChange:    true,
+	eventTypeTask:      true,
+	eventTypeProgress:  true,
+	eventTypeWarning:   true,
+	eventTypeInterface: true,
+}
+
+// eventBufferSize is how many events can be pending for a subscriber
+// before it is considered to not be keeping up, and dropped.
+var eventBufferSize = 256
+
+type eventInfo struct {
+	Type      string              `json:"type"`
+	Time      time.Time           `json:"time"`
+	Change    *changeEventInfo    `json:"change,omitempty"`
+	Task      *taskEventInfo      `json:"task,omitempty"`
+	Warning   *state.Warning      `json:"warning,omitempty"`
+	Interface *interfaceEventInfo `json:"interface,omitempty"`
+}
+
+type changeEventInfo struct {
+	ID        string `json:"id"`
+	Kind      string `json:"kind"`
+	Summary   string `json:"summary"`
+	Status    string `json:"status"`
+	OldStatus string `json:"old-status,omitempty"`
+	Ready     bool   `json:"ready"`
+	Err       string `json:"err,omitempty"`
+}
+
+type taskEventInfo struct {
+	ID        string           `json:"id"`
+	ChangeID  string           `json:"change-id,omitempty"`
+	Kind      string           `json:"kind"`
+	Summary   string           `json:"summary"`
+	Status    string           `json:"status"`
+	OldStatus string           `json:"old-status,omitempty"`
+	Progress  taskInfoProgress `json:"progress"`
+}
+
+type interfaceEventInfo struct {
+	// Action is either "connect" or "disconnect".
+	Action   string             `json:"action"`
+	Plug     interfaces.PlugRef `json:"plug"`
+	Slot     interfaces.SlotRef `json:"slot"`
+	ChangeID string             `json:"change-id,omitempty"`
+}
+
+func (ev *eventInfo) changeID() string {
+	switch {
+	case ev.Change != nil:
+		return ev.Change.ID
+	case ev.Task != nil:
+		return ev.Task.ChangeID
+	case ev.Interface != nil:
+		return ev.Interface.ChangeID
+	}
+	return ""
+}
+
+func newTaskEventInfo(t *state.Task) *taskEventInfo {
+	label, done, total := t.Progress()
+	info := &taskEventInfo{
+		ID:      t.ID(),
+		Kind:    t.Kind(),
+		Summary: t.Summary(),
+		Status:  t.Status().String(),
+		Progress: taskInfoProgress{
+			Label: label,
+			Done:  done,
+			Total: total,
+		},
+	}
+	if chg := t.Change(); chg != nil {
+		info.ChangeID = chg.ID()
+	}
+	return info
+}
+
+// eventHub hooks into the state to fan out what happens there to its
+// subscribers.
+type eventHub struct {
+	mu   sync.Mutex
+	subs map[*eventSubscription]bool
+}
+
+type eventHubKey struct{}
+
+// eventHubFor returns the event hub of the given state, hooking it up
+// on first use. The state must be locked.
+func eventHubFor(st *state.State) *eventHub {
+	if hub, ok := st.Cached(eventHubKey{}).(*eventHub); ok {
+		return hub
+	}
+	hub := &eventHub{subs: make(map[*eventSubscription]bool)}
+	st.AddChangeStatusChangedHandler(hub.changeStatusChanged)
+	st.AddTaskStatusChangedHandler(hub.taskStatusChanged)
+	st.AddTaskProgressHandler(hub.taskProgress)
+	st.AddWarningAddedHandler(hub.warningAdded)
+	st.Cache(eventHubKey{}, hub)
+	return hub
+}
+
+// eventSubscription receives the events it wants from an eventHub
+// on its channel, until it is closed.
+type eventSubscription struct {
+	hub *eventHub
+	// types of events wanted, all of them if empty
+	types map[string]bool
+	// if set, only events of this change are wanted
+	changeID string
+
+	ch chan *eventInfo
+}
+
+func (sub *eventSubscription) wants(ev *eventInfo) bool {
+	if len(sub.types) > 0 && !sub.types[ev.Type] {
+		return false
+	}
+	if sub.changeID != "" && ev.changeID() != sub.changeID {
+		return false
+	}
+	return true
+}
+
+// Close stops the subscription and closes its channel, if still open.
+func (sub *eventSubscription) Close() {
+	sub.hub.mu.Lock()
+	defer sub.hub.mu.Unlock()
+	sub.hub.remove(sub)
+}
+
+func (h *eventHub) subscribe(types map[string]bool, changeID string) *eventSubscription {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	sub := &eventSubscription{
+		hub:      h,
+		types:    types,
+		changeID: changeID,
+		ch:       make(chan *eventInfo, eventBufferSize),
+	}
+	h.subs[sub] = true
+	return sub
+}
+
+// remove must be called with h.mu held.
+func (h *eventHub) remove(sub *eventSubscription) {
+	if h.subs[sub] {
+		delete(h.subs, sub)
+		close(sub.ch)
+	}
+}
+
+func (h *eventHub) active() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs) > 0
+}
+
+func (h *eventHub) publish(ev *eventInfo) {
+	ev.Time = time.Now()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subs {
+		if !sub.wants(ev) {
+			continue
+		}
+		select {
+		case sub.ch <- ev:
+		default:
+			// never hold up the state because of a slow reader
+			logger.Noticef("Dropping event subscriber that is not keeping up.")
+			h.remove(sub)
+		}
+	}
+}
+
+func (h *eventHub) changeStatusChanged(chg *state.Change, old, new state.Status) {
+	if !h.active() {
+		return
+	}
+	info := &changeEventInfo{
+		ID:        chg.ID(),
+		Kind:      chg.Kind(),
+		Summary:   chg.Summary(),
+		Status:    new.String(),
+		OldStatus: old.String(),
+		Ready:     new.Ready(),
+	}
+	if err := chg.Err(); err != nil {
+		info.Err = err.Error()
+	}
+	h.publish(&eventInfo{Type: eventTypeChange, Change: info})
+}
+
+func (h *eventHub) taskStatusChanged(t *state.Task, old, new state.Status) {
+	if !h.active() {
+		return
+	}
+	info := newTaskEventInfo(t)
+	info.OldStatus = old.String()
+	h.publish(&eventInfo{Type: eventTypeTask, Task: info})
+
+	if iface := interfaceEvent(t, new); iface != nil {
+		h.publish(&eventInfo{Type: eventTypeInterface, Interface: iface})
+	}
+}
+
+// interfaceEvent returns the interface event for the given connect or
+// disconnect task reaching the given status, if any.
+func interfaceEvent(t *state.Task, status state.Status) *interfaceEventInfo {
+	var action string
+	switch {
+	case t.Kind() == "connect" && status == state.DoneStatus,
+		t.Kind() == "disconnect" && status == state.UndoneStatus:
+		action = "connect"
+	case t.Kind() == "disconnect" && status == state.DoneStatus,
+		t.Kind() == "connect" && status == state.UndoneStatus:
+		action = "disconnect"
+	default:
+		return nil
+	}
+
+	info := &interfaceEventInfo{Action: action}
+	if err := t.Get("plug", &info.Plug); err != nil {
+		logger.Noticef("Cannot get plug of task %s: %v", t.ID(), err)
+		return nil
+	}
+	if err := t.Get("slot", &info.Slot); err != nil {
+		logger.Noticef("Cannot get slot of task %s: %v", t.ID(), err)
+		return nil
+	}
+	if chg := t.Change(); chg != nil {
+		info.ChangeID = chg.ID()
+	}
+	return info
+}
+
+func (h *eventHub) taskProgress(t *state.Task) {
+	if !h.active() {
+		return
+	}
+	h.publish(&eventInfo{Type: eventTypeProgress, Task: newTaskEventInfo(t)})
+}
+
+func (h *eventHub) warningAdded(w *state.Warning) {
+	if !h.active() {
+		return
+	}
+	// the warning keeps changing, send a snapshot of it
+	snapshot := *w
+	h.publish(&eventInfo{Type: eventTypeWarning, Warning: &snapshot})
+}
+
+func getEvents(c *Command, r *http.Request, user *auth.UserState) Response {
+	query := r.URL.Query()
+
+	var types map[string]bool
+	if qtypes := query.Get("types"); qtypes != "" {
+		types = make(map[string]bool)
+		for _, typ := range strings.Split(qtypes, ",") {
+			if !eventTypes[typ] {
+				return BadRequest("unknown event type %q", typ)
+			}
+			types[typ] = true
+		}
+	}
+
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	changeID := query.Get("change-id")
+	if changeID != "" && st.Change(changeID) == nil {
+		return NotFound("cannot find change with id %q", changeID)
+	}
+
+	sub := eventHubFor(st).subscribe(types, changeID)
+	return &eventsResponse{sub: sub, dying: c.d.Dying()}
+}
+
+// eventsResponse streams the events of a subscription as json-seq
+// (RFC7464), until the client goes away or the daemon stops.
+type eventsResponse struct {
+	sub   *eventSubscription
+	dying <-chan struct{}
+}
+
+func (er *eventsResponse) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	defer er.sub.Close()
+
+	w.Header().Set("Content-Type", "application/json-seq")
+	w.WriteHeader(http.StatusOK)
+	flusher, hasFlusher := w.(http.Flusher)
+	if hasFlusher {
+		flusher.Flush()
+	}
+
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case ev, ok := <-er.sub.ch:
+			if !ok {
+				return
+			}
+			if _, err := w.Write([]byte{0x1E}); err != nil {
+				return
+			}
+			if err := enc.Encode(ev); err != nil {
+				logger.Debugf("cannot stream event: %v", err)
+				return
+			}
+			if hasFlusher {
+				flusher.Flush()
+			}
+		case <-r.Context().Done():
+			return
+		case <-er.dying:
+			return
+		}
+	}
+}
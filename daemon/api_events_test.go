@@ -0,0 +1,211 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/interfaces"
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+func decodeEventsSeq(c *check.C, body []byte) []map[string]interface{} {
+	var events []map[string]interface{}
+	for _, rec := range bytes.Split(body, []byte{0x1E}) {
+		if len(rec) == 0 {
+			continue
+		}
+		var ev map[string]interface{}
+		c.Assert(json.Unmarshal(rec, &ev), check.IsNil)
+		events = append(events, ev)
+	}
+	return events
+}
+
+func (s *apiSuite) TestEvents(c *check.C) {
+	d := s.daemonWithOverlordMock(c)
+	st := d.overlord.State()
+
+	req, err := http.NewRequest("GET", "/v2/events", nil)
+	c.Assert(err, check.IsNil)
+	rsp, ok := getEvents(eventsCmd, req, nil).(*eventsResponse)
+	c.Assert(ok, check.Equals, true)
+
+	st.Lock()
+	chg := st.NewChange("connect-snap", "Connect foo:bar to baz:quux")
+	t := st.NewTask("connect", "Connect foo:bar to baz:quux")
+	t.Set("plug", interfaces.PlugRef{Snap: "foo", Name: "bar"})
+	t.Set("slot", interfaces.SlotRef{Snap: "baz", Name: "quux"})
+	chg.AddTask(t)
+	t.SetStatus(state.DoingStatus)
+	t.SetProgress("label", 1, 2)
+	t.SetStatus(state.DoneStatus)
+	st.Warnf("something happened")
+	st.Unlock()
+
+	// no more events; the stream ends once the pending ones are sent
+	rsp.sub.Close()
+
+	rec := httptest.NewRecorder()
+	rsp.ServeHTTP(rec, req)
+	c.Check(rec.Code, check.Equals, 200)
+	c.Check(rec.HeaderMap.Get("Content-Type"), check.Equals, "application/json-seq")
+
+	events := decodeEventsSeq(c, rec.Body.Bytes())
+	var types []string
+	for _, ev := range events {
+		types = append(types, ev["type"].(string))
+		c.Check(ev["time"], check.NotNil)
+	}
+	c.Check(types, check.DeepEquals, []string{
+		"task", "change", "progress", "task", "interface", "change", "warning",
+	})
+
+	c.Check(events[0]["task"], check.DeepEquals, map[string]interface{}{
+		"id":         t.ID(),
+		"change-id":  chg.ID(),
+		"kind":       "connect",
+		"summary":    "Connect foo:bar to baz:quux",
+		"status":     "Doing",
+		"old-status": "Do",
+		"progress":   map[string]interface{}{"label": "", "done": 1.0, "total": 1.0},
+	})
+	c.Check(events[1]["change"], check.DeepEquals, map[string]interface{}{
+		"id":         chg.ID(),
+		"kind":       "connect-snap",
+		"summary":    "Connect foo:bar to baz:quux",
+		"status":     "Doing",
+		"old-status": "Do",
+		"ready":      false,
+	})
+	c.Check(events[2]["task"].(map[string]interface{})["progress"], check.DeepEquals, map[string]interface{}{
+		"label": "label", "done": 1.0, "total": 2.0,
+	})
+	c.Check(events[4]["interface"], check.DeepEquals, map[string]interface{}{
+		"action":    "connect",
+		"plug":      map[string]interface{}{"snap": "foo", "plug": "bar"},
+		"slot":      map[string]interface{}{"snap": "baz", "slot": "quux"},
+		"change-id": chg.ID(),
+	})
+	c.Check(events[5]["change"].(map[string]interface{})["ready"], check.Equals, true)
+	c.Check(events[6]["warning"].(map[string]interface{})["message"], check.Equals, "something happened")
+}
+
+func (s *apiSuite) TestEventsFiltered(c *check.C) {
+	d := s.daemonWithOverlordMock(c)
+	st := d.overlord.State()
+
+	st.Lock()
+	chg1 := st.NewChange("foo", "...")
+	t1 := st.NewTask("foo", "...")
+	chg1.AddTask(t1)
+	chg2 := st.NewChange("bar", "...")
+	t2 := st.NewTask("bar", "...")
+	chg2.AddTask(t2)
+	st.Unlock()
+
+	req, err := http.NewRequest("GET", "/v2/events?types=change,progress&change-id="+chg1.ID(), nil)
+	c.Assert(err, check.IsNil)
+	rsp, ok := getEvents(eventsCmd, req, nil).(*eventsResponse)
+	c.Assert(ok, check.Equals, true)
+
+	st.Lock()
+	for _, t := range []*state.Task{t1, t2} {
+		t.SetProgress("", 1, 2)
+		t.SetStatus(state.DoneStatus)
+	}
+	st.Warnf("something happened")
+	st.Unlock()
+	rsp.sub.Close()
+
+	rec := httptest.NewRecorder()
+	rsp.ServeHTTP(rec, req)
+
+	events := decodeEventsSeq(c, rec.Body.Bytes())
+	c.Assert(events, check.HasLen, 2)
+	c.Check(events[0]["type"], check.Equals, "progress")
+	c.Check(events[0]["task"].(map[string]interface{})["id"], check.Equals, t1.ID())
+	c.Check(events[1]["type"], check.Equals, "change")
+	c.Check(events[1]["change"].(map[string]interface{})["id"], check.Equals, chg1.ID())
+}
+
+func (s *apiSuite) TestEventsErrors(c *check.C) {
+	s.daemonWithOverlordMock(c)
+
+	req, err := http.NewRequest("GET", "/v2/events?types=change,foo", nil)
+	c.Assert(err, check.IsNil)
+	rsp := getEvents(eventsCmd, req, nil).(*resp)
+	c.Check(rsp.Status, check.Equals, 400)
+	c.Check(rsp.Result.(*errorResult).Message, check.Equals, `unknown event type "foo"`)
+
+	req, err = http.NewRequest("GET", "/v2/events?change-id=42", nil)
+	c.Assert(err, check.IsNil)
+	rsp = getEvents(eventsCmd, req, nil).(*resp)
+	c.Check(rsp.Status, check.Equals, 404)
+	c.Check(rsp.Result.(*errorResult).Message, check.Equals, `cannot find change with id "42"`)
+}
+
+func (s *apiSuite) TestEventsSlowSubscriberDropped(c *check.C) {
+	d := s.daemonWithOverlordMock(c)
+	st := d.overlord.State()
+
+	oldEventBufferSize := eventBufferSize
+	eventBufferSize = 1
+	defer func() { eventBufferSize = oldEventBufferSize }()
+
+	req, err := http.NewRequest("GET", "/v2/events", nil)
+	c.Assert(err, check.IsNil)
+	rsp := getEvents(eventsCmd, req, nil).(*eventsResponse)
+
+	st.Lock()
+	st.Warnf("one")
+	st.Warnf("two")
+	hub := eventHubFor(st)
+	st.Unlock()
+
+	c.Check(hub.active(), check.Equals, false)
+	ev, ok := <-rsp.sub.ch
+	c.Assert(ok, check.Equals, true)
+	c.Check(ev.Warning.String(), check.Equals, "one")
+	_, ok = <-rsp.sub.ch
+	c.Check(ok, check.Equals, false)
+}
+
+func (s *apiSuite) TestEventsStopsWhenClientGoes(c *check.C) {
+	s.daemonWithOverlordMock(c)
+
+	req, err := http.NewRequest("GET", "/v2/events", nil)
+	c.Assert(err, check.IsNil)
+	rsp := getEvents(eventsCmd, req, nil).(*eventsResponse)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rec := httptest.NewRecorder()
+	rsp.ServeHTTP(rec, req.WithContext(ctx))
+	c.Check(rec.Code, check.Equals, 200)
+	c.Check(rec.Body.Len(), check.Equals, 0)
+	c.Check(rsp.sub.hub.active(), check.Equals, false)
+}
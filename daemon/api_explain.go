@@ -0,0 +1,220 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/overlord/assertstate"
+	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/ifacestate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+)
+
+var interfacesExplainCmd = &Command{
+	Path:   "/v2/interfaces/explain",
+	UserOK: true,
+	GET:    explainConnection,
+}
+
+var explainUcrednetGet = ucrednetGet
+
+// splitEndpoint splits "snap:name" into its snap and name.
+func splitEndpoint(s string) (snapName, name string, err error) {
+	i := strings.LastIndex(s, ":")
+	if i < 0 || i == len(s)-1 {
+		return "", "", fmt.Errorf("expected <snap>:<name>, got %q", s)
+	}
+	return s[:i], s[i+1:], nil
+}
+
+// readExplainSnapDeclarations reads the snap declarations in the given
+// files, checking they are valid against the assertion database without
+// adding them to it.
+func readExplainSnapDeclarations(st *state.State, fns []string) ([]*asserts.SnapDeclaration, error) {
+	db := assertstate.DB(st)
+	var decls []*asserts.SnapDeclaration
+	for _, fn := range fns {
+		as, err := readAssertionsFile(fn)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range as {
+			decl, ok := a.(*asserts.SnapDeclaration)
+			if !ok {
+				continue
+			}
+			if err := db.Check(decl); err != nil {
+				return nil, fmt.Errorf("cannot use snap declaration for %q: %v", decl.SnapName(), err)
+			}
+			decls = append(decls, decl)
+		}
+	}
+	return decls, nil
+}
+
+func readAssertionsFile(fn string) ([]asserts.Assertion, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var as []asserts.Assertion
+	dec := asserts.NewDecoder(f)
+	for {
+		a, err := dec.Decode()
+		if err == io.EOF {
+			return as, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode assertions in %s: %v", fn, err)
+		}
+		as = append(as, a)
+	}
+}
+
+// readExplainSnapFiles reads the snap files with the given paths, using
+// the matching snap declarations to give them their snap-id.
+func readExplainSnapFiles(fns []string, decls []*asserts.SnapDeclaration) (map[string]*snap.Info, error) {
+	infos := make(map[string]*snap.Info, len(fns))
+	for _, fn := range fns {
+		snapf, err := snap.Open(fn)
+		if err != nil {
+			return nil, err
+		}
+		info, err := snap.ReadInfoFromSnapFile(snapf, nil)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read snap file %s: %v", fn, err)
+		}
+		for _, decl := range decls {
+			if decl.SnapName() == info.SnapName() {
+				info.SnapID = decl.SnapID()
+			}
+		}
+		snap.SanitizePlugsSlots(info)
+		infos[info.InstanceName()] = info
+	}
+	return infos, nil
+}
+
+func explainConnection(c *Command, r *http.Request, user *auth.UserState) Response {
+	query := r.URL.Query()
+	plugSnap, plugName, err := splitEndpoint(query.Get("plug"))
+	if err != nil {
+		return BadRequest("invalid plug: %v", err)
+	}
+	slotSnap, slotName, err := splitEndpoint(query.Get("slot"))
+	if err != nil {
+		return BadRequest("invalid slot: %v", err)
+	}
+	if slotSnap == "" {
+		slotSnap = ifacestate.SystemSnapName()
+	}
+	plugSnap = ifacestate.RemapSnapFromRequest(plugSnap)
+	slotSnap = ifacestate.RemapSnapFromRequest(slotSnap)
+
+	snapFiles := query["snap-file"]
+	assertionFiles := query["assertion-file"]
+	if len(snapFiles) != 0 || len(assertionFiles) != 0 {
+		// the files are read with the privileges of snapd
+		if _, uid, _, err := explainUcrednetGet(r.RemoteAddr); err != nil || uid != 0 {
+			return Forbidden("cannot use snap or assertion files unless root")
+		}
+		for _, fn := range append(snapFiles, assertionFiles...) {
+			if !filepath.IsAbs(fn) {
+				return BadRequest("cannot use relative path %q", fn)
+			}
+		}
+	}
+
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	decls, err := readExplainSnapDeclarations(st, assertionFiles)
+	if err != nil {
+		return BadRequest("%v", err)
+	}
+	infos, err := readExplainSnapFiles(snapFiles, decls)
+	if err != nil {
+		return BadRequest("%v", err)
+	}
+	declsByID := make(map[string]*asserts.SnapDeclaration, len(decls))
+	for _, decl := range decls {
+		declsByID[decl.SnapID()] = decl
+	}
+
+	repo := c.d.overlord.InterfaceManager().Repository()
+	plug := repo.Plug(plugSnap, plugName)
+	if info := infos[plugSnap]; info != nil {
+		plug = info.Plugs[plugName]
+	}
+	if plug == nil {
+		return NotFound("snap %q has no plug named %q", plugSnap, plugName)
+	}
+	slot := repo.Slot(slotSnap, slotName)
+	if info := infos[slotSnap]; info != nil {
+		slot = info.Slots[slotName]
+	}
+	if slot == nil {
+		return NotFound("snap %q has no slot named %q", slotSnap, slotName)
+	}
+
+	checks, err := ifacestate.ExplainConnection(st, plug, slot, declsByID)
+	if err != nil {
+		return BadRequest("cannot explain connection: %v", err)
+	}
+
+	explanation := &client.ConnectionExplanation{
+		Plug:      client.PlugRef{Snap: plugSnap, Name: plugName},
+		Slot:      client.SlotRef{Snap: slotSnap, Name: slotName},
+		Interface: plug.Interface,
+		Checks:    make([]*client.PolicyCheck, len(checks)),
+	}
+	for i, check := range checks {
+		cc := &client.PolicyCheck{
+			Check:   check.Check,
+			Snap:    check.Snap,
+			Allowed: check.Allowed,
+			Skipped: check.Skipped,
+			Error:   check.Error,
+		}
+		for _, step := range check.Trace {
+			cc.Trace = append(cc.Trace, client.PolicyTraceStep{
+				Rule:        step.Rule,
+				Constraint:  step.Constraint,
+				Alternative: step.Alternative,
+				Matched:     step.Matched,
+				Detail:      step.Detail,
+			})
+		}
+		explanation.Checks[i] = cc
+	}
+	return SyncResponse(explanation, nil)
+}
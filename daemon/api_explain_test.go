@@ -0,0 +1,193 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/assertstest"
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/interfaces/builtin"
+	"github.com/snapcore/snapd/interfaces/ifacetest"
+	"github.com/snapcore/snapd/overlord/assertstate"
+)
+
+// Tests for GET /v2/interfaces/explain
+
+func (s *apiSuite) explainConnection(c *check.C, query url.Values) *resp {
+	req, err := http.NewRequest("GET", "/v2/interfaces/explain?"+query.Encode(), nil)
+	c.Assert(err, check.IsNil)
+	return interfacesExplainCmd.GET(interfacesExplainCmd, req, nil).(*resp)
+}
+
+func (s *apiSuite) TestExplainConnectionInstalled(c *check.C) {
+	restore := builtin.MockInterface(&ifacetest.TestInterface{InterfaceName: "test"})
+	defer restore()
+
+	s.daemon(c)
+	s.mockSnap(c, consumerYaml)
+	s.mockSnap(c, producerYaml)
+
+	rsp := s.explainConnection(c, url.Values{"plug": {"consumer:plug"}, "slot": {"producer:slot"}})
+	c.Assert(rsp.Type, check.Equals, ResponseTypeSync)
+	explanation := rsp.Result.(*client.ConnectionExplanation)
+	c.Check(explanation.Plug, check.Equals, client.PlugRef{Snap: "consumer", Name: "plug"})
+	c.Check(explanation.Slot, check.Equals, client.SlotRef{Snap: "producer", Name: "slot"})
+	c.Check(explanation.Interface, check.Equals, "test")
+	c.Assert(explanation.Checks, check.HasLen, 4)
+	for i, what := range []string{"installation", "installation", "connection", "auto-connection"} {
+		c.Check(explanation.Checks[i].Check, check.Equals, what)
+		c.Check(explanation.Checks[i].Allowed, check.Equals, true)
+	}
+	c.Check(explanation.Checks[3].Trace, check.DeepEquals, []client.PolicyTraceStep{{
+		Constraint: "auto-connection",
+		Detail:     `no rule for interface "test", allowed`,
+	}})
+}
+
+func (s *apiSuite) TestExplainConnectionErrors(c *check.C) {
+	restore := builtin.MockInterface(&ifacetest.TestInterface{InterfaceName: "test"})
+	defer restore()
+
+	s.daemon(c)
+	s.mockSnap(c, consumerYaml)
+
+	for _, t := range []struct {
+		query  url.Values
+		status int
+		err    string
+	}{
+		{url.Values{"plug": {"consumer"}, "slot": {"producer:slot"}}, 400, `invalid plug: expected <snap>:<name>, got "consumer"`},
+		{url.Values{"plug": {"consumer:plug"}, "slot": {"producer:"}}, 400, `invalid slot: expected <snap>:<name>, got "producer:"`},
+		{url.Values{"plug": {"consumer:nope"}, "slot": {"producer:slot"}}, 404, `snap "consumer" has no plug named "nope"`},
+		{url.Values{"plug": {"consumer:plug"}, "slot": {"producer:slot"}}, 404, `snap "producer" has no slot named "slot"`},
+	} {
+		rsp := s.explainConnection(c, t.query)
+		c.Check(rsp.Status, check.Equals, t.status, check.Commentf("%v", t.query))
+		c.Check(rsp.Result.(*errorResult).Message, check.Equals, t.err)
+	}
+}
+
+func (s *apiSuite) TestExplainConnectionFilesRootOnly(c *check.C) {
+	s.daemon(c)
+	explainUcrednetGet = func(string) (int32, uint32, string, error) {
+		return 100, 1000, dirs.SnapdSocket, nil
+	}
+	defer func() { explainUcrednetGet = ucrednetGet }()
+
+	rsp := s.explainConnection(c, url.Values{"plug": {"consumer:plug"}, "slot": {"producer:slot"}, "snap-file": {"/tmp/foo.snap"}})
+	c.Check(rsp.Status, check.Equals, 403)
+
+	explainUcrednetGet = func(string) (int32, uint32, string, error) {
+		return 100, 0, dirs.SnapdSocket, nil
+	}
+	rsp = s.explainConnection(c, url.Values{"plug": {"consumer:plug"}, "slot": {"producer:slot"}, "snap-file": {"foo.snap"}})
+	c.Check(rsp.Status, check.Equals, 400)
+	c.Check(rsp.Result.(*errorResult).Message, check.Equals, `cannot use relative path "foo.snap"`)
+}
+
+func (s *apiSuite) TestExplainConnectionSnapFile(c *check.C) {
+	restore := builtin.MockInterface(&ifacetest.TestInterface{InterfaceName: "test"})
+	defer restore()
+
+	d := s.daemon(c)
+	s.mockSnap(c, producerYaml)
+	explainUcrednetGet = func(string) (int32, uint32, string, error) {
+		return 100, 0, dirs.SnapdSocket, nil
+	}
+	defer func() { explainUcrednetGet = ucrednetGet }()
+
+	snapDir := filepath.Join(c.MkDir(), "consumer")
+	c.Assert(os.MkdirAll(filepath.Join(snapDir, "meta"), 0755), check.IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(snapDir, "meta", "snap.yaml"), []byte(consumerYaml), 0644), check.IsNil)
+
+	devAcct := assertstest.NewAccount(s.storeSigning, "devel", map[string]interface{}{
+		"account-id": "devel-id",
+	}, "")
+	st := d.overlord.State()
+	st.Lock()
+	err := assertstate.Add(st, s.storeSigning.StoreAccountKey(""))
+	if err == nil {
+		err = assertstate.Add(st, devAcct)
+	}
+	st.Unlock()
+	c.Assert(err, check.IsNil)
+	snapDecl, err := s.storeSigning.Sign(asserts.SnapDeclarationType, map[string]interface{}{
+		"series":       "16",
+		"snap-id":      "consumer-id",
+		"snap-name":    "consumer",
+		"publisher-id": devAcct.AccountID(),
+		"timestamp":    time.Now().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, check.IsNil)
+	assertsFile := filepath.Join(c.MkDir(), "consumer.assert")
+	c.Assert(ioutil.WriteFile(assertsFile, asserts.Encode(snapDecl), 0644), check.IsNil)
+
+	rsp := s.explainConnection(c, url.Values{
+		"plug":           {"consumer:plug"},
+		"slot":           {"producer:slot"},
+		"snap-file":      {snapDir},
+		"assertion-file": {assertsFile},
+	})
+	c.Assert(rsp.Type, check.Equals, ResponseTypeSync, check.Commentf("%v", rsp.Result))
+	explanation := rsp.Result.(*client.ConnectionExplanation)
+	c.Assert(explanation.Checks, check.HasLen, 4)
+	// the snap file got its snap-id from the declaration, so its
+	// installation is checked
+	c.Check(explanation.Checks[0], check.DeepEquals, &client.PolicyCheck{
+		Check:   "installation",
+		Snap:    "consumer",
+		Allowed: true,
+		Trace: []client.PolicyTraceStep{{
+			Constraint: "installation",
+			Detail:     `no rule for plug "plug" of interface "test", allowed`,
+		}},
+	})
+	c.Check(explanation.Checks[1].Skipped, check.Equals, "snap has no snap-id, its installation is not checked")
+
+	// a declaration the system cannot verify is refused
+	otherSigning := assertstest.NewStoreStack("other", nil)
+	otherDecl, err := otherSigning.Sign(asserts.SnapDeclarationType, map[string]interface{}{
+		"series":       "16",
+		"snap-id":      "consumer-id",
+		"snap-name":    "consumer",
+		"publisher-id": "other",
+		"timestamp":    time.Now().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, check.IsNil)
+	c.Assert(ioutil.WriteFile(assertsFile, asserts.Encode(otherDecl), 0644), check.IsNil)
+	rsp = s.explainConnection(c, url.Values{
+		"plug":           {"consumer:plug"},
+		"slot":           {"producer:slot"},
+		"snap-file":      {snapDir},
+		"assertion-file": {assertsFile},
+	})
+	c.Check(rsp.Status, check.Equals, 400)
+	c.Check(rsp.Result.(*errorResult).Message, check.Matches, `cannot use snap declaration for "consumer": .*matching public key.*`)
+}
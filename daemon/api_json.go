@@ -58,21 +58,23 @@ type interfaceJSON struct {
 
 // interfaceAction is an action performed on the interface system.
 type interfaceAction struct {
-	Action string     `json:"action"`
-	Plugs  []plugJSON `json:"plugs,omitempty"`
-	Slots  []slotJSON `json:"slots,omitempty"`
+	Action   string     `json:"action"`
+	Plugs    []plugJSON `json:"plugs,omitempty"`
+	Slots    []slotJSON `json:"slots,omitempty"`
+	Schedule string     `json:"schedule,omitempty"`
 }
 
 // connectionsJSON aids in marshalling information about a single connection
 // into JSON
 type connectionJSON struct {
-	Slot      interfaces.SlotRef     `json:"slot"`
-	Plug      interfaces.PlugRef     `json:"plug"`
-	Interface string                 `json:"interface"`
-	Manual    bool                   `json:"manual,omitempty"`
-	Gadget    bool                   `json:"gadget,omitempty"`
-	SlotAttrs map[string]interface{} `json:"slot-attrs,omitempty"`
-	PlugAttrs map[string]interface{} `json:"plug-attrs,omitempty"`
+	Slot        interfaces.SlotRef     `json:"slot"`
+	Plug        interfaces.PlugRef     `json:"plug"`
+	Interface   string                 `json:"interface"`
+	Manual      bool                   `json:"manual,omitempty"`
+	Gadget      bool                   `json:"gadget,omitempty"`
+	LocalPolicy bool                   `json:"local-policy,omitempty"`
+	SlotAttrs   map[string]interface{} `json:"slot-attrs,omitempty"`
+	PlugAttrs   map[string]interface{} `json:"plug-attrs,omitempty"`
 }
 
 // legacyConnectionsJSON aids in marshaling legacy connections into JSON.
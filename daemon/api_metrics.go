@@ -0,0 +1,65 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"net/http"
+
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/metrics"
+	"github.com/snapcore/snapd/overlord/auth"
+)
+
+var metricsCmd = &Command{
+	Path:     "/v2/metrics",
+	RootOnly: true,
+	GET:      getMetrics,
+}
+
+// metricsResponse writes out the registered metrics, and the given
+// ones, in the Prometheus text exposition format.
+type metricsResponse []metrics.Metric
+
+func (mr metricsResponse) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.WriteHeader(200)
+	if err := metrics.Write(w, mr...); err != nil {
+		logger.Noticef("cannot write metrics: %v", err)
+	}
+}
+
+func getMetrics(c *Command, r *http.Request, user *auth.UserState) Response {
+	queue := metrics.NewGauge("snapd_taskrunner_tasks", "Tasks in the task runner queue, by whether they are running or waiting to run.", "state")
+	running, waiting := c.d.overlord.TaskRunner().QueueDepth()
+	queue.Set(float64(running), "running")
+	queue.Set(float64(waiting), "waiting")
+
+	inProgress := metrics.NewGauge("snapd_changes_in_progress", "Changes not ready yet, by kind.", "kind")
+	st := c.d.overlord.State()
+	st.Lock()
+	for _, chg := range st.Changes() {
+		if !chg.Status().Ready() {
+			inProgress.Add(1, chg.Kind())
+		}
+	}
+	st.Unlock()
+
+	return metricsResponse{queue, inProgress}
+}
@@ -0,0 +1,65 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+func (s *apiSuite) TestGetMetrics(c *check.C) {
+	d := s.daemon(c)
+	c.Check(metricsCmd.RootOnly, check.Equals, true)
+
+	st := d.overlord.State()
+	st.Lock()
+	for _, status := range []state.Status{state.DoStatus, state.DoStatus, state.DoneStatus} {
+		chg := st.NewChange("install-snap", "...")
+		t := st.NewTask("foo", "...")
+		t.SetStatus(status)
+		chg.AddTask(t)
+	}
+	st.Unlock()
+
+	req, err := http.NewRequest("GET", "/v2/metrics", nil)
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	getMetrics(metricsCmd, req, nil).ServeHTTP(rec, req)
+
+	c.Check(rec.Code, check.Equals, 200)
+	c.Check(rec.HeaderMap.Get("Content-Type"), check.Equals, "text/plain; version=0.0.4")
+	body := rec.Body.String()
+	c.Check(body, check.Matches, `(?s).*
+# TYPE snapd_changes_in_progress gauge
+snapd_changes_in_progress{kind="install-snap"} 2
+.*`)
+	c.Check(body, check.Matches, `(?s).*
+# TYPE snapd_taskrunner_tasks gauge
+snapd_taskrunner_tasks{state="running"} 0
+snapd_taskrunner_tasks{state="waiting"} 0
+.*`)
+	// the registered metrics are there too
+	c.Check(body, check.Matches, `(?s).*# TYPE snapd_store_request_duration_seconds histogram
+.*`)
+}
@@ -0,0 +1,220 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/interfaces"
+	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/ifacestate"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/strutil"
+)
+
+var snapProfilesCmd = &Command{
+	Path:     "/v2/snaps/{name}/security-profiles",
+	RootOnly: true,
+	GET:      getSnapProfiles,
+}
+
+// parseConnectionEndpoints parses "<snap>:<plug>[,<snap>:<slot>]".
+func parseConnectionEndpoints(s string) (plugSnap, plugName, slotSnap, slotName string, err error) {
+	endpoints := strings.SplitN(s, ",", 2)
+	plugSnap, plugName, err = splitEndpoint(endpoints[0])
+	if err != nil {
+		return "", "", "", "", err
+	}
+	if len(endpoints) == 2 {
+		slotSnap, slotName, err = splitEndpoint(endpoints[1])
+		if err != nil {
+			return "", "", "", "", err
+		}
+	}
+	plugSnap = ifacestate.RemapSnapFromRequest(plugSnap)
+	slotSnap = ifacestate.RemapSnapFromRequest(slotSnap)
+	return plugSnap, plugName, slotSnap, slotName, nil
+}
+
+func involvesSnap(ref *interfaces.ConnRef, snapName string) bool {
+	return ref.PlugRef.Snap == snapName || ref.SlotRef.Snap == snapName
+}
+
+// readProfilesChange reads the change to preview from the diff-with
+// parameter of the request.
+func readProfilesChange(st *state.State, repo *interfaces.Repository, snapName, diffWith string) (*ifacestate.ProfilesChange, error) {
+	i := strings.Index(diffWith, ":")
+	if i < 0 {
+		return nil, fmt.Errorf("expected <action>:<argument>, got %q", diffWith)
+	}
+	action, arg := diffWith[:i], diffWith[i+1:]
+	switch action {
+	case "connect":
+		plugSnap, plugName, slotSnap, slotName, err := parseConnectionEndpoints(arg)
+		if err != nil {
+			return nil, err
+		}
+		ref, err := repo.ResolveConnect(plugSnap, plugName, slotSnap, slotName)
+		if err != nil {
+			return nil, err
+		}
+		if !involvesSnap(ref, snapName) {
+			return nil, fmt.Errorf("connection %s does not involve snap %q", ref.ID(), snapName)
+		}
+		return &ifacestate.ProfilesChange{Connect: ref}, nil
+	case "disconnect":
+		plugSnap, plugName, slotSnap, slotName, err := parseConnectionEndpoints(arg)
+		if err != nil {
+			return nil, err
+		}
+		refs, err := repo.ResolveDisconnect(plugSnap, plugName, slotSnap, slotName)
+		if err != nil {
+			return nil, err
+		}
+		for _, ref := range refs {
+			if !involvesSnap(ref, snapName) {
+				return nil, fmt.Errorf("connection %s does not involve snap %q", ref.ID(), snapName)
+			}
+		}
+		return &ifacestate.ProfilesChange{Disconnect: refs}, nil
+	case "refresh":
+		if !filepath.IsAbs(arg) {
+			return nil, fmt.Errorf("cannot use relative path %q", arg)
+		}
+		var snapst snapstate.SnapState
+		if err := snapstate.Get(st, snapName, &snapst); err != nil && err != state.ErrNoState {
+			return nil, err
+		}
+		if !snapst.IsInstalled() {
+			return nil, &snap.NotInstalledError{Snap: snapName}
+		}
+		snapf, err := snap.Open(arg)
+		if err != nil {
+			return nil, err
+		}
+		info, err := snap.ReadInfoFromSnapFile(snapf, nil)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read snap file %s: %v", arg, err)
+		}
+		snap.SanitizePlugsSlots(info)
+		_, info.InstanceKey = snap.SplitInstanceName(snapName)
+		if info.InstanceName() != snapName {
+			return nil, fmt.Errorf("cannot refresh snap %q to snap file of %q", snapName, info.SnapName())
+		}
+		// only the differences the snap file brings are of interest,
+		// not those of a new revision
+		info.SideInfo = *snapst.CurrentSideInfo()
+		return &ifacestate.ProfilesChange{Refresh: info}, nil
+	}
+	return nil, fmt.Errorf("unknown action %q", action)
+}
+
+func getSnapProfiles(c *Command, r *http.Request, user *auth.UserState) Response {
+	snapName := ifacestate.RemapSnapFromRequest(muxVars(r)["name"])
+	diffWith := r.URL.Query().Get("diff-with")
+
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	ifaceMgr := c.d.overlord.InterfaceManager()
+	repo := ifaceMgr.Repository()
+	var change *ifacestate.ProfilesChange
+	if diffWith != "" {
+		var err error
+		change, err = readProfilesChange(st, repo, snapName, diffWith)
+		if _, ok := err.(*snap.NotInstalledError); ok {
+			return SnapNotFound(snapName, err)
+		}
+		if err != nil {
+			return BadRequest("invalid diff-with: %v", err)
+		}
+	}
+
+	current, changed, err := ifaceMgr.RenderSecurityProfiles(snapName, change)
+	if _, ok := err.(*snap.NotInstalledError); ok {
+		return SnapNotFound(snapName, err)
+	}
+	if err != nil {
+		if change != nil {
+			return BadRequest("cannot render security profiles: %v", err)
+		}
+		return InternalError("cannot render security profiles: %v", err)
+	}
+
+	profiles := []*client.SecurityProfile{}
+	for _, backend := range repo.Backends() {
+		name := backend.Name()
+		if change == nil {
+			for _, path := range sortedPaths(current[name]) {
+				profiles = append(profiles, &client.SecurityProfile{
+					Backend: string(name),
+					Path:    path,
+					Content: string(current[name][path]),
+				})
+			}
+			continue
+		}
+		for _, path := range sortedPaths(current[name], changed[name]) {
+			before, hadBefore := current[name][path]
+			after, hasAfter := changed[name][path]
+			fromName, toName := path, path
+			if !hadBefore {
+				fromName = "/dev/null"
+			}
+			if !hasAfter {
+				toName = "/dev/null"
+			}
+			diff := strutil.UnifiedDiff(fromName, toName, string(before), string(after), 3)
+			if diff == "" {
+				continue
+			}
+			profiles = append(profiles, &client.SecurityProfile{
+				Backend: string(name),
+				Path:    path,
+				Diff:    diff,
+			})
+		}
+	}
+	return SyncResponse(profiles, nil)
+}
+
+// sortedPaths returns the paths of the given profiles, sorted.
+func sortedPaths(files ...map[string][]byte) []string {
+	seen := make(map[string]bool)
+	var paths []string
+	for _, m := range files {
+		for path := range m {
+			if !seen[path] {
+				seen[path] = true
+				paths = append(paths, path)
+			}
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
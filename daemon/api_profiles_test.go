@@ -0,0 +1,233 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/interfaces"
+	"github.com/snapcore/snapd/interfaces/ifacetest"
+	"github.com/snapcore/snapd/snap"
+)
+
+// mockProfilesBackend adds a backend rendering a profile that lists the
+// connections of each snap.
+func (s *apiSuite) mockProfilesBackend(c *check.C) {
+	repo := s.d.overlord.InterfaceManager().Repository()
+	err := repo.AddBackend(&ifacetest.TestSecurityBackend{
+		BackendName: "apparmor",
+		RenderCallback: func(snapInfo *snap.Info, opts interfaces.ConfinementOptions, repo *interfaces.Repository) (map[string][]byte, error) {
+			conns, err := repo.Connections(snapInfo.InstanceName())
+			if err != nil {
+				return nil, err
+			}
+			var content string
+			for _, conn := range conns {
+				content += conn.ID() + "\n"
+			}
+			return map[string][]byte{"/profiles/snap." + snapInfo.InstanceName(): []byte(content)}, nil
+		},
+	})
+	c.Assert(err, check.IsNil)
+}
+
+// mockSnapDir returns the path of an unpacked snap with the given yaml.
+func mockSnapDir(c *check.C, yaml string) string {
+	snapDir := c.MkDir()
+	c.Assert(os.MkdirAll(filepath.Join(snapDir, "meta"), 0755), check.IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(snapDir, "meta", "snap.yaml"), []byte(yaml), 0644), check.IsNil)
+	return snapDir
+}
+
+func (s *apiSuite) getSnapProfiles(c *check.C, name, diffWith string) *resp {
+	s.vars = map[string]string{"name": name}
+	query := url.Values{}
+	if diffWith != "" {
+		query.Set("diff-with", diffWith)
+	}
+	req, err := http.NewRequest("GET", "/v2/snaps/"+name+"/security-profiles?"+query.Encode(), nil)
+	c.Assert(err, check.IsNil)
+	return snapProfilesCmd.GET(snapProfilesCmd, req, nil).(*resp)
+}
+
+func (s *apiSuite) TestSnapProfiles(c *check.C) {
+	s.daemon(c)
+	s.mockIface(c, &ifacetest.TestInterface{InterfaceName: "test"})
+	s.mockSnap(c, consumerYaml)
+	s.mockSnap(c, producerYaml)
+	s.mockProfilesBackend(c)
+
+	rsp := s.getSnapProfiles(c, "consumer", "")
+	c.Assert(rsp.Status, check.Equals, 200, check.Commentf("%v", rsp.Result))
+	c.Check(rsp.Result, check.DeepEquals, []*client.SecurityProfile{{
+		Backend: "apparmor",
+		Path:    "/profiles/snap.consumer",
+	}})
+
+	rsp = s.getSnapProfiles(c, "consumer", "connect:consumer:plug,producer:slot")
+	c.Assert(rsp.Status, check.Equals, 200, check.Commentf("%v", rsp.Result))
+	c.Check(rsp.Result, check.DeepEquals, []*client.SecurityProfile{{
+		Backend: "apparmor",
+		Path:    "/profiles/snap.consumer",
+		Diff: `--- /profiles/snap.consumer
++++ /profiles/snap.consumer
+@@ -0,0 +1 @@
++consumer:plug producer:slot
+`,
+	}})
+
+	// the connection was not made
+	repo := s.d.overlord.InterfaceManager().Repository()
+	conns, err := repo.Connections("consumer")
+	c.Assert(err, check.IsNil)
+	c.Check(conns, check.HasLen, 0)
+}
+
+func (s *apiSuite) TestSnapProfilesDisconnect(c *check.C) {
+	s.daemon(c)
+	s.mockIface(c, &ifacetest.TestInterface{InterfaceName: "test"})
+	s.mockSnap(c, consumerYaml)
+	s.mockSnap(c, producerYaml)
+	s.mockProfilesBackend(c)
+
+	repo := s.d.overlord.InterfaceManager().Repository()
+	ref := &interfaces.ConnRef{
+		PlugRef: interfaces.PlugRef{Snap: "consumer", Name: "plug"},
+		SlotRef: interfaces.SlotRef{Snap: "producer", Name: "slot"},
+	}
+	_, err := repo.Connect(ref, nil, nil, nil, nil, nil)
+	c.Assert(err, check.IsNil)
+
+	rsp := s.getSnapProfiles(c, "producer", "")
+	c.Assert(rsp.Status, check.Equals, 200, check.Commentf("%v", rsp.Result))
+	c.Check(rsp.Result, check.DeepEquals, []*client.SecurityProfile{{
+		Backend: "apparmor",
+		Path:    "/profiles/snap.producer",
+		Content: "consumer:plug producer:slot\n",
+	}})
+
+	rsp = s.getSnapProfiles(c, "producer", "disconnect:consumer:plug")
+	c.Assert(rsp.Status, check.Equals, 200, check.Commentf("%v", rsp.Result))
+	c.Check(rsp.Result, check.DeepEquals, []*client.SecurityProfile{{
+		Backend: "apparmor",
+		Path:    "/profiles/snap.producer",
+		Diff: `--- /profiles/snap.producer
++++ /profiles/snap.producer
+@@ -1 +0,0 @@
+-consumer:plug producer:slot
+`,
+	}})
+
+	// nothing changes when connecting what is connected already
+	rsp = s.getSnapProfiles(c, "producer", "connect:consumer:plug,producer:slot")
+	c.Assert(rsp.Status, check.Equals, 200, check.Commentf("%v", rsp.Result))
+	c.Check(rsp.Result, check.DeepEquals, []*client.SecurityProfile{})
+}
+
+func (s *apiSuite) TestSnapProfilesRefresh(c *check.C) {
+	s.daemon(c)
+	s.mockIface(c, &ifacetest.TestInterface{InterfaceName: "test"})
+	s.mockSnap(c, consumerYaml)
+	s.mockSnap(c, producerYaml)
+	s.mockProfilesBackend(c)
+
+	st := s.d.overlord.State()
+	st.Lock()
+	st.Set("conns", map[string]interface{}{
+		"consumer:plug producer:slot": map[string]interface{}{"interface": "test"},
+	})
+	st.Unlock()
+	repo := s.d.overlord.InterfaceManager().Repository()
+	ref := &interfaces.ConnRef{
+		PlugRef: interfaces.PlugRef{Snap: "consumer", Name: "plug"},
+		SlotRef: interfaces.SlotRef{Snap: "producer", Name: "slot"},
+	}
+	_, err := repo.Connect(ref, nil, nil, nil, nil, nil)
+	c.Assert(err, check.IsNil)
+
+	// the new revision still has the plug
+	path := mockSnapDir(c, consumerYaml)
+	rsp := s.getSnapProfiles(c, "consumer", "refresh:"+path)
+	c.Assert(rsp.Status, check.Equals, 200, check.Commentf("%v", rsp.Result))
+	c.Check(rsp.Result, check.DeepEquals, []*client.SecurityProfile{})
+
+	// but not this one
+	path = mockSnapDir(c, "name: consumer\nversion: 2\napps:\n app:\n")
+	rsp = s.getSnapProfiles(c, "consumer", "refresh:"+path)
+	c.Assert(rsp.Status, check.Equals, 200, check.Commentf("%v", rsp.Result))
+	c.Check(rsp.Result, check.DeepEquals, []*client.SecurityProfile{{
+		Backend: "apparmor",
+		Path:    "/profiles/snap.consumer",
+		Diff: `--- /profiles/snap.consumer
++++ /profiles/snap.consumer
+@@ -1 +0,0 @@
+-consumer:plug producer:slot
+`,
+	}})
+
+	rsp = s.getSnapProfiles(c, "producer", "refresh:"+path)
+	c.Check(rsp.Status, check.Equals, 400)
+	c.Check(rsp.Result.(*errorResult).Message, check.Equals, `invalid diff-with: cannot refresh snap "producer" to snap file of "consumer"`)
+
+	rsp = s.getSnapProfiles(c, "consumer", "refresh:relative/path.snap")
+	c.Check(rsp.Status, check.Equals, 400)
+	c.Check(rsp.Result.(*errorResult).Message, check.Equals, `invalid diff-with: cannot use relative path "relative/path.snap"`)
+}
+
+func (s *apiSuite) TestSnapProfilesErrors(c *check.C) {
+	s.daemon(c)
+	s.mockIface(c, &ifacetest.TestInterface{InterfaceName: "test"})
+	s.mockSnap(c, consumerYaml)
+	s.mockSnap(c, producerYaml)
+	s.mockProfilesBackend(c)
+
+	for _, t := range []struct {
+		name, diffWith, err string
+	}{
+		{"consumer", "connect", `invalid diff-with: expected <action>:<argument>, got "connect"`},
+		{"consumer", "install:foo", `invalid diff-with: unknown action "install"`},
+		{"consumer", "connect:consumer", `invalid diff-with: expected <snap>:<name>, got "consumer"`},
+		{"consumer", "connect:consumer:nope,producer:slot", `invalid diff-with: snap "consumer" has no plug named "nope"`},
+		{"consumer", "disconnect:consumer:plug,producer:slot", `invalid diff-with: cannot disconnect consumer:plug from producer:slot, it is not connected`},
+	} {
+		rsp := s.getSnapProfiles(c, t.name, t.diffWith)
+		c.Check(rsp.Status, check.Equals, 400, check.Commentf("%s", t.diffWith))
+		c.Check(rsp.Result.(*errorResult).Message, check.Equals, t.err, check.Commentf("%s", t.diffWith))
+	}
+
+	s.mockSnap(c, strings.Replace(consumerYaml, "name: consumer", "name: other", 1))
+	rsp := s.getSnapProfiles(c, "producer", "connect:other:plug,producer:slot")
+	c.Check(rsp.Status, check.Equals, 200)
+	rsp = s.getSnapProfiles(c, "consumer", "connect:other:plug,producer:slot")
+	c.Check(rsp.Status, check.Equals, 400)
+	c.Check(rsp.Result.(*errorResult).Message, check.Equals, `invalid diff-with: connection other:plug producer:slot does not involve snap "consumer"`)
+
+	rsp = s.getSnapProfiles(c, "unknown", "")
+	c.Check(rsp.Status, check.Equals, 404)
+	c.Check(rsp.Result.(*errorResult).Kind, check.Equals, errorKindSnapNotFound)
+}
@@ -0,0 +1,43 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"fmt"
+
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+// rollbackChange creates a change that takes the snap revisions,
+// connections and aliases affected by the given completed change back
+// to what they were before it.
+func rollbackChange(c *Command, chg *state.Change) Response {
+	st := chg.State()
+	tss, affected, err := snapstateRollback(st, chg)
+	if err != nil {
+		return errToResponse(err, nil, BadRequest, "cannot roll back change %s: %v", chg.ID())
+	}
+
+	rollback := newChange(st, "rollback", fmt.Sprintf("Roll back change %s (%s)", chg.ID(), chg.Summary()), tss, affected)
+	rollback.Set("rollback-of", chg.ID())
+	ensureStateSoon(st)
+
+	return AsyncResponse(nil, &Meta{Change: rollback.ID()})
+}
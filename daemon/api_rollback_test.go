@@ -0,0 +1,100 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+func (s *apiSuite) postRollback(c *check.C, chgID string) *resp {
+	s.vars = map[string]string{"id": chgID}
+	buf := bytes.NewBufferString(`{"action": "rollback"}`)
+	req, err := http.NewRequest("POST", "/v2/changes/"+chgID, buf)
+	c.Assert(err, check.IsNil)
+	return postChange(stateChangeCmd, req, nil).(*resp)
+}
+
+func (s *apiSuite) TestRollback(c *check.C) {
+	d := s.daemon(c)
+	soon := 0
+	ensureStateSoon = func(st *state.State) { soon++ }
+
+	st := d.overlord.State()
+	st.Lock()
+	chg := st.NewChange("refresh-snap", "Refresh foo and install bar")
+	st.Unlock()
+
+	snapstateRollback = func(st *state.State, rchg *state.Change) ([]*state.TaskSet, []string, error) {
+		c.Check(rchg, check.Equals, chg)
+		ts1 := state.NewTaskSet(st.NewTask("fake-remove", "bar"))
+		ts2 := state.NewTaskSet(st.NewTask("fake-revert", "foo"))
+		ts2.WaitAll(ts1)
+		return []*state.TaskSet{ts1, ts2}, []string{"bar", "foo"}, nil
+	}
+
+	rsp := s.postRollback(c, chg.ID())
+	c.Assert(rsp.Status, check.Equals, 202, check.Commentf("%v", rsp.Result))
+	c.Check(soon, check.Equals, 1)
+
+	st.Lock()
+	defer st.Unlock()
+	rollback := st.Change(rsp.Change)
+	c.Assert(rollback, check.NotNil)
+	c.Check(rollback.Kind(), check.Equals, "rollback")
+	c.Check(rollback.Summary(), check.Equals, "Roll back change "+chg.ID()+" (Refresh foo and install bar)")
+	var rollbackOf string
+	c.Assert(rollback.Get("rollback-of", &rollbackOf), check.IsNil)
+	c.Check(rollbackOf, check.Equals, chg.ID())
+	var snapNames []string
+	c.Assert(rollback.Get("snap-names", &snapNames), check.IsNil)
+	c.Check(snapNames, check.DeepEquals, []string{"bar", "foo"})
+
+	tasks := rollback.Tasks()
+	c.Assert(tasks, check.HasLen, 2)
+	c.Check(tasks[0].Kind(), check.Equals, "fake-remove")
+	c.Check(tasks[1].Kind(), check.Equals, "fake-revert")
+}
+
+func (s *apiSuite) TestRollbackError(c *check.C) {
+	d := s.daemon(c)
+	ensureStateSoon = func(st *state.State) {}
+
+	st := d.overlord.State()
+	st.Lock()
+	chg := st.NewChange("remove-snap", "...")
+	st.Unlock()
+
+	snapstateRollback = func(*state.State, *state.Change) ([]*state.TaskSet, []string, error) {
+		return nil, nil, errors.New(`"remove-snap" changes cannot be rolled back`)
+	}
+
+	rsp := s.postRollback(c, chg.ID())
+	c.Check(rsp.Status, check.Equals, 400)
+	c.Check(rsp.Result.(*errorResult).Message, check.Matches, `cannot roll back change \d+: "remove-snap" changes cannot be rolled back`)
+	st.Lock()
+	defer st.Unlock()
+	c.Check(st.Changes(), check.HasLen, 1)
+}
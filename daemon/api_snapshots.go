@@ -23,12 +23,18 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"mime"
 	"net/http"
+	"path/filepath"
 	"strconv"
 	"strings"
 
 	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/snapshotstate"
+	"github.com/snapcore/snapd/overlord/snapshotstate/backend"
+	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/strutil"
 )
@@ -42,6 +48,24 @@ var snapshotCmd = &Command{
 	POST:     changeSnapshots,
 }
 
+var snapshotExportCmd = &Command{
+	// exports carry the data of all users, so this is root only
+	Path: "/v2/snapshots/{id}/export",
+	GET:  getSnapshotExport,
+}
+
+var snapshotFilesCmd = &Command{
+	// listings show the data of all users, so this is root only
+	Path: "/v2/snapshots/{id}/{snap}/files",
+	GET:  getSnapshotFiles,
+}
+
+var snapshotUcrednetGet = ucrednetGet
+
+// snapshotEncryptionKeyHeader is the header used to give the key to use
+// for listing the files in an encrypted snapshot.
+const snapshotEncryptionKeyHeader = "X-Snapshot-Encryption-Key"
+
 func listSnapshots(c *Command, r *http.Request, user *auth.UserState) Response {
 	query := r.URL.Query()
 	var setID uint64
@@ -67,22 +91,45 @@ type snapshotAction struct {
 	Action string   `json:"action"`
 	Snaps  []string `json:"snaps,omitempty"`
 	Users  []string `json:"users,omitempty"`
+	Paths  []string `json:"paths,omitempty"`
+	Target string   `json:"target,omitempty"`
+	// EncryptionKey is left out of String, as that ends up in the
+	// change's summary
+	EncryptionKey string `json:"encryption-key,omitempty"`
 }
 
 func (action snapshotAction) String() string {
-	// verb of snapshot #N [for snaps %q] [for users %q]
+	// verb of snapshot #N [for snaps %q] [for users %q] [paths %q into %q]
 	var snaps string
 	var users string
+	var paths string
 	if len(action.Snaps) > 0 {
 		snaps = " for snaps " + strutil.Quoted(action.Snaps)
 	}
 	if len(action.Users) > 0 {
 		users = " for users " + strutil.Quoted(action.Users)
 	}
-	return fmt.Sprintf("%s of snapshot set #%d%s%s", strings.Title(action.Action), action.SetID, snaps, users)
+	if len(action.Paths) > 0 {
+		paths = fmt.Sprintf(" paths %s into %q", strutil.Quoted(action.Paths), action.Target)
+	}
+	return fmt.Sprintf("%s of snapshot set #%d%s%s%s", strings.Title(action.Action), action.SetID, snaps, users, paths)
 }
 
 func changeSnapshots(c *Command, r *http.Request, user *auth.UserState) Response {
+	// an import sends the export itself as the body, so the action
+	// comes in the query instead
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	isExport := mediaType == client.SnapshotExportMediaType
+	if r.URL.Query().Get("action") == "import" {
+		if !isExport {
+			return BadRequest("snapshot import requires a body of type %q", client.SnapshotExportMediaType)
+		}
+		return doSnapshotImport(c, r, user)
+	}
+	if isExport {
+		return BadRequest(`snapshot export sent without the "import" action`)
+	}
+
 	var action snapshotAction
 	decoder := json.NewDecoder(r.Body)
 	if err := decoder.Decode(&action); err != nil {
@@ -100,6 +147,28 @@ func changeSnapshots(c *Command, r *http.Request, user *auth.UserState) Response
 		return BadRequest("snapshot operation requires action")
 	}
 
+	restoreFiles := len(action.Paths) > 0 || action.Target != ""
+	if restoreFiles {
+		if action.Action != "restore" {
+			return BadRequest("snapshot %q operation cannot specify paths or target", action.Action)
+		}
+		if rsp := checkSnapshotRestoreFiles(r, &action); rsp != nil {
+			return rsp
+		}
+	}
+
+	var key []byte
+	if action.EncryptionKey != "" {
+		if action.Action == "forget" {
+			return BadRequest(`snapshot "forget" operation cannot specify an encryption key`)
+		}
+		var err error
+		key, err = backend.ParseKey(action.EncryptionKey)
+		if err != nil {
+			return BadRequest("%v", err)
+		}
+	}
+
 	var affected []string
 	var ts *state.TaskSet
 	var err error
@@ -112,7 +181,11 @@ func changeSnapshots(c *Command, r *http.Request, user *auth.UserState) Response
 	case "check":
 		affected, ts, err = snapshotCheck(st, action.SetID, action.Snaps, action.Users)
 	case "restore":
-		affected, ts, err = snapshotRestore(st, action.SetID, action.Snaps, action.Users)
+		if restoreFiles {
+			affected, ts, err = snapshotRestoreFiles(st, action.SetID, action.Snaps, action.Users, action.Paths, action.Target)
+		} else {
+			affected, ts, err = snapshotRestore(st, action.SetID, action.Snaps, action.Users)
+		}
 	case "forget":
 		if len(action.Users) != 0 {
 			return BadRequest(`snapshot "forget" operation cannot specify users`)
@@ -131,9 +204,130 @@ func changeSnapshots(c *Command, r *http.Request, user *auth.UserState) Response
 		return InternalError("%v", err)
 	}
 
-	chg := newChange(st, action.Action+"-snapshot", action.String(), []*state.TaskSet{ts}, affected)
+	snapshotstate.UseEncryptionKey(st, ts, key)
+
+	kind := action.Action + "-snapshot"
+	if restoreFiles {
+		kind = "restore-snapshot-files"
+	}
+	chg := newChange(st, kind, action.String(), []*state.TaskSet{ts}, affected)
 	chg.Set("api-data", map[string]interface{}{"snap-names": affected})
 	ensureStateSoon(st)
 
 	return AsyncResponse(nil, &Meta{Change: chg.ID()})
 }
+
+// checkSnapshotRestoreFiles checks a request to restore files from a
+// snapshot into a target directory; as the files are written as root to
+// wherever the target is, only root can do that.
+func checkSnapshotRestoreFiles(r *http.Request, action *snapshotAction) Response {
+	_, uid, _, err := snapshotUcrednetGet(r.RemoteAddr)
+	if err != nil {
+		return BadRequest("cannot get ucrednet uid: %v", err)
+	}
+	if uid != 0 {
+		return Forbidden("cannot restore snapshot files as non-root")
+	}
+	if len(action.Paths) == 0 {
+		return BadRequest("snapshot restore into a target requires paths")
+	}
+	if action.Target == "" {
+		return BadRequest("snapshot restore of paths requires a target")
+	}
+	if err := backend.ValidatePathPatterns(action.Paths); err != nil {
+		return BadRequest("%v", err)
+	}
+	if !filepath.IsAbs(action.Target) {
+		return BadRequest("snapshot restore target must be an absolute path; got %q", action.Target)
+	}
+	return nil
+}
+
+func doSnapshotImport(c *Command, r *http.Request, user *auth.UserState) Response {
+	st := c.d.overlord.State()
+	setID, snapNames, err := snapshotImport(r.Context(), st, r.Body)
+	if err != nil {
+		if _, ok := err.(*backend.InvalidExportError); ok {
+			return BadRequest("%v", err)
+		}
+		return InternalError("%v", err)
+	}
+
+	return SyncResponse(&client.SnapshotImportSet{ID: setID, Snaps: snapNames}, nil)
+}
+
+func getSnapshotExport(c *Command, r *http.Request, user *auth.UserState) Response {
+	sid := muxVars(r)["id"]
+	setID, err := strconv.ParseUint(sid, 10, 64)
+	if err != nil {
+		return BadRequest("'id' must be a positive base 10 number; got %q", sid)
+	}
+
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	export, err := snapshotExport(r.Context(), st, setID)
+	switch err {
+	case nil:
+		return &snapshotExportResponse{SnapshotExport: export, setID: setID}
+	case client.ErrSnapshotSetNotFound:
+		return NotFound("%v", err)
+	}
+	switch e := err.(type) {
+	case *snapstate.ChangeConflictError:
+		// the set is being forgotten
+		return SnapChangeConflict(e)
+	case *backend.CannotExportError:
+		return BadRequest("%v", err)
+	default:
+		return InternalError("%v", err)
+	}
+}
+
+func getSnapshotFiles(c *Command, r *http.Request, user *auth.UserState) Response {
+	vars := muxVars(r)
+	setID, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		return BadRequest("'id' must be a positive base 10 number; got %q", vars["id"])
+	}
+	users := strutil.CommaSeparatedList(r.URL.Query().Get("users"))
+	var key []byte
+	if hdr := r.Header.Get(snapshotEncryptionKeyHeader); hdr != "" {
+		key, err = backend.ParseKey(hdr)
+		if err != nil {
+			return BadRequest("%v", err)
+		}
+	}
+
+	files, err := snapshotFiles(r.Context(), c.d.overlord.State(), setID, vars["snap"], users, key)
+	switch err {
+	case nil:
+		if files == nil {
+			files = []client.SnapshotFile{}
+		}
+		return SyncResponse(files, nil)
+	case client.ErrSnapshotSetNotFound, client.ErrSnapshotSnapsNotFound:
+		return NotFound("%v", err)
+	default:
+		return InternalError("%v", err)
+	}
+}
+
+// A snapshotExportResponse's ServeHTTP method streams a snapshot set
+// export, closing it when done.
+type snapshotExportResponse struct {
+	*backend.SnapshotExport
+	setID uint64
+}
+
+func (s *snapshotExportResponse) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	defer s.Close()
+
+	w.Header().Set("Content-Type", client.SnapshotExportMediaType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=snapshot-%d.snapshot", s.setID))
+	if err := s.StreamTo(r.Context(), w); err != nil {
+		// too late to report this in the response itself
+		logger.Noticef("cannot export snapshot set #%d: %v", s.setID, err)
+	}
+}
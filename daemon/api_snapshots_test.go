@@ -20,10 +20,15 @@
 package daemon_test
 
 import (
+	"archive/tar"
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 
 	"gopkg.in/check.v1"
@@ -33,6 +38,8 @@ import (
 	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/overlord"
 	"github.com/snapcore/snapd/overlord/assertstate"
+	"github.com/snapcore/snapd/overlord/snapshotstate"
+	"github.com/snapcore/snapd/overlord/snapshotstate/backend"
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/store/storetest"
@@ -64,8 +71,9 @@ func (s *snapshotSuite) TearDownTest(c *check.C) {
 }
 
 func (s *snapshotSuite) TestSnapshotMany(c *check.C) {
-	defer daemon.MockSnapshotSave(func(s *state.State, snaps, users []string) (uint64, []string, *state.TaskSet, error) {
+	defer daemon.MockSnapshotSave(func(s *state.State, snaps, users []string, flags *snapshotstate.SaveFlags) (uint64, []string, *state.TaskSet, error) {
 		c.Check(snaps, check.HasLen, 2)
+		c.Check(flags, check.DeepEquals, &snapshotstate.SaveFlags{})
 		t := s.NewTask("fake-snapshot-2", "Snapshot two")
 		return 1, snaps, state.NewTaskSet(t), nil
 	})()
@@ -80,6 +88,22 @@ func (s *snapshotSuite) TestSnapshotMany(c *check.C) {
 	c.Check(res.Affected, check.DeepEquals, inst.Snaps)
 }
 
+func (s *snapshotSuite) TestSnapshotManyIncremental(c *check.C) {
+	defer daemon.MockSnapshotSave(func(s *state.State, snaps, users []string, flags *snapshotstate.SaveFlags) (uint64, []string, *state.TaskSet, error) {
+		c.Check(flags, check.DeepEquals, &snapshotstate.SaveFlags{Compression: "none", BaseSetID: 42})
+		t := s.NewTask("fake-snapshot", "Snapshot one")
+		return 43, snaps, state.NewTaskSet(t), nil
+	})()
+
+	inst := daemon.MustUnmarshalSnapInstruction(c, `{"action": "snapshot", "snaps": ["foo"], "compression": "none", "base-set-id": 42}`)
+	st := s.o.State()
+	st.Lock()
+	res, err := daemon.SnapshotMany(inst, st)
+	st.Unlock()
+	c.Assert(err, check.IsNil)
+	c.Check(res.Result, check.DeepEquals, map[string]interface{}{"set-id": uint64(43)})
+}
+
 func (s *snapshotSuite) TestListSnapshots(c *check.C) {
 	snapshots := []client.SnapshotSet{{ID: 1}, {ID: 42}}
 
@@ -168,6 +192,9 @@ func (s *snapshotSuite) TestFormatSnapshotAction(c *check.C) {
 		}, {
 			`{"set": 2, "action": "verb", "users": ["meep", "quux"], "snaps": ["foo", "bar"]}`,
 			`Verb of snapshot set #2 for snaps "foo", "bar" for users "meep", "quux"`,
+		}, {
+			`{"set": 2, "action": "verb", "snaps": ["foo"], "paths": ["42/*", "common"], "target": "/tmp/x"}`,
+			`Verb of snapshot set #2 for snaps "foo" paths "42/*", "common" into "/tmp/x"`,
 		},
 	}
 
@@ -198,6 +225,12 @@ func (s *snapshotSuite) TestChangeSnapshots400(c *check.C) {
 		}, {
 			body:  `{"set": 42, "action": "forget", "users": ["foo"]}`,
 			error: `snapshot "forget" operation cannot specify users`,
+		}, {
+			body:  `{"set": 42, "action": "forget", "encryption-key": "00"}`,
+			error: `snapshot "forget" operation cannot specify an encryption key`,
+		}, {
+			body:  `{"set": 42, "action": "check", "encryption-key": "00"}`,
+			error: `invalid snapshot encryption key: must be 32 hex-encoded bytes`,
 		},
 	}
 
@@ -321,3 +354,302 @@ func (s *snapshotSuite) TestChangeSnapshot(c *check.C) {
 
 	}
 }
+
+func (s *snapshotSuite) TestChangeSnapshotEncryptionKey(c *check.C) {
+	defer daemon.MockSnapshotRestore(func(st *state.State, setID uint64, snaps, users []string) ([]string, *state.TaskSet, error) {
+		t := st.NewTask("restore-snapshot", "...")
+		t.Set("snapshot-setup", map[string]interface{}{"set-id": setID, "snap": "foo"})
+		return []string{"foo"}, state.NewTaskSet(t), nil
+	})()
+
+	body := fmt.Sprintf(`{"set": 42, "action": "restore", "encryption-key": "%s"}`, strings.Repeat("ab", 32))
+	req, err := http.NewRequest("POST", "/v2/snapshots", strings.NewReader(body))
+	c.Assert(err, check.IsNil)
+
+	rsp := daemon.ChangeSnapshots(daemon.SnapshotCmd, req, nil)
+	c.Assert(rsp.Type, check.Equals, daemon.ResponseTypeAsync)
+
+	st := s.o.State()
+	st.Lock()
+	defer st.Unlock()
+	chg := st.Change(rsp.Change)
+	c.Assert(chg, check.NotNil)
+	// the key is not in the summary, nor in the state
+	c.Check(chg.Summary(), check.Equals, "Restore of snapshot set #42")
+	c.Assert(chg.Tasks(), check.HasLen, 1)
+	var snapshot map[string]interface{}
+	c.Assert(chg.Tasks()[0].Get("snapshot-setup", &snapshot), check.IsNil)
+	c.Check(snapshot, check.DeepEquals, map[string]interface{}{
+		"set-id":               42.,
+		"snap":                 "foo",
+		"current":              "unset",
+		"encryption-key-given": true,
+	})
+}
+
+func (s *snapshotSuite) TestChangeSnapshotRestoreFiles(c *check.C) {
+	defer daemon.MockSnapshotUcrednetGet(func(string) (int32, uint32, string, error) {
+		return 100, 0, "", nil
+	})()
+	defer daemon.MockSnapshotRestore(func(*state.State, uint64, []string, []string) ([]string, *state.TaskSet, error) {
+		c.Fatal("unexpected call to snapshotstate.Restore")
+		return nil, nil, nil
+	})()
+	defer daemon.MockSnapshotRestoreFiles(func(_ *state.State, setID uint64, snaps []string, users []string, paths []string, target string) ([]string, *state.TaskSet, error) {
+		c.Check(setID, check.Equals, uint64(42))
+		c.Check(snaps, check.DeepEquals, []string{"foo"})
+		c.Check(users, check.DeepEquals, []string{"bar"})
+		c.Check(paths, check.DeepEquals, []string{"42/*"})
+		c.Check(target, check.Equals, "/tmp/restored")
+		return []string{"foo"}, state.NewTaskSet(), nil
+	})()
+
+	body := `{"set": 42, "action": "restore", "snaps": ["foo"], "users": ["bar"], "paths": ["42/*"], "target": "/tmp/restored"}`
+	req, err := http.NewRequest("POST", "/v2/snapshots", strings.NewReader(body))
+	c.Assert(err, check.IsNil)
+
+	rsp := daemon.ChangeSnapshots(daemon.SnapshotCmd, req, nil)
+	c.Check(rsp.Type, check.Equals, daemon.ResponseTypeAsync)
+	c.Check(rsp.Status, check.Equals, 202)
+
+	st := s.o.State()
+	st.Lock()
+	defer st.Unlock()
+	chg := st.Change(rsp.Change)
+	c.Assert(chg, check.NotNil)
+	c.Check(chg.Kind(), check.Equals, "restore-snapshot-files")
+	c.Check(chg.Summary(), check.Equals, `Restore of snapshot set #42 for snaps "foo" for users "bar" paths "42/*" into "/tmp/restored"`)
+}
+
+func (s *snapshotSuite) TestChangeSnapshotRestoreFilesErrors(c *check.C) {
+	var uid uint32
+	defer daemon.MockSnapshotUcrednetGet(func(string) (int32, uint32, string, error) {
+		return 100, uid, "", nil
+	})()
+	defer daemon.MockSnapshotRestoreFiles(func(*state.State, uint64, []string, []string, []string, string) ([]string, *state.TaskSet, error) {
+		c.Fatal("unexpected call to snapshotstate.RestoreFiles")
+		return nil, nil, nil
+	})()
+
+	for i, t := range []struct {
+		uid    uint32
+		body   string
+		status int
+		error  string
+	}{
+		{1000, `{"set": 42, "action": "restore", "paths": ["42"], "target": "/tmp"}`, 403, `cannot restore snapshot files as non-root`},
+		{0, `{"set": 42, "action": "check", "paths": ["42"], "target": "/tmp"}`, 400, `snapshot "check" operation cannot specify paths or target`},
+		{0, `{"set": 42, "action": "restore", "target": "/tmp"}`, 400, `snapshot restore into a target requires paths`},
+		{0, `{"set": 42, "action": "restore", "paths": ["42"]}`, 400, `snapshot restore of paths requires a target`},
+		{0, `{"set": 42, "action": "restore", "paths": ["/42"], "target": "/tmp"}`, 400, `invalid path pattern "/42": must be a relative path`},
+		{0, `{"set": 42, "action": "restore", "paths": ["42"], "target": "tmp"}`, 400, `snapshot restore target must be an absolute path; got "tmp"`},
+	} {
+		comm := check.Commentf("%d:%q", i, t.body)
+		uid = t.uid
+		req, err := http.NewRequest("POST", "/v2/snapshots", strings.NewReader(t.body))
+		c.Assert(err, check.IsNil, comm)
+
+		rsp := daemon.ChangeSnapshots(daemon.SnapshotCmd, req, nil)
+		c.Check(rsp.Type, check.Equals, daemon.ResponseTypeError, comm)
+		c.Check(rsp.Status, check.Equals, t.status, comm)
+		c.Check(rsp.ErrorResult().Message, check.Equals, t.error, comm)
+	}
+}
+
+func (s *snapshotSuite) TestSnapshotFiles(c *check.C) {
+	defer daemon.MockSnapshotFiles(func(_ context.Context, _ *state.State, setID uint64, snap string, users []string, key []byte) ([]client.SnapshotFile, error) {
+		c.Check(setID, check.Equals, uint64(42))
+		c.Check(snap, check.Equals, "foo")
+		c.Check(users, check.DeepEquals, []string{"bar", "baz"})
+		c.Check(key, check.DeepEquals, bytes.Repeat([]byte{0xab}, 32))
+		return []client.SnapshotFile{{Path: "42/canary", Size: 3, SetID: 41}}, nil
+	})()
+	defer daemon.MockMuxVars(func(*http.Request) map[string]string {
+		return map[string]string{"id": "42", "snap": "foo"}
+	})()
+
+	c.Check(daemon.SnapshotFilesCmd.Path, check.Equals, "/v2/snapshots/{id}/{snap}/files")
+	req, err := http.NewRequest("GET", "/v2/snapshots/42/foo/files?users=bar,baz", nil)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("X-Snapshot-Encryption-Key", strings.Repeat("ab", 32))
+
+	rsp := daemon.GetSnapshotFiles(daemon.SnapshotFilesCmd, req, nil)
+	c.Check(rsp.Type, check.Equals, daemon.ResponseTypeSync)
+	c.Check(rsp.Status, check.Equals, 200)
+	c.Check(rsp.Result, check.DeepEquals, []client.SnapshotFile{{Path: "42/canary", Size: 3, SetID: 41}})
+}
+
+func (s *snapshotSuite) TestSnapshotFilesErrors(c *check.C) {
+	var filesErr error
+	defer daemon.MockSnapshotFiles(func(context.Context, *state.State, uint64, string, []string, []byte) ([]client.SnapshotFile, error) {
+		return nil, filesErr
+	})()
+	var id string
+	defer daemon.MockMuxVars(func(*http.Request) map[string]string {
+		return map[string]string{"id": id, "snap": "foo"}
+	})()
+
+	for _, t := range []struct {
+		id     string
+		key    string
+		err    error
+		status int
+		msg    string
+	}{
+		{"foo", "", nil, 400, `'id' must be a positive base 10 number; got "foo"`},
+		{"42", "00", nil, 400, `invalid snapshot encryption key: must be 32 hex-encoded bytes`},
+		{"42", "", client.ErrSnapshotSetNotFound, 404, `no snapshot set with the given ID`},
+		{"42", "", client.ErrSnapshotSnapsNotFound, 404, `no snapshot for the requested snaps found in the set with the given ID`},
+		{"42", "", errors.New("bzzt"), 500, `bzzt`},
+	} {
+		id = t.id
+		filesErr = t.err
+		req, err := http.NewRequest("GET", "/v2/snapshots/"+id+"/foo/files", nil)
+		c.Assert(err, check.IsNil)
+		if t.key != "" {
+			req.Header.Set("X-Snapshot-Encryption-Key", t.key)
+		}
+
+		rsp := daemon.GetSnapshotFiles(daemon.SnapshotFilesCmd, req, nil)
+		c.Check(rsp.Type, check.Equals, daemon.ResponseTypeError)
+		c.Check(rsp.Status, check.Equals, t.status)
+		c.Check(rsp.ErrorResult().Message, check.Equals, t.msg)
+	}
+}
+
+func (s *snapshotSuite) TestSnapshotExport(c *check.C) {
+	var exportedID uint64
+	defer daemon.MockSnapshotExport(func(_ context.Context, st *state.State, setID uint64) (*backend.SnapshotExport, error) {
+		exportedID = setID
+		return &backend.SnapshotExport{}, nil
+	})()
+	defer daemon.MockMuxVars(func(*http.Request) map[string]string {
+		return map[string]string{"id": "42"}
+	})()
+
+	c.Check(daemon.SnapshotExportCmd.Path, check.Equals, "/v2/snapshots/{id}/export")
+	req, err := http.NewRequest("GET", "/v2/snapshots/42/export", nil)
+	c.Assert(err, check.IsNil)
+
+	rsp := daemon.GetSnapshotExport(daemon.SnapshotExportCmd, req, nil)
+	c.Check(exportedID, check.Equals, uint64(42))
+
+	rec := httptest.NewRecorder()
+	rsp.ServeHTTP(rec, req)
+	c.Check(rec.Code, check.Equals, 200)
+	c.Check(rec.HeaderMap.Get("Content-Type"), check.Equals, client.SnapshotExportMediaType)
+	c.Check(rec.HeaderMap.Get("Content-Disposition"), check.Equals, "attachment; filename=snapshot-42.snapshot")
+
+	// an empty export is just the manifest
+	tr := tar.NewReader(rec.Body)
+	hdr, err := tr.Next()
+	c.Assert(err, check.IsNil)
+	c.Check(hdr.Name, check.Equals, "export.json")
+	_, err = tr.Next()
+	c.Check(err, check.Equals, io.EOF)
+}
+
+func (s *snapshotSuite) TestSnapshotExportErrors(c *check.C) {
+	var exportErr error
+	defer daemon.MockSnapshotExport(func(context.Context, *state.State, uint64) (*backend.SnapshotExport, error) {
+		return nil, exportErr
+	})()
+	var id string
+	defer daemon.MockMuxVars(func(*http.Request) map[string]string {
+		return map[string]string{"id": id}
+	})()
+
+	for _, t := range []struct {
+		id     string
+		err    error
+		status int
+		msg    string
+	}{
+		{"foo", nil, 400, `'id' must be a positive base 10 number; got "foo"`},
+		{"42", client.ErrSnapshotSetNotFound, 404, `no snapshot set with the given ID`},
+		{"42", &snapstate.ChangeConflictError{Message: `cannot operate on snapshot set #42 while change "1" is in progress`, ChangeKind: "forget-snapshot"}, 409, `cannot operate on snapshot set #42 while change "1" is in progress`},
+		{"42", &backend.CannotExportError{Err: errors.New(`cannot export snapshot "foo": it is incremental on snapshot set #41`)}, 400, `cannot export snapshot "foo": it is incremental on snapshot set #41`},
+		{"42", &backend.CannotExportError{Err: errors.New(`cannot export snapshot "foo": invalid snapshot`)}, 400, `cannot export snapshot "foo": invalid snapshot`},
+		{"42", errors.New("bzzt"), 500, `bzzt`},
+	} {
+		id = t.id
+		exportErr = t.err
+		req, err := http.NewRequest("GET", "/v2/snapshots/"+id+"/export", nil)
+		c.Assert(err, check.IsNil)
+
+		rsp := daemon.GetSnapshotExport(daemon.SnapshotExportCmd, req, nil).(*daemon.Resp)
+		c.Check(rsp.Type, check.Equals, daemon.ResponseTypeError)
+		c.Check(rsp.Status, check.Equals, t.status)
+		c.Check(rsp.ErrorResult().Message, check.Equals, t.msg)
+	}
+}
+
+func (s *snapshotSuite) TestSnapshotImport(c *check.C) {
+	defer daemon.MockSnapshotImport(func(_ context.Context, st *state.State, r io.Reader) (uint64, []string, error) {
+		data, err := ioutil.ReadAll(r)
+		c.Assert(err, check.IsNil)
+		c.Check(string(data), check.Equals, "exported snapshot set")
+		return 7, []string{"foo", "bar"}, nil
+	})()
+
+	req, err := http.NewRequest("POST", "/v2/snapshots?action=import", strings.NewReader("exported snapshot set"))
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", client.SnapshotExportMediaType)
+
+	rsp := daemon.ChangeSnapshots(daemon.SnapshotCmd, req, nil)
+	c.Check(rsp.Type, check.Equals, daemon.ResponseTypeSync)
+	c.Check(rsp.Status, check.Equals, 200)
+	c.Check(rsp.Result, check.DeepEquals, &client.SnapshotImportSet{ID: 7, Snaps: []string{"foo", "bar"}})
+}
+
+func (s *snapshotSuite) TestSnapshotImportBadRequest(c *check.C) {
+	defer daemon.MockSnapshotImport(func(context.Context, *state.State, io.Reader) (uint64, []string, error) {
+		c.Fatal("unexpected call to snapshotImport")
+		return 0, nil, nil
+	})()
+
+	for _, t := range []struct {
+		query       string
+		contentType string
+		msg         string
+	}{
+		{"?action=import", "", `snapshot import requires a body of type "application/x.snapd.snapshot"`},
+		{"?action=import", "application/json", `snapshot import requires a body of type "application/x.snapd.snapshot"`},
+		{"", client.SnapshotExportMediaType, `snapshot export sent without the "import" action`},
+	} {
+		req, err := http.NewRequest("POST", "/v2/snapshots"+t.query, strings.NewReader("exported snapshot set"))
+		c.Assert(err, check.IsNil)
+		req.Header.Set("Content-Type", t.contentType)
+
+		rsp := daemon.ChangeSnapshots(daemon.SnapshotCmd, req, nil)
+		c.Check(rsp.Type, check.Equals, daemon.ResponseTypeError)
+		c.Check(rsp.Status, check.Equals, 400)
+		c.Check(rsp.ErrorResult().Message, check.Equals, t.msg)
+	}
+}
+
+func (s *snapshotSuite) TestSnapshotImportError(c *check.C) {
+	var importErr error
+	defer daemon.MockSnapshotImport(func(context.Context, *state.State, io.Reader) (uint64, []string, error) {
+		return 0, nil, importErr
+	})()
+
+	for _, t := range []struct {
+		err    error
+		status int
+	}{
+		{&backend.InvalidExportError{Err: errors.New("cannot import snapshot set: missing export.json")}, 400},
+		{errors.New("cannot import snapshot set: no space left on device"), 500},
+	} {
+		importErr = t.err
+
+		req, err := http.NewRequest("POST", "/v2/snapshots?action=import", strings.NewReader(""))
+		c.Assert(err, check.IsNil)
+		req.Header.Set("Content-Type", client.SnapshotExportMediaType)
+
+		rsp := daemon.ChangeSnapshots(daemon.SnapshotCmd, req, nil)
+		c.Check(rsp.Type, check.Equals, daemon.ResponseTypeError)
+		c.Check(rsp.Status, check.Equals, t.status)
+		c.Check(rsp.ErrorResult().Message, check.Equals, t.err.Error())
+	}
+}
@@ -42,6 +42,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/gorilla/mux"
 	"golang.org/x/crypto/sha3"
 
 	"gopkg.in/check.v1"
@@ -61,12 +62,15 @@ import (
 	"github.com/snapcore/snapd/overlord"
 	"github.com/snapcore/snapd/overlord/assertstate"
 	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/changejournal"
 	"github.com/snapcore/snapd/overlord/configstate/config"
 	"github.com/snapcore/snapd/overlord/devicestate"
+	"github.com/snapcore/snapd/overlord/healthstate"
 	"github.com/snapcore/snapd/overlord/hookstate"
 	"github.com/snapcore/snapd/overlord/hookstate/ctlcmd"
 	"github.com/snapcore/snapd/overlord/ifacestate"
 	"github.com/snapcore/snapd/overlord/servicestate"
+	"github.com/snapcore/snapd/overlord/snapshotstate"
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/release"
@@ -213,7 +217,7 @@ func (s *apiBaseSuite) SetUpSuite(c *check.C) {
 }
 
 func (s *apiBaseSuite) TearDownSuite(c *check.C) {
-	muxVars = nil
+	muxVars = mux.Vars
 	s.restoreRelease()
 	s.systemctlRestorer()
 	s.journalctlRestorer()
@@ -291,12 +295,16 @@ func (s *apiBaseSuite) SetUpTest(c *check.C) {
 	snapstateInstallMany = nil
 	snapstateInstallPath = nil
 	snapstateRefreshCandidates = nil
+	snapstateRemove = nil
 	snapstateRemoveMany = nil
 	snapstateRevert = nil
 	snapstateRevertToRevision = nil
+	snapstateRollback = nil
 	snapstateTryPath = nil
 	snapstateUpdate = nil
 	snapstateUpdateMany = nil
+	snapstateHoldRefreshes = nil
+	snapstateUnholdRefreshes = nil
 
 	devicestateRemodel = nil
 }
@@ -314,12 +322,16 @@ func (s *apiBaseSuite) TearDownTest(c *check.C) {
 	snapstateInstallMany = snapstate.InstallMany
 	snapstateInstallPath = snapstate.InstallPath
 	snapstateRefreshCandidates = snapstate.RefreshCandidates
+	snapstateRemove = snapstate.Remove
 	snapstateRemoveMany = snapstate.RemoveMany
 	snapstateRevert = snapstate.Revert
 	snapstateRevertToRevision = snapstate.RevertToRevision
+	snapstateRollback = snapstate.Rollback
 	snapstateTryPath = snapstate.TryPath
 	snapstateUpdate = snapstate.Update
 	snapstateUpdateMany = snapstate.UpdateMany
+	snapstateHoldRefreshes = snapstate.HoldRefreshes
+	snapstateUnholdRefreshes = snapstate.UnholdRefreshes
 }
 
 func makeMockModelHdrs() map[string]interface{} {
@@ -1646,6 +1658,51 @@ func (s *apiSuite) TestSnapsInfoOnlyLocal(c *check.C) {
 	c.Assert(snaps[0]["name"], check.Equals, "local")
 }
 
+func (s *apiSuite) TestSnapsInfoHealth(c *check.C) {
+	d := s.daemon(c)
+
+	s.mkInstalledInState(c, d, "local", "foo", "v1", snap.R(10), true, "")
+	s.mkInstalledInState(c, d, "other", "foo", "v1", snap.R(3), true, "")
+
+	st := d.overlord.State()
+	st.Lock()
+	t0 := time.Date(2019, 5, 1, 10, 0, 0, 0, time.UTC)
+	c.Assert(healthstate.Set(st, "local", &healthstate.HealthState{
+		Revision:  snap.R(10),
+		Timestamp: t0,
+		Status:    healthstate.BlockedStatus,
+		Message:   "waiting for the network",
+		Code:      "no-network",
+	}), check.IsNil)
+	// health reported by another revision is not shown
+	c.Assert(healthstate.Set(st, "other", &healthstate.HealthState{
+		Revision:  snap.R(2),
+		Timestamp: t0,
+		Status:    healthstate.OkayStatus,
+	}), check.IsNil)
+	st.Unlock()
+
+	req, err := http.NewRequest("GET", "/v2/snaps", nil)
+	c.Assert(err, check.IsNil)
+	rsp := getSnapsInfo(snapsCmd, req, nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeSync)
+
+	snaps := snapList(rsp.Result)
+	c.Assert(snaps, check.HasLen, 2)
+	byName := make(map[string]map[string]interface{})
+	for _, snap := range snaps {
+		byName[snap["name"].(string)] = snap
+	}
+	c.Check(byName["local"]["health"], check.DeepEquals, map[string]interface{}{
+		"revision":  "10",
+		"timestamp": "2019-05-01T10:00:00Z",
+		"status":    "blocked",
+		"message":   "waiting for the network",
+		"code":      "no-network",
+	})
+	c.Check(byName["other"]["health"], check.IsNil)
+}
+
 func (s *apiSuite) TestSnapsInfoAllMixedPublishers(c *check.C) {
 	d := s.daemon(c)
 
@@ -2404,6 +2461,178 @@ func (s *apiSuite) TestPostSnap(c *check.C) {
 	c.Check(soon, check.Equals, 1)
 }
 
+// futureWindow returns a schedule whose window opens in two days.
+func futureWindow() (schedule string, start time.Time) {
+	day := time.Now().AddDate(0, 0, 2)
+	start = time.Date(day.Year(), day.Month(), day.Day(), 10, 0, 0, 0, time.Local)
+	weekday := strings.ToLower(day.Weekday().String()[:3])
+	return weekday + ",10:00-11:00", start
+}
+
+func (s *apiSuite) TestPostSnapScheduled(c *check.C) {
+	d := s.daemonWithOverlordMock(c)
+	ensureStateSoon = func(st *state.State) {}
+
+	s.vars = map[string]string{"name": "foo"}
+
+	snapInstructionDispTable["refresh"] = func(inst *snapInstruction, st *state.State) (string, []*state.TaskSet, error) {
+		t1 := st.NewTask("fake-download", "...")
+		t2 := st.NewTask("fake-link", "...")
+		t2.WaitFor(t1)
+		return "Refresh foo", []*state.TaskSet{state.NewTaskSet(t1, t2)}, nil
+	}
+	defer func() {
+		snapInstructionDispTable["refresh"] = snapUpdate
+	}()
+
+	schedule, start := futureWindow()
+	buf := bytes.NewBufferString(fmt.Sprintf(`{"action": "refresh", "schedule": %q}`, schedule))
+	req, err := http.NewRequest("POST", "/v2/snaps/foo", buf)
+	c.Assert(err, check.IsNil)
+
+	rsp := postSnap(snapCmd, req, nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeAsync)
+
+	st := d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+	chg := st.Change(rsp.Change)
+	c.Assert(chg, check.NotNil)
+
+	var scheduled time.Time
+	c.Assert(chg.Get("scheduled-time", &scheduled), check.IsNil)
+	c.Check(scheduled.Equal(start), check.Equals, true)
+
+	tasks := chg.Tasks()
+	c.Assert(tasks, check.HasLen, 2)
+	c.Check(tasks[0].AtTime().Equal(scheduled), check.Equals, true)
+	c.Check(tasks[1].AtTime().IsZero(), check.Equals, true)
+
+	info := change2changeInfo(chg)
+	c.Assert(info.ScheduledTime, check.NotNil)
+	c.Check(info.ScheduledTime.Equal(scheduled), check.Equals, true)
+}
+
+func (s *apiSuite) TestPostSnapScheduledWindowOpen(c *check.C) {
+	d := s.daemonWithOverlordMock(c)
+	ensureStateSoon = func(st *state.State) {}
+
+	s.vars = map[string]string{"name": "foo"}
+
+	snapInstructionDispTable["install"] = func(inst *snapInstruction, st *state.State) (string, []*state.TaskSet, error) {
+		return "Install foo", []*state.TaskSet{state.NewTaskSet(st.NewTask("fake-install", "..."))}, nil
+	}
+	defer func() {
+		snapInstructionDispTable["install"] = snapInstall
+	}()
+
+	buf := bytes.NewBufferString(`{"action": "install", "schedule": "00:00-24:00"}`)
+	req, err := http.NewRequest("POST", "/v2/snaps/foo", buf)
+	c.Assert(err, check.IsNil)
+
+	rsp := postSnap(snapCmd, req, nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeAsync)
+
+	st := d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+	chg := st.Change(rsp.Change)
+	c.Assert(chg, check.NotNil)
+	var scheduled time.Time
+	c.Check(chg.Get("scheduled-time", &scheduled), check.Equals, state.ErrNoState)
+	c.Check(chg.Tasks()[0].AtTime().IsZero(), check.Equals, true)
+	c.Check(change2changeInfo(chg).ScheduledTime, check.IsNil)
+}
+
+func (s *apiSuite) TestPostSnapScheduleErrors(c *check.C) {
+	s.daemonWithOverlordMock(c)
+	s.vars = map[string]string{"name": "foo"}
+
+	for _, t := range []struct {
+		body string
+		err  string
+	}{
+		{`{"action": "refresh", "schedule": "bogus"}`, `cannot parse schedule "bogus": .*`},
+		{`{"action": "enable", "schedule": "10:00-11:00"}`, `cannot schedule enable`},
+	} {
+		req, err := http.NewRequest("POST", "/v2/snaps/foo", bytes.NewBufferString(t.body))
+		c.Assert(err, check.IsNil)
+		rsp := postSnap(snapCmd, req, nil).(*resp)
+		c.Check(rsp.Status, check.Equals, 400, check.Commentf(t.body))
+		c.Check(rsp.Result.(*errorResult).Message, check.Matches, t.err)
+	}
+}
+
+func (s *apiSuite) TestPostSnapScheduleTooLate(c *check.C) {
+	s.daemonWithOverlordMock(c)
+	s.vars = map[string]string{"name": "foo"}
+	old := maxScheduleDelay
+	maxScheduleDelay = 24 * time.Hour
+	defer func() { maxScheduleDelay = old }()
+
+	// the window is two days out
+	schedule, start := futureWindow()
+	buf := bytes.NewBufferString(fmt.Sprintf(`{"action": "refresh", "schedule": %q}`, schedule))
+	req, err := http.NewRequest("POST", "/v2/snaps/foo", buf)
+	c.Assert(err, check.IsNil)
+	rsp := postSnap(snapCmd, req, nil).(*resp)
+	c.Check(rsp.Status, check.Equals, 400)
+	c.Check(rsp.Result.(*errorResult).Message, check.Matches, fmt.Sprintf(`cannot schedule %q: its next window opens at %s, after the latest possible start at .*`, schedule, regexp.QuoteMeta(start.Format(time.RFC3339))))
+}
+
+func (s *apiSuite) TestPostSnapsOpScheduled(c *check.C) {
+	assertstateRefreshSnapDeclarations = func(*state.State, int) error { return nil }
+	snapstateUpdateMany = func(_ context.Context, s *state.State, names []string, userID int, flags *snapstate.Flags) ([]string, []*state.TaskSet, error) {
+		t := s.NewTask("fake-refresh-all", "Refreshing everything")
+		return []string{"fake1", "fake2"}, []*state.TaskSet{state.NewTaskSet(t)}, nil
+	}
+
+	d := s.daemonWithOverlordMock(c)
+
+	schedule, start := futureWindow()
+	buf := bytes.NewBufferString(fmt.Sprintf(`{"action": "refresh", "schedule": %q}`, schedule))
+	req, err := http.NewRequest("POST", "/v2/snaps", buf)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "application/json")
+
+	rsp := postSnaps(snapsCmd, req, nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeAsync)
+
+	st := d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+	chg := st.Change(rsp.Change)
+	var scheduled time.Time
+	c.Assert(chg.Get("scheduled-time", &scheduled), check.IsNil)
+	c.Check(scheduled.Equal(start), check.Equals, true)
+	c.Check(chg.Tasks()[0].AtTime().Equal(scheduled), check.Equals, true)
+}
+
+func (s *apiSuite) TestStateChangeAbortScheduled(c *check.C) {
+	ensureStateSoon = func(st *state.State) {}
+
+	d := s.daemonWithOverlordMock(c)
+	st := d.overlord.State()
+	st.Lock()
+	chg := st.NewChange("refresh-snap", "...")
+	t := st.NewTask("fake-refresh", "...")
+	chg.AddTask(t)
+	scheduleChange(chg, time.Now().Add(24*time.Hour))
+	st.Unlock()
+	s.vars = map[string]string{"id": chg.ID()}
+
+	buf := bytes.NewBufferString(`{"action": "abort"}`)
+	req, err := http.NewRequest("POST", "/v2/changes/"+chg.ID(), buf)
+	c.Assert(err, check.IsNil)
+	rsp := postChange(stateChangeCmd, req, nil).(*resp)
+	c.Check(rsp.Status, check.Equals, 200)
+
+	st.Lock()
+	defer st.Unlock()
+	c.Check(chg.Status(), check.Equals, state.HoldStatus)
+	c.Check(chg.IsReady(), check.Equals, true)
+}
+
 func (s *apiSuite) TestPostSnapVerfySnapInstruction(c *check.C) {
 	s.daemonWithOverlordMock(c)
 
@@ -3841,6 +4070,102 @@ func (s *apiSuite) TestRemoveMany(c *check.C) {
 	c.Check(res.Affected, check.DeepEquals, inst.Snaps)
 }
 
+func (s *apiSuite) TestHoldMany(c *check.C) {
+	var heldSnaps []string
+	var heldUntil time.Time
+	snapstateHoldRefreshes = func(s *state.State, names []string, until time.Time) error {
+		heldSnaps = names
+		heldUntil = until
+		return nil
+	}
+
+	d := s.daemon(c)
+	st := d.overlord.State()
+
+	until := time.Date(2019, 4, 1, 10, 0, 0, 0, time.UTC)
+	for _, tst := range []struct {
+		snaps []string
+		until time.Time
+		msg   string
+	}{
+		{[]string{"foo"}, time.Time{}, `Hold auto-refreshes of snap "foo"`},
+		{[]string{"foo"}, until, `Hold auto-refreshes of snap "foo" until 2019-04-01T10:00:00Z`},
+		{[]string{"foo", "bar"}, time.Time{}, `Hold auto-refreshes of snaps "foo", "bar"`},
+		{[]string{"foo", "bar"}, until, `Hold auto-refreshes of snaps "foo", "bar" until 2019-04-01T10:00:00Z`},
+	} {
+		inst := &snapInstruction{Action: "hold", Snaps: tst.snaps, HoldUntil: tst.until}
+		st.Lock()
+		res, err := snapHoldMany(inst, st)
+		st.Unlock()
+		c.Assert(err, check.IsNil)
+		c.Check(res.Summary, check.Equals, tst.msg)
+		c.Check(res.Affected, check.DeepEquals, tst.snaps)
+		c.Check(res.Tasksets, check.HasLen, 0)
+		c.Check(heldSnaps, check.DeepEquals, tst.snaps)
+		c.Check(heldUntil.Equal(tst.until), check.Equals, true)
+	}
+}
+
+func (s *apiSuite) TestHoldManyNoSnaps(c *check.C) {
+	snapstateHoldRefreshes = func(*state.State, []string, time.Time) error {
+		return errors.New("should not be called")
+	}
+
+	d := s.daemon(c)
+	inst := &snapInstruction{Action: "hold"}
+	st := d.overlord.State()
+	st.Lock()
+	res, err := snapHoldMany(inst, st)
+	st.Unlock()
+	c.Assert(res, check.IsNil)
+	c.Check(err, check.ErrorMatches, "cannot hold refreshes of zero snaps")
+}
+
+func (s *apiSuite) TestUnholdMany(c *check.C) {
+	var unheldSnaps []string
+	snapstateUnholdRefreshes = func(s *state.State, names []string) error {
+		unheldSnaps = names
+		return nil
+	}
+
+	d := s.daemon(c)
+	inst := &snapInstruction{Action: "unhold", Snaps: []string{"foo", "bar"}}
+	st := d.overlord.State()
+	st.Lock()
+	res, err := snapUnholdMany(inst, st)
+	st.Unlock()
+	c.Assert(err, check.IsNil)
+	c.Check(res.Summary, check.Equals, `Remove auto-refresh holds of snaps "foo", "bar"`)
+	c.Check(res.Affected, check.DeepEquals, inst.Snaps)
+	c.Check(unheldSnaps, check.DeepEquals, inst.Snaps)
+}
+
+func (s *apiSuite) TestPostSnapsOpHold(c *check.C) {
+	snapstateHoldRefreshes = func(s *state.State, names []string, until time.Time) error {
+		c.Check(names, check.DeepEquals, []string{"foo"})
+		c.Check(until.Equal(time.Date(2019, 4, 1, 10, 0, 0, 0, time.UTC)), check.Equals, true)
+		return nil
+	}
+
+	d := s.daemonWithOverlordMock(c)
+
+	buf := bytes.NewBufferString(`{"action": "hold", "snaps": ["foo"], "hold-until": "2019-04-01T10:00:00Z"}`)
+	req, err := http.NewRequest("POST", "/v2/snaps", buf)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "application/json")
+
+	rsp, ok := postSnaps(snapsCmd, req, nil).(*resp)
+	c.Assert(ok, check.Equals, true)
+	c.Check(rsp.Type, check.Equals, ResponseTypeAsync)
+
+	st := d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+	chg := st.Change(rsp.Change)
+	c.Check(chg.Summary(), check.Equals, `Hold auto-refreshes of snap "foo" until 2019-04-01T10:00:00Z`)
+	c.Check(chg.Status(), check.Equals, state.DoneStatus)
+}
+
 func (s *apiSuite) TestInstallFails(c *check.C) {
 	snapstateInstall = func(s *state.State, name, channel string, revision snap.Revision, userID int, flags snapstate.Flags) (*state.TaskSet, error) {
 		t := s.NewTask("fake-install-snap-error", "Install task")
@@ -4029,6 +4354,104 @@ func (s *apiSuite) TestInstallJailModeDevMode(c *check.C) {
 	c.Check(err, check.ErrorMatches, "cannot use devmode and jailmode flags together")
 }
 
+func (s *apiSuite) testRemoveSnap(inst *snapInstruction, c *check.C) {
+	var removeFlags *snapstate.RemoveFlags
+	snapstateRemove = func(s *state.State, name string, rev snap.Revision, flags *snapstate.RemoveFlags) (*state.TaskSet, error) {
+		c.Check(name, check.Equals, "some-snap")
+		c.Check(rev, check.Equals, inst.Revision)
+		removeFlags = flags
+		return state.NewTaskSet(), nil
+	}
+
+	d := s.daemon(c)
+	inst.Action = "remove"
+	inst.Snaps = []string{"some-snap"}
+
+	st := d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+	summary, _, err := inst.dispatch()(inst, st)
+	c.Check(err, check.IsNil)
+	c.Check(summary, check.Equals, `Remove "some-snap" snap`)
+	c.Check(removeFlags, check.DeepEquals, &snapstate.RemoveFlags{Purge: inst.Purge})
+}
+
+func (s *apiSuite) TestRemoveSnap(c *check.C) {
+	s.testRemoveSnap(&snapInstruction{}, c)
+}
+
+func (s *apiSuite) TestRemoveSnapRevision(c *check.C) {
+	s.testRemoveSnap(&snapInstruction{Revision: snap.R(7)}, c)
+}
+
+func (s *apiSuite) TestRemoveSnapPurge(c *check.C) {
+	s.testRemoveSnap(&snapInstruction{Purge: true}, c)
+}
+
+func (s *apiSuite) TestPostSnapsOpPurgeUnsupported(c *check.C) {
+	s.daemonWithOverlordMock(c)
+
+	buf := bytes.NewBufferString(`{"action": "remove", "snaps": ["foo", "bar"], "purge": true}`)
+	req, err := http.NewRequest("POST", "/v2/snaps", buf)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "application/json")
+
+	rsp := postSnaps(snapsCmd, req, nil).(*resp)
+	c.Check(rsp.Status, check.Equals, 400)
+	c.Check(rsp.Result.(*errorResult).Message, check.Equals, "unsupported option provided for multi-snap operation")
+}
+
+func (s *apiSuite) TestPostSnapsOpSnapshotOptionsUnsupported(c *check.C) {
+	s.daemonWithOverlordMock(c)
+
+	for _, body := range []string{
+		`{"action": "refresh", "snaps": ["foo", "bar"], "compression": "none"}`,
+		`{"action": "refresh", "snaps": ["foo", "bar"], "base-set-id": 42}`,
+		`{"action": "refresh", "snaps": ["foo", "bar"], "encryption-key": "00"}`,
+	} {
+		buf := bytes.NewBufferString(body)
+		req, err := http.NewRequest("POST", "/v2/snaps", buf)
+		c.Assert(err, check.IsNil)
+		req.Header.Set("Content-Type", "application/json")
+
+		rsp := postSnaps(snapsCmd, req, nil).(*resp)
+		c.Check(rsp.Status, check.Equals, 400, check.Commentf(body))
+		c.Check(rsp.Result.(*errorResult).Message, check.Equals, "unsupported option provided for multi-snap operation")
+	}
+}
+
+func (s *apiSuite) TestPostSnapsOpSnapshotEncryptionKey(c *check.C) {
+	var key []byte
+	snapshotSave = func(st *state.State, snaps, users []string, flags *snapshotstate.SaveFlags) (uint64, []string, *state.TaskSet, error) {
+		key = flags.EncryptionKey
+		return 1, snaps, state.NewTaskSet(st.NewTask("fake-snapshot", "...")), nil
+	}
+	defer func() { snapshotSave = snapshotstate.Save }()
+
+	s.daemonWithOverlordMock(c)
+
+	for _, t := range []struct {
+		key    string
+		status int
+	}{
+		{"not-hex", 400},
+		{"00", 400},
+		{strings.Repeat("ab", 32), 202},
+	} {
+		buf := bytes.NewBufferString(fmt.Sprintf(`{"action": "snapshot", "snaps": ["foo"], "encryption-key": %q}`, t.key))
+		req, err := http.NewRequest("POST", "/v2/snaps", buf)
+		c.Assert(err, check.IsNil)
+		req.Header.Set("Content-Type", "application/json")
+
+		rsp := postSnaps(snapsCmd, req, nil).(*resp)
+		c.Assert(rsp.Status, check.Equals, t.status, check.Commentf(t.key))
+		if t.status == 400 {
+			c.Check(rsp.Result.(*errorResult).Message, check.Equals, "invalid snapshot encryption key: must be 32 hex-encoded bytes")
+		}
+	}
+	c.Check(key, check.DeepEquals, bytes.Repeat([]byte{0xab}, 32))
+}
+
 func (s *apiSuite) testRevertSnap(inst *snapInstruction, c *check.C) {
 	queue := []string{}
 
@@ -4361,6 +4784,65 @@ func (s *apiSuite) TestConnectPlugSuccess(c *check.C) {
 	}})
 }
 
+func (s *apiSuite) TestConnectPlugScheduled(c *check.C) {
+	restore := builtin.MockInterface(&ifacetest.TestInterface{InterfaceName: "test"})
+	defer restore()
+
+	d := s.daemon(c)
+
+	s.mockSnap(c, consumerYaml)
+	s.mockSnap(c, producerYaml)
+
+	d.overlord.Loop()
+	defer d.overlord.Stop()
+
+	schedule, start := futureWindow()
+	action := &interfaceAction{
+		Action:   "connect",
+		Plugs:    []plugJSON{{Snap: "consumer", Name: "plug"}},
+		Slots:    []slotJSON{{Snap: "producer", Name: "slot"}},
+		Schedule: schedule,
+	}
+	text, err := json.Marshal(action)
+	c.Assert(err, check.IsNil)
+	req, err := http.NewRequest("POST", "/v2/interfaces", bytes.NewBuffer(text))
+	c.Assert(err, check.IsNil)
+	rsp := changeInterfaces(interfacesCmd, req, nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeAsync)
+
+	st := d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+	chg := st.Change(rsp.Change)
+	c.Assert(chg, check.NotNil)
+	var scheduled time.Time
+	c.Assert(chg.Get("scheduled-time", &scheduled), check.IsNil)
+	c.Check(scheduled.Equal(start), check.Equals, true)
+	for _, t := range chg.Tasks() {
+		if len(t.WaitTasks()) == 0 {
+			c.Check(t.AtTime().Equal(scheduled), check.Equals, true)
+		}
+	}
+}
+
+func (s *apiSuite) TestConnectPlugScheduleError(c *check.C) {
+	s.daemon(c)
+
+	action := &interfaceAction{
+		Action:   "connect",
+		Plugs:    []plugJSON{{Snap: "consumer", Name: "plug"}},
+		Slots:    []slotJSON{{Snap: "producer", Name: "slot"}},
+		Schedule: "bogus",
+	}
+	text, err := json.Marshal(action)
+	c.Assert(err, check.IsNil)
+	req, err := http.NewRequest("POST", "/v2/interfaces", bytes.NewBuffer(text))
+	c.Assert(err, check.IsNil)
+	rsp := changeInterfaces(interfacesCmd, req, nil).(*resp)
+	c.Check(rsp.Status, check.Equals, 400)
+	c.Check(rsp.Result.(*errorResult).Message, check.Matches, `cannot parse schedule "bogus": .*`)
+}
+
 func (s *apiSuite) TestConnectPlugFailureInterfaceMismatch(c *check.C) {
 	d := s.daemon(c)
 
@@ -5187,6 +5669,60 @@ func (s *apiSuite) TestStateChangesForSnapName(c *check.C) {
 	c.Assert(err, check.IsNil)
 }
 
+func (s *apiSuite) TestStateChangesArchived(c *check.C) {
+	var gotFilter *changejournal.Filter
+	oldChangejournalRead := changejournalRead
+	changejournalRead = func(filter *changejournal.Filter) ([]*changejournal.Entry, error) {
+		gotFilter = filter
+		return []*changejournal.Entry{{ID: "42", Kind: "install-snap", Status: "Done", Ready: true}}, nil
+	}
+	defer func() { changejournalRead = oldChangejournalRead }()
+
+	req, err := http.NewRequest("GET", "/v2/changes?select=archived&since=2019-03-11T10:00:00Z&kind=install-snap&for=foo", nil)
+	c.Assert(err, check.IsNil)
+	rsp := getChanges(stateChangesCmd, req, nil).(*resp)
+
+	c.Check(rsp.Type, check.Equals, ResponseTypeSync)
+	c.Check(rsp.Status, check.Equals, 200)
+	c.Check(gotFilter, check.DeepEquals, &changejournal.Filter{
+		Since: time.Date(2019, 3, 11, 10, 0, 0, 0, time.UTC),
+		Kind:  "install-snap",
+		Snap:  "foo",
+	})
+
+	res, err := rsp.MarshalJSON()
+	c.Assert(err, check.IsNil)
+	c.Check(string(res), check.Matches, `.*"result":\[{"id":"42","kind":"install-snap","summary":"","status":"Done","ready":true,.*`)
+}
+
+func (s *apiSuite) TestStateChangesArchivedErrors(c *check.C) {
+	oldChangejournalRead := changejournalRead
+	changejournalRead = func(filter *changejournal.Filter) ([]*changejournal.Entry, error) {
+		return nil, errors.New("boom")
+	}
+	defer func() { changejournalRead = oldChangejournalRead }()
+
+	req, err := http.NewRequest("GET", "/v2/changes?select=archived&since=yesterday", nil)
+	c.Assert(err, check.IsNil)
+	rsp := getChanges(stateChangesCmd, req, nil).(*resp)
+	c.Check(rsp.Status, check.Equals, 400)
+	c.Check(rsp.Result.(*errorResult).Message, check.Matches, `cannot parse since: .*`)
+
+	req, err = http.NewRequest("GET", "/v2/changes?select=archived", nil)
+	c.Assert(err, check.IsNil)
+	rsp = getChanges(stateChangesCmd, req, nil).(*resp)
+	c.Check(rsp.Status, check.Equals, 500)
+	c.Check(rsp.Result.(*errorResult).Message, check.Equals, `cannot read change journal: boom`)
+}
+
+func (s *apiSuite) TestStateChangesBadSelect(c *check.C) {
+	req, err := http.NewRequest("GET", "/v2/changes?select=foo", nil)
+	c.Assert(err, check.IsNil)
+	rsp := getChanges(stateChangesCmd, req, nil).(*resp)
+	c.Check(rsp.Status, check.Equals, 400)
+	c.Check(rsp.Result.(*errorResult).Message, check.Equals, `select should be one of: all,in-progress,ready,archived`)
+}
+
 func (s *apiSuite) TestStateChange(c *check.C) {
 	restore := state.MockTime(time.Date(2016, 04, 21, 1, 2, 3, 0, time.UTC))
 	defer restore()
@@ -5271,7 +5807,7 @@ func (s *apiSuite) TestStateChangeAbort(c *check.C) {
 	// Execute
 	req, err := http.NewRequest("POST", "/v2/changes/"+ids[0], buf)
 	c.Assert(err, check.IsNil)
-	rsp := abortChange(stateChangeCmd, req, nil).(*resp)
+	rsp := postChange(stateChangeCmd, req, nil).(*resp)
 	rec := httptest.NewRecorder()
 	rsp.ServeHTTP(rec, req)
 
@@ -5337,7 +5873,7 @@ func (s *apiSuite) TestStateChangeAbortIsReady(c *check.C) {
 	// Execute
 	req, err := http.NewRequest("POST", "/v2/changes/"+ids[0], buf)
 	c.Assert(err, check.IsNil)
-	rsp := abortChange(stateChangeCmd, req, nil).(*resp)
+	rsp := postChange(stateChangeCmd, req, nil).(*resp)
 	rec := httptest.NewRecorder()
 	rsp.ServeHTTP(rec, req)
 
@@ -5355,6 +5891,59 @@ func (s *apiSuite) TestStateChangeAbortIsReady(c *check.C) {
 	})
 }
 
+func (s *apiSuite) TestStateChangePauseResume(c *check.C) {
+	soon := 0
+	ensureStateSoon = func(st *state.State) {
+		soon++
+	}
+
+	d := newTestDaemon(c)
+	st := d.overlord.State()
+	st.Lock()
+	ids := setupChanges(st)
+	chg := st.Change(ids[0])
+	st.Unlock()
+	s.vars = map[string]string{"id": ids[0]}
+
+	post := func(action string) *resp {
+		buf := bytes.NewBufferString(fmt.Sprintf(`{"action": %q}`, action))
+		req, err := http.NewRequest("POST", "/v2/changes/"+ids[0], buf)
+		c.Assert(err, check.IsNil)
+		return postChange(stateChangeCmd, req, nil).(*resp)
+	}
+
+	rsp := post("pause")
+	c.Assert(rsp.Status, check.Equals, 200)
+	c.Check(rsp.Result.(*changeInfo).Paused, check.Equals, true)
+	c.Check(soon, check.Equals, 1)
+	st.Lock()
+	c.Check(chg.IsPaused(), check.Equals, true)
+	st.Unlock()
+
+	rsp = post("pause")
+	c.Check(rsp.Status, check.Equals, 400)
+	c.Check(rsp.Result.(*errorResult).Message, check.Equals, fmt.Sprintf("change %s is already paused", ids[0]))
+
+	rsp = post("resume")
+	c.Assert(rsp.Status, check.Equals, 200)
+	c.Check(rsp.Result.(*changeInfo).Paused, check.Equals, false)
+	c.Check(soon, check.Equals, 2)
+	st.Lock()
+	c.Check(chg.IsPaused(), check.Equals, false)
+	st.Unlock()
+
+	rsp = post("resume")
+	c.Check(rsp.Status, check.Equals, 400)
+	c.Check(rsp.Result.(*errorResult).Message, check.Equals, fmt.Sprintf("change %s is not paused", ids[0]))
+
+	st.Lock()
+	chg.SetStatus(state.DoneStatus)
+	st.Unlock()
+	rsp = post("pause")
+	c.Check(rsp.Status, check.Equals, 400)
+	c.Check(rsp.Result.(*errorResult).Message, check.Equals, fmt.Sprintf("cannot pause change %s with nothing pending", ids[0]))
+}
+
 const validBuyInput = `{
 		  "snap-id": "the-snap-id-1234abcd",
 		  "snap-name": "the snap name",
@@ -7315,7 +7904,7 @@ func (s *appSuite) TestPostAppsConflict(c *check.C) {
 		}
 	}()
 
-	ts, err := snapstate.Remove(st, "snap-a", snap.R(0))
+	ts, err := snapstate.Remove(st, "snap-a", snap.R(0), nil)
 	c.Assert(err, check.IsNil)
 	// need a change to make the tasks visible
 	st.NewChange("enable", "...").AddAll(ts)
@@ -0,0 +1,339 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/jsonutil/jsonlog"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+var (
+	// auditLogMaxSize is the size past which the audit log is rotated
+	auditLogMaxSize int64 = 8 * 1024 * 1024
+	// auditLogBackups is how many rotated audit logs are kept
+	auditLogBackups = 3
+	// auditDeniedLogMaxSize and auditDeniedLogBackups are the same
+	// for the separate log of the requests that were denied access
+	auditDeniedLogMaxSize int64 = 1024 * 1024
+	auditDeniedLogBackups       = 1
+	// auditBodyMaxSize is how much of a request body is looked at to
+	// find the action and snaps of the request
+	auditBodyMaxSize int64 = 64 * 1024
+	// auditFieldMaxSize is how much of a multipart form field is
+	// looked at
+	auditFieldMaxSize int64 = 1024
+)
+
+// auditEntry is the audit log record of a state-changing request.
+type auditEntry struct {
+	Time time.Time `json:"time"`
+	// PID and UID are those of the peer, if known
+	PID *int32  `json:"pid,omitempty"`
+	UID *uint32 `json:"uid,omitempty"`
+	// UserID, Username and Email are those of the snapd user, if
+	// the request was authenticated
+	UserID   int    `json:"user-id,omitempty"`
+	Username string `json:"username,omitempty"`
+	Email    string `json:"email,omitempty"`
+
+	Method string   `json:"method"`
+	Route  string   `json:"route"`
+	Path   string   `json:"path"`
+	Action string   `json:"action,omitempty"`
+	Snaps  []string `json:"snaps,omitempty"`
+	// File is the path or name of the snap file sent to sideload or
+	// try a snap
+	File     string `json:"file,omitempty"`
+	Status   int    `json:"status"`
+	Err      string `json:"err,omitempty"`
+	ChangeID string `json:"change-id,omitempty"`
+	// Denied is set for requests that were denied access, and so
+	// never reached their handler; these are recorded apart, so
+	// that they cannot push the accepted ones out of the audit log.
+	Denied bool `json:"denied,omitempty"`
+}
+
+// auditRequestBody holds the parts of the body of a request that are
+// of interest to the audit log.
+type auditRequestBody struct {
+	Action string   `json:"action"`
+	Snaps  []string `json:"snaps"`
+	Plugs  []struct {
+		Snap string `json:"snap"`
+	} `json:"plugs"`
+	Slots []struct {
+		Snap string `json:"snap"`
+	} `json:"slots"`
+}
+
+func (e *auditEntry) addSnap(name string) {
+	if name == "" {
+		return
+	}
+	for _, snap := range e.Snaps {
+		if snap == name {
+			return
+		}
+	}
+	e.Snaps = append(e.Snaps, name)
+}
+
+// newAuditEntry starts the audit log record of the given request.
+func newAuditEntry(c *Command, r *http.Request, user *auth.UserState) *auditEntry {
+	entry := &auditEntry{
+		Time:   time.Now().UTC(),
+		Method: r.Method,
+		Route:  c.Path,
+	}
+	if r.URL != nil {
+		entry.Path = r.URL.Path
+	}
+	if pid, uid, _, err := ucrednetGet(r.RemoteAddr); err == nil {
+		entry.PID = &pid
+		entry.UID = &uid
+	}
+	if user != nil {
+		entry.UserID = user.ID
+		entry.Username = user.Username
+		entry.Email = user.Email
+	}
+	entry.addSnap(muxVars(r)["name"])
+	return entry
+}
+
+// peekBody looks at the start of the body of the request for its
+// action and snaps, and leaves all of it for the handler to read.
+func (e *auditEntry) peekBody(r *http.Request) {
+	if r.Body == nil {
+		return
+	}
+	mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	multipartBody := strings.HasPrefix(mediaType, "multipart/")
+	if mediaType != "" && mediaType != "application/json" && !multipartBody {
+		return
+	}
+	buf, err := ioutil.ReadAll(io.LimitReader(r.Body, auditBodyMaxSize))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(buf), r.Body), r.Body}
+	if err != nil {
+		return
+	}
+	if multipartBody {
+		e.readForm(buf, params["boundary"])
+		return
+	}
+	var body auditRequestBody
+	if err := json.Unmarshal(buf, &body); err == nil {
+		e.Action = body.Action
+		for _, name := range body.Snaps {
+			e.addSnap(name)
+		}
+		for _, plug := range body.Plugs {
+			e.addSnap(plug.Snap)
+		}
+		for _, slot := range body.Slots {
+			e.addSnap(slot.Snap)
+		}
+	}
+}
+
+// readForm gets the action, snap name and file of a request to
+// sideload or try a snap from the form fields at the start of its
+// body, which come before the snap file itself.
+func (e *auditEntry) readForm(buf []byte, boundary string) {
+	if boundary == "" {
+		return
+	}
+	mr := multipart.NewReader(bytes.NewReader(buf), boundary)
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			break
+		}
+		if part.FormName() == "snap" && part.FileName() != "" {
+			if e.File == "" {
+				e.File = part.FileName()
+			}
+			// the snap file is sent last, and is likely cut short
+			break
+		}
+		value, err := ioutil.ReadAll(io.LimitReader(part, auditFieldMaxSize))
+		if err != nil {
+			break
+		}
+		switch part.FormName() {
+		case "action":
+			e.Action = string(value)
+		case "name":
+			e.addSnap(string(value))
+		case "snap-path":
+			e.File = string(value)
+		}
+	}
+	if e.Action == "" && e.File != "" {
+		// sideloading is installing
+		e.Action = "install"
+	}
+}
+
+// finish completes the audit log record with the outcome of the
+// request.
+func (e *auditEntry) finish(st *state.State, rsp Response) {
+	r, ok := rsp.(*resp)
+	if !ok {
+		// e.g. a file
+		e.Status = 200
+		return
+	}
+	e.Status = r.Status
+	if res, ok := r.Result.(*errorResult); ok {
+		e.Err = res.Message
+	}
+	if r.Meta == nil || r.Meta.Change == "" {
+		return
+	}
+	e.ChangeID = r.Meta.Change
+
+	st.Lock()
+	defer st.Unlock()
+	if chg := st.Change(e.ChangeID); chg != nil {
+		var names []string
+		chg.Get("snap-names", &names)
+		for _, name := range names {
+			e.addSnap(name)
+		}
+	}
+}
+
+var auditMu sync.Mutex
+
+// auditLogs returns the audit log and the log of denied requests.
+func auditLogs() []*jsonlog.Log {
+	return []*jsonlog.Log{
+		{Path: dirs.SnapAuditLogFile, MaxSize: auditLogMaxSize, Backups: auditLogBackups},
+		{Path: dirs.SnapAuditDeniedLogFile, MaxSize: auditDeniedLogMaxSize, Backups: auditDeniedLogBackups},
+	}
+}
+
+// recordAudit appends the given entry to the audit log, or to the log
+// of denied requests, rotating it first if it got too big.
+func recordAudit(entry *auditEntry) error {
+	buf, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	buf = append(buf, '\n')
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+
+	logs := auditLogs()
+	log := logs[0]
+	if entry.Denied {
+		log = logs[1]
+	}
+	return log.Append(buf)
+}
+
+// auditFilter selects the entries returned by readAudit.
+type auditFilter struct {
+	// Since and Until, if set, select the entries recorded in the
+	// given time range.
+	Since time.Time
+	Until time.Time
+	// User, if set, selects the entries of requests from the snapd
+	// user with the given username or email, or from the given uid.
+	User string
+}
+
+func (f *auditFilter) match(e *auditEntry) bool {
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && e.Time.After(f.Until) {
+		return false
+	}
+	if f.User != "" {
+		if f.User == e.Username || f.User == e.Email {
+			return true
+		}
+		return e.UID != nil && f.User == strconv.FormatUint(uint64(*e.UID), 10)
+	}
+	return true
+}
+
+// byAuditTime sorts audit entries by time, keeping the order of the
+// ones recorded at the same time.
+type byAuditTime []*auditEntry
+
+func (ts byAuditTime) Len() int           { return len(ts) }
+func (ts byAuditTime) Swap(i, j int)      { ts[i], ts[j] = ts[j], ts[i] }
+func (ts byAuditTime) Less(i, j int) bool { return ts[i].Time.Before(ts[j].Time) }
+
+// readAudit returns the audit log entries, rotated ones and denied
+// ones included, that match the given filter, oldest first.
+func readAudit(filter *auditFilter) ([]*auditEntry, error) {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+
+	var entries []*auditEntry
+	for _, log := range auditLogs() {
+		err := log.Read(func(line []byte) {
+			var entry auditEntry
+			if err := json.Unmarshal(line, &entry); err != nil {
+				logger.Debugf("Skipping invalid audit log entry: %v", err)
+			} else if filter.match(&entry) {
+				entries = append(entries, &entry)
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Stable(byAuditTime(entries))
+	return entries, nil
+}
+
+// audit records a state-changing request in the audit log. Failures
+// are logged, but do not affect the request.
+func (c *Command) audit(entry *auditEntry, rsp Response) {
+	entry.finish(c.d.overlord.State(), rsp)
+	if err := recordAudit(entry); err != nil {
+		logger.Noticef("Cannot record %s %s in the audit log: %v", entry.Method, entry.Path, err)
+	}
+}
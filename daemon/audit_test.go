@@ -0,0 +1,341 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/auth"
+)
+
+type auditSuite struct{}
+
+var _ = check.Suite(&auditSuite{})
+
+func (s *auditSuite) SetUpTest(c *check.C) {
+	dirs.SetRootDir(c.MkDir())
+}
+
+func (s *auditSuite) TearDownTest(c *check.C) {
+	dirs.SetRootDir("")
+}
+
+func uint32Ptr(u uint32) *uint32 { return &u }
+
+func (s *auditSuite) TestRecordAndRead(c *check.C) {
+	t0 := time.Date(2019, 3, 11, 10, 0, 0, 0, time.UTC)
+	entries := []*auditEntry{
+		{Time: t0, UID: uint32Ptr(0), Method: "POST", Route: "/v2/snaps/{name}", Path: "/v2/snaps/foo", Action: "install", Snaps: []string{"foo"}, Status: 202, ChangeID: "1"},
+		{Time: t0.Add(time.Hour), UID: uint32Ptr(1000), Email: "foo@example.com", Method: "PUT", Route: "/v2/snaps/{name}/conf", Path: "/v2/snaps/foo/conf", Snaps: []string{"foo"}, Status: 202, ChangeID: "2"},
+		{Time: t0.Add(2 * time.Hour), UID: uint32Ptr(1001), Method: "POST", Route: "/v2/snaps/{name}", Path: "/v2/snaps/bar", Action: "remove", Snaps: []string{"bar"}, Status: 401, Err: "access denied"},
+	}
+	for _, entry := range entries {
+		c.Assert(recordAudit(entry), check.IsNil)
+	}
+
+	fi, err := os.Stat(dirs.SnapAuditLogFile)
+	c.Assert(err, check.IsNil)
+	c.Check(fi.Mode().Perm(), check.Equals, os.FileMode(0600))
+
+	read, err := readAudit(&auditFilter{})
+	c.Assert(err, check.IsNil)
+	c.Check(read, check.DeepEquals, entries)
+
+	read, err = readAudit(&auditFilter{Since: t0.Add(30 * time.Minute), Until: t0.Add(90 * time.Minute)})
+	c.Assert(err, check.IsNil)
+	c.Check(read, check.DeepEquals, entries[1:2])
+
+	read, err = readAudit(&auditFilter{User: "foo@example.com"})
+	c.Assert(err, check.IsNil)
+	c.Check(read, check.DeepEquals, entries[1:2])
+
+	read, err = readAudit(&auditFilter{User: "0"})
+	c.Assert(err, check.IsNil)
+	c.Check(read, check.DeepEquals, entries[:1])
+}
+
+func (s *auditSuite) TestReadSkipsJunk(c *check.C) {
+	c.Assert(recordAudit(&auditEntry{Method: "POST", Route: "/v2/snaps"}), check.IsNil)
+	f, err := os.OpenFile(dirs.SnapAuditLogFile, os.O_WRONLY|os.O_APPEND, 0600)
+	c.Assert(err, check.IsNil)
+	_, err = f.WriteString(`{"method": "PO`)
+	c.Assert(err, check.IsNil)
+	c.Assert(f.Close(), check.IsNil)
+
+	read, err := readAudit(&auditFilter{})
+	c.Assert(err, check.IsNil)
+	c.Check(read, check.DeepEquals, []*auditEntry{{Method: "POST", Route: "/v2/snaps"}})
+}
+
+func (s *auditSuite) TestRotation(c *check.C) {
+	oldMaxSize, oldBackups := auditLogMaxSize, auditLogBackups
+	defer func() {
+		auditLogMaxSize, auditLogBackups = oldMaxSize, oldBackups
+	}()
+	auditLogMaxSize = 150
+	auditLogBackups = 2
+
+	var entries []*auditEntry
+	for _, path := range []string{"/v2/snaps/a", "/v2/snaps/b", "/v2/snaps/c", "/v2/snaps/d", "/v2/snaps/e"} {
+		entry := &auditEntry{Method: "POST", Route: "/v2/snaps/{name}", Path: path, Status: 202}
+		entries = append(entries, entry)
+		c.Assert(recordAudit(entry), check.IsNil)
+	}
+
+	// each file holds one entry, and only two rotated files are kept
+	for _, fn := range []string{dirs.SnapAuditLogFile, dirs.SnapAuditLogFile + ".1", dirs.SnapAuditLogFile + ".2"} {
+		_, err := os.Stat(fn)
+		c.Check(err, check.IsNil)
+	}
+	_, err := os.Stat(dirs.SnapAuditLogFile + ".3")
+	c.Check(os.IsNotExist(err), check.Equals, true)
+
+	read, err := readAudit(&auditFilter{})
+	c.Assert(err, check.IsNil)
+	c.Check(read, check.DeepEquals, entries[2:])
+}
+
+func (s *auditSuite) TestNewAuditEntry(c *check.C) {
+	body := `{"action": "connect", "plugs": [{"snap": "foo", "plug": "network"}], "slots": [{"snap": "core", "slot": "network"}]}`
+	req, err := http.NewRequest("POST", "/v2/interfaces", bytes.NewBufferString(body))
+	c.Assert(err, check.IsNil)
+	req.RemoteAddr = "pid=100;uid=1000;socket=;"
+
+	entry := newAuditEntry(interfacesCmd, req, &auth.UserState{ID: 1, Username: "foo", Email: "foo@example.com"})
+	entry.peekBody(req)
+	pid := int32(100)
+	c.Check(entry.Time.IsZero(), check.Equals, false)
+	entry.Time = time.Time{}
+	c.Check(entry, check.DeepEquals, &auditEntry{
+		PID:      &pid,
+		UID:      uint32Ptr(1000),
+		UserID:   1,
+		Username: "foo",
+		Email:    "foo@example.com",
+		Method:   "POST",
+		Route:    "/v2/interfaces",
+		Path:     "/v2/interfaces",
+		Action:   "connect",
+		Snaps:    []string{"foo", "core"},
+	})
+
+	// the handler still gets the whole body
+	data, err := ioutil.ReadAll(req.Body)
+	c.Assert(err, check.IsNil)
+	c.Check(string(data), check.Equals, body)
+}
+
+func (s *auditSuite) TestNewAuditEntryNotJSON(c *check.C) {
+	req, err := http.NewRequest("POST", "/v2/snaps", bytes.NewBufferString("not json"))
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "multipart/form-data; boundary=foo")
+
+	entry := newAuditEntry(snapsCmd, req, nil)
+	entry.peekBody(req)
+	c.Check(entry.Action, check.Equals, "")
+	c.Check(entry.Snaps, check.HasLen, 0)
+
+	data, err := ioutil.ReadAll(req.Body)
+	c.Assert(err, check.IsNil)
+	c.Check(string(data), check.Equals, "not json")
+}
+
+func (s *auditSuite) TestNewAuditEntryForm(c *check.C) {
+	oldMaxSize := auditBodyMaxSize
+	defer func() { auditBodyMaxSize = oldMaxSize }()
+	auditBodyMaxSize = 512
+
+	sideload := "--hello\r\n" +
+		"Content-Disposition: form-data; name=\"name\"\r\n" +
+		"\r\n" +
+		"foo_bar\r\n" +
+		"--hello\r\n" +
+		"Content-Disposition: form-data; name=\"dangerous\"\r\n" +
+		"\r\n" +
+		"true\r\n" +
+		"--hello\r\n" +
+		"Content-Disposition: form-data; name=\"snap\"; filename=\"foo_1.snap\"\r\n" +
+		"\r\n" +
+		strings.Repeat("x", 1024) + "\r\n" +
+		"--hello--\r\n"
+	try := "--hello\r\n" +
+		"Content-Disposition: form-data; name=\"action\"\r\n" +
+		"\r\n" +
+		"try\r\n" +
+		"--hello\r\n" +
+		"Content-Disposition: form-data; name=\"snap-path\"\r\n" +
+		"\r\n" +
+		"/home/foo/prime\r\n" +
+		"--hello--\r\n"
+
+	for _, t := range []struct {
+		body   string
+		action string
+		snaps  []string
+		file   string
+	}{
+		{sideload, "install", []string{"foo_bar"}, "foo_1.snap"},
+		{try, "try", nil, "/home/foo/prime"},
+	} {
+		req, err := http.NewRequest("POST", "/v2/snaps", bytes.NewBufferString(t.body))
+		c.Assert(err, check.IsNil)
+		req.Header.Set("Content-Type", "multipart/thing; boundary=hello")
+
+		entry := newAuditEntry(snapsCmd, req, nil)
+		entry.peekBody(req)
+		c.Check(entry.Action, check.Equals, t.action)
+		c.Check(entry.Snaps, check.DeepEquals, t.snaps)
+		c.Check(entry.File, check.Equals, t.file)
+
+		// the handler still gets the whole body
+		data, err := ioutil.ReadAll(req.Body)
+		c.Assert(err, check.IsNil)
+		c.Check(string(data), check.Equals, t.body)
+	}
+}
+
+func (s *auditSuite) TestDeniedDoNotRotateAccepted(c *check.C) {
+	oldMaxSize, oldDeniedMaxSize := auditLogMaxSize, auditDeniedLogMaxSize
+	defer func() {
+		auditLogMaxSize, auditDeniedLogMaxSize = oldMaxSize, oldDeniedMaxSize
+	}()
+	auditLogMaxSize = 150
+	auditDeniedLogMaxSize = 150
+
+	t0 := time.Date(2019, 3, 11, 10, 0, 0, 0, time.UTC)
+	accepted := &auditEntry{Time: t0, Method: "POST", Route: "/v2/snaps/{name}", Path: "/v2/snaps/a", Status: 202}
+	c.Assert(recordAudit(accepted), check.IsNil)
+	var denied []*auditEntry
+	for i := 1; i <= 5; i++ {
+		entry := &auditEntry{Time: t0.Add(time.Duration(i) * time.Minute), Method: "POST", Route: "/v2/snaps/{name}", Path: "/v2/snaps/b", Status: 401, Denied: true}
+		denied = append(denied, entry)
+		c.Assert(recordAudit(entry), check.IsNil)
+	}
+
+	// the accepted entry is still there, and only the last denied
+	// ones are, rotated in their own log
+	_, err := os.Stat(dirs.SnapAuditLogFile + ".1")
+	c.Check(os.IsNotExist(err), check.Equals, true)
+	_, err = os.Stat(dirs.SnapAuditDeniedLogFile + ".1")
+	c.Check(err, check.IsNil)
+
+	read, err := readAudit(&auditFilter{})
+	c.Assert(err, check.IsNil)
+	c.Check(read, check.DeepEquals, append([]*auditEntry{accepted}, denied[3:]...))
+}
+
+func (s *daemonSuite) TestServeHTTPAudit(c *check.C) {
+	d := newTestDaemon(c)
+	st := d.overlord.State()
+	st.Lock()
+	chg := st.NewChange("install-snap", "...")
+	chg.Set("snap-names", []string{"foo", "bar"})
+	st.Unlock()
+
+	cmd := &Command{d: d}
+	cmd.POST = func(*Command, *http.Request, *auth.UserState) Response {
+		return AsyncResponse(nil, &Meta{Change: chg.ID()})
+	}
+	cmd.GET = func(*Command, *http.Request, *auth.UserState) Response {
+		return SyncResponse(nil, nil)
+	}
+
+	for _, method := range []string{"GET", "POST"} {
+		req, err := http.NewRequest(method, "/v2/snaps/foo", bytes.NewBufferString(`{"action": "install"}`))
+		c.Assert(err, check.IsNil)
+		req.RemoteAddr = "pid=100;uid=0;socket=;"
+		cmd.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// and one that is not allowed
+	req, err := http.NewRequest("POST", "/v2/snaps/foo", bytes.NewBufferString(`{"action": "remove"}`))
+	c.Assert(err, check.IsNil)
+	req.RemoteAddr = "pid=100;uid=1000;socket=;"
+	cmd.ServeHTTP(httptest.NewRecorder(), req)
+
+	entries, err := readAudit(&auditFilter{})
+	c.Assert(err, check.IsNil)
+	c.Assert(entries, check.HasLen, 2)
+	c.Check(*entries[0].UID, check.Equals, uint32(0))
+	c.Check(entries[0].Action, check.Equals, "install")
+	c.Check(entries[0].Status, check.Equals, 202)
+	c.Check(entries[0].ChangeID, check.Equals, chg.ID())
+	c.Check(entries[0].Snaps, check.DeepEquals, []string{"foo", "bar"})
+	c.Check(*entries[1].UID, check.Equals, uint32(1000))
+	// the body of denied requests is not looked at
+	c.Check(entries[1].Action, check.Equals, "")
+	c.Check(entries[1].Denied, check.Equals, true)
+	c.Check(entries[1].Status, check.Equals, 401)
+	c.Check(entries[1].Err, check.Equals, "access denied")
+	c.Check(entries[1].ChangeID, check.Equals, "")
+}
+
+func (s *daemonSuite) TestAuditRootOnly(c *check.C) {
+	cmd := &Command{d: newTestDaemon(c), RootOnly: true}
+	for _, t := range []struct {
+		remoteAddr string
+		access     accessResult
+	}{
+		{"pid=100;uid=0;socket=;", accessOK},
+		{"pid=100;uid=1000;socket=;", accessUnauthorized},
+		{"pid=100;uid=0;socket=" + dirs.SnapSocket + ";", accessUnauthorized},
+		{"", accessUnauthorized},
+	} {
+		req := &http.Request{Method: "GET", RemoteAddr: t.remoteAddr}
+		c.Check(cmd.canAccess(req, &auth.UserState{}), check.Equals, t.access, check.Commentf(t.remoteAddr))
+	}
+}
+
+func (s *apiSuite) TestGetAudit(c *check.C) {
+	s.daemon(c)
+	t0 := time.Date(2019, 3, 11, 10, 0, 0, 0, time.UTC)
+	for i, user := range []string{"foo", "bar", "foo"} {
+		entry := &auditEntry{Time: t0.Add(time.Duration(i) * time.Hour), Username: user, Method: "POST", Route: "/v2/snaps"}
+		c.Assert(recordAudit(entry), check.IsNil)
+	}
+
+	req, err := http.NewRequest("GET", "/v2/audit?user=foo&since=2019-03-11T10:30:00Z&until=2019-03-11T13:00:00Z", nil)
+	c.Assert(err, check.IsNil)
+	rsp := getAudit(auditCmd, req, nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeSync)
+	entries := rsp.Result.([]*auditEntry)
+	c.Assert(entries, check.HasLen, 1)
+	c.Check(entries[0].Time.Equal(t0.Add(2*time.Hour)), check.Equals, true)
+
+	req, err = http.NewRequest("GET", "/v2/audit?user=baz", nil)
+	c.Assert(err, check.IsNil)
+	rsp = getAudit(auditCmd, req, nil).(*resp)
+	c.Check(rsp.Result, check.DeepEquals, []*auditEntry{})
+
+	req, err = http.NewRequest("GET", "/v2/audit?until=yesterday", nil)
+	c.Assert(err, check.IsNil)
+	rsp = getAudit(auditCmd, req, nil).(*resp)
+	c.Check(rsp.Status, check.Equals, 400)
+	c.Check(rsp.Result.(*errorResult).Message, check.Matches, `cannot parse until: .*`)
+}
@@ -74,6 +74,8 @@ type Daemon struct {
 	restartSocket bool
 	// degradedErr is set when the daemon is in degraded mode
 	degradedErr error
+	// accessPolicy gives roles to users, if there is a policy
+	accessPolicy *accessPolicy
 
 	mu sync.Mutex
 }
@@ -98,6 +100,11 @@ type Command struct {
 
 	// can polkit grant access? set to polkit action ID if so
 	PolkitOK string
+	// can an operator, as given by the access policy, use the
+	// verbs that are not open to any user?
+	OperatorOK bool
+	// is this only for root, whatever the access policy says?
+	RootOnly bool
 
 	d *Daemon
 }
@@ -109,13 +116,16 @@ const (
 	accessUnauthorized
 	accessForbidden
 	accessCancelled
+	accessDenied
 )
 
 var polkitCheckAuthorization = polkit.CheckAuthorization
 
 // canAccess checks the following properties:
 //
-// - if a user is logged in (via `snap login`) everything is allowed
+// - RootOnly: only root can access it, in any way
+// - if the access policy gives the user a role, the role decides
+// - otherwise, if a user is logged in everything is allowed
 // - if the user is `root` everything is allowed
 // - POST/PUT/DELETE all require `snap login` or `root`
 //
@@ -124,6 +134,22 @@ var polkitCheckAuthorization = polkit.CheckAuthorization
 // - UserOK: any uid on the local system can access GET
 // - SnapOK: a snap can access this via `snapctl`
 func (c *Command) canAccess(r *http.Request, user *auth.UserState) accessResult {
+	if c.RootOnly {
+		if _, uid, socket, err := ucrednetGet(r.RemoteAddr); err == nil && uid == 0 && socket != dirs.SnapSocket {
+			return accessOK
+		}
+		return accessUnauthorized
+	}
+
+	if policy := c.d.accessPolicy; policy != nil {
+		if role := policy.roleFor(r, user); role != roleNone {
+			if role >= c.requiredRole(r.Method) {
+				return accessOK
+			}
+			logger.Noticef("Access denied to %s %s for role %s.", r.Method, c.Path, role)
+			return accessDenied
+		}
+	}
 	if user != nil {
 		// Authenticated users do anything for now.
 		return accessOK
@@ -202,24 +228,62 @@ func (c *Command) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	user, _ := UserFromRequest(st, r)
 	st.Unlock()
 
-	// check if we are in degradedMode
-	if c.d.degradedErr != nil && r.Method != "GET" {
-		InternalError(c.d.degradedErr.Error()).ServeHTTP(w, r)
+	if r.Method == "GET" {
+		c.response(r, user).ServeHTTP(w, r)
+		return
+	}
+
+	entry := newAuditEntry(c, r, user)
+	if rsp := c.checkAccess(r, user); rsp != nil {
+		// anybody can make requests that are denied, so their
+		// bodies are not looked at and they are recorded apart
+		entry.Denied = true
+		c.audit(entry, rsp)
+		rsp.ServeHTTP(w, r)
 		return
 	}
+	entry.peekBody(r)
+	rsp := c.handle(r, user)
+	c.audit(entry, rsp)
+	rsp.ServeHTTP(w, r)
+}
+
+// response checks the request can be made and, if so, hands it to the
+// handler for its method.
+func (c *Command) response(r *http.Request, user *auth.UserState) Response {
+	if rsp := c.checkAccess(r, user); rsp != nil {
+		return rsp
+	}
+	return c.handle(r, user)
+}
 
+// checkAccess returns the error response for a request that cannot
+// be made, or nil.
+func (c *Command) checkAccess(r *http.Request, user *auth.UserState) Response {
 	switch c.canAccess(r, user) {
 	case accessOK:
-		// nothing
+		return nil
 	case accessUnauthorized:
-		Unauthorized("access denied").ServeHTTP(w, r)
-		return
+		return Unauthorized("access denied")
 	case accessForbidden:
-		Forbidden("forbidden").ServeHTTP(w, r)
-		return
+		return Forbidden("forbidden")
 	case accessCancelled:
-		AuthCancelled("cancelled").ServeHTTP(w, r)
-		return
+		return AuthCancelled("cancelled")
+	case accessDenied:
+		role, required := c.d.accessPolicy.roleFor(r, user), c.requiredRole(r.Method)
+		return AccessDenied(role, required, "access denied by the access policy")
+	}
+	return nil
+}
+
+// handle hands the request, that can be made, to the handler for its
+// method.
+func (c *Command) handle(r *http.Request, user *auth.UserState) Response {
+	st := c.d.overlord.State()
+
+	// check if we are in degradedMode
+	if c.d.degradedErr != nil && r.Method != "GET" {
+		return InternalError(c.d.degradedErr.Error())
 	}
 
 	var rspf ResponseFunc
@@ -258,7 +322,7 @@ func (c *Command) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	rsp.ServeHTTP(w, r)
+	return rsp
 }
 
 type wrappedWriter struct {
@@ -374,6 +438,11 @@ func (d *Daemon) Init() error {
 		logger.Debugf("cannot get listener for %q: %v", dirs.SnapSocket, err)
 	}
 
+	var st *state.State
+	if d.overlord != nil {
+		st = d.overlord.State()
+	}
+	d.accessPolicy = loadSystemAccessPolicy(st)
 	d.addRoutes()
 
 	logger.Noticef("started %v.", httputil.UserAgent())
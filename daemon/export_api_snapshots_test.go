@@ -22,16 +22,19 @@ package daemon
 import (
 	"context"
 	"encoding/json"
+	"io"
 	"net/http"
 
 	"gopkg.in/check.v1"
 
 	"github.com/snapcore/snapd/client"
 	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/snapshotstate"
+	"github.com/snapcore/snapd/overlord/snapshotstate/backend"
 	"github.com/snapcore/snapd/overlord/state"
 )
 
-func MockSnapshotSave(newSave func(*state.State, []string, []string) (uint64, []string, *state.TaskSet, error)) (restore func()) {
+func MockSnapshotSave(newSave func(*state.State, []string, []string, *snapshotstate.SaveFlags) (uint64, []string, *state.TaskSet, error)) (restore func()) {
 	oldSave := snapshotSave
 	snapshotSave = newSave
 	return func() {
@@ -63,6 +66,30 @@ func MockSnapshotRestore(newRestore func(*state.State, uint64, []string, []strin
 	}
 }
 
+func MockSnapshotRestoreFiles(newRestoreFiles func(*state.State, uint64, []string, []string, []string, string) ([]string, *state.TaskSet, error)) (restore func()) {
+	oldRestoreFiles := snapshotRestoreFiles
+	snapshotRestoreFiles = newRestoreFiles
+	return func() {
+		snapshotRestoreFiles = oldRestoreFiles
+	}
+}
+
+func MockSnapshotFiles(newFiles func(context.Context, *state.State, uint64, string, []string, []byte) ([]client.SnapshotFile, error)) (restore func()) {
+	oldFiles := snapshotFiles
+	snapshotFiles = newFiles
+	return func() {
+		snapshotFiles = oldFiles
+	}
+}
+
+func MockSnapshotUcrednetGet(newUcrednetGet func(string) (int32, uint32, string, error)) (restore func()) {
+	oldUcrednetGet := snapshotUcrednetGet
+	snapshotUcrednetGet = newUcrednetGet
+	return func() {
+		snapshotUcrednetGet = oldUcrednetGet
+	}
+}
+
 func MockSnapshotForget(newForget func(*state.State, uint64, []string) ([]string, *state.TaskSet, error)) (restore func()) {
 	oldForget := snapshotForget
 	snapshotForget = newForget
@@ -71,6 +98,22 @@ func MockSnapshotForget(newForget func(*state.State, uint64, []string) ([]string
 	}
 }
 
+func MockSnapshotExport(newExport func(context.Context, *state.State, uint64) (*backend.SnapshotExport, error)) (restore func()) {
+	oldExport := snapshotExport
+	snapshotExport = newExport
+	return func() {
+		snapshotExport = oldExport
+	}
+}
+
+func MockSnapshotImport(newImport func(context.Context, *state.State, io.Reader) (uint64, []string, error)) (restore func()) {
+	oldImport := snapshotImport
+	snapshotImport = newImport
+	return func() {
+		snapshotImport = oldImport
+	}
+}
+
 func MustUnmarshalSnapInstruction(c *check.C, jinst string) *snapInstruction {
 	var inst snapInstruction
 	if err := json.Unmarshal([]byte(jinst), &inst); err != nil {
@@ -95,11 +138,21 @@ func ListSnapshots(c *Command, r *http.Request, user *auth.UserState) *resp {
 	return listSnapshots(c, r, user).(*resp)
 }
 
+func GetSnapshotExport(c *Command, r *http.Request, user *auth.UserState) Response {
+	return getSnapshotExport(c, r, user)
+}
+
+func GetSnapshotFiles(c *Command, r *http.Request, user *auth.UserState) *resp {
+	return getSnapshotFiles(c, r, user).(*resp)
+}
+
 func ChangeSnapshots(c *Command, r *http.Request, user *auth.UserState) *resp {
 	return changeSnapshots(c, r, user).(*resp)
 }
 
 var (
-	SnapshotMany = snapshotMany
-	SnapshotCmd  = snapshotCmd
+	SnapshotMany      = snapshotMany
+	SnapshotCmd       = snapshotCmd
+	SnapshotExportCmd = snapshotExportCmd
+	SnapshotFilesCmd  = snapshotFilesCmd
 )
@@ -188,6 +188,8 @@ const (
 
 	errorKindDaemonRestart = errorKind("daemon-restart")
 	errorKindSystemRestart = errorKind("system-restart")
+
+	errorKindAccessDenied = errorKind("access-denied")
 )
 
 type errorValue interface{}
@@ -482,6 +484,24 @@ func AuthCancelled(format string, v ...interface{}) Response {
 	}
 }
 
+// AccessDenied is an error responder used when the access policy
+// gives the user a role that cannot do what was requested.
+func AccessDenied(role, required accessRole, format string, v ...interface{}) Response {
+	res := &errorResult{
+		Message: fmt.Sprintf(format, v...),
+		Kind:    errorKindAccessDenied,
+		Value: map[string]string{
+			"role":     role.String(),
+			"required": required.String(),
+		},
+	}
+	return &resp{
+		Type:   ResponseTypeError,
+		Result: res,
+		Status: 403,
+	}
+}
+
 // InterfacesUnchanged is an error responder used when an operation
 // that would normally change interfaces finds it has nothing to do
 func InterfacesUnchanged(format string, v ...interface{}) Response {
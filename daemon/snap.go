@@ -31,6 +31,7 @@ import (
 	"github.com/snapcore/snapd/cmd"
 	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/overlord/assertstate"
+	"github.com/snapcore/snapd/overlord/healthstate"
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/snap"
@@ -68,6 +69,21 @@ func publisherAccount(st *state.State, snapID string) (snap.StoreAccount, error)
 type aboutSnap struct {
 	info   *snap.Info
 	snapst *snapstate.SnapState
+	health *client.SnapHealth
+}
+
+func clientHealth(st *state.State, instanceName string) (*client.SnapHealth, error) {
+	health, err := healthstate.Get(st, instanceName)
+	if err != nil || health == nil {
+		return nil, err
+	}
+	return &client.SnapHealth{
+		Revision:  health.Revision,
+		Timestamp: health.Timestamp,
+		Status:    health.Status.String(),
+		Message:   health.Message,
+		Code:      health.Code,
+	}, nil
 }
 
 // localSnapInfo returns the information about the current snap for the given name plus the SnapState with the active flag and other snap revisions.
@@ -94,9 +110,15 @@ func localSnapInfo(st *state.State, name string) (aboutSnap, error) {
 		return aboutSnap{}, err
 	}
 
+	health, err := clientHealth(st, name)
+	if err != nil {
+		return aboutSnap{}, err
+	}
+
 	return aboutSnap{
 		info:   info,
 		snapst: &snapst,
+		health: health,
 	}, nil
 }
 
@@ -118,7 +140,10 @@ func allLocalSnapInfos(st *state.State, all bool, wanted map[string]bool) ([]abo
 		}
 		var aboutThis []aboutSnap
 		var info *snap.Info
-		var err error
+		health, err := clientHealth(st, name)
+		if err != nil {
+			return nil, err
+		}
 		if all {
 			for _, seq := range snapst.Sequence {
 				info, err = snap.ReadInfo(name, seq)
@@ -137,13 +162,13 @@ func allLocalSnapInfos(st *state.State, all bool, wanted map[string]bool) ([]abo
 				if err != nil && firstErr == nil {
 					firstErr = err
 				}
-				aboutThis = append(aboutThis, aboutSnap{info, snapst})
+				aboutThis = append(aboutThis, aboutSnap{info, snapst, health})
 			}
 		} else {
 			info, err = snapst.CurrentInfo()
 			if err == nil {
 				info.Publisher, err = publisherAccount(st, info.SnapID)
-				aboutThis = append(aboutThis, aboutSnap{info, snapst})
+				aboutThis = append(aboutThis, aboutSnap{info, snapst, health})
 			}
 		}
 
@@ -281,6 +306,9 @@ func mapLocal(about aboutSnap) *client.Snap {
 	result.DevMode = snapst.DevMode
 	result.TryMode = snapst.TryMode
 	result.JailMode = snapst.JailMode
+	if about.health != nil && about.health.Revision == localSnap.Revision {
+		result.Health = about.health
+	}
 	result.MountedFrom = localSnap.MountFile()
 	if result.TryMode {
 		// Readlink instead of EvalSymlinks because it's only expected
@@ -66,8 +66,14 @@ var (
 	SnapAssertsSpoolDir   string
 	SnapSeqDir            string
 
-	SnapStateFile     string
-	SnapSystemKeyFile string
+	SnapStateFile          string
+	SnapStateJournalFile   string
+	SnapSystemKeyFile      string
+	SnapChangesJournalFile string
+	SnapAccessPolicyFile   string
+	SnapLocalPolicyFile    string
+	SnapAuditLogFile       string
+	SnapAuditDeniedLogFile string
 
 	SnapRepairDir        string
 	SnapRepairStateFile  string
@@ -237,7 +243,13 @@ func SetRootDir(rootdir string) {
 	SnapSeqDir = filepath.Join(rootdir, snappyDir, "sequence")
 
 	SnapStateFile = filepath.Join(rootdir, snappyDir, "state.json")
+	SnapStateJournalFile = filepath.Join(rootdir, snappyDir, "state.journal")
 	SnapSystemKeyFile = filepath.Join(rootdir, snappyDir, "system-key")
+	SnapChangesJournalFile = filepath.Join(rootdir, snappyDir, "changes.journal")
+	SnapAccessPolicyFile = filepath.Join(rootdir, "/etc/snapd/access.yaml")
+	SnapLocalPolicyFile = filepath.Join(rootdir, "/etc/snapd/interfaces-policy.yaml")
+	SnapAuditLogFile = filepath.Join(rootdir, snappyDir, "audit.log")
+	SnapAuditDeniedLogFile = filepath.Join(rootdir, snappyDir, "audit-denied.log")
 
 	SnapCacheDir = filepath.Join(rootdir, "/var/cache/snapd")
 	SnapNamesFile = filepath.Join(SnapCacheDir, "names")
@@ -43,6 +43,10 @@ const (
 	PerUserMountNamespace
 	// RefreshAppAwareness controls refresh being aware of running applications.
 	RefreshAppAwareness
+	// StateJournal controls checkpointing the state through an append-only
+	// journal, rather than rewriting it all every time. It is only looked
+	// at when snapd starts.
+	StateJournal
 	// lastFeature is the final known feature, it is only used for testing.
 	lastFeature
 )
@@ -65,6 +69,7 @@ var featureNames = map[SnapdFeature]string{
 	SnapdSnap:             "snapd-snap",
 	PerUserMountNamespace: "per-user-mount-namespace",
 	RefreshAppAwareness:   "refresh-app-awareness",
+	StateJournal:          "state-journal",
 }
 
 // featuresEnabledWhenUnset contains a set of features that are enabled when not explicitly configured.
@@ -76,6 +81,7 @@ var featuresEnabledWhenUnset = map[SnapdFeature]bool{
 var featuresExported = map[SnapdFeature]bool{
 	PerUserMountNamespace: true,
 	RefreshAppAwareness:   true,
+	StateJournal:          true,
 }
 
 // String returns the name of a snapd feature.
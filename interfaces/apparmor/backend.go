@@ -426,6 +426,23 @@ func (b *Backend) Setup(snapInfo *snap.Info, opts interfaces.ConfinementOptions,
 	return errUnload
 }
 
+// Render returns the apparmor profiles Setup would write for a given snap,
+// indexed by their path. Profiles are neither written nor loaded.
+func (b *Backend) Render(snapInfo *snap.Info, opts interfaces.ConfinementOptions, repo *interfaces.Repository) (map[string][]byte, error) {
+	snapName := snapInfo.InstanceName()
+	spec, err := repo.SnapSpecification(b.Name(), snapName)
+	if err != nil {
+		return nil, fmt.Errorf("cannot obtain apparmor specification for snap %q: %s", snapName, err)
+	}
+	spec.(*Specification).AddOvername(snapInfo)
+	spec.(*Specification).AddLayout(snapInfo)
+	content, err := b.deriveContent(spec.(*Specification), snapInfo, opts)
+	if err != nil {
+		return nil, fmt.Errorf("cannot obtain expected security files for snap %q: %s", snapName, err)
+	}
+	return interfaces.RenderedFiles(dirs.SnapAppArmorDir, content), nil
+}
+
 // Remove removes and unloads apparmor profiles of a given snap.
 func (b *Backend) Remove(snapName string) error {
 	dir := dirs.SnapAppArmorDir
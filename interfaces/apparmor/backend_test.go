@@ -144,6 +144,18 @@ func (s *backendSuite) TestInstallingSnapWithHookWritesAndLoadsProfiles(c *C) {
 	})
 }
 
+func (s *backendSuite) TestRenderingSnapDoesNotWriteOrLoadProfiles(c *C) {
+	_, files := s.RenderSnap(c, interfaces.ConfinementOptions{}, ifacetest.SambaYamlV1, 1)
+	updateNSProfile := filepath.Join(dirs.SnapAppArmorDir, "snap-update-ns.samba")
+	profile := filepath.Join(dirs.SnapAppArmorDir, "snap.samba.smbd")
+	c.Assert(files, HasLen, 2)
+	c.Check(string(files[profile]), testutil.Contains, "profile \"snap.samba.smbd\"")
+	c.Check(string(files[updateNSProfile]), testutil.Contains, "profile snap-update-ns.samba")
+	// nothing was written or loaded
+	c.Check(osutil.FileExists(profile), Equals, false)
+	c.Check(s.parserCmd.Calls(), HasLen, 0)
+}
+
 const layoutYaml = `name: myapp
 version: 1
 apps:
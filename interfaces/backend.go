@@ -20,6 +20,9 @@
 package interfaces
 
 import (
+	"path/filepath"
+
+	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/snap"
 	"github.com/snapcore/snapd/timings"
 )
@@ -85,6 +88,13 @@ type SecurityBackend interface {
 	// between them or application present in the snap.
 	Setup(snapInfo *snap.Info, opts ConfinementOptions, repo *Repository, tm timings.Measurer) error
 
+	// Render returns the security artefacts Setup would create for a given
+	// snap, indexed by their path, without writing or loading anything.
+	//
+	// This method is used to preview the effect of changes to connections or
+	// to the snap itself.
+	Render(snapInfo *snap.Info, opts ConfinementOptions, repo *Repository) (map[string][]byte, error)
+
 	// Remove removes and unloads security artefacts of a given snap.
 	//
 	// This method should be called during the process of removing a snap.
@@ -96,3 +106,13 @@ type SecurityBackend interface {
 	// SandboxFeatures returns a list of tags that identify sandbox features.
 	SandboxFeatures() []string
 }
+
+// RenderedFiles returns the content of the files that osutil.EnsureDirState
+// would write to the given directory, indexed by their path.
+func RenderedFiles(dir string, content map[string]*osutil.FileState) map[string][]byte {
+	files := make(map[string][]byte, len(content))
+	for name, state := range content {
+		files[filepath.Join(dir, name)] = state.Content
+	}
+	return files
+}
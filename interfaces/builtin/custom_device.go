@@ -0,0 +1,374 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package builtin
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/snapcore/snapd/interfaces"
+	"github.com/snapcore/snapd/interfaces/apparmor"
+	"github.com/snapcore/snapd/interfaces/udev"
+	"github.com/snapcore/snapd/snap"
+)
+
+const customDeviceSummary = `allows access to custom devices described by the gadget`
+
+const customDeviceBaseDeclarationSlots = `
+  custom-device:
+    allow-installation:
+      slot-snap-type:
+        - gadget
+        - core
+    allow-connection:
+      plug-attributes:
+        custom-device: $SLOT(custom-device)
+    deny-auto-connection: true
+`
+
+const customDeviceConnectedPlugAppArmor = `
+# Description: Can access the custom device %q
+`
+
+// customDeviceInterface allows gadget snaps to describe bespoke hardware
+// with the attributes of a slot, for instance:
+//
+//	slots:
+//	  sensor:
+//	    interface: custom-device
+//	    custom-device: sensor    # defaults to the slot name
+//	    devices: [/dev/sensor0, /dev/sensor/*]
+//	    read-devices: [/dev/sensor-ctl]
+//	    files:
+//	      read: [/sys/class/sensor/*/name]
+//	      write: [/sys/devices/platform/sensor/enable]
+//	    udev-tagging:
+//	      - kernel: sensor[0-9]
+//	        subsystem: sensor
+//	        attributes:
+//	          idVendor: "1234"
+//
+// Device nodes given with devices are readable and writable, those given
+// with read-devices are only readable, and so are the sysfs files given
+// with files. The paths can use the glob syntax AppArmor and udev have
+// in common, but not ** and no wildcards in the first path component
+// below /dev or /sys, so that a slot names the devices it is about.
+// Plugs connect to the slot with the same custom-device
+// attribute, which defaults to the name of the plug.
+//
+// Without udev-tagging the device nodes are tagged by their kernel name,
+// taken to be their name in /dev; as kernel names never contain a /,
+// device nodes in subdirectories of /dev need udev-tagging rules.
+// Otherwise only the devices matched by the udev-tagging rules are
+// tagged, and so are accessible once the snap uses a device cgroup.
+type customDeviceInterface struct {
+	commonInterface
+}
+
+// customDeviceUDevRule matches the devices to tag by their kernel name,
+// subsystem and attributes.
+type customDeviceUDevRule struct {
+	kernel     string
+	subsystem  string
+	attributes map[string]string
+}
+
+// customDevice is the description of a device in the attributes of a
+// custom-device slot.
+type customDevice struct {
+	name        string
+	devices     []string
+	readDevices []string
+	readFiles   []string
+	writeFiles  []string
+	udevRules   []customDeviceUDevRule
+}
+
+// Pattern to match valid custom-device names.
+var customDeviceNamePattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// Pattern to match paths and globs for device nodes, sysfs files and
+// udev kernel names. They use the subset of the AppArmor and udev glob
+// syntaxes the two have in common.
+var customDeviceGlobPattern = regexp.MustCompile(`^[-a-zA-Z0-9_.+:,/*?\[\]]+$`)
+
+// Pattern to match valid udev subsystem and attribute names.
+var customDeviceUDevNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]+(/[a-zA-Z0-9_.-]+)*$`)
+
+func validateCustomDeviceGlob(glob string) error {
+	if !customDeviceGlobPattern.MatchString(glob) {
+		return fmt.Errorf("%q contains invalid characters", glob)
+	}
+	if strings.Contains(glob, "**") {
+		return fmt.Errorf("%q contains a recursive glob", glob)
+	}
+	if _, err := filepath.Match(glob, ""); err != nil {
+		return fmt.Errorf("%q is not a valid glob: %v", glob, err)
+	}
+	return nil
+}
+
+// customDevicePaths reads the list of paths in attrs[key], which must be
+// below the given directory and name what is right below it without
+// wildcards.
+func customDevicePaths(attrs map[string]interface{}, key, dir string) ([]string, error) {
+	value, ok := attrs[key]
+	if !ok {
+		return nil, nil
+	}
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%q must be a list of strings", key)
+	}
+	paths := make([]string, len(list))
+	for i, item := range list {
+		path, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("%q must be a list of strings", key)
+		}
+		if !strings.HasPrefix(path, dir) || path == dir {
+			return nil, fmt.Errorf("%q must be a path below %s", path, dir)
+		}
+		if filepath.Clean(path) != path {
+			return nil, fmt.Errorf("cannot use %q: try %q", path, filepath.Clean(path))
+		}
+		if err := validateCustomDeviceGlob(path); err != nil {
+			return nil, err
+		}
+		// a wildcard right below dir would match whole classes of
+		// unrelated devices or sysfs trees
+		first := strings.SplitN(path[len(dir):], "/", 2)[0]
+		if strings.ContainsAny(first, "*?[") {
+			return nil, fmt.Errorf("%q cannot use wildcards in the first path component below %s", path, dir)
+		}
+		paths[i] = path
+	}
+	return paths, nil
+}
+
+func customDeviceUDevRules(value interface{}) ([]customDeviceUDevRule, error) {
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf(`"udev-tagging" must be a list of rules`)
+	}
+	rules := make([]customDeviceUDevRule, len(list))
+	for i, item := range list {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf(`"udev-tagging" must be a list of rules`)
+		}
+		var rule customDeviceUDevRule
+		for key, value := range m {
+			switch key {
+			case "kernel":
+				kernel, ok := value.(string)
+				if !ok {
+					return nil, fmt.Errorf(`udev-tagging "kernel" must be a string`)
+				}
+				if err := validateCustomDeviceGlob(kernel); err != nil {
+					return nil, fmt.Errorf("udev-tagging kernel %v", err)
+				}
+				if strings.Contains(kernel, "/") {
+					return nil, fmt.Errorf("udev-tagging kernel %q cannot contain /", kernel)
+				}
+				rule.kernel = kernel
+			case "subsystem":
+				subsystem, ok := value.(string)
+				if !ok || !customDeviceUDevNamePattern.MatchString(subsystem) {
+					return nil, fmt.Errorf("udev-tagging subsystem %v is not valid", value)
+				}
+				rule.subsystem = subsystem
+			case "attributes":
+				attrs, ok := value.(map[string]interface{})
+				if !ok {
+					return nil, fmt.Errorf(`udev-tagging "attributes" must be a map of strings`)
+				}
+				rule.attributes = make(map[string]string, len(attrs))
+				for name, v := range attrs {
+					if !customDeviceUDevNamePattern.MatchString(name) {
+						return nil, fmt.Errorf("udev-tagging attribute name %q is not valid", name)
+					}
+					s, ok := v.(string)
+					if !ok {
+						return nil, fmt.Errorf("udev-tagging attribute %q must be a string", name)
+					}
+					if strings.ContainsAny(s, "\"\\\n\x00") {
+						return nil, fmt.Errorf("udev-tagging attribute %q has invalid value %q", name, s)
+					}
+					rule.attributes[name] = s
+				}
+			default:
+				return nil, fmt.Errorf("unknown udev-tagging key %q", key)
+			}
+		}
+		if rule.kernel == "" {
+			return nil, fmt.Errorf(`udev-tagging rules must have a "kernel" key`)
+		}
+		rules[i] = rule
+	}
+	return rules, nil
+}
+
+// parseCustomDevice reads and validates the description of a device from
+// the attributes of a custom-device slot.
+func parseCustomDevice(attrs map[string]interface{}) (*customDevice, error) {
+	var device customDevice
+	var err error
+
+	name, ok := attrs["custom-device"].(string)
+	if !ok || !customDeviceNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("custom-device %v is not a valid name", attrs["custom-device"])
+	}
+	device.name = name
+	if device.devices, err = customDevicePaths(attrs, "devices", "/dev/"); err != nil {
+		return nil, err
+	}
+	if device.readDevices, err = customDevicePaths(attrs, "read-devices", "/dev/"); err != nil {
+		return nil, err
+	}
+	if files, ok := attrs["files"]; ok {
+		m, ok := files.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf(`"files" must be a map with "read" and "write" lists`)
+		}
+		for key := range m {
+			if key != "read" && key != "write" {
+				return nil, fmt.Errorf(`"files" must be a map with "read" and "write" lists`)
+			}
+		}
+		if device.readFiles, err = customDevicePaths(m, "read", "/sys/"); err != nil {
+			return nil, err
+		}
+		if device.writeFiles, err = customDevicePaths(m, "write", "/sys/"); err != nil {
+			return nil, err
+		}
+	}
+	if len(device.devices)+len(device.readDevices)+len(device.readFiles)+len(device.writeFiles) == 0 {
+		return nil, fmt.Errorf("custom-device slot must declare devices, read-devices or files")
+	}
+
+	if value, ok := attrs["udev-tagging"]; ok {
+		if device.udevRules, err = customDeviceUDevRules(value); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, path := range append(device.devices, device.readDevices...) {
+			kernel := strings.TrimPrefix(path, "/dev/")
+			if strings.Contains(kernel, "/") {
+				return nil, fmt.Errorf("%q is in a subdirectory of /dev/, it needs udev-tagging rules", path)
+			}
+			device.udevRules = append(device.udevRules, customDeviceUDevRule{
+				kernel: kernel,
+			})
+		}
+	}
+	return &device, nil
+}
+
+// setDefaultCustomDeviceName makes the custom-device attribute default to
+// the name of the plug or slot.
+func setDefaultCustomDeviceName(attrs map[string]interface{}, name string) map[string]interface{} {
+	if attrs == nil {
+		attrs = make(map[string]interface{})
+	}
+	if _, ok := attrs["custom-device"]; !ok {
+		attrs["custom-device"] = name
+	}
+	return attrs
+}
+
+func (iface *customDeviceInterface) BeforePreparePlug(plug *snap.PlugInfo) error {
+	plug.Attrs = setDefaultCustomDeviceName(plug.Attrs, plug.Name)
+	name, ok := plug.Attrs["custom-device"].(string)
+	if !ok || !customDeviceNamePattern.MatchString(name) {
+		return fmt.Errorf("custom-device %v is not a valid name", plug.Attrs["custom-device"])
+	}
+	return nil
+}
+
+func (iface *customDeviceInterface) BeforePrepareSlot(slot *snap.SlotInfo) error {
+	if err := sanitizeSlotReservedForOSOrGadget(iface, slot); err != nil {
+		return err
+	}
+	slot.Attrs = setDefaultCustomDeviceName(slot.Attrs, slot.Name)
+	if _, err := parseCustomDevice(slot.Attrs); err != nil {
+		return fmt.Errorf("cannot add custom-device slot %q: %v", slot.Name, err)
+	}
+	return nil
+}
+
+func (iface *customDeviceInterface) AppArmorConnectedPlug(spec *apparmor.Specification, plug *interfaces.ConnectedPlug, slot *interfaces.ConnectedSlot) error {
+	device, err := parseCustomDevice(slot.StaticAttrs())
+	if err != nil {
+		return fmt.Errorf("cannot connect plug %s: %v", plug.Name(), err)
+	}
+
+	buf := bytes.NewBufferString(fmt.Sprintf(customDeviceConnectedPlugAppArmor, device.name))
+	for _, path := range device.devices {
+		fmt.Fprintf(buf, "\"%s\" rw,\n", path)
+	}
+	for _, path := range device.readDevices {
+		fmt.Fprintf(buf, "\"%s\" r,\n", path)
+	}
+	for _, path := range device.readFiles {
+		fmt.Fprintf(buf, "\"%s\" r,\n", path)
+	}
+	for _, path := range device.writeFiles {
+		fmt.Fprintf(buf, "\"%s\" rw,\n", path)
+	}
+	spec.AddSnippet(buf.String())
+	return nil
+}
+
+func (iface *customDeviceInterface) UDevConnectedPlug(spec *udev.Specification, plug *interfaces.ConnectedPlug, slot *interfaces.ConnectedSlot) error {
+	device, err := parseCustomDevice(slot.StaticAttrs())
+	if err != nil {
+		return fmt.Errorf("cannot connect plug %s: %v", plug.Name(), err)
+	}
+
+	for _, rule := range device.udevRules {
+		matches := []string{fmt.Sprintf(`KERNEL=="%s"`, rule.kernel)}
+		if rule.subsystem != "" {
+			matches = append(matches, fmt.Sprintf(`SUBSYSTEM=="%s"`, rule.subsystem))
+		}
+		names := make([]string, 0, len(rule.attributes))
+		for name := range rule.attributes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			matches = append(matches, fmt.Sprintf(`ATTRS{%s}=="%s"`, name, rule.attributes[name]))
+		}
+		spec.TagDevice(strings.Join(matches, ", "))
+	}
+	return nil
+}
+
+func init() {
+	registerIface(&customDeviceInterface{commonInterface{
+		name:                 "custom-device",
+		summary:              customDeviceSummary,
+		baseDeclarationSlots: customDeviceBaseDeclarationSlots,
+	}})
+}
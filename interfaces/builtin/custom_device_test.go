@@ -0,0 +1,244 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package builtin_test
+
+import (
+	"strings"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/interfaces"
+	"github.com/snapcore/snapd/interfaces/apparmor"
+	"github.com/snapcore/snapd/interfaces/builtin"
+	"github.com/snapcore/snapd/interfaces/udev"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snaptest"
+	"github.com/snapcore/snapd/testutil"
+)
+
+type customDeviceInterfaceSuite struct {
+	iface    interfaces.Interface
+	slot     *interfaces.ConnectedSlot
+	slotInfo *snap.SlotInfo
+	plug     *interfaces.ConnectedPlug
+	plugInfo *snap.PlugInfo
+}
+
+var _ = Suite(&customDeviceInterfaceSuite{
+	iface: builtin.MustInterface("custom-device"),
+})
+
+const customDeviceConsumerYaml = `name: consumer
+version: 0
+plugs:
+ sensor:
+  interface: custom-device
+apps:
+ app:
+  plugs: [sensor]
+`
+
+const customDeviceGadgetYaml = `name: gadget
+version: 0
+type: gadget
+slots:
+ sensor:
+  interface: custom-device
+  devices:
+   - /dev/sensor0
+   - /dev/sensor1
+  read-devices:
+   - /dev/sensor-ctl
+  files:
+   read: [/sys/class/sensor/*/name]
+   write: [/sys/devices/platform/sensor/enable]
+`
+
+func (s *customDeviceInterfaceSuite) SetUpTest(c *C) {
+	s.plug, s.plugInfo = MockConnectedPlug(c, customDeviceConsumerYaml, nil, "sensor")
+	c.Assert(interfaces.BeforePreparePlug(s.iface, s.plugInfo), IsNil)
+	s.slot, s.slotInfo = MockConnectedSlot(c, customDeviceGadgetYaml, nil, "sensor")
+	c.Assert(interfaces.BeforePrepareSlot(s.iface, s.slotInfo), IsNil)
+	s.plug = interfaces.NewConnectedPlug(s.plugInfo, nil, nil)
+	s.slot = interfaces.NewConnectedSlot(s.slotInfo, nil, nil)
+}
+
+func (s *customDeviceInterfaceSuite) TestName(c *C) {
+	c.Assert(s.iface.Name(), Equals, "custom-device")
+}
+
+func (s *customDeviceInterfaceSuite) TestStaticInfo(c *C) {
+	si := interfaces.StaticInfoOf(s.iface)
+	c.Assert(si.ImplicitOnCore, Equals, false)
+	c.Assert(si.ImplicitOnClassic, Equals, false)
+	c.Assert(si.Summary, Equals, `allows access to custom devices described by the gadget`)
+	c.Assert(si.BaseDeclarationSlots, testutil.Contains, "custom-device: $SLOT(custom-device)")
+}
+
+func (s *customDeviceInterfaceSuite) TestSanitizeDefaultsToName(c *C) {
+	c.Check(s.plugInfo.Attrs["custom-device"], Equals, "sensor")
+	c.Check(s.slotInfo.Attrs["custom-device"], Equals, "sensor")
+
+	info := snaptest.MockInfo(c, `name: consumer
+version: 0
+plugs:
+ cam:
+  interface: custom-device
+  custom-device: sensor
+ bad:
+  interface: custom-device
+  custom-device: Bad_Name
+`, nil)
+	c.Assert(interfaces.BeforePreparePlug(s.iface, info.Plugs["cam"]), IsNil)
+	c.Check(info.Plugs["cam"].Attrs["custom-device"], Equals, "sensor")
+	c.Check(interfaces.BeforePreparePlug(s.iface, info.Plugs["bad"]), ErrorMatches, "custom-device Bad_Name is not a valid name")
+}
+
+func (s *customDeviceInterfaceSuite) TestSanitizeSlotReserved(c *C) {
+	info := snaptest.MockInfo(c, strings.Replace(customDeviceGadgetYaml, "type: gadget", "type: app", 1), nil)
+	c.Check(interfaces.BeforePrepareSlot(s.iface, info.Slots["sensor"]), ErrorMatches,
+		"custom-device slots are reserved for the core and gadget snaps")
+}
+
+func (s *customDeviceInterfaceSuite) TestSanitizeSlotUnhappy(c *C) {
+	const mockSnapYaml = `name: gadget
+version: 0
+type: gadget
+slots:
+ sensor:
+  interface: custom-device
+  $t
+`
+	errPrefix := `cannot add custom-device slot "sensor": `
+	for _, t := range []struct {
+		inp    string
+		errStr string
+	}{
+		{`custom-device: -sensor`, `custom-device -sensor is not a valid name`},
+		{`custom-device: 42`, `custom-device 42 is not a valid name`},
+		{`files: {}`, `custom-device slot must declare devices, read-devices or files`},
+		{`devices: /dev/foo`, `"devices" must be a list of strings`},
+		{`devices: [ 42 ]`, `"devices" must be a list of strings`},
+		{`devices: [ /sys/foo ]`, `"/sys/foo" must be a path below /dev/`},
+		{`devices: [ /dev/ ]`, `"/dev/" must be a path below /dev/`},
+		{`read-devices: [ /dev/foo/../../etc/shadow ]`, `cannot use "/dev/foo/../../etc/shadow": try "/etc/shadow"`},
+		{`devices: [ "/dev/foo{,bar}" ]`, `"/dev/foo{,bar}" contains invalid characters`},
+		{`devices: [ "/dev/foo\"" ]`, `"/dev/foo\\"" contains invalid characters`},
+		{`devices: [ "/dev/foo[0-" ]`, `"/dev/foo\[0-" is not a valid glob: syntax error in pattern`},
+		{`devices: [ "/dev/**" ]`, `"/dev/\*\*" contains a recursive glob`},
+		{`devices: [ "/dev/foo/**" ]`, `"/dev/foo/\*\*" contains a recursive glob`},
+		{`devices: [ "/dev/*" ]`, `"/dev/\*" cannot use wildcards in the first path component below /dev/`},
+		{`read-devices: [ "/dev/tty?" ]`, `"/dev/tty\?" cannot use wildcards in the first path component below /dev/`},
+		{`devices: [ "/dev/[a-z]d/foo" ]`, `"/dev/\[a-z\]d/foo" cannot use wildcards in the first path component below /dev/`},
+		{`files: { write: [ "/sys/**" ] }`, `"/sys/\*\*" contains a recursive glob`},
+		{`files: { read: [ "/sys/*/foo" ] }`, `"/sys/\*/foo" cannot use wildcards in the first path component below /sys/`},
+		{"devices: [ /dev/foo ]\n  udev-tagging: [ { kernel: \"foo**\" } ]", `udev-tagging kernel "foo\*\*" contains a recursive glob`},
+		{`devices: [ "/dev/bus/sensor/*" ]`, `"/dev/bus/sensor/\*" is in a subdirectory of /dev/, it needs udev-tagging rules`},
+		{`read-devices: [ /dev/input/event0 ]`, `"/dev/input/event0" is in a subdirectory of /dev/, it needs udev-tagging rules`},
+		{"devices: [ /dev/bus/foo ]\n  udev-tagging: [ { kernel: bus/foo } ]", `udev-tagging kernel "bus/foo" cannot contain /`},
+		{`files: [ /sys/foo ]`, `"files" must be a map with "read" and "write" lists`},
+		{`files: { exec: [ /sys/foo ] }`, `"files" must be a map with "read" and "write" lists`},
+		{`files: { read: [ /dev/foo ] }`, `"/dev/foo" must be a path below /sys/`},
+		{`files: { write: [ "/sys/foo bar" ] }`, `"/sys/foo bar" contains invalid characters`},
+		{"devices: [ /dev/foo ]\n  udev-tagging: foo", `"udev-tagging" must be a list of rules`},
+		{"devices: [ /dev/foo ]\n  udev-tagging: [ foo ]", `"udev-tagging" must be a list of rules`},
+		{"devices: [ /dev/foo ]\n  udev-tagging: [ { subsystem: foo } ]", `udev-tagging rules must have a "kernel" key`},
+		{"devices: [ /dev/foo ]\n  udev-tagging: [ { kernel: foo, mode: \"0666\" } ]", `unknown udev-tagging key "mode"`},
+		{"devices: [ /dev/foo ]\n  udev-tagging: [ { kernel: \"foo\\\"\" } ]", `udev-tagging kernel "foo\\"" contains invalid characters`},
+		{"devices: [ /dev/foo ]\n  udev-tagging: [ { kernel: foo, subsystem: \"a b\" } ]", `udev-tagging subsystem a b is not valid`},
+		{"devices: [ /dev/foo ]\n  udev-tagging: [ { kernel: foo, attributes: [ a ] } ]", `udev-tagging "attributes" must be a map of strings`},
+		{"devices: [ /dev/foo ]\n  udev-tagging: [ { kernel: foo, attributes: { \"a b\": c } } ]", `udev-tagging attribute name "a b" is not valid`},
+		{"devices: [ /dev/foo ]\n  udev-tagging: [ { kernel: foo, attributes: { idVendor: 1234 } } ]", `udev-tagging attribute "idVendor" must be a string`},
+		{"devices: [ /dev/foo ]\n  udev-tagging: [ { kernel: foo, attributes: { idVendor: \"12\\\"34\" } } ]", `udev-tagging attribute "idVendor" has invalid value "12\\"34"`},
+	} {
+		yml := strings.Replace(mockSnapYaml, "$t", t.inp, -1)
+		info := snaptest.MockInfo(c, yml, nil)
+		slot := info.Slots["sensor"]
+		c.Check(interfaces.BeforePrepareSlot(s.iface, slot), ErrorMatches, errPrefix+t.errStr, Commentf("unexpected error for %q", t.inp))
+	}
+}
+
+func (s *customDeviceInterfaceSuite) TestAppArmorConnectedPlug(c *C) {
+	spec := &apparmor.Specification{}
+	c.Assert(spec.AddConnectedPlug(s.iface, s.plug, s.slot), IsNil)
+	c.Assert(spec.SecurityTags(), DeepEquals, []string{"snap.consumer.app"})
+	c.Check(spec.SnippetForTag("snap.consumer.app"), Equals, `
+# Description: Can access the custom device "sensor"
+"/dev/sensor0" rw,
+"/dev/sensor1" rw,
+"/dev/sensor-ctl" r,
+"/sys/class/sensor/*/name" r,
+"/sys/devices/platform/sensor/enable" rw,
+`)
+}
+
+func (s *customDeviceInterfaceSuite) TestUDevConnectedPlug(c *C) {
+	spec := &udev.Specification{}
+	c.Assert(spec.AddConnectedPlug(s.iface, s.plug, s.slot), IsNil)
+	c.Assert(spec.Snippets(), HasLen, 4)
+	c.Check(spec.Snippets(), testutil.Contains, `# custom-device
+KERNEL=="sensor0", TAG+="snap_consumer_app"`)
+	c.Check(spec.Snippets(), testutil.Contains, `# custom-device
+KERNEL=="sensor1", TAG+="snap_consumer_app"`)
+	c.Check(spec.Snippets(), testutil.Contains, `# custom-device
+KERNEL=="sensor-ctl", TAG+="snap_consumer_app"`)
+	c.Check(spec.Snippets(), testutil.Contains, `TAG=="snap_consumer_app", RUN+="/usr/lib/snapd/snap-device-helper $env{ACTION} snap_consumer_app $devpath $major:$minor"`)
+}
+
+func (s *customDeviceInterfaceSuite) TestUDevConnectedPlugTagging(c *C) {
+	slotInfo := snaptest.MockInfo(c, `name: gadget
+version: 0
+type: gadget
+slots:
+ sensor:
+  interface: custom-device
+  devices:
+   - /dev/sensor0
+   - /dev/bus/sensor/*
+  udev-tagging:
+   - kernel: sensor[0-9]
+     subsystem: sensor
+     attributes:
+      idVendor: "1234"
+      idProduct: "abcd"
+   - kernel: sensor-ctl
+   - kernel: sensor-bus*
+`, nil).Slots["sensor"]
+	c.Assert(interfaces.BeforePrepareSlot(s.iface, slotInfo), IsNil)
+	slot := interfaces.NewConnectedSlot(slotInfo, nil, nil)
+
+	spec := &udev.Specification{}
+	c.Assert(spec.AddConnectedPlug(s.iface, s.plug, slot), IsNil)
+	c.Assert(spec.Snippets(), HasLen, 4)
+	c.Check(spec.Snippets(), testutil.Contains, `# custom-device
+KERNEL=="sensor-bus*", TAG+="snap_consumer_app"`)
+	c.Check(spec.Snippets(), testutil.Contains, `# custom-device
+KERNEL=="sensor[0-9]", SUBSYSTEM=="sensor", ATTRS{idProduct}=="abcd", ATTRS{idVendor}=="1234", TAG+="snap_consumer_app"`)
+	c.Check(spec.Snippets(), testutil.Contains, `# custom-device
+KERNEL=="sensor-ctl", TAG+="snap_consumer_app"`)
+}
+
+func (s *customDeviceInterfaceSuite) TestAutoConnect(c *C) {
+	c.Check(s.iface.AutoConnect(s.plugInfo, s.slotInfo), Equals, true)
+}
+
+func (s *customDeviceInterfaceSuite) TestInterfaces(c *C) {
+	c.Check(builtin.Interfaces(), testutil.DeepContains, s.iface)
+}
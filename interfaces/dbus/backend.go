@@ -112,6 +112,21 @@ func (b *Backend) Setup(snapInfo *snap.Info, opts interfaces.ConfinementOptions,
 	return nil
 }
 
+// Render returns the DBus configuration files Setup would write for a given
+// snap, indexed by their path, without writing them.
+func (b *Backend) Render(snapInfo *snap.Info, opts interfaces.ConfinementOptions, repo *interfaces.Repository) (map[string][]byte, error) {
+	snapName := snapInfo.InstanceName()
+	spec, err := repo.SnapSpecification(b.Name(), snapName)
+	if err != nil {
+		return nil, fmt.Errorf("cannot obtain dbus specification for snap %q: %s", snapName, err)
+	}
+	content, err := b.deriveContent(spec.(*Specification), snapInfo)
+	if err != nil {
+		return nil, fmt.Errorf("cannot obtain expected DBus configuration files for snap %q: %s", snapName, err)
+	}
+	return interfaces.RenderedFiles(dirs.SnapBusPolicyDir, content), nil
+}
+
 // Remove removes dbus configuration files of a given snap.
 //
 // This method should be called after removing a snap.
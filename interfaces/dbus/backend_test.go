@@ -103,6 +103,20 @@ func (s *backendSuite) TestInstallingSnapWithHookWritesConfigFiles(c *C) {
 	}
 }
 
+func (s *backendSuite) TestRenderingSnapDoesNotWriteConfigFiles(c *C) {
+	// NOTE: Hand out a permanent snippet so that .conf file is generated.
+	s.Iface.DBusPermanentSlotCallback = func(spec *dbus.Specification, slot *snap.SlotInfo) error {
+		spec.AddSnippet("<policy/>")
+		return nil
+	}
+	_, files := s.RenderSnap(c, interfaces.ConfinementOptions{}, ifacetest.SambaYamlV1, 0)
+	profile := filepath.Join(dirs.SnapBusPolicyDir, "snap.samba.smbd.conf")
+	c.Assert(files, HasLen, 1)
+	c.Check(string(files[profile]), testutil.Contains, "<policy/>")
+	_, err := os.Stat(profile)
+	c.Check(os.IsNotExist(err), Equals, true)
+}
+
 func (s *backendSuite) TestRemovingSnapRemovesConfigFiles(c *C) {
 	// NOTE: Hand out a permanent snippet so that .conf file is generated.
 	s.Iface.DBusPermanentSlotCallback = func(spec *dbus.Specification, slot *snap.SlotInfo) error {
@@ -0,0 +1,229 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package denials
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+)
+
+// appArmorRule is an allow rule of an AppArmor snippet, as far as it
+// can grant file, capability or network access.
+type appArmorRule struct {
+	// file rules
+	path  *regexp.Regexp
+	perms string
+	owner bool
+	// capability rules
+	capabilities []string
+	// network rules
+	family   string
+	sockType string
+}
+
+var appArmorPerms = regexp.MustCompile(`^[rwaklmixuUpPcCbB]+$`)
+
+// parseAppArmorRules returns the rules of the given snippet that grant
+// file, capability or network access. Rules granting any such access,
+// like "/** rw," or "capability,", are left out as they would match
+// every denial.
+func parseAppArmorRules(snippet string, vars map[string][]string) []*appArmorRule {
+	var rules []*appArmorRule
+lines:
+	for _, line := range strings.Split(snippet, "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if !strings.HasSuffix(line, ",") {
+			continue
+		}
+		fields := strings.Fields(strings.TrimSuffix(line, ","))
+		rule := &appArmorRule{}
+	qualifiers:
+		for len(fields) > 0 {
+			switch fields[0] {
+			case "audit", "allow":
+			case "owner":
+				rule.owner = true
+			case "deny":
+				continue lines
+			default:
+				break qualifiers
+			}
+			fields = fields[1:]
+		}
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "capability":
+			rule.capabilities = fields[1:]
+			if len(rule.capabilities) == 0 {
+				continue
+			}
+		case "network":
+			if len(fields) < 2 {
+				continue
+			}
+			rule.family = fields[1]
+			if len(fields) > 2 {
+				rule.sockType = fields[2]
+			}
+		default:
+			if fields[0] == "file" {
+				fields = fields[1:]
+			}
+			if len(fields) < 2 {
+				continue
+			}
+			path, perms := fields[0], fields[1]
+			if appArmorPerms.MatchString(path) {
+				path, perms = perms, path
+			}
+			path = strings.Trim(path, `"`)
+			if !appArmorPerms.MatchString(perms) || !(strings.HasPrefix(path, "/") || strings.HasPrefix(path, "@{")) {
+				continue
+			}
+			if strings.HasPrefix(path, "/**") || strings.HasPrefix(path, "/{,**}") {
+				continue
+			}
+			re, err := regexp.Compile("^" + appArmorGlobRegexp(path, vars) + "$")
+			if err != nil {
+				continue
+			}
+			rule.path = re
+			rule.perms = perms
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// appArmorGlobRegexp converts an AppArmor glob to a regular expression,
+// expanding the given variables. Unknown variables match anything but
+// a slash.
+func appArmorGlobRegexp(glob string, vars map[string][]string) string {
+	var buf bytes.Buffer
+	depth := 0
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case c == '@' && strings.HasPrefix(glob[i+1:], "{") && strings.Contains(glob[i:], "}"):
+			end := i + strings.Index(glob[i:], "}")
+			values, ok := vars[glob[i+2:end]]
+			if !ok {
+				buf.WriteString("[^/]*")
+			} else {
+				alternatives := make([]string, len(values))
+				for j, value := range values {
+					alternatives[j] = appArmorGlobRegexp(value, vars)
+				}
+				buf.WriteString("(?:" + strings.Join(alternatives, "|") + ")")
+			}
+			i = end
+		case c == '*':
+			if strings.HasPrefix(glob[i+1:], "*") {
+				buf.WriteString(".*")
+				i++
+			} else {
+				buf.WriteString("[^/]*")
+			}
+		case c == '?':
+			buf.WriteString("[^/]")
+		case c == '[' && strings.Contains(glob[i:], "]"):
+			end := i + strings.Index(glob[i:], "]")
+			buf.WriteString(glob[i : end+1])
+			i = end
+		case c == '{':
+			buf.WriteString("(?:")
+			depth++
+		case c == ',' && depth > 0:
+			buf.WriteString("|")
+		case c == '}' && depth > 0:
+			buf.WriteString(")")
+			depth--
+		case c == '\\' && i+1 < len(glob):
+			buf.WriteString(regexp.QuoteMeta(glob[i+1 : i+2]))
+			i++
+		default:
+			buf.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	return buf.String()
+}
+
+// grantsPerms returns whether the given rule permissions include the
+// ones of a denied mask.
+func grantsPerms(perms, mask string) bool {
+	for _, c := range mask {
+		var ok bool
+		switch c {
+		case 'a':
+			// writing allows appending
+			ok = strings.ContainsAny(perms, "aw")
+		case 'c', 'd':
+			// creating and deleting files are covered by writing
+			ok = strings.ContainsRune(perms, 'w')
+		case 'x':
+			ok = strings.ContainsRune(perms, 'x')
+		default:
+			ok = strings.ContainsRune(perms, c)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// appArmorRulesGrant returns whether the given rules together grant
+// what the AppArmor denial was about.
+func appArmorRulesGrant(rules []*appArmorRule, d *Denial) bool {
+	switch {
+	case d.Capability != "":
+		for _, rule := range rules {
+			for _, capability := range rule.capabilities {
+				if capability == d.Capability {
+					return true
+				}
+			}
+		}
+	case d.Family != "":
+		for _, rule := range rules {
+			if rule.family == d.Family && (rule.sockType == "" || rule.sockType == d.SockType) {
+				return true
+			}
+		}
+	case d.Path != "" && d.Mask != "":
+		// the permissions can be granted by several rules
+		var perms string
+		for _, rule := range rules {
+			if rule.path == nil || (rule.owner && !d.Owned) || !rule.path.MatchString(d.Path) {
+				continue
+			}
+			perms += rule.perms
+		}
+		return grantsPerms(perms, d.Mask)
+	}
+	return false
+}
@@ -0,0 +1,250 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package denials parses the AppArmor and seccomp denials that the
+// kernel logs for snaps and suggests interfaces that would grant the
+// denied access.
+package denials
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/snap"
+)
+
+const (
+	// AppArmor is the kind of denials made by AppArmor.
+	AppArmor = "apparmor"
+	// Seccomp is the kind of denials made by seccomp.
+	Seccomp = "seccomp"
+)
+
+// Denial is an AppArmor or seccomp denial logged for a snap.
+type Denial struct {
+	Kind string `json:"kind"`
+	// Snap is the instance name of the denied snap, and App or Hook
+	// is the denied app or hook if known.
+	Snap string `json:"snap"`
+	App  string `json:"app,omitempty"`
+	Hook string `json:"hook,omitempty"`
+
+	// Operation is the AppArmor operation, e.g. "open" or "capable".
+	Operation string `json:"operation,omitempty"`
+	// Path and Mask are the path and permissions AppArmor denied.
+	Path string `json:"path,omitempty"`
+	Mask string `json:"mask,omitempty"`
+	// Capability is the capability AppArmor denied.
+	Capability string `json:"capability,omitempty"`
+	// Family and SockType describe the socket AppArmor denied.
+	Family   string `json:"family,omitempty"`
+	SockType string `json:"sock-type,omitempty"`
+	// Syscall is the name of the system call seccomp denied, or its
+	// number if the name is not known.
+	Syscall string `json:"syscall,omitempty"`
+	// Owned is whether the denied file is owned by the process, which
+	// AppArmor owner rules require.
+	Owned bool `json:"owned,omitempty"`
+}
+
+// SecurityTag returns the security tag of the denied snap app or hook,
+// or "" if only the snap is known.
+func (d *Denial) SecurityTag() string {
+	switch {
+	case d.App != "":
+		return snap.AppSecurityTag(d.Snap, d.App)
+	case d.Hook != "":
+		return snap.HookSecurityTag(d.Snap, d.Hook)
+	}
+	return ""
+}
+
+// Key identifies the denials of the same access by the same snap app
+// or hook.
+func (d *Denial) Key() string {
+	tag := d.SecurityTag()
+	if tag == "" {
+		tag = snap.SecurityTag(d.Snap)
+	}
+	switch d.Kind {
+	case Seccomp:
+		return fmt.Sprintf("%s %s %s", tag, d.Kind, d.Syscall)
+	case AppArmor:
+		return fmt.Sprintf("%s %s %s %s%s%s%s %s", tag, d.Kind, d.Operation, d.Path, d.Capability, d.Family, d.SockType, d.Mask)
+	}
+	return ""
+}
+
+// ParseSecurityTag splits the security tag of a snap app or hook, as
+// used for AppArmor profiles, into the snap instance name and the app
+// or hook name.
+func ParseSecurityTag(tag string) (snapName, app, hook string, err error) {
+	parts := strings.Split(tag, ".")
+	switch {
+	case len(parts) == 3 && parts[0] == "snap":
+		snapName, app = parts[1], parts[2]
+	case len(parts) == 4 && parts[0] == "snap" && parts[2] == "hook":
+		snapName, hook = parts[1], parts[3]
+	default:
+		return "", "", "", fmt.Errorf("invalid security tag %q", tag)
+	}
+	if err := snap.ValidateInstanceName(snapName); err != nil {
+		return "", "", "", fmt.Errorf("invalid security tag %q: %v", tag, err)
+	}
+	return snapName, app, hook, nil
+}
+
+var auditField = regexp.MustCompile(`([a-z_]+)=("[^"]*"|[^ ]*)`)
+
+func parseAuditFields(msg string) map[string]string {
+	fields := make(map[string]string)
+	for _, m := range auditField.FindAllStringSubmatch(msg, -1) {
+		key, value := m[1], m[2]
+		if strings.HasPrefix(value, `"`) {
+			value = value[1 : len(value)-1]
+		} else if key == "name" || key == "profile" || key == "label" || key == "comm" || key == "exe" {
+			// the kernel logs these hex encoded, without quotes,
+			// when they contain spaces or other unusual characters
+			if decoded, err := hex.DecodeString(value); err == nil {
+				value = string(decoded)
+			}
+		}
+		fields[key] = value
+	}
+	return fields
+}
+
+var (
+	// seccomp return actions that are not denials, see seccomp(2)
+	seccompRetLog   = uint64(0x7ffc0000)
+	seccompRetAllow = uint64(0x7fff0000)
+)
+
+// Parse returns the denial logged with the given kernel or audit
+// message, or nil if the message is not about a denial for a snap.
+func Parse(msg string) (*Denial, error) {
+	if !strings.Contains(msg, "apparmor=") && !strings.Contains(msg, "syscall=") {
+		return nil, nil
+	}
+	fields := parseAuditFields(msg)
+	switch {
+	case fields["apparmor"] == "DENIED":
+		return parseAppArmorDenial(fields)
+	case fields["syscall"] != "" && fields["arch"] != "" && fields["code"] != "":
+		return parseSeccompDenial(fields)
+	}
+	return nil, nil
+}
+
+func parseAppArmorDenial(fields map[string]string) (*Denial, error) {
+	profile := fields["profile"]
+	if profile == "" {
+		// dbus-daemon logs the label of the peer
+		profile = fields["label"]
+	}
+	// denials in child profiles are attributed to the parent
+	if i := strings.Index(profile, "//"); i >= 0 {
+		profile = profile[:i]
+	}
+	if !strings.HasPrefix(profile, "snap.") {
+		return nil, nil
+	}
+	snapName, app, hook, err := ParseSecurityTag(profile)
+	if err != nil {
+		return nil, err
+	}
+	d := &Denial{
+		Kind:       AppArmor,
+		Snap:       snapName,
+		App:        app,
+		Hook:       hook,
+		Operation:  fields["operation"],
+		Path:       fields["name"],
+		Mask:       fields["denied_mask"],
+		Capability: fields["capname"],
+		Family:     fields["family"],
+		SockType:   fields["sock_type"],
+		Owned:      fields["fsuid"] != "" && fields["fsuid"] == fields["ouid"],
+	}
+	return d, nil
+}
+
+var procPidDir = func(pid string) string {
+	return filepath.Join("/proc", pid)
+}
+
+// seccompDenialSnap returns the snap, and the app or hook if known, of
+// the process that made a denied system call. The app or hook is known
+// if the process is still running, otherwise only the snap its
+// executable is in is.
+func seccompDenialSnap(fields map[string]string) (snapName, app, hook string) {
+	pid := fields["pid"]
+	if _, err := strconv.Atoi(pid); err == nil {
+		// the pid could have been reused since, check the
+		// process still looks the same
+		comm, err := ioutil.ReadFile(filepath.Join(procPidDir(pid), "comm"))
+		if err == nil && strings.TrimSpace(string(comm)) == fields["comm"] {
+			label, err := ioutil.ReadFile(filepath.Join(procPidDir(pid), "attr", "current"))
+			// the label is followed by the mode, e.g. " (enforce)"
+			if tag := strings.Fields(string(label)); err == nil && len(tag) > 0 {
+				if snapName, app, hook, err := ParseSecurityTag(tag[0]); err == nil {
+					return snapName, app, hook
+				}
+			}
+		}
+	}
+	if rel, err := filepath.Rel(dirs.SnapMountDir, fields["exe"]); err == nil && !strings.HasPrefix(rel, "../") {
+		if snapName := strings.Split(rel, "/")[0]; snap.ValidateInstanceName(snapName) == nil {
+			return snapName, "", ""
+		}
+	}
+	return "", "", ""
+}
+
+func parseSeccompDenial(fields map[string]string) (*Denial, error) {
+	code, err := strconv.ParseUint(fields["code"], 0, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid seccomp code %q", fields["code"])
+	}
+	// the action is in the upper 16 bits
+	if action := code & 0xffff0000; action == seccompRetLog || action == seccompRetAllow {
+		return nil, nil
+	}
+	nr, err := strconv.Atoi(fields["syscall"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid seccomp syscall %q", fields["syscall"])
+	}
+
+	d := &Denial{Kind: Seccomp}
+	d.Snap, d.App, d.Hook = seccompDenialSnap(fields)
+	if d.Snap == "" {
+		return nil, nil
+	}
+	d.Syscall = syscallName(fields["arch"], nr)
+	if d.Syscall == "" {
+		d.Syscall = strconv.Itoa(nr)
+	}
+	return d, nil
+}
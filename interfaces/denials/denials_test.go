@@ -0,0 +1,182 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package denials_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/interfaces/denials"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type denialsSuite struct {
+	procDir string
+	restore func()
+}
+
+var _ = Suite(&denialsSuite{})
+
+func (s *denialsSuite) SetUpTest(c *C) {
+	dirs.SetRootDir(c.MkDir())
+	s.procDir = c.MkDir()
+	s.restore = denials.MockProcPidDir(func(pid string) string {
+		return filepath.Join(s.procDir, pid)
+	})
+}
+
+func (s *denialsSuite) TearDownTest(c *C) {
+	s.restore()
+	dirs.SetRootDir("")
+}
+
+func (s *denialsSuite) mockProcess(c *C, pid, comm, label string) {
+	dir := filepath.Join(s.procDir, pid, "attr")
+	c.Assert(os.MkdirAll(dir, 0755), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(s.procDir, pid, "comm"), []byte(comm+"\n"), 0644), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "current"), []byte(label+"\n"), 0644), IsNil)
+}
+
+func (s *denialsSuite) TestParseAppArmorFile(c *C) {
+	d, err := denials.Parse(`audit: type=1400 audit(1552475541.123:42): apparmor="DENIED" operation="open" profile="snap.foo.bar" name="/etc/shadow" pid=1234 comm="bar" requested_mask="r" denied_mask="r" fsuid=1000 ouid=0`)
+	c.Assert(err, IsNil)
+	c.Check(d, DeepEquals, &denials.Denial{
+		Kind:      denials.AppArmor,
+		Snap:      "foo",
+		App:       "bar",
+		Operation: "open",
+		Path:      "/etc/shadow",
+		Mask:      "r",
+	})
+	c.Check(d.SecurityTag(), Equals, "snap.foo.bar")
+	c.Check(d.Key(), Equals, "snap.foo.bar apparmor open /etc/shadow r")
+}
+
+func (s *denialsSuite) TestParseAppArmorHookCapability(c *C) {
+	// as logged via the audit transport
+	d, err := denials.Parse(`AVC apparmor="DENIED" operation="capable" profile="snap.foo_instance.hook.configure" pid=1234 comm="configure" capability=12  capname="net_admin"`)
+	c.Assert(err, IsNil)
+	c.Check(d, DeepEquals, &denials.Denial{
+		Kind:       denials.AppArmor,
+		Snap:       "foo_instance",
+		Hook:       "configure",
+		Operation:  "capable",
+		Capability: "net_admin",
+	})
+	c.Check(d.SecurityTag(), Equals, "snap.foo_instance.hook.configure")
+}
+
+func (s *denialsSuite) TestParseAppArmorHexName(c *C) {
+	d, err := denials.Parse(`apparmor="DENIED" operation="mknod" profile="snap.foo.bar//null-/usr/bin/baz" name=2F746D702F6120622F pid=1 comm="baz" requested_mask="c" denied_mask="c" fsuid=0 ouid=0`)
+	c.Assert(err, IsNil)
+	c.Check(d.App, Equals, "bar")
+	c.Check(d.Path, Equals, "/tmp/a b/")
+}
+
+func (s *denialsSuite) TestParseIgnored(c *C) {
+	for _, msg := range []string{
+		`usb 1-1: new high-speed USB device number 2 using xhci_hcd`,
+		`apparmor="STATUS" operation="profile_load" profile="unconfined" name="snap.foo.bar" pid=1 comm="apparmor_parser"`,
+		`apparmor="DENIED" operation="open" profile="/usr/sbin/cupsd" name="/etc/shadow" pid=1 comm="cupsd" requested_mask="r" denied_mask="r"`,
+		`apparmor="ALLOWED" operation="open" profile="snap.foo.bar" name="/etc/shadow" pid=1 comm="bar" requested_mask="r" denied_mask="r"`,
+		// seccomp logging allowed calls
+		`type=1326 audit(1552475541.123:43): auid=1000 uid=1000 gid=1000 ses=2 pid=1 comm="bar" exe="/snap/foo/1/bin/bar" sig=0 arch=c000003e syscall=165 compat=0 ip=0x7f code=0x7ffc0000`,
+		// seccomp denial outside of snaps
+		`type=1326 audit(1552475541.123:43): auid=1000 uid=1000 gid=1000 ses=2 pid=1 comm="bar" exe="/usr/bin/bar" sig=31 arch=c000003e syscall=165 compat=0 ip=0x7f code=0x0`,
+	} {
+		d, err := denials.Parse(msg)
+		c.Check(err, IsNil, Commentf(msg))
+		c.Check(d, IsNil, Commentf(msg))
+	}
+}
+
+func (s *denialsSuite) TestParseErrors(c *C) {
+	_, err := denials.Parse(`apparmor="DENIED" operation="open" profile="snap.foo" name="/etc/shadow"`)
+	c.Check(err, ErrorMatches, `invalid security tag "snap.foo"`)
+	_, err = denials.Parse(`apparmor="DENIED" operation="open" profile="snap.Foo.bar" name="/etc/shadow"`)
+	c.Check(err, ErrorMatches, `invalid security tag "snap.Foo.bar": invalid snap name: "Foo"`)
+	_, err = denials.Parse(`type=1326 pid=1 comm="bar" exe="/snap/foo/1/bin/bar" arch=c000003e syscall=nope code=0x0`)
+	c.Check(err, ErrorMatches, `invalid seccomp syscall "nope"`)
+	_, err = denials.Parse(`type=1326 pid=1 comm="bar" exe="/snap/foo/1/bin/bar" arch=c000003e syscall=1 code=nope`)
+	c.Check(err, ErrorMatches, `invalid seccomp code "nope"`)
+}
+
+func (s *denialsSuite) TestParseSeccompRunning(c *C) {
+	s.mockProcess(c, "1234", "bar", "snap.foo.bar (enforce)")
+
+	d, err := denials.Parse(`audit: type=1326 audit(1552475541.123:43): auid=1000 uid=1000 gid=1000 ses=2 pid=1234 comm="bar" exe="/usr/bin/python3" sig=31 arch=c000003e syscall=165 compat=0 ip=0x7f code=0x0`)
+	c.Assert(err, IsNil)
+	c.Check(d, DeepEquals, &denials.Denial{
+		Kind:    denials.Seccomp,
+		Snap:    "foo",
+		App:     "bar",
+		Syscall: "mount",
+	})
+	c.Check(d.Key(), Equals, "snap.foo.bar seccomp mount")
+}
+
+func (s *denialsSuite) TestParseSeccompExited(c *C) {
+	// the pid was reused by another process
+	s.mockProcess(c, "1234", "other", "snap.other.app (enforce)")
+
+	d, err := denials.Parse(`SECCOMP auid=1000 uid=1000 gid=1000 ses=2 pid=1234 comm="bar" exe="` + dirs.SnapMountDir + `/foo/x1/bin/bar" sig=0 arch=c00000b7 syscall=1000 compat=0 ip=0x7f code=0x50000`)
+	c.Assert(err, IsNil)
+	c.Check(d, DeepEquals, &denials.Denial{
+		Kind:    denials.Seccomp,
+		Snap:    "foo",
+		Syscall: "1000",
+	})
+	c.Check(d.SecurityTag(), Equals, "")
+	c.Check(d.Key(), Equals, "snap.foo seccomp 1000")
+}
+
+func (s *denialsSuite) TestParseSecurityTag(c *C) {
+	for _, t := range []struct {
+		tag, snap, app, hook string
+	}{
+		{"snap.foo.bar", "foo", "bar", ""},
+		{"snap.foo_baz.bar", "foo_baz", "bar", ""},
+		{"snap.foo.hook.install", "foo", "", "install"},
+	} {
+		snapName, app, hook, err := denials.ParseSecurityTag(t.tag)
+		c.Check(err, IsNil)
+		c.Check([]string{snapName, app, hook}, DeepEquals, []string{t.snap, t.app, t.hook})
+	}
+	for _, tag := range []string{"snap.foo", "snap-update-ns.foo", "snap.foo.bar.baz", "snap..bar"} {
+		_, _, _, err := denials.ParseSecurityTag(tag)
+		c.Check(err, NotNil, Commentf(tag))
+	}
+}
+
+func (s *denialsSuite) TestSyscallName(c *C) {
+	c.Check(denials.SyscallName("c000003e", 0), Equals, "read")
+	c.Check(denials.SyscallName("c000003e", 321), Equals, "bpf")
+	c.Check(denials.SyscallName("40000003", 1), Equals, "exit")
+	c.Check(denials.SyscallName("c00000b7", 280), Equals, "bpf")
+	c.Check(denials.SyscallName("c000003e", 400), Equals, "")
+	c.Check(denials.SyscallName("c000003e", -1), Equals, "")
+	c.Check(denials.SyscallName("deadbeef", 0), Equals, "")
+}
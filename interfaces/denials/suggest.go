@@ -0,0 +1,167 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package denials
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/snapcore/snapd/interfaces"
+	"github.com/snapcore/snapd/interfaces/apparmor"
+	"github.com/snapcore/snapd/interfaces/builtin"
+	"github.com/snapcore/snapd/interfaces/dbus"
+	"github.com/snapcore/snapd/interfaces/seccomp"
+	"github.com/snapcore/snapd/snap"
+)
+
+// snippets are the AppArmor and seccomp snippets an interface adds to
+// the profiles of a snap when a plug of it is connected.
+type snippets struct {
+	appArmor *apparmor.Specification
+	seccomp  *seccomp.Specification
+}
+
+// Suggester suggests the interfaces that would grant the access a snap
+// was denied.
+type Suggester struct {
+	info   *snap.Info
+	system *snap.Info
+	// snippets by interface name, computed on first use
+	snippets map[string]*snippets
+}
+
+// NewSuggester returns a Suggester for the denials of the given snap.
+func NewSuggester(info *snap.Info) *Suggester {
+	return &Suggester{
+		info:   info,
+		system: &snap.Info{SuggestedName: "core", Type: snap.TypeOS},
+	}
+}
+
+func (s *Suggester) computeSnippets() {
+	s.snippets = make(map[string]*snippets)
+	for _, iface := range builtin.Interfaces() {
+		// connect a plug used by all apps and hooks of the snap to
+		// a slot of the system snap
+		plug := &snap.PlugInfo{
+			Snap:      s.info,
+			Name:      iface.Name(),
+			Interface: iface.Name(),
+			Apps:      s.info.Apps,
+			Hooks:     s.info.Hooks,
+		}
+		slot := &snap.SlotInfo{
+			Snap:      s.system,
+			Name:      iface.Name(),
+			Interface: iface.Name(),
+		}
+		// interfaces that need attributes to be set fail here and
+		// are not suggested
+		if err := interfaces.BeforePreparePlug(iface, plug); err != nil {
+			continue
+		}
+		if err := interfaces.BeforePrepareSlot(iface, slot); err != nil {
+			continue
+		}
+		connectedPlug := interfaces.NewConnectedPlug(plug, nil, nil)
+		connectedSlot := interfaces.NewConnectedSlot(slot, nil, nil)
+
+		sn := &snippets{appArmor: &apparmor.Specification{}, seccomp: &seccomp.Specification{}}
+		if err := sn.appArmor.AddConnectedPlug(iface, connectedPlug, connectedSlot); err != nil {
+			continue
+		}
+		if err := sn.seccomp.AddConnectedPlug(iface, connectedPlug, connectedSlot); err != nil {
+			continue
+		}
+		s.snippets[iface.Name()] = sn
+	}
+}
+
+// appArmorVariables returns the values of the AppArmor variables used
+// by the snippets of the interfaces, as globs. Unlike AppArmor, matching
+// does not collapse repeated slashes so the directories are given
+// without a trailing one: the snippets use e.g. "@{PROC}/cpuinfo".
+func (s *Suggester) appArmorVariables(securityTag string) map[string][]string {
+	return map[string][]string{
+		"HOME":               {"/home/*", "/root"},
+		"HOMEDIRS":           {"/home"},
+		"PROC":               {"/proc"},
+		"sys":                {"/sys"},
+		"run":                {"/run", "/var/run"},
+		"pid":                {"[1-9]*"},
+		"pids":               {"[1-9]*"},
+		"tid":                {"[1-9]*"},
+		"multiarch":          {"*-linux-gnu*"},
+		"SNAP_NAME":          {s.info.SnapName()},
+		"SNAP_INSTANCE_NAME": {s.info.InstanceName()},
+		"SNAP_REVISION":      {s.info.Revision.String()},
+		"INSTALL_DIR":        {"/{,var/lib/snapd/}snap"},
+		"PROFILE_DBUS":       {dbus.SafePath(securityTag)},
+	}
+}
+
+// seccompSnippetGrants returns whether the given seccomp snippet allows
+// the given system call, whatever its arguments.
+func seccompSnippetGrants(snippet, syscall string) bool {
+	for _, line := range strings.Split(snippet, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && fields[0] == syscall {
+			return true
+		}
+	}
+	return false
+}
+
+// Suggest returns, sorted, the names of the interfaces whose connected
+// plugs would grant the access in the given denial of the snap. The app
+// or hook of the denial must be known.
+func (s *Suggester) Suggest(d *Denial) []string {
+	tag := d.SecurityTag()
+	if tag == "" {
+		return nil
+	}
+	if s.snippets == nil {
+		s.computeSnippets()
+	}
+
+	var vars map[string][]string
+	var suggested []string
+	for name, sn := range s.snippets {
+		var grants bool
+		switch d.Kind {
+		case AppArmor:
+			snippet := sn.appArmor.SnippetForTag(tag)
+			if snippet == "" {
+				continue
+			}
+			if vars == nil {
+				vars = s.appArmorVariables(tag)
+			}
+			grants = appArmorRulesGrant(parseAppArmorRules(snippet, vars), d)
+		case Seccomp:
+			grants = seccompSnippetGrants(sn.seccomp.SnippetForTag(tag), d.Syscall)
+		}
+		if grants {
+			suggested = append(suggested, name)
+		}
+	}
+	sort.Strings(suggested)
+	return suggested
+}
@@ -0,0 +1,111 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package denials_test
+
+import (
+	"regexp"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/interfaces/denials"
+	"github.com/snapcore/snapd/snap/snaptest"
+)
+
+type suggestSuite struct{}
+
+var _ = Suite(&suggestSuite{})
+
+const suggestSnapYaml = `name: foo
+version: 1
+apps:
+  app:
+hooks:
+  configure:
+`
+
+func (s *suggestSuite) TestSuggest(c *C) {
+	info := snaptest.MockInfo(c, suggestSnapYaml, nil)
+	suggester := denials.NewSuggester(info)
+
+	for _, t := range []struct {
+		denial    *denials.Denial
+		suggested []string
+	}{
+		{&denials.Denial{Kind: denials.AppArmor, Snap: "foo", App: "app", Operation: "open", Path: "/dev/video0", Mask: "rw"}, []string{"camera"}},
+		// owner rules need the file to be owned
+		{&denials.Denial{Kind: denials.AppArmor, Snap: "foo", App: "app", Operation: "open", Path: "/home/jo/.ssh/id_rsa", Mask: "r", Owned: true}, []string{"ssh-keys"}},
+		{&denials.Denial{Kind: denials.AppArmor, Snap: "foo", App: "app", Operation: "open", Path: "/home/jo/.ssh/id_rsa", Mask: "r"}, nil},
+		// ssh-keys grants reading only
+		{&denials.Denial{Kind: denials.AppArmor, Snap: "foo", App: "app", Operation: "open", Path: "/home/jo/.ssh/id_rsa", Mask: "w", Owned: true}, nil},
+		{&denials.Denial{Kind: denials.AppArmor, Snap: "foo", Hook: "configure", Operation: "capable", Capability: "net_admin"}, []string{"bluetooth-control", "firewall-control", "kubernetes-support", "netlink-audit", "netlink-connector", "network-control"}},
+		{&denials.Denial{Kind: denials.Seccomp, Snap: "foo", App: "app", Syscall: "bpf"}, []string{"docker-support", "system-trace"}},
+		// the app is not known
+		{&denials.Denial{Kind: denials.Seccomp, Snap: "foo", Syscall: "bpf"}, nil},
+		{&denials.Denial{Kind: denials.Seccomp, Snap: "foo", App: "app", Syscall: "1000"}, nil},
+	} {
+		c.Check(suggester.Suggest(t.denial), DeepEquals, t.suggested, Commentf("%s", t.denial.Key()))
+	}
+}
+
+func (s *suggestSuite) TestAppArmorGlobRegexp(c *C) {
+	vars := map[string][]string{
+		"HOME": {"/home/*", "/root"},
+		"pid":  {"[1-9]*"},
+	}
+	for _, t := range []struct {
+		glob    string
+		matches []string
+		misses  []string
+	}{
+		{"/dev/video[0-9]*", []string{"/dev/video0", "/dev/video12"}, []string{"/dev/video", "/dev/video0/x"}},
+		{"/sys/**", []string{"/sys/a", "/sys/a/b/c"}, []string{"/sys"}},
+		{"/etc/{,foo/}bar?", []string{"/etc/bar1", "/etc/foo/bar2"}, []string{"/etc/baz/bar1"}},
+		{"@{HOME}/.ssh/{,**}", []string{"/home/jo/.ssh/", "/root/.ssh/id_rsa"}, []string{"/home/.ssh/x"}},
+		{"/proc/@{pid}/@{unknown}", []string{"/proc/1/stat"}, []string{"/proc/self/stat"}},
+		{`/a\*b.c`, []string{"/a*b.c"}, []string{"/axb.c", "/a*bxc"}},
+	} {
+		re := regexp.MustCompile("^" + denials.AppArmorGlobRegexp(t.glob, vars) + "$")
+		for _, path := range t.matches {
+			c.Check(re.MatchString(path), Equals, true, Commentf("%s %s", t.glob, path))
+		}
+		for _, path := range t.misses {
+			c.Check(re.MatchString(path), Equals, false, Commentf("%s %s", t.glob, path))
+		}
+	}
+}
+
+func (s *suggestSuite) TestGrantsPerms(c *C) {
+	c.Check(denials.GrantsPerms("rw", "r"), Equals, true)
+	c.Check(denials.GrantsPerms("rw", "a"), Equals, true)
+	c.Check(denials.GrantsPerms("rw", "c"), Equals, true)
+	c.Check(denials.GrantsPerms("r", "w"), Equals, false)
+	c.Check(denials.GrantsPerms("rix", "rx"), Equals, true)
+	c.Check(denials.GrantsPerms("rPx", "x"), Equals, true)
+	c.Check(denials.GrantsPerms("rw", "k"), Equals, false)
+	c.Check(denials.GrantsPerms("", "r"), Equals, false)
+}
+
+func (s *suggestSuite) TestSeccompSnippetGrants(c *C) {
+	snippet := "# Description: foo\nmount\numount2\nsocket AF_NETLINK - NETLINK_ROUTE\n"
+	c.Check(denials.SeccompSnippetGrants(snippet, "mount"), Equals, true)
+	c.Check(denials.SeccompSnippetGrants(snippet, "socket"), Equals, true)
+	c.Check(denials.SeccompSnippetGrants(snippet, "umount"), Equals, false)
+	c.Check(denials.SeccompSnippetGrants(snippet, "Description:"), Equals, false)
+}
@@ -34,6 +34,8 @@ type TestSecurityBackend struct {
 	RemoveCalls []string
 	// SetupCallback is an callback that is optionally called in Setup
 	SetupCallback func(snapInfo *snap.Info, opts interfaces.ConfinementOptions, repo *interfaces.Repository) error
+	// RenderCallback is a callback that is optionally called in Render
+	RenderCallback func(snapInfo *snap.Info, opts interfaces.ConfinementOptions, repo *interfaces.Repository) (map[string][]byte, error)
 	// RemoveCallback is a callback that is optionally called in Remove
 	RemoveCallback func(snapName string) error
 	// SandboxFeaturesCallback is a callback that is optionally called in SandboxFeatures
@@ -67,6 +69,14 @@ func (b *TestSecurityBackend) Setup(snapInfo *snap.Info, opts interfaces.Confine
 	return b.SetupCallback(snapInfo, opts, repo)
 }
 
+// Render calls the render callback if one is defined.
+func (b *TestSecurityBackend) Render(snapInfo *snap.Info, opts interfaces.ConfinementOptions, repo *interfaces.Repository) (map[string][]byte, error) {
+	if b.RenderCallback == nil {
+		return nil, nil
+	}
+	return b.RenderCallback(snapInfo, opts, repo)
+}
+
 // Remove records information about the call and calls the remove callback if one is defined
 func (b *TestSecurityBackend) Remove(snapName string) error {
 	b.RemoveCalls = append(b.RemoveCalls, snapName)
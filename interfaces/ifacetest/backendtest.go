@@ -190,6 +190,18 @@ func (s *BackendSuite) RemoveSnap(c *C, snapInfo *snap.Info) {
 	s.removePlugsSlots(c, snapInfo)
 }
 
+// RenderSnap "installs" a snap into the repository and renders its security
+// artefacts with the backend, without setting them up.
+func (s *BackendSuite) RenderSnap(c *C, opts interfaces.ConfinementOptions, snapYaml string, revision int) (*snap.Info, map[string][]byte) {
+	snapInfo := snaptest.MockInfo(c, snapYaml, &snap.SideInfo{
+		Revision: snap.R(revision),
+	})
+	s.addPlugsSlots(c, snapInfo)
+	files, err := s.Backend.Render(snapInfo, opts, s.Repo)
+	c.Assert(err, IsNil)
+	return snapInfo, files
+}
+
 func (s *BackendSuite) addPlugsSlots(c *C, snapInfo *snap.Info) {
 	for _, plugInfo := range snapInfo.Plugs {
 		err := s.Repo.AddPlug(plugInfo)
@@ -94,6 +94,18 @@ func (b *Backend) Setup(snapInfo *snap.Info, confinement interfaces.ConfinementO
 	return nil
 }
 
+// Render returns the modules config file Setup would write for a given snap,
+// indexed by its path. Nothing is written and no module is loaded.
+func (b *Backend) Render(snapInfo *snap.Info, confinement interfaces.ConfinementOptions, repo *interfaces.Repository) (map[string][]byte, error) {
+	snapName := snapInfo.InstanceName()
+	spec, err := repo.SnapSpecification(b.Name(), snapName)
+	if err != nil {
+		return nil, fmt.Errorf("cannot obtain kmod specification for snap %q: %s", snapName, err)
+	}
+	content, _ := deriveContent(spec.(*Specification), snapInfo)
+	return interfaces.RenderedFiles(dirs.SnapKModModulesDir, content), nil
+}
+
 // Remove removes modules config file specific to a given snap.
 //
 // This method should be called after removing a snap.
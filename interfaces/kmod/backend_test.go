@@ -99,6 +99,23 @@ func (s *backendSuite) TestInstallingSnapCreatesModulesConf(c *C) {
 	}
 }
 
+func (s *backendSuite) TestRenderingSnapDoesNotCreateModulesConf(c *C) {
+	// NOTE: Hand out a permanent snippet so that .conf file is generated.
+	s.Iface.KModPermanentSlotCallback = func(spec *kmod.Specification, slot *snap.SlotInfo) error {
+		spec.AddModule("module1")
+		spec.AddModule("module2")
+		return nil
+	}
+
+	path := filepath.Join(dirs.SnapKModModulesDir, "snap.samba.conf")
+	_, files := s.RenderSnap(c, interfaces.ConfinementOptions{}, ifacetest.SambaYamlV1, 0)
+	c.Check(files, DeepEquals, map[string][]byte{
+		path: []byte("# This file is automatically generated.\nmodule1\nmodule2\n"),
+	})
+	c.Check(osutil.FileExists(path), Equals, false)
+	c.Check(s.modprobeCmd.Calls(), HasLen, 0)
+}
+
 func (s *backendSuite) TestRemovingSnapRemovesModulesConf(c *C) {
 	// NOTE: Hand out a permanent snippet so that .conf file is generated.
 	s.Iface.KModPermanentSlotCallback = func(spec *kmod.Specification, slot *snap.SlotInfo) error {
@@ -80,6 +80,20 @@ func (b *Backend) Setup(snapInfo *snap.Info, confinement interfaces.ConfinementO
 	return nil
 }
 
+// Render returns the mount configuration files Setup would write for a given
+// snap, indexed by their path. The mount namespace is left untouched.
+func (b *Backend) Render(snapInfo *snap.Info, confinement interfaces.ConfinementOptions, repo *interfaces.Repository) (map[string][]byte, error) {
+	snapName := snapInfo.InstanceName()
+	spec, err := repo.SnapSpecification(b.Name(), snapName)
+	if err != nil {
+		return nil, fmt.Errorf("cannot obtain mount security snippets for snap %q: %s", snapName, err)
+	}
+	spec.(*Specification).AddOvername(snapInfo)
+	spec.(*Specification).AddLayout(snapInfo)
+	content := deriveContent(spec.(*Specification), snapInfo)
+	return interfaces.RenderedFiles(dirs.SnapMountPolicyDir, content), nil
+}
+
 // Remove removes mount configuration files of a given snap.
 //
 // This method should be called after removing a snap.
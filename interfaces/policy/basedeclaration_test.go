@@ -568,6 +568,7 @@ var (
 		"browser-support":         {"core"},
 		"content":                 {"app", "gadget"},
 		"core-support":            {"core"},
+		"custom-device":           {"core", "gadget"},
 		"dbus":                    {"app"},
 		"docker-support":          {"core"},
 		"fwupd":                   {"app"},
@@ -729,6 +730,7 @@ func (s *baseDeclSuite) TestConnection(c *C) {
 	// case-by-case basis
 	noconnect := map[string]bool{
 		"content":                   true,
+		"custom-device":             true,
 		"docker":                    true,
 		"fwupd":                     true,
 		"location-control":          true,
@@ -899,6 +901,53 @@ plugs:
 	c.Check(err, NotNil)
 }
 
+func (s *baseDeclSuite) TestConnectionCustomDevice(c *C) {
+	// we let connect explicitly as long as the custom-device names match
+
+	cand := s.connectCand(c, "sensor", `name: gadget
+version: 0
+type: gadget
+slots:
+  sensor:
+    interface: custom-device
+    custom-device: sensor
+    devices: [/dev/sensor0]
+`, `
+name: plug-snap
+version: 0
+plugs:
+  sensor:
+    interface: custom-device
+    custom-device: sensor
+`)
+	err := cand.Check()
+	c.Check(err, IsNil)
+
+	// but never auto-connect
+	err = cand.CheckAutoConnect()
+	c.Check(err, NotNil)
+
+	// different custom-device
+	cand = s.connectCand(c, "sensor", `name: gadget
+version: 0
+type: gadget
+slots:
+  sensor:
+    interface: custom-device
+    custom-device: sensor
+    devices: [/dev/sensor0]
+`, `
+name: plug-snap
+version: 0
+plugs:
+  sensor:
+    interface: custom-device
+    custom-device: camera
+`)
+	err = cand.Check()
+	c.Check(err, NotNil)
+}
+
 func (s *baseDeclSuite) TestComposeBaseDeclaration(c *C) {
 	decl, err := policy.ComposeBaseDeclaration(nil)
 	c.Assert(err, IsNil)
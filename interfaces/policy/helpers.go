@@ -166,8 +166,9 @@ func checkPlugConnectionConstraints1(connc *ConnectCandidate, cstrs *asserts.Plu
 func checkPlugConnectionConstraints(connc *ConnectCandidate, cstrs []*asserts.PlugConnectionConstraints) error {
 	var firstErr error
 	// OR of constraints
-	for _, cstrs1 := range cstrs {
+	for i, cstrs1 := range cstrs {
 		err := checkPlugConnectionConstraints1(connc, cstrs1)
+		connc.Trace.alternative(i+1, err)
 		if err == nil {
 			return nil
 		}
@@ -209,8 +210,9 @@ func checkSlotConnectionConstraints1(connc *ConnectCandidate, cstrs *asserts.Slo
 func checkSlotConnectionConstraints(connc *ConnectCandidate, cstrs []*asserts.SlotConnectionConstraints) error {
 	var firstErr error
 	// OR of constraints
-	for _, cstrs1 := range cstrs {
+	for i, cstrs1 := range cstrs {
 		err := checkSlotConnectionConstraints1(connc, cstrs1)
+		connc.Trace.alternative(i+1, err)
 		if err == nil {
 			return nil
 		}
@@ -241,8 +243,9 @@ func checkSlotInstallationConstraints1(ic *InstallCandidate, slot *snap.SlotInfo
 func checkSlotInstallationConstraints(ic *InstallCandidate, slot *snap.SlotInfo, cstrs []*asserts.SlotInstallationConstraints) error {
 	var firstErr error
 	// OR of constraints
-	for _, cstrs1 := range cstrs {
+	for i, cstrs1 := range cstrs {
 		err := checkSlotInstallationConstraints1(ic, slot, cstrs1)
+		ic.Trace.alternative(i+1, err)
 		if err == nil {
 			return nil
 		}
@@ -273,8 +276,9 @@ func checkPlugInstallationConstraints1(ic *InstallCandidate, plug *snap.PlugInfo
 func checkPlugInstallationConstraints(ic *InstallCandidate, plug *snap.PlugInfo, cstrs []*asserts.PlugInstallationConstraints) error {
 	var firstErr error
 	// OR of constraints
-	for _, cstrs1 := range cstrs {
+	for i, cstrs1 := range cstrs {
 		err := checkPlugInstallationConstraints1(ic, plug, cstrs1)
+		ic.Trace.alternative(i+1, err)
 		if err == nil {
 			return nil
 		}
@@ -0,0 +1,192 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package policy
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/snapcore/snapd/interfaces"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/snap"
+)
+
+// LocalDecision is what a local policy rule decides.
+type LocalDecision string
+
+const (
+	LocalAllow LocalDecision = "allow"
+	LocalDeny  LocalDecision = "deny"
+)
+
+// LocalRule is a rule of a device-local interface policy. The empty
+// selectors match anything, the non-empty ones must all match.
+type LocalRule struct {
+	Interface string `yaml:"interface,omitempty"`
+	PlugSnap  string `yaml:"plug-snap,omitempty"`
+	Plug      string `yaml:"plug,omitempty"`
+	// SlotSnap can be "system" to match the slots of the core or
+	// snapd snap, whichever provides them.
+	SlotSnap string `yaml:"slot-snap,omitempty"`
+	Slot     string `yaml:"slot,omitempty"`
+
+	Installation   LocalDecision `yaml:"installation,omitempty"`
+	AutoConnection LocalDecision `yaml:"auto-connection,omitempty"`
+
+	// index is the 1-based position of the rule in the policy
+	index int
+}
+
+func (r *LocalRule) String() string {
+	return fmt.Sprintf("local policy rule #%d", r.index)
+}
+
+func (r *LocalRule) validate() error {
+	if r.Interface == "" && r.PlugSnap == "" && r.SlotSnap == "" {
+		return fmt.Errorf("must select an interface, a plug snap or a slot snap")
+	}
+	if r.Plug != "" && r.PlugSnap == "" {
+		return fmt.Errorf("plug %q must be qualified with a plug snap", r.Plug)
+	}
+	if r.Slot != "" && r.SlotSnap == "" {
+		return fmt.Errorf("slot %q must be qualified with a slot snap", r.Slot)
+	}
+	if r.Installation == "" && r.AutoConnection == "" {
+		return fmt.Errorf("must decide on installation or auto-connection")
+	}
+	for _, d := range []LocalDecision{r.Installation, r.AutoConnection} {
+		if d != "" && d != LocalAllow && d != LocalDeny {
+			return fmt.Errorf(`invalid decision %q, must be "allow" or "deny"`, d)
+		}
+	}
+	if r.Installation != "" && r.PlugSnap != "" && r.SlotSnap != "" {
+		return fmt.Errorf("installation rules cannot select both a plug snap and a slot snap")
+	}
+	return nil
+}
+
+func snapMatches(sel string, info *snap.Info) bool {
+	if sel == "" || sel == info.InstanceName() {
+		return true
+	}
+	return sel == "system" && (info.Type == snap.TypeOS || info.Type == snap.TypeSnapd)
+}
+
+func nameMatches(sel, name string) bool {
+	return sel == "" || sel == name
+}
+
+// LocalPolicy is a device-local interface policy, layered on top of
+// the base and snap declarations: its rules are considered in order
+// and the first one matching decides, otherwise the declarations do.
+type LocalPolicy struct {
+	Rules []*LocalRule `yaml:"rules"`
+}
+
+// ReadLocalPolicy reads the local policy in the given file, or returns
+// nil if there is none. As the policy can grant snaps more than their
+// declarations do, the file must be owned by root (the user snapd runs
+// as) and not be writable by anyone else.
+func ReadLocalPolicy(fn string) (*LocalPolicy, error) {
+	data, err := osutil.ReadProtectedFile(fn)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot use local policy %s: %v", fn, err)
+	}
+	return ParseLocalPolicy(data)
+}
+
+// ParseLocalPolicy parses and validates a local policy.
+func ParseLocalPolicy(data []byte) (*LocalPolicy, error) {
+	var p LocalPolicy
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("cannot parse local policy: %v", err)
+	}
+	for i, r := range p.Rules {
+		if r == nil {
+			return nil, fmt.Errorf("cannot use local policy: rule #%d is empty", i+1)
+		}
+		if err := r.validate(); err != nil {
+			return nil, fmt.Errorf("cannot use local policy: rule #%d %v", i+1, err)
+		}
+		r.index = i + 1
+	}
+	return &p, nil
+}
+
+// AutoConnectionRule returns the rule deciding on the auto-connection
+// of the given plug and slot, or nil if none does.
+func (p *LocalPolicy) AutoConnectionRule(plug *interfaces.ConnectedPlug, slot *interfaces.ConnectedSlot) *LocalRule {
+	if p == nil {
+		return nil
+	}
+	for _, r := range p.Rules {
+		if r.AutoConnection == "" {
+			continue
+		}
+		if nameMatches(r.Interface, plug.Interface()) &&
+			snapMatches(r.PlugSnap, plug.Snap()) && nameMatches(r.Plug, plug.Name()) &&
+			snapMatches(r.SlotSnap, slot.Snap()) && nameMatches(r.Slot, slot.Name()) {
+			return r
+		}
+	}
+	return nil
+}
+
+// AllowsAutoConnection returns whether the local policy explicitly
+// allows the auto-connection of the given plug and slot.
+func (p *LocalPolicy) AllowsAutoConnection(plug *interfaces.ConnectedPlug, slot *interfaces.ConnectedSlot) bool {
+	r := p.AutoConnectionRule(plug, slot)
+	return r != nil && r.AutoConnection == LocalAllow
+}
+
+func (p *LocalPolicy) plugInstallationRule(plug *snap.PlugInfo) *LocalRule {
+	if p == nil {
+		return nil
+	}
+	for _, r := range p.Rules {
+		if r.Installation == "" || r.SlotSnap != "" {
+			continue
+		}
+		if nameMatches(r.Interface, plug.Interface) && snapMatches(r.PlugSnap, plug.Snap) && nameMatches(r.Plug, plug.Name) {
+			return r
+		}
+	}
+	return nil
+}
+
+func (p *LocalPolicy) slotInstallationRule(slot *snap.SlotInfo) *LocalRule {
+	if p == nil {
+		return nil
+	}
+	for _, r := range p.Rules {
+		if r.Installation == "" || r.PlugSnap != "" {
+			continue
+		}
+		if nameMatches(r.Interface, slot.Interface) && snapMatches(r.SlotSnap, slot.Snap) && nameMatches(r.Slot, slot.Name) {
+			return r
+		}
+	}
+	return nil
+}
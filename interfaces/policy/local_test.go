@@ -0,0 +1,234 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package policy_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/interfaces"
+	"github.com/snapcore/snapd/interfaces/policy"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/osutil/sys"
+	"github.com/snapcore/snapd/snap/snaptest"
+)
+
+func (s *policySuite) TestReadLocalPolicy(c *C) {
+	fn := filepath.Join(c.MkDir(), "interfaces-policy.yaml")
+
+	p, err := policy.ReadLocalPolicy(fn)
+	c.Assert(err, IsNil)
+	c.Check(p, IsNil)
+
+	c.Assert(ioutil.WriteFile(fn, []byte(`rules:
+  - plug-snap: plug-snap
+    interface: auto-base-plug-deny
+    auto-connection: allow
+`), 0644), IsNil)
+	p, err = policy.ReadLocalPolicy(fn)
+	c.Assert(err, IsNil)
+	c.Assert(p.Rules, HasLen, 1)
+	c.Check(p.Rules[0].PlugSnap, Equals, "plug-snap")
+	c.Check(p.Rules[0].AutoConnection, Equals, policy.LocalAllow)
+
+	c.Assert(os.Chmod(fn, 0664), IsNil)
+	_, err = policy.ReadLocalPolicy(fn)
+	c.Check(err, ErrorMatches, `cannot use local policy .*: writable by group or others`)
+}
+
+func (s *policySuite) TestReadLocalPolicyNotOwnedByRoot(c *C) {
+	fn := filepath.Join(c.MkDir(), "interfaces-policy.yaml")
+	c.Assert(ioutil.WriteFile(fn, []byte(`rules:
+  - plug-snap: plug-snap
+    interface: auto-base-plug-deny
+    auto-connection: allow
+`), 0644), IsNil)
+
+	// as if snapd, running as root, found a file owned by another user
+	restore := osutil.MockGeteuid(func() sys.UserID { return sys.UserID(os.Geteuid() + 1) })
+	defer restore()
+
+	_, err := policy.ReadLocalPolicy(fn)
+	c.Check(err, ErrorMatches, `cannot use local policy .*: not owned by root`)
+}
+
+func (s *policySuite) TestParseLocalPolicyErrors(c *C) {
+	for _, t := range []struct {
+		rule string
+		err  string
+	}{
+		{"- installation: allow", `rule #1 must select an interface, a plug snap or a slot snap`},
+		{"- interface: foo", `rule #1 must decide on installation or auto-connection`},
+		{"- interface: foo\n  plug: bar\n  installation: deny", `rule #1 plug "bar" must be qualified with a plug snap`},
+		{"- interface: foo\n  slot: bar\n  installation: deny", `rule #1 slot "bar" must be qualified with a slot snap`},
+		{"- interface: foo\n  auto-connection: maybe", `rule #1 invalid decision "maybe", must be "allow" or "deny"`},
+		{"- plug-snap: foo\n  slot-snap: bar\n  installation: deny", `rule #1 installation rules cannot select both a plug snap and a slot snap`},
+		{"- interface: foo\n  installation: deny\n-", `rule #2 is empty`},
+	} {
+		_, err := policy.ParseLocalPolicy([]byte("rules:\n" + t.rule))
+		c.Check(err, ErrorMatches, "cannot use local policy: "+t.err, Commentf(t.rule))
+	}
+
+	_, err := policy.ParseLocalPolicy([]byte("rules: {"))
+	c.Check(err, ErrorMatches, "cannot parse local policy: .*")
+}
+
+func (s *policySuite) TestLocalPolicyAutoConnection(c *C) {
+	localPolicy, err := policy.ParseLocalPolicy([]byte(`rules:
+  - plug-snap: plug-snap
+    plug: auto-base-plug-deny
+    auto-connection: allow
+  - interface: auto-base-plug-allow
+    slot-snap: slot-snap
+    auto-connection: deny
+  - interface: auto-base-plug-not-allow
+    auto-connection: allow
+    installation: deny
+  - plug-snap: other-snap
+    interface: auto-base-slot-deny
+    auto-connection: allow
+`))
+	c.Assert(err, IsNil)
+
+	tests := []struct {
+		iface    string
+		expected string // "" => no error
+	}{
+		{"auto-base-plug-deny", ""},
+		{"auto-base-plug-allow", `auto-connection denied by local policy rule #2`},
+		{"auto-base-plug-not-allow", ""},
+		// no matching rule, the declarations decide
+		{"auto-base-slot-deny", `auto-connection denied by slot rule of interface "auto-base-slot-deny"`},
+	}
+
+	for _, t := range tests {
+		plug := interfaces.NewConnectedPlug(s.plugSnap.Plugs[t.iface], nil, nil)
+		slot := interfaces.NewConnectedSlot(s.slotSnap.Slots[t.iface], nil, nil)
+		cand := policy.ConnectCandidate{
+			Plug:            plug,
+			Slot:            slot,
+			BaseDeclaration: s.baseDecl,
+			LocalPolicy:     localPolicy,
+		}
+
+		err := cand.CheckAutoConnect()
+		if t.expected == "" {
+			c.Check(err, IsNil, Commentf(t.iface))
+			c.Check(localPolicy.AllowsAutoConnection(plug, slot), Equals, true)
+		} else {
+			c.Check(err, ErrorMatches, t.expected, Commentf(t.iface))
+			c.Check(localPolicy.AllowsAutoConnection(plug, slot), Equals, false)
+		}
+	}
+
+	// manual connections are not affected
+	cand := policy.ConnectCandidate{
+		Plug:            interfaces.NewConnectedPlug(s.plugSnap.Plugs["auto-base-plug-allow"], nil, nil),
+		Slot:            interfaces.NewConnectedSlot(s.slotSnap.Slots["auto-base-plug-allow"], nil, nil),
+		BaseDeclaration: s.baseDecl,
+		LocalPolicy:     localPolicy,
+	}
+	c.Check(cand.Check(), IsNil)
+}
+
+func (s *policySuite) TestLocalPolicySystemSlotSnap(c *C) {
+	localPolicy, err := policy.ParseLocalPolicy([]byte(`rules:
+  - slot-snap: system
+    interface: auto-base-plug-deny
+    auto-connection: allow
+`))
+	c.Assert(err, IsNil)
+
+	coreSnap := snaptest.MockInfo(c, `
+name: core
+version: 0
+type: os
+slots:
+  auto-base-plug-deny:
+`, nil)
+
+	plug := interfaces.NewConnectedPlug(s.plugSnap.Plugs["auto-base-plug-deny"], nil, nil)
+	c.Check(localPolicy.AllowsAutoConnection(plug, interfaces.NewConnectedSlot(coreSnap.Slots["auto-base-plug-deny"], nil, nil)), Equals, true)
+	c.Check(localPolicy.AllowsAutoConnection(plug, interfaces.NewConnectedSlot(s.slotSnap.Slots["auto-base-plug-deny"], nil, nil)), Equals, false)
+}
+
+func (s *policySuite) TestLocalPolicyInstallation(c *C) {
+	localPolicy, err := policy.ParseLocalPolicy([]byte(`rules:
+  - interface: install-slot-coreonly
+    slot-snap: install-snap
+    installation: allow
+  - plug-snap: install-snap
+    plug: innocuous
+    installation: deny
+  - interface: install-plug-gadget-only
+    auto-connection: deny
+`))
+	c.Assert(err, IsNil)
+
+	tests := []struct {
+		installYaml string
+		expected    string // "" => no error
+	}{
+		{`name: install-snap
+version: 0
+slots:
+  install-slot-coreonly:
+`, ""},
+		{`name: other-snap
+version: 0
+slots:
+  install-slot-coreonly:
+`, `installation not allowed by "install-slot-coreonly" slot rule of interface "install-slot-coreonly"`},
+		{`name: install-snap
+version: 0
+plugs:
+  innocuous:
+`, `installation denied by local policy rule #2 for "innocuous" plug of interface "innocuous"`},
+		{`name: install-snap
+version: 0
+slots:
+  innocuous:
+`, ""},
+		// auto-connection rules do not decide on installation
+		{`name: install-snap
+version: 0
+plugs:
+  install-plug-gadget-only:
+`, `installation not allowed by "install-plug-gadget-only" plug rule of interface "install-plug-gadget-only"`},
+	}
+
+	for _, t := range tests {
+		cand := policy.InstallCandidate{
+			Snap:            snaptest.MockInfo(c, t.installYaml, nil),
+			BaseDeclaration: s.baseDecl,
+			LocalPolicy:     localPolicy,
+		}
+
+		err := cand.Check()
+		if t.expected == "" {
+			c.Check(err, IsNil)
+		} else {
+			c.Check(err, ErrorMatches, t.expected)
+		}
+	}
+}
@@ -39,6 +39,12 @@ type InstallCandidate struct {
 
 	Model *asserts.Model
 	Store *asserts.Store
+
+	// LocalPolicy, if set, is considered before the declarations.
+	LocalPolicy *LocalPolicy
+
+	// Trace, if set, collects the steps of the checks.
+	Trace *Trace
 }
 
 func (ic *InstallCandidate) checkSlotRule(slot *snap.SlotInfo, rule *asserts.SlotRule, snapRule bool) error {
@@ -46,9 +52,12 @@ func (ic *InstallCandidate) checkSlotRule(slot *snap.SlotInfo, rule *asserts.Slo
 	if snapRule {
 		context = fmt.Sprintf(" for %q snap", ic.SnapDeclaration.SnapName())
 	}
+	ruleDesc := fmt.Sprintf("%s %q slot rule of interface %q%s", declarationKind(snapRule), slot.Name, slot.Interface, context)
+	ic.Trace.enter(ruleDesc, "deny-installation")
 	if checkSlotInstallationConstraints(ic, slot, rule.DenyInstallation) == nil {
 		return fmt.Errorf("installation denied by %q slot rule of interface %q%s", slot.Name, slot.Interface, context)
 	}
+	ic.Trace.enter(ruleDesc, "allow-installation")
 	if checkSlotInstallationConstraints(ic, slot, rule.AllowInstallation) != nil {
 		return fmt.Errorf("installation not allowed by %q slot rule of interface %q%s", slot.Name, slot.Interface, context)
 	}
@@ -60,9 +69,12 @@ func (ic *InstallCandidate) checkPlugRule(plug *snap.PlugInfo, rule *asserts.Plu
 	if snapRule {
 		context = fmt.Sprintf(" for %q snap", ic.SnapDeclaration.SnapName())
 	}
+	ruleDesc := fmt.Sprintf("%s %q plug rule of interface %q%s", declarationKind(snapRule), plug.Name, plug.Interface, context)
+	ic.Trace.enter(ruleDesc, "deny-installation")
 	if checkPlugInstallationConstraints(ic, plug, rule.DenyInstallation) == nil {
 		return fmt.Errorf("installation denied by %q plug rule of interface %q%s", plug.Name, plug.Interface, context)
 	}
+	ic.Trace.enter(ruleDesc, "allow-installation")
 	if checkPlugInstallationConstraints(ic, plug, rule.AllowInstallation) != nil {
 		return fmt.Errorf("installation not allowed by %q plug rule of interface %q%s", plug.Name, plug.Interface, context)
 	}
@@ -71,6 +83,13 @@ func (ic *InstallCandidate) checkPlugRule(plug *snap.PlugInfo, rule *asserts.Plu
 
 func (ic *InstallCandidate) checkSlot(slot *snap.SlotInfo) error {
 	iface := slot.Interface
+	if rule := ic.LocalPolicy.slotInstallationRule(slot); rule != nil {
+		ic.Trace.note(rule.String(), "installation", true, "%s slot %q", rule.Installation, slot.Name)
+		if rule.Installation == LocalDeny {
+			return fmt.Errorf("installation denied by %s for %q slot of interface %q", rule, slot.Name, iface)
+		}
+		return nil
+	}
 	if snapDecl := ic.SnapDeclaration; snapDecl != nil {
 		if rule := snapDecl.SlotRule(iface); rule != nil {
 			return ic.checkSlotRule(slot, rule, true)
@@ -79,11 +98,19 @@ func (ic *InstallCandidate) checkSlot(slot *snap.SlotInfo) error {
 	if rule := ic.BaseDeclaration.SlotRule(iface); rule != nil {
 		return ic.checkSlotRule(slot, rule, false)
 	}
+	ic.Trace.note("", "installation", false, "no rule for slot %q of interface %q, allowed", slot.Name, iface)
 	return nil
 }
 
 func (ic *InstallCandidate) checkPlug(plug *snap.PlugInfo) error {
 	iface := plug.Interface
+	if rule := ic.LocalPolicy.plugInstallationRule(plug); rule != nil {
+		ic.Trace.note(rule.String(), "installation", true, "%s plug %q", rule.Installation, plug.Name)
+		if rule.Installation == LocalDeny {
+			return fmt.Errorf("installation denied by %s for %q plug of interface %q", rule, plug.Name, iface)
+		}
+		return nil
+	}
 	if snapDecl := ic.SnapDeclaration; snapDecl != nil {
 		if rule := snapDecl.PlugRule(iface); rule != nil {
 			return ic.checkPlugRule(plug, rule, true)
@@ -92,6 +119,7 @@ func (ic *InstallCandidate) checkPlug(plug *snap.PlugInfo) error {
 	if rule := ic.BaseDeclaration.PlugRule(iface); rule != nil {
 		return ic.checkPlugRule(plug, rule, false)
 	}
+	ic.Trace.note("", "installation", false, "no rule for plug %q of interface %q, allowed", plug.Name, iface)
 	return nil
 }
 
@@ -130,6 +158,13 @@ type ConnectCandidate struct {
 
 	Model *asserts.Model
 	Store *asserts.Store
+
+	// LocalPolicy, if set, is considered before the declarations
+	// when checking auto-connection.
+	LocalPolicy *LocalPolicy
+
+	// Trace, if set, collects the steps of the checks.
+	Trace *Trace
 }
 
 func nestedGet(which string, attrs interfaces.Attrer, path string) (interface{}, error) {
@@ -187,9 +222,12 @@ func (connc *ConnectCandidate) checkPlugRule(kind string, rule *asserts.PlugRule
 		denyConst = rule.DenyAutoConnection
 		allowConst = rule.AllowAutoConnection
 	}
+	ruleDesc := fmt.Sprintf("%s plug rule of interface %q%s", declarationKind(snapRule), connc.Plug.Interface(), context)
+	connc.Trace.enter(ruleDesc, "deny-"+kind)
 	if checkPlugConnectionConstraints(connc, denyConst) == nil {
 		return fmt.Errorf("%s denied by plug rule of interface %q%s", kind, connc.Plug.Interface(), context)
 	}
+	connc.Trace.enter(ruleDesc, "allow-"+kind)
 	if checkPlugConnectionConstraints(connc, allowConst) != nil {
 		return fmt.Errorf("%s not allowed by plug rule of interface %q%s", kind, connc.Plug.Interface(), context)
 	}
@@ -207,9 +245,12 @@ func (connc *ConnectCandidate) checkSlotRule(kind string, rule *asserts.SlotRule
 		denyConst = rule.DenyAutoConnection
 		allowConst = rule.AllowAutoConnection
 	}
+	ruleDesc := fmt.Sprintf("%s slot rule of interface %q%s", declarationKind(snapRule), connc.Plug.Interface(), context)
+	connc.Trace.enter(ruleDesc, "deny-"+kind)
 	if checkSlotConnectionConstraints(connc, denyConst) == nil {
 		return fmt.Errorf("%s denied by slot rule of interface %q%s", kind, connc.Plug.Interface(), context)
 	}
+	connc.Trace.enter(ruleDesc, "allow-"+kind)
 	if checkSlotConnectionConstraints(connc, allowConst) != nil {
 		return fmt.Errorf("%s not allowed by slot rule of interface %q%s", kind, connc.Plug.Interface(), context)
 	}
@@ -228,6 +269,16 @@ func (connc *ConnectCandidate) check(kind string) error {
 		return fmt.Errorf("cannot connect mismatched plug interface %q to slot interface %q", iface, connc.Slot.Interface())
 	}
 
+	if kind == "auto-connection" {
+		if rule := connc.LocalPolicy.AutoConnectionRule(connc.Plug, connc.Slot); rule != nil {
+			connc.Trace.note(rule.String(), kind, true, "%s", rule.AutoConnection)
+			if rule.AutoConnection == LocalDeny {
+				return fmt.Errorf("auto-connection denied by %s", rule)
+			}
+			return nil
+		}
+	}
+
 	if plugDecl := connc.PlugSnapDeclaration; plugDecl != nil {
 		if rule := plugDecl.PlugRule(iface); rule != nil {
 			return connc.checkPlugRule(kind, rule, true)
@@ -244,6 +295,7 @@ func (connc *ConnectCandidate) check(kind string) error {
 	if rule := baseDecl.SlotRule(iface); rule != nil {
 		return connc.checkSlotRule(kind, rule, false)
 	}
+	connc.Trace.note("", kind, false, "no rule for interface %q, allowed", iface)
 	return nil
 }
 
@@ -0,0 +1,95 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package policy
+
+import (
+	"fmt"
+)
+
+// TraceStep is a step of a traced policy check.
+type TraceStep struct {
+	// Rule describes the rule that was considered, e.g.
+	// `base-declaration plug rule of interface "foo"`.
+	Rule string
+	// Constraint names the constraints of the rule that were
+	// checked, e.g. "deny-auto-connection".
+	Constraint string
+	// Alternative is the 1-based index of the alternative
+	// constraints that were checked, or 0 if the step is about the
+	// rule as a whole.
+	Alternative int
+	// Matched is whether the constraints matched.
+	Matched bool
+	// Detail explains the outcome, e.g. which attribute did not
+	// match.
+	Detail string
+}
+
+// Trace collects the steps of a policy check, when set on a
+// ConnectCandidate or InstallCandidate.
+type Trace struct {
+	Steps []TraceStep
+
+	rule       string
+	constraint string
+}
+
+func (t *Trace) enter(rule, constraint string) {
+	if t == nil {
+		return
+	}
+	t.rule = rule
+	t.constraint = constraint
+}
+
+func (t *Trace) alternative(i int, err error) {
+	if t == nil {
+		return
+	}
+	step := TraceStep{
+		Rule:        t.rule,
+		Constraint:  t.constraint,
+		Alternative: i,
+		Matched:     err == nil,
+	}
+	if err != nil {
+		step.Detail = err.Error()
+	}
+	t.Steps = append(t.Steps, step)
+}
+
+func (t *Trace) note(rule, constraint string, matched bool, format string, v ...interface{}) {
+	if t == nil {
+		return
+	}
+	t.Steps = append(t.Steps, TraceStep{
+		Rule:       rule,
+		Constraint: constraint,
+		Matched:    matched,
+		Detail:     fmt.Sprintf(format, v...),
+	})
+}
+
+func declarationKind(snapRule bool) string {
+	if snapRule {
+		return "snap-declaration"
+	}
+	return "base-declaration"
+}
@@ -0,0 +1,88 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package policy_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/interfaces"
+	"github.com/snapcore/snapd/interfaces/policy"
+	"github.com/snapcore/snapd/snap/snaptest"
+)
+
+func (s *policySuite) TestTraceConnection(c *C) {
+	trace := &policy.Trace{}
+	cand := policy.ConnectCandidate{
+		Plug:            interfaces.NewConnectedPlug(s.plugSnap.Plugs["base-plug-not-allow-slots"], nil, nil),
+		Slot:            interfaces.NewConnectedSlot(s.slotSnap.Slots["base-plug-not-allow-slots"], nil, nil),
+		BaseDeclaration: s.baseDecl,
+		Trace:           trace,
+	}
+	c.Check(cand.Check(), ErrorMatches, `connection not allowed by plug rule of interface "base-plug-not-allow-slots"`)
+
+	rule := `base-declaration plug rule of interface "base-plug-not-allow-slots"`
+	c.Assert(trace.Steps, HasLen, 2)
+	c.Check(trace.Steps[0].Rule, Equals, rule)
+	c.Check(trace.Steps[0].Constraint, Equals, "deny-connection")
+	c.Check(trace.Steps[0].Alternative, Equals, 1)
+	c.Check(trace.Steps[0].Matched, Equals, false)
+	c.Check(trace.Steps[1], DeepEquals, policy.TraceStep{
+		Rule:        rule,
+		Constraint:  "allow-connection",
+		Alternative: 1,
+		Detail:      `attribute "s" has constraints but is unset`,
+	})
+}
+
+func (s *policySuite) TestTraceAutoConnectionNoRule(c *C) {
+	trace := &policy.Trace{}
+	cand := policy.ConnectCandidate{
+		Plug:            interfaces.NewConnectedPlug(s.plugSnap.Plugs["random"], nil, nil),
+		Slot:            interfaces.NewConnectedSlot(s.slotSnap.Slots["random"], nil, nil),
+		BaseDeclaration: s.baseDecl,
+		Trace:           trace,
+	}
+	c.Check(cand.CheckAutoConnect(), IsNil)
+	c.Check(trace.Steps, DeepEquals, []policy.TraceStep{{
+		Constraint: "auto-connection",
+		Detail:     `no rule for interface "random", allowed`,
+	}})
+}
+
+func (s *policySuite) TestTraceInstallation(c *C) {
+	trace := &policy.Trace{}
+	cand := policy.InstallCandidate{
+		Snap: snaptest.MockInfo(c, `name: install-snap
+version: 0
+slots:
+  install-slot-coreonly:
+`, nil),
+		BaseDeclaration: s.baseDecl,
+		Trace:           trace,
+	}
+	c.Check(cand.Check(), ErrorMatches, `installation not allowed by "install-slot-coreonly" slot rule of interface "install-slot-coreonly"`)
+
+	c.Assert(trace.Steps, HasLen, 2)
+	last := trace.Steps[1]
+	c.Check(last.Rule, Equals, `base-declaration "install-slot-coreonly" slot rule of interface "install-slot-coreonly"`)
+	c.Check(last.Constraint, Equals, "allow-installation")
+	c.Check(last.Matched, Equals, false)
+	c.Check(last.Detail, Equals, "snap type does not match")
+}
@@ -61,6 +61,48 @@ func NewRepository() *Repository {
 	return repo
 }
 
+// Copy returns a copy of the repository, with the same interfaces, plugs,
+// slots, connections and backends. Connecting or disconnecting plugs and
+// slots in the copy does not affect the original repository.
+func (r *Repository) Copy() *Repository {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	repo := NewRepository()
+	for name, iface := range r.ifaces {
+		repo.ifaces[name] = iface
+	}
+	for name, iface := range r.hotplugIfaces {
+		repo.hotplugIfaces[name] = iface
+	}
+	for snapName, plugs := range r.plugs {
+		repo.plugs[snapName] = make(map[string]*snap.PlugInfo, len(plugs))
+		for name, plug := range plugs {
+			repo.plugs[snapName][name] = plug
+		}
+	}
+	for snapName, slots := range r.slots {
+		repo.slots[snapName] = make(map[string]*snap.SlotInfo, len(slots))
+		for name, slot := range slots {
+			repo.slots[snapName][name] = slot
+		}
+	}
+	for slot, plugs := range r.slotPlugs {
+		repo.slotPlugs[slot] = make(map[*snap.PlugInfo]*Connection, len(plugs))
+		for plug, conn := range plugs {
+			repo.slotPlugs[slot][plug] = conn
+		}
+	}
+	for plug, slots := range r.plugSlots {
+		repo.plugSlots[plug] = make(map[*snap.SlotInfo]*Connection, len(slots))
+		for slot, conn := range slots {
+			repo.plugSlots[plug][slot] = conn
+		}
+	}
+	repo.backends = append(repo.backends, r.backends...)
+	return repo
+}
+
 // Interface returns an interface with a given name.
 func (r *Repository) Interface(interfaceName string) Interface {
 	r.m.Lock()
@@ -1427,6 +1427,35 @@ func (s *RepositorySuite) TestDisconnectSucceeds(c *C) {
 	})
 }
 
+// Tests for Repository.Copy
+
+func (s *RepositorySuite) TestCopyIsIndependent(c *C) {
+	c.Assert(s.testRepo.AddPlug(s.plug), IsNil)
+	c.Assert(s.testRepo.AddSlot(s.slot), IsNil)
+	c.Assert(s.testRepo.AddPlug(s.plugSelf), IsNil)
+	_, err := s.testRepo.Connect(NewConnRef(s.plug, s.slot), nil, nil, nil, nil, nil)
+	c.Assert(err, IsNil)
+
+	repo := s.testRepo.Copy()
+	c.Check(repo.Interfaces(), DeepEquals, s.testRepo.Interfaces())
+	c.Check(repo.Interface(s.iface.Name()), Equals, s.iface)
+
+	// changes to the copy leave the original alone
+	_, err = repo.Connect(NewConnRef(s.plugSelf, s.slot), nil, nil, nil, nil, nil)
+	c.Assert(err, IsNil)
+	err = repo.Disconnect(s.plug.Snap.InstanceName(), s.plug.Name, s.slot.Snap.InstanceName(), s.slot.Name)
+	c.Assert(err, IsNil)
+	c.Assert(repo.RemovePlug(s.plug.Snap.InstanceName(), s.plug.Name), IsNil)
+
+	conns, err := s.testRepo.Connected(s.slot.Snap.InstanceName(), s.slot.Name)
+	c.Assert(err, IsNil)
+	c.Check(conns, DeepEquals, []*ConnRef{NewConnRef(s.plug, s.slot)})
+	c.Check(s.testRepo.Plug(s.plug.Snap.InstanceName(), s.plug.Name), Equals, s.plug)
+	conns, err = repo.Connected(s.slot.Snap.InstanceName(), s.slot.Name)
+	c.Assert(err, IsNil)
+	c.Check(conns, DeepEquals, []*ConnRef{NewConnRef(s.plugSelf, s.slot)})
+}
+
 // Tests for Repository.Connected
 
 // Connected fails if snap name is empty and there's no core snap around
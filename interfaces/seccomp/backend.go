@@ -235,6 +235,21 @@ func (b *Backend) Setup(snapInfo *snap.Info, opts interfaces.ConfinementOptions,
 	return nil
 }
 
+// Render returns the seccomp profile sources Setup would write for a given
+// snap, indexed by their path. Profiles are neither written nor compiled.
+func (b *Backend) Render(snapInfo *snap.Info, opts interfaces.ConfinementOptions, repo *interfaces.Repository) (map[string][]byte, error) {
+	snapName := snapInfo.InstanceName()
+	spec, err := repo.SnapSpecification(b.Name(), snapName)
+	if err != nil {
+		return nil, fmt.Errorf("cannot obtain seccomp specification for snap %q: %s", snapName, err)
+	}
+	content, err := b.deriveContent(spec.(*Specification), opts, snapInfo)
+	if err != nil {
+		return nil, fmt.Errorf("cannot obtain expected security files for snap %q: %s", snapName, err)
+	}
+	return interfaces.RenderedFiles(dirs.SnapSeccompDir, content), nil
+}
+
 // Remove removes seccomp profiles of a given snap.
 func (b *Backend) Remove(snapName string) error {
 	glob := interfaces.SecurityTagGlob(snapName)
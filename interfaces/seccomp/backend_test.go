@@ -143,6 +143,17 @@ func (s *backendSuite) TestInstallingSnapWritesHookProfiles(c *C) {
 	})
 }
 
+func (s *backendSuite) TestRenderingSnapDoesNotWriteOrCompileProfiles(c *C) {
+	_, files := s.RenderSnap(c, interfaces.ConfinementOptions{}, ifacetest.SambaYamlV1, 0)
+	profile := filepath.Join(dirs.SnapSeccompDir, "snap.samba.smbd.src")
+	c.Assert(files, HasLen, 1)
+	c.Check(string(files[profile]), testutil.Contains, "# snap-seccomp version information:\n")
+	// nothing was written or compiled
+	_, err := os.Stat(profile)
+	c.Check(os.IsNotExist(err), Equals, true)
+	c.Check(s.snapSeccomp.Calls(), HasLen, 0)
+}
+
 func (s *backendSuite) TestInstallingSnapWritesProfilesWithReexec(c *C) {
 	restore := seccomp.MockOsReadlink(func(string) (string, error) {
 		// simulate that we run snapd from core
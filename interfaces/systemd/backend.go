@@ -98,6 +98,18 @@ func (b *Backend) Setup(snapInfo *snap.Info, confinement interfaces.ConfinementO
 	return errEnsure
 }
 
+// Render returns the systemd services Setup would write for a given snap,
+// indexed by their path. Services are neither written nor started.
+func (b *Backend) Render(snapInfo *snap.Info, confinement interfaces.ConfinementOptions, repo *interfaces.Repository) (map[string][]byte, error) {
+	snapName := snapInfo.InstanceName()
+	spec, err := repo.SnapSpecification(b.Name(), snapName)
+	if err != nil {
+		return nil, fmt.Errorf("cannot obtain systemd services for snap %q: %s", snapName, err)
+	}
+	content := deriveContent(spec.(*Specification), snapInfo)
+	return interfaces.RenderedFiles(dirs.SnapServicesDir, content), nil
+}
+
 // Remove disables, stops and removes systemd services of a given snap.
 func (b *Backend) Remove(snapName string) error {
 	systemd := sysd.New(dirs.GlobalRootDir, &dummyReporter{})
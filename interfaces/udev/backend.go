@@ -94,22 +94,8 @@ func (b *Backend) Setup(snapInfo *snap.Info, opts interfaces.ConfinementOptions,
 		return nil
 	}
 
-	var buffer bytes.Buffer
-	buffer.WriteString("# This file is automatically generated.\n")
-	if (opts.DevMode || opts.Classic) && !opts.JailMode {
-		buffer.WriteString("# udev tagging/device cgroups disabled with non-strict mode snaps\n")
-	}
-	for _, snippet := range content {
-		if (opts.DevMode || opts.Classic) && !opts.JailMode {
-			buffer.WriteRune('#')
-			snippet = strings.Replace(snippet, "\n", "\n#", -1)
-		}
-		buffer.WriteString(snippet)
-		buffer.WriteByte('\n')
-	}
-
 	rulesFileState := &osutil.FileState{
-		Content: buffer.Bytes(),
+		Content: rulesContent(content, opts),
 		Mode:    0644,
 	}
 
@@ -129,6 +115,40 @@ func (b *Backend) Setup(snapInfo *snap.Info, opts interfaces.ConfinementOptions,
 	return ReloadRules(subsystemTriggers)
 }
 
+// Render returns the udev rules Setup would write for a given snap, indexed
+// by their path. The rules are neither written nor reloaded.
+func (b *Backend) Render(snapInfo *snap.Info, opts interfaces.ConfinementOptions, repo *interfaces.Repository) (map[string][]byte, error) {
+	snapName := snapInfo.InstanceName()
+	spec, err := repo.SnapSpecification(b.Name(), snapName)
+	if err != nil {
+		return nil, fmt.Errorf("cannot obtain udev specification for snap %q: %s", snapName, err)
+	}
+	content := b.deriveContent(spec.(*Specification), snapInfo)
+	if len(content) == 0 {
+		return nil, nil
+	}
+	return map[string][]byte{snapRulesFilePath(snapName): rulesContent(content, opts)}, nil
+}
+
+// rulesContent returns the content of the rules file made of the given
+// snippets. Rules are commented out for snaps in non-strict mode.
+func rulesContent(content []string, opts interfaces.ConfinementOptions) []byte {
+	var buffer bytes.Buffer
+	buffer.WriteString("# This file is automatically generated.\n")
+	if (opts.DevMode || opts.Classic) && !opts.JailMode {
+		buffer.WriteString("# udev tagging/device cgroups disabled with non-strict mode snaps\n")
+	}
+	for _, snippet := range content {
+		if (opts.DevMode || opts.Classic) && !opts.JailMode {
+			buffer.WriteRune('#')
+			snippet = strings.Replace(snippet, "\n", "\n#", -1)
+		}
+		buffer.WriteString(snippet)
+		buffer.WriteByte('\n')
+	}
+	return buffer.Bytes()
+}
+
 // Remove removes udev rules specific to a given snap.
 // If any of the rules are removed then udev database is reloaded.
 //
@@ -145,6 +145,33 @@ func (s *backendSuite) TestInstallingSnapWithHookWritesAndLoadsRules(c *C) {
 	}
 }
 
+func (s *backendSuite) TestRenderingSnapDoesNotWriteOrLoadRules(c *C) {
+	// NOTE: Hand out a permanent snippet so that .rules file is generated.
+	s.Iface.UDevPermanentSlotCallback = func(spec *udev.Specification, slot *snap.SlotInfo) error {
+		spec.AddSnippet("dummy")
+		return nil
+	}
+	fname := filepath.Join(dirs.SnapUdevRulesDir, "70-snap.samba.rules")
+	snapInfo, files := s.RenderSnap(c, interfaces.ConfinementOptions{}, ifacetest.SambaYamlV1, 0)
+	c.Check(files, DeepEquals, map[string][]byte{
+		fname: []byte("# This file is automatically generated.\ndummy\n"),
+	})
+	files, err := s.Backend.Render(snapInfo, interfaces.ConfinementOptions{DevMode: true}, s.Repo)
+	c.Assert(err, IsNil)
+	c.Check(files, DeepEquals, map[string][]byte{
+		fname: []byte("# This file is automatically generated.\n# udev tagging/device cgroups disabled with non-strict mode snaps\n#dummy\n"),
+	})
+	// nothing was written or reloaded
+	_, err = os.Stat(fname)
+	c.Check(os.IsNotExist(err), Equals, true)
+	c.Check(s.udevadmCmd.Calls(), HasLen, 0)
+}
+
+func (s *backendSuite) TestRenderingSnapWithoutRules(c *C) {
+	_, files := s.RenderSnap(c, interfaces.ConfinementOptions{}, ifacetest.SambaYamlV1, 0)
+	c.Check(files, HasLen, 0)
+}
+
 func (s *backendSuite) TestSecurityIsStable(c *C) {
 	// NOTE: Hand out a permanent snippet so that .rules file is generated.
 	s.Iface.UDevPermanentSlotCallback = func(spec *udev.Specification, slot *snap.SlotInfo) error {
@@ -0,0 +1,153 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package jsonlog keeps append-only logs of JSON records, one per
+// line, that are rotated once they get too big.
+package jsonlog
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// A Log is a file of JSON records, one per line, along with its
+// rotated copies. A Log does no locking of its own: its users must
+// serialize appending to and reading it.
+type Log struct {
+	// Path is the file of the log, its rotated copies being
+	// Path.1, Path.2 and so on, from newest to oldest.
+	Path string
+	// MaxSize is the size past which the log is rotated.
+	MaxSize int64
+	// Backups is how many rotated copies are kept.
+	Backups int
+}
+
+// Append appends the given encoded records, each ending with a
+// newline, to the log, rotating it first if it would get too big.
+func (l *Log) Append(buf []byte) error {
+	if err := os.MkdirAll(filepath.Dir(l.Path), 0755); err != nil {
+		return err
+	}
+	if fi, err := os.Stat(l.Path); err == nil && fi.Size()+int64(len(buf)) > l.MaxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(l.Path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	partial, err := endsInPartialLine(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if partial {
+		// the last write was cut short, e.g. by a crash; end its
+		// line, so that it is skipped as a whole when reading
+		buf = append([]byte{'\n'}, buf...)
+	}
+	// a single write, so that records are not interleaved
+	if _, err := f.Write(buf); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// endsInPartialLine returns whether the given file does not end with a
+// newline, and is not empty.
+func endsInPartialLine(f *os.File) (bool, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	if fi.Size() == 0 {
+		return false, nil
+	}
+	last := make([]byte, 1)
+	if _, err := f.ReadAt(last, fi.Size()-1); err != nil {
+		return false, err
+	}
+	return last[0] != '\n', nil
+}
+
+func (l *Log) backup(n int) string {
+	return l.Path + "." + strconv.Itoa(n)
+}
+
+// rotate moves e.g. audit.log to audit.log.1, audit.log.1 to
+// audit.log.2 and so on, dropping the oldest one.
+func (l *Log) rotate() error {
+	for n := l.Backups; n > 1; n-- {
+		if err := os.Rename(l.backup(n-1), l.backup(n)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if l.Backups < 1 {
+		return os.Remove(l.Path)
+	}
+	return os.Rename(l.Path, l.backup(1))
+}
+
+// Read calls f with each line of the log, rotated copies included, in
+// the order they were appended. The lines are not decoded; they include
+// their newline, if any, and might not be valid JSON, e.g. if their
+// write was cut short.
+func (l *Log) Read(f func(line []byte)) error {
+	for n := l.Backups; n >= 0; n-- {
+		fn := l.Path
+		if n > 0 {
+			fn = l.backup(n)
+		}
+		if err := readFile(fn, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readFile(fn string, f func(line []byte)) error {
+	file, err := os.Open(fn)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if len(line) > 0 {
+			f(line)
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package jsonlog_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/jsonutil/jsonlog"
+	"github.com/snapcore/snapd/testutil"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+type logSuite struct {
+	log *jsonlog.Log
+}
+
+var _ = check.Suite(&logSuite{})
+
+func (s *logSuite) SetUpTest(c *check.C) {
+	s.log = &jsonlog.Log{
+		Path:    filepath.Join(c.MkDir(), "dir", "test.log"),
+		MaxSize: 20,
+		Backups: 2,
+	}
+}
+
+func (s *logSuite) read(c *check.C) []string {
+	var lines []string
+	err := s.log.Read(func(line []byte) {
+		lines = append(lines, string(line))
+	})
+	c.Assert(err, check.IsNil)
+	return lines
+}
+
+func (s *logSuite) TestReadNothing(c *check.C) {
+	c.Check(s.read(c), check.HasLen, 0)
+}
+
+func (s *logSuite) TestAppend(c *check.C) {
+	c.Assert(s.log.Append([]byte("{\"n\":1}\n")), check.IsNil)
+	c.Assert(s.log.Append([]byte("{\"n\":2}\n")), check.IsNil)
+
+	c.Check(s.log.Path, testutil.FileEquals, "{\"n\":1}\n{\"n\":2}\n")
+	fi, err := os.Stat(s.log.Path)
+	c.Assert(err, check.IsNil)
+	c.Check(fi.Mode().Perm(), check.Equals, os.FileMode(0600))
+
+	c.Check(s.read(c), check.DeepEquals, []string{"{\"n\":1}\n", "{\"n\":2}\n"})
+}
+
+func (s *logSuite) TestRotate(c *check.C) {
+	for _, rec := range []string{"{\"n\":1}\n", "{\"n\":2}\n", "{\"n\":3}\n", "{\"n\":4}\n", "{\"n\":5}\n", "{\"n\":6}\n", "{\"n\":7}\n"} {
+		c.Assert(s.log.Append([]byte(rec)), check.IsNil)
+	}
+
+	// each file holds two records, and only two rotated files are kept
+	for fn, content := range map[string]string{
+		s.log.Path:        "{\"n\":7}\n",
+		s.log.Path + ".1": "{\"n\":5}\n{\"n\":6}\n",
+		s.log.Path + ".2": "{\"n\":3}\n{\"n\":4}\n",
+	} {
+		c.Check(fn, testutil.FileEquals, content)
+	}
+	c.Check(s.log.Path+".3", testutil.FileAbsent)
+
+	c.Check(s.read(c), check.DeepEquals, []string{"{\"n\":3}\n", "{\"n\":4}\n", "{\"n\":5}\n", "{\"n\":6}\n", "{\"n\":7}\n"})
+}
+
+func (s *logSuite) TestRotateNoBackups(c *check.C) {
+	s.log.Backups = 0
+	for _, rec := range []string{"{\"n\":1}\n", "{\"n\":2}\n", "{\"n\":3}\n"} {
+		c.Assert(s.log.Append([]byte(rec)), check.IsNil)
+	}
+
+	c.Check(s.log.Path+".1", testutil.FileAbsent)
+	c.Check(s.read(c), check.DeepEquals, []string{"{\"n\":3}\n"})
+}
+
+func (s *logSuite) TestAppendAfterPartialLine(c *check.C) {
+	c.Assert(os.MkdirAll(filepath.Dir(s.log.Path), 0755), check.IsNil)
+	c.Assert(ioutil.WriteFile(s.log.Path, []byte("{\"n\":1}\n{\"n\""), 0600), check.IsNil)
+
+	c.Assert(s.log.Append([]byte("{\"n\":2}\n")), check.IsNil)
+
+	// the cut short record is on a line of its own
+	c.Check(s.read(c), check.DeepEquals, []string{"{\"n\":1}\n", "{\"n\"\n", "{\"n\":2}\n"})
+}
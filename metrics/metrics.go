@@ -0,0 +1,353 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package metrics implements counters, gauges and histograms that can
+// be written out in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are the histogram buckets, in seconds, suitable for
+// timing requests and other short operations.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// A Metric is a named set of values, by label values, that can be
+// written out.
+type Metric interface {
+	Name() string
+	write(w *bufio.Writer)
+}
+
+// desc is what all metrics have in common.
+type desc struct {
+	name   string
+	help   string
+	labels []string
+}
+
+func (d *desc) Name() string {
+	return d.name
+}
+
+func (d *desc) key(labelValues []string) string {
+	if len(labelValues) != len(d.labels) {
+		panic(fmt.Sprintf("internal error: metric %s needs %d label values, got %d", d.name, len(d.labels), len(labelValues)))
+	}
+	return strings.Join(labelValues, "\x00")
+}
+
+func (d *desc) writeHeader(w *bufio.Writer, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.name, escapeHelp(d.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.name, typ)
+}
+
+// writeSample writes a single line with the given value, for the label
+// values joined in key and the extra label, if any.
+func (d *desc) writeSample(w *bufio.Writer, suffix, key, extraLabel, extraValue string, value float64) {
+	w.WriteString(d.name)
+	w.WriteString(suffix)
+	var labelValues []string
+	if len(d.labels) > 0 {
+		labelValues = strings.Split(key, "\x00")
+	}
+	if len(d.labels) > 0 || extraLabel != "" {
+		w.WriteByte('{')
+		for i, label := range d.labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", label, escapeLabelValue(labelValues[i]))
+		}
+		if extraLabel != "" {
+			if len(d.labels) > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", extraLabel, extraValue)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+var (
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return labelValueEscaper.Replace(s)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// A Counter is a value, by label values, that only goes up.
+type Counter struct {
+	desc
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewCounter returns a counter with the given name, help text and
+// label names.
+func NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{
+		desc:   desc{name: name, help: help, labels: labels},
+		values: make(map[string]float64),
+	}
+}
+
+// Add adds the given value, which must not be negative, to the counter
+// with the given label values.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic(fmt.Sprintf("internal error: cannot decrease counter %s", c.name))
+	}
+	key := c.key(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[key] += v
+}
+
+// Inc increments the counter with the given label values.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Value returns the value of the counter with the given label values.
+func (c *Counter) Value(labelValues ...string) float64 {
+	key := c.key(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[key]
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writeHeader(w, "counter")
+	for _, key := range sortedKeys(c.values) {
+		c.writeSample(w, "", key, "", "", c.values[key])
+	}
+}
+
+// A Gauge is a value, by label values, that can go up and down.
+type Gauge struct {
+	desc
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewGauge returns a gauge with the given name, help text and label
+// names.
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{
+		desc:   desc{name: name, help: help, labels: labels},
+		values: make(map[string]float64),
+	}
+}
+
+// Set sets the gauge with the given label values to the given value.
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	key := g.key(labelValues)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.values[key] = v
+}
+
+// Add adds the given value, which can be negative, to the gauge with
+// the given label values.
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	key := g.key(labelValues)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.values[key] += v
+}
+
+func (g *Gauge) write(w *bufio.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.writeHeader(w, "gauge")
+	for _, key := range sortedKeys(g.values) {
+		g.writeSample(w, "", key, "", "", g.values[key])
+	}
+}
+
+// A Histogram counts observed values, by label values, in buckets.
+type Histogram struct {
+	desc
+	buckets []float64
+
+	mu     sync.Mutex
+	values map[string]*histogramValue
+}
+
+type histogramValue struct {
+	// counts are per bucket, not cumulative
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram returns a histogram with the given name, help text,
+// upper bounds of the buckets, in increasing order, and label names.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if !sort.Float64sAreSorted(buckets) {
+		panic(fmt.Sprintf("internal error: buckets of histogram %s are not sorted", name))
+	}
+	return &Histogram{
+		desc:    desc{name: name, help: help, labels: labels},
+		buckets: buckets,
+		values:  make(map[string]*histogramValue),
+	}
+}
+
+// Observe adds the given value to the histogram with the given label
+// values.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	key := h.key(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hv := h.values[key]
+	if hv == nil {
+		hv = &histogramValue{counts: make([]uint64, len(h.buckets))}
+		h.values[key] = hv
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		hv.counts[i]++
+	}
+	hv.count++
+	hv.sum += v
+}
+
+// ObserveDuration adds the given duration, in seconds, to the histogram
+// with the given label values.
+func (h *Histogram) ObserveDuration(d time.Duration, labelValues ...string) {
+	h.Observe(d.Seconds(), labelValues...)
+}
+
+// Count returns how many values were observed by the histogram with
+// the given label values.
+func (h *Histogram) Count(labelValues ...string) uint64 {
+	key := h.key(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if hv := h.values[key]; hv != nil {
+		return hv.count
+	}
+	return 0
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.writeHeader(w, "histogram")
+	keys := make([]string, 0, len(h.values))
+	for key := range h.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		hv := h.values[key]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += hv.counts[i]
+			h.writeSample(w, "_bucket", key, "le", formatFloat(bound), float64(cumulative))
+		}
+		h.writeSample(w, "_bucket", key, "le", "+Inf", float64(hv.count))
+		h.writeSample(w, "_sum", key, "", "", hv.sum)
+		h.writeSample(w, "_count", key, "", "", float64(hv.count))
+	}
+}
+
+type byName []Metric
+
+func (ms byName) Len() int           { return len(ms) }
+func (ms byName) Swap(i, j int)      { ms[i], ms[j] = ms[j], ms[i] }
+func (ms byName) Less(i, j int) bool { return ms[i].Name() < ms[j].Name() }
+
+var (
+	registeredMu sync.Mutex
+	registered   = make(map[string]Metric)
+)
+
+// Register makes the given metrics part of those written by Write.
+func Register(ms ...Metric) {
+	registeredMu.Lock()
+	defer registeredMu.Unlock()
+	for _, m := range ms {
+		if _, ok := registered[m.Name()]; ok {
+			panic(fmt.Sprintf("internal error: metric %s registered twice", m.Name()))
+		}
+		registered[m.Name()] = m
+	}
+}
+
+// Write writes out the registered metrics and the given extra ones,
+// ordered by name, in the Prometheus text exposition format.
+func Write(w io.Writer, extra ...Metric) error {
+	registeredMu.Lock()
+	all := make([]Metric, 0, len(registered)+len(extra))
+	for _, m := range registered {
+		all = append(all, m)
+	}
+	registeredMu.Unlock()
+	all = append(all, extra...)
+	sort.Sort(byName(all))
+
+	bw := bufio.NewWriter(w)
+	for _, m := range all {
+		m.write(bw)
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,132 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package metrics_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/metrics"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type metricsSuite struct{}
+
+var _ = Suite(&metricsSuite{})
+
+func write(c *C, ms ...metrics.Metric) string {
+	var buf bytes.Buffer
+	c.Assert(metrics.Write(&buf, ms...), IsNil)
+	return buf.String()
+}
+
+func (s *metricsSuite) TestCounter(c *C) {
+	counter := metrics.NewCounter("test_requests_total", "Requests, by code.", "code")
+	counter.Inc("200")
+	counter.Inc("404")
+	counter.Add(2, "200")
+	c.Check(counter.Value("200"), Equals, 3.0)
+	c.Check(counter.Value("500"), Equals, 0.0)
+
+	c.Check(write(c, counter), Equals, `# HELP test_requests_total Requests, by code.
+# TYPE test_requests_total counter
+test_requests_total{code="200"} 3
+test_requests_total{code="404"} 1
+`)
+
+	c.Check(func() { counter.Add(-1, "200") }, PanicMatches, "internal error: cannot decrease counter test_requests_total")
+	c.Check(func() { counter.Inc() }, PanicMatches, "internal error: metric test_requests_total needs 1 label values, got 0")
+}
+
+func (s *metricsSuite) TestGauge(c *C) {
+	gauge := metrics.NewGauge("test_queue", "Queued things.")
+	c.Check(write(c, gauge), Equals, `# HELP test_queue Queued things.
+# TYPE test_queue gauge
+`)
+
+	gauge.Set(5)
+	gauge.Add(-2)
+	c.Check(write(c, gauge), Equals, `# HELP test_queue Queued things.
+# TYPE test_queue gauge
+test_queue 3
+`)
+}
+
+func (s *metricsSuite) TestHistogram(c *C) {
+	h := metrics.NewHistogram("test_duration_seconds", "How long things take.", []float64{0.1, 1, 10}, "kind")
+	h.Observe(0.05, "foo")
+	h.Observe(0.1, "foo")
+	h.ObserveDuration(2*time.Second, "foo")
+	h.Observe(20, "foo")
+	h.Observe(0.5, "bar")
+	c.Check(h.Count("foo"), Equals, uint64(4))
+	c.Check(h.Count("baz"), Equals, uint64(0))
+
+	c.Check(write(c, h), Equals, `# HELP test_duration_seconds How long things take.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{kind="bar",le="0.1"} 0
+test_duration_seconds_bucket{kind="bar",le="1"} 1
+test_duration_seconds_bucket{kind="bar",le="10"} 1
+test_duration_seconds_bucket{kind="bar",le="+Inf"} 1
+test_duration_seconds_sum{kind="bar"} 0.5
+test_duration_seconds_count{kind="bar"} 1
+test_duration_seconds_bucket{kind="foo",le="0.1"} 2
+test_duration_seconds_bucket{kind="foo",le="1"} 2
+test_duration_seconds_bucket{kind="foo",le="10"} 3
+test_duration_seconds_bucket{kind="foo",le="+Inf"} 4
+test_duration_seconds_sum{kind="foo"} 22.15
+test_duration_seconds_count{kind="foo"} 4
+`)
+
+	c.Check(func() { metrics.NewHistogram("test_bad", "", []float64{1, 0.1}) }, PanicMatches, "internal error: buckets of histogram test_bad are not sorted")
+}
+
+func (s *metricsSuite) TestEscaping(c *C) {
+	counter := metrics.NewCounter("test_escaped", "Help with \\ and\nnewline.", "what")
+	counter.Inc("a \"quoted\" \\ value\n")
+
+	c.Check(write(c, counter), Equals, `# HELP test_escaped Help with \\ and\nnewline.
+# TYPE test_escaped counter
+test_escaped{what="a \"quoted\" \\ value\n"} 1
+`)
+}
+
+func (s *metricsSuite) TestRegister(c *C) {
+	b := metrics.NewCounter("test_b", "B.")
+	a := metrics.NewGauge("test_a", "A.")
+	metrics.Register(b)
+	b.Inc()
+	a.Set(1)
+
+	// registered and extra metrics are written ordered by name
+	c.Check(write(c, a), Equals, `# HELP test_a A.
+# TYPE test_a gauge
+test_a 1
+# HELP test_b B.
+# TYPE test_b counter
+test_b 1
+`)
+
+	c.Check(func() { metrics.Register(metrics.NewCounter("test_b", "B again.")) }, PanicMatches, "internal error: metric test_b registered twice")
+}
@@ -0,0 +1,67 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package osutil
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"syscall"
+
+	"github.com/snapcore/snapd/osutil/sys"
+)
+
+var sysGeteuid = sys.Geteuid
+
+// ReadProtectedFile reads the given file, which must be owned by the
+// effective user, i.e. root for snapd, and not be writable by anybody
+// else, as is needed for files that grant privileges. The checks are
+// done on the opened file, so it cannot be swapped for another one
+// after them. If the file does not exist, the error is the one of
+// os.Open, for os.IsNotExist to tell.
+func ReadProtectedFile(fn string) ([]byte, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if st, ok := fi.Sys().(*syscall.Stat_t); !ok || st.Uid != uint32(sysGeteuid()) {
+		return nil, fmt.Errorf("not owned by root")
+	}
+	if fi.Mode().Perm()&0022 != 0 {
+		return nil, fmt.Errorf("writable by group or others")
+	}
+	return ioutil.ReadAll(f)
+}
+
+// MockGeteuid replaces the function that returns the effective user
+// ReadProtectedFile checks the owner of files against.
+func MockGeteuid(f func() sys.UserID) (restore func()) {
+	old := sysGeteuid
+	sysGeteuid = f
+	return func() {
+		sysGeteuid = old
+	}
+}
@@ -0,0 +1,75 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package osutil_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/osutil/sys"
+)
+
+type protectedSuite struct {
+	fn string
+}
+
+var _ = Suite(&protectedSuite{})
+
+func (s *protectedSuite) SetUpTest(c *C) {
+	s.fn = filepath.Join(c.MkDir(), "policy")
+}
+
+func (s *protectedSuite) TestReadProtectedFile(c *C) {
+	c.Assert(ioutil.WriteFile(s.fn, []byte("hello"), 0644), IsNil)
+
+	data, err := osutil.ReadProtectedFile(s.fn)
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, "hello")
+}
+
+func (s *protectedSuite) TestReadProtectedFileMissing(c *C) {
+	_, err := osutil.ReadProtectedFile(s.fn)
+	c.Check(os.IsNotExist(err), Equals, true)
+}
+
+func (s *protectedSuite) TestReadProtectedFileWritable(c *C) {
+	for _, perm := range []os.FileMode{0664, 0646} {
+		c.Assert(ioutil.WriteFile(s.fn, []byte("hello"), 0600), IsNil)
+		c.Assert(os.Chmod(s.fn, perm), IsNil)
+
+		_, err := osutil.ReadProtectedFile(s.fn)
+		c.Check(err, ErrorMatches, "writable by group or others")
+	}
+}
+
+func (s *protectedSuite) TestReadProtectedFileNotOwned(c *C) {
+	c.Assert(ioutil.WriteFile(s.fn, []byte("hello"), 0644), IsNil)
+
+	// as if snapd, running as root, found a file owned by another user
+	restore := osutil.MockGeteuid(func() sys.UserID { return sys.UserID(os.Geteuid() + 1) })
+	defer restore()
+
+	_, err := osutil.ReadProtectedFile(s.fn)
+	c.Check(err, ErrorMatches, "not owned by root")
+}
@@ -22,6 +22,7 @@ package overlord
 import (
 	"time"
 
+	"github.com/snapcore/snapd/metrics"
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/overlord/state"
 )
@@ -32,7 +33,12 @@ type overlordStateBackend struct {
 	requestRestart func(t state.RestartType)
 }
 
+var checkpointDuration = metrics.NewHistogram("snapd_state_checkpoint_duration_seconds", "Time taken to write the state to disk.", metrics.DefaultBuckets)
+
 func (osb *overlordStateBackend) Checkpoint(data []byte) error {
+	defer func(start time.Time) {
+		checkpointDuration.ObserveDuration(time.Since(start))
+	}(time.Now())
 	return osutil.AtomicWriteFile(osb.path, data, 0600, 0)
 }
 
@@ -43,3 +49,24 @@ func (osb *overlordStateBackend) EnsureBefore(d time.Duration) {
 func (osb *overlordStateBackend) RequestRestart(t state.RestartType) {
 	osb.requestRestart(t)
 }
+
+// journaledStateBackend checkpoints the state through a journal,
+// appending only what was modified instead of rewriting it all.
+type journaledStateBackend struct {
+	*overlordStateBackend
+	journal *state.Journal
+}
+
+func (jsb *journaledStateBackend) Checkpoint(data []byte) error {
+	defer func(start time.Time) {
+		checkpointDuration.ObserveDuration(time.Since(start))
+	}(time.Now())
+	return jsb.journal.Checkpoint(data)
+}
+
+func (jsb *journaledStateBackend) CheckpointDelta(delta *state.Delta) error {
+	defer func(start time.Time) {
+		checkpointDuration.ObserveDuration(time.Since(start))
+	}(time.Now())
+	return jsb.journal.CheckpointDelta(delta)
+}
@@ -0,0 +1,281 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package changejournal keeps an append-only record of the changes
+// that became ready, so that their history outlives the pruning of
+// the state.
+package changejournal
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/jsonutil/jsonlog"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/timings"
+)
+
+var (
+	// journalMaxSize is the size past which the journal is rotated
+	journalMaxSize int64 = 8 * 1024 * 1024
+	// journalBackups is how many rotated journals are kept
+	journalBackups = 3
+)
+
+// Entry is the journal record of a change that became ready.
+type Entry struct {
+	ID      string   `json:"id"`
+	Kind    string   `json:"kind"`
+	Summary string   `json:"summary"`
+	Status  string   `json:"status"`
+	Tasks   []*Task  `json:"tasks,omitempty"`
+	Ready   bool     `json:"ready"`
+	Err     string   `json:"err,omitempty"`
+	Snaps   []string `json:"snap-names,omitempty"`
+
+	SpawnTime time.Time `json:"spawn-time,omitempty"`
+	ReadyTime time.Time `json:"ready-time,omitempty"`
+
+	Data map[string]*json.RawMessage `json:"data,omitempty"`
+}
+
+// Task is the journal record of a task of a change that became ready.
+type Task struct {
+	ID      string   `json:"id"`
+	Kind    string   `json:"kind"`
+	Summary string   `json:"summary"`
+	Status  string   `json:"status"`
+	Log     []string `json:"log,omitempty"`
+
+	SpawnTime time.Time  `json:"spawn-time,omitempty"`
+	ReadyTime *time.Time `json:"ready-time,omitempty"`
+
+	Timings []*timings.TimingsInfo `json:"timings,omitempty"`
+}
+
+func newEntry(chg *state.Change) *Entry {
+	status := chg.Status()
+	entry := &Entry{
+		ID:        chg.ID(),
+		Kind:      chg.Kind(),
+		Summary:   chg.Summary(),
+		Status:    status.String(),
+		Ready:     status.Ready(),
+		SpawnTime: chg.SpawnTime(),
+		ReadyTime: chg.ReadyTime(),
+	}
+	if err := chg.Err(); err != nil {
+		entry.Err = err.Error()
+	}
+	chg.Get("snap-names", &entry.Snaps)
+	chg.Get("api-data", &entry.Data)
+
+	chgTimings, err := timings.Get(chg.State(), func(tags map[string]string) bool {
+		return tags["change-id"] == chg.ID()
+	})
+	if err != nil {
+		logger.Noticef("Cannot get timings of change %s: %v", chg.ID(), err)
+	}
+
+	tasks := chg.Tasks()
+	entry.Tasks = make([]*Task, len(tasks))
+	for i, t := range tasks {
+		task := &Task{
+			ID:        t.ID(),
+			Kind:      t.Kind(),
+			Summary:   t.Summary(),
+			Status:    t.Status().String(),
+			Log:       t.Log(),
+			SpawnTime: t.SpawnTime(),
+		}
+		if readyTime := t.ReadyTime(); !readyTime.IsZero() {
+			task.ReadyTime = &readyTime
+		}
+		for _, tm := range chgTimings {
+			if tm.Tags["task-id"] == t.ID() {
+				task.Timings = append(task.Timings, tm)
+			}
+		}
+		entry.Tasks[i] = task
+	}
+
+	return entry
+}
+
+var (
+	// pendingMu protects pending and writing
+	pendingMu sync.Mutex
+	// pending are the encoded entries not yet written to the journal
+	pending [][]byte
+	// writing is set while a goroutine is writing the pending entries
+	writing bool
+
+	// fileMu serializes writing, rotating and reading the journal
+	fileMu sync.Mutex
+)
+
+// Record queues the given change to be appended to the journal. It is
+// meant to be used as a state change-ready handler, and so expects the
+// state to be locked; the entry is built right away, but the journal
+// is written in the background, without holding up the state.
+// Failures are logged but otherwise ignored, as they must not hold up
+// the change itself.
+func Record(chg *state.Change) {
+	buf, err := json.Marshal(newEntry(chg))
+	if err != nil {
+		logger.Noticef("Cannot record change %s in the journal: %v", chg.ID(), err)
+		return
+	}
+	buf = append(buf, '\n')
+
+	pendingMu.Lock()
+	pending = append(pending, buf)
+	start := !writing
+	writing = true
+	pendingMu.Unlock()
+
+	if start {
+		go writePending()
+	}
+}
+
+// writePending writes the pending entries, in batches, until there are
+// none left.
+func writePending() {
+	fileMu.Lock()
+	defer fileMu.Unlock()
+
+	for {
+		pendingMu.Lock()
+		bufs := pending
+		pending = nil
+		if len(bufs) == 0 {
+			writing = false
+		}
+		pendingMu.Unlock()
+		if len(bufs) == 0 {
+			return
+		}
+		write(bufs)
+	}
+}
+
+// Flush writes the entries recorded so far to the journal, waiting
+// for any writing already in progress.
+func Flush() {
+	fileMu.Lock()
+	defer fileMu.Unlock()
+
+	flushLocked()
+}
+
+func flushLocked() {
+	pendingMu.Lock()
+	bufs := pending
+	pending = nil
+	pendingMu.Unlock()
+
+	if len(bufs) > 0 {
+		write(bufs)
+	}
+}
+
+func write(bufs [][]byte) {
+	if err := appendEntries(bytes.Join(bufs, nil)); err != nil {
+		logger.Noticef("Cannot record %d changes in the journal: %v", len(bufs), err)
+	}
+}
+
+// journal returns the journal, with its rotated copies.
+func journal() *jsonlog.Log {
+	return &jsonlog.Log{
+		Path:    dirs.SnapChangesJournalFile,
+		MaxSize: journalMaxSize,
+		Backups: journalBackups,
+	}
+}
+
+// appendEntries appends the given encoded entries to the journal,
+// rotating it first if it got too big.
+func appendEntries(buf []byte) error {
+	return journal().Append(buf)
+}
+
+// Filter selects the entries returned by Read.
+type Filter struct {
+	// Since, if set, selects the changes that became ready at or
+	// after the given time.
+	Since time.Time
+	// Kind, if set, selects the changes of the given kind.
+	Kind string
+	// Snap, if set, selects the changes affecting the given snap.
+	Snap string
+}
+
+func (f *Filter) match(entry *Entry) bool {
+	if !f.Since.IsZero() && entry.ReadyTime.Before(f.Since) {
+		return false
+	}
+	if f.Kind != "" && entry.Kind != f.Kind {
+		return false
+	}
+	if f.Snap != "" {
+		for _, snap := range entry.Snaps {
+			if snap == f.Snap {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Read returns the journal entries, rotated ones included, that match
+// the given filter, in the order they were recorded. Entries recorded
+// but not yet written are written first. Lines that cannot be decoded
+// (for example, a partial write interrupted by a crash) are skipped.
+func Read(filter *Filter) ([]*Entry, error) {
+	if filter == nil {
+		filter = &Filter{}
+	}
+
+	fileMu.Lock()
+	defer fileMu.Unlock()
+
+	flushLocked()
+
+	var entries []*Entry
+	err := journal().Read(func(line []byte) {
+		var entry Entry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			logger.Debugf("Skipping invalid change journal entry: %v", err)
+		} else if filter.match(&entry) {
+			entries = append(entries, &entry)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
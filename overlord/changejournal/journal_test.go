@@ -0,0 +1,232 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package changejournal_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/overlord/changejournal"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/timings"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type journalSuite struct {
+	st *state.State
+}
+
+var _ = Suite(&journalSuite{})
+
+func (s *journalSuite) SetUpTest(c *C) {
+	dirs.SetRootDir(c.MkDir())
+	s.st = state.New(nil)
+	s.st.Lock()
+	s.st.AddChangeReadyHandler(changejournal.Record)
+	s.st.Unlock()
+}
+
+func (s *journalSuite) TearDownTest(c *C) {
+	changejournal.Flush()
+	dirs.SetRootDir("")
+}
+
+func (s *journalSuite) makeChange(c *C, kind, snap string, when time.Time) *state.Change {
+	restore := state.MockTime(when)
+	defer restore()
+
+	chg := s.st.NewChange(kind, "summary of "+kind)
+	chg.Set("snap-names", []string{snap})
+	t := s.st.NewTask("some-task", "do something")
+	t.Logf("did something")
+	chg.AddTask(t)
+
+	tm := timings.New(map[string]string{"change-id": chg.ID(), "task-id": t.ID(), "task-kind": t.Kind()})
+	tm.StartSpan("foo", "doing foo").Stop()
+	tm.Save(s.st)
+
+	t.SetStatus(state.DoneStatus)
+	return chg
+}
+
+func (s *journalSuite) TestRecordAndRead(c *C) {
+	s.st.Lock()
+	defer s.st.Unlock()
+
+	oldDurationThreshold := timings.DurationThreshold
+	timings.DurationThreshold = 0
+	defer func() { timings.DurationThreshold = oldDurationThreshold }()
+
+	t0 := time.Date(2019, 3, 11, 10, 0, 0, 0, time.UTC)
+	chg := s.makeChange(c, "install-snap", "foo", t0)
+	c.Assert(chg.Status(), Equals, state.DoneStatus)
+
+	entries, err := changejournal.Read(nil)
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 1)
+	entry := entries[0]
+	c.Check(entry.ID, Equals, chg.ID())
+	c.Check(entry.Kind, Equals, "install-snap")
+	c.Check(entry.Summary, Equals, "summary of install-snap")
+	c.Check(entry.Status, Equals, "Done")
+	c.Check(entry.Ready, Equals, true)
+	c.Check(entry.Snaps, DeepEquals, []string{"foo"})
+	c.Check(entry.ReadyTime.Equal(t0), Equals, true)
+	c.Assert(entry.Tasks, HasLen, 1)
+	task := entry.Tasks[0]
+	c.Check(task.Kind, Equals, "some-task")
+	c.Check(task.Status, Equals, "Done")
+	c.Assert(task.Log, HasLen, 1)
+	c.Check(task.Log[0], Matches, ".* INFO did something")
+	c.Assert(task.Timings, HasLen, 1)
+	c.Assert(task.Timings[0].NestedTimings, HasLen, 1)
+	c.Check(task.Timings[0].NestedTimings[0].Label, Equals, "foo")
+
+	// the journal is not readable by others
+	st, err := os.Stat(dirs.SnapChangesJournalFile)
+	c.Assert(err, IsNil)
+	c.Check(st.Mode().Perm(), Equals, os.FileMode(0600))
+}
+
+func (s *journalSuite) TestReadFilter(c *C) {
+	s.st.Lock()
+	defer s.st.Unlock()
+
+	t0 := time.Date(2019, 3, 11, 10, 0, 0, 0, time.UTC)
+	chg1 := s.makeChange(c, "install-snap", "foo", t0)
+	chg2 := s.makeChange(c, "remove-snap", "foo", t0.Add(time.Hour))
+	chg3 := s.makeChange(c, "install-snap", "bar", t0.Add(2*time.Hour))
+
+	ids := func(filter *changejournal.Filter) []string {
+		entries, err := changejournal.Read(filter)
+		c.Assert(err, IsNil)
+		var ids []string
+		for _, entry := range entries {
+			ids = append(ids, entry.ID)
+		}
+		return ids
+	}
+
+	c.Check(ids(nil), DeepEquals, []string{chg1.ID(), chg2.ID(), chg3.ID()})
+	c.Check(ids(&changejournal.Filter{Since: t0.Add(time.Hour)}), DeepEquals, []string{chg2.ID(), chg3.ID()})
+	c.Check(ids(&changejournal.Filter{Kind: "install-snap"}), DeepEquals, []string{chg1.ID(), chg3.ID()})
+	c.Check(ids(&changejournal.Filter{Snap: "foo"}), DeepEquals, []string{chg1.ID(), chg2.ID()})
+	c.Check(ids(&changejournal.Filter{Kind: "remove-snap", Snap: "bar"}), HasLen, 0)
+}
+
+func (s *journalSuite) TestReadNoJournal(c *C) {
+	entries, err := changejournal.Read(nil)
+	c.Assert(err, IsNil)
+	c.Check(entries, HasLen, 0)
+}
+
+func (s *journalSuite) TestReadSkipsInvalidLines(c *C) {
+	c.Assert(os.MkdirAll(filepath.Dir(dirs.SnapChangesJournalFile), 0755), IsNil)
+	content := `{"id":"1","kind":"foo","ready-time":"2019-03-11T10:00:00Z"}
+{"id":"2","kin
+{"id":"3","kind":"bar","ready-time":"2019-03-11T11:00:00Z"}
+{"id":"4","ki`
+	c.Assert(ioutil.WriteFile(dirs.SnapChangesJournalFile, []byte(content), 0600), IsNil)
+
+	entries, err := changejournal.Read(nil)
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 2)
+	c.Check(entries[0].ID, Equals, "1")
+	c.Check(entries[1].ID, Equals, "3")
+}
+
+func (s *journalSuite) TestRecordAfterPartialLine(c *C) {
+	c.Assert(os.MkdirAll(filepath.Dir(dirs.SnapChangesJournalFile), 0755), IsNil)
+	content := `{"id":"1","kind":"foo","ready-time":"2019-03-11T10:00:00Z"}
+{"id":"2","ki`
+	c.Assert(ioutil.WriteFile(dirs.SnapChangesJournalFile, []byte(content), 0600), IsNil)
+
+	s.st.Lock()
+	chg := s.makeChange(c, "install-snap", "foo", time.Now())
+	s.st.Unlock()
+
+	// the entry after the cut short one is not lost with it
+	entries, err := changejournal.Read(nil)
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 2)
+	c.Check(entries[0].ID, Equals, "1")
+	c.Check(entries[1].ID, Equals, chg.ID())
+}
+
+func (s *journalSuite) TestRecordWritesInBackground(c *C) {
+	s.st.Lock()
+	chg := s.makeChange(c, "install-snap", "foo", time.Now())
+	c.Assert(chg.Status(), Equals, state.DoneStatus)
+
+	// the journal is written while the state is still locked
+	for i := 0; i < 500 && !osutil.FileExists(dirs.SnapChangesJournalFile); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.st.Unlock()
+
+	changejournal.Flush()
+	content, err := ioutil.ReadFile(dirs.SnapChangesJournalFile)
+	c.Assert(err, IsNil)
+	c.Check(string(content), Matches, `\{"id":"`+chg.ID()+`".*\n`)
+}
+
+func (s *journalSuite) TestRotate(c *C) {
+	s.st.Lock()
+	defer s.st.Unlock()
+
+	t0 := time.Date(2019, 3, 11, 10, 0, 0, 0, time.UTC)
+	chg1 := s.makeChange(c, "install-snap", "foo", t0)
+	entries, err := changejournal.Read(nil)
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 1)
+	fi, err := os.Stat(dirs.SnapChangesJournalFile)
+	c.Assert(err, IsNil)
+
+	// room for one entry per journal, and two rotated ones
+	defer changejournal.MockMaxSize(fi.Size()+fi.Size()/2, 2)()
+
+	var ids []string
+	for i := 1; i <= 3; i++ {
+		chg := s.makeChange(c, "install-snap", "foo", t0.Add(time.Duration(i)*time.Hour))
+		ids = append(ids, chg.ID())
+		changejournal.Flush()
+	}
+	c.Check(osutil.FileExists(dirs.SnapChangesJournalFile+".1"), Equals, true)
+	c.Check(osutil.FileExists(dirs.SnapChangesJournalFile+".2"), Equals, true)
+	c.Check(osutil.FileExists(dirs.SnapChangesJournalFile+".3"), Equals, false)
+
+	// the oldest change was dropped, the rest are read in order
+	entries, err = changejournal.Read(nil)
+	c.Assert(err, IsNil)
+	var got []string
+	for _, entry := range entries {
+		c.Check(entry.ID, Not(Equals), chg1.ID())
+		got = append(got, entry.ID)
+	}
+	c.Check(got, DeepEquals, ids)
+}
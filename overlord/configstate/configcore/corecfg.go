@@ -22,6 +22,7 @@ package configcore
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/snapcore/snapd/overlord/configstate/config"
 	"github.com/snapcore/snapd/release"
@@ -48,6 +49,23 @@ func coreCfg(tr config.Conf, key string) (result string, err error) {
 // The actual values are populated by `init()` functions in each module.
 var supportedConfigurations = make(map[string]bool, 32)
 
+// supportedConfigurationPrefixes contains a set of handled prefixes of
+// configuration keys, for keys nested under a name of the user's
+// choosing (e.g. core.tasks.max-concurrent.<task-kind>).
+var supportedConfigurationPrefixes = make(map[string]bool)
+
+func isSupportedConfiguration(key string) bool {
+	if supportedConfigurations[key] {
+		return true
+	}
+	for prefix := range supportedConfigurationPrefixes {
+		if strings.HasPrefix(key, prefix) && len(key) > len(prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 func validateBoolFlag(tr config.Conf, flag string) error {
 	value, err := coreCfg(tr, flag)
 	if err != nil {
@@ -65,7 +83,7 @@ func validateBoolFlag(tr config.Conf, flag string) error {
 func Run(tr config.Conf) error {
 	// check if the changes
 	for _, k := range tr.Changes() {
-		if !supportedConfigurations[k] {
+		if !isSupportedConfiguration(k) {
 			return fmt.Errorf("cannot set %q: unsupported system option", k)
 		}
 	}
@@ -88,6 +106,15 @@ func Run(tr config.Conf) error {
 	if err := validateNetworkSettings(tr); err != nil {
 		return err
 	}
+	if err := validateAutomaticSnapshotsRetention(tr); err != nil {
+		return err
+	}
+	if err := validateSnapshotsEncryptionKeyFile(tr); err != nil {
+		return err
+	}
+	if err := validateTaskPolicy(tr); err != nil {
+		return err
+	}
 	// FIXME: ensure the user cannot set "core seed.loaded"
 
 	// capture cloud information
@@ -37,6 +37,7 @@ func init() {
 	supportedConfigurations["core.refresh.metered"] = true
 	supportedConfigurations["core.refresh.retain"] = true
 	supportedConfigurations["core.refresh.rate-limit"] = true
+	supportedConfigurations["core.refresh.batch-size"] = true
 }
 
 func validateRefreshSchedule(tr config.Conf) error {
@@ -50,6 +51,16 @@ func validateRefreshSchedule(tr config.Conf) error {
 		}
 	}
 
+	refreshBatchSizeStr, err := coreCfg(tr, "refresh.batch-size")
+	if err != nil {
+		return err
+	}
+	if refreshBatchSizeStr != "" {
+		if _, err := strconv.ParseUint(refreshBatchSizeStr, 10, 8); err != nil {
+			return fmt.Errorf("batch-size must be a number between 0 and 255, not %q", refreshBatchSizeStr)
+		}
+	}
+
 	refreshHoldStr, err := coreCfg(tr, "refresh.hold")
 	if err != nil {
 		return err
@@ -20,6 +20,8 @@
 package configcore_test
 
 import (
+	"fmt"
+
 	. "gopkg.in/check.v1"
 
 	"github.com/snapcore/snapd/overlord/configstate/configcore"
@@ -167,3 +169,25 @@ func (s *refreshSuite) TestConfigureRefreshRetainInvalid(c *C) {
 	})
 	c.Assert(err, ErrorMatches, `retain must be a number between 2 and 20, not "invalid"`)
 }
+
+func (s *refreshSuite) TestConfigureRefreshBatchSizeHappy(c *C) {
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"refresh.batch-size": "2",
+		},
+	})
+	c.Assert(err, IsNil)
+}
+
+func (s *refreshSuite) TestConfigureRefreshBatchSizeInvalid(c *C) {
+	for _, v := range []string{"-1", "256", "invalid"} {
+		err := configcore.Run(&mockConf{
+			state: s.state,
+			conf: map[string]interface{}{
+				"refresh.batch-size": v,
+			},
+		})
+		c.Check(err, ErrorMatches, fmt.Sprintf(`batch-size must be a number between 0 and 255, not %q`, v))
+	}
+}
@@ -0,0 +1,64 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package configcore
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/snapcore/snapd/overlord/configstate/config"
+)
+
+func init() {
+	supportedConfigurations["core.snapshots.automatic.retention"] = true
+	supportedConfigurations["core.snapshots.encryption-key-file"] = true
+}
+
+func validateAutomaticSnapshotsRetention(tr config.Conf) error {
+	retentionStr, err := coreCfg(tr, "snapshots.automatic.retention")
+	if err != nil {
+		return err
+	}
+	switch retentionStr {
+	case "", "no":
+		// noop
+	default:
+		retention, err := time.ParseDuration(retentionStr)
+		if err != nil {
+			return fmt.Errorf("snapshots.automatic.retention cannot be parsed: %v", err)
+		}
+		if retention < 24*time.Hour {
+			return fmt.Errorf("snapshots.automatic.retention must be \"no\" or at least 24h, not %q", retentionStr)
+		}
+	}
+	return nil
+}
+
+func validateSnapshotsEncryptionKeyFile(tr config.Conf) error {
+	keyFile, err := coreCfg(tr, "snapshots.encryption-key-file")
+	if err != nil {
+		return err
+	}
+	if keyFile != "" && !filepath.IsAbs(keyFile) {
+		return fmt.Errorf("snapshots.encryption-key-file must be an absolute path, not %q", keyFile)
+	}
+	return nil
+}
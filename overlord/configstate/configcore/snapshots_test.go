@@ -0,0 +1,82 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package configcore_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/overlord/configstate/configcore"
+)
+
+type snapshotsSuite struct {
+	configcoreSuite
+}
+
+var _ = Suite(&snapshotsSuite{})
+
+func (s *snapshotsSuite) TestConfigureAutomaticSnapshotsRetentionHappy(c *C) {
+	for _, retention := range []string{"", "no", "24h", "720h"} {
+		err := configcore.Run(&mockConf{
+			state: s.state,
+			conf: map[string]interface{}{
+				"snapshots.automatic.retention": retention,
+			},
+		})
+		c.Check(err, IsNil, Commentf(retention))
+	}
+}
+
+func (s *snapshotsSuite) TestConfigureAutomaticSnapshotsRetentionRejected(c *C) {
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"snapshots.automatic.retention": "invalid",
+		},
+	})
+	c.Check(err, ErrorMatches, `snapshots.automatic.retention cannot be parsed: time: invalid duration "?invalid"?`)
+
+	err = configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"snapshots.automatic.retention": "23h",
+		},
+	})
+	c.Check(err, ErrorMatches, `snapshots.automatic.retention must be "no" or at least 24h, not "23h"`)
+}
+
+func (s *snapshotsSuite) TestConfigureSnapshotsEncryptionKeyFile(c *C) {
+	for _, keyFile := range []string{"", "/etc/snapd/snapshots.key"} {
+		err := configcore.Run(&mockConf{
+			state: s.state,
+			conf: map[string]interface{}{
+				"snapshots.encryption-key-file": keyFile,
+			},
+		})
+		c.Check(err, IsNil, Commentf(keyFile))
+	}
+
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"snapshots.encryption-key-file": "snapshots.key",
+		},
+	})
+	c.Check(err, ErrorMatches, `snapshots.encryption-key-file must be an absolute path, not "snapshots.key"`)
+}
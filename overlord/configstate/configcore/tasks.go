@@ -0,0 +1,74 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package configcore
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/snapcore/snapd/overlord/configstate/config"
+)
+
+func init() {
+	// tasks.max-concurrent.<task-kind>
+	supportedConfigurationPrefixes["core.tasks.max-concurrent."] = true
+	// changes.priority.<change-kind>
+	supportedConfigurationPrefixes["core.changes.priority."] = true
+}
+
+func validateTaskPolicy(tr config.Conf) error {
+	for _, k := range tr.Changes() {
+		var prefix string
+		var minimum int
+		switch {
+		case strings.HasPrefix(k, "core.tasks.max-concurrent."):
+			prefix = "core.tasks.max-concurrent."
+			minimum = 0
+		case strings.HasPrefix(k, "core.changes.priority."):
+			prefix = "core.changes.priority."
+			minimum = -1000
+		default:
+			continue
+		}
+		option := strings.TrimPrefix(k, "core.")
+		if kind := strings.TrimPrefix(k, prefix); strings.Contains(kind, ".") {
+			// the options are read back as a map of kinds to numbers
+			return fmt.Errorf("cannot set %s: %q is not a valid kind", option, kind)
+		}
+		var v interface{}
+		if err := tr.Get("core", option, &v); err != nil && !config.IsNoOption(err) {
+			return err
+		}
+		if v == nil || v == "" {
+			// unset
+			continue
+		}
+		switch v.(type) {
+		case map[string]interface{}, []interface{}:
+			return fmt.Errorf("%s must be a number between %d and 1000, not a map or list", option, minimum)
+		}
+		value := fmt.Sprintf("%v", v)
+		if n, err := strconv.Atoi(value); err != nil || n < minimum || n > 1000 {
+			return fmt.Errorf("%s must be a number between %d and 1000, not %q", option, minimum, value)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package configcore_test
+
+import (
+	"encoding/json"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/overlord/configstate/configcore"
+)
+
+type tasksSuite struct {
+	configcoreSuite
+}
+
+var _ = Suite(&tasksSuite{})
+
+func (s *tasksSuite) TestConfigureTaskPolicyHappy(c *C) {
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		changes: map[string]interface{}{
+			"tasks.max-concurrent.download-snap": json.Number("2"),
+			"tasks.max-concurrent.link-snap":     "0",
+			"changes.priority.auto-refresh":      json.Number("-20"),
+			"changes.priority.install-snap":      "",
+		},
+	})
+	c.Check(err, IsNil)
+}
+
+func (s *tasksSuite) TestConfigureTaskPolicyRejected(c *C) {
+	for _, t := range []struct {
+		key   string
+		value interface{}
+		err   string
+	}{
+		{"tasks.max-concurrent.download-snap", "two", `tasks.max-concurrent.download-snap must be a number between 0 and 1000, not "two"`},
+		{"tasks.max-concurrent.download-snap", json.Number("-1"), `tasks.max-concurrent.download-snap must be a number between 0 and 1000, not "-1"`},
+		{"tasks.max-concurrent.download-snap", json.Number("1.5"), `tasks.max-concurrent.download-snap must be a number between 0 and 1000, not "1.5"`},
+		{"changes.priority.auto-refresh", json.Number("-1001"), `changes.priority.auto-refresh must be a number between -1000 and 1000, not "-1001"`},
+		{"tasks.max-concurrent.download-snap", map[string]interface{}{"a": json.Number("1")}, `tasks.max-concurrent.download-snap must be a number between 0 and 1000, not a map or list`},
+		{"changes.priority.auto-refresh", []interface{}{json.Number("1")}, `changes.priority.auto-refresh must be a number between -1000 and 1000, not a map or list`},
+		{"tasks.max-concurrent.download-snap.a", json.Number("1"), `cannot set tasks.max-concurrent.download-snap.a: "download-snap.a" is not a valid kind`},
+		{"changes.priority.auto-refresh.a", json.Number("1"), `cannot set changes.priority.auto-refresh.a: "auto-refresh.a" is not a valid kind`},
+	} {
+		err := configcore.Run(&mockConf{
+			state:   s.state,
+			changes: map[string]interface{}{t.key: t.value},
+		})
+		c.Check(err, ErrorMatches, t.err, Commentf("%s=%v", t.key, t.value))
+	}
+}
+
+func (s *tasksSuite) TestConfigureTaskPolicyUnsupported(c *C) {
+	for _, key := range []string{"tasks.max-concurrent", "tasks.max-concurrent.", "tasks.foo"} {
+		err := configcore.Run(&mockConf{
+			state:   s.state,
+			changes: map[string]interface{}{key: json.Number("1")},
+		})
+		c.Check(err, ErrorMatches, `cannot set "core.`+key+`": unsupported system option`)
+	}
+}
@@ -0,0 +1,320 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package denialstate collects the AppArmor and seccomp denials the
+// kernel logs for snaps, keeping them aggregated in the state.
+package denialstate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/snapcore/snapd/interfaces/denials"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/systemd"
+)
+
+var (
+	timeNow         = time.Now
+	kernelLogReader = systemd.KernelLogReader
+)
+
+const (
+	// initialEntries is how many journal entries the first
+	// collection looks at.
+	initialEntries = 10000
+	// maxRecords is how many records are kept, the least recently
+	// seen ones are dropped first.
+	maxRecords = 1000
+)
+
+// Record aggregates the denials of the same access by the same snap app
+// or hook.
+type Record struct {
+	denials.Denial
+	Count     int       `json:"count"`
+	FirstSeen time.Time `json:"first-seen"`
+	LastSeen  time.Time `json:"last-seen"`
+	// Interfaces are the interfaces whose connected plugs would grant
+	// the denied access.
+	Interfaces []string `json:"interfaces,omitempty"`
+}
+
+type byLastSeen []*Record
+
+func (r byLastSeen) Len() int           { return len(r) }
+func (r byLastSeen) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+func (r byLastSeen) Less(i, j int) bool { return r[i].LastSeen.Before(r[j].LastSeen) }
+
+type loggedDenial struct {
+	denial *denials.Denial
+	time   time.Time
+}
+
+// readDenials reads the denials logged after the given cursor, and
+// after the given time unless that is zero, returning them with the
+// cursor and the time of the last entry to continue from.
+func readDenials(cursor string, after time.Time) (found []loggedDenial, newCursor string, last time.Time, err error) {
+	r, err := kernelLogReader(cursor, initialEntries)
+	if err != nil {
+		return nil, "", time.Time{}, err
+	}
+	defer r.Close()
+
+	newCursor = cursor
+	last = after
+	dec := json.NewDecoder(r)
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, "", time.Time{}, fmt.Errorf("cannot decode journal entry: %v", err)
+		}
+		var entry struct {
+			Cursor string `json:"__CURSOR"`
+		}
+		if err := json.Unmarshal(raw, &entry); err == nil && entry.Cursor != "" {
+			newCursor = entry.Cursor
+		}
+		var l systemd.Log
+		if err := json.Unmarshal(raw, &l); err != nil {
+			// e.g. a message that is not valid UTF-8, which
+			// journald writes as an array of bytes
+			logger.Debugf("cannot decode journal entry: %v", err)
+			continue
+		}
+		t, err := l.Time()
+		if err == nil {
+			if !t.After(after) {
+				// handled by a previous collection
+				continue
+			}
+			if t.After(last) {
+				last = t
+			}
+		} else {
+			t = timeNow()
+		}
+		d, err := denials.Parse(l.Message())
+		if err != nil {
+			logger.Debugf("cannot parse denial: %v", err)
+			continue
+		}
+		if d == nil {
+			continue
+		}
+		found = append(found, loggedDenial{denial: d, time: t})
+	}
+	return found, newCursor, last, nil
+}
+
+// collectInterval is how often the manager collects denials.
+var collectInterval = 5 * time.Minute
+
+// DenialManager collects the denials the kernel logs for snaps.
+type DenialManager struct {
+	state       *state.State
+	lastCollect time.Time
+
+	collecting int32
+	wg         sync.WaitGroup
+}
+
+// Manager returns a new DenialManager.
+func Manager(st *state.State) *DenialManager {
+	// the first collection waits, so that it does not slow down
+	// starting up
+	return &DenialManager{state: st, lastCollect: timeNow()}
+}
+
+// Ensure is part of the overlord.StateManager interface. It starts
+// collecting, in the background, the denials logged since the previous
+// collection, unless that was less than collectInterval ago or is
+// still going on.
+func (m *DenialManager) Ensure() error {
+	now := timeNow()
+	if now.Sub(m.lastCollect) < collectInterval {
+		return nil
+	}
+	if !atomic.CompareAndSwapInt32(&m.collecting, 0, 1) {
+		return nil
+	}
+	m.lastCollect = now
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer atomic.StoreInt32(&m.collecting, 0)
+		if err := Collect(m.state); err != nil {
+			// the journal might just not be there, try again later
+			logger.Noticef("cannot collect denials: %v", err)
+		}
+	}()
+	return nil
+}
+
+// Wait implements StateWaiterStopper. It waits for a collection going
+// on to finish.
+func (m *DenialManager) Wait() {
+	m.wg.Wait()
+}
+
+// Stop implements StateWaiterStopper. As a collection only reads a
+// bounded part of the journal, it waits for it to finish.
+func (m *DenialManager) Stop() {
+	m.wg.Wait()
+}
+
+// collectLock serializes collections, which read the journal without
+// holding the state lock.
+var collectLock sync.Mutex
+
+// Collect adds the denials logged since the previous collection to the
+// state, suggesting interfaces for the new ones. The state must not be
+// locked.
+func Collect(st *state.State) error {
+	collectLock.Lock()
+	defer collectLock.Unlock()
+
+	st.Lock()
+	var cursor string
+	var lastTime time.Time
+	err := st.Get("denials-cursor", &cursor)
+	if err == nil || err == state.ErrNoState {
+		err = st.Get("denials-last-time", &lastTime)
+	}
+	st.Unlock()
+	if err != nil && err != state.ErrNoState {
+		return err
+	}
+
+	found, newCursor, newLastTime, err := readDenials(cursor, lastTime)
+	if err != nil {
+		if cursor != "" {
+			// the journal could have been rotated away from
+			// the cursor, start over next time; the entries
+			// read again are not newer than the last one
+			// handled, and so are skipped
+			st.Lock()
+			st.Set("denials-cursor", "")
+			st.Unlock()
+		}
+		return fmt.Errorf("cannot read denials from the journal: %v", err)
+	}
+
+	st.Lock()
+	defer st.Unlock()
+
+	records, err := allRecords(st)
+	if err != nil {
+		return err
+	}
+	if records == nil {
+		records = make(map[string]*Record)
+	}
+	suggesters := make(map[string]*denials.Suggester)
+	for _, logged := range found {
+		key := logged.denial.Key()
+		rec := records[key]
+		if rec == nil {
+			rec = &Record{Denial: *logged.denial, FirstSeen: logged.time}
+			rec.Interfaces = suggest(st, suggesters, logged.denial)
+			records[key] = rec
+		}
+		rec.Count++
+		if logged.time.After(rec.LastSeen) {
+			rec.LastSeen = logged.time
+		}
+	}
+	prune(records)
+
+	st.Set("denials", records)
+	st.Set("denials-cursor", newCursor)
+	if !newLastTime.IsZero() {
+		st.Set("denials-last-time", newLastTime)
+	}
+	return nil
+}
+
+func suggest(st *state.State, suggesters map[string]*denials.Suggester, d *denials.Denial) []string {
+	suggester, ok := suggesters[d.Snap]
+	if !ok {
+		// snaps can be removed after being denied
+		if info, err := snapstate.CurrentInfo(st, d.Snap); err == nil {
+			suggester = denials.NewSuggester(info)
+		}
+		suggesters[d.Snap] = suggester
+	}
+	if suggester == nil {
+		return nil
+	}
+	return suggester.Suggest(d)
+}
+
+// prune drops the least recently seen records beyond maxRecords.
+func prune(records map[string]*Record) {
+	if len(records) <= maxRecords {
+		return
+	}
+	all := make([]*Record, 0, len(records))
+	for _, rec := range records {
+		all = append(all, rec)
+	}
+	sort.Sort(byLastSeen(all))
+	for _, rec := range all[:len(all)-maxRecords] {
+		delete(records, rec.Key())
+	}
+}
+
+func allRecords(st *state.State) (map[string]*Record, error) {
+	var records map[string]*Record
+	if err := st.Get("denials", &records); err != nil && err != state.ErrNoState {
+		return nil, err
+	}
+	return records, nil
+}
+
+// All returns the collected denials of the given snaps, or of all snaps
+// if none are given, least recently seen first.
+func All(st *state.State, snapNames []string) ([]*Record, error) {
+	records, err := allRecords(st)
+	if err != nil {
+		return nil, err
+	}
+	wanted := make(map[string]bool, len(snapNames))
+	for _, name := range snapNames {
+		wanted[name] = true
+	}
+	all := make([]*Record, 0, len(records))
+	for _, rec := range records {
+		if len(snapNames) == 0 || wanted[rec.Snap] {
+			all = append(all, rec)
+		}
+	}
+	sort.Sort(byLastSeen(all))
+	return all, nil
+}
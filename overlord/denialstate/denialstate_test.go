@@ -0,0 +1,332 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package denialstate_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/interfaces/denials"
+	"github.com/snapcore/snapd/overlord/denialstate"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snaptest"
+)
+
+func TestDenialState(t *testing.T) { TestingT(t) }
+
+type denialSuite struct {
+	state *state.State
+
+	// the journal entries, and the cursors collections asked for
+	journal []map[string]interface{}
+	cursors []string
+	readErr error
+
+	restore func()
+}
+
+var _ = Suite(&denialSuite{})
+
+var t0 = time.Date(2019, 3, 12, 10, 0, 0, 0, time.UTC)
+
+func (s *denialSuite) SetUpTest(c *C) {
+	dirs.SetRootDir(c.MkDir())
+	s.state = state.New(nil)
+	s.journal = nil
+	s.cursors = nil
+	s.readErr = nil
+	s.restore = denialstate.MockKernelLogReader(func(afterCursor string, n int) (io.ReadCloser, error) {
+		c.Check(n, Equals, 10000)
+		s.cursors = append(s.cursors, afterCursor)
+		if s.readErr != nil {
+			return nil, s.readErr
+		}
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		for _, l := range s.journal {
+			if cursor, _ := l["__CURSOR"].(string); afterCursor != "" && cursor <= afterCursor {
+				continue
+			}
+			c.Assert(enc.Encode(l), IsNil)
+		}
+		return ioutil.NopCloser(&buf), nil
+	})
+}
+
+func (s *denialSuite) TearDownTest(c *C) {
+	s.restore()
+	dirs.SetRootDir("")
+}
+
+func (s *denialSuite) log(t time.Time, msg string) {
+	s.journal = append(s.journal, map[string]interface{}{
+		"__CURSOR":             fmt.Sprintf("c%03d", len(s.journal)),
+		"__REALTIME_TIMESTAMP": strconv.FormatInt(t.UnixNano()/1000, 10),
+		"MESSAGE":              msg,
+	})
+}
+
+func (s *denialSuite) mockSnap(c *C) {
+	si := &snap.SideInfo{RealName: "foo", Revision: snap.R(1)}
+	snaptest.MockSnap(c, "name: foo\nversion: 1\napps:\n  app:\n", si)
+	s.state.Lock()
+	defer s.state.Unlock()
+	snapstate.Set(s.state, "foo", &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{si},
+		Current:  si.Revision,
+	})
+}
+
+const (
+	videoDenial   = `apparmor="DENIED" operation="open" profile="snap.foo.app" name="/dev/video0" pid=1234 comm="app" requested_mask="wr" denied_mask="wr" fsuid=1000 ouid=0`
+	shadowDenial  = `apparmor="DENIED" operation="open" profile="snap.bar.app" name="/etc/shadow" pid=1234 comm="app" requested_mask="r" denied_mask="r" fsuid=1000 ouid=0`
+	unrelatedLine = `usb 1-1: new high-speed USB device number 2 using xhci_hcd`
+)
+
+func (s *denialSuite) TestCollect(c *C) {
+	s.mockSnap(c)
+	s.log(t0, videoDenial)
+	s.log(t0.Add(time.Second), unrelatedLine)
+	s.log(t0.Add(2*time.Second), shadowDenial)
+	s.log(t0.Add(3*time.Second), videoDenial)
+
+	c.Assert(denialstate.Collect(s.state), IsNil)
+
+	s.state.Lock()
+	records, err := denialstate.All(s.state, nil)
+	s.state.Unlock()
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 2)
+	c.Check(records[0], DeepEquals, &denialstate.Record{
+		Denial: denials.Denial{
+			Kind:      denials.AppArmor,
+			Snap:      "bar",
+			App:       "app",
+			Operation: "open",
+			Path:      "/etc/shadow",
+			Mask:      "r",
+		},
+		Count:     1,
+		FirstSeen: t0.Add(2 * time.Second),
+		LastSeen:  t0.Add(2 * time.Second),
+		// bar is not installed
+	})
+	c.Check(records[1], DeepEquals, &denialstate.Record{
+		Denial: denials.Denial{
+			Kind:      denials.AppArmor,
+			Snap:      "foo",
+			App:       "app",
+			Operation: "open",
+			Path:      "/dev/video0",
+			Mask:      "wr",
+		},
+		Count:      2,
+		FirstSeen:  t0,
+		LastSeen:   t0.Add(3 * time.Second),
+		Interfaces: []string{"camera"},
+	})
+
+	// the next collection continues where the previous one stopped
+	s.log(t0.Add(time.Minute), videoDenial)
+	c.Assert(denialstate.Collect(s.state), IsNil)
+	c.Check(s.cursors, DeepEquals, []string{"", "c003"})
+
+	s.state.Lock()
+	records, err = denialstate.All(s.state, []string{"foo"})
+	s.state.Unlock()
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 1)
+	c.Check(records[0].Count, Equals, 3)
+	c.Check(records[0].LastSeen, Equals, t0.Add(time.Minute))
+}
+
+func (s *denialSuite) TestCollectNoTimestamp(c *C) {
+	restore := denialstate.MockTimeNow(func() time.Time { return t0 })
+	defer restore()
+	s.journal = []map[string]interface{}{{"MESSAGE": shadowDenial}}
+
+	c.Assert(denialstate.Collect(s.state), IsNil)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	records, err := denialstate.All(s.state, nil)
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 1)
+	c.Check(records[0].FirstSeen, Equals, t0)
+}
+
+func (s *denialSuite) TestCollectErrorResetsCursor(c *C) {
+	s.log(t0, shadowDenial)
+	c.Assert(denialstate.Collect(s.state), IsNil)
+
+	s.readErr = fmt.Errorf("boom")
+	c.Check(denialstate.Collect(s.state), ErrorMatches, "cannot read denials from the journal: boom")
+	s.readErr = nil
+	c.Assert(denialstate.Collect(s.state), IsNil)
+	c.Check(s.cursors, DeepEquals, []string{"", "c000", ""})
+
+	// starting over does not count the denials already collected
+	// again
+	s.state.Lock()
+	defer s.state.Unlock()
+	records, err := denialstate.All(s.state, nil)
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 1)
+	c.Check(records[0].Count, Equals, 1)
+}
+
+func (s *denialSuite) TestCollectSkipsUndecodableEntries(c *C) {
+	s.log(t0, shadowDenial)
+	// journald writes a message that is not valid UTF-8 as an array
+	// of bytes
+	s.journal = append(s.journal, map[string]interface{}{
+		"__CURSOR":             "c001",
+		"__REALTIME_TIMESTAMP": strconv.FormatInt(t0.Add(time.Second).UnixNano()/1000, 10),
+		"MESSAGE":              []int{0xff, 0xfe},
+	})
+	s.log(t0.Add(2*time.Second), shadowDenial)
+
+	c.Assert(denialstate.Collect(s.state), IsNil)
+	s.log(t0.Add(3*time.Second), shadowDenial)
+	c.Assert(denialstate.Collect(s.state), IsNil)
+	// the next collection continues after the entry
+	c.Check(s.cursors, DeepEquals, []string{"", "c002"})
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	records, err := denialstate.All(s.state, nil)
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 1)
+	c.Check(records[0].Count, Equals, 3)
+}
+
+func (s *denialSuite) TestCollectPrunes(c *C) {
+	for i := 0; i < denialstate.MaxRecords+1; i++ {
+		s.log(t0.Add(time.Duration(i)*time.Second), fmt.Sprintf(`apparmor="DENIED" operation="open" profile="snap.bar.app" name="/etc/%d" pid=1 comm="app" requested_mask="r" denied_mask="r"`, i))
+	}
+	c.Assert(denialstate.Collect(s.state), IsNil)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	records, err := denialstate.All(s.state, nil)
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, denialstate.MaxRecords)
+	// the least recently seen is gone
+	c.Check(records[0].Path, Equals, "/etc/1")
+}
+
+func (s *denialSuite) TestManagerEnsure(c *C) {
+	now := t0
+	restore := denialstate.MockTimeNow(func() time.Time { return now })
+	defer restore()
+	restore = denialstate.MockCollectInterval(time.Minute)
+	defer restore()
+
+	mgr := denialstate.Manager(s.state)
+	s.log(t0, shadowDenial)
+	// nothing is collected right after starting
+	c.Assert(mgr.Ensure(), IsNil)
+	mgr.Wait()
+	c.Check(s.cursors, HasLen, 0)
+
+	now = now.Add(time.Minute)
+	c.Assert(mgr.Ensure(), IsNil)
+	mgr.Wait()
+	c.Check(s.cursors, DeepEquals, []string{""})
+
+	// too early to collect again
+	s.log(t0.Add(time.Second), shadowDenial)
+	now = now.Add(30 * time.Second)
+	c.Assert(mgr.Ensure(), IsNil)
+	mgr.Wait()
+	c.Check(s.cursors, DeepEquals, []string{""})
+
+	now = now.Add(time.Minute)
+	c.Assert(mgr.Ensure(), IsNil)
+	mgr.Wait()
+	c.Check(s.cursors, DeepEquals, []string{"", "c000"})
+
+	s.state.Lock()
+	records, err := denialstate.All(s.state, nil)
+	s.state.Unlock()
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 1)
+	c.Check(records[0].Count, Equals, 2)
+}
+
+func (s *denialSuite) TestManagerEnsureError(c *C) {
+	restore := denialstate.MockCollectInterval(0)
+	defer restore()
+
+	s.log(t0, shadowDenial)
+	mgr := denialstate.Manager(s.state)
+	c.Assert(mgr.Ensure(), IsNil)
+	mgr.Wait()
+
+	// errors are only logged, the collected denials stay
+	s.readErr = fmt.Errorf("boom")
+	c.Assert(mgr.Ensure(), IsNil)
+	mgr.Stop()
+	c.Check(s.cursors, DeepEquals, []string{"", "c000"})
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	records, err := denialstate.All(s.state, nil)
+	c.Assert(err, IsNil)
+	c.Check(records, HasLen, 1)
+}
+
+func (s *denialSuite) TestManagerEnsureInBackground(c *C) {
+	restore := denialstate.MockCollectInterval(0)
+	defer restore()
+
+	s.log(t0, shadowDenial)
+	reading := make(chan struct{})
+	unblock := make(chan struct{})
+	restore = denialstate.MockKernelLogReader(func(afterCursor string, n int) (io.ReadCloser, error) {
+		s.cursors = append(s.cursors, afterCursor)
+		close(reading)
+		<-unblock
+		return ioutil.NopCloser(&bytes.Buffer{}), nil
+	})
+	defer restore()
+
+	mgr := denialstate.Manager(s.state)
+	// Ensure returns while the journal is still being read
+	c.Assert(mgr.Ensure(), IsNil)
+	<-reading
+	// and does not start another collection meanwhile
+	c.Assert(mgr.Ensure(), IsNil)
+	close(unblock)
+	mgr.Wait()
+	c.Check(s.cursors, DeepEquals, []string{""})
+}
@@ -0,0 +1,51 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package denialstate
+
+import (
+	"io"
+	"time"
+)
+
+const MaxRecords = maxRecords
+
+func MockTimeNow(f func() time.Time) (restore func()) {
+	old := timeNow
+	timeNow = f
+	return func() {
+		timeNow = old
+	}
+}
+
+func MockKernelLogReader(f func(afterCursor string, n int) (io.ReadCloser, error)) (restore func()) {
+	old := kernelLogReader
+	kernelLogReader = f
+	return func() {
+		kernelLogReader = old
+	}
+}
+
+func MockCollectInterval(d time.Duration) (restore func()) {
+	old := collectInterval
+	collectInterval = d
+	return func() {
+		collectInterval = old
+	}
+}
@@ -74,3 +74,8 @@ func MockConfigstateInit(new func(hookmgr *hookstate.HookManager)) (restore func
 		configstateInit = configstate.Init
 	}
 }
+
+var (
+	ChangesReady       = changesReady
+	CheckpointDuration = checkpointDuration
+)
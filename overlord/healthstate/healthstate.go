@@ -0,0 +1,196 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package healthstate keeps track of the health snaps report about
+// themselves via snapctl set-health.
+package healthstate
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/snapcore/snapd/overlord/hookstate"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+)
+
+var timeNow = time.Now
+
+func init() {
+	snapstate.DiscardSnapHealth = Discard
+}
+
+// HealthStatus is the status of a snap as reported by itself.
+type HealthStatus int
+
+const (
+	UnknownStatus HealthStatus = iota
+	OkayStatus
+	WaitingStatus
+	BlockedStatus
+	ErrorStatus
+)
+
+var knownStatuses = []string{"unknown", "okay", "waiting", "blocked", "error"}
+
+// StatusLookup returns the HealthStatus for the given name.
+func StatusLookup(str string) (HealthStatus, error) {
+	for i, name := range knownStatuses {
+		if name == str {
+			return HealthStatus(i), nil
+		}
+	}
+	return UnknownStatus, fmt.Errorf("invalid status %q, must be one of \"okay\", \"waiting\", \"blocked\" or \"error\"", str)
+}
+
+func (s HealthStatus) String() string {
+	if s < 0 || int(s) >= len(knownStatuses) {
+		return fmt.Sprintf("invalid (%d)", s)
+	}
+	return knownStatuses[s]
+}
+
+func (s HealthStatus) MarshalJSON() ([]byte, error) {
+	if s < 0 || int(s) >= len(knownStatuses) {
+		return nil, fmt.Errorf("cannot marshal invalid health status %d", s)
+	}
+	return json.Marshal(knownStatuses[s])
+}
+
+func (s *HealthStatus) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return err
+	}
+	status, err := StatusLookup(str)
+	if err != nil {
+		return err
+	}
+	*s = status
+	return nil
+}
+
+// HealthState is the health reported by a snap.
+type HealthState struct {
+	Revision  snap.Revision `json:"revision"`
+	Timestamp time.Time     `json:"timestamp"`
+	Status    HealthStatus  `json:"status"`
+	Message   string        `json:"message,omitempty"`
+	Code      string        `json:"code,omitempty"`
+}
+
+var validCode = regexp.MustCompile(`^[a-z](?:-?[a-z0-9])+$`)
+
+// Validate checks that the health is one snaps are allowed to report.
+func (h *HealthState) Validate() error {
+	if h.Status == UnknownStatus {
+		return fmt.Errorf(`status cannot be "unknown"`)
+	}
+	if h.Status != OkayStatus && h.Message == "" {
+		return fmt.Errorf(`a message is required when status is not "okay"`)
+	}
+	if n := len(h.Message); n != 0 && (n < 7 || n > 70) {
+		return fmt.Errorf("message must be between 7 and 70 characters long, not %d", n)
+	}
+	if h.Code != "" && (len(h.Code) < 3 || len(h.Code) > 30 || !validCode.MatchString(h.Code)) {
+		return fmt.Errorf("invalid code %q", h.Code)
+	}
+	return nil
+}
+
+// All returns the health reported by all snaps, by instance name.
+func All(st *state.State) (map[string]*HealthState, error) {
+	var health map[string]*HealthState
+	if err := st.Get("health", &health); err != nil && err != state.ErrNoState {
+		return nil, err
+	}
+	return health, nil
+}
+
+// Get returns the health reported by the given snap, or nil if it
+// reported none.
+func Get(st *state.State, instanceName string) (*HealthState, error) {
+	health, err := All(st)
+	if err != nil {
+		return nil, err
+	}
+	return health[instanceName], nil
+}
+
+// Set records the health reported by the given snap, raising a warning
+// when the snap moves to the error status.
+func Set(st *state.State, instanceName string, h *HealthState) error {
+	health, err := All(st)
+	if err != nil {
+		return err
+	}
+	if health == nil {
+		health = make(map[string]*HealthState)
+	}
+	old := health[instanceName]
+	if h.Status == ErrorStatus && (old == nil || old.Status != ErrorStatus) {
+		st.Warnf("snap %q is reporting an error: %s", instanceName, h.Message)
+	}
+	health[instanceName] = h
+	st.Set("health", health)
+	return nil
+}
+
+// Discard forgets the health reported by the given snap, as it is
+// being removed.
+func Discard(st *state.State, instanceName string) error {
+	health, err := All(st)
+	if err != nil {
+		return err
+	}
+	if _, ok := health[instanceName]; !ok {
+		return nil
+	}
+	delete(health, instanceName)
+	st.Set("health", health)
+	return nil
+}
+
+// SetFromHookContext records the health the snap of the given context
+// requested via snapctl set-health. The context must be locked.
+func SetFromHookContext(context *hookstate.Context) error {
+	var h HealthState
+	if err := context.Get("health", &h); err != nil {
+		if err == state.ErrNoState {
+			return nil
+		}
+		return err
+	}
+
+	h.Revision = context.SnapRevision()
+	if h.Revision.Unset() {
+		// ephemeral contexts do not know the revision
+		var snapst snapstate.SnapState
+		if err := snapstate.Get(context.State(), context.InstanceName(), &snapst); err != nil {
+			return err
+		}
+		h.Revision = snapst.Current
+	}
+	h.Timestamp = timeNow()
+
+	return Set(context.State(), context.InstanceName(), &h)
+}
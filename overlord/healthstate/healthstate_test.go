@@ -0,0 +1,173 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package healthstate_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/overlord/healthstate"
+	"github.com/snapcore/snapd/overlord/hookstate"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+)
+
+func TestHealthState(t *testing.T) { TestingT(t) }
+
+type healthSuite struct {
+	state *state.State
+}
+
+var _ = Suite(&healthSuite{})
+
+func (s *healthSuite) SetUpTest(c *C) {
+	s.state = state.New(nil)
+}
+
+func (s *healthSuite) TestStatusRoundTrip(c *C) {
+	for i, name := range []string{"unknown", "okay", "waiting", "blocked", "error"} {
+		status, err := healthstate.StatusLookup(name)
+		c.Assert(err, IsNil)
+		c.Check(status, Equals, healthstate.HealthStatus(i))
+		c.Check(status.String(), Equals, name)
+
+		bs, err := json.Marshal(status)
+		c.Assert(err, IsNil)
+		c.Check(string(bs), Equals, `"`+name+`"`)
+
+		var other healthstate.HealthStatus
+		c.Assert(json.Unmarshal(bs, &other), IsNil)
+		c.Check(other, Equals, status)
+	}
+
+	_, err := healthstate.StatusLookup("potato")
+	c.Check(err, ErrorMatches, `invalid status "potato", .*`)
+	_, err = json.Marshal(healthstate.HealthStatus(42))
+	c.Check(err, ErrorMatches, ".*cannot marshal invalid health status 42")
+	c.Check(healthstate.HealthStatus(42).String(), Equals, "invalid (42)")
+}
+
+func (s *healthSuite) TestValidate(c *C) {
+	for _, t := range []struct {
+		health healthstate.HealthState
+		err    string
+	}{
+		{healthstate.HealthState{Status: healthstate.OkayStatus}, ""},
+		{healthstate.HealthState{Status: healthstate.ErrorStatus, Message: "it is broken", Code: "is-broken"}, ""},
+		{healthstate.HealthState{Status: healthstate.UnknownStatus}, `status cannot be "unknown"`},
+		{healthstate.HealthState{Status: healthstate.WaitingStatus}, `a message is required when status is not "okay"`},
+		{healthstate.HealthState{Status: healthstate.OkayStatus, Message: "short"}, "message must be between 7 and 70 characters long, not 5"},
+		{healthstate.HealthState{Status: healthstate.OkayStatus, Code: "-bad"}, `invalid code "-bad"`},
+		{healthstate.HealthState{Status: healthstate.OkayStatus, Code: "a-very-long-code-that-is-not-allowed"}, `invalid code ".*"`},
+	} {
+		err := t.health.Validate()
+		if t.err == "" {
+			c.Check(err, IsNil, Commentf("%+v", t.health))
+		} else {
+			c.Check(err, ErrorMatches, t.err, Commentf("%+v", t.health))
+		}
+	}
+}
+
+func (s *healthSuite) TestSetWarnsOnError(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	c.Assert(healthstate.Set(s.state, "foo", &healthstate.HealthState{
+		Revision: snap.R(1),
+		Status:   healthstate.WaitingStatus,
+		Message:  "starting up",
+	}), IsNil)
+	c.Check(s.state.AllWarnings(), HasLen, 0)
+
+	for i := 0; i < 2; i++ {
+		c.Assert(healthstate.Set(s.state, "foo", &healthstate.HealthState{
+			Revision: snap.R(1),
+			Status:   healthstate.ErrorStatus,
+			Message:  "cannot open database",
+		}), IsNil)
+	}
+	// only the move to error is warned about
+	warnings := s.state.AllWarnings()
+	c.Assert(warnings, HasLen, 1)
+	c.Check(warnings[0].String(), Equals, `snap "foo" is reporting an error: cannot open database`)
+
+	all, err := healthstate.All(s.state)
+	c.Assert(err, IsNil)
+	c.Check(all, HasLen, 1)
+	c.Check(all["foo"].Status, Equals, healthstate.ErrorStatus)
+}
+
+func (s *healthSuite) TestDiscard(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	for _, name := range []string{"foo", "bar"} {
+		c.Assert(healthstate.Set(s.state, name, &healthstate.HealthState{
+			Revision: snap.R(1),
+			Status:   healthstate.OkayStatus,
+		}), IsNil)
+	}
+
+	// snapstate drops the health of removed snaps
+	c.Assert(snapstate.DiscardSnapHealth(s.state, "foo"), IsNil)
+	health, err := healthstate.All(s.state)
+	c.Assert(err, IsNil)
+	c.Check(health, HasLen, 1)
+	c.Check(health["bar"], NotNil)
+
+	// snaps that reported nothing are fine
+	c.Check(healthstate.Discard(s.state, "baz"), IsNil)
+}
+
+func (s *healthSuite) TestSetFromHookContext(c *C) {
+	now := time.Date(2019, 5, 1, 10, 0, 0, 0, time.UTC)
+	restore := healthstate.MockTimeNow(func() time.Time { return now })
+	defer restore()
+
+	s.state.Lock()
+	task := s.state.NewTask("run-hook", "...")
+	s.state.Unlock()
+	context, err := hookstate.NewContext(task, s.state, &hookstate.HookSetup{Snap: "foo", Revision: snap.R(3), Hook: "configure"}, nil, "")
+	c.Assert(err, IsNil)
+
+	context.Lock()
+	defer context.Unlock()
+
+	// nothing was requested
+	c.Assert(healthstate.SetFromHookContext(context), IsNil)
+	health, err := healthstate.Get(s.state, "foo")
+	c.Assert(err, IsNil)
+	c.Check(health, IsNil)
+
+	context.Set("health", &healthstate.HealthState{Status: healthstate.OkayStatus})
+	c.Assert(healthstate.SetFromHookContext(context), IsNil)
+	health, err = healthstate.Get(s.state, "foo")
+	c.Assert(err, IsNil)
+	c.Check(health, DeepEquals, &healthstate.HealthState{
+		Revision:  snap.R(3),
+		Timestamp: now,
+		Status:    healthstate.OkayStatus,
+	})
+}
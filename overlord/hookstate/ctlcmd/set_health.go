@@ -0,0 +1,93 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ctlcmd
+
+import (
+	"fmt"
+
+	"github.com/snapcore/snapd/i18n"
+	"github.com/snapcore/snapd/overlord/healthstate"
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+var (
+	shortSetHealthHelp = i18n.G("Report the health status of a snap")
+	longSetHealthHelp  = i18n.G(`
+The set-health command is called from within a snap to inform the system of the
+snap's overall health.
+
+It can be called from any hook, and from the apps themselves. The reported
+health is shown by "snap list" and "snap info", and a warning is issued when the
+snap moves to the "error" status.
+
+The status can be one of "okay", "waiting", "blocked" or "error". A message is
+required unless the status is "okay":
+
+    $ snapctl set-health blocked "waiting for the network" --code=no-network
+`)
+)
+
+func init() {
+	addCommand("set-health", shortSetHealthHelp, longSetHealthHelp, func() command { return &setHealthCommand{} })
+}
+
+type setHealthCommand struct {
+	baseCommand
+	Positional struct {
+		Status  string `positional-arg-name:"<status>" required:"yes"`
+		Message string `positional-arg-name:"<message>"`
+	} `positional-args:"yes"`
+	Code string `long:"code" value-name:"<code>"`
+}
+
+func (c *setHealthCommand) Execute([]string) error {
+	status, err := healthstate.StatusLookup(c.Positional.Status)
+	if err != nil {
+		return err
+	}
+	health := healthstate.HealthState{
+		Status:  status,
+		Message: c.Positional.Message,
+		Code:    c.Code,
+	}
+	if err := health.Validate(); err != nil {
+		return err
+	}
+
+	context := c.context()
+	if context == nil {
+		return fmt.Errorf("cannot set health without a context")
+	}
+
+	context.Lock()
+	defer context.Unlock()
+
+	// the health is recorded once the hook is done, only register
+	// for that the first time around
+	var v healthstate.HealthState
+	if err := context.Get("health", &v); err == state.ErrNoState {
+		context.OnDone(func() error {
+			return healthstate.SetFromHookContext(context)
+		})
+	}
+	context.Set("health", &health)
+
+	return nil
+}
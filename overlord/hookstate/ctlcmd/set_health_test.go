@@ -0,0 +1,125 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ctlcmd_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/overlord/healthstate"
+	"github.com/snapcore/snapd/overlord/hookstate"
+	"github.com/snapcore/snapd/overlord/hookstate/ctlcmd"
+	"github.com/snapcore/snapd/overlord/hookstate/hooktest"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+)
+
+type setHealthSuite struct {
+	state       *state.State
+	mockContext *hookstate.Context
+}
+
+var _ = Suite(&setHealthSuite{})
+
+func (s *setHealthSuite) SetUpTest(c *C) {
+	s.state = state.New(nil)
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	task := s.state.NewTask("test-task", "my test task")
+	setup := &hookstate.HookSetup{Snap: "test-snap", Revision: snap.R(1), Hook: "check-health"}
+
+	var err error
+	s.mockContext, err = hookstate.NewContext(task, s.state, setup, hooktest.NewMockHandler(), "")
+	c.Assert(err, IsNil)
+}
+
+func (s *setHealthSuite) TestInvalidArguments(c *C) {
+	for _, t := range []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"set-health"}, "the required argument `<status>` was not provided"},
+		{[]string{"set-health", "fine"}, `invalid status "fine", must be one of "okay", "waiting", "blocked" or "error"`},
+		{[]string{"set-health", "unknown", "no idea yet"}, `status cannot be "unknown"`},
+		{[]string{"set-health", "blocked"}, `a message is required when status is not "okay"`},
+		{[]string{"set-health", "error", "oops"}, `message must be between 7 and 70 characters long, not 4`},
+		{[]string{"set-health", "error", "something went wrong", "--code=Bad_Code"}, `invalid code "Bad_Code"`},
+		{[]string{"set-health", "error", "something went wrong", "--code=ab"}, `invalid code "ab"`},
+	} {
+		_, _, err := ctlcmd.Run(s.mockContext, t.args, 0)
+		c.Check(err, ErrorMatches, t.err, Commentf("%v", t.args))
+	}
+}
+
+func (s *setHealthSuite) TestCommand(c *C) {
+	stdout, stderr, err := ctlcmd.Run(s.mockContext, []string{"set-health", "waiting", "starting up..."}, 0)
+	c.Assert(err, IsNil)
+	c.Check(string(stdout), Equals, "")
+	c.Check(string(stderr), Equals, "")
+	// the last call wins
+	_, _, err = ctlcmd.Run(s.mockContext, []string{"set-health", "blocked", "no network yet", "--code=no-network"}, 1000)
+	c.Assert(err, IsNil)
+
+	s.mockContext.Lock()
+	defer s.mockContext.Unlock()
+
+	// nothing is recorded until the hook is done
+	health, err := healthstate.Get(s.state, "test-snap")
+	c.Assert(err, IsNil)
+	c.Check(health, IsNil)
+
+	c.Assert(s.mockContext.Done(), IsNil)
+
+	health, err = healthstate.Get(s.state, "test-snap")
+	c.Assert(err, IsNil)
+	c.Assert(health, NotNil)
+	c.Check(health.Revision, Equals, snap.R(1))
+	c.Check(health.Status, Equals, healthstate.BlockedStatus)
+	c.Check(health.Message, Equals, "no network yet")
+	c.Check(health.Code, Equals, "no-network")
+	c.Check(health.Timestamp.IsZero(), Equals, false)
+}
+
+func (s *setHealthSuite) TestCommandEphemeral(c *C) {
+	s.state.Lock()
+	snapstate.Set(s.state, "test-snap", &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{{RealName: "test-snap", Revision: snap.R(7)}},
+		Current:  snap.R(7),
+	})
+	s.state.Unlock()
+
+	context, err := hookstate.NewContext(nil, s.state, &hookstate.HookSetup{Snap: "test-snap"}, nil, "")
+	c.Assert(err, IsNil)
+
+	_, _, err = ctlcmd.Run(context, []string{"set-health", "okay"}, 0)
+	c.Assert(err, IsNil)
+
+	context.Lock()
+	defer context.Unlock()
+	c.Assert(context.Done(), IsNil)
+
+	health, err := healthstate.Get(s.state, "test-snap")
+	c.Assert(err, IsNil)
+	c.Assert(health, NotNil)
+	c.Check(health.Revision, Equals, snap.R(7))
+	c.Check(health.Status, Equals, healthstate.OkayStatus)
+}
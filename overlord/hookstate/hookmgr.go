@@ -87,6 +87,14 @@ type HookSetup struct {
 	TrackError  bool          `json:"track-error,omitempty"`
 }
 
+// runHookRetryPolicy is how run-hook tasks are retried while snapd is
+// restarting: with growing delays, but never giving up.
+var runHookRetryPolicy = &state.RetryPolicy{
+	Delay:      time.Second,
+	Multiplier: 2,
+	MaxDelay:   30 * time.Second,
+}
+
 // Manager returns a new HookManager.
 func Manager(s *state.State, runner *state.TaskRunner) (*HookManager, error) {
 	// Make sure we only run 1 hook task for given snap at a time
@@ -121,7 +129,7 @@ func Manager(s *state.State, runner *state.TaskRunner) (*HookManager, error) {
 		runner:     runner,
 	}
 
-	runner.AddHandler("run-hook", manager.doRunHook, manager.undoRunHook)
+	runner.AddHandlerWithRetryPolicy("run-hook", manager.doRunHook, manager.undoRunHook, runHookRetryPolicy)
 	// Compatibility with snapd between 2.29 and 2.30 in edge only.
 	// We generated a configure-snapd task on core refreshes and
 	// for compatibility we need to handle those.
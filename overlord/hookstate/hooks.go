@@ -31,6 +31,7 @@ func init() {
 	snapstate.SetupPreRefreshHook = SetupPreRefreshHook
 	snapstate.SetupPostRefreshHook = SetupPostRefreshHook
 	snapstate.SetupRemoveHook = SetupRemoveHook
+	snapstate.SetupCheckHealthHook = SetupCheckHealthHook
 }
 
 func SetupInstallHook(st *state.State, snapName string) *state.Task {
@@ -99,6 +100,35 @@ func SetupRemoveHook(st *state.State, snapName string) *state.Task {
 	return task
 }
 
+func SetupCheckHealthHook(st *state.State, snapName string) *state.Task {
+	hooksup := &HookSetup{
+		Snap:     snapName,
+		Hook:     "check-health",
+		Optional: true,
+	}
+
+	summary := fmt.Sprintf(i18n.G("Run check-health hook of %q snap if present"), hooksup.Snap)
+	return HookTask(st, summary, hooksup, nil)
+}
+
+type checkHealthHandler struct {
+	snapHookHandler
+
+	context *Context
+}
+
+// Error records in the change that the snap failed its health check and
+// is being reverted.
+func (h *checkHealthHandler) Error(err error) error {
+	h.context.Lock()
+	defer h.context.Unlock()
+
+	if task, ok := h.context.Task(); ok && task.Change() != nil {
+		snapstate.SetRefreshHealth(task.Change(), h.context.InstanceName(), snapstate.RefreshReverted)
+	}
+	return nil
+}
+
 func setupHooks(hookMgr *HookManager) {
 	handlerGenerator := func(context *Context) Handler {
 		return &snapHookHandler{}
@@ -108,4 +138,7 @@ func setupHooks(hookMgr *HookManager) {
 	hookMgr.Register(regexp.MustCompile("^post-refresh$"), handlerGenerator)
 	hookMgr.Register(regexp.MustCompile("^pre-refresh$"), handlerGenerator)
 	hookMgr.Register(regexp.MustCompile("^remove$"), handlerGenerator)
+	hookMgr.Register(regexp.MustCompile("^check-health$"), func(context *Context) Handler {
+		return &checkHealthHandler{context: context}
+	})
 }
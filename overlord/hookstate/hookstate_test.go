@@ -405,6 +405,38 @@ func (s *hookManagerSuite) TestHookTaskHandlesHookError(c *C) {
 	c.Check(s.manager.NumRunningHooks(), Equals, 0)
 }
 
+func (s *hookManagerSuite) TestCheckHealthHookErrorRecordsRevert(c *C) {
+	s.setUpSnap(c, "health-snap", `name: health-snap
+version: 1.0
+hooks:
+    check-health:
+`)
+	s.state.Lock()
+	s.task.Set("hook-setup", &hookstate.HookSetup{
+		Snap:     "health-snap",
+		Hook:     "check-health",
+		Revision: snap.R(1),
+		Optional: true,
+	})
+	s.state.Unlock()
+
+	cmd := testutil.MockCommand(c, "snap", ">&2 echo 'not feeling well'; exit 1")
+	defer cmd.Restore()
+
+	s.se.Ensure()
+	s.se.Wait()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	c.Check(s.task.Status(), Equals, state.ErrorStatus)
+	checkTaskLogContains(c, s.task, ".*not feeling well.*")
+
+	var data map[string]map[string]string
+	c.Assert(s.change.Get("api-data", &data), IsNil)
+	c.Check(data["refresh-health"], DeepEquals, map[string]string{"health-snap": "reverted"})
+}
+
 func (s *hookManagerSuite) TestHookTaskHandleIgnoreErrorWorks(c *C) {
 	s.state.Lock()
 	var hooksup hookstate.HookSetup
@@ -0,0 +1,190 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ifacestate
+
+import (
+	"fmt"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/interfaces"
+	"github.com/snapcore/snapd/interfaces/policy"
+	"github.com/snapcore/snapd/overlord/assertstate"
+	"github.com/snapcore/snapd/overlord/devicestate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+)
+
+// PolicyCheck is the traced outcome of one of the policy checks made
+// for a plug and slot.
+type PolicyCheck struct {
+	// Check is one of "installation", "connection" or
+	// "auto-connection".
+	Check string
+	// Snap is the snap whose installation was checked.
+	Snap string
+	// Allowed is whether the policy allows it.
+	Allowed bool
+	// Skipped explains why the check is not made by snapd, if so.
+	Skipped string
+	// Error is why the policy does not allow it.
+	Error string
+	// Trace lists how the declarations were evaluated.
+	Trace []policy.TraceStep
+}
+
+func (pc *PolicyCheck) setOutcome(err error, trace *policy.Trace) {
+	pc.Allowed = err == nil
+	if err != nil {
+		pc.Error = err.Error()
+	}
+	pc.Trace = trace.Steps
+}
+
+// ExplainConnection runs, with tracing, the policy checks for
+// installing the snaps of the given plug and slot and for connecting
+// them, manually and automatically. The snap declarations in decls,
+// by snap-id, are used instead of the ones in the assertion database,
+// so that snaps that are not installed can be explained too.
+func ExplainConnection(st *state.State, plug *snap.PlugInfo, slot *snap.SlotInfo, decls map[string]*asserts.SnapDeclaration) ([]*PolicyCheck, error) {
+	if plug.Interface != slot.Interface {
+		return nil, fmt.Errorf("cannot connect mismatched plug interface %q to slot interface %q", plug.Interface, slot.Interface)
+	}
+
+	baseDecl, err := assertstate.BaseDeclaration(st)
+	if err != nil {
+		return nil, fmt.Errorf("internal error: cannot find base declaration: %v", err)
+	}
+	// a broken local policy is ignored like when installing and
+	// connecting, each trace starts by saying so
+	localPolicy, ignored := localPolicyOrNone(st)
+	newTrace := func() *policy.Trace {
+		trace := &policy.Trace{}
+		if ignored != nil {
+			trace.Steps = append(trace.Steps, policy.TraceStep{
+				Rule:   "local policy",
+				Detail: fmt.Sprintf("%v, only the declarations apply", ignored),
+			})
+		}
+		return trace
+	}
+
+	// explaining is useful even before the device is seeded, the
+	// device scope constraints then do not match
+	modelAs, err := devicestate.Model(st)
+	if err != nil && err != state.ErrNoState {
+		return nil, err
+	}
+	var storeAs *asserts.Store
+	if modelAs != nil && modelAs.Store() != "" {
+		storeAs, err = assertstate.Store(st, modelAs.Store())
+		if err != nil && !asserts.IsNotFound(err) {
+			return nil, err
+		}
+	}
+
+	snapDecl := func(info *snap.Info) (*asserts.SnapDeclaration, error) {
+		if info.SnapID == "" {
+			return nil, nil
+		}
+		if decl := decls[info.SnapID]; decl != nil {
+			return decl, nil
+		}
+		decl, err := assertstate.SnapDeclaration(st, info.SnapID)
+		if err != nil {
+			return nil, fmt.Errorf("cannot find snap declaration for %q: %v", info.InstanceName(), err)
+		}
+		return decl, nil
+	}
+
+	var checks []*PolicyCheck
+
+	snaps := []*snap.Info{plug.Snap}
+	if slot.Snap.InstanceName() != plug.Snap.InstanceName() {
+		snaps = append(snaps, slot.Snap)
+	}
+	for _, info := range snaps {
+		check := &PolicyCheck{Check: "installation", Snap: info.InstanceName()}
+		checks = append(checks, check)
+		if info.SnapID == "" {
+			check.Allowed = true
+			check.Skipped = "snap has no snap-id, its installation is not checked"
+			continue
+		}
+		decl, err := snapDecl(info)
+		if err != nil {
+			check.Error = err.Error()
+			continue
+		}
+		trace := newTrace()
+		ic := policy.InstallCandidate{
+			Snap:            info,
+			SnapDeclaration: decl,
+			BaseDeclaration: baseDecl,
+			Model:           modelAs,
+			Store:           storeAs,
+			LocalPolicy:     localPolicy,
+			Trace:           trace,
+		}
+		check.setOutcome(ic.Check(), trace)
+	}
+
+	connCheck := &PolicyCheck{Check: "connection"}
+	autoCheck := &PolicyCheck{Check: "auto-connection"}
+	checks = append(checks, connCheck, autoCheck)
+
+	plugDecl, plugErr := snapDecl(plug.Snap)
+	slotDecl, slotErr := snapDecl(slot.Snap)
+	for _, err := range []error{plugErr, slotErr} {
+		if err != nil {
+			connCheck.Error = err.Error()
+			autoCheck.Error = err.Error()
+			return checks, nil
+		}
+	}
+
+	newCandidate := func(trace *policy.Trace) *policy.ConnectCandidate {
+		return &policy.ConnectCandidate{
+			Plug:                interfaces.NewConnectedPlug(plug, nil, nil),
+			PlugSnapDeclaration: plugDecl,
+			Slot:                interfaces.NewConnectedSlot(slot, nil, nil),
+			SlotSnapDeclaration: slotDecl,
+			BaseDeclaration:     baseDecl,
+			Model:               modelAs,
+			Store:               storeAs,
+			LocalPolicy:         localPolicy,
+			Trace:               trace,
+		}
+	}
+
+	// like connectChecker, manual connections are not checked for
+	// snaps installed without a declaration
+	if plugDecl == nil || slotDecl == nil {
+		connCheck.Allowed = true
+		connCheck.Skipped = "snaps without snap-id can be connected manually"
+	} else {
+		trace := newTrace()
+		connCheck.setOutcome(newCandidate(trace).Check(), trace)
+	}
+
+	trace := newTrace()
+	autoCheck.setOutcome(newCandidate(trace).CheckAutoConnect(), trace)
+
+	return checks, nil
+}
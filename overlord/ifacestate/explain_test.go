@@ -0,0 +1,200 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ifacestate_test
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/assertstest"
+	"github.com/snapcore/snapd/interfaces/ifacetest"
+	"github.com/snapcore/snapd/interfaces/policy"
+	"github.com/snapcore/snapd/overlord/ifacestate"
+)
+
+var explainBaseDecl = []byte(`
+type: base-declaration
+authority-id: canonical
+series: 16
+slots:
+  test:
+    allow-auto-connection: false
+`)
+
+func (s *interfaceManagerSuite) TestExplainConnection(c *C) {
+	restore := assertstest.MockBuiltinBaseDeclaration(explainBaseDecl)
+	defer restore()
+	s.MockModel(c, nil)
+	s.mockIfaces(c, &ifacetest.TestInterface{InterfaceName: "test"})
+
+	s.MockSnapDecl(c, "producer", "one-publisher", nil)
+	producer := s.mockSnap(c, producerYaml)
+	s.MockSnapDecl(c, "consumer", "one-publisher", map[string]interface{}{
+		"format": "3",
+		"plugs": map[string]interface{}{
+			"test": map[string]interface{}{
+				"allow-auto-connection": map[string]interface{}{
+					"on-store": []interface{}{"my-store"},
+				},
+			},
+		},
+	})
+	consumer := s.mockSnap(c, consumerYaml)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	checks, err := ifacestate.ExplainConnection(s.state, consumer.Plugs["plug"], producer.Slots["slot"], nil)
+	c.Assert(err, IsNil)
+	c.Assert(checks, HasLen, 4)
+
+	c.Check(checks[0].Check, Equals, "installation")
+	c.Check(checks[0].Snap, Equals, "consumer")
+	c.Check(checks[0].Allowed, Equals, true)
+	c.Check(checks[1].Check, Equals, "installation")
+	c.Check(checks[1].Snap, Equals, "producer")
+	c.Check(checks[1].Allowed, Equals, true)
+
+	c.Check(checks[2].Check, Equals, "connection")
+	c.Check(checks[2].Allowed, Equals, true)
+
+	auto := checks[3]
+	c.Check(auto.Check, Equals, "auto-connection")
+	c.Check(auto.Allowed, Equals, false)
+	c.Check(auto.Error, Equals, `auto-connection not allowed by plug rule of interface "test" for "consumer" snap`)
+	c.Assert(auto.Trace, HasLen, 2)
+	c.Check(auto.Trace[1], DeepEquals, policy.TraceStep{
+		Rule:        `snap-declaration plug rule of interface "test" for "consumer" snap`,
+		Constraint:  "allow-auto-connection",
+		Alternative: 1,
+		Detail:      "on-store mismatch",
+	})
+}
+
+func (s *interfaceManagerSuite) TestExplainConnectionBrokenLocalPolicy(c *C) {
+	restore := assertstest.MockBuiltinBaseDeclaration(explainBaseDecl)
+	defer restore()
+	s.MockModel(c, nil)
+	s.mockIfaces(c, &ifacetest.TestInterface{InterfaceName: "test"})
+	s.mockLocalPolicy(c, `rules:
+  - interface: test
+`)
+
+	s.MockSnapDecl(c, "producer", "one-publisher", nil)
+	producer := s.mockSnap(c, producerYaml)
+	s.MockSnapDecl(c, "consumer", "one-publisher", nil)
+	consumer := s.mockSnap(c, consumerYaml)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	// the broken policy is ignored as when connecting, and said so
+	checks, err := ifacestate.ExplainConnection(s.state, consumer.Plugs["plug"], producer.Slots["slot"], nil)
+	c.Assert(err, IsNil)
+	c.Assert(checks, HasLen, 4)
+	for _, check := range checks {
+		c.Assert(check.Trace, Not(HasLen), 0, Commentf(check.Check))
+		c.Check(check.Trace[0].Rule, Equals, "local policy", Commentf(check.Check))
+		c.Check(check.Trace[0].Detail, Equals, "cannot load local interface policy: cannot use local policy: rule #1 must decide on installation or auto-connection, only the declarations apply", Commentf(check.Check))
+	}
+	for _, check := range checks[:3] {
+		c.Check(check.Allowed, Equals, true, Commentf(check.Check))
+	}
+	c.Check(checks[3].Allowed, Equals, false)
+	c.Check(checks[3].Error, Equals, `auto-connection not allowed by slot rule of interface "test"`)
+}
+
+func (s *interfaceManagerSuite) TestExplainConnectionGivenDeclaration(c *C) {
+	restore := assertstest.MockBuiltinBaseDeclaration(explainBaseDecl)
+	defer restore()
+	s.MockModel(c, nil)
+	s.mockIfaces(c, &ifacetest.TestInterface{InterfaceName: "test"})
+
+	s.MockSnapDecl(c, "producer", "one-publisher", nil)
+	producer := s.mockSnap(c, producerYaml)
+	// the consumer is not installed, nor is its declaration known
+	consumer := s.mockSnap(c, consumerYaml)
+	consumer.SnapID = "consumeridididididididididididid"
+
+	a, err := s.storeSigning.Sign(asserts.SnapDeclarationType, map[string]interface{}{
+		"series":       "16",
+		"snap-name":    "consumer",
+		"snap-id":      consumer.SnapID,
+		"publisher-id": "one-publisher",
+		"format":       "1",
+		"plugs": map[string]interface{}{
+			"test": map[string]interface{}{
+				"allow-auto-connection": "true",
+			},
+		},
+		"timestamp": time.Now().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+	decls := map[string]*asserts.SnapDeclaration{
+		consumer.SnapID: a.(*asserts.SnapDeclaration),
+	}
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	checks, err := ifacestate.ExplainConnection(s.state, consumer.Plugs["plug"], producer.Slots["slot"], decls)
+	c.Assert(err, IsNil)
+	c.Assert(checks, HasLen, 4)
+	for _, check := range checks {
+		c.Check(check.Allowed, Equals, true, Commentf(check.Check))
+		c.Check(check.Error, Equals, "", Commentf(check.Check))
+	}
+	c.Check(checks[3].Trace[0].Rule, Equals, `snap-declaration plug rule of interface "test" for "consumer" snap`)
+
+	// without it, the missing declaration is reported
+	checks, err = ifacestate.ExplainConnection(s.state, consumer.Plugs["plug"], producer.Slots["slot"], nil)
+	c.Assert(err, IsNil)
+	c.Check(checks[0].Allowed, Equals, false)
+	c.Check(checks[0].Error, Matches, `cannot find snap declaration for "consumer": .*`)
+	c.Check(checks[3].Allowed, Equals, false)
+}
+
+func (s *interfaceManagerSuite) TestExplainConnectionUnasserted(c *C) {
+	restore := assertstest.MockBuiltinBaseDeclaration(explainBaseDecl)
+	defer restore()
+	s.MockModel(c, nil)
+	s.mockIfaces(c, &ifacetest.TestInterface{InterfaceName: "test"})
+
+	producer := s.mockSnap(c, producerYaml)
+	consumer := s.mockSnap(c, consumerYaml)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	checks, err := ifacestate.ExplainConnection(s.state, consumer.Plugs["plug"], producer.Slots["slot"], nil)
+	c.Assert(err, IsNil)
+	c.Assert(checks, HasLen, 4)
+	for _, check := range checks[:3] {
+		c.Check(check.Allowed, Equals, true, Commentf(check.Check))
+		c.Check(check.Skipped, Not(Equals), "", Commentf(check.Check))
+	}
+	c.Check(checks[3].Allowed, Equals, false)
+	c.Check(checks[3].Error, Equals, `auto-connection not allowed by slot rule of interface "test"`)
+
+	_, err = ifacestate.ExplainConnection(s.state, consumer.Plugs["otherplug"], producer.Slots["slot"], nil)
+	c.Check(err, ErrorMatches, `cannot connect mismatched plug interface "test2" to slot interface "test"`)
+}
@@ -446,12 +446,13 @@ func (m *InterfaceManager) doConnect(task *state.Task, _ *tomb.Tomb) error {
 	}
 
 	var policyChecker interfaces.PolicyFunc
+	var autochecker *autoConnectChecker
 
 	// manual connections and connections by the gadget obey the
 	// policy "connection" rules, other auto-connections obey the
 	// "auto-connection" rules
 	if autoConnect && !byGadget {
-		autochecker, err := newAutoConnectChecker(st)
+		autochecker, err = newAutoConnectChecker(st)
 		if err != nil {
 			return err
 		}
@@ -488,6 +489,7 @@ func (m *InterfaceManager) doConnect(task *state.Task, _ *tomb.Tomb) error {
 		DynamicSlotAttrs: conn.Slot.DynamicAttrs(),
 		Auto:             autoConnect,
 		ByGadget:         byGadget,
+		ByLocalPolicy:    autochecker != nil && autochecker.localPolicy.AllowsAutoConnection(conn.Plug, conn.Slot),
 		HotplugKey:       slot.HotplugKey,
 	}
 	setConns(st, conns)
@@ -292,7 +292,13 @@ var removeStaleConnections = func(st *state.State) error {
 //
 // The return value is the list of affected snap names.
 func (m *InterfaceManager) reloadConnections(snapName string) ([]string, error) {
-	conns, err := getConns(m.state)
+	return reloadRepoConnections(m.state, m.repo, snapName)
+}
+
+// reloadRepoConnections reloads connections stored in the state in the
+// given repository, see reloadConnections.
+func reloadRepoConnections(st *state.State, repo *interfaces.Repository, snapName string) ([]string, error) {
+	conns, err := getConns(st)
 	if err != nil {
 		return nil, err
 	}
@@ -310,7 +316,7 @@ func (m *InterfaceManager) reloadConnections(snapName string) ([]string, error)
 		}
 
 		// Note: reloaded connections are not checked against policy again, and also we don't call BeforeConnect* methods on them.
-		if _, err := m.repo.Connect(connRef, conn.StaticPlugAttrs, conn.DynamicPlugAttrs, conn.StaticSlotAttrs, conn.DynamicSlotAttrs, nil); err != nil {
+		if _, err := repo.Connect(connRef, conn.StaticPlugAttrs, conn.DynamicPlugAttrs, conn.StaticSlotAttrs, conn.DynamicSlotAttrs, nil); err != nil {
 			if _, ok := err.(*interfaces.UnknownPlugSlotError); ok {
 				// Some versions of snapd may have left stray connections that
 				// don't have the corresponding plug or slot anymore. Before we
@@ -443,9 +449,12 @@ func addHotplugSlot(st *state.State, repo *interfaces.Repository, stateSlots map
 }
 
 type connState struct {
-	Auto      bool   `json:"auto,omitempty"`
-	ByGadget  bool   `json:"by-gadget,omitempty"`
-	Interface string `json:"interface,omitempty"`
+	Auto     bool `json:"auto,omitempty"`
+	ByGadget bool `json:"by-gadget,omitempty"`
+	// ByLocalPolicy tracks auto-connections that were allowed by the
+	// device-local interface policy rather than the declarations.
+	ByLocalPolicy bool   `json:"by-local-policy,omitempty"`
+	Interface     string `json:"interface,omitempty"`
 	// Undesired tracks connections that were manually disconnected after being auto-connected,
 	// so that they are not automatically reconnected again in the future.
 	Undesired        bool                   `json:"undesired,omitempty"`
@@ -462,10 +471,36 @@ type connState struct {
 	HotplugKey  string `json:"hotplug-key,omitempty"`
 }
 
+// readLocalPolicy reads the device-local interface policy, if any.
+func readLocalPolicy() (*policy.LocalPolicy, error) {
+	localPolicy, err := policy.ReadLocalPolicy(dirs.SnapLocalPolicyFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load local interface policy: %v", err)
+	}
+	return localPolicy, nil
+}
+
+// localPolicyOrNone reads the device-local interface policy, if any;
+// if it cannot be used none of its rules apply, only the declarations
+// do, and a warning says so. A broken policy thus grants nothing but
+// does not stop snaps from being installed and auto-connected either.
+// The returned error, if any, is why the policy is ignored, for
+// callers that explain the checks.
+func localPolicyOrNone(st *state.State) (*policy.LocalPolicy, error) {
+	localPolicy, err := readLocalPolicy()
+	if err != nil {
+		logger.Noticef("%v, only the declarations apply", err)
+		st.Warnf("%v, only the declarations apply", err)
+		return nil, err
+	}
+	return localPolicy, nil
+}
+
 type autoConnectChecker struct {
-	st       *state.State
-	cache    map[string]*asserts.SnapDeclaration
-	baseDecl *asserts.BaseDeclaration
+	st          *state.State
+	cache       map[string]*asserts.SnapDeclaration
+	baseDecl    *asserts.BaseDeclaration
+	localPolicy *policy.LocalPolicy
 }
 
 func newAutoConnectChecker(s *state.State) (*autoConnectChecker, error) {
@@ -473,10 +508,12 @@ func newAutoConnectChecker(s *state.State) (*autoConnectChecker, error) {
 	if err != nil {
 		return nil, fmt.Errorf("internal error: cannot find base declaration: %v", err)
 	}
+	localPolicy, _ := localPolicyOrNone(s)
 	return &autoConnectChecker{
-		st:       s,
-		cache:    make(map[string]*asserts.SnapDeclaration),
-		baseDecl: baseDecl,
+		st:          s,
+		cache:       make(map[string]*asserts.SnapDeclaration),
+		baseDecl:    baseDecl,
+		localPolicy: localPolicy,
 	}, nil
 }
 
@@ -537,6 +574,7 @@ func (c *autoConnectChecker) check(plug *interfaces.ConnectedPlug, slot *interfa
 		BaseDeclaration:     c.baseDecl,
 		Model:               modelAs,
 		Store:               storeAs,
+		LocalPolicy:         c.localPolicy,
 	}
 
 	return ic.CheckAutoConnect() == nil, nil
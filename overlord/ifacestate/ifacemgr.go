@@ -91,6 +91,11 @@ func Manager(s *state.State, hookManager *hookstate.HookManager, runner *state.T
 	addHandler("setup-profiles", m.doSetupProfiles, m.undoSetupProfiles)
 	addHandler("remove-profiles", m.doRemoveProfiles, m.doSetupProfiles)
 	addHandler("discard-conns", m.doDiscardConns, m.undoDiscardConns)
+	// auto-connect, gadget-connect, auto-disconnect and the hotplug
+	// (dis)connect tasks retry without limit for as long as conflicting
+	// changes, like core or kernel refreshes, run: giving up would undo
+	// installs, and fail removals and seeding outright as not all of
+	// them can be undone
 	addHandler("auto-connect", m.doAutoConnect, m.undoAutoConnect)
 	addHandler("gadget-connect", m.doGadgetConnect, nil)
 	addHandler("auto-disconnect", m.doAutoDisconnect, nil)
@@ -180,6 +185,9 @@ type ConnectionState struct {
 	Auto bool
 	// ByGadget indicates whether the connection was trigged by the gadget
 	ByGadget bool
+	// ByLocalPolicy indicates whether the connection was established
+	// automatically because the local interface policy allowed it
+	ByLocalPolicy bool
 	// Interface name of the connection
 	Interface string
 	// Undesired indicates whether the connection, otherwise established
@@ -206,6 +214,7 @@ func (m *InterfaceManager) ConnectionStates() (connStateByRef map[string]Connect
 		connStateByRef[cref] = ConnectionState{
 			Auto:             cstate.Auto,
 			ByGadget:         cstate.ByGadget,
+			ByLocalPolicy:    cstate.ByLocalPolicy,
 			Interface:        cstate.Interface,
 			Undesired:        cstate.Undesired,
 			StaticPlugAttrs:  cstate.StaticPlugAttrs,
@@ -441,12 +441,14 @@ func CheckInterfaces(st *state.State, snapInfo *snap.Info) error {
 		return fmt.Errorf("cannot find snap declaration for %q: %v", snapInfo.InstanceName(), err)
 	}
 
+	localPolicy, _ := localPolicyOrNone(st)
 	ic := policy.InstallCandidate{
 		Snap:            snapInfo,
 		SnapDeclaration: snapDecl,
 		BaseDeclaration: baseDecl,
 		Model:           modelAs,
 		Store:           storeAs,
+		LocalPolicy:     localPolicy,
 	}
 
 	return ic.Check()
@@ -465,6 +467,9 @@ func delayedCrossMgrInit() {
 		// hook into conflict checks mechanisms
 		snapstate.AddAffectedSnapsByKind("connect", connectDisconnectAffectedSnaps)
 		snapstate.AddAffectedSnapsByKind("disconnect", connectDisconnectAffectedSnaps)
+
+		// hook into rolling back changes
+		snapstate.AddRollbackByKind("connect", rollbackConnect)
 	})
 }
 
@@ -2302,6 +2302,73 @@ slots:
 	check(conns, repo.Interfaces().Connections)
 }
 
+func (s *interfaceManagerSuite) mockLocalPolicy(c *C, content string) {
+	c.Assert(os.MkdirAll(filepath.Dir(dirs.SnapLocalPolicyFile), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(dirs.SnapLocalPolicyFile, []byte(content), 0644), IsNil)
+}
+
+// The auto-connect task will consider the local interface policy before
+// the declarations: here it allows a connection the on-store constraint
+// would fail, and the connection records that.
+func (s *interfaceManagerSuite) TestDoSetupSnapSecurityAutoConnectsLocalPolicyAllow(c *C) {
+	s.MockModel(c, nil)
+	s.mockLocalPolicy(c, `rules:
+  - plug-snap: consumer
+    plug: plug
+    auto-connection: allow
+`)
+
+	s.testDoSetupSnapSecurityAutoConnectsDeclBasedDeviceScope(c, func(conns map[string]interface{}, repoConns []*interfaces.ConnRef) {
+		c.Check(conns, DeepEquals, map[string]interface{}{
+			"consumer:plug producer:slot": map[string]interface{}{"auto": true, "interface": "test",
+				"by-local-policy": true,
+				"plug-static":     map[string]interface{}{"attr1": "value1"},
+				"slot-static":     map[string]interface{}{"attr2": "value2"},
+			}})
+		c.Check(repoConns, HasLen, 1)
+	})
+}
+
+// The auto-connect task will not auto-connect what the local interface
+// policy denies, even if the declarations allow it.
+func (s *interfaceManagerSuite) TestDoSetupSnapSecurityAutoConnectsLocalPolicyDeny(c *C) {
+	s.MockModel(c, map[string]interface{}{
+		"store": "my-store",
+	})
+	s.mockLocalPolicy(c, `rules:
+  - interface: test
+    slot-snap: producer
+    auto-connection: deny
+`)
+
+	s.testDoSetupSnapSecurityAutoConnectsDeclBasedDeviceScope(c, func(conns map[string]interface{}, repoConns []*interfaces.ConnRef) {
+		c.Check(conns, HasLen, 0)
+		c.Check(repoConns, HasLen, 0)
+	})
+}
+
+// The auto-connect task ignores a broken local interface policy, so
+// that it grants nothing, and warns about it.
+func (s *interfaceManagerSuite) TestDoSetupSnapSecurityAutoConnectsLocalPolicyBroken(c *C) {
+	s.MockModel(c, nil)
+	s.mockLocalPolicy(c, `rules:
+  - plug-snap: consumer
+    plug: plug
+    auto-connection: allow
+  - interface: test
+`)
+
+	s.testDoSetupSnapSecurityAutoConnectsDeclBasedDeviceScope(c, func(conns map[string]interface{}, repoConns []*interfaces.ConnRef) {
+		// the declarations still apply and deny the connection
+		c.Check(conns, HasLen, 0)
+		c.Check(repoConns, HasLen, 0)
+
+		warns := s.state.AllWarnings()
+		c.Assert(warns, HasLen, 1)
+		c.Check(warns[0].String(), Matches, `cannot load local interface policy: cannot use local policy: rule #2 must decide on installation or auto-connection, only the declarations apply`)
+	})
+}
+
 // The setup-profiles task will only touch connection state for the task it
 // operates on or auto-connects to and will leave other state intact.
 func (s *interfaceManagerSuite) TestDoSetupSnapSecurityKeepsExistingConnectionState(c *C) {
@@ -3319,6 +3386,41 @@ slots:
 	c.Check(ifacestate.CheckInterfaces(s.state, snapInfo), IsNil)
 }
 
+func (s *interfaceManagerSuite) TestCheckInterfacesLocalPolicy(c *C) {
+	s.MockModel(c, nil)
+
+	restore := assertstest.MockBuiltinBaseDeclaration([]byte(`
+type: base-declaration
+authority-id: canonical
+series: 16
+slots:
+  test:
+    deny-installation: true
+plugs:
+  test2:
+    allow-installation: true
+`))
+	defer restore()
+	s.mockIfaces(c, &ifacetest.TestInterface{InterfaceName: "test"}, &ifacetest.TestInterface{InterfaceName: "test2"})
+	s.mockLocalPolicy(c, `rules:
+  - interface: test
+    slot-snap: producer
+    installation: allow
+  - interface: test2
+    installation: deny
+`)
+
+	s.MockSnapDecl(c, "producer", "producer-publisher", nil)
+	producer := s.mockSnap(c, producerYaml)
+	s.MockSnapDecl(c, "consumer", "producer-publisher", nil)
+	consumer := s.mockSnap(c, consumerYaml)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	c.Check(ifacestate.CheckInterfaces(s.state, producer), IsNil)
+	c.Check(ifacestate.CheckInterfaces(s.state, consumer), ErrorMatches, `installation denied by local policy rule #2 for "otherplug" plug of interface "test2"`)
+}
+
 func (s *interfaceManagerSuite) TestCheckInterfacesDeviceScopeRightStore(c *C) {
 	s.MockModel(c, map[string]interface{}{
 		"store": "my-store",
@@ -4670,6 +4772,46 @@ func (s *interfaceManagerSuite) TestGadgetConnectConflictRetry(c *C) {
 	c.Check(t.Log()[0], Matches, `.*gadget connect will be retried: conflicting snap producer with task "link-snap"`)
 }
 
+func (s *interfaceManagerSuite) TestGadgetConnectConflictRetriesForever(c *C) {
+	r1 := release.MockOnClassic(false)
+	defer r1()
+	restore := ifacestate.MockConnectRetryTimeout(0)
+	defer restore()
+
+	s.setupGadgetConnect(c)
+	s.manager(c)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	otherChg := s.state.NewChange("other-chg", "...")
+	t := s.state.NewTask("link-snap", "...")
+	t.Set("snap-setup", &snapstate.SnapSetup{
+		SideInfo: &snap.SideInfo{
+			RealName: "producer"},
+	})
+	otherChg.AddTask(t)
+
+	chg := s.state.NewChange("setting-up", "...")
+	t = s.state.NewTask("gadget-connect", "gadget connections")
+	chg.AddTask(t)
+
+	// way more than an hour of retries, as long as a core or kernel
+	// refresh could take
+	for i := 0; i < 1000; i++ {
+		s.state.Unlock()
+		s.se.Ensure()
+		s.se.Wait()
+		s.state.Lock()
+	}
+
+	// gadget-connect cannot be undone, it keeps waiting instead of
+	// failing the seeding
+	c.Check(chg.Err(), IsNil)
+	c.Check(t.Status(), Equals, state.DoingStatus)
+	c.Check(t.DoingRetries(), Equals, 1000)
+}
+
 func (s *interfaceManagerSuite) TestGadgetConnectSkipUnknown(c *C) {
 	r1 := release.MockOnClassic(false)
 	defer r1()
@@ -0,0 +1,127 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ifacestate
+
+import (
+	"fmt"
+
+	"github.com/snapcore/snapd/interfaces"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+)
+
+// ProfilesChange describes a prospective change whose effect on the
+// security profiles of a snap is to be rendered.
+type ProfilesChange struct {
+	// Refresh is the snap the snap would be refreshed to.
+	Refresh *snap.Info
+	// Disconnect are connections that would be removed.
+	Disconnect []*interfaces.ConnRef
+	// Connect is a connection that would be made.
+	Connect *interfaces.ConnRef
+}
+
+// SecurityProfiles holds the content of rendered security profiles by
+// backend and path.
+type SecurityProfiles map[interfaces.SecuritySystem]map[string][]byte
+
+// renderSecurityProfiles renders the security profiles of a snap with all
+// the backends of the given repository.
+func renderSecurityProfiles(repo *interfaces.Repository, snapInfo *snap.Info, opts interfaces.ConfinementOptions) (SecurityProfiles, error) {
+	profiles := make(SecurityProfiles)
+	for _, backend := range repo.Backends() {
+		files, err := backend.Render(snapInfo, opts, repo)
+		if err != nil {
+			return nil, fmt.Errorf("cannot render %s profiles for snap %q: %v", backend.Name(), snapInfo.InstanceName(), err)
+		}
+		profiles[backend.Name()] = files
+	}
+	return profiles, nil
+}
+
+// allowAnyConnection is the policy used to render the profiles of a
+// prospective connection, whose policy is not of concern here, see
+// ExplainConnection for that.
+func allowAnyConnection(*interfaces.ConnectedPlug, *interfaces.ConnectedSlot) (bool, error) {
+	return true, nil
+}
+
+// RenderSecurityProfiles renders the security profiles of the given snap
+// with every security backend, without writing or loading them. If change
+// is not nil the profiles are also rendered as they would be after the
+// change, which is only ever applied to a copy of the repository.
+//
+// The state must be locked by the caller.
+func (m *InterfaceManager) RenderSecurityProfiles(instanceName string, change *ProfilesChange) (current, changed SecurityProfiles, err error) {
+	var snapst snapstate.SnapState
+	err = snapstate.Get(m.state, instanceName, &snapst)
+	if err == state.ErrNoState {
+		return nil, nil, &snap.NotInstalledError{Snap: instanceName}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	snapInfo, err := snapst.CurrentInfo()
+	if err != nil {
+		return nil, nil, err
+	}
+	opts := confinementOptions(snapst.Flags)
+	current, err = renderSecurityProfiles(m.repo, snapInfo, opts)
+	if err != nil || change == nil {
+		return current, nil, err
+	}
+
+	repo := m.repo.Copy()
+	if change.Refresh != nil {
+		// this mirrors what setupProfilesForSnap does on refresh
+		snapInfo = change.Refresh
+		if err := addImplicitSlots(m.state, snapInfo); err != nil {
+			return nil, nil, err
+		}
+		if _, err := repo.DisconnectSnap(instanceName); err != nil {
+			return nil, nil, err
+		}
+		if err := repo.RemoveSnap(instanceName); err != nil {
+			return nil, nil, err
+		}
+		if err := repo.AddSnap(snapInfo); err != nil {
+			return nil, nil, err
+		}
+		if _, err := reloadRepoConnections(m.state, repo, instanceName); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, ref := range change.Disconnect {
+		if err := repo.Disconnect(ref.PlugRef.Snap, ref.PlugRef.Name, ref.SlotRef.Snap, ref.SlotRef.Name); err != nil {
+			return nil, nil, err
+		}
+	}
+	if ref := change.Connect; ref != nil {
+		if _, err := repo.Connect(ref, nil, nil, nil, nil, allowAnyConnection); err != nil {
+			return nil, nil, err
+		}
+	}
+	changed, err = renderSecurityProfiles(repo, snapInfo, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return current, changed, nil
+}
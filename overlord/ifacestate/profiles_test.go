@@ -0,0 +1,160 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ifacestate_test
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/interfaces"
+	"github.com/snapcore/snapd/interfaces/ifacetest"
+	"github.com/snapcore/snapd/overlord/ifacestate"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snaptest"
+)
+
+// mockRenderConnections makes the test backend render a profile that
+// lists the connections of the snap.
+func (s *interfaceManagerSuite) mockRenderConnections() {
+	s.secBackend.BackendName = "test-backend"
+	s.secBackend.RenderCallback = func(snapInfo *snap.Info, opts interfaces.ConfinementOptions, repo *interfaces.Repository) (map[string][]byte, error) {
+		conns, err := repo.Connections(snapInfo.InstanceName())
+		if err != nil {
+			return nil, err
+		}
+		var lines []string
+		for _, conn := range conns {
+			lines = append(lines, conn.ID())
+		}
+		sort.Strings(lines)
+		name := fmt.Sprintf("/profiles/%s.%s", snapInfo.InstanceName(), snapInfo.Revision)
+		return map[string][]byte{name: []byte(strings.Join(lines, "\n"))}, nil
+	}
+}
+
+func (s *interfaceManagerSuite) TestRenderSecurityProfilesConnect(c *C) {
+	s.mockIfaces(c, &ifacetest.TestInterface{InterfaceName: "test"}, &ifacetest.TestInterface{InterfaceName: "test2"})
+	s.mockSnap(c, consumerYaml)
+	s.mockSnap(c, producerYaml)
+	s.mockRenderConnections()
+	mgr := s.manager(c)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	current, changed, err := mgr.RenderSecurityProfiles("consumer", nil)
+	c.Assert(err, IsNil)
+	c.Check(current, DeepEquals, ifacestate.SecurityProfiles{
+		"test-backend": {"/profiles/consumer.1": []byte("")},
+	})
+	c.Check(changed, IsNil)
+
+	ref := &interfaces.ConnRef{
+		PlugRef: interfaces.PlugRef{Snap: "consumer", Name: "plug"},
+		SlotRef: interfaces.SlotRef{Snap: "producer", Name: "slot"},
+	}
+	current, changed, err = mgr.RenderSecurityProfiles("consumer", &ifacestate.ProfilesChange{Connect: ref})
+	c.Assert(err, IsNil)
+	c.Check(current, DeepEquals, ifacestate.SecurityProfiles{
+		"test-backend": {"/profiles/consumer.1": []byte("")},
+	})
+	c.Check(changed, DeepEquals, ifacestate.SecurityProfiles{
+		"test-backend": {"/profiles/consumer.1": []byte("consumer:plug producer:slot")},
+	})
+
+	// the repository itself was left alone
+	conns, err := mgr.Repository().Connections("consumer")
+	c.Assert(err, IsNil)
+	c.Check(conns, HasLen, 0)
+	c.Check(s.secBackend.SetupCalls, HasLen, 0)
+}
+
+func (s *interfaceManagerSuite) TestRenderSecurityProfilesConnectError(c *C) {
+	s.mockIfaces(c, &ifacetest.TestInterface{InterfaceName: "test"}, &ifacetest.TestInterface{InterfaceName: "test2"})
+	s.mockSnap(c, consumerYaml)
+	s.mockSnap(c, producerYaml)
+	s.mockRenderConnections()
+	mgr := s.manager(c)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	ref := &interfaces.ConnRef{
+		PlugRef: interfaces.PlugRef{Snap: "consumer", Name: "otherplug"},
+		SlotRef: interfaces.SlotRef{Snap: "producer", Name: "slot"},
+	}
+	_, _, err := mgr.RenderSecurityProfiles("consumer", &ifacestate.ProfilesChange{Connect: ref})
+	c.Check(err, ErrorMatches, `cannot connect plug "consumer:otherplug" \(interface "test2"\) to "producer:slot" \(interface "test"\)`)
+
+	_, _, err = mgr.RenderSecurityProfiles("unknown", nil)
+	c.Check(err, ErrorMatches, `snap "unknown" is not installed`)
+}
+
+func (s *interfaceManagerSuite) TestRenderSecurityProfilesDisconnectAndRefresh(c *C) {
+	s.mockIfaces(c, &ifacetest.TestInterface{InterfaceName: "test"}, &ifacetest.TestInterface{InterfaceName: "test2"})
+	s.mockSnap(c, consumerYaml)
+	s.mockSnap(c, producerYaml)
+	s.mockRenderConnections()
+
+	s.state.Lock()
+	s.state.Set("conns", map[string]interface{}{
+		"consumer:plug producer:slot": map[string]interface{}{"interface": "test"},
+	})
+	s.state.Unlock()
+	mgr := s.manager(c)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	ref := &interfaces.ConnRef{
+		PlugRef: interfaces.PlugRef{Snap: "consumer", Name: "plug"},
+		SlotRef: interfaces.SlotRef{Snap: "producer", Name: "slot"},
+	}
+	current, changed, err := mgr.RenderSecurityProfiles("consumer", &ifacestate.ProfilesChange{Disconnect: []*interfaces.ConnRef{ref}})
+	c.Assert(err, IsNil)
+	c.Check(current, DeepEquals, ifacestate.SecurityProfiles{
+		"test-backend": {"/profiles/consumer.1": []byte("consumer:plug producer:slot")},
+	})
+	c.Check(changed, DeepEquals, ifacestate.SecurityProfiles{
+		"test-backend": {"/profiles/consumer.1": []byte("")},
+	})
+
+	// a refresh keeps the connections of the plugs that are still there
+	info := snaptest.MockInfo(c, consumerYaml, &snap.SideInfo{Revision: snap.R(2)})
+	current, changed, err = mgr.RenderSecurityProfiles("consumer", &ifacestate.ProfilesChange{Refresh: info})
+	c.Assert(err, IsNil)
+	c.Check(changed, DeepEquals, ifacestate.SecurityProfiles{
+		"test-backend": {"/profiles/consumer.2": []byte("consumer:plug producer:slot")},
+	})
+	info = snaptest.MockInfo(c, "name: consumer\nversion: 2\n", &snap.SideInfo{Revision: snap.R(3)})
+	current, changed, err = mgr.RenderSecurityProfiles("consumer", &ifacestate.ProfilesChange{Refresh: info})
+	c.Assert(err, IsNil)
+	c.Check(changed, DeepEquals, ifacestate.SecurityProfiles{
+		"test-backend": {"/profiles/consumer.3": []byte("")},
+	})
+
+	conns, err := mgr.Repository().Connections("consumer")
+	c.Assert(err, IsNil)
+	c.Check(conns, HasLen, 1)
+	c.Check(mgr.Repository().Plug("consumer", "plug"), NotNil)
+}
@@ -0,0 +1,62 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ifacestate
+
+import (
+	"fmt"
+
+	"github.com/snapcore/snapd/interfaces"
+	"github.com/snapcore/snapd/overlord/ifacestate/ifacerepo"
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+// rollbackConnect disconnects what the done connect task connected by
+// hand, when rolling back its change.
+func rollbackConnect(t *state.Task, removed map[string]bool) (*state.TaskSet, []string, error) {
+	var autoConnect bool
+	if err := t.Get("auto", &autoConnect); err != nil && err != state.ErrNoState {
+		return nil, nil, err
+	}
+	if autoConnect {
+		// follows from the snaps involved
+		return nil, nil, nil
+	}
+	var connRef interfaces.ConnRef
+	if err := t.Get("plug", &connRef.PlugRef); err != nil {
+		return nil, nil, err
+	}
+	if err := t.Get("slot", &connRef.SlotRef); err != nil {
+		return nil, nil, err
+	}
+	if removed[connRef.PlugRef.Snap] || removed[connRef.SlotRef.Snap] {
+		return nil, nil, nil
+	}
+
+	st := t.State()
+	conn, err := ifacerepo.Get(st).Connection(&connRef)
+	if err != nil {
+		return nil, nil, fmt.Errorf("connection %s is gone", connRef.ID())
+	}
+	ts, err := Disconnect(st, conn)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ts, []string{connRef.PlugRef.Snap, connRef.SlotRef.Snap}, nil
+}
@@ -0,0 +1,112 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ifacestate_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/interfaces"
+	"github.com/snapcore/snapd/interfaces/ifacetest"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+)
+
+func (s *interfaceManagerSuite) TestRollbackConnect(c *C) {
+	s.mockIfaces(c, &ifacetest.TestInterface{InterfaceName: "test"})
+	s.mockSnap(c, consumerYaml)
+	s.mockSnap(c, producerYaml)
+	mgr := s.manager(c)
+
+	repo := mgr.Repository()
+	connRef := &interfaces.ConnRef{
+		PlugRef: interfaces.PlugRef{Snap: "consumer", Name: "plug"},
+		SlotRef: interfaces.SlotRef{Snap: "producer", Name: "slot"},
+	}
+	_, err := repo.Connect(connRef, nil, nil, nil, nil, nil)
+	c.Assert(err, IsNil)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	chg := s.state.NewChange("connect-snap", "Connect consumer:plug to producer:slot")
+	t := s.state.NewTask("connect", "...")
+	t.Set("plug", connRef.PlugRef)
+	t.Set("slot", connRef.SlotRef)
+	t.SetStatus(state.DoneStatus)
+	chg.AddTask(t)
+	// auto-connections follow from the snaps involved
+	t = s.state.NewTask("connect", "...")
+	t.Set("plug", connRef.PlugRef)
+	t.Set("slot", connRef.SlotRef)
+	t.Set("auto", true)
+	t.SetStatus(state.DoneStatus)
+	chg.AddTask(t)
+
+	tss, affected, err := snapstate.Rollback(s.state, chg)
+	c.Assert(err, IsNil)
+	c.Check(affected, DeepEquals, []string{"consumer", "producer"})
+	c.Assert(tss, HasLen, 1)
+	var disconnect *state.Task
+	for _, t := range tss[0].Tasks() {
+		if t.Kind() == "disconnect" {
+			disconnect = t
+		}
+	}
+	c.Assert(disconnect, NotNil)
+	var plug interfaces.PlugRef
+	c.Assert(disconnect.Get("plug", &plug), IsNil)
+	c.Check(plug, Equals, connRef.PlugRef)
+
+	// once disconnected there is nothing to roll back to
+	repo.Disconnect("consumer", "plug", "producer", "slot")
+	_, _, err = snapstate.Rollback(s.state, chg)
+	c.Check(err, ErrorMatches, `connection consumer:plug producer:slot is gone`)
+}
+
+func (s *interfaceManagerSuite) TestRollbackConnectOfRemovedSnap(c *C) {
+	s.mockIfaces(c, &ifacetest.TestInterface{InterfaceName: "test"})
+	s.mockSnap(c, producerYaml)
+	consumer := s.mockSnap(c, consumerYaml)
+	s.manager(c)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	// the consumer was installed and connected by the change, it is
+	// removed as a whole
+	chg := s.state.NewChange("install-snap", "...")
+	t := s.state.NewTask("link-snap", "...")
+	t.Set("snap-setup", &snapstate.SnapSetup{
+		SideInfo: &snap.SideInfo{RealName: "consumer", Revision: consumer.Revision},
+	})
+	t.SetStatus(state.DoneStatus)
+	chg.AddTask(t)
+	t = s.state.NewTask("connect", "...")
+	t.Set("plug", interfaces.PlugRef{Snap: "consumer", Name: "plug"})
+	t.Set("slot", interfaces.SlotRef{Snap: "producer", Name: "slot"})
+	t.SetStatus(state.DoneStatus)
+	chg.AddTask(t)
+
+	tss, affected, err := snapstate.Rollback(s.state, chg)
+	c.Assert(err, IsNil)
+	c.Check(affected, DeepEquals, []string{"consumer"})
+	c.Assert(tss, HasLen, 1)
+}
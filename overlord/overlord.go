@@ -30,14 +30,18 @@ import (
 	"gopkg.in/tomb.v2"
 
 	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/features"
 	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/metrics"
 	"github.com/snapcore/snapd/osutil"
 
 	"github.com/snapcore/snapd/overlord/assertstate"
 	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/changejournal"
 	"github.com/snapcore/snapd/overlord/cmdstate"
 	"github.com/snapcore/snapd/overlord/configstate"
 	"github.com/snapcore/snapd/overlord/configstate/proxyconf"
+	"github.com/snapcore/snapd/overlord/denialstate"
 	"github.com/snapcore/snapd/overlord/devicestate"
 	"github.com/snapcore/snapd/overlord/hookstate"
 	"github.com/snapcore/snapd/overlord/ifacestate"
@@ -74,6 +78,9 @@ type Overlord struct {
 	numEnsure   uint64
 	// restarts
 	restartHandler func(t state.RestartType)
+	// stateJournal is the journal the state is checkpointed into, if
+	// it is in use
+	stateJournal *state.Journal
 	// managers
 	inited    bool
 	runner    *state.TaskRunner
@@ -88,6 +95,18 @@ type Overlord struct {
 
 var storeNew = store.New
 
+var changesReady = metrics.NewCounter("snapd_changes_total", "Changes that became ready, by kind and final status.", "kind", "status")
+
+func init() {
+	metrics.Register(checkpointDuration, changesReady)
+}
+
+// countReadyChange is a change ready handler keeping count of the
+// changes that became ready.
+func countReadyChange(chg *state.Change) {
+	changesReady.Inc(chg.Kind(), chg.Status().String())
+}
+
 // New creates a new Overlord with all its state managers.
 func New() (*Overlord, error) {
 	o := &Overlord{
@@ -100,7 +119,17 @@ func New() (*Overlord, error) {
 		ensureBefore:   o.ensureBefore,
 		requestRestart: o.requestRestart,
 	}
-	s, err := loadState(backend)
+	var s *state.State
+	var err error
+	if features.StateJournal.IsEnabled() {
+		o.stateJournal = state.NewJournal(dirs.SnapStateFile, dirs.SnapStateJournalFile)
+		s, err = loadJournaledState(&journaledStateBackend{
+			overlordStateBackend: backend,
+			journal:              o.stateJournal,
+		})
+	} else {
+		s, err = loadState(backend)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -114,6 +143,12 @@ func New() (*Overlord, error) {
 	}
 	o.runner.AddOptionalHandler(matchAnyUnknownTask, handleUnknownTask, nil)
 
+	// keep a record of ready changes that outlives their pruning
+	s.Lock()
+	s.AddChangeReadyHandler(changejournal.Record)
+	s.AddChangeReadyHandler(countReadyChange)
+	s.Unlock()
+
 	hookMgr, err := hookstate.Manager(s, o.runner)
 	if err != nil {
 		return nil, err
@@ -146,6 +181,7 @@ func New() (*Overlord, error) {
 
 	o.addManager(cmdstate.Manager(s, o.runner))
 	o.addManager(snapshotstate.Manager(s, o.runner))
+	o.addManager(denialstate.Manager(s))
 
 	configstateInit(hookMgr)
 
@@ -191,7 +227,19 @@ func (o *Overlord) addManager(mgr StateManager) {
 	o.stateEng.AddManager(mgr)
 }
 
-func loadState(backend state.Backend) (*state.State, error) {
+func loadState(backend *overlordStateBackend) (*state.State, error) {
+	if osutil.FileExists(dirs.SnapStateJournalFile) {
+		// the journal was used before, but no longer is: fold it
+		// into the state file
+		journal := state.NewJournal(dirs.SnapStateFile, dirs.SnapStateJournalFile)
+		if _, err := journal.ReadState(nil); err != nil {
+			return nil, err
+		}
+		if err := journal.Compact(); err != nil {
+			return nil, fmt.Errorf("cannot compact the state journal: %v", err)
+		}
+	}
+
 	if !osutil.FileExists(dirs.SnapStateFile) {
 		// fail fast, mostly interesting for tests, this dir is setup
 		// by the snapd package
@@ -223,6 +271,28 @@ func loadState(backend state.Backend) (*state.State, error) {
 	return s, nil
 }
 
+func loadJournaledState(backend *journaledStateBackend) (*state.State, error) {
+	stateDir := filepath.Dir(dirs.SnapStateFile)
+	if !osutil.IsDirectory(stateDir) {
+		return nil, fmt.Errorf("fatal: directory %q must be present", stateDir)
+	}
+	fresh := !osutil.FileExists(dirs.SnapStateFile) && !osutil.FileExists(dirs.SnapStateJournalFile)
+
+	s, err := backend.journal.ReadState(backend)
+	if err != nil {
+		return nil, err
+	}
+
+	if fresh {
+		patch.Init(s)
+		return s, nil
+	}
+	if err := patch.Apply(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
 func (o *Overlord) ensureTimerSetup() {
 	o.ensureLock.Lock()
 	defer o.ensureLock.Unlock()
@@ -266,6 +336,8 @@ func (o *Overlord) ensureBefore(d time.Duration) {
 }
 
 func (o *Overlord) requestRestart(t state.RestartType) {
+	// whatever snapd comes up next must find the state file current
+	o.closeStateJournal()
 	if o.restartHandler == nil {
 		logger.Noticef("restart requested but no handler set")
 	} else {
@@ -312,9 +384,24 @@ func (o *Overlord) Stop() error {
 	o.loopTomb.Kill(nil)
 	err := o.loopTomb.Wait()
 	o.stateEng.Stop()
+	o.closeStateJournal()
+	// write out what's left of the changes that became ready
+	changejournal.Flush()
 	return err
 }
 
+// closeStateJournal folds the state journal, if in use, into the state
+// file, which is then kept current: the next snapd to read the state
+// might not use the journal, or not know about it at all.
+func (o *Overlord) closeStateJournal() {
+	if o.stateJournal == nil {
+		return
+	}
+	if err := o.stateJournal.Close(); err != nil {
+		logger.Noticef("Cannot compact the state journal: %v", err)
+	}
+}
+
 func (o *Overlord) settle(timeout time.Duration, beforeCleanups func()) error {
 	func() {
 		o.ensureLock.Lock()
@@ -33,6 +33,8 @@ import (
 	"gopkg.in/tomb.v2"
 
 	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/features"
+	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/overlord"
 	"github.com/snapcore/snapd/overlord/auth"
 	"github.com/snapcore/snapd/overlord/hookstate"
@@ -566,10 +568,12 @@ func (ovs *overlordSuite) TestCheckpoint(c *C) {
 	o, err := overlord.New()
 	c.Assert(err, IsNil)
 
+	checkpoints := overlord.CheckpointDuration.Count()
 	s := o.State()
 	s.Lock()
 	s.Set("mark", 1)
 	s.Unlock()
+	c.Check(overlord.CheckpointDuration.Count(), Equals, checkpoints+1)
 
 	st, err := os.Stat(dirs.SnapStateFile)
 	c.Assert(err, IsNil)
@@ -578,6 +582,98 @@ func (ovs *overlordSuite) TestCheckpoint(c *C) {
 	c.Check(dirs.SnapStateFile, testutil.FileContains, `"mark":1`)
 }
 
+func (ovs *overlordSuite) TestChangesReadyCounted(c *C) {
+	o, err := overlord.New()
+	c.Assert(err, IsNil)
+
+	done := overlord.ChangesReady.Value("foo", "Done")
+	errored := overlord.ChangesReady.Value("foo", "Error")
+
+	s := o.State()
+	s.Lock()
+	defer s.Unlock()
+	for _, status := range []state.Status{state.DoneStatus, state.ErrorStatus} {
+		chg := s.NewChange("foo", "...")
+		t := s.NewTask("bar", "...")
+		chg.AddTask(t)
+		t.SetStatus(status)
+		// only counted once
+		t.SetStatus(status)
+	}
+
+	c.Check(overlord.ChangesReady.Value("foo", "Done"), Equals, done+1)
+	c.Check(overlord.ChangesReady.Value("foo", "Error"), Equals, errored+1)
+}
+
+func (ovs *overlordSuite) TestCheckpointJournal(c *C) {
+	dirs.SnapStateJournalFile = filepath.Join(filepath.Dir(dirs.SnapStateFile), "test.journal")
+	c.Assert(os.MkdirAll(dirs.FeaturesDir, 0755), IsNil)
+	c.Assert(ioutil.WriteFile(features.StateJournal.ControlFile(), nil, 0644), IsNil)
+
+	o, err := overlord.New()
+	c.Assert(err, IsNil)
+
+	s := o.State()
+	s.Lock()
+	s.Set("mark", 1)
+	s.Unlock()
+
+	// the state file was written on first use, the change went to
+	// the journal
+	c.Check(dirs.SnapStateFile, testutil.FileContains, `"patch-level"`)
+	c.Check(dirs.SnapStateFile, Not(testutil.FileContains), `"mark"`)
+	c.Check(dirs.SnapStateJournalFile, testutil.FileContains, `"data/mark":1`)
+
+	// which is read back
+	o, err = overlord.New()
+	c.Assert(err, IsNil)
+	s = o.State()
+	s.Lock()
+	var mark int
+	c.Check(s.Get("mark", &mark), IsNil)
+	s.Unlock()
+	c.Check(mark, Equals, 1)
+
+	// and folded into the state file when stopping
+	s.Lock()
+	s.Set("mark", 2)
+	s.Unlock()
+	c.Check(dirs.SnapStateFile, Not(testutil.FileContains), `"mark":2`)
+	o.Loop()
+	c.Assert(o.Stop(), IsNil)
+	c.Check(dirs.SnapStateFile, testutil.FileContains, `"mark":2`)
+	c.Check(osutil.FileExists(dirs.SnapStateJournalFile), Equals, false)
+
+	// or when a restart is requested, after which the state file is
+	// kept current; the control file is written anew as the ensure
+	// loop synced the features with the (empty) configuration
+	c.Assert(ioutil.WriteFile(features.StateJournal.ControlFile(), nil, 0644), IsNil)
+	o, err = overlord.New()
+	c.Assert(err, IsNil)
+	s = o.State()
+	s.Lock()
+	s.Set("mark", 3)
+	s.Unlock()
+	c.Check(dirs.SnapStateFile, Not(testutil.FileContains), `"mark":3`)
+	s.Lock()
+	s.RequestRestart(state.RestartDaemon)
+	c.Check(dirs.SnapStateFile, testutil.FileContains, `"mark":3`)
+	s.Set("mark", 4)
+	s.Unlock()
+	c.Check(dirs.SnapStateFile, testutil.FileContains, `"mark":4`)
+	c.Check(osutil.FileExists(dirs.SnapStateJournalFile), Equals, false)
+
+	// and folded into the state file when no longer used
+	s.Lock()
+	s.Set("mark", 1)
+	s.Unlock()
+	c.Assert(os.Remove(features.StateJournal.ControlFile()), IsNil)
+	_, err = overlord.New()
+	c.Assert(err, IsNil)
+	c.Check(dirs.SnapStateFile, testutil.FileContains, `"mark":1`)
+	c.Check(osutil.FileExists(dirs.SnapStateJournalFile), Equals, false)
+}
+
 type sampleManager struct {
 	ensureCallback func()
 }
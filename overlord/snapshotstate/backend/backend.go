@@ -21,15 +21,20 @@ package backend
 
 import (
 	"archive/zip"
+	"bytes"
+	"compress/gzip"
 	"context"
 	"crypto"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/snapcore/snapd/client"
@@ -41,14 +46,55 @@ import (
 )
 
 const (
-	archiveName  = "archive.tgz"
-	metadataName = "meta.json"
-	metaHashName = "meta.sha3_384"
+	archiveBaseName = "archive"
+	metadataName    = "meta.json"
+	metaHashName    = "meta.sha3_384"
+	configName      = "config.json"
 
 	userArchivePrefix = "user/"
-	userArchiveSuffix = ".tgz"
+	incrementalSuffix = ".snar"
 )
 
+// Compression methods supported for the archives in a snapshot.
+//
+// CompressionGzipFast is the faster option: it writes gzip archives
+// like CompressionGzip, at the fastest compression level, trading size
+// for speed. Formats like zstd, which compress faster at a ratio
+// closer to gzip's, are not offered as the Go standard library has no
+// implementation of them, and snapd compresses and decompresses
+// archives itself rather than through external tools.
+const (
+	CompressionNone     = "none"
+	CompressionGzip     = "gzip"
+	CompressionGzipFast = "gzip-fast"
+
+	// DefaultCompression is used when no compression is requested.
+	DefaultCompression = CompressionGzip
+)
+
+var compressionSuffixes = map[string]string{
+	CompressionNone:     ".tar",
+	CompressionGzip:     ".tgz",
+	CompressionGzipFast: ".tgz",
+}
+
+var gzipLevels = map[string]int{
+	CompressionGzip:     gzip.DefaultCompression,
+	CompressionGzipFast: gzip.BestSpeed,
+}
+
+// ValidateCompression checks that the given compression method is
+// supported; the empty string means DefaultCompression.
+func ValidateCompression(compression string) error {
+	if compression == "" {
+		return nil
+	}
+	if _, ok := compressionSuffixes[compression]; !ok {
+		return fmt.Errorf("unsupported snapshot compression %q (supported: %s, %s, %s)", compression, CompressionNone, CompressionGzip, CompressionGzipFast)
+	}
+	return nil
+}
+
 var (
 	// Stop is used to ask Iter to stop iteration, without it being an error.
 	Stop = errors.New("stop iteration")
@@ -61,6 +107,16 @@ var (
 // Flags encompasses extra flags for snapshots backend Save.
 type Flags struct {
 	Auto bool
+	// Compression is the compression method to use for the archives;
+	// empty means DefaultCompression.
+	Compression string
+	// BaseSetID, if non-zero, is the snapshot set the new snapshot
+	// should be incremental on. If the set has no snapshot of the
+	// snap, a full snapshot is taken instead.
+	BaseSetID uint64
+	// EncryptionKey, if set, is the key to encrypt the snapshot's
+	// data (and configuration) with. See ParseKey.
+	EncryptionKey []byte
 }
 
 // Iter loops over all snapshots in the snapshots directory, applying the given
@@ -91,6 +147,10 @@ func Iter(ctx context.Context, f func(*Reader) error) error {
 			if err = ctx.Err(); err != nil {
 				break
 			}
+			if strings.HasPrefix(name, ".") {
+				// in-progress imports, see Import
+				continue
+			}
 
 			filename := filepath.Join(dirs.SnapshotsDir, name)
 			reader, openError := backendOpen(filename)
@@ -156,15 +216,39 @@ func Filename(snapshot *client.Snapshot) string {
 	return filepath.Join(dirs.SnapshotsDir, fmt.Sprintf("%d_%s_%s_%s.zip", snapshot.SetID, snapshot.Snap, snapshot.Version, snapshot.Revision))
 }
 
+// findSnapshot returns the filename of the snapshot of the given snap in the
+// given snapshot set, or the empty string if there is none.
+func findSnapshot(ctx context.Context, setID uint64, snapName string) (string, error) {
+	var fn string
+	err := Iter(ctx, func(r *Reader) error {
+		if r.SetID == setID && r.Snap == snapName {
+			fn = r.Name()
+			return Stop
+		}
+		return nil
+	})
+	return fn, err
+}
+
 // Save a snapshot
 func Save(ctx context.Context, id uint64, si *snap.Info, cfg map[string]interface{}, usernames []string, flags *Flags) (*client.Snapshot, error) {
 	if err := os.MkdirAll(dirs.SnapshotsDir, 0700); err != nil {
 		return nil, err
 	}
 
-	var auto bool
-	if flags != nil {
-		auto = flags.Auto
+	if flags == nil {
+		flags = &Flags{}
+	}
+	compression := flags.Compression
+	if compression == "" {
+		compression = DefaultCompression
+	}
+	if err := ValidateCompression(compression); err != nil {
+		return nil, err
+	}
+	key := flags.EncryptionKey
+	if key != nil && len(key) != KeySize {
+		return nil, fmt.Errorf("invalid snapshot encryption key: must be %d bytes", KeySize)
 	}
 
 	snapshot := &client.Snapshot{
@@ -178,7 +262,33 @@ func Save(ctx context.Context, id uint64, si *snap.Info, cfg map[string]interfac
 		SHA3_384: make(map[string]string),
 		Size:     0,
 		Conf:     cfg,
-		Auto:     auto,
+		Auto:     flags.Auto,
+	}
+	if key != nil {
+		// the configuration goes in its own, encrypted, entry
+		snapshot.Conf = nil
+		snapshot.KeyID = keyID(key)
+	}
+
+	var base *Reader
+	if flags.BaseSetID != 0 {
+		fn, err := findSnapshot(ctx, flags.BaseSetID, snapshot.Snap)
+		if err != nil {
+			return nil, err
+		}
+		if fn == "" {
+			logger.Noticef("No snapshot of %q in snapshot set #%d; taking a full snapshot in #%d.", snapshot.Snap, flags.BaseSetID, id)
+		} else {
+			base, err = backendOpen(fn)
+			if err != nil {
+				return nil, fmt.Errorf("cannot open base snapshot %q: %v", fn, err)
+			}
+			defer base.Close()
+			if err := base.Unlock(key); err != nil {
+				return nil, fmt.Errorf("cannot use base snapshot %q: %v", fn, err)
+			}
+			snapshot.BaseSetID = flags.BaseSetID
+		}
 	}
 
 	aw, err := osutil.NewAtomicFile(Filename(snapshot), 0600, 0, osutil.NoChown, osutil.NoChown)
@@ -190,7 +300,7 @@ func Save(ctx context.Context, id uint64, si *snap.Info, cfg map[string]interfac
 
 	w := zip.NewWriter(aw)
 	defer w.Close() // note this does not close the file descriptor (that's done by hand on the atomic writer, above)
-	if err := addDirToZip(ctx, snapshot, w, "root", archiveName, si.DataDir()); err != nil {
+	if err := addDirToZip(ctx, snapshot, w, "root", archiveBaseName+compressionSuffixes[compression], si.DataDir(), compression, base, key); err != nil {
 		return nil, err
 	}
 
@@ -200,27 +310,20 @@ func Save(ctx context.Context, id uint64, si *snap.Info, cfg map[string]interfac
 	}
 
 	for _, usr := range users {
-		if err := addDirToZip(ctx, snapshot, w, usr.Username, userArchiveName(usr), si.UserDataDir(usr.HomeDir)); err != nil {
+		if err := addDirToZip(ctx, snapshot, w, usr.Username, userArchiveName(usr, compression), si.UserDataDir(usr.HomeDir), compression, base, key); err != nil {
 			return nil, err
 		}
 	}
 
-	metaWriter, err := w.Create(metadataName)
-	if err != nil {
-		return nil, err
-	}
-
-	hasher := crypto.SHA3_384.New()
-	enc := json.NewEncoder(io.MultiWriter(metaWriter, hasher))
-	if err := enc.Encode(snapshot); err != nil {
-		return nil, err
+	if key != nil && cfg != nil {
+		if err := addConfigToZip(snapshot, w, cfg, key); err != nil {
+			return nil, err
+		}
 	}
 
-	hashWriter, err := w.Create(metaHashName)
-	if err != nil {
+	if err := addMetaToZip(snapshot, w); err != nil {
 		return nil, err
 	}
-	fmt.Fprintf(hashWriter, "%x\n", hasher.Sum(nil))
 	if err := w.Close(); err != nil {
 		return nil, err
 	}
@@ -236,9 +339,55 @@ func Save(ctx context.Context, id uint64, si *snap.Info, cfg map[string]interfac
 	return snapshot, nil
 }
 
+// addMetaToZip adds the snapshot metadata, and its hash, to the zip.
+func addMetaToZip(snapshot *client.Snapshot, w *zip.Writer) error {
+	metaWriter, err := w.Create(metadataName)
+	if err != nil {
+		return err
+	}
+
+	hasher := crypto.SHA3_384.New()
+	enc := json.NewEncoder(io.MultiWriter(metaWriter, hasher))
+	if err := enc.Encode(snapshot); err != nil {
+		return err
+	}
+
+	hashWriter, err := w.Create(metaHashName)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(hashWriter, "%x\n", hasher.Sum(nil))
+	return err
+}
+
 var isTesting = osutil.GetenvBool("SNAPPY_TESTING")
 
-func addDirToZip(ctx context.Context, snapshot *client.Snapshot, w *zip.Writer, username string, entry, dir string) error {
+// addConfigToZip adds the given snap configuration to the zip, encrypted
+// with the given key.
+func addConfigToZip(snapshot *client.Snapshot, w *zip.Writer, cfg map[string]interface{}, key []byte) error {
+	buf, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	return addEntryToZip(snapshot, w, configName, bytes.NewReader(buf), key)
+}
+
+// maybeEncrypter returns a writer that encrypts into w with the given key,
+// or that writes to w as is if key is nil.
+func maybeEncrypter(key []byte, w io.Writer) (io.WriteCloser, error) {
+	if key == nil {
+		return nopWriteCloser{w}, nil
+	}
+	return encrypter(key, w)
+}
+
+// addDirToZip adds the given snap data directory (and the "common" directory
+// next to it) to the zip as a tar archive, along with the listed-incremental
+// data tar produced for it. The archive is compressed with the given
+// compression method. If base has listed-incremental data for the
+// same archive, only the changes since base are archived. If key is not
+// nil, both are encrypted with it.
+func addDirToZip(ctx context.Context, snapshot *client.Snapshot, w *zip.Writer, username string, entry, dir, compression string, base *Reader, key []byte) error {
 	parent, revdir := filepath.Split(dir)
 	exists, isDir, err := osutil.DirExists(parent)
 	if err != nil {
@@ -254,7 +403,7 @@ func addDirToZip(ctx context.Context, snapshot *client.Snapshot, w *zip.Writer,
 	}
 	tarArgs := []string{
 		"--create",
-		"--sparse", "--gzip",
+		"--sparse",
 		"--directory", parent,
 	}
 
@@ -293,6 +442,13 @@ func addDirToZip(ctx context.Context, snapshot *client.Snapshot, w *zip.Writer,
 		return nil
 	}
 
+	snar, err := newIncrementalFile(ctx, username, base, entry)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(snar)
+	tarArgs = append([]string{"--listed-incremental=" + snar, "--no-check-device"}, tarArgs...)
+
 	archiveWriter, err := w.CreateHeader(&zip.FileHeader{Name: entry})
 	if err != nil {
 		return err
@@ -301,8 +457,16 @@ func addDirToZip(ctx context.Context, snapshot *client.Snapshot, w *zip.Writer,
 	var sz sizer
 	hasher := crypto.SHA3_384.New()
 
+	ew, err := maybeEncrypter(key, io.MultiWriter(archiveWriter, hasher, &sz))
+	if err != nil {
+		return err
+	}
+	cw, err := compressor(compression, ew)
+	if err != nil {
+		return err
+	}
 	cmd := tarAsUser(username, tarArgs...)
-	cmd.Stdout = io.MultiWriter(archiveWriter, hasher, &sz)
+	cmd.Stdout = cw
 	matchCounter := &strutil.MatchCounter{N: 1}
 	cmd.Stderr = matchCounter
 	if isTesting {
@@ -316,9 +480,128 @@ func addDirToZip(ctx context.Context, snapshot *client.Snapshot, w *zip.Writer,
 		}
 		return fmt.Errorf("tar failed: %v", err)
 	}
+	if err := cw.Close(); err != nil {
+		return err
+	}
+	if err := ew.Close(); err != nil {
+		return err
+	}
+
+	snapshot.SHA3_384[entry] = fmt.Sprintf("%x", hasher.Sum(nil))
+	snapshot.Size += sz.size
+
+	f, err := os.Open(snar)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return addEntryToZip(snapshot, w, incrementalEntry(entry), f, key)
+}
+
+// addEntryToZip adds what's read from r to the zip as entry, encrypted with
+// key if not nil, tracking its hash and size in the snapshot.
+func addEntryToZip(snapshot *client.Snapshot, w *zip.Writer, entry string, r io.Reader, key []byte) error {
+	entryWriter, err := w.CreateHeader(&zip.FileHeader{Name: entry})
+	if err != nil {
+		return err
+	}
+
+	var sz sizer
+	hasher := crypto.SHA3_384.New()
+	ew, err := maybeEncrypter(key, io.MultiWriter(entryWriter, hasher, &sz))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(ew, r); err != nil {
+		return err
+	}
+	if err := ew.Close(); err != nil {
+		return err
+	}
 
 	snapshot.SHA3_384[entry] = fmt.Sprintf("%x", hasher.Sum(nil))
 	snapshot.Size += sz.size
 
 	return nil
 }
+
+// newIncrementalFile creates a temporary file, owned by the given user, for
+// tar to keep its listed-incremental data in. If base has listed-incremental
+// data for the given archive entry, the file is primed with it so the new
+// archive is incremental on base's; otherwise it is left empty so the new
+// archive is a full one.
+func newIncrementalFile(ctx context.Context, username string, base *Reader, entry string) (fn string, e error) {
+	f, err := ioutil.TempFile("", "snapshot")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		f.Close()
+		if e != nil {
+			os.Remove(f.Name())
+		}
+	}()
+
+	if base != nil {
+		snarEntry := incrementalEntry(entry)
+		if _, ok := base.SHA3_384[snarEntry]; ok {
+			err := base.readArchive(snarEntry, func(snar io.Reader) error {
+				_, err := io.Copy(io.MultiWriter(osutil.ContextWriter(ctx), f), snar)
+				return err
+			})
+			if err != nil {
+				return "", fmt.Errorf("cannot use base snapshot %q: %v", base.Name(), err)
+			}
+		}
+	}
+
+	if username != "root" && sysGeteuid() == 0 {
+		usr, err := userLookup(username)
+		if err != nil {
+			if isUnknownUser(err) {
+				// tar won't be able to run as them either, and
+				// will say so
+				return f.Name(), nil
+			}
+			return "", err
+		}
+		uid, err := strconv.ParseUint(usr.Uid, 10, 32)
+		if err != nil {
+			return "", err
+		}
+		gid, err := strconv.ParseUint(usr.Gid, 10, 32)
+		if err != nil {
+			return "", err
+		}
+		if err := f.Chown(int(uid), int(gid)); err != nil {
+			return "", err
+		}
+	}
+
+	return f.Name(), nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// compressor returns a writer that compresses into w with the given
+// compression method.
+func compressor(compression string, w io.Writer) (io.WriteCloser, error) {
+	if level, ok := gzipLevels[compression]; ok {
+		return gzip.NewWriterLevel(w, level)
+	}
+	return nopWriteCloser{w}, nil
+}
+
+// decompressor returns a reader that decompresses from r as appropriate
+// for the given archive entry.
+func decompressor(entry string, r io.Reader) (io.Reader, error) {
+	if archiveSuffix(entry) == compressionSuffixes[CompressionGzip] {
+		return gzip.NewReader(r)
+	}
+	return r, nil
+}
@@ -20,9 +20,12 @@
 package backend_test
 
 import (
+	"archive/tar"
 	"archive/zip"
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto"
 	"errors"
 	"fmt"
 	"io"
@@ -34,6 +37,7 @@ import (
 	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	"gopkg.in/check.v1"
 
@@ -408,11 +412,11 @@ func (s *snapshotSuite) TestAddDirToZipBails(c *check.C) {
 	buf, restore := logger.MockLogger()
 	defer restore()
 	// note as the zip is nil this would panic if it didn't bail
-	c.Check(backend.AddDirToZip(nil, snapshot, nil, "", "an/entry", filepath.Join(s.root, "nonexistent")), check.IsNil)
+	c.Check(backend.AddDirToZip(nil, snapshot, nil, "", "an/entry", filepath.Join(s.root, "nonexistent"), backend.CompressionNone, nil, nil), check.IsNil)
 	// no log for the non-existent case
 	c.Check(buf.String(), check.Equals, "")
 	buf.Reset()
-	c.Check(backend.AddDirToZip(nil, snapshot, nil, "", "an/entry", "/etc/passwd"), check.IsNil)
+	c.Check(backend.AddDirToZip(nil, snapshot, nil, "", "an/entry", "/etc/passwd", backend.CompressionNone, nil, nil), check.IsNil)
 	c.Check(buf.String(), check.Matches, "(?m).* is not a directory.")
 }
 
@@ -426,7 +430,7 @@ func (s *snapshotSuite) TestAddDirToZipTarFails(c *check.C) {
 
 	var buf bytes.Buffer
 	z := zip.NewWriter(&buf)
-	c.Assert(backend.AddDirToZip(ctx, nil, z, "", "an/entry", d), check.ErrorMatches, ".* context canceled")
+	c.Assert(backend.AddDirToZip(ctx, nil, z, "", "an/entry", d, backend.CompressionNone, nil, nil), check.ErrorMatches, ".* context canceled")
 }
 
 func (s *snapshotSuite) TestAddDirToZip(c *check.C) {
@@ -440,17 +444,58 @@ func (s *snapshotSuite) TestAddDirToZip(c *check.C) {
 	snapshot := &client.Snapshot{
 		SHA3_384: map[string]string{},
 	}
-	c.Assert(backend.AddDirToZip(context.Background(), snapshot, z, "", "an/entry", d), check.IsNil)
+	c.Assert(backend.AddDirToZip(context.Background(), snapshot, z, "", "an/entry", d, backend.CompressionNone, nil, nil), check.IsNil)
 	z.Close() // write out the central directory
 
-	c.Check(snapshot.SHA3_384, check.HasLen, 1)
+	c.Check(snapshot.SHA3_384, check.HasLen, 2)
 	c.Check(snapshot.SHA3_384["an/entry"], check.HasLen, 96)
+	c.Check(snapshot.SHA3_384["an/entry.snar"], check.HasLen, 96)
 	c.Check(snapshot.Size > 0, check.Equals, true) // actual size most likely system-dependent
 	br := bytes.NewReader(buf.Bytes())
 	r, err := zip.NewReader(br, int64(br.Len()))
 	c.Assert(err, check.IsNil)
-	c.Check(r.File, check.HasLen, 1)
+	c.Check(r.File, check.HasLen, 2)
 	c.Check(r.File[0].Name, check.Equals, "an/entry")
+	c.Check(r.File[1].Name, check.Equals, "an/entry.snar")
+}
+
+func (s *snapshotSuite) TestAddDirToZipGzipFast(c *check.C) {
+	d := filepath.Join(s.root, "foo")
+	c.Assert(os.MkdirAll(filepath.Join(d, "bar"), 0755), check.IsNil)
+	c.Assert(os.MkdirAll(filepath.Join(s.root, "common"), 0755), check.IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(d, "bar", "baz"), []byte("hello\n"), 0644), check.IsNil)
+
+	var buf bytes.Buffer
+	z := zip.NewWriter(&buf)
+	snapshot := &client.Snapshot{
+		SHA3_384: map[string]string{},
+	}
+	c.Assert(backend.AddDirToZip(context.Background(), snapshot, z, "", "an/entry.tgz", d, backend.CompressionGzipFast, nil, nil), check.IsNil)
+	z.Close()
+
+	br := bytes.NewReader(buf.Bytes())
+	r, err := zip.NewReader(br, int64(br.Len()))
+	c.Assert(err, check.IsNil)
+	c.Assert(r.File[0].Name, check.Equals, "an/entry.tgz")
+	f, err := r.File[0].Open()
+	c.Assert(err, check.IsNil)
+	defer f.Close()
+	// a gzip stream like any other, holding the tar archive
+	gz, err := gzip.NewReader(f)
+	c.Assert(err, check.IsNil)
+	tr := tar.NewReader(gz)
+	found := false
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		c.Assert(err, check.IsNil)
+		if hdr.Name == "foo/bar/baz" {
+			found = true
+		}
+	}
+	c.Check(found, check.Equals, true)
 }
 
 func (s *snapshotSuite) TestHappyRoundtrip(c *check.C) {
@@ -501,7 +546,7 @@ func (s *snapshotSuite) testHappyRoundtrip(c *check.C, marker string, auto bool)
 	c.Check(shw.Conf, check.DeepEquals, cfg)
 	c.Check(shw.Auto, check.Equals, auto)
 	c.Check(backend.Filename(shw), check.Equals, filepath.Join(dirs.SnapshotsDir, "12_hello-snap_v1.33_42.zip"))
-	c.Check(hashkeys(shw), check.DeepEquals, []string{"archive.tgz", "user/snapuser.tgz"})
+	c.Check(hashkeys(shw), check.DeepEquals, []string{"archive.snar", "archive.tgz", "user/snapuser.snar", "user/snapuser.tgz"})
 
 	shs, err := backend.List(context.TODO(), 0, nil)
 	c.Assert(err, check.IsNil)
@@ -604,6 +649,186 @@ func (s *snapshotSuite) TestRestoreRoundtripDifferentRevision(c *check.C) {
 	c.Check(diff().Run(), check.IsNil)
 }
 
+func (s *snapshotSuite) TestHappyRoundtripNoCompression(c *check.C) {
+	if os.Geteuid() == 0 {
+		c.Skip("this test cannot run as root (runuser will fail)")
+	}
+	logger.SimpleSetup()
+
+	info := &snap.Info{SideInfo: snap.SideInfo{RealName: "hello-snap", Revision: snap.R(42), SnapID: "hello-id"}, Version: "v1.33"}
+	shw, err := backend.Save(context.TODO(), 12, info, nil, []string{"snapuser"}, &backend.Flags{Compression: backend.CompressionNone})
+	c.Assert(err, check.IsNil)
+	c.Check(hashkeys(shw), check.DeepEquals, []string{"archive.snar", "archive.tar", "user/snapuser.snar", "user/snapuser.tar"})
+
+	shr, err := backend.Open(backend.Filename(shw))
+	c.Assert(err, check.IsNil)
+	defer shr.Close()
+	c.Check(shr.Check(context.TODO(), nil), check.IsNil)
+
+	newroot := c.MkDir()
+	c.Assert(os.MkdirAll(filepath.Join(newroot, "home/snapuser"), 0755), check.IsNil)
+	dirs.SetRootDir(newroot)
+
+	rs, err := shr.Restore(context.TODO(), snap.R(0), nil, logger.Debugf)
+	c.Assert(err, check.IsNil)
+	rs.Cleanup()
+	c.Check(exec.Command("diff", "-urN", "-x*.zip", s.root, newroot).Run(), check.IsNil)
+}
+
+func (s *snapshotSuite) TestSaveUnsupportedCompression(c *check.C) {
+	info := &snap.Info{SideInfo: snap.SideInfo{RealName: "hello-snap", Revision: snap.R(42)}, Version: "v1.33"}
+	_, err := backend.Save(context.TODO(), 12, info, nil, nil, &backend.Flags{Compression: "lzma"})
+	c.Check(err, check.ErrorMatches, `unsupported snapshot compression "lzma" \(supported: none, gzip, gzip-fast\)`)
+
+	c.Check(backend.ValidateCompression(""), check.IsNil)
+	c.Check(backend.ValidateCompression("none"), check.IsNil)
+	c.Check(backend.ValidateCompression("gzip"), check.IsNil)
+	c.Check(backend.ValidateCompression("gzip-fast"), check.IsNil)
+}
+
+func (s *snapshotSuite) TestIncrementalRoundtrip(c *check.C) {
+	if os.Geteuid() == 0 {
+		c.Skip("this test cannot run as root (runuser will fail)")
+	}
+	logger.SimpleSetup()
+
+	info := &snap.Info{SideInfo: snap.SideInfo{RealName: "hello-snap", Revision: snap.R(42), SnapID: "hello-id"}, Version: "v1.33"}
+	full, err := backend.Save(context.TODO(), 12, info, nil, []string{"snapuser"}, nil)
+	c.Assert(err, check.IsNil)
+	c.Check(full.BaseSetID, check.Equals, uint64(0))
+
+	// add, change, and remove some things
+	waitPastTimestamps()
+	homeDir := filepath.Join(dirs.GlobalRootDir, "home/snapuser")
+	c.Assert(ioutil.WriteFile(filepath.Join(info.DataDir(), "new"), []byte("new system canary\n"), 0644), check.IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(info.UserDataDir(homeDir), "ufoo"), []byte("changed user canary\n"), 0644), check.IsNil)
+	c.Assert(os.Remove(filepath.Join(info.CommonDataDir(), "bar")), check.IsNil)
+
+	incr, err := backend.Save(context.TODO(), 13, info, nil, []string{"snapuser"}, &backend.Flags{BaseSetID: 12})
+	c.Assert(err, check.IsNil)
+	c.Check(incr.BaseSetID, check.Equals, uint64(12))
+	// only what changed is in the archives
+	c.Check(archivedFiles(c, backend.Filename(incr), "archive.tgz"), check.DeepEquals, []string{"42/new"})
+	c.Check(archivedFiles(c, backend.Filename(incr), "user/snapuser.tgz"), check.DeepEquals, []string{"42/ufoo"})
+
+	// a third link in the chain, using a different compression than its base
+	waitPastTimestamps()
+	c.Assert(ioutil.WriteFile(filepath.Join(info.UserCommonDataDir(homeDir), "ubar"), []byte("changed again\n"), 0644), check.IsNil)
+	last, err := backend.Save(context.TODO(), 14, info, nil, []string{"snapuser"}, &backend.Flags{BaseSetID: 13, Compression: backend.CompressionNone})
+	c.Assert(err, check.IsNil)
+	c.Check(last.BaseSetID, check.Equals, uint64(13))
+	c.Check(archivedFiles(c, backend.Filename(last), "archive.tar"), check.HasLen, 0)
+	c.Check(archivedFiles(c, backend.Filename(last), "user/snapuser.tar"), check.DeepEquals, []string{"common/ubar"})
+
+	shr, err := backend.Open(backend.Filename(last))
+	c.Assert(err, check.IsNil)
+	defer shr.Close()
+	c.Check(shr.Check(context.TODO(), nil), check.IsNil)
+
+	// the snapshots need to be reachable from the new root
+	oldSnapshotsDir := dirs.SnapshotsDir
+	newroot := c.MkDir()
+	c.Assert(os.MkdirAll(filepath.Join(newroot, "home/snapuser"), 0755), check.IsNil)
+	dirs.SetRootDir(newroot)
+	c.Assert(os.MkdirAll(filepath.Dir(dirs.SnapshotsDir), 0755), check.IsNil)
+	c.Assert(os.Symlink(oldSnapshotsDir, dirs.SnapshotsDir), check.IsNil)
+
+	rs, err := shr.Restore(context.TODO(), snap.R(0), nil, logger.Debugf)
+	c.Assert(err, check.IsNil)
+	rs.Cleanup()
+	c.Check(exec.Command("diff", "-urN", "-x*.zip", s.root, newroot).Run(), check.IsNil)
+
+	// without its base, the chain is broken
+	c.Assert(os.Remove(backend.Filename(full)), check.IsNil)
+	c.Check(shr.Check(context.TODO(), nil), check.ErrorMatches, `cannot find base snapshot of "hello-snap" in snapshot set #12`)
+	_, err = shr.Restore(context.TODO(), snap.R(0), nil, logger.Debugf)
+	c.Check(err, check.ErrorMatches, `cannot find base snapshot of "hello-snap" in snapshot set #12`)
+}
+
+// waitPastTimestamps waits long enough for files changed afterwards to
+// look newer to tar than the snapshot just taken; the filesystem
+// timestamps are coarser than the clock tar reads.
+func waitPastTimestamps() {
+	time.Sleep(50 * time.Millisecond)
+}
+
+// archivedFiles returns the regular files in the given archive entry of
+// the given snapshot.
+func archivedFiles(c *check.C, fn, entry string) []string {
+	zr, err := zip.OpenReader(fn)
+	c.Assert(err, check.IsNil)
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		if f.Name != entry {
+			continue
+		}
+		body, err := f.Open()
+		c.Assert(err, check.IsNil)
+		defer body.Close()
+		var r io.Reader = body
+		if strings.HasSuffix(entry, ".tgz") {
+			r, err = gzip.NewReader(body)
+			c.Assert(err, check.IsNil)
+		}
+		var names []string
+		tr := tar.NewReader(r)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			c.Assert(err, check.IsNil)
+			if hdr.Typeflag == tar.TypeReg {
+				names = append(names, hdr.Name)
+			}
+		}
+		sort.Strings(names)
+		return names
+	}
+	c.Fatalf("no entry %q in %q", entry, fn)
+	return nil
+}
+
+func (s *snapshotSuite) TestIncrementalNoBaseSnapshotIsFull(c *check.C) {
+	if os.Geteuid() == 0 {
+		c.Skip("this test cannot run as root (runuser will fail)")
+	}
+	logger.SimpleSetup()
+	makeSnapshotFile(c, 12, "other-snap")
+
+	info := &snap.Info{SideInfo: snap.SideInfo{RealName: "hello-snap", Revision: snap.R(42)}, Version: "v1.33"}
+	shw, err := backend.Save(context.TODO(), 13, info, nil, []string{"snapuser"}, &backend.Flags{BaseSetID: 12})
+	c.Assert(err, check.IsNil)
+	c.Check(shw.BaseSetID, check.Equals, uint64(0))
+}
+
+func (s *snapshotSuite) TestCheckBrokenChain(c *check.C) {
+	makeIncrementalSnapshotFile(c, 13, "a-snap", 12)
+	shr, err := backend.Open(backend.Filename(&client.Snapshot{SetID: 13, Snap: "a-snap", Version: "v1.0", Revision: snap.R(42)}))
+	c.Assert(err, check.IsNil)
+	defer shr.Close()
+
+	c.Check(shr.Check(context.TODO(), nil), check.ErrorMatches, `cannot find base snapshot of "a-snap" in snapshot set #12`)
+
+	// a base that is, in turn, incremental on the snapshot itself
+	makeIncrementalSnapshotFile(c, 12, "a-snap", 13)
+	c.Check(shr.Check(context.TODO(), nil), check.ErrorMatches, `snapshot ".*/13_a-snap_v1.0_42.zip" has a loop in its chain of base snapshots`)
+
+	makeSnapshotFile(c, 12, "a-snap")
+	c.Check(shr.Check(context.TODO(), nil), check.IsNil)
+
+	// a corrupted base
+	fn := backend.Filename(&client.Snapshot{SetID: 12, Snap: "a-snap", Version: "v1.0", Revision: snap.R(42)})
+	buf, err := ioutil.ReadFile(fn)
+	c.Assert(err, check.IsNil)
+	idx := bytes.Index(buf, []byte("archive of a-snap"))
+	c.Assert(idx >= 0, check.Equals, true)
+	buf[idx] = 'A'
+	c.Assert(ioutil.WriteFile(fn, buf, 0600), check.IsNil)
+	c.Check(shr.Check(context.TODO(), nil), check.ErrorMatches, `base snapshot set #12: .*`)
+}
+
 func (s *snapshotSuite) TestPickUserWrapperRunuser(c *check.C) {
 	n := 0
 	defer backend.MockExecLookPath(func(s string) (string, error) {
@@ -718,3 +943,261 @@ func (s *snapshotSuite) TestMaybeRunuserNoHappy(c *check.C) {
 	})
 	c.Check(strings.TrimSpace(logbuf.String()), check.Matches, ".* No user wrapper found.*")
 }
+
+// makeSnapshotFile writes a minimal but valid snapshot file for the
+// given set and snap to the snapshots directory, without needing to
+// run tar as a user.
+func makeSnapshotFile(c *check.C, setID uint64, snapName string) *client.Snapshot {
+	return makeIncrementalSnapshotFile(c, setID, snapName, 0)
+}
+
+// makeIncrementalSnapshotFile is like makeSnapshotFile, but the snapshot
+// claims to be incremental on the given base set.
+func makeIncrementalSnapshotFile(c *check.C, setID uint64, snapName string, baseSetID uint64) *client.Snapshot {
+	content := []byte("archive of " + snapName)
+	hasher := crypto.SHA3_384.New()
+	hasher.Write(content)
+	snapshot := &client.Snapshot{
+		SetID:     setID,
+		Time:      time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC),
+		Snap:      snapName,
+		Revision:  snap.R(42),
+		Version:   "v1.0",
+		SHA3_384:  map[string]string{"archive.tgz": fmt.Sprintf("%x", hasher.Sum(nil))},
+		Size:      int64(len(content)),
+		BaseSetID: baseSetID,
+	}
+
+	c.Assert(os.MkdirAll(dirs.SnapshotsDir, 0700), check.IsNil)
+	f, err := os.Create(backend.Filename(snapshot))
+	c.Assert(err, check.IsNil)
+	defer f.Close()
+	w := zip.NewWriter(f)
+	archiveWriter, err := w.Create("archive.tgz")
+	c.Assert(err, check.IsNil)
+	_, err = archiveWriter.Write(content)
+	c.Assert(err, check.IsNil)
+	c.Assert(backend.AddMetaToZip(snapshot, w), check.IsNil)
+	c.Assert(w.Close(), check.IsNil)
+
+	return snapshot
+}
+
+func (s *snapshotSuite) exportSet(c *check.C, setID uint64) []byte {
+	se, err := backend.NewSnapshotExport(context.TODO(), setID)
+	c.Assert(err, check.IsNil)
+	defer se.Close()
+
+	var buf bytes.Buffer
+	c.Assert(se.StreamTo(context.TODO(), &buf), check.IsNil)
+	return buf.Bytes()
+}
+
+func (s *snapshotSuite) TestExportImportRoundtrip(c *check.C) {
+	shA := makeSnapshotFile(c, 12, "a-snap")
+	shB := makeSnapshotFile(c, 12, "b-snap")
+	makeSnapshotFile(c, 13, "c-snap")
+
+	exported := s.exportSet(c, 12)
+
+	snapNames, err := backend.Import(context.TODO(), 20, bytes.NewReader(exported))
+	c.Assert(err, check.IsNil)
+	c.Check(snapNames, check.DeepEquals, []string{"a-snap", "b-snap"})
+
+	sets, err := backend.List(context.TODO(), 20, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(sets, check.HasLen, 1)
+	c.Assert(sets[0].Snapshots, check.HasLen, 2)
+	for i, expected := range []*client.Snapshot{shA, shB} {
+		imported := sets[0].Snapshots[i]
+		c.Check(imported.SetID, check.Equals, uint64(20))
+		c.Check(imported.Snap, check.Equals, expected.Snap)
+		c.Check(imported.SHA3_384, check.DeepEquals, expected.SHA3_384)
+
+		r, err := backend.Open(backend.Filename(imported))
+		c.Assert(err, check.IsNil)
+		c.Check(r.Check(context.TODO(), nil), check.IsNil)
+		r.Close()
+	}
+
+	// the original set is untouched, and no temporary files are left behind
+	sets, err = backend.List(context.TODO(), 0, nil)
+	c.Assert(err, check.IsNil)
+	c.Check(sets, check.HasLen, 3)
+	names, err := filepath.Glob(filepath.Join(dirs.SnapshotsDir, ".*"))
+	c.Assert(err, check.IsNil)
+	c.Check(names, check.HasLen, 0)
+}
+
+func (s *snapshotSuite) TestNewSnapshotExportNotFound(c *check.C) {
+	makeSnapshotFile(c, 12, "a-snap")
+
+	_, err := backend.NewSnapshotExport(context.TODO(), 13)
+	c.Check(err, check.Equals, client.ErrSnapshotSetNotFound)
+}
+
+func (s *snapshotSuite) TestNewSnapshotExportIncremental(c *check.C) {
+	makeSnapshotFile(c, 12, "a-snap")
+	makeIncrementalSnapshotFile(c, 13, "a-snap", 12)
+
+	_, err := backend.NewSnapshotExport(context.TODO(), 13)
+	c.Check(err, check.ErrorMatches, `cannot export snapshot ".*/13_a-snap_v1.0_42.zip": it is incremental on snapshot set #12`)
+	c.Check(err, check.FitsTypeOf, &backend.CannotExportError{})
+}
+
+func (s *snapshotSuite) TestNewSnapshotExportBroken(c *check.C) {
+	makeSnapshotFile(c, 12, "a-snap")
+	defer backend.MockOpen(func(fn string) (*backend.Reader, error) {
+		r, err := backend.Open(fn)
+		c.Assert(err, check.IsNil)
+		r.Close()
+		r.Broken = "xyzzy"
+		return r, errors.New(r.Broken)
+	})()
+
+	_, err := backend.NewSnapshotExport(context.TODO(), 12)
+	c.Check(err, check.ErrorMatches, `cannot export snapshot ".*/12_a-snap_v1.0_42.zip": xyzzy`)
+	c.Check(err, check.FitsTypeOf, &backend.CannotExportError{})
+}
+
+func (s *snapshotSuite) TestImportDoesNotOverwrite(c *check.C) {
+	makeSnapshotFile(c, 12, "a-snap")
+	makeSnapshotFile(c, 12, "b-snap")
+	existing := makeSnapshotFile(c, 20, "b-snap")
+	exported := s.exportSet(c, 12)
+
+	_, err := backend.Import(context.TODO(), 20, bytes.NewReader(exported))
+	c.Check(err, check.ErrorMatches, `cannot import snapshot "12_b-snap_v1.0_42.zip": ".*/20_b-snap_v1.0_42.zip" already exists`)
+	// the export is fine, it's the snapshots directory that is in the way
+	_, ok := err.(*backend.InvalidExportError)
+	c.Check(ok, check.Equals, false)
+
+	// the snapshot imported before the failure was removed again
+	sets, err := backend.List(context.TODO(), 20, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(sets, check.HasLen, 1)
+	c.Assert(sets[0].Snapshots, check.HasLen, 1)
+	c.Check(sets[0].Snapshots[0].SHA3_384, check.DeepEquals, existing.SHA3_384)
+}
+
+type tarMember struct {
+	name    string
+	content []byte
+}
+
+func makeTar(c *check.C, members []tarMember) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, m := range members {
+		c.Assert(tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     m.name,
+			Mode:     0600,
+			Size:     int64(len(m.content)),
+		}), check.IsNil)
+		_, err := tw.Write(m.content)
+		c.Assert(err, check.IsNil)
+	}
+	c.Assert(tw.Close(), check.IsNil)
+	return buf.Bytes()
+}
+
+func (s *snapshotSuite) TestImportRejectsBadMetadata(c *check.C) {
+	content := []byte("archive of evil")
+	hasher := crypto.SHA3_384.New()
+	hasher.Write(content)
+	good := client.Snapshot{
+		SetID:    12,
+		Time:     time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC),
+		Snap:     "a-snap",
+		Revision: snap.R(42),
+		Version:  "v1.0",
+		SHA3_384: map[string]string{"archive.tgz": fmt.Sprintf("%x", hasher.Sum(nil))},
+		Size:     int64(len(content)),
+	}
+	evil := filepath.Join(dirs.SnapshotsDir, "..", "..", "evil")
+
+	for _, t := range []struct {
+		tweak func(*client.Snapshot)
+		err   string
+	}{
+		{func(sh *client.Snapshot) { sh.Snap = "../../../../evil" }, `invalid snap name: "\.\./\.\./\.\./\.\./evil"`},
+		{func(sh *client.Snapshot) { sh.Snap = "a-snap/../../evil" }, `invalid snap name: .*`},
+		{func(sh *client.Snapshot) { sh.Version = "1/../../../../evil" }, `invalid snap version .*`},
+		{func(sh *client.Snapshot) { sh.Version = "" }, `invalid snap version: cannot be empty`},
+	} {
+		snapshot := good
+		t.tweak(&snapshot)
+
+		var zipBuf bytes.Buffer
+		w := zip.NewWriter(&zipBuf)
+		archiveWriter, err := w.Create("archive.tgz")
+		c.Assert(err, check.IsNil)
+		_, err = archiveWriter.Write(content)
+		c.Assert(err, check.IsNil)
+		c.Assert(backend.AddMetaToZip(&snapshot, w), check.IsNil)
+		c.Assert(w.Close(), check.IsNil)
+
+		zipHasher := crypto.SHA3_384.New()
+		zipHasher.Write(zipBuf.Bytes())
+		manifest := fmt.Sprintf(`{"format":1,"set-id":12,"snapshots":{"12_evil.zip":{"size":%d,"sha3-384":"%x"}}}`, zipBuf.Len(), zipHasher.Sum(nil))
+		exported := makeTar(c, []tarMember{
+			{"12_evil.zip", zipBuf.Bytes()},
+			{"export.json", []byte(manifest)},
+		})
+
+		_, err = backend.Import(context.TODO(), 20, bytes.NewReader(exported))
+		c.Check(err, check.ErrorMatches, `cannot import snapshot "12_evil.zip": `+t.err)
+		c.Check(err, check.FitsTypeOf, &backend.InvalidExportError{})
+	}
+
+	// nothing was written, in or out of the snapshots directory
+	sets, err := backend.List(context.TODO(), 20, nil)
+	c.Assert(err, check.IsNil)
+	c.Check(sets, check.HasLen, 0)
+	names, err := filepath.Glob(evil + "*")
+	c.Assert(err, check.IsNil)
+	c.Check(names, check.HasLen, 0)
+}
+
+func (s *snapshotSuite) TestImportErrors(c *check.C) {
+	snapshot := makeSnapshotFile(c, 12, "a-snap")
+	zipName := filepath.Base(backend.Filename(snapshot))
+	zipContent, err := ioutil.ReadFile(backend.Filename(snapshot))
+	c.Assert(err, check.IsNil)
+	hasher := crypto.SHA3_384.New()
+	hasher.Write(zipContent)
+	zipHash := fmt.Sprintf("%x", hasher.Sum(nil))
+	manifest := func(format int, setID uint64, size int, hash string) []byte {
+		return []byte(fmt.Sprintf(`{"format":%d,"set-id":%d,"snapshots":{%q:{"size":%d,"sha3-384":%q}}}`, format, setID, zipName, size, hash))
+	}
+	tampered := append([]byte(nil), zipContent...)
+	tampered[len(tampered)/2] ^= 0xff
+
+	for _, t := range []struct {
+		members []tarMember
+		err     string
+	}{
+		{nil, `cannot import snapshot set: missing export.json`},
+		{[]tarMember{{zipName, zipContent}}, `cannot import snapshot set: missing export.json`},
+		{[]tarMember{{"../" + zipName, zipContent}}, `cannot import snapshot set: unexpected member "\.\./.*"`},
+		{[]tarMember{{".hidden.zip", zipContent}}, `cannot import snapshot set: unexpected member "\.hidden\.zip"`},
+		{[]tarMember{{"foo.txt", zipContent}}, `cannot import snapshot set: unexpected member "foo\.txt"`},
+		{[]tarMember{{zipName, zipContent}, {zipName, zipContent}}, `cannot import snapshot set: duplicate member ".*"`},
+		{[]tarMember{{"export.json", manifest(1, 12, 0, "")}, {zipName, zipContent}}, `cannot import snapshot set: unexpected ".*" after export.json`},
+		{[]tarMember{{zipName, zipContent}, {"export.json", []byte("{")}}, `cannot decode export.json: unexpected EOF`},
+		{[]tarMember{{zipName, zipContent}, {"export.json", manifest(2, 12, len(zipContent), zipHash)}}, `cannot import snapshot set: unsupported export format 2`},
+		{[]tarMember{{"export.json", manifest(1, 12, len(zipContent), zipHash)}}, `cannot import snapshot set: manifest lists 1 snapshots, got 0`},
+		{[]tarMember{{zipName, zipContent}, {"export.json", manifest(1, 12, 1, zipHash)}}, `cannot import snapshot set: ".*" size \(\d+\) different from expected \(1\)`},
+		{[]tarMember{{zipName, tampered}, {"export.json", manifest(1, 12, len(zipContent), zipHash)}}, `cannot import snapshot set: ".*" hash \(.*\) does not match expected \(.*\)`},
+		{[]tarMember{{zipName, zipContent}, {"export.json", manifest(1, 13, len(zipContent), zipHash)}}, `cannot import snapshot ".*": snapshot set ID \(12\) does not match exported set ID \(13\)`},
+	} {
+		_, err := backend.Import(context.TODO(), 20, bytes.NewReader(makeTar(c, t.members)))
+		c.Check(err, check.ErrorMatches, t.err)
+		c.Check(err, check.FitsTypeOf, &backend.InvalidExportError{})
+	}
+
+	sets, err := backend.List(context.TODO(), 20, nil)
+	c.Assert(err, check.IsNil)
+	c.Check(sets, check.HasLen, 0)
+}
@@ -0,0 +1,242 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package backend
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// KeySize is the size, in bytes, of the keys snapshots are encrypted with.
+const KeySize = 32
+
+// Encrypted entries start with encryptionMagic, followed by a random salt
+// from which the key for the entry is derived, followed by the data
+// sealed in chunks of encryptionChunkSize bytes; the last chunk is sealed
+// differently to the others, so that a truncated entry can be told apart.
+const (
+	encryptionMagic     = "snapenc1"
+	encryptionSaltSize  = 32
+	encryptionChunkSize = 64 * 1024
+)
+
+var errBadEncryptedData = errors.New("cannot decrypt snapshot data: wrong key, or corrupted data")
+
+// ParseKey parses a hex-encoded snapshot encryption key.
+func ParseKey(s string) ([]byte, error) {
+	key, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(key) != KeySize {
+		return nil, fmt.Errorf("invalid snapshot encryption key: must be %d hex-encoded bytes", KeySize)
+	}
+	return key, nil
+}
+
+// ReadKeyFile reads a hex-encoded snapshot encryption key from the given
+// file, which must only be accessible by the owner of the process (that
+// is, root).
+func ReadKeyFile(fn string) ([]byte, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read snapshot encryption key: %v", err)
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read snapshot encryption key: %v", err)
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok || st.Uid != uint32(sysGeteuid()) || fi.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("cannot use snapshot encryption key file %q: it must only be accessible by root", fn)
+	}
+
+	buf, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read snapshot encryption key: %v", err)
+	}
+	key, err := ParseKey(string(buf))
+	if err != nil {
+		return nil, fmt.Errorf("cannot use snapshot encryption key file %q: %v", fn, err)
+	}
+	return key, nil
+}
+
+// keyID returns an identifier for the given key, so that the key a
+// snapshot was encrypted with can be checked without the key itself being
+// kept with it.
+func keyID(key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("snapshot key id"))
+	return fmt.Sprintf("%x", mac.Sum(nil)[:8])
+}
+
+func newEntryAEAD(key, salt []byte) (cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("snapshot entry key"))
+	mac.Write(salt)
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// chunkNonce returns the nonce for the n-th chunk of an entry.
+func chunkNonce(aead cipher.AEAD, n uint64, last bool) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce, n)
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+type encryptingWriter struct {
+	w    io.Writer
+	aead cipher.AEAD
+	buf  []byte
+	n    uint64
+}
+
+// encrypter returns a writer that encrypts into w with the given key; it
+// must be closed for the data to be complete.
+func encrypter(key []byte, w io.Writer) (io.WriteCloser, error) {
+	salt := make([]byte, encryptionSaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	aead, err := newEntryAEAD(key, salt)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(w, encryptionMagic); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(salt); err != nil {
+		return nil, err
+	}
+	return &encryptingWriter{w: w, aead: aead, buf: make([]byte, 0, encryptionChunkSize)}, nil
+}
+
+func (ew *encryptingWriter) seal(last bool) error {
+	_, err := ew.w.Write(ew.aead.Seal(nil, chunkNonce(ew.aead, ew.n, last), ew.buf, nil))
+	ew.buf = ew.buf[:0]
+	ew.n++
+	return err
+}
+
+func (ew *encryptingWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		// a full chunk is only sealed once there's more to come,
+		// as the last one needs to be sealed as such on Close
+		if len(ew.buf) == encryptionChunkSize {
+			if err := ew.seal(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(ew.buf[len(ew.buf):encryptionChunkSize], p)
+		ew.buf = ew.buf[:len(ew.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (ew *encryptingWriter) Close() error {
+	return ew.seal(true)
+}
+
+type decryptingReader struct {
+	r    *bufio.Reader
+	aead cipher.AEAD
+	buf  []byte
+	n    uint64
+	done bool
+}
+
+// decrypter returns a reader that decrypts what encrypter wrote into r.
+func decrypter(key []byte, r io.Reader) (io.Reader, error) {
+	header := make([]byte, len(encryptionMagic)+encryptionSaltSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, errBadEncryptedData
+	}
+	if !bytes.HasPrefix(header, []byte(encryptionMagic)) {
+		return nil, errBadEncryptedData
+	}
+	aead, err := newEntryAEAD(key, header[len(encryptionMagic):])
+	if err != nil {
+		return nil, err
+	}
+	return &decryptingReader{r: bufio.NewReader(r), aead: aead}, nil
+}
+
+func (dr *decryptingReader) Read(p []byte) (int, error) {
+	for len(dr.buf) == 0 {
+		if dr.done {
+			return 0, io.EOF
+		}
+		if err := dr.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, dr.buf)
+	dr.buf = dr.buf[n:]
+	return n, nil
+}
+
+// open reads and opens the next chunk.
+func (dr *decryptingReader) open() error {
+	sealed := make([]byte, encryptionChunkSize+dr.aead.Overhead())
+	n, err := io.ReadFull(dr.r, sealed)
+	switch err {
+	case nil:
+		// a full chunk is the last one if nothing comes after it
+		_, err = dr.r.Peek(1)
+		dr.done = err == io.EOF
+	case io.ErrUnexpectedEOF:
+		dr.done = true
+	case io.EOF:
+		// the last chunk is always there, even if empty
+		return errBadEncryptedData
+	default:
+		return err
+	}
+	dr.buf, err = dr.aead.Open(sealed[:0], chunkNonce(dr.aead, dr.n, dr.done), sealed[:n], nil)
+	if err != nil {
+		return errBadEncryptedData
+	}
+	dr.n++
+	return nil
+}
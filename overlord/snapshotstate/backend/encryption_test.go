@@ -0,0 +1,247 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package backend_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/osutil/sys"
+	"github.com/snapcore/snapd/overlord/snapshotstate/backend"
+	"github.com/snapcore/snapd/snap"
+)
+
+var (
+	testKey  = bytes.Repeat([]byte{42}, backend.KeySize)
+	otherKey = bytes.Repeat([]byte{7}, backend.KeySize)
+)
+
+func encrypt(c *check.C, key, data []byte) []byte {
+	var buf bytes.Buffer
+	w, err := backend.Encrypter(key, &buf)
+	c.Assert(err, check.IsNil)
+	// write it in odd bits, to exercise the chunking
+	for len(data) > 0 {
+		n := 1000
+		if n > len(data) {
+			n = len(data)
+		}
+		_, err := w.Write(data[:n])
+		c.Assert(err, check.IsNil)
+		data = data[n:]
+	}
+	c.Assert(w.Close(), check.IsNil)
+	return buf.Bytes()
+}
+
+func decrypt(key, data []byte) ([]byte, error) {
+	r, err := backend.Decrypter(key, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(r)
+}
+
+func (s *snapshotSuite) TestEncryptionRoundtrip(c *check.C) {
+	const chunk = backend.EncryptionChunkSize
+	for _, size := range []int{0, 1, chunk - 1, chunk, chunk + 1, 3*chunk + 17} {
+		comm := check.Commentf("%d", size)
+		data := bytes.Repeat([]byte("x"), size)
+		encrypted := encrypt(c, testKey, data)
+		c.Check(bytes.Contains(encrypted, []byte("xxxx")), check.Equals, false, comm)
+
+		decrypted, err := decrypt(testKey, encrypted)
+		c.Assert(err, check.IsNil, comm)
+		c.Check(decrypted, check.DeepEquals, data, comm)
+
+		_, err = decrypt(otherKey, encrypted)
+		c.Check(err, check.ErrorMatches, "cannot decrypt snapshot data: wrong key, or corrupted data", comm)
+	}
+
+	// the same data doesn't encrypt the same twice
+	c.Check(encrypt(c, testKey, []byte("hello")), check.Not(check.DeepEquals), encrypt(c, testKey, []byte("hello")))
+}
+
+func (s *snapshotSuite) TestDecryptionDetectsTampering(c *check.C) {
+	const chunk = backend.EncryptionChunkSize
+	encrypted := encrypt(c, testKey, bytes.Repeat([]byte("x"), 2*chunk+1))
+	// magic, salt, and the overhead of each chunk
+	header, sealedChunk := 8+32, chunk+16
+
+	for label, data := range map[string][]byte{
+		"empty":           nil,
+		"bad magic":       append([]byte("snapenc0"), encrypted[8:]...),
+		"no chunks":       encrypted[:header],
+		"truncated":       encrypted[:len(encrypted)-1],
+		"last chunk gone": encrypted[:header+2*sealedChunk],
+		"chunks swapped":  append(append(append([]byte{}, encrypted[:header]...), encrypted[header+sealedChunk:header+2*sealedChunk]...), encrypted[header:header+sealedChunk]...),
+		"flipped bit":     append(append(append([]byte{}, encrypted[:100]...), encrypted[100]^1), encrypted[101:]...),
+	} {
+		_, err := decrypt(testKey, data)
+		c.Check(err, check.ErrorMatches, "cannot decrypt snapshot data: wrong key, or corrupted data", check.Commentf(label))
+	}
+}
+
+func (s *snapshotSuite) TestParseKey(c *check.C) {
+	key, err := backend.ParseKey(strings.Repeat("2a", backend.KeySize) + "\n")
+	c.Assert(err, check.IsNil)
+	c.Check(key, check.DeepEquals, testKey)
+
+	for _, bad := range []string{"", "2a2a", strings.Repeat("2a", backend.KeySize+1), strings.Repeat("zz", backend.KeySize)} {
+		_, err := backend.ParseKey(bad)
+		c.Check(err, check.ErrorMatches, "invalid snapshot encryption key: must be 32 hex-encoded bytes", check.Commentf(bad))
+	}
+}
+
+func (s *snapshotSuite) TestReadKeyFile(c *check.C) {
+	fn := filepath.Join(c.MkDir(), "key")
+	c.Assert(ioutil.WriteFile(fn, []byte(strings.Repeat("2a", backend.KeySize)+"\n"), 0600), check.IsNil)
+
+	key, err := backend.ReadKeyFile(fn)
+	c.Assert(err, check.IsNil)
+	c.Check(key, check.DeepEquals, testKey)
+
+	// only root can have access to it
+	c.Assert(os.Chmod(fn, 0640), check.IsNil)
+	_, err = backend.ReadKeyFile(fn)
+	c.Check(err, check.ErrorMatches, `cannot use snapshot encryption key file ".*/key": it must only be accessible by root`)
+	c.Assert(os.Chmod(fn, 0600), check.IsNil)
+	restore := backend.MockSysGeteuid(func() sys.UserID { return sys.UserID(os.Geteuid() + 1) })
+	_, err = backend.ReadKeyFile(fn)
+	restore()
+	c.Check(err, check.ErrorMatches, `cannot use snapshot encryption key file ".*/key": it must only be accessible by root`)
+
+	c.Assert(ioutil.WriteFile(fn, []byte("hello\n"), 0600), check.IsNil)
+	_, err = backend.ReadKeyFile(fn)
+	c.Check(err, check.ErrorMatches, `cannot use snapshot encryption key file ".*/key": invalid snapshot encryption key: .*`)
+
+	_, err = backend.ReadKeyFile(fn + ".nope")
+	c.Check(err, check.ErrorMatches, `cannot read snapshot encryption key: open .*/key.nope: no such file or directory`)
+}
+
+func (s *snapshotSuite) TestEncryptedRoundtrip(c *check.C) {
+	if os.Geteuid() == 0 {
+		c.Skip("this test cannot run as root (runuser will fail)")
+	}
+	logger.SimpleSetup()
+
+	info := &snap.Info{SideInfo: snap.SideInfo{RealName: "hello-snap", Revision: snap.R(42), SnapID: "hello-id"}, Version: "v1.33"}
+	cfg := map[string]interface{}{"password": "hunter2"}
+	shw, err := backend.Save(context.TODO(), 12, info, cfg, []string{"snapuser"}, &backend.Flags{EncryptionKey: testKey})
+	c.Assert(err, check.IsNil)
+	c.Check(shw.KeyID, check.Equals, backend.KeyID(testKey))
+	c.Check(shw.Conf, check.IsNil)
+	c.Check(hashkeys(shw), check.DeepEquals, []string{"archive.snar", "archive.tgz", "config.json", "user/snapuser.snar", "user/snapuser.tgz"})
+
+	// neither the data nor the configuration are there in the clear
+	zr, err := zip.OpenReader(backend.Filename(shw))
+	c.Assert(err, check.IsNil)
+	for _, f := range zr.File {
+		body, err := f.Open()
+		c.Assert(err, check.IsNil)
+		data, err := ioutil.ReadAll(body)
+		body.Close()
+		c.Assert(err, check.IsNil)
+		for _, secret := range []string{"hunter2", "canary", "ufoo"} {
+			c.Check(bytes.Contains(data, []byte(secret)), check.Equals, false, check.Commentf("%s in %s", secret, f.Name))
+		}
+	}
+	zr.Close()
+
+	shr, err := backend.Open(backend.Filename(shw))
+	c.Assert(err, check.IsNil)
+	defer shr.Close()
+	c.Check(shr.KeyID, check.Equals, shw.KeyID)
+	c.Check(shr.Conf, check.IsNil)
+
+	// the hashes can be checked without the key
+	c.Check(shr.Check(context.TODO(), nil), check.IsNil)
+	// but the data can't be read
+	_, err = shr.Restore(context.TODO(), snap.R(0), nil, logger.Debugf)
+	c.Check(err, check.ErrorMatches, `snapshot of ".*" is encrypted, and no key was given`)
+	_, err = shr.List(context.TODO(), nil)
+	c.Check(err, check.ErrorMatches, `snapshot of ".*" is encrypted, and no key was given`)
+
+	c.Check(shr.Unlock(nil), check.ErrorMatches, `snapshot of ".*" is encrypted, and no key was given`)
+	c.Check(shr.Unlock(otherKey), check.ErrorMatches, `snapshot of ".*" is encrypted with a different key`)
+	c.Assert(shr.Unlock(testKey), check.IsNil)
+	c.Check(shr.Conf, check.DeepEquals, cfg)
+	c.Check(shr.Check(context.TODO(), nil), check.IsNil)
+
+	files, err := shr.List(context.TODO(), nil)
+	c.Assert(err, check.IsNil)
+	c.Check(regularFiles(files), check.DeepEquals, []string{":42/foo", ":common/bar", "snapuser:42/ufoo", "snapuser:common/ubar"})
+
+	newroot := c.MkDir()
+	c.Assert(os.MkdirAll(filepath.Join(newroot, "home/snapuser"), 0755), check.IsNil)
+	dirs.SetRootDir(newroot)
+	rs, err := shr.Restore(context.TODO(), snap.R(0), nil, logger.Debugf)
+	c.Assert(err, check.IsNil)
+	rs.Cleanup()
+	c.Check(exec.Command("diff", "-urN", "-x*.zip", s.root, newroot).Run(), check.IsNil)
+}
+
+func (s *snapshotSuite) TestEncryptedIncremental(c *check.C) {
+	if os.Geteuid() == 0 {
+		c.Skip("this test cannot run as root (runuser will fail)")
+	}
+	logger.SimpleSetup()
+
+	info := &snap.Info{SideInfo: snap.SideInfo{RealName: "hello-snap", Revision: snap.R(42), SnapID: "hello-id"}, Version: "v1.33"}
+	_, err := backend.Save(context.TODO(), 12, info, nil, []string{"snapuser"}, &backend.Flags{EncryptionKey: testKey})
+	c.Assert(err, check.IsNil)
+
+	// using an encrypted snapshot as base needs its key
+	_, err = backend.Save(context.TODO(), 13, info, nil, []string{"snapuser"}, &backend.Flags{BaseSetID: 12})
+	c.Check(err, check.ErrorMatches, `cannot use base snapshot ".*/12_hello-snap_v1.33_42.zip": snapshot .* is encrypted, and no key was given`)
+	_, err = backend.Save(context.TODO(), 13, info, nil, []string{"snapuser"}, &backend.Flags{BaseSetID: 12, EncryptionKey: otherKey})
+	c.Check(err, check.ErrorMatches, `cannot use base snapshot ".*": snapshot .* is encrypted with a different key`)
+
+	c.Assert(ioutil.WriteFile(filepath.Join(info.DataDir(), "new"), []byte("new system canary\n"), 0644), check.IsNil)
+	shw, err := backend.Save(context.TODO(), 13, info, nil, []string{"snapuser"}, &backend.Flags{BaseSetID: 12, EncryptionKey: testKey})
+	c.Assert(err, check.IsNil)
+	c.Check(shw.BaseSetID, check.Equals, uint64(12))
+
+	shr, err := backend.Open(backend.Filename(shw))
+	c.Assert(err, check.IsNil)
+	defer shr.Close()
+	c.Assert(shr.Unlock(testKey), check.IsNil)
+	c.Check(shr.Check(context.TODO(), nil), check.IsNil)
+	files, err := shr.List(context.TODO(), []string{"nobody-else"})
+	c.Assert(err, check.IsNil)
+	c.Check(regularFiles(files), check.DeepEquals, []string{":42/foo", ":42/new", ":common/bar"})
+}
+
+func (s *snapshotSuite) TestSaveBadKey(c *check.C) {
+	info := &snap.Info{SideInfo: snap.SideInfo{RealName: "hello-snap", Revision: snap.R(42)}, Version: "v1.33"}
+	_, err := backend.Save(context.TODO(), 12, info, nil, nil, &backend.Flags{EncryptionKey: []byte("short")})
+	c.Check(err, check.ErrorMatches, fmt.Sprintf("invalid snapshot encryption key: must be %d bytes", backend.KeySize))
+}
@@ -0,0 +1,445 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package backend
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"context"
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/snap"
+)
+
+const (
+	// the manifest is the last member of an export
+	exportManifestName = "export.json"
+	exportFormat       = 1
+	// way more than enough for a manifest of any sane snapshot set
+	maxExportManifestSize = 1024 * 1024
+)
+
+// exportManifest describes the snapshots in an exported snapshot set.
+type exportManifest struct {
+	Format    int                          `json:"format"`
+	SetID     uint64                       `json:"set-id"`
+	Snapshots map[string]*exportedSnapshot `json:"snapshots"`
+}
+
+type exportedSnapshot struct {
+	Size     int64  `json:"size"`
+	SHA3_384 string `json:"sha3-384"`
+}
+
+// An InvalidExportError is returned by Import when the snapshot export
+// itself is at fault, as opposed to something going wrong while storing
+// it.
+type InvalidExportError struct {
+	Err error
+}
+
+func (e *InvalidExportError) Error() string {
+	return e.Err.Error()
+}
+
+func invalidExportf(format string, args ...interface{}) error {
+	return &InvalidExportError{Err: fmt.Errorf(format, args...)}
+}
+
+// A CannotExportError is returned by NewSnapshotExport when a snapshot
+// of the set cannot be exported as it is, e.g. because it is broken.
+type CannotExportError struct {
+	Err error
+}
+
+func (e *CannotExportError) Error() string {
+	return e.Err.Error()
+}
+
+func cannotExportf(format string, args ...interface{}) error {
+	return &CannotExportError{Err: fmt.Errorf(format, args...)}
+}
+
+// A SnapshotExport is a snapshot set that's been opened for exporting.
+type SnapshotExport struct {
+	setID uint64
+	files []*os.File
+}
+
+// NewSnapshotExport opens the snapshots of the given set for
+// exporting. Opening them upfront means a concurrent forget cannot
+// yank them from under an export.
+//
+// If the returned error is nil, the caller must call Close when done.
+func NewSnapshotExport(ctx context.Context, setID uint64) (se *SnapshotExport, err error) {
+	var filenames []string
+	err = Iter(ctx, func(reader *Reader) error {
+		if reader.SetID != setID {
+			return nil
+		}
+		if reader.Broken != "" {
+			return cannotExportf("cannot export snapshot %q: %s", reader.Name(), reader.Broken)
+		}
+		if reader.BaseSetID != 0 {
+			// the snapshots it builds on would need to go along
+			return cannotExportf("cannot export snapshot %q: it is incremental on snapshot set #%d", reader.Name(), reader.BaseSetID)
+		}
+		filenames = append(filenames, reader.Name())
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(filenames) == 0 {
+		return nil, client.ErrSnapshotSetNotFound
+	}
+	sort.Strings(filenames)
+
+	se = &SnapshotExport{setID: setID}
+	defer func() {
+		if err != nil {
+			se.Close()
+		}
+	}()
+	for _, fn := range filenames {
+		f, err := os.Open(fn)
+		if err != nil {
+			return nil, err
+		}
+		se.files = append(se.files, f)
+	}
+
+	return se, nil
+}
+
+// Close the snapshots held by the export.
+func (se *SnapshotExport) Close() error {
+	var firstErr error
+	for _, f := range se.files {
+		if err := f.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	se.files = nil
+	return firstErr
+}
+
+// StreamTo writes the exported snapshot set to the given writer, as a
+// tar archive of the snapshot files followed by a manifest with their
+// sizes and hashes.
+func (se *SnapshotExport) StreamTo(ctx context.Context, w io.Writer) error {
+	tw := tar.NewWriter(w)
+	manifest := exportManifest{
+		Format:    exportFormat,
+		SetID:     se.setID,
+		Snapshots: make(map[string]*exportedSnapshot, len(se.files)),
+	}
+
+	hasher := crypto.SHA3_384.New()
+	for _, f := range se.files {
+		fi, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		if _, err := f.Seek(0, 0); err != nil {
+			return err
+		}
+		name := filepath.Base(f.Name())
+		hdr := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Mode:     0600,
+			Size:     fi.Size(),
+			ModTime:  fi.ModTime(),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		sz, err := io.Copy(io.MultiWriter(osutil.ContextWriter(ctx), tw, hasher), f)
+		if err != nil {
+			return err
+		}
+		manifest.Snapshots[name] = &exportedSnapshot{
+			Size:     sz,
+			SHA3_384: fmt.Sprintf("%x", hasher.Sum(nil)),
+		}
+		hasher.Reset()
+	}
+
+	data, err := json.Marshal(&manifest)
+	if err != nil {
+		return err
+	}
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     exportManifestName,
+		Mode:     0600,
+		Size:     int64(len(data)),
+		ModTime:  time.Now(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
+
+// Import a snapshot set previously written by SnapshotExport.StreamTo,
+// storing it as the snapshot set with the given ID. The hashes of the
+// snapshot files and of all their archives are checked before
+// anything is added to the snapshots directory; if the export does not
+// pass these checks the error is an *InvalidExportError.
+func Import(ctx context.Context, id uint64, r io.Reader) (snapNames []string, err error) {
+	if err := os.MkdirAll(dirs.SnapshotsDir, 0700); err != nil {
+		return nil, err
+	}
+	// the leading dot has Iter skip the directory
+	tempdir, err := ioutil.TempDir(dirs.SnapshotsDir, ".import-")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := os.RemoveAll(tempdir); err != nil {
+			logger.Noticef("Cannot clean up temporary directory %q: %v.", tempdir, err)
+		}
+	}()
+
+	received, manifest, err := receiveExport(ctx, tempdir, r)
+	if err != nil {
+		return nil, err
+	}
+	if manifest == nil {
+		return nil, invalidExportf("cannot import snapshot set: missing %s", exportManifestName)
+	}
+	if manifest.Format != exportFormat {
+		return nil, invalidExportf("cannot import snapshot set: unsupported export format %d", manifest.Format)
+	}
+	if len(received) != len(manifest.Snapshots) {
+		return nil, invalidExportf("cannot import snapshot set: manifest lists %d snapshots, got %d", len(manifest.Snapshots), len(received))
+	}
+	names := make([]string, 0, len(received))
+	for name, actual := range received {
+		expected := manifest.Snapshots[name]
+		if expected == nil {
+			return nil, invalidExportf("cannot import snapshot set: %q not in manifest", name)
+		}
+		if actual.Size != expected.Size {
+			return nil, invalidExportf("cannot import snapshot set: %q size (%d) different from expected (%d)", name, actual.Size, expected.Size)
+		}
+		if actual.SHA3_384 != expected.SHA3_384 {
+			return nil, invalidExportf("cannot import snapshot set: %q hash (%.7s…) does not match expected (%.7s…)", name, actual.SHA3_384, expected.SHA3_384)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var created []string
+	defer func() {
+		if err == nil {
+			return
+		}
+		for _, fn := range created {
+			if e := os.Remove(fn); e != nil && !os.IsNotExist(e) {
+				logger.Noticef("Cannot remove partially imported snapshot %q: %v.", fn, e)
+			}
+		}
+	}()
+
+	snapNames = make([]string, 0, len(names))
+	for _, name := range names {
+		fn, snapName, err := importOne(ctx, filepath.Join(tempdir, name), manifest.SetID, id)
+		if _, ok := err.(*InvalidExportError); ok {
+			return nil, invalidExportf("cannot import snapshot %q: %v", name, err)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot import snapshot %q: %v", name, err)
+		}
+		created = append(created, fn)
+		snapNames = append(snapNames, snapName)
+	}
+
+	return snapNames, nil
+}
+
+// receiveExport unpacks the snapshot files of an export into dir,
+// returning their actual sizes and hashes, and the manifest (if any).
+func receiveExport(ctx context.Context, dir string, r io.Reader) (received map[string]*exportedSnapshot, manifest *exportManifest, err error) {
+	received = make(map[string]*exportedSnapshot)
+	hasher := crypto.SHA3_384.New()
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, invalidExportf("cannot read snapshot export: %v", err)
+		}
+		if manifest != nil {
+			return nil, nil, invalidExportf("cannot import snapshot set: unexpected %q after %s", hdr.Name, exportManifestName)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return nil, nil, invalidExportf("cannot import snapshot set: %q is not a regular file", hdr.Name)
+		}
+
+		if hdr.Name == exportManifestName {
+			if hdr.Size > maxExportManifestSize {
+				return nil, nil, invalidExportf("cannot import snapshot set: %s too big (%d bytes)", exportManifestName, hdr.Size)
+			}
+			manifest = &exportManifest{}
+			if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+				return nil, nil, invalidExportf("cannot decode %s: %v", exportManifestName, err)
+			}
+			continue
+		}
+
+		name := hdr.Name
+		if name != filepath.Base(name) || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, ".zip") {
+			return nil, nil, invalidExportf("cannot import snapshot set: unexpected member %q", name)
+		}
+		if received[name] != nil {
+			return nil, nil, invalidExportf("cannot import snapshot set: duplicate member %q", name)
+		}
+
+		f, err := os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return nil, nil, err
+		}
+		sz, err := io.Copy(io.MultiWriter(osutil.ContextWriter(ctx), f, hasher), tr)
+		if e := f.Close(); err == nil {
+			err = e
+		}
+		if err == io.ErrUnexpectedEOF {
+			return nil, nil, invalidExportf("cannot read snapshot export: %v", err)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		received[name] = &exportedSnapshot{
+			Size:     sz,
+			SHA3_384: fmt.Sprintf("%x", hasher.Sum(nil)),
+		}
+		hasher.Reset()
+	}
+
+	return received, manifest, nil
+}
+
+// importOne checks the snapshot in the given file and writes it into
+// the snapshots directory as part of the snapshot set with the given
+// ID, returning the new filename and the snap name.
+func importOne(ctx context.Context, fn string, exportedID, id uint64) (newFn, snapName string, err error) {
+	reader, err := Open(fn)
+	if err != nil {
+		return "", "", invalidExportf("%v", err)
+	}
+	defer reader.Close()
+
+	if reader.SetID != exportedID {
+		return "", "", invalidExportf("snapshot set ID (%d) does not match exported set ID (%d)", reader.SetID, exportedID)
+	}
+	if err := reader.Check(ctx, nil); err != nil {
+		return "", "", invalidExportf("%v", err)
+	}
+
+	snapshot := reader.Snapshot
+	snapshot.SetID = id
+	// the metadata comes from the uploaded archive, and the filename
+	// is built from it
+	if err := snap.ValidateInstanceName(snapshot.Snap); err != nil {
+		return "", "", invalidExportf("%v", err)
+	}
+	if err := snap.ValidateVersion(snapshot.Version); err != nil {
+		return "", "", invalidExportf("%v", err)
+	}
+	if snapshot.Revision.Unset() {
+		return "", "", invalidExportf("invalid snapshot revision: unset")
+	}
+	newFn = Filename(&snapshot)
+	if filepath.Dir(newFn) != dirs.SnapshotsDir {
+		return "", "", fmt.Errorf("internal error: snapshot filename %q is not in %s", newFn, dirs.SnapshotsDir)
+	}
+	if osutil.FileExists(newFn) {
+		return "", "", fmt.Errorf("%q already exists", newFn)
+	}
+
+	aw, err := osutil.NewAtomicFile(newFn, 0600, 0, osutil.NoChown, osutil.NoChown)
+	if err != nil {
+		return "", "", err
+	}
+	// if things worked, we'll commit (and Cancel becomes a NOP)
+	defer aw.Cancel()
+
+	w := zip.NewWriter(aw)
+	defer w.Close() // note this does not close the file descriptor (that's done by hand on the atomic writer, above)
+
+	entries := make([]string, 0, len(snapshot.SHA3_384))
+	for entry := range snapshot.SHA3_384 {
+		entries = append(entries, entry)
+	}
+	sort.Strings(entries)
+	for _, entry := range entries {
+		if err := copyZipMember(ctx, reader.File, entry, w); err != nil {
+			return "", "", err
+		}
+	}
+	if err := addMetaToZip(&snapshot, w); err != nil {
+		return "", "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", "", err
+	}
+	if err := aw.Commit(); err != nil {
+		return "", "", err
+	}
+
+	return newFn, snapshot.Snap, nil
+}
+
+func copyZipMember(ctx context.Context, f *os.File, entry string, w *zip.Writer) error {
+	body, _, err := zipMember(f, entry)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	entryWriter, err := w.CreateHeader(&zip.FileHeader{Name: entry})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(io.MultiWriter(osutil.ContextWriter(ctx), entryWriter), body)
+	return err
+}
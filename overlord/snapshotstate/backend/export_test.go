@@ -28,10 +28,16 @@ import (
 
 var (
 	AddDirToZip     = addDirToZip
+	AddMetaToZip    = addMetaToZip
 	TarAsUser       = tarAsUser
 	PickUserWrapper = pickUserWrapper
+	Encrypter       = encrypter
+	Decrypter       = decrypter
+	KeyID           = keyID
 )
 
+const EncryptionChunkSize = encryptionChunkSize
+
 func MockIsTesting(newIsTesting bool) func() {
 	oldIsTesting := isTesting
 	isTesting = newIsTesting
@@ -0,0 +1,294 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package backend
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/strutil"
+)
+
+// typeGNUDumpDir is the type of the entries GNU tar uses for directories in
+// incremental archives; their contents list the directory's members.
+const typeGNUDumpDir = 'D'
+
+// archivedFile is a file as listed from the archives of a snapshot.
+type archivedFile struct {
+	client.SnapshotFile
+	// the snapshot and archive entry the file's contents are in,
+	// and the file's name in that archive
+	reader *Reader
+	entry  string
+	member string
+}
+
+// listArchive returns the files in the given archive entry, keyed by path,
+// as they would be after unpacking it and the archives it builds on.
+func (r *Reader) listArchive(ctx context.Context, bases []*Reader, entry string) (map[string]*archivedFile, error) {
+	username := ""
+	if isUserArchive(entry) {
+		username = entryUsername(entry)
+	}
+
+	files := make(map[string]*archivedFile)
+	levels, entries := r.archiveChain(bases, entry)
+	for i := len(levels) - 1; i >= 0; i-- {
+		level, levelEntry := levels[i], entries[i]
+		err := level.readArchive(levelEntry, func(archive io.Reader) error {
+			tr := tar.NewReader(archive)
+			for {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				hdr, err := tr.Next()
+				if err == io.EOF {
+					return nil
+				}
+				if err != nil {
+					return fmt.Errorf("cannot read archive: %v", err)
+				}
+				p := path.Clean(hdr.Name)
+				if hdr.Typeflag == typeGNUDumpDir {
+					members, err := ioutil.ReadAll(tr)
+					if err != nil {
+						return fmt.Errorf("cannot read archive: %v", err)
+					}
+					pruneRemoved(files, p, members)
+				}
+				files[p] = &archivedFile{
+					SnapshotFile: client.SnapshotFile{
+						User:    username,
+						Path:    p,
+						Size:    hdr.Size,
+						Mode:    hdr.FileInfo().Mode(),
+						ModTime: hdr.ModTime,
+						Link:    hdr.Linkname,
+						SetID:   level.SetID,
+					},
+					reader: level,
+					entry:  levelEntry,
+					member: hdr.Name,
+				}
+				if hdr.Typeflag == typeGNUDumpDir {
+					files[p].Size = 0
+					files[p].Mode |= os.ModeDir
+				}
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
+
+// pruneRemoved removes from files those in dir that are not in the given
+// GNU tar dumpdir members list, as tar does when unpacking incrementally.
+func pruneRemoved(files map[string]*archivedFile, dir string, members []byte) {
+	present := make(map[string]bool)
+	for _, member := range bytes.Split(members, []byte{0}) {
+		// the first byte says whether the member is in the archive,
+		// and if it's a directory
+		if len(member) > 1 {
+			present[string(member[1:])] = true
+		}
+	}
+
+	for p := range files {
+		if !strings.HasPrefix(p, dir+"/") {
+			continue
+		}
+		rest := p[len(dir)+1:]
+		if i := strings.IndexByte(rest, '/'); i >= 0 {
+			rest = rest[:i]
+		}
+		if !present[rest] {
+			delete(files, p)
+		}
+	}
+}
+
+// archiveEntries returns the archive entries in the snapshot, limited to
+// those of the given users if usernames is not empty (but always including
+// the system one).
+func (r *Reader) archiveEntries(usernames []string) []string {
+	usernames = append([]string(nil), usernames...)
+	sort.Strings(usernames)
+
+	var entries []string
+	for entry := range r.SHA3_384 {
+		if !isArchive(entry) {
+			continue
+		}
+		if len(usernames) > 0 && isUserArchive(entry) && !strutil.SortedListContains(usernames, entryUsername(entry)) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Strings(entries)
+
+	return entries
+}
+
+// List the files in the snapshot, limited to those of the given users if
+// usernames is not empty. For an incremental snapshot, the files are listed
+// as they would be after restoring it.
+func (r *Reader) List(ctx context.Context, usernames []string) ([]client.SnapshotFile, error) {
+	bases, err := r.bases(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer closeAll(bases)
+
+	var list []client.SnapshotFile
+	for _, entry := range r.archiveEntries(usernames) {
+		files, err := r.listArchive(ctx, bases, entry)
+		if err != nil {
+			return nil, err
+		}
+		start := len(list)
+		for _, file := range files {
+			list = append(list, file.SnapshotFile)
+		}
+		sort.Sort(byPath(list[start:]))
+	}
+
+	return list, nil
+}
+
+// ValidatePathPatterns checks that the given patterns can be used with
+// RestoreFiles.
+func ValidatePathPatterns(patterns []string) error {
+	if len(patterns) == 0 {
+		return fmt.Errorf("no path patterns given")
+	}
+	for _, pattern := range patterns {
+		if pattern == "" || path.IsAbs(pattern) {
+			return fmt.Errorf("invalid path pattern %q: must be a relative path", pattern)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid path pattern %q: %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+// matchesAny checks whether p, or any of the directories it is in, matches
+// any of the patterns.
+func matchesAny(patterns []string, p string) bool {
+	for ; p != "." && p != "/"; p = path.Dir(p) {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, p); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RestoreFiles extracts the files in the snapshot that match any of the
+// given patterns into target, without touching the snap's data. System
+// data goes into <target>/<snap>/, and user data into
+// <target>/<snap>/user/<username>/.
+//
+// A pattern matches a path as returned by List; if it matches a
+// directory, everything in it is extracted. RestoreFiles returns the number
+// of files extracted.
+func (r *Reader) RestoreFiles(ctx context.Context, usernames []string, patterns []string, target string, logf Logf) (int, error) {
+	if err := ValidatePathPatterns(patterns); err != nil {
+		return 0, err
+	}
+	if !filepath.IsAbs(target) {
+		return 0, fmt.Errorf("cannot restore files into %q: target must be an absolute path", target)
+	}
+
+	bases, err := r.bases(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer closeAll(bases)
+
+	type source struct {
+		reader *Reader
+		entry  string
+	}
+
+	count := 0
+	for _, entry := range r.archiveEntries(usernames) {
+		files, err := r.listArchive(ctx, bases, entry)
+		if err != nil {
+			return count, err
+		}
+
+		// group what to extract by the archive it's in
+		members := make(map[source][]string)
+		var sources []source
+		for p, file := range files {
+			if file.Mode.IsDir() || !matchesAny(patterns, p) {
+				continue
+			}
+			src := source{reader: file.reader, entry: file.entry}
+			if _, ok := members[src]; !ok {
+				sources = append(sources, src)
+			}
+			members[src] = append(members[src], file.member)
+		}
+		if len(sources) == 0 {
+			continue
+		}
+
+		dest := filepath.Join(target, r.Snap)
+		if isUserArchive(entry) {
+			dest = filepath.Join(dest, "user", entryUsername(entry))
+		}
+		if err := os.MkdirAll(dest, 0700); err != nil {
+			return count, err
+		}
+
+		entryCount := 0
+		for _, src := range sources {
+			sort.Strings(members[src])
+			logger.Debugf("Restoring %d files from %q of %q into %q.", len(members[src]), src.entry, src.reader.Name(), dest)
+			// this is root choosing where to put things, so
+			// it's done as root
+			if err := src.reader.unpack(ctx, src.entry, "root", dest, members[src]...); err != nil {
+				return count, err
+			}
+			entryCount += len(members[src])
+		}
+		count += entryCount
+		logf("Restored %d files from %q into %q.", entryCount, entry, dest)
+	}
+
+	return count, nil
+}
@@ -0,0 +1,202 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package backend_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/overlord/snapshotstate/backend"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/testutil"
+)
+
+// regularFiles returns the user and path of the regular files in the list.
+func regularFiles(files []client.SnapshotFile) []string {
+	var names []string
+	for _, f := range files {
+		if f.Mode.IsRegular() {
+			names = append(names, f.User+":"+f.Path)
+		}
+	}
+	return names
+}
+
+func (s *snapshotSuite) TestListFiles(c *check.C) {
+	if os.Geteuid() == 0 {
+		c.Skip("this test cannot run as root (runuser will fail)")
+	}
+	logger.SimpleSetup()
+
+	info := &snap.Info{SideInfo: snap.SideInfo{RealName: "hello-snap", Revision: snap.R(42), SnapID: "hello-id"}, Version: "v1.33"}
+	shw, err := backend.Save(context.TODO(), 12, info, nil, []string{"snapuser"}, nil)
+	c.Assert(err, check.IsNil)
+
+	shr, err := backend.Open(backend.Filename(shw))
+	c.Assert(err, check.IsNil)
+	defer shr.Close()
+
+	files, err := shr.List(context.TODO(), nil)
+	c.Assert(err, check.IsNil)
+	c.Check(regularFiles(files), check.DeepEquals, []string{
+		":42/foo",
+		":common/bar",
+		"snapuser:42/ufoo",
+		"snapuser:common/ubar",
+	})
+	for _, f := range files {
+		c.Check(f.SetID, check.Equals, uint64(12))
+		if f.Path == "42/foo" {
+			c.Check(f.Size, check.Equals, int64(len("versioned system canary\n")))
+			c.Check(f.Mode.Perm(), check.Equals, os.FileMode(0644))
+		}
+	}
+
+	// limited to the given users (the system data is always there)
+	files, err = shr.List(context.TODO(), []string{"someone-else"})
+	c.Assert(err, check.IsNil)
+	c.Check(regularFiles(files), check.DeepEquals, []string{":42/foo", ":common/bar"})
+}
+
+func (s *snapshotSuite) TestListFilesIncremental(c *check.C) {
+	if os.Geteuid() == 0 {
+		c.Skip("this test cannot run as root (runuser will fail)")
+	}
+	logger.SimpleSetup()
+
+	info := &snap.Info{SideInfo: snap.SideInfo{RealName: "hello-snap", Revision: snap.R(42), SnapID: "hello-id"}, Version: "v1.33"}
+	_, err := backend.Save(context.TODO(), 12, info, nil, []string{"snapuser"}, nil)
+	c.Assert(err, check.IsNil)
+
+	c.Assert(ioutil.WriteFile(filepath.Join(info.DataDir(), "new"), []byte("new system canary\n"), 0644), check.IsNil)
+	c.Assert(os.Remove(filepath.Join(info.CommonDataDir(), "bar")), check.IsNil)
+
+	shw, err := backend.Save(context.TODO(), 13, info, nil, []string{"snapuser"}, &backend.Flags{BaseSetID: 12})
+	c.Assert(err, check.IsNil)
+
+	shr, err := backend.Open(backend.Filename(shw))
+	c.Assert(err, check.IsNil)
+	defer shr.Close()
+
+	files, err := shr.List(context.TODO(), nil)
+	c.Assert(err, check.IsNil)
+	// the removed file is gone, and unchanged files come from the base
+	c.Check(regularFiles(files), check.DeepEquals, []string{
+		":42/foo",
+		":42/new",
+		"snapuser:42/ufoo",
+		"snapuser:common/ubar",
+	})
+	setIDs := make(map[string]uint64)
+	for _, f := range files {
+		setIDs[f.User+":"+f.Path] = f.SetID
+	}
+	c.Check(setIDs[":42/foo"], check.Equals, uint64(12))
+	c.Check(setIDs[":42/new"], check.Equals, uint64(13))
+}
+
+func (s *snapshotSuite) TestRestoreFiles(c *check.C) {
+	if os.Geteuid() == 0 {
+		c.Skip("this test cannot run as root (runuser will fail)")
+	}
+	logger.SimpleSetup()
+
+	info := &snap.Info{SideInfo: snap.SideInfo{RealName: "hello-snap", Revision: snap.R(42), SnapID: "hello-id"}, Version: "v1.33"}
+	_, err := backend.Save(context.TODO(), 12, info, nil, []string{"snapuser"}, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(info.DataDir(), "new"), []byte("new system canary\n"), 0644), check.IsNil)
+	shw, err := backend.Save(context.TODO(), 13, info, nil, []string{"snapuser"}, &backend.Flags{BaseSetID: 12})
+	c.Assert(err, check.IsNil)
+
+	shr, err := backend.Open(backend.Filename(shw))
+	c.Assert(err, check.IsNil)
+	defer shr.Close()
+
+	var logs []string
+	logf := func(format string, args ...interface{}) {
+		logs = append(logs, format)
+	}
+
+	target := c.MkDir()
+	n, err := shr.RestoreFiles(context.TODO(), nil, []string{"42/*"}, target, logf)
+	c.Assert(err, check.IsNil)
+	c.Check(n, check.Equals, 3)
+	c.Check(logs, check.HasLen, 2)
+
+	for fn, content := range map[string]string{
+		"hello-snap/42/foo":                "versioned system canary\n",
+		"hello-snap/42/new":                "new system canary\n",
+		"hello-snap/user/snapuser/42/ufoo": "versioned user canary\n",
+	} {
+		buf, err := ioutil.ReadFile(filepath.Join(target, fn))
+		c.Assert(err, check.IsNil)
+		c.Check(string(buf), check.Equals, content)
+	}
+	c.Check(filepath.Join(target, "hello-snap/common"), testutil.FileAbsent)
+
+	// the snap's data is untouched
+	buf, err := ioutil.ReadFile(filepath.Join(info.DataDir(), "new"))
+	c.Assert(err, check.IsNil)
+	c.Check(string(buf), check.Equals, "new system canary\n")
+
+	// a pattern matching a directory restores all of it
+	target = c.MkDir()
+	n, err = shr.RestoreFiles(context.TODO(), []string{"snapuser"}, []string{"common"}, target, logf)
+	c.Assert(err, check.IsNil)
+	c.Check(n, check.Equals, 2)
+	c.Check(filepath.Join(target, "hello-snap/common/bar"), testutil.FilePresent)
+	c.Check(filepath.Join(target, "hello-snap/user/snapuser/common/ubar"), testutil.FilePresent)
+
+	// nothing matching is not an error
+	n, err = shr.RestoreFiles(context.TODO(), nil, []string{"nope"}, c.MkDir(), logf)
+	c.Assert(err, check.IsNil)
+	c.Check(n, check.Equals, 0)
+}
+
+func (s *snapshotSuite) TestRestoreFilesBadArgs(c *check.C) {
+	makeSnapshotFile(c, 12, "a-snap")
+	shr, err := backend.Open(filepath.Join(dirs.SnapshotsDir, "12_a-snap_v1.0_42.zip"))
+	c.Assert(err, check.IsNil)
+	defer shr.Close()
+
+	for _, t := range []struct {
+		patterns []string
+		target   string
+		err      string
+	}{
+		{nil, "/tmp", `no path patterns given`},
+		{[]string{""}, "/tmp", `invalid path pattern "": must be a relative path`},
+		{[]string{"/42/foo"}, "/tmp", `invalid path pattern "/42/foo": must be a relative path`},
+		{[]string{"42/[foo"}, "/tmp", `invalid path pattern "42/\[foo": syntax error in pattern`},
+		{[]string{"42/foo"}, "tmp", `cannot restore files into "tmp": target must be an absolute path`},
+	} {
+		_, err := shr.RestoreFiles(context.TODO(), nil, t.patterns, t.target, logger.Debugf)
+		c.Check(err, check.ErrorMatches, t.err, check.Commentf("%q", t.patterns))
+	}
+
+	c.Check(backend.ValidatePathPatterns([]string{"42/*", "common/foo"}), check.IsNil)
+}
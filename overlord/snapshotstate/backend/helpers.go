@@ -64,17 +64,61 @@ func zipMember(f *os.File, member string) (r io.ReadCloser, sz int64, err error)
 	return nil, -1, fmt.Errorf("missing archive member %q", member)
 }
 
-func userArchiveName(usr *user.User) string {
-	return filepath.Join(userArchivePrefix, usr.Username+userArchiveSuffix)
+func userArchiveName(usr *user.User, compression string) string {
+	return filepath.Join(userArchivePrefix, usr.Username+compressionSuffixes[compression])
+}
+
+// archiveSuffix returns the suffix of the given entry if it is an archive,
+// or the empty string otherwise.
+func archiveSuffix(entry string) string {
+	ext := filepath.Ext(entry)
+	for _, suffix := range compressionSuffixes {
+		if ext == suffix {
+			return ext
+		}
+	}
+	return ""
+}
+
+func isArchive(entry string) bool {
+	return archiveSuffix(entry) != ""
+}
+
+func isSystemArchive(entry string) bool {
+	return isArchive(entry) && strings.TrimSuffix(entry, filepath.Ext(entry)) == archiveBaseName
 }
 
 func isUserArchive(entry string) bool {
-	return strings.HasPrefix(entry, userArchivePrefix) && strings.HasSuffix(entry, userArchiveSuffix)
+	return strings.HasPrefix(entry, userArchivePrefix) && isArchive(entry)
+}
+
+// isUserEntry checks whether the given entry is either a user archive or
+// its listed-incremental data.
+func isUserEntry(entry string) bool {
+	return strings.HasPrefix(entry, userArchivePrefix) && (isArchive(entry) || filepath.Ext(entry) == incrementalSuffix)
 }
 
 func entryUsername(entry string) string {
-	// this _will_ panic if !isUserArchive(entry)
-	return entry[len(userArchivePrefix) : len(entry)-len(userArchiveSuffix)]
+	// this _will_ panic if !isUserEntry(entry)
+	return entry[len(userArchivePrefix) : len(entry)-len(filepath.Ext(entry))]
+}
+
+// incrementalEntry returns the name of the entry holding the
+// listed-incremental data for the given archive entry.
+func incrementalEntry(entry string) string {
+	return strings.TrimSuffix(entry, filepath.Ext(entry)) + incrementalSuffix
+}
+
+// findArchive returns the archive entry, in whatever compression, that
+// corresponds to the given one.
+func findArchive(entries map[string]string, entry string) (string, bool) {
+	stem := strings.TrimSuffix(entry, filepath.Ext(entry))
+	for _, suffix := range compressionSuffixes {
+		if _, ok := entries[stem+suffix]; ok {
+			return stem + suffix, true
+		}
+	}
+	return "", false
 }
 
 type bySnap []*client.Snapshot
@@ -83,6 +127,12 @@ func (a bySnap) Len() int           { return len(a) }
 func (a bySnap) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 func (a bySnap) Less(i, j int) bool { return a[i].Snap < a[j].Snap }
 
+type byPath []client.SnapshotFile
+
+func (a byPath) Len() int           { return len(a) }
+func (a byPath) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byPath) Less(i, j int) bool { return a[i].Path < a[j].Path }
+
 type byID []client.SnapshotSet
 
 func (a byID) Len() int           { return len(a) }
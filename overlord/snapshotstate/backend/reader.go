@@ -46,6 +46,9 @@ import (
 type Reader struct {
 	*os.File
 	client.Snapshot
+
+	// the key to decrypt the snapshot with, once unlocked
+	key []byte
 }
 
 // Open a Snapshot given its full filename.
@@ -122,7 +125,35 @@ func Open(fn string) (reader *Reader, e error) {
 	return reader, nil
 }
 
-func (r *Reader) checkOne(ctx context.Context, entry string, hasher hash.Hash) error {
+// Unlock makes an encrypted snapshot readable, by giving it the key it is
+// encrypted with, and loads its configuration. Unlocking a snapshot that is
+// not encrypted does nothing.
+func (r *Reader) Unlock(key []byte) error {
+	if r.KeyID == "" {
+		return nil
+	}
+	if key == nil {
+		return fmt.Errorf("snapshot of %q is encrypted, and no key was given", r.Snap)
+	}
+	if keyID(key) != r.KeyID {
+		return fmt.Errorf("snapshot of %q is encrypted with a different key", r.Snap)
+	}
+	r.key = key
+
+	if _, ok := r.SHA3_384[configName]; !ok {
+		return nil
+	}
+	return r.readArchive(configName, func(config io.Reader) error {
+		if err := jsonutil.DecodeWithNumber(config, &r.Conf); err != nil {
+			return fmt.Errorf("cannot decode snapshot configuration: %v", err)
+		}
+		return nil
+	})
+}
+
+// checkOne checks the size and hash of the given entry, copying its
+// contents to dst as it goes.
+func (r *Reader) checkOne(ctx context.Context, entry string, hasher hash.Hash, dst io.Writer) error {
 	body, reportedSize, err := zipMember(r.File, entry)
 	if err != nil {
 		return err
@@ -130,7 +161,7 @@ func (r *Reader) checkOne(ctx context.Context, entry string, hasher hash.Hash) e
 	defer body.Close()
 
 	expectedHash := r.SHA3_384[entry]
-	readSize, err := io.Copy(io.MultiWriter(osutil.ContextWriter(ctx), hasher), body)
+	readSize, err := io.Copy(io.MultiWriter(osutil.ContextWriter(ctx), hasher, dst), body)
 	if err != nil {
 		return err
 	}
@@ -145,13 +176,36 @@ func (r *Reader) checkOne(ctx context.Context, entry string, hasher hash.Hash) e
 	return nil
 }
 
-// Check that the data contained in the snapshot matches its hashsums.
+// Check that the data contained in the snapshot matches its hashsums. If the
+// snapshot is incremental, the snapshots it builds on are checked as well.
+// If the snapshot is encrypted and has been unlocked, its data is also
+// checked to decrypt correctly.
 func (r *Reader) Check(ctx context.Context, usernames []string) error {
 	sort.Strings(usernames)
 
+	if err := r.checkEntries(ctx, usernames); err != nil {
+		return err
+	}
+
+	bases, err := r.bases(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeAll(bases)
+
+	for _, base := range bases {
+		if err := base.checkEntries(ctx, usernames); err != nil {
+			return fmt.Errorf("base snapshot set #%d: %v", base.SetID, err)
+		}
+	}
+
+	return nil
+}
+
+func (r *Reader) checkEntries(ctx context.Context, usernames []string) error {
 	hasher := crypto.SHA3_384.New()
 	for entry := range r.SHA3_384 {
-		if len(usernames) > 0 && isUserArchive(entry) {
+		if len(usernames) > 0 && isUserEntry(entry) {
 			username := entryUsername(entry)
 			if !strutil.SortedListContains(usernames, username) {
 				logger.Debugf("In checking snapshot %q, skipping entry %q by user request.", r.Name(), username)
@@ -159,7 +213,18 @@ func (r *Reader) Check(ctx context.Context, usernames []string) error {
 			}
 		}
 
-		if err := r.checkOne(ctx, entry, hasher); err != nil {
+		if r.key != nil {
+			err := r.readArchive(entry, func(data io.Reader) error {
+				_, err := io.Copy(ioutil.Discard, data)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := r.checkOne(ctx, entry, hasher, ioutil.Discard); err != nil {
 			return err
 		}
 		hasher.Reset()
@@ -168,6 +233,184 @@ func (r *Reader) Check(ctx context.Context, usernames []string) error {
 	return nil
 }
 
+// bases opens the snapshots of the same snap this snapshot is incremental
+// on, newest first, unlocking them with the snapshot's key if it has been
+// unlocked. The caller must close them when done with them.
+func (r *Reader) bases(ctx context.Context) (bases []*Reader, e error) {
+	if r.BaseSetID == 0 {
+		return nil, nil
+	}
+
+	filenames := make(map[uint64]string)
+	err := Iter(ctx, func(sh *Reader) error {
+		if sh.Snap == r.Snap {
+			filenames[sh.SetID] = sh.Name()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if e != nil {
+			closeAll(bases)
+			bases = nil
+		}
+	}()
+
+	seen := map[uint64]bool{r.SetID: true}
+	for setID := r.BaseSetID; setID != 0; {
+		if seen[setID] {
+			return bases, fmt.Errorf("snapshot %q has a loop in its chain of base snapshots", r.Name())
+		}
+		seen[setID] = true
+		fn, ok := filenames[setID]
+		if !ok {
+			return bases, fmt.Errorf("cannot find base snapshot of %q in snapshot set #%d", r.Snap, setID)
+		}
+		base, err := backendOpen(fn)
+		if err != nil {
+			return bases, fmt.Errorf("cannot open base snapshot %q: %v", fn, err)
+		}
+		bases = append(bases, base)
+		if r.key != nil {
+			if err := base.Unlock(r.key); err != nil {
+				return bases, err
+			}
+		}
+		setID = base.BaseSetID
+	}
+
+	return bases, nil
+}
+
+func closeAll(readers []*Reader) {
+	for _, r := range readers {
+		r.Close()
+	}
+}
+
+// archiveChain returns the snapshots, out of the given bases, that the given
+// archive entry builds on, newest first and starting with the reader itself,
+// along with the name of the archive entry in each of them.
+func (r *Reader) archiveChain(bases []*Reader, entry string) (levels []*Reader, entries []string) {
+	levels = []*Reader{r}
+	entries = []string{entry}
+	for _, base := range bases {
+		// an archive only builds on the base's archive if the
+		// base had listed-incremental data for it
+		if _, ok := base.SHA3_384[incrementalEntry(entry)]; !ok {
+			break
+		}
+		baseEntry, ok := findArchive(base.SHA3_384, entry)
+		if !ok {
+			break
+		}
+		levels = append(levels, base)
+		entries = append(entries, baseEntry)
+	}
+	return levels, entries
+}
+
+// readArchive calls f with the decrypted and decompressed contents of the
+// given archive entry, and then checks the entry's size and hash.
+func (r *Reader) readArchive(entry string, f func(archive io.Reader) error) error {
+	body, expectedSize, err := zipMember(r.File, entry)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	expectedHash := r.SHA3_384[entry]
+
+	var sz sizer
+	hasher := crypto.SHA3_384.New()
+	tr := io.TeeReader(body, io.MultiWriter(hasher, &sz))
+	var data io.Reader = tr
+	if r.KeyID != "" {
+		if r.key == nil {
+			return fmt.Errorf("snapshot of %q is encrypted, and no key was given", r.Snap)
+		}
+		data, err = decrypter(r.key, tr)
+		if err != nil {
+			return err
+		}
+	}
+	archive, err := decompressor(entry, data)
+	if err != nil {
+		return fmt.Errorf("cannot unpack archive: %v", err)
+	}
+
+	if err := f(archive); err != nil {
+		return err
+	}
+
+	// the archive can end before the entry does
+	if _, err := io.Copy(ioutil.Discard, tr); err != nil {
+		return err
+	}
+
+	if sz.size != expectedSize {
+		return fmt.Errorf("snapshot %q entry %q expected size (%d) does not match actual (%d)",
+			r.Name(), entry, expectedSize, sz.size)
+	}
+
+	if actualHash := fmt.Sprintf("%x", hasher.Sum(nil)); actualHash != expectedHash {
+		return fmt.Errorf("snapshot %q entry %q expected hash (%.7s…) does not match actual (%.7s…)",
+			r.Name(), entry, expectedHash, actualHash)
+	}
+
+	return nil
+}
+
+// unpack extracts the given archive entry into dir, as the given user,
+// checking the entry's size and hash as it goes. If members are given,
+// only those are extracted.
+func (r *Reader) unpack(ctx context.Context, entry, username, dir string, members ...string) error {
+	// resist the temptation of using archive/tar unless it's proven
+	// that calling out to tar has issues -- there are a lot of
+	// special cases we'd need to consider otherwise
+	tarArgs := []string{
+		"--extract",
+		"--preserve-permissions",
+		"--directory", dir,
+	}
+	if _, ok := r.SHA3_384[incrementalEntry(entry)]; ok && len(members) == 0 {
+		// this makes tar also remove what was removed since the
+		// archive's base (and it can't be used with --preserve-order)
+		tarArgs = append(tarArgs, "--listed-incremental=/dev/null")
+	} else {
+		tarArgs = append(tarArgs, "--preserve-order")
+	}
+	if len(members) > 0 {
+		tarArgs = append(tarArgs, "--")
+		tarArgs = append(tarArgs, members...)
+	}
+
+	return r.readArchive(entry, func(archive io.Reader) error {
+		cmd := tarAsUser(username, tarArgs...)
+		cmd.Env = []string{}
+		cmd.Stdin = archive
+		matchCounter := &strutil.MatchCounter{N: 1}
+		cmd.Stderr = matchCounter
+		cmd.Stdout = os.Stderr
+		if isTesting {
+			matchCounter.N = -1
+			cmd.Stderr = io.MultiWriter(os.Stderr, matchCounter)
+		}
+
+		if err := osutil.RunWithContext(ctx, cmd); err != nil {
+			matches, count := matchCounter.Matches()
+			if count > 0 {
+				return fmt.Errorf("cannot unpack archive: %s (and %d more)", matches[0], count-1)
+			}
+			return fmt.Errorf("tar failed: %v", err)
+		}
+		return nil
+	})
+}
+
 // Logf is the type implemented by logging functions.
 type Logf func(format string, args ...interface{})
 
@@ -189,8 +432,12 @@ func (r *Reader) Restore(ctx context.Context, current snap.Revision, usernames [
 	sort.Strings(usernames)
 	isRoot := sys.Geteuid() == 0
 	si := snap.MinimalPlaceInfo(r.Snap, r.Revision)
-	hasher := crypto.SHA3_384.New()
-	var sz sizer
+
+	bases, err := r.bases(ctx)
+	if err != nil {
+		return rs, err
+	}
+	defer closeAll(bases)
 
 	var curdir string
 	if !current.Unset() {
@@ -202,6 +449,15 @@ func (r *Reader) Restore(ctx context.Context, current snap.Revision, usernames [
 			return rs, err
 		}
 
+		if filepath.Ext(entry) == incrementalSuffix {
+			// only needed when saving incremental snapshots
+			continue
+		}
+		if entry == configName {
+			// restored by the caller, from Conf
+			continue
+		}
+
 		var dest string
 		isUser := isUserArchive(entry)
 		username := "root"
@@ -209,7 +465,7 @@ func (r *Reader) Restore(ctx context.Context, current snap.Revision, usernames [
 		gid := sys.GroupID(osutil.NoChown)
 
 		if !isUser {
-			if entry != archiveName {
+			if !isSystemArchive(entry) {
 				// hmmm
 				logf("Skipping restore of unknown entry %q.", entry)
 				continue
@@ -288,50 +544,14 @@ func (r *Reader) Restore(ctx context.Context, current snap.Revision, usernames [
 			}
 		}()
 
-		logger.Debugf("Restoring %q from %q into %q.", entry, r.Name(), tempdir)
-
-		body, expectedSize, err := zipMember(r.File, entry)
-		if err != nil {
-			return rs, err
-		}
-
-		expectedHash := r.SHA3_384[entry]
-
-		tr := io.TeeReader(body, io.MultiWriter(hasher, &sz))
-
-		// resist the temptation of using archive/tar unless it's proven
-		// that calling out to tar has issues -- there are a lot of
-		// special cases we'd need to consider otherwise
-		cmd := tarAsUser(username,
-			"--extract",
-			"--preserve-permissions", "--preserve-order", "--gunzip",
-			"--directory", tempdir)
-		cmd.Env = []string{}
-		cmd.Stdin = tr
-		matchCounter := &strutil.MatchCounter{N: 1}
-		cmd.Stderr = matchCounter
-		cmd.Stdout = os.Stderr
-		if isTesting {
-			matchCounter.N = -1
-			cmd.Stderr = io.MultiWriter(os.Stderr, matchCounter)
-		}
-
-		if err = osutil.RunWithContext(ctx, cmd); err != nil {
-			matches, count := matchCounter.Matches()
-			if count > 0 {
-				return rs, fmt.Errorf("cannot unpack archive: %s (and %d more)", matches[0], count-1)
+		// an incremental archive needs all the archives it builds
+		// on unpacked before it, oldest first
+		levels, entries := r.archiveChain(bases, entry)
+		for i := len(levels) - 1; i >= 0; i-- {
+			logger.Debugf("Restoring %q from %q into %q.", entries[i], levels[i].Name(), tempdir)
+			if err := levels[i].unpack(ctx, entries[i], username, tempdir); err != nil {
+				return rs, err
 			}
-			return rs, fmt.Errorf("tar failed: %v", err)
-		}
-
-		if sz.size != expectedSize {
-			return rs, fmt.Errorf("snapshot %q entry %q expected size (%d) does not match actual (%d)",
-				r.Name(), entry, expectedSize, sz.size)
-		}
-
-		if actualHash := fmt.Sprintf("%x", hasher.Sum(nil)); actualHash != expectedHash {
-			return rs, fmt.Errorf("snapshot %q entry %q expected hash (%.7s…) does not match actual (%.7s…)",
-				r.Name(), entry, expectedHash, actualHash)
 		}
 
 		if curdir != "" && curdir != revdir {
@@ -368,9 +588,6 @@ func (r *Reader) Restore(ctx context.Context, current snap.Revision, usernames [
 			}
 			rs.Created = append(rs.Created, target)
 		}
-
-		sz.Reset()
-		hasher.Reset()
 	}
 
 	return rs, nil
@@ -22,6 +22,8 @@ package snapshotstate
 import (
 	"context"
 	"encoding/json"
+	"io"
+	"time"
 
 	"github.com/snapcore/snapd/client"
 	"github.com/snapcore/snapd/overlord/snapshotstate/backend"
@@ -41,6 +43,7 @@ var (
 	UndoRestore                = undoRestore
 	CleanupRestore             = cleanupRestore
 	DoCheck                    = doCheck
+	DoRestoreFiles             = doRestoreFiles
 	DoForget                   = doForget
 )
 
@@ -57,6 +60,14 @@ func (summaries snapshotSnapSummaries) AsMaps() []map[string]string {
 	return out
 }
 
+func MockTimeNow(f func() time.Time) (restore func()) {
+	old := timeNow
+	timeNow = f
+	return func() {
+		timeNow = old
+	}
+}
+
 func MockOsRemove(f func(string) error) (restore func()) {
 	old := osRemove
 	osRemove = f
@@ -97,6 +108,22 @@ func MockBackendIter(f func(context.Context, func(*backend.Reader) error) error)
 	}
 }
 
+func MockBackendNewSnapshotExport(f func(context.Context, uint64) (*backend.SnapshotExport, error)) (restore func()) {
+	old := backendNewSnapshotExport
+	backendNewSnapshotExport = f
+	return func() {
+		backendNewSnapshotExport = old
+	}
+}
+
+func MockBackendImport(f func(context.Context, uint64, io.Reader) ([]string, error)) (restore func()) {
+	old := backendImport
+	backendImport = f
+	return func() {
+		backendImport = old
+	}
+}
+
 func MockBackendSave(f func(context.Context, uint64, *snap.Info, map[string]interface{}, []string, *backend.Flags) (*client.Snapshot, error)) (restore func()) {
 	old := backendSave
 	backendSave = f
@@ -129,6 +156,22 @@ func MockBackendCheck(f func(*backend.Reader, context.Context, []string) error)
 	}
 }
 
+func MockBackendList(f func(*backend.Reader, context.Context, []string) ([]client.SnapshotFile, error)) (restore func()) {
+	old := backendList
+	backendList = f
+	return func() {
+		backendList = old
+	}
+}
+
+func MockBackendRestoreFiles(f func(*backend.Reader, context.Context, []string, []string, string, backend.Logf) (int, error)) (restore func()) {
+	old := backendRestoreFiles
+	backendRestoreFiles = f
+	return func() {
+		backendRestoreFiles = old
+	}
+}
+
 func MockBackendRevert(f func(*backend.RestoreState)) (restore func()) {
 	old := backendRevert
 	backendRevert = f
@@ -160,3 +203,11 @@ func MockConfigSetSnapConfig(f func(*state.State, string, *json.RawMessage) erro
 		configSetSnapConfig = old
 	}
 }
+
+func MockBackendReadKeyFile(f func(string) ([]byte, error)) (restore func()) {
+	old := backendReadKeyFile
+	backendReadKeyFile = f
+	return func() {
+		backendReadKeyFile = old
+	}
+}
@@ -20,9 +20,11 @@
 package snapshotstate
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
+	"time"
 
 	"gopkg.in/tomb.v2"
 
@@ -33,10 +35,12 @@ import (
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/strutil"
 )
 
 var (
 	osRemove             = os.Remove
+	timeNow              = time.Now
 	snapstateCurrentInfo = snapstate.CurrentInfo
 	configGetSnapConfig  = config.GetSnapConfig
 	configSetSnapConfig  = config.SetSnapConfig
@@ -44,12 +48,26 @@ var (
 	backendSave          = backend.Save
 	backendRestore       = (*backend.Reader).Restore // TODO: look into using an interface instead
 	backendCheck         = (*backend.Reader).Check
+	backendList          = (*backend.Reader).List
+	backendRestoreFiles  = (*backend.Reader).RestoreFiles
 	backendRevert        = (*backend.RestoreState).Revert // ditto
 	backendCleanup       = (*backend.RestoreState).Cleanup
+	backendReadKeyFile   = backend.ReadKeyFile
 )
 
+// how often to look for expired automatic snapshots
+const forgetExpiredSnapshotsInterval = 24 * time.Hour
+
+func init() {
+	snapstate.AutomaticSnapshot = AutomaticSnapshot
+}
+
 // SnapshotManager takes snapshots of active snaps
-type SnapshotManager struct{}
+type SnapshotManager struct {
+	state *state.State
+
+	lastForgetExpiredSnapshotTime time.Time
+}
 
 // Manager returns a new SnapshotManager
 func Manager(st *state.State, runner *state.TaskRunner) *SnapshotManager {
@@ -58,19 +76,85 @@ func Manager(st *state.State, runner *state.TaskRunner) *SnapshotManager {
 	runner.AddHandler("check-snapshot", doCheck, nil)
 	runner.AddHandler("restore-snapshot", doRestore, undoRestore)
 	runner.AddCleanup("restore-snapshot", cleanupRestore)
+	runner.AddHandler("restore-snapshot-files", doRestoreFiles, nil)
 
-	manager := &SnapshotManager{}
+	manager := &SnapshotManager{state: st}
 	snapstate.AddAffectedSnapsByAttr("snapshot-setup", manager.affectedSnaps)
 
 	return manager
 }
 
 // Ensure is part of the overlord.StateManager interface.
-func (SnapshotManager) Ensure() error { return nil }
+func (mgr *SnapshotManager) Ensure() error {
+	now := timeNow()
+	if now.Before(mgr.lastForgetExpiredSnapshotTime.Add(forgetExpiredSnapshotsInterval)) {
+		return nil
+	}
+	if err := mgr.forgetExpiredSnapshots(now); err != nil {
+		return err
+	}
+	mgr.lastForgetExpiredSnapshotTime = now
+	return nil
+}
+
+// forgetExpiredSnapshots removes the automatic snapshots that are
+// older than the snapshots.automatic.retention core setting.
+func (mgr *SnapshotManager) forgetExpiredSnapshots(now time.Time) error {
+	mgr.state.Lock()
+	retention, err := AutomaticSnapshotExpiration(mgr.state)
+	mgr.state.Unlock()
+	if err != nil {
+		return err
+	}
+	if retention == 0 {
+		// automatic snapshots are disabled; leave existing ones be
+		return nil
+	}
+
+	type expiredSnapshot struct {
+		setID    uint64
+		snap     string
+		filename string
+	}
+	var expired []expiredSnapshot
+	// snapshots other snapshots are incremental on, by set ID and snap
+	bases := make(map[uint64][]string)
+	err = backendIter(context.TODO(), func(r *backend.Reader) error {
+		if r.Auto && r.Broken == "" && r.Time.Add(retention).Before(now) {
+			expired = append(expired, expiredSnapshot{setID: r.SetID, snap: r.Snap, filename: r.Name()})
+		}
+		if r.BaseSetID != 0 {
+			bases[r.BaseSetID] = append(bases[r.BaseSetID], r.Snap)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
 
-func (SnapshotManager) affectedSnaps(t *state.Task) ([]string, error) {
-	if k := t.Kind(); k == "check-snapshot" || k == "forget-snapshot" {
-		// check and forget don't affect snaps
+	mgr.state.Lock()
+	defer mgr.state.Unlock()
+	for _, snapshot := range expired {
+		// don't yank snapshots from under in-progress checks and
+		// restores; they'll be expired on a later pass
+		if err := checkSnapshotTaskConflict(mgr.state, snapshot.setID, "check-snapshot", "restore-snapshot", "restore-snapshot-files", "save-snapshot"); err != nil {
+			continue
+		}
+		// nor from under the snapshots that are incremental on them
+		if strutil.ListContains(bases[snapshot.setID], snapshot.snap) {
+			continue
+		}
+		if err := osRemove(snapshot.filename); err != nil && !os.IsNotExist(err) {
+			logger.Noticef("Cannot remove expired automatic snapshot %q: %v.", snapshot.filename, err)
+		}
+	}
+
+	return nil
+}
+
+func (*SnapshotManager) affectedSnaps(t *state.Task) ([]string, error) {
+	if k := t.Kind(); k == "check-snapshot" || k == "forget-snapshot" || k == "restore-snapshot-files" {
+		// check, forget, and restoring files elsewhere don't affect snaps
 		// (this could also be written k != save && k != restore, but it's safer this way around)
 		return nil, nil
 	}
@@ -89,6 +173,16 @@ type snapshotSetup struct {
 	Filename string        `json:"filename,omitempty"`
 	Current  snap.Revision `json:"current"`
 	Auto     bool          `json:"auto,omitempty"`
+
+	Compression string `json:"compression,omitempty"`
+	BaseSetID   uint64 `json:"base-set-id,omitempty"`
+
+	Paths  []string `json:"paths,omitempty"`
+	Target string   `json:"target,omitempty"`
+
+	// the encryption key itself is only ever kept in memory; this
+	// says whether one was given with the request
+	EncryptionKeyGiven bool `json:"encryption-key-given,omitempty"`
 }
 
 func filename(setID uint64, si *snap.Info) string {
@@ -103,17 +197,29 @@ func filename(setID uint64, si *snap.Info) string {
 
 // prepareSave does all the steps of doSave that require the state lock;
 // it has no real significance beyond making the lock handling simpler
-func prepareSave(task *state.Task) (snapshot *snapshotSetup, cur *snap.Info, cfg map[string]interface{}, err error) {
+func prepareSave(task *state.Task) (snapshot *snapshotSetup, cur *snap.Info, cfg map[string]interface{}, key []byte, err error) {
 	st := task.State()
 	st.Lock()
 	defer st.Unlock()
 
 	if err := task.Get("snapshot-setup", &snapshot); err != nil {
-		return nil, nil, nil, taskGetErrMsg(task, err, "snapshot")
+		return nil, nil, nil, nil, taskGetErrMsg(task, err, "snapshot")
+	}
+	if snapshot.Auto && snapshot.SetID == 0 {
+		// automatic snapshots get their set ID when taken, see
+		// AutomaticSnapshot
+		snapshot.SetID, err = newSnapshotSetID(st)
+		if err != nil {
+			return nil, nil, nil, nil, err
+		}
+	}
+	key, err = encryptionKey(task, snapshot)
+	if err != nil {
+		return nil, nil, nil, nil, err
 	}
 	cur, err = snapstateCurrentInfo(st, snapshot.Snap)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, nil, nil, nil, err
 	}
 	// updating snapshot-setup with the filename, for use in undo
 	snapshot.Filename = filename(snapshot.SetID, cur)
@@ -121,26 +227,47 @@ func prepareSave(task *state.Task) (snapshot *snapshotSetup, cur *snap.Info, cfg
 
 	rawCfg, err := configGetSnapConfig(st, snapshot.Snap)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, nil, nil, nil, err
 	}
 	if rawCfg != nil {
 		if err := json.Unmarshal(*rawCfg, &cfg); err != nil {
-			return nil, nil, nil, err
+			return nil, nil, nil, nil, err
 		}
 	}
 
-	return snapshot, cur, cfg, nil
+	return snapshot, cur, cfg, key, nil
 }
 
 func doSave(task *state.Task, tomb *tomb.Tomb) error {
-	snapshot, cur, cfg, err := prepareSave(task)
+	defer forgetEncryptionKey(task)
+
+	snapshot, cur, cfg, key, err := prepareSave(task)
 	if err != nil {
 		return err
 	}
-	_, err = backendSave(tomb.Context(nil), snapshot.SetID, cur, cfg, snapshot.Users, &backend.Flags{Auto: snapshot.Auto})
+	_, err = backendSave(tomb.Context(nil), snapshot.SetID, cur, cfg, snapshot.Users, &backend.Flags{
+		Auto:          snapshot.Auto,
+		Compression:   snapshot.Compression,
+		BaseSetID:     snapshot.BaseSetID,
+		EncryptionKey: key,
+	})
 	return err
 }
 
+// unlock makes the reader use the key the task should use, if the
+// snapshot is encrypted.
+// Note that the state must be locked by the caller.
+func unlock(task *state.Task, snapshot *snapshotSetup, reader *backend.Reader) error {
+	if reader.KeyID == "" {
+		return nil
+	}
+	key, err := encryptionKey(task, snapshot)
+	if err != nil {
+		return err
+	}
+	return reader.Unlock(key)
+}
+
 // prepareRestore does the steps of doRestore that require the state lock
 // before the backend Restore call.
 func prepareRestore(task *state.Task) (snapshot *snapshotSetup, oldCfg map[string]interface{}, reader *backend.Reader, err error) {
@@ -168,12 +295,18 @@ func prepareRestore(task *state.Task) (snapshot *snapshotSetup, oldCfg map[strin
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("cannot open snapshot: %v", err)
 	}
+	if err := unlock(task, snapshot, reader); err != nil {
+		reader.Close()
+		return nil, nil, nil, err
+	}
 	// note given the Open succeeded, caller needs to close it when done
 
 	return snapshot, oldCfg, reader, nil
 }
 
 func doRestore(task *state.Task, tomb *tomb.Tomb) error {
+	defer forgetEncryptionKey(task)
+
 	snapshot, oldCfg, reader, err := prepareRestore(task)
 	if err != nil {
 		return err
@@ -269,6 +402,8 @@ func cleanupRestore(task *state.Task, _ *tomb.Tomb) error {
 }
 
 func doCheck(task *state.Task, tomb *tomb.Tomb) error {
+	defer forgetEncryptionKey(task)
+
 	var snapshot snapshotSetup
 
 	st := task.State()
@@ -285,9 +420,59 @@ func doCheck(task *state.Task, tomb *tomb.Tomb) error {
 	}
 	defer reader.Close()
 
+	st.Lock()
+	err = unlock(task, &snapshot, reader)
+	st.Unlock()
+	if err != nil {
+		return err
+	}
+
 	return backendCheck(reader, tomb.Context(nil), snapshot.Users)
 }
 
+func doRestoreFiles(task *state.Task, tomb *tomb.Tomb) error {
+	defer forgetEncryptionKey(task)
+
+	var snapshot snapshotSetup
+
+	st := task.State()
+	st.Lock()
+	err := task.Get("snapshot-setup", &snapshot)
+	st.Unlock()
+	if err != nil {
+		return taskGetErrMsg(task, err, "snapshot")
+	}
+
+	reader, err := backendOpen(snapshot.Filename)
+	if err != nil {
+		return fmt.Errorf("cannot open snapshot: %v", err)
+	}
+	defer reader.Close()
+
+	st.Lock()
+	err = unlock(task, &snapshot, reader)
+	st.Unlock()
+	if err != nil {
+		return err
+	}
+
+	logf := func(format string, args ...interface{}) {
+		st.Lock()
+		defer st.Unlock()
+		task.Logf(format, args...)
+	}
+
+	n, err := backendRestoreFiles(reader, tomb.Context(nil), snapshot.Users, snapshot.Paths, snapshot.Target, logf)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		logf("No files in the snapshot of %q matched the given paths.", snapshot.Snap)
+	}
+
+	return nil
+}
+
 func doForget(task *state.Task, _ *tomb.Tomb) error {
 	// note this is also undoSave
 	st := task.State()
@@ -23,16 +23,21 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"os"
 	"path/filepath"
 	"sort"
+	"time"
 
 	"gopkg.in/check.v1"
 	"gopkg.in/tomb.v2"
 
 	"github.com/snapcore/snapd/client"
 	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/configstate/config"
 	"github.com/snapcore/snapd/overlord/snapshotstate"
 	"github.com/snapcore/snapd/overlord/snapshotstate/backend"
+	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/snap"
 )
@@ -50,6 +55,7 @@ func (snapshotSuite) TestManager(c *check.C) {
 		"check-snapshot",
 		"forget-snapshot",
 		"restore-snapshot",
+		"restore-snapshot-files",
 		"save-snapshot",
 	})
 }
@@ -106,6 +112,110 @@ func (snapshotSuite) TestDoSave(c *check.C) {
 	c.Assert(err, check.IsNil)
 }
 
+func (snapshotSuite) TestDoSaveIncremental(c *check.C) {
+	defer snapshotstate.MockSnapstateCurrentInfo(func(_ *state.State, snapname string) (*snap.Info, error) {
+		return &snap.Info{SideInfo: snap.SideInfo{RealName: "a-snap", Revision: snap.R(-1)}, Version: "1.33"}, nil
+	})()
+	defer snapshotstate.MockConfigGetSnapConfig(func(*state.State, string) (*json.RawMessage, error) {
+		return nil, nil
+	})()
+	defer snapshotstate.MockBackendSave(func(_ context.Context, id uint64, si *snap.Info, cfg map[string]interface{}, usernames []string, flags *backend.Flags) (*client.Snapshot, error) {
+		c.Check(id, check.Equals, uint64(42))
+		c.Check(flags, check.DeepEquals, &backend.Flags{Compression: "none", BaseSetID: 41})
+		return nil, nil
+	})()
+
+	st := state.New(nil)
+	st.Lock()
+	task := st.NewTask("save-snapshot", "...")
+	task.Set("snapshot-setup", map[string]interface{}{
+		"set-id":      42,
+		"snap":        "a-snap",
+		"compression": "none",
+		"base-set-id": 41,
+	})
+	st.Unlock()
+	err := snapshotstate.DoSave(task, &tomb.Tomb{})
+	c.Assert(err, check.IsNil)
+}
+
+func (snapshotSuite) TestDoSaveEncrypted(c *check.C) {
+	key := make([]byte, backend.KeySize)
+	defer snapshotstate.MockSnapstateCurrentInfo(func(_ *state.State, snapname string) (*snap.Info, error) {
+		return &snap.Info{SideInfo: snap.SideInfo{RealName: "a-snap", Revision: snap.R(-1)}, Version: "1.33"}, nil
+	})()
+	defer snapshotstate.MockConfigGetSnapConfig(func(*state.State, string) (*json.RawMessage, error) {
+		return nil, nil
+	})()
+	defer snapshotstate.MockBackendReadKeyFile(func(string) ([]byte, error) {
+		c.Fatal("unexpected call to backend.ReadKeyFile")
+		return nil, nil
+	})()
+	defer snapshotstate.MockBackendSave(func(_ context.Context, id uint64, si *snap.Info, cfg map[string]interface{}, usernames []string, flags *backend.Flags) (*client.Snapshot, error) {
+		c.Check(flags.EncryptionKey, check.DeepEquals, key)
+		return nil, nil
+	})()
+
+	st := state.New(nil)
+	st.Lock()
+	// the key given wins over the key file
+	tr := config.NewTransaction(st)
+	tr.Set("core", "snapshots.encryption-key-file", "/some/key")
+	tr.Commit()
+	task := st.NewTask("save-snapshot", "...")
+	task.Set("snapshot-setup", map[string]interface{}{
+		"set-id": 42,
+		"snap":   "a-snap",
+	})
+	snapshotstate.UseEncryptionKey(st, state.NewTaskSet(task), key)
+	st.Unlock()
+	err := snapshotstate.DoSave(task, &tomb.Tomb{})
+	c.Assert(err, check.IsNil)
+
+	// the key is only kept around for as long as it's needed
+	err = snapshotstate.DoSave(task, &tomb.Tomb{})
+	c.Assert(err, check.ErrorMatches, `cannot use snapshot "a-snap": the encryption key given is no longer available`)
+}
+
+func (snapshotSuite) TestDoSaveEncryptionKeyFile(c *check.C) {
+	key := make([]byte, backend.KeySize)
+	defer snapshotstate.MockSnapstateCurrentInfo(func(_ *state.State, snapname string) (*snap.Info, error) {
+		return &snap.Info{SideInfo: snap.SideInfo{RealName: "a-snap", Revision: snap.R(-1)}, Version: "1.33"}, nil
+	})()
+	defer snapshotstate.MockConfigGetSnapConfig(func(*state.State, string) (*json.RawMessage, error) {
+		return nil, nil
+	})()
+	keyErr := errors.New("bzzt")
+	defer snapshotstate.MockBackendReadKeyFile(func(fn string) ([]byte, error) {
+		c.Check(fn, check.Equals, "/some/key")
+		return key, keyErr
+	})()
+	defer snapshotstate.MockBackendSave(func(_ context.Context, id uint64, si *snap.Info, cfg map[string]interface{}, usernames []string, flags *backend.Flags) (*client.Snapshot, error) {
+		c.Check(flags.EncryptionKey, check.DeepEquals, key)
+		return nil, nil
+	})()
+
+	st := state.New(nil)
+	st.Lock()
+	tr := config.NewTransaction(st)
+	tr.Set("core", "snapshots.encryption-key-file", "/some/key")
+	tr.Commit()
+	task := st.NewTask("save-snapshot", "...")
+	task.Set("snapshot-setup", map[string]interface{}{
+		"set-id": 42,
+		"snap":   "a-snap",
+	})
+	st.Unlock()
+
+	// not saving unencrypted if the key file can't be used
+	err := snapshotstate.DoSave(task, &tomb.Tomb{})
+	c.Assert(err, check.ErrorMatches, "bzzt")
+
+	keyErr = nil
+	err = snapshotstate.DoSave(task, &tomb.Tomb{})
+	c.Assert(err, check.IsNil)
+}
+
 func (snapshotSuite) TestDoSaveFailsWithNoSnap(c *check.C) {
 	defer snapshotstate.MockSnapstateCurrentInfo(func(*state.State, string) (*snap.Info, error) {
 		return nil, errors.New("bzzt")
@@ -470,6 +580,88 @@ func (rs *readerSuite) TestDoCheck(c *check.C) {
 
 }
 
+func (rs *readerSuite) TestDoCheckEncrypted(c *check.C) {
+	defer snapshotstate.MockBackendOpen(func(filename string) (*backend.Reader, error) {
+		rs.calls = append(rs.calls, "open")
+		return &backend.Reader{
+			Snapshot: client.Snapshot{Snap: "a-snap", KeyID: "0123456789abcdef"},
+		}, nil
+	})()
+
+	err := snapshotstate.DoCheck(rs.task, &tomb.Tomb{})
+	c.Assert(err, check.ErrorMatches, `snapshot of "a-snap" is encrypted, and no key was given`)
+
+	st := rs.task.State()
+	st.Lock()
+	snapshotstate.UseEncryptionKey(st, state.NewTaskSet(rs.task), make([]byte, backend.KeySize))
+	st.Unlock()
+	err = snapshotstate.DoRestore(rs.task, &tomb.Tomb{})
+	c.Assert(err, check.ErrorMatches, `snapshot of "a-snap" is encrypted with a different key`)
+	c.Check(rs.calls, check.DeepEquals, []string{"open", "get config", "open"})
+}
+
+func (rs *readerSuite) TestDoRestoreFiles(c *check.C) {
+	st := rs.task.State()
+	st.Lock()
+	rs.task.Set("snapshot-setup", map[string]interface{}{
+		"snap":     "a-snap",
+		"filename": "/some/file.zip",
+		"users":    []string{"a-user"},
+		"paths":    []string{"42/*"},
+		"target":   "/some/dir",
+	})
+	st.Unlock()
+
+	defer snapshotstate.MockBackendRestoreFiles(func(_ *backend.Reader, _ context.Context, users []string, paths []string, target string, logf backend.Logf) (int, error) {
+		rs.calls = append(rs.calls, "restore files")
+		c.Check(users, check.DeepEquals, []string{"a-user"})
+		c.Check(paths, check.DeepEquals, []string{"42/*"})
+		c.Check(target, check.Equals, "/some/dir")
+		logf("Restored %d files.", 2)
+		return 2, nil
+	})()
+
+	err := snapshotstate.DoRestoreFiles(rs.task, &tomb.Tomb{})
+	c.Assert(err, check.IsNil)
+	c.Check(rs.calls, check.DeepEquals, []string{"open", "restore files"})
+
+	st.Lock()
+	defer st.Unlock()
+	c.Assert(rs.task.Log(), check.HasLen, 1)
+	c.Check(rs.task.Log()[0], check.Matches, `.* Restored 2 files\.`)
+}
+
+func (rs *readerSuite) TestDoRestoreFilesNoMatches(c *check.C) {
+	defer snapshotstate.MockBackendRestoreFiles(func(*backend.Reader, context.Context, []string, []string, string, backend.Logf) (int, error) {
+		rs.calls = append(rs.calls, "restore files")
+		return 0, nil
+	})()
+
+	err := snapshotstate.DoRestoreFiles(rs.task, &tomb.Tomb{})
+	c.Assert(err, check.IsNil)
+
+	st := rs.task.State()
+	st.Lock()
+	defer st.Unlock()
+	c.Assert(rs.task.Log(), check.HasLen, 1)
+	c.Check(rs.task.Log()[0], check.Matches, `.* No files in the snapshot of "a-snap" matched the given paths\.`)
+}
+
+func (rs *readerSuite) TestDoRestoreFilesFails(c *check.C) {
+	defer snapshotstate.MockBackendRestoreFiles(func(*backend.Reader, context.Context, []string, []string, string, backend.Logf) (int, error) {
+		return 0, errors.New("bzzt")
+	})()
+
+	err := snapshotstate.DoRestoreFiles(rs.task, &tomb.Tomb{})
+	c.Assert(err, check.ErrorMatches, "bzzt")
+
+	defer snapshotstate.MockBackendOpen(func(string) (*backend.Reader, error) {
+		return nil, errors.New("bzzt")
+	})()
+	err = snapshotstate.DoRestoreFiles(rs.task, &tomb.Tomb{})
+	c.Assert(err, check.ErrorMatches, "cannot open snapshot: bzzt")
+}
+
 func (rs *readerSuite) TestDoRemove(c *check.C) {
 	defer snapshotstate.MockOsRemove(func(filename string) error {
 		c.Check(filename, check.Equals, "/some/file.zip")
@@ -480,3 +672,198 @@ func (rs *readerSuite) TestDoRemove(c *check.C) {
 	c.Assert(err, check.IsNil)
 	c.Check(rs.calls, check.DeepEquals, []string{"remove"})
 }
+
+func (snapshotSuite) TestAutomaticSnapshotExpiration(c *check.C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	for _, t := range []struct {
+		retention string
+		expected  time.Duration
+	}{
+		{"", 31 * 24 * time.Hour},
+		{"no", 0},
+		{"48h", 48 * time.Hour},
+		// invalid settings fall back to the default
+		{"bogus", 31 * 24 * time.Hour},
+	} {
+		tr := config.NewTransaction(st)
+		tr.Set("core", "snapshots.automatic.retention", t.retention)
+		tr.Commit()
+
+		expiration, err := snapshotstate.AutomaticSnapshotExpiration(st)
+		c.Assert(err, check.IsNil)
+		c.Check(expiration, check.Equals, t.expected, check.Commentf("%q", t.retention))
+	}
+}
+
+func (snapshotSuite) TestAutomaticSnapshot(c *check.C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	ts, err := snapshotstate.AutomaticSnapshot(st, "a-snap")
+	c.Assert(err, check.IsNil)
+	tasks := ts.Tasks()
+	c.Assert(tasks, check.HasLen, 1)
+	c.Check(tasks[0].Kind(), check.Equals, "save-snapshot")
+	c.Check(tasks[0].Summary(), check.Equals, `Save data of snap "a-snap" in automatic snapshot set`)
+	var snapshot map[string]interface{}
+	c.Check(tasks[0].Get("snapshot-setup", &snapshot), check.IsNil)
+	c.Check(snapshot, check.DeepEquals, map[string]interface{}{
+		"set-id":  0.,
+		"snap":    "a-snap",
+		"auto":    true,
+		"current": "unset",
+	})
+	// the set ID is only allocated when the snapshot is taken
+	var lastSetID uint64
+	c.Check(st.Get("last-snapshot-set-id", &lastSetID), check.Equals, state.ErrNoState)
+}
+
+func (snapshotSuite) TestDoSaveAutomaticAllocatesSetID(c *check.C) {
+	snapInfo := snap.Info{
+		SideInfo: snap.SideInfo{
+			RealName: "a-snap",
+			Revision: snap.R(-1),
+		},
+		Version: "1.33",
+	}
+	defer snapshotstate.MockSnapstateCurrentInfo(func(*state.State, string) (*snap.Info, error) {
+		return &snapInfo, nil
+	})()
+	defer snapshotstate.MockConfigGetSnapConfig(func(*state.State, string) (*json.RawMessage, error) {
+		return nil, nil
+	})()
+	defer snapshotstate.MockBackendSave(func(_ context.Context, id uint64, si *snap.Info, cfg map[string]interface{}, usernames []string, flags *backend.Flags) (*client.Snapshot, error) {
+		c.Check(id, check.Equals, uint64(8))
+		c.Check(flags.Auto, check.Equals, true)
+		return nil, nil
+	})()
+
+	st := state.New(nil)
+	st.Lock()
+	st.Set("last-snapshot-set-id", 7)
+	ts, err := snapshotstate.AutomaticSnapshot(st, "a-snap")
+	c.Assert(err, check.IsNil)
+	task := ts.Tasks()[0]
+	st.Unlock()
+
+	err = snapshotstate.DoSave(task, &tomb.Tomb{})
+	c.Assert(err, check.IsNil)
+
+	st.Lock()
+	defer st.Unlock()
+	var snapshot map[string]interface{}
+	c.Assert(task.Get("snapshot-setup", &snapshot), check.IsNil)
+	c.Check(snapshot["set-id"], check.Equals, 8.)
+	c.Check(snapshot["filename"], check.Equals, snapshotstate.Filename(8, &snapInfo))
+	var lastSetID uint64
+	c.Assert(st.Get("last-snapshot-set-id", &lastSetID), check.IsNil)
+	c.Check(lastSetID, check.Equals, uint64(8))
+}
+
+func (snapshotSuite) TestAutomaticSnapshotDisabled(c *check.C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	tr := config.NewTransaction(st)
+	tr.Set("core", "snapshots.automatic.retention", "no")
+	tr.Commit()
+
+	ts, err := snapshotstate.AutomaticSnapshot(st, "a-snap")
+	c.Assert(err, check.IsNil)
+	c.Check(ts, check.IsNil)
+}
+
+func (snapshotSuite) TestAutomaticSnapshotHooksIntoSnapstate(c *check.C) {
+	// the hook is set up when the package is loaded
+	c.Check(snapstate.AutomaticSnapshot, check.NotNil)
+}
+
+func (snapshotSuite) TestEnsureForgetsExpiredAutomaticSnapshots(c *check.C) {
+	dir := c.MkDir()
+	now := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	defer snapshotstate.MockTimeNow(func() time.Time { return now })()
+
+	shots := []client.Snapshot{
+		// expired
+		{SetID: 1, Snap: "a-snap", Auto: true, Time: now.Add(-32 * 24 * time.Hour)},
+		// expired, but being restored
+		{SetID: 2, Snap: "b-snap", Auto: true, Time: now.Add(-32 * 24 * time.Hour)},
+		// not expired
+		{SetID: 3, Snap: "c-snap", Auto: true, Time: now.Add(-30 * 24 * time.Hour)},
+		// not automatic
+		{SetID: 4, Snap: "d-snap", Time: now.Add(-32 * 24 * time.Hour)},
+		// expired but broken
+		{SetID: 5, Snap: "e-snap", Auto: true, Time: now.Add(-32 * 24 * time.Hour), Broken: "bad"},
+		// expired, but with an incremental snapshot on it
+		{SetID: 6, Snap: "f-snap", Auto: true, Time: now.Add(-32 * 24 * time.Hour)},
+		{SetID: 7, Snap: "f-snap", Time: now.Add(-time.Hour), BaseSetID: 6},
+		// expired, and the snapshot on it is of another snap
+		{SetID: 8, Snap: "g-snap", Auto: true, Time: now.Add(-32 * 24 * time.Hour)},
+		{SetID: 8, Snap: "h-snap", Auto: true, Time: now.Add(-32 * 24 * time.Hour)},
+		{SetID: 9, Snap: "h-snap", Time: now.Add(-time.Hour), BaseSetID: 8},
+	}
+	iters := 0
+	defer snapshotstate.MockBackendIter(func(_ context.Context, f func(*backend.Reader) error) error {
+		iters++
+		for _, shot := range shots {
+			shotfile, err := os.Create(filepath.Join(dir, fmt.Sprintf("%d.zip", shot.SetID)))
+			c.Assert(err, check.IsNil)
+			err = f(&backend.Reader{Snapshot: shot, File: shotfile})
+			shotfile.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})()
+	var removed []string
+	defer snapshotstate.MockOsRemove(func(fn string) error {
+		removed = append(removed, filepath.Base(fn))
+		return nil
+	})()
+
+	st := state.New(nil)
+	st.Lock()
+	chg := st.NewChange("restore-snapshot-change", "...")
+	tsk := st.NewTask("restore-snapshot", "...")
+	tsk.SetStatus(state.DoingStatus)
+	tsk.Set("snapshot-setup", map[string]int{"set-id": 2})
+	chg.AddTask(tsk)
+	st.Unlock()
+
+	mgr := snapshotstate.Manager(st, state.NewTaskRunner(st))
+	c.Assert(mgr.Ensure(), check.IsNil)
+	c.Check(iters, check.Equals, 1)
+	c.Check(removed, check.DeepEquals, []string{"1.zip", "8.zip"})
+
+	// nothing is done until a day has passed
+	now = now.Add(23 * time.Hour)
+	c.Assert(mgr.Ensure(), check.IsNil)
+	c.Check(iters, check.Equals, 1)
+
+	now = now.Add(time.Hour)
+	c.Assert(mgr.Ensure(), check.IsNil)
+	c.Check(iters, check.Equals, 2)
+}
+
+func (snapshotSuite) TestEnsureDoesNotForgetIfAutomaticSnapshotsDisabled(c *check.C) {
+	defer snapshotstate.MockBackendIter(func(context.Context, func(*backend.Reader) error) error {
+		c.Fatal("unexpected call to backend.Iter")
+		return nil
+	})()
+
+	st := state.New(nil)
+	st.Lock()
+	tr := config.NewTransaction(st)
+	tr.Set("core", "snapshots.automatic.retention", "no")
+	tr.Commit()
+	st.Unlock()
+
+	mgr := snapshotstate.Manager(st, state.NewTaskRunner(st))
+	c.Assert(mgr.Ensure(), check.IsNil)
+}
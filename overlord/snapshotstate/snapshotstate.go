@@ -22,9 +22,14 @@ package snapshotstate
 import (
 	"context"
 	"fmt"
+	"io"
+	"path/filepath"
 	"sort"
+	"time"
 
 	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/overlord/configstate/config"
 	"github.com/snapcore/snapd/overlord/snapshotstate/backend"
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
@@ -36,6 +41,8 @@ var (
 	snapstateAll                     = snapstate.All
 	snapstateCheckChangeConflictMany = snapstate.CheckChangeConflictMany
 	backendIter                      = backend.Iter
+	backendNewSnapshotExport         = backend.NewSnapshotExport
+	backendImport                    = backend.Import
 )
 
 func newSnapshotSetID(st *state.State) (uint64, error) {
@@ -143,21 +150,170 @@ func checkSnapshotTaskConflict(st *state.State, setID uint64, conflictingKinds .
 			return taskGetErrMsg(task, err, "snapshot")
 		}
 
-		if snapshot.SetID == setID {
-			return fmt.Errorf("cannot operate on snapshot set #%d while change %q is in progress", setID, task.Change().ID())
+		if snapshot.SetID == setID || snapshot.BaseSetID == setID {
+			return &snapstate.ChangeConflictError{
+				Message:    fmt.Sprintf("cannot operate on snapshot set #%d while change %q is in progress", setID, task.Change().ID()),
+				ChangeKind: task.Change().Kind(),
+			}
 		}
 	}
 
 	return nil
 }
 
+// the default retention of automatic snapshots
+const defaultAutomaticSnapshotExpiration = 31 * 24 * time.Hour
+
+// AutomaticSnapshotExpiration returns how long automatic snapshots
+// are kept for, as set by the snapshots.automatic.retention core
+// setting. A zero duration means automatic snapshots are disabled.
+// Note that the state must be locked by the caller.
+func AutomaticSnapshotExpiration(st *state.State) (time.Duration, error) {
+	var retentionStr string
+	tr := config.NewTransaction(st)
+	err := tr.Get("core", "snapshots.automatic.retention", &retentionStr)
+	if err != nil && !config.IsNoOption(err) {
+		return 0, err
+	}
+	if err == nil && retentionStr != "" {
+		if retentionStr == "no" {
+			return 0, nil
+		}
+		retention, err := time.ParseDuration(retentionStr)
+		if err == nil {
+			return retention, nil
+		}
+		logger.Noticef("Cannot parse snapshots.automatic.retention %q, using the default: %v.", retentionStr, err)
+	}
+
+	return defaultAutomaticSnapshotExpiration, nil
+}
+
+// AutomaticSnapshot creates a taskset for taking an automatic
+// snapshot of the data of the given snap, to be used when removing
+// it. It returns a nil taskset if automatic snapshots are disabled.
+// The snapshot set ID is only allocated when the task runs, so that
+// tasksets that are discarded, as when dry-running, use up none.
+// Note that the state must be locked by the caller.
+func AutomaticSnapshot(st *state.State, instanceName string) (ts *state.TaskSet, err error) {
+	expiration, err := AutomaticSnapshotExpiration(st)
+	if err != nil {
+		return nil, err
+	}
+	if expiration == 0 {
+		return nil, nil
+	}
+
+	desc := fmt.Sprintf("Save data of snap %q in automatic snapshot set", instanceName)
+	task := st.NewTask("save-snapshot", desc)
+	snapshot := snapshotSetup{
+		Snap: instanceName,
+		Auto: true,
+	}
+	task.Set("snapshot-setup", &snapshot)
+
+	return state.NewTaskSet(task), nil
+}
+
 // List valid snapshots.
 // Note that the state must be locked by the caller.
 var List = backend.List
 
+// SaveFlags are the extra options for Save.
+type SaveFlags struct {
+	// Compression is the compression method to use for the
+	// snapshots' archives; empty means the backend's default.
+	Compression string
+	// BaseSetID, if non-zero, makes the snapshots incremental on
+	// the ones in the given snapshot set.
+	BaseSetID uint64
+	// EncryptionKey, if set, is used to encrypt the snapshots
+	// instead of the one from snapshots.encryption-key-file.
+	EncryptionKey []byte
+}
+
+type encryptionKeyKey struct {
+	taskID string
+}
+
+// UseEncryptionKey makes the tasks in the given taskset use the given key
+// for encrypting or decrypting snapshots, instead of the one from the file
+// set via snapshots.encryption-key-file. The key is only kept in memory.
+// Note that the state must be locked by the caller.
+func UseEncryptionKey(st *state.State, ts *state.TaskSet, key []byte) {
+	if key == nil {
+		return
+	}
+	for _, task := range ts.Tasks() {
+		var snapshot snapshotSetup
+		if err := task.Get("snapshot-setup", &snapshot); err != nil {
+			continue
+		}
+		snapshot.EncryptionKeyGiven = true
+		task.Set("snapshot-setup", &snapshot)
+		st.Cache(encryptionKeyKey{task.ID()}, key)
+	}
+}
+
+// encryptionKey returns the key the task should use for the snapshot, or
+// nil if it should not be encrypted.
+// Note that the state must be locked by the caller.
+func encryptionKey(task *state.Task, snapshot *snapshotSetup) ([]byte, error) {
+	st := task.State()
+	if key, ok := st.Cached(encryptionKeyKey{task.ID()}).([]byte); ok {
+		return key, nil
+	}
+	if snapshot.EncryptionKeyGiven {
+		// snapd was restarted since the request was made
+		return nil, fmt.Errorf("cannot use snapshot %q: the encryption key given is no longer available", snapshot.Snap)
+	}
+	return configuredEncryptionKey(st)
+}
+
+// configuredEncryptionKey returns the key from the file set via
+// snapshots.encryption-key-file, or nil if it is not set.
+// Note that the state must be locked by the caller.
+func configuredEncryptionKey(st *state.State) ([]byte, error) {
+	var keyFile string
+	tr := config.NewTransaction(st)
+	if err := tr.Get("core", "snapshots.encryption-key-file", &keyFile); err != nil && !config.IsNoOption(err) {
+		return nil, err
+	}
+	if keyFile == "" {
+		return nil, nil
+	}
+	return backendReadKeyFile(keyFile)
+}
+
+func forgetEncryptionKey(task *state.Task) {
+	st := task.State()
+	st.Lock()
+	defer st.Unlock()
+	st.Cache(encryptionKeyKey{task.ID()}, nil)
+}
+
 // Save creates a taskset for taking snapshots of snaps' data.
 // Note that the state must be locked by the caller.
-func Save(st *state.State, instanceNames []string, users []string) (setID uint64, snapsSaved []string, ts *state.TaskSet, err error) {
+func Save(st *state.State, instanceNames []string, users []string, flags *SaveFlags) (setID uint64, snapsSaved []string, ts *state.TaskSet, err error) {
+	if flags == nil {
+		flags = &SaveFlags{}
+	}
+	if err := backend.ValidateCompression(flags.Compression); err != nil {
+		return 0, nil, nil, err
+	}
+	if flags.EncryptionKey != nil && len(flags.EncryptionKey) != backend.KeySize {
+		return 0, nil, nil, fmt.Errorf("invalid snapshot encryption key: must be %d bytes", backend.KeySize)
+	}
+	if flags.BaseSetID != 0 {
+		// the base needs to be there until the snapshots are taken
+		if err := checkSnapshotTaskConflict(st, flags.BaseSetID, "forget-snapshot"); err != nil {
+			return 0, nil, nil, err
+		}
+		if _, err := snapSummariesInSnapshotSet(flags.BaseSetID, nil); err != nil {
+			return 0, nil, nil, err
+		}
+	}
+
 	if len(instanceNames) == 0 {
 		instanceNames, err = allActiveSnapNames(st)
 		if err != nil {
@@ -181,9 +337,11 @@ func Save(st *state.State, instanceNames []string, users []string) (setID uint64
 		desc := fmt.Sprintf("Save data of snap %q in snapshot set #%d", name, setID)
 		task := st.NewTask("save-snapshot", desc)
 		snapshot := snapshotSetup{
-			SetID: setID,
-			Snap:  name,
-			Users: users,
+			SetID:       setID,
+			Snap:        name,
+			Users:       users,
+			Compression: flags.Compression,
+			BaseSetID:   flags.BaseSetID,
 		}
 		task.Set("snapshot-setup", &snapshot)
 		// Here, note that a snapshot set behaves as a unit: it either
@@ -199,6 +357,7 @@ func Save(st *state.State, instanceNames []string, users []string) (setID uint64
 		// it if we find it to be wrong.
 		ts.AddTask(task)
 	}
+	UseEncryptionKey(st, ts, flags.EncryptionKey)
 
 	return setID, instanceNames, ts, nil
 }
@@ -264,6 +423,90 @@ func Restore(st *state.State, setID uint64, snapNames []string, users []string)
 	return snapsFound, ts, nil
 }
 
+// RestoreFiles creates a taskset for extracting the files matching the
+// given patterns from a snapshot into the target directory, leaving the
+// snaps' data alone.
+// Note that the state must be locked by the caller.
+func RestoreFiles(st *state.State, setID uint64, snapNames []string, users []string, paths []string, target string) (snapsFound []string, ts *state.TaskSet, err error) {
+	if err := backend.ValidatePathPatterns(paths); err != nil {
+		return nil, nil, err
+	}
+	if !filepath.IsAbs(target) {
+		return nil, nil, fmt.Errorf("cannot restore files into %q: target must be an absolute path", target)
+	}
+
+	// restoring files needs to conflict with forget of itself
+	if err := checkSnapshotTaskConflict(st, setID, "forget-snapshot"); err != nil {
+		return nil, nil, err
+	}
+
+	summaries, err := snapSummariesInSnapshotSet(setID, snapNames)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ts = state.NewTaskSet()
+
+	for _, summary := range summaries {
+		desc := fmt.Sprintf("Restore files of snap %q from snapshot set #%d into %q", summary.snap, setID, target)
+		task := st.NewTask("restore-snapshot-files", desc)
+		snapshot := snapshotSetup{
+			SetID:    setID,
+			Snap:     summary.snap,
+			Users:    users,
+			Filename: summary.filename,
+			Paths:    paths,
+			Target:   target,
+		}
+		task.Set("snapshot-setup", &snapshot)
+		ts.AddTask(task)
+	}
+
+	return summaries.snapNames(), ts, nil
+}
+
+// Files lists the files in the snapshot of the given snap in the given
+// snapshot set, limited to those of the given users if not empty. If the
+// snapshot is encrypted, the given key is used, or if nil the one from
+// snapshots.encryption-key-file.
+// Note that the state must *not* be locked by the caller.
+func Files(ctx context.Context, st *state.State, setID uint64, snapName string, users []string, key []byte) ([]client.SnapshotFile, error) {
+	// listing needs to conflict with forget of itself
+	st.Lock()
+	err := checkSnapshotTaskConflict(st, setID, "forget-snapshot")
+	st.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	summaries, err := snapSummariesInSnapshotSet(setID, []string{snapName})
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := backendOpen(summaries[0].filename)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open snapshot: %v", err)
+	}
+	defer reader.Close()
+
+	if reader.KeyID != "" {
+		if key == nil {
+			st.Lock()
+			key, err = configuredEncryptionKey(st)
+			st.Unlock()
+			if err != nil {
+				return nil, err
+			}
+		}
+		if err := reader.Unlock(key); err != nil {
+			return nil, err
+		}
+	}
+
+	return backendList(reader, ctx, users)
+}
+
 // Check creates a taskset for checking a snapshot's data.
 // Note that the state must be locked by the caller.
 func Check(st *state.State, setID uint64, snapNames []string, users []string) (snapsFound []string, ts *state.TaskSet, err error) {
@@ -298,8 +541,9 @@ func Check(st *state.State, setID uint64, snapNames []string, users []string) (s
 // Forget creates a taskset for deletinig a snapshot.
 // Note that the state must be locked by the caller.
 func Forget(st *state.State, setID uint64, snapNames []string) (snapsFound []string, ts *state.TaskSet, err error) {
-	// forget needs to conflict with check and restore
-	if err := checkSnapshotTaskConflict(st, setID, "check-snapshot", "restore-snapshot"); err != nil {
+	// forget needs to conflict with check and restore, and with saves
+	// that use the set as their base
+	if err := checkSnapshotTaskConflict(st, setID, "check-snapshot", "restore-snapshot", "restore-snapshot-files", "save-snapshot"); err != nil {
 		return nil, nil, err
 	}
 
@@ -308,6 +552,10 @@ func Forget(st *state.State, setID uint64, snapNames []string) (snapsFound []str
 		return nil, nil, err
 	}
 
+	if err := checkIncrementalDependents(setID, summaries.snapNames()); err != nil {
+		return nil, nil, err
+	}
+
 	ts = state.NewTaskSet()
 	for _, summary := range summaries {
 		desc := fmt.Sprintf("Drop data of snap %q from snapshot set #%d", summary.snap, setID)
@@ -323,3 +571,53 @@ func Forget(st *state.State, setID uint64, snapNames []string) (snapsFound []str
 
 	return summaries.snapNames(), ts, nil
 }
+
+// checkIncrementalDependents checks that no snapshot of the given snaps is
+// incremental on the given snapshot set.
+func checkIncrementalDependents(setID uint64, snapNames []string) error {
+	var dependent uint64
+	err := backendIter(context.TODO(), func(r *backend.Reader) error {
+		if r.BaseSetID == setID && r.SetID != setID && strutil.ListContains(snapNames, r.Snap) {
+			dependent = r.SetID
+			return backend.Stop
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if dependent != 0 {
+		return fmt.Errorf("cannot forget snapshot set #%d: snapshot set #%d is incremental on it", setID, dependent)
+	}
+	return nil
+}
+
+// Export opens the snapshot set with the given ID for exporting.
+// Note that the state must be locked by the caller.
+func Export(ctx context.Context, st *state.State, setID uint64) (*backend.SnapshotExport, error) {
+	// export needs to conflict with forget of itself
+	if err := checkSnapshotTaskConflict(st, setID, "forget-snapshot"); err != nil {
+		return nil, err
+	}
+
+	return backendNewSnapshotExport(ctx, setID)
+}
+
+// Import adds the snapshot set read from the given reader, as written
+// by an export, as a new snapshot set.
+// Note that the state must *not* be locked by the caller.
+func Import(ctx context.Context, st *state.State, r io.Reader) (setID uint64, snapNames []string, err error) {
+	st.Lock()
+	setID, err = newSnapshotSetID(st)
+	st.Unlock()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	snapNames, err = backendImport(ctx, setID, r)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return setID, snapNames, nil
+}
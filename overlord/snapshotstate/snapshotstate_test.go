@@ -23,6 +23,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"os/user"
@@ -291,7 +293,7 @@ func (snapshotSuite) TestSaveChecksSnapnamesError(c *check.C) {
 	st := state.New(nil)
 	st.Lock()
 	defer st.Unlock()
-	_, _, _, err := snapshotstate.Save(st, nil, nil)
+	_, _, _, err := snapshotstate.Save(st, nil, nil, nil)
 	c.Check(err, check.ErrorMatches, "bzzt")
 }
 
@@ -337,7 +339,7 @@ func (snapshotSuite) createConflictingChange(c *check.C) (st *state.State, resto
 	})
 
 	chg := st.NewChange("rm foo", "...")
-	rmTasks, err := snapstate.Remove(st, "foo", snap.R(0))
+	rmTasks, err := snapstate.Remove(st, "foo", snap.R(0), nil)
 	c.Assert(err, check.IsNil)
 	c.Assert(rmTasks, check.NotNil)
 	chg.AddAll(rmTasks)
@@ -353,7 +355,7 @@ func (s snapshotSuite) TestSaveChecksSnapstateConflict(c *check.C) {
 	st, restore := s.createConflictingChange(c)
 	defer restore()
 
-	_, _, _, err := snapshotstate.Save(st, []string{"foo"}, nil)
+	_, _, _, err := snapshotstate.Save(st, []string{"foo"}, nil, nil)
 	c.Assert(err, check.NotNil)
 	c.Check(err, check.FitsTypeOf, &snapstate.ChangeConflictError{})
 }
@@ -389,7 +391,7 @@ func (snapshotSuite) TestSaveConflictsWithSnapstate(c *check.C) {
 	})
 
 	chg := st.NewChange("snapshot-save", "...")
-	_, _, saveTasks, err := snapshotstate.Save(st, nil, nil)
+	_, _, saveTasks, err := snapshotstate.Save(st, nil, nil, nil)
 	c.Assert(err, check.IsNil)
 	chg.AddAll(saveTasks)
 
@@ -405,7 +407,7 @@ func (snapshotSuite) TestSaveChecksSnapstateConflictError(c *check.C) {
 	st := state.New(nil)
 	st.Lock()
 	defer st.Unlock()
-	_, _, _, err := snapshotstate.Save(st, nil, nil)
+	_, _, _, err := snapshotstate.Save(st, nil, nil, nil)
 	c.Check(err, check.ErrorMatches, "bzzt")
 }
 
@@ -416,7 +418,7 @@ func (snapshotSuite) TestSaveChecksSetIDError(c *check.C) {
 
 	st.Set("last-snapshot-set-id", "3/4")
 
-	_, _, _, err := snapshotstate.Save(st, nil, nil)
+	_, _, _, err := snapshotstate.Save(st, nil, nil, nil)
 	c.Check(err, check.ErrorMatches, ".* could not unmarshal .*")
 }
 
@@ -425,7 +427,7 @@ func (snapshotSuite) TestSaveNoSnapsInState(c *check.C) {
 	st.Lock()
 	defer st.Unlock()
 
-	setID, saved, taskset, err := snapshotstate.Save(st, nil, nil)
+	setID, saved, taskset, err := snapshotstate.Save(st, nil, nil, nil)
 	c.Assert(err, check.IsNil)
 	c.Check(setID, check.Equals, uint64(1))
 	c.Check(saved, check.HasLen, 0)
@@ -447,7 +449,7 @@ func (snapshotSuite) TestSaveSomeSnaps(c *check.C) {
 	st.Lock()
 	defer st.Unlock()
 
-	setID, saved, taskset, err := snapshotstate.Save(st, nil, nil)
+	setID, saved, taskset, err := snapshotstate.Save(st, nil, nil, nil)
 	c.Assert(err, check.IsNil)
 	c.Check(setID, check.Equals, uint64(1))
 	c.Check(saved, check.DeepEquals, []string{"a-snap", "c-snap"})
@@ -471,7 +473,7 @@ func (snapshotSuite) TestSaveOneSnap(c *check.C) {
 	st.Lock()
 	defer st.Unlock()
 
-	setID, saved, taskset, err := snapshotstate.Save(st, []string{"a-snap"}, []string{"a-user"})
+	setID, saved, taskset, err := snapshotstate.Save(st, []string{"a-snap"}, []string{"a-user"}, nil)
 	c.Assert(err, check.IsNil)
 	c.Check(setID, check.Equals, uint64(1))
 	c.Check(saved, check.DeepEquals, []string{"a-snap"})
@@ -489,6 +491,99 @@ func (snapshotSuite) TestSaveOneSnap(c *check.C) {
 	})
 }
 
+func (snapshotSuite) TestSaveIncremental(c *check.C) {
+	shotfile, err := os.Create(filepath.Join(c.MkDir(), "yadda.zip"))
+	c.Assert(err, check.IsNil)
+	defer shotfile.Close()
+	defer snapshotstate.MockBackendIter(func(_ context.Context, f func(*backend.Reader) error) error {
+		return f(&backend.Reader{
+			Snapshot: client.Snapshot{SetID: 42, Snap: "a-snap"},
+			File:     shotfile,
+		})
+	})()
+	defer snapshotstate.MockSnapstateAll(func(*state.State) (map[string]*snapstate.SnapState, error) {
+		return map[string]*snapstate.SnapState{"a-snap": {Active: true}}, nil
+	})()
+
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	setID, _, taskset, err := snapshotstate.Save(st, []string{"a-snap"}, nil, &snapshotstate.SaveFlags{Compression: "none", BaseSetID: 42})
+	c.Assert(err, check.IsNil)
+	c.Check(setID, check.Equals, uint64(1))
+	tasks := taskset.Tasks()
+	c.Assert(tasks, check.HasLen, 1)
+	var snapshot map[string]interface{}
+	c.Check(tasks[0].Get("snapshot-setup", &snapshot), check.IsNil)
+	c.Check(snapshot, check.DeepEquals, map[string]interface{}{
+		"set-id":      1.,
+		"snap":        "a-snap",
+		"current":     "unset",
+		"compression": "none",
+		"base-set-id": 42.,
+	})
+
+	// a forget of the base now conflicts with the save
+	chg := st.NewChange("save-snapshot", "...")
+	chg.AddAll(taskset)
+	_, _, err = snapshotstate.Forget(st, 42, nil)
+	c.Check(err, check.ErrorMatches, `cannot operate on snapshot set #42 while change "1" is in progress`)
+}
+
+func (snapshotSuite) TestSaveEncrypted(c *check.C) {
+	defer snapshotstate.MockSnapstateAll(func(*state.State) (map[string]*snapstate.SnapState, error) {
+		return map[string]*snapstate.SnapState{"a-snap": {Active: true}}, nil
+	})()
+
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	_, _, _, err := snapshotstate.Save(st, []string{"a-snap"}, nil, &snapshotstate.SaveFlags{EncryptionKey: []byte("short")})
+	c.Assert(err, check.ErrorMatches, "invalid snapshot encryption key: must be 32 bytes")
+
+	key := make([]byte, backend.KeySize)
+	_, _, taskset, err := snapshotstate.Save(st, []string{"a-snap"}, nil, &snapshotstate.SaveFlags{EncryptionKey: key})
+	c.Assert(err, check.IsNil)
+	tasks := taskset.Tasks()
+	c.Assert(tasks, check.HasLen, 1)
+	// the key itself is not in the state
+	var snapshot map[string]interface{}
+	c.Check(tasks[0].Get("snapshot-setup", &snapshot), check.IsNil)
+	c.Check(snapshot, check.DeepEquals, map[string]interface{}{
+		"set-id":               1.,
+		"snap":                 "a-snap",
+		"current":              "unset",
+		"encryption-key-given": true,
+	})
+}
+
+func (snapshotSuite) TestSaveIncrementalErrors(c *check.C) {
+	defer snapshotstate.MockBackendIter(func(context.Context, func(*backend.Reader) error) error {
+		return nil
+	})()
+
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	_, _, _, err := snapshotstate.Save(st, []string{"a-snap"}, nil, &snapshotstate.SaveFlags{Compression: "lzma"})
+	c.Check(err, check.ErrorMatches, `unsupported snapshot compression "lzma" .*`)
+
+	_, _, _, err = snapshotstate.Save(st, []string{"a-snap"}, nil, &snapshotstate.SaveFlags{BaseSetID: 42})
+	c.Check(err, check.Equals, client.ErrSnapshotSetNotFound)
+
+	chg := st.NewChange("forget-snapshot-change", "...")
+	tsk := st.NewTask("forget-snapshot", "...")
+	tsk.SetStatus(state.DoingStatus)
+	tsk.Set("snapshot-setup", map[string]int{"set-id": 42})
+	chg.AddTask(tsk)
+
+	_, _, _, err = snapshotstate.Save(st, []string{"a-snap"}, nil, &snapshotstate.SaveFlags{BaseSetID: 42})
+	c.Check(err, check.ErrorMatches, `cannot operate on snapshot set #42 while change "1" is in progress`)
+}
+
 func (snapshotSuite) TestSaveIntegration(c *check.C) {
 	if os.Geteuid() == 0 {
 		c.Skip("this test cannot run as root (runuser will fail)")
@@ -544,7 +639,7 @@ func (snapshotSuite) TestSaveIntegration(c *check.C) {
 		}
 	}
 
-	setID, saved, taskset, err := snapshotstate.Save(st, nil, []string{"a-user"})
+	setID, saved, taskset, err := snapshotstate.Save(st, nil, []string{"a-user"}, nil)
 	c.Assert(err, check.IsNil)
 	c.Check(setID, check.Equals, uint64(1))
 	c.Check(saved, check.DeepEquals, []string{"one-snap", "too-snap", "tri-snap"})
@@ -567,8 +662,9 @@ func (snapshotSuite) TestSaveIntegration(c *check.C) {
 		c.Check(r.Snapshot.Time.After(t0), check.Equals, true)
 		c.Check(r.Snapshot.Time.Before(tf), check.Equals, true)
 		c.Check(r.Snapshot.Size > 0, check.Equals, true)
-		c.Assert(r.Snapshot.SHA3_384, check.HasLen, 1)
+		c.Assert(r.Snapshot.SHA3_384, check.HasLen, 2)
 		c.Check(r.Snapshot.SHA3_384["user/a-user.tgz"], check.HasLen, 96)
+		c.Check(r.Snapshot.SHA3_384["user/a-user.snar"], check.HasLen, 96)
 
 		r.Snapshot.Time = time.Time{}
 		r.Snapshot.Size = 0
@@ -650,7 +746,7 @@ exec /bin/tar "$@"
 		c.Assert(os.Mkdir(filepath.Join(homedir, "snap", name, "common", "common-"+name), mode), check.IsNil)
 	}
 
-	setID, saved, taskset, err := snapshotstate.Save(st, nil, []string{"a-user"})
+	setID, saved, taskset, err := snapshotstate.Save(st, nil, []string{"a-user"}, nil)
 	c.Assert(err, check.IsNil)
 	c.Check(setID, check.Equals, uint64(1))
 	c.Check(saved, check.DeepEquals, []string{"one-snap", "too-snap", "tri-snap"})
@@ -1229,6 +1325,135 @@ func (snapshotSuite) TestCheck(c *check.C) {
 	})
 }
 
+func (snapshotSuite) TestRestoreFilesBadArgs(c *check.C) {
+	defer snapshotstate.MockBackendIter(func(context.Context, func(*backend.Reader) error) error {
+		c.Fatal("unexpected call to backend.Iter")
+		return nil
+	})()
+
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	_, _, err := snapshotstate.RestoreFiles(st, 42, nil, nil, nil, "/tmp")
+	c.Check(err, check.ErrorMatches, `no path patterns given`)
+	_, _, err = snapshotstate.RestoreFiles(st, 42, nil, nil, []string{"/42"}, "/tmp")
+	c.Check(err, check.ErrorMatches, `invalid path pattern "/42": must be a relative path`)
+	_, _, err = snapshotstate.RestoreFiles(st, 42, nil, nil, []string{"42"}, "tmp")
+	c.Check(err, check.ErrorMatches, `cannot restore files into "tmp": target must be an absolute path`)
+}
+
+func (s snapshotSuite) TestRestoreFilesDoesNotTriggerSnapstateConflict(c *check.C) {
+	st, restore := s.createConflictingChange(c)
+	defer restore()
+
+	_, _, err := snapshotstate.RestoreFiles(st, 42, nil, nil, []string{"42"}, "/tmp")
+	c.Assert(err, check.IsNil)
+}
+
+func (snapshotSuite) TestRestoreFilesChecksForgetConflicts(c *check.C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+	chg := st.NewChange("forget-snapshot-change", "...")
+	tsk := st.NewTask("forget-snapshot", "...")
+	tsk.SetStatus(state.DoingStatus)
+	tsk.Set("snapshot-setup", map[string]int{"set-id": 42})
+	chg.AddTask(tsk)
+
+	_, _, err := snapshotstate.RestoreFiles(st, 42, nil, nil, []string{"42"}, "/tmp")
+	c.Assert(err, check.ErrorMatches, `cannot operate on snapshot set #42 while change \"1\" is in progress`)
+}
+
+func (snapshotSuite) TestRestoreFiles(c *check.C) {
+	shotfile, err := os.Create(filepath.Join(c.MkDir(), "yadda.zip"))
+	c.Assert(err, check.IsNil)
+	defer shotfile.Close()
+	defer snapshotstate.MockBackendIter(func(_ context.Context, f func(*backend.Reader) error) error {
+		return f(&backend.Reader{
+			Snapshot: client.Snapshot{SetID: 42, Snap: "a-snap"},
+			File:     shotfile,
+		})
+	})()
+
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	found, taskset, err := snapshotstate.RestoreFiles(st, 42, []string{"a-snap", "b-snap"}, []string{"a-user"}, []string{"42/*"}, "/some/dir")
+	c.Assert(err, check.IsNil)
+	c.Check(found, check.DeepEquals, []string{"a-snap"})
+	tasks := taskset.Tasks()
+	c.Assert(tasks, check.HasLen, 1)
+	c.Check(tasks[0].Kind(), check.Equals, "restore-snapshot-files")
+	c.Check(tasks[0].Summary(), check.Equals, `Restore files of snap "a-snap" from snapshot set #42 into "/some/dir"`)
+	var snapshot map[string]interface{}
+	c.Check(tasks[0].Get("snapshot-setup", &snapshot), check.IsNil)
+	c.Check(snapshot, check.DeepEquals, map[string]interface{}{
+		"set-id":   42.,
+		"snap":     "a-snap",
+		"filename": shotfile.Name(),
+		"users":    []interface{}{"a-user"},
+		"current":  "unset",
+		"paths":    []interface{}{"42/*"},
+		"target":   "/some/dir",
+	})
+}
+
+func (snapshotSuite) TestFilesChecksForgetConflicts(c *check.C) {
+	defer snapshotstate.MockBackendIter(func(context.Context, func(*backend.Reader) error) error {
+		c.Fatal("unexpected call to backend.Iter")
+		return nil
+	})()
+
+	st := state.New(nil)
+	st.Lock()
+	chg := st.NewChange("forget-snapshot-change", "...")
+	tsk := st.NewTask("forget-snapshot", "...")
+	tsk.SetStatus(state.DoingStatus)
+	tsk.Set("snapshot-setup", map[string]int{"set-id": 42})
+	chg.AddTask(tsk)
+	st.Unlock()
+
+	_, err := snapshotstate.Files(context.TODO(), st, 42, "a-snap", nil, nil)
+	c.Assert(err, check.ErrorMatches, `cannot operate on snapshot set #42 while change \"1\" is in progress`)
+}
+
+func (snapshotSuite) TestFiles(c *check.C) {
+	defer snapshotstate.MockBackendIter(func(_ context.Context, f func(*backend.Reader) error) error {
+		for _, snapName := range []string{"a-snap", "b-snap"} {
+			if err := f(&backend.Reader{
+				Snapshot: client.Snapshot{SetID: 42, Snap: snapName},
+				File:     os.NewFile(0, "/some/"+snapName+".zip"),
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})()
+	defer snapshotstate.MockBackendOpen(func(filename string) (*backend.Reader, error) {
+		c.Check(filename, check.Equals, "/some/b-snap.zip")
+		return &backend.Reader{}, nil
+	})()
+	st := state.New(nil)
+	defer snapshotstate.MockBackendList(func(_ *backend.Reader, _ context.Context, users []string) ([]client.SnapshotFile, error) {
+		// the state is not locked while listing
+		st.Lock()
+		st.Unlock()
+		c.Check(users, check.DeepEquals, []string{"a-user"})
+		return []client.SnapshotFile{{Path: "42/foo", SetID: 42}}, nil
+	})()
+
+	files, err := snapshotstate.Files(context.TODO(), st, 42, "b-snap", []string{"a-user"}, nil)
+	c.Assert(err, check.IsNil)
+	c.Check(files, check.DeepEquals, []client.SnapshotFile{{Path: "42/foo", SetID: 42}})
+
+	_, err = snapshotstate.Files(context.TODO(), st, 42, "c-snap", nil, nil)
+	c.Check(err, check.Equals, client.ErrSnapshotSnapsNotFound)
+	_, err = snapshotstate.Files(context.TODO(), st, 43, "a-snap", nil, nil)
+	c.Check(err, check.Equals, client.ErrSnapshotSetNotFound)
+}
+
 func (snapshotSuite) TestForgetChecksIterError(c *check.C) {
 	defer snapshotstate.MockBackendIter(func(context.Context, func(*backend.Reader) error) error {
 		return errors.New("bzzt")
@@ -1306,6 +1531,38 @@ func (snapshotSuite) TestForgetChecksRestoreConflicts(c *check.C) {
 	c.Assert(err, check.ErrorMatches, `cannot operate on snapshot set #42 while change \"1\" is in progress`)
 }
 
+func (snapshotSuite) TestForgetChecksIncrementalDependents(c *check.C) {
+	shotfile, err := os.Create(filepath.Join(c.MkDir(), "yadda.zip"))
+	c.Assert(err, check.IsNil)
+	defer shotfile.Close()
+	defer snapshotstate.MockBackendIter(func(_ context.Context, f func(*backend.Reader) error) error {
+		for _, shot := range []client.Snapshot{
+			{SetID: 42, Snap: "a-snap"},
+			{SetID: 42, Snap: "b-snap"},
+			{SetID: 43, Snap: "b-snap", BaseSetID: 42},
+		} {
+			if err := f(&backend.Reader{Snapshot: shot, File: shotfile}); err != nil {
+				if err == backend.Stop {
+					break
+				}
+				return err
+			}
+		}
+		return nil
+	})()
+
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	found, _, err := snapshotstate.Forget(st, 42, []string{"a-snap"})
+	c.Assert(err, check.IsNil)
+	c.Check(found, check.DeepEquals, []string{"a-snap"})
+
+	_, _, err = snapshotstate.Forget(st, 42, nil)
+	c.Check(err, check.ErrorMatches, `cannot forget snapshot set #42: snapshot set #43 is incremental on it`)
+}
+
 func (snapshotSuite) TestForget(c *check.C) {
 	shotfile, err := os.Create(filepath.Join(c.MkDir(), "yadda.zip"))
 	c.Assert(err, check.IsNil)
@@ -1341,3 +1598,77 @@ func (snapshotSuite) TestForget(c *check.C) {
 		"current":  "unset",
 	})
 }
+
+func (snapshotSuite) TestExportChecksForgetConflicts(c *check.C) {
+	defer snapshotstate.MockBackendNewSnapshotExport(func(context.Context, uint64) (*backend.SnapshotExport, error) {
+		c.Fatal("unexpected call to backend.NewSnapshotExport")
+		return nil, nil
+	})()
+
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+	chg := st.NewChange("forget-snapshot-change", "...")
+	tsk := st.NewTask("forget-snapshot", "...")
+	tsk.SetStatus(state.DoingStatus)
+	tsk.Set("snapshot-setup", map[string]int{"set-id": 42})
+	chg.AddTask(tsk)
+
+	_, err := snapshotstate.Export(context.TODO(), st, 42)
+	c.Assert(err, check.ErrorMatches, `cannot operate on snapshot set #42 while change \"1\" is in progress`)
+	c.Check(err, check.FitsTypeOf, &snapstate.ChangeConflictError{})
+	c.Check(err.(*snapstate.ChangeConflictError).ChangeKind, check.Equals, "forget-snapshot-change")
+}
+
+func (snapshotSuite) TestExport(c *check.C) {
+	var exportedID uint64
+	defer snapshotstate.MockBackendNewSnapshotExport(func(_ context.Context, setID uint64) (*backend.SnapshotExport, error) {
+		exportedID = setID
+		return &backend.SnapshotExport{}, nil
+	})()
+
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	se, err := snapshotstate.Export(context.TODO(), st, 42)
+	c.Assert(err, check.IsNil)
+	c.Check(se, check.NotNil)
+	c.Check(exportedID, check.Equals, uint64(42))
+}
+
+func (snapshotSuite) TestImport(c *check.C) {
+	st := state.New(nil)
+	defer snapshotstate.MockBackendImport(func(_ context.Context, id uint64, r io.Reader) ([]string, error) {
+		// the state is not locked while importing
+		st.Lock()
+		st.Unlock()
+		c.Check(id, check.Equals, uint64(1))
+		data, err := ioutil.ReadAll(r)
+		c.Assert(err, check.IsNil)
+		c.Check(string(data), check.Equals, "exported")
+		return []string{"a-snap", "b-snap"}, nil
+	})()
+
+	setID, snapNames, err := snapshotstate.Import(context.TODO(), st, strings.NewReader("exported"))
+	c.Assert(err, check.IsNil)
+	c.Check(setID, check.Equals, uint64(1))
+	c.Check(snapNames, check.DeepEquals, []string{"a-snap", "b-snap"})
+}
+
+func (snapshotSuite) TestImportError(c *check.C) {
+	defer snapshotstate.MockBackendImport(func(context.Context, uint64, io.Reader) ([]string, error) {
+		return nil, errors.New("bzzt")
+	})()
+
+	st := state.New(nil)
+	_, _, err := snapshotstate.Import(context.TODO(), st, strings.NewReader(""))
+	c.Assert(err, check.ErrorMatches, "bzzt")
+
+	// the set ID is consumed regardless
+	st.Lock()
+	defer st.Unlock()
+	setID, err := snapshotstate.NewSnapshotSetID(st)
+	c.Assert(err, check.IsNil)
+	c.Check(setID, check.Equals, uint64(2))
+}
@@ -26,6 +26,7 @@ import (
 
 	"github.com/snapcore/snapd/i18n"
 	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/metrics"
 	"github.com/snapcore/snapd/overlord/auth"
 	"github.com/snapcore/snapd/overlord/configstate/config"
 	"github.com/snapcore/snapd/overlord/state"
@@ -51,6 +52,12 @@ var (
 // refreshRetryDelay specified the minimum time to retry failed refreshes
 var refreshRetryDelay = 30 * time.Minute
 
+var autoRefreshes = metrics.NewCounter("snapd_auto_refreshes_total", "Auto-refresh attempts, by outcome (\"failed\", \"up-to-date\" or \"started\").", "outcome")
+
+func init() {
+	metrics.Register(autoRefreshes)
+}
+
 // autoRefresh will ensure that snaps are refreshed automatically
 // according to the refresh schedule.
 type autoRefresh struct {
@@ -366,10 +373,14 @@ func (m *autoRefresh) refreshScheduleWithDefaultsFallback() (ts []*timeutil.Sche
 // launchAutoRefresh creates the auto-refresh taskset and a change for it.
 func (m *autoRefresh) launchAutoRefresh() error {
 	m.lastRefreshAttempt = time.Now()
+	if err := clearExpiredRefreshHolds(m.state, m.lastRefreshAttempt); err != nil {
+		return err
+	}
 	updated, tasksets, err := AutoRefresh(auth.EnsureContextTODO(), m.state)
 	m.state.Set("last-refresh", time.Now())
 	if err != nil {
 		logger.Noticef("Cannot prepare auto-refresh change: %s", err)
+		autoRefreshes.Inc("failed")
 		return err
 	}
 
@@ -377,6 +388,7 @@ func (m *autoRefresh) launchAutoRefresh() error {
 	switch len(updated) {
 	case 0:
 		logger.Noticef(i18n.G("auto-refresh: all snaps are up-to-date"))
+		autoRefreshes.Inc("up-to-date")
 		return nil
 	case 1:
 		msg = fmt.Sprintf(i18n.G("Auto-refresh snap %q"), updated[0])
@@ -394,6 +406,7 @@ func (m *autoRefresh) launchAutoRefresh() error {
 	}
 	chg.Set("snap-names", updated)
 	chg.Set("api-data", map[string]interface{}{"snap-names": updated})
+	autoRefreshes.Inc("started")
 
 	return nil
 }
@@ -118,11 +118,13 @@ func (s *autoRefreshTestSuite) TearDownTest(c *C) {
 
 func (s *autoRefreshTestSuite) TestLastRefresh(c *C) {
 	// this does an immediate refresh
+	upToDate := snapstate.AutoRefreshes.Value("up-to-date")
 
 	af := snapstate.NewAutoRefresh(s.state)
 	err := af.Ensure()
 	c.Check(err, IsNil)
 	c.Check(s.store.ops, DeepEquals, []string{"list-refresh"})
+	c.Check(snapstate.AutoRefreshes.Value("up-to-date"), Equals, upToDate+1)
 
 	var lastRefresh time.Time
 	s.state.Lock()
@@ -212,10 +214,12 @@ func (s *autoRefreshTestSuite) TestLastRefreshNoRefreshNeeded(c *C) {
 
 func (s *autoRefreshTestSuite) TestRefreshBackoff(c *C) {
 	s.store.err = fmt.Errorf("random store error")
+	failed := snapstate.AutoRefreshes.Value("failed")
 	af := snapstate.NewAutoRefresh(s.state)
 	err := af.Ensure()
 	c.Check(err, ErrorMatches, "random store error")
 	c.Check(s.store.ops, HasLen, 1)
+	c.Check(snapstate.AutoRefreshes.Value("failed"), Equals, failed+1)
 
 	// override next refresh to be here already
 	now := time.Now()
@@ -26,10 +26,12 @@ import (
 
 	"github.com/snapcore/snapd/asserts"
 	"github.com/snapcore/snapd/boot"
+	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/progress"
 	"github.com/snapcore/snapd/release"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/systemd"
 	"github.com/snapcore/snapd/wrappers"
 )
 
@@ -143,6 +145,29 @@ func (b Backend) StopServices(apps []*snap.AppInfo, reason snap.ServiceStopReaso
 	return wrappers.StopServices(apps, reason, meter)
 }
 
+// InactiveServices returns the names of the given services that are
+// enabled but not running.
+func (b Backend) InactiveServices(apps []*snap.AppInfo) ([]string, error) {
+	if len(apps) == 0 {
+		return nil, nil
+	}
+	units := make([]string, len(apps))
+	for i, app := range apps {
+		units[i] = app.ServiceName()
+	}
+	sts, err := systemd.New(dirs.GlobalRootDir, progress.Null).Status(units...)
+	if err != nil {
+		return nil, err
+	}
+	var inactive []string
+	for i, st := range sts {
+		if st.Enabled && !st.Active {
+			inactive = append(inactive, apps[i].Name)
+		}
+	}
+	return inactive, nil
+}
+
 func generateWrappers(s *snap.Info) error {
 	// add the CLI apps from the snap.yaml
 	if err := wrappers.AddSnapBinaries(s); err != nil {
@@ -222,6 +222,59 @@ func (s *linkSuite) TestLinkFailsForUnsetRevision(c *C) {
 	c.Assert(err, ErrorMatches, `cannot link snap "foo" with unset revision`)
 }
 
+func (s *linkSuite) TestInactiveServices(c *C) {
+	const yaml = `name: hello
+version: 1.0
+apps:
+ svc1:
+   command: svc1
+   daemon: simple
+ svc2:
+   command: svc2
+   daemon: simple
+ svc3:
+   command: svc3
+   daemon: simple
+`
+	info := snaptest.MockSnap(c, yaml, &snap.SideInfo{Revision: snap.R(11)})
+
+	var sysctlArgs [][]string
+	r := systemd.MockSystemctl(func(cmd ...string) ([]byte, error) {
+		sysctlArgs = append(sysctlArgs, cmd)
+		return []byte(`Type=simple
+Id=snap.hello.svc1.service
+ActiveState=active
+UnitFileState=enabled
+
+Type=simple
+Id=snap.hello.svc2.service
+ActiveState=failed
+UnitFileState=enabled
+
+Type=simple
+Id=snap.hello.svc3.service
+ActiveState=inactive
+UnitFileState=disabled
+`), nil
+	})
+	defer r()
+
+	apps := []*snap.AppInfo{info.Apps["svc1"], info.Apps["svc2"], info.Apps["svc3"]}
+	inactive, err := s.be.InactiveServices(apps)
+	c.Assert(err, IsNil)
+	c.Check(inactive, DeepEquals, []string{"svc2"})
+	c.Check(sysctlArgs, DeepEquals, [][]string{
+		{"show", "--property=Id,ActiveState,UnitFileState,Type", "snap.hello.svc1.service", "snap.hello.svc2.service", "snap.hello.svc3.service"},
+	})
+
+	// nothing to check
+	sysctlArgs = nil
+	inactive, err = s.be.InactiveServices(nil)
+	c.Assert(err, IsNil)
+	c.Check(inactive, HasLen, 0)
+	c.Check(sysctlArgs, HasLen, 0)
+}
+
 type linkCleanupSuite struct {
 	linkSuite
 	info *snap.Info
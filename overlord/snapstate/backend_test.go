@@ -595,6 +595,7 @@ type fakeSnappyBackend struct {
 
 	linkSnapFailTrigger     string
 	copySnapDataFailTrigger string
+	inactiveServicesTrigger string
 	emptyContainer          snap.Container
 }
 
@@ -704,6 +705,8 @@ func (f *fakeSnappyBackend) ReadInfo(name string, si *snap.SideInfo) (*snap.Info
 		info.Type = snap.TypeGadget
 	case "core":
 		info.Type = snap.TypeOS
+	case "some-base":
+		info.Type = snap.TypeBase
 	case "services-snap":
 		var err error
 		// fix services after/before so that there is only one solution
@@ -828,6 +831,22 @@ func (f *fakeSnappyBackend) StartServices(svcs []*snap.AppInfo, meter progress.M
 	return nil
 }
 
+func (f *fakeSnappyBackend) InactiveServices(svcs []*snap.AppInfo) ([]string, error) {
+	services := make([]string, 0, len(svcs))
+	for _, svc := range svcs {
+		services = append(services, svc.Name)
+	}
+	f.appendOp(&fakeOp{
+		op:       "check-snap-services",
+		path:     svcSnapMountDir(svcs),
+		services: services,
+	})
+	if svcSnapMountDir(svcs) == f.inactiveServicesTrigger {
+		return services, nil
+	}
+	return nil, nil
+}
+
 func (f *fakeSnappyBackend) StopServices(svcs []*snap.AppInfo, reason snap.ServiceStopReason, meter progress.Meter) error {
 	f.appendOp(&fakeOp{
 		op:   fmt.Sprintf("stop-snap-services:%s", reason),
@@ -114,6 +114,8 @@ var (
 	NewAutoRefresh                = newAutoRefresh
 	NewRefreshHints               = newRefreshHints
 	CanRefreshOnMeteredConnection = canRefreshOnMeteredConnection
+	AutoRefreshes                 = autoRefreshes
+	TaskPolicy                    = taskPolicy
 
 	NewCatalogRefresh            = newCatalogRefresh
 	CatalogRefreshDelayBase      = catalogRefreshDelayBase
@@ -227,6 +229,16 @@ func MockReRefreshUpdateMany(f func(context.Context, *state.State, []string, int
 	}
 }
 
+func MockHealthCheckRetryPolicy(delay time.Duration, maxAttempts int) (restore func()) {
+	// the policy is registered with the task runner already
+	old := *healthCheckRetryPolicy
+	healthCheckRetryPolicy.Delay = delay
+	healthCheckRetryPolicy.MaxAttempts = maxAttempts
+	return func() {
+		*healthCheckRetryPolicy = old
+	}
+}
+
 func MockReRefreshRetryTimeout(d time.Duration) (restore func()) {
 	old := reRefreshRetryTimeout
 	reRefreshRetryTimeout = d
@@ -1404,6 +1404,12 @@ func (m *SnapManager) doDiscardSnap(t *state.Task, _ *tomb.Tomb) error {
 		if err != nil {
 			return err
 		}
+		// and the health it reported
+		if DiscardSnapHealth != nil {
+			if err := DiscardSnapHealth(st, snapsup.InstanceName()); err != nil {
+				return err
+			}
+		}
 		err = m.backend.DiscardSnapNamespace(snapsup.InstanceName())
 		if err != nil {
 			t.Errorf("cannot discard snap namespace %q, will retry in 3 mins: %s", snapsup.InstanceName(), err)
@@ -0,0 +1,119 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapstate
+
+import (
+	"time"
+
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+)
+
+// RefreshHold describes a hold on the auto-refreshes of a single
+// snap instance. Unlike the global refresh.hold core setting it is
+// not limited by maxPostponement.
+type RefreshHold struct {
+	// Until is the time the hold expires; the zero time means the
+	// snap is held indefinitely.
+	Until time.Time `json:"until"`
+}
+
+// Held returns whether the hold is still in effect at the given time.
+func (h *RefreshHold) Held(now time.Time) bool {
+	if h == nil {
+		return false
+	}
+	return h.Until.IsZero() || h.Until.After(now)
+}
+
+// HoldRefreshes holds the auto-refreshes of the given snap instances
+// until the given time, or indefinitely if until is the zero
+// time. Manual refreshes are not affected.
+func HoldRefreshes(st *state.State, instanceNames []string, until time.Time) error {
+	snapStates, err := installedSnapStates(st, instanceNames)
+	if err != nil {
+		return err
+	}
+	for i, snapst := range snapStates {
+		snapst.RefreshHold = &RefreshHold{Until: until}
+		Set(st, instanceNames[i], snapst)
+	}
+	return nil
+}
+
+// UnholdRefreshes removes any auto-refresh hold from the given snap
+// instances.
+func UnholdRefreshes(st *state.State, instanceNames []string) error {
+	snapStates, err := installedSnapStates(st, instanceNames)
+	if err != nil {
+		return err
+	}
+	for i, snapst := range snapStates {
+		if snapst.RefreshHold == nil {
+			continue
+		}
+		snapst.RefreshHold = nil
+		Set(st, instanceNames[i], snapst)
+	}
+	return nil
+}
+
+// installedSnapStates returns the SnapStates of the given snap
+// instances, failing if any of them is not installed.
+func installedSnapStates(st *state.State, instanceNames []string) ([]*SnapState, error) {
+	snapStates := make([]*SnapState, len(instanceNames))
+	for i, name := range instanceNames {
+		var snapst SnapState
+		err := Get(st, name, &snapst)
+		if err != nil && err != state.ErrNoState {
+			return nil, err
+		}
+		if !snapst.IsInstalled() {
+			return nil, &snap.NotInstalledError{Snap: name}
+		}
+		snapStates[i] = &snapst
+	}
+	return snapStates, nil
+}
+
+// clearExpiredRefreshHolds drops the per-snap refresh holds that have
+// expired at the given time.
+func clearExpiredRefreshHolds(st *state.State, now time.Time) error {
+	snapStates, err := All(st)
+	if err != nil {
+		return err
+	}
+	for instanceName, snapst := range snapStates {
+		if snapst.RefreshHold == nil || snapst.RefreshHold.Held(now) {
+			continue
+		}
+		snapst.RefreshHold = nil
+		Set(st, instanceName, snapst)
+	}
+	return nil
+}
+
+// notHeldFilter returns an updateFilter that skips the snaps whose
+// auto-refreshes are held at the given time.
+func notHeldFilter(now time.Time) updateFilter {
+	return func(update *snap.Info, snapst *SnapState) bool {
+		return !snapst.RefreshHold.Held(now)
+	}
+}
@@ -0,0 +1,168 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapstate
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"gopkg.in/tomb.v2"
+
+	"github.com/snapcore/snapd/i18n"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/strutil"
+)
+
+// Outcomes of the health check of a snap refreshed in a staged refresh,
+// as recorded in the "refresh-health" entry of the change's api-data.
+const (
+	RefreshHealthy  = "healthy"
+	RefreshReverted = "reverted"
+)
+
+// healthCheckRetryPolicy is how check-snap-health tasks wait for the
+// services of a snap to come up: for about a minute, after which the
+// snap is deemed unhealthy and reverted.
+var healthCheckRetryPolicy = &state.RetryPolicy{
+	MaxAttempts: 13,
+	Delay:       5 * time.Second,
+}
+
+// refreshBatchSize returns how many snaps are refreshed together before
+// their health is checked, or 0 if refreshes are not staged.
+func refreshBatchSize(st *state.State) (int, error) {
+	var batchSize int
+	err := config.NewTransaction(st).Get("core", "refresh.batch-size", &batchSize)
+	if err != nil && !config.IsNoOption(err) {
+		return 0, err
+	}
+	return batchSize, nil
+}
+
+// addHealthChecks appends to the given refresh task set of a snap the
+// tasks checking the health of the snap once it has been refreshed:
+// its check-health hook, if any, followed by the liveness of its
+// services.
+func addHealthChecks(st *state.State, ts *state.TaskSet, snapName string) {
+	var setupTaskID string
+	for _, t := range ts.Tasks() {
+		if t.Has("snap-setup") {
+			setupTaskID = t.ID()
+			break
+		}
+	}
+
+	checkHealthHook := SetupCheckHealthHook(st, snapName)
+	checkHealthHook.WaitAll(ts)
+
+	checkHealth := st.NewTask("check-snap-health", fmt.Sprintf(i18n.G("Check health of snap %q"), snapName))
+	checkHealth.Set("snap-setup-task", setupTaskID)
+	checkHealth.WaitFor(checkHealthHook)
+
+	ts.AddTask(checkHealthHook)
+	ts.AddTask(checkHealth)
+}
+
+// batchRefreshes makes every batch of batchSize refreshes wait for
+// the previous batch, so that a failing health check in one batch
+// holds the ones after it.
+func batchRefreshes(tasksets []*state.TaskSet, batchSize int) {
+	for i := batchSize; i < len(tasksets); i++ {
+		start := (i/batchSize - 1) * batchSize
+		for _, prev := range tasksets[start : start+batchSize] {
+			tasksets[i].WaitAll(prev)
+		}
+	}
+}
+
+// SetRefreshHealth records the outcome of the health check of the
+// given snap in the change.
+func SetRefreshHealth(chg *state.Change, snapName, outcome string) {
+	var data map[string]interface{}
+	if err := chg.Get("api-data", &data); err != nil && err != state.ErrNoState {
+		logger.Noticef("cannot record health of snap %q: %v", snapName, err)
+		return
+	}
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+	health, _ := data["refresh-health"].(map[string]interface{})
+	if health == nil {
+		health = make(map[string]interface{})
+	}
+	health[snapName] = outcome
+	data["refresh-health"] = health
+	chg.Set("api-data", data)
+}
+
+// healthCheckedServices returns the services of the snap that are
+// expected to keep running after a refresh.
+func healthCheckedServices(info *snap.Info) []*snap.AppInfo {
+	var svcs []*snap.AppInfo
+	for _, app := range info.Services() {
+		if app.Daemon == "oneshot" || len(app.Sockets) != 0 || app.Timer != nil {
+			// not supposed to be running all the time
+			continue
+		}
+		svcs = append(svcs, app)
+	}
+	return svcs
+}
+
+func (m *SnapManager) doCheckSnapHealth(t *state.Task, _ *tomb.Tomb) error {
+	st := t.State()
+	st.Lock()
+	defer st.Unlock()
+
+	snapsup, snapst, err := snapSetupAndState(t)
+	if err != nil {
+		return err
+	}
+	info, err := snapst.CurrentInfo()
+	if err != nil {
+		return err
+	}
+
+	st.Unlock()
+	inactive, err := m.backend.InactiveServices(healthCheckedServices(info))
+	st.Lock()
+	if err != nil {
+		return err
+	}
+
+	if len(inactive) == 0 {
+		SetRefreshHealth(t.Change(), snapsup.InstanceName(), RefreshHealthy)
+		return nil
+	}
+
+	sort.Strings(inactive)
+	reason := fmt.Sprintf("services %s are not running", strutil.Quoted(inactive))
+	if t.DoingRetries()+1 < healthCheckRetryPolicy.MaxAttempts {
+		return &state.Retry{Reason: reason}
+	}
+
+	// the task runner gives up on this last attempt, reverting the snap
+	SetRefreshHealth(t.Change(), snapsup.InstanceName(), RefreshReverted)
+	return &state.Retry{Reason: fmt.Sprintf("snap %q is unhealthy: %s", snapsup.InstanceName(), reason)}
+}
@@ -0,0 +1,230 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapstate_test
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/hookstate"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/testutil"
+)
+
+func (s *snapmgrTestSuite) setupStagedRefresh(c *C, batchSize int) {
+	tr := config.NewTransaction(s.state)
+	tr.Set("core", "refresh.batch-size", batchSize)
+	tr.Commit()
+
+	for _, name := range []string{"some-snap", "services-snap", "snap-with-snapd-control"} {
+		snapstate.Set(s.state, name, &snapstate.SnapState{
+			Active: true,
+			Sequence: []*snap.SideInfo{
+				{RealName: name, SnapID: name + "-id", Revision: snap.R(1)},
+			},
+			Current:  snap.R(1),
+			SnapType: "app",
+		})
+	}
+}
+
+// stagedTaskSets returns the refresh task sets of the given update
+// by snap name.
+func stagedTaskSets(c *C, tts []*state.TaskSet) map[string]*state.TaskSet {
+	byName := make(map[string]*state.TaskSet)
+	for _, ts := range tts[:len(tts)-1] {
+		snapsup, err := snapstate.TaskSnapSetup(ts.Tasks()[0])
+		c.Assert(err, IsNil)
+		byName[snapsup.InstanceName()] = ts
+	}
+	return byName
+}
+
+func (s *snapmgrTestSuite) TestUpdateManyStagedTasks(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.setupStagedRefresh(c, 2)
+
+	updates, tts, err := snapstate.UpdateMany(context.TODO(), s.state, nil, 0, nil)
+	c.Assert(err, IsNil)
+	c.Assert(tts, HasLen, 4)
+	verifyLastTasksetIsReRefresh(c, tts)
+	c.Check(updates, HasLen, 3)
+
+	chg := s.state.NewChange("refresh", "refresh all snaps")
+	for _, ts := range tts {
+		chg.AddAll(ts)
+	}
+
+	for _, ts := range tts[:3] {
+		tasks := ts.Tasks()
+		hook := tasks[len(tasks)-2]
+		check := tasks[len(tasks)-1]
+		c.Check(hook.Kind(), Equals, "run-hook")
+		var hooksup hookstate.HookSetup
+		c.Assert(hook.Get("hook-setup", &hooksup), IsNil)
+		c.Check(hooksup.Hook, Equals, "check-health")
+		c.Check(hooksup.Optional, Equals, true)
+		c.Check(check.Kind(), Equals, "check-snap-health")
+		c.Check(check.WaitTasks(), testutil.Contains, hook)
+		c.Check(check.Lanes(), DeepEquals, tasks[0].Lanes())
+
+		snapsup, err := snapstate.TaskSnapSetup(check)
+		c.Assert(err, IsNil)
+		c.Check(hooksup.Snap, Equals, snapsup.InstanceName())
+	}
+
+	// the first batch does not wait on anything else, the second
+	// batch waits for all of the first one
+	first := []*state.TaskSet{tts[0], tts[1]}
+	for _, ts := range first {
+		for _, t := range ts.Tasks() {
+			for _, w := range t.WaitTasks() {
+				c.Check(w.Lanes(), DeepEquals, t.Lanes())
+			}
+		}
+	}
+	prereq := tts[2].Tasks()[0]
+	for _, ts := range first {
+		for _, t := range ts.Tasks() {
+			c.Check(prereq.WaitTasks(), testutil.Contains, t)
+		}
+	}
+}
+
+func (s *snapmgrTestSuite) TestUpdateManyNotStaged(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.setupStagedRefresh(c, 0)
+
+	_, tts, err := snapstate.UpdateMany(context.TODO(), s.state, nil, 0, nil)
+	c.Assert(err, IsNil)
+	c.Assert(tts, HasLen, 4)
+	for _, ts := range tts[:3] {
+		for _, t := range ts.Tasks() {
+			c.Check(t.Kind(), Not(Equals), "check-snap-health")
+		}
+	}
+}
+
+func (s *snapmgrTestSuite) TestUpdateManyStagedRunThrough(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.setupStagedRefresh(c, 1)
+
+	chg := s.state.NewChange("refresh", "refresh all snaps")
+	_, tts, err := snapstate.UpdateMany(context.TODO(), s.state, nil, 0, nil)
+	c.Assert(err, IsNil)
+	for _, ts := range tts {
+		chg.AddAll(ts)
+	}
+
+	s.state.Unlock()
+	defer s.se.Stop()
+	s.settle(c)
+	s.state.Lock()
+
+	c.Assert(chg.Err(), IsNil)
+	c.Assert(chg.Status(), Equals, state.DoneStatus)
+
+	var data map[string]map[string]string
+	c.Assert(chg.Get("api-data", &data), IsNil)
+	c.Check(data["refresh-health"], DeepEquals, map[string]string{
+		"some-snap":               "healthy",
+		"services-snap":           "healthy",
+		"snap-with-snapd-control": "healthy",
+	})
+
+	var checked []string
+	for _, op := range s.fakeBackend.ops {
+		if op.op == "check-snap-services" {
+			checked = append(checked, op.path)
+		}
+	}
+	c.Check(checked, testutil.Contains, filepath.Join(dirs.SnapMountDir, "services-snap/11"))
+}
+
+func (s *snapmgrTestSuite) TestUpdateManyStagedUnhealthyReverts(c *C) {
+	restore := snapstate.MockHealthCheckRetryPolicy(time.Millisecond, 3)
+	defer restore()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.setupStagedRefresh(c, 1)
+	s.fakeBackend.inactiveServicesTrigger = filepath.Join(dirs.SnapMountDir, "services-snap/11")
+
+	chg := s.state.NewChange("refresh", "refresh all snaps")
+	_, tts, err := snapstate.UpdateMany(context.TODO(), s.state, nil, 0, nil)
+	c.Assert(err, IsNil)
+	for _, ts := range tts {
+		chg.AddAll(ts)
+	}
+	byName := stagedTaskSets(c, tts)
+
+	s.state.Unlock()
+	defer s.se.Stop()
+	s.settle(c)
+	s.state.Lock()
+
+	c.Assert(chg.Status(), Equals, state.ErrorStatus)
+	c.Check(chg.Err(), ErrorMatches, `(?s).*giving up after 3 attempts: snap "services-snap" is unhealthy: services "svc1", "svc2", "svc3" are not running.*`)
+
+	// the unhealthy snap was reverted
+	var snapst snapstate.SnapState
+	c.Assert(snapstate.Get(s.state, "services-snap", &snapst), IsNil)
+	c.Check(snapst.Current, Equals, snap.R(1))
+
+	var check *state.Task
+	for _, t := range byName["services-snap"].Tasks() {
+		if t.Kind() == "check-snap-health" {
+			check = t
+		}
+	}
+	c.Assert(check, NotNil)
+	c.Check(check.DoingRetries(), Equals, 3)
+	c.Check(check.Status(), Equals, state.ErrorStatus)
+
+	var data map[string]map[string]string
+	c.Assert(chg.Get("api-data", &data), IsNil)
+	c.Check(data["refresh-health"]["services-snap"], Equals, "reverted")
+
+	// the batches after the unhealthy one (the first one, as
+	// refreshes are ordered by name) never ran
+	for _, name := range []string{"snap-with-snapd-control", "some-snap"} {
+		for _, t := range byName[name].Tasks() {
+			c.Check(t.Status(), Equals, state.HoldStatus, Commentf("%s: %s", name, t.Kind()))
+		}
+		_, ok := data["refresh-health"][name]
+		c.Check(ok, Equals, false, Commentf(name))
+		c.Assert(snapstate.Get(s.state, name, &snapst), IsNil)
+		c.Check(snapst.Current, Equals, snap.R(1), Commentf(name))
+	}
+}
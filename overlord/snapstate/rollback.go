@@ -0,0 +1,254 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapstate
+
+import (
+	"fmt"
+
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/strutil"
+)
+
+// rollbackKinds are the kinds of changes that can be rolled back.
+var rollbackKinds = map[string]bool{
+	"install-snap": true,
+	"refresh-snap": true,
+	"auto-refresh": true,
+	"connect-snap": true,
+	"alias":        true,
+}
+
+// A RollbackFunc returns the task set undoing what the given done task
+// did, if anything, and the snaps that affects. The snaps the rollback
+// removes are given too, what the task did for those need not be
+// undone.
+type RollbackFunc func(t *state.Task, removed map[string]bool) (*state.TaskSet, []string, error)
+
+var rollbackByKind = map[string]RollbackFunc{
+	"link-snap": rollbackLinkSnap,
+	"alias":     rollbackAlias,
+}
+
+// AddRollbackByKind registers a RollbackFunc for undoing the done tasks of the given kind when rolling back a change.
+func AddRollbackByKind(kind string, f RollbackFunc) {
+	rollbackByKind[kind] = f
+}
+
+// Rollback returns the task sets taking the snap revisions,
+// connections and aliases affected by the given completed change back
+// to what they were before it, using what its tasks recorded, and the
+// snaps they affect. The task sets undo things one at a time, in the
+// reverse order they were done.
+//
+// Snaps installed by the change are removed, except for bases that are
+// still in use, as those installed as a prerequisite of a snap are.
+func Rollback(st *state.State, chg *state.Change) ([]*state.TaskSet, []string, error) {
+	if !rollbackKinds[chg.Kind()] {
+		return nil, nil, fmt.Errorf("%q changes cannot be rolled back", chg.Kind())
+	}
+	if chg.Status() != state.DoneStatus {
+		return nil, nil, fmt.Errorf("change is not done")
+	}
+
+	tasks := chg.Tasks()
+	removed, err := rollbackRemovedSnaps(st, tasks)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var tss []*state.TaskSet
+	var affected []string
+	for i := len(tasks) - 1; i >= 0; i-- {
+		t := tasks[i]
+		if t.Status() != state.DoneStatus {
+			continue
+		}
+		rollback := rollbackByKind[t.Kind()]
+		if rollback == nil {
+			continue
+		}
+		ts, snaps, err := rollback(t, removed)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ts == nil {
+			continue
+		}
+		if len(tss) > 0 {
+			ts.WaitAll(tss[len(tss)-1])
+		}
+		tss = append(tss, ts)
+		for _, name := range snaps {
+			if !strutil.ListContains(affected, name) {
+				affected = append(affected, name)
+			}
+		}
+	}
+	if len(tss) == 0 {
+		return nil, nil, fmt.Errorf("nothing to roll back")
+	}
+	return tss, affected, nil
+}
+
+// rollbackRemovedSnaps returns the snaps the done link-snap tasks
+// installed, that rolling them back removes as a whole.
+func rollbackRemovedSnaps(st *state.State, tasks []*state.Task) (map[string]bool, error) {
+	removed := make(map[string]bool)
+	for _, t := range tasks {
+		if t.Kind() != "link-snap" || t.Status() != state.DoneStatus {
+			continue
+		}
+		snapsup, err := TaskSnapSetup(t)
+		if err != nil {
+			return nil, err
+		}
+		var oldCurrent snap.Revision
+		if err := t.Get("old-current", &oldCurrent); err != nil && err != state.ErrNoState {
+			return nil, err
+		}
+		if !oldCurrent.Unset() {
+			continue
+		}
+		keep, err := keepOnRollback(st, snapsup.InstanceName())
+		if err != nil {
+			return nil, err
+		}
+		if !keep {
+			removed[snapsup.InstanceName()] = true
+		}
+	}
+	return removed, nil
+}
+
+// keepOnRollback returns whether the given snap, installed by the
+// change being rolled back, is a base or core that cannot be removed
+// as other snaps use it. These are not removed, and they would not be
+// removable as part of the rollback either: when the rollback is
+// planned the snaps using them are still installed.
+func keepOnRollback(st *state.State, name string) (bool, error) {
+	var snapst SnapState
+	err := Get(st, name, &snapst)
+	if err == state.ErrNoState {
+		// reported when planning its removal
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	typ, err := snapst.Type()
+	if err != nil {
+		return false, err
+	}
+	if typ != snap.TypeBase && typ != snap.TypeOS {
+		return false, nil
+	}
+	info, err := snapst.CurrentInfo()
+	if err != nil {
+		return false, err
+	}
+	return !canRemove(st, info, &snapst, true), nil
+}
+
+// rollbackLinkSnap reverts the snap to the revision it had before, or
+// removes it if it was installed by the task.
+func rollbackLinkSnap(t *state.Task, removed map[string]bool) (*state.TaskSet, []string, error) {
+	st := t.State()
+	snapsup, err := TaskSnapSetup(t)
+	if err != nil {
+		return nil, nil, err
+	}
+	name := snapsup.InstanceName()
+	var oldCurrent snap.Revision
+	if err := t.Get("old-current", &oldCurrent); err != nil && err != state.ErrNoState {
+		return nil, nil, err
+	}
+	if oldCurrent.Unset() && !removed[name] {
+		// a base that is kept
+		return nil, nil, nil
+	}
+
+	var snapst SnapState
+	err = Get(st, name, &snapst)
+	if err == state.ErrNoState {
+		return nil, nil, fmt.Errorf("snap %q was removed since", name)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if snapst.Current != snapsup.Revision() {
+		return nil, nil, fmt.Errorf("snap %q is no longer at revision %s", name, snapsup.Revision())
+	}
+
+	var ts *state.TaskSet
+	if oldCurrent.Unset() {
+		ts, err = Remove(st, name, snap.R(0), nil)
+	} else {
+		ts, err = RevertToRevision(st, name, oldCurrent, Flags{})
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return ts, []string{name}, nil
+}
+
+// rollbackAlias removes the manual alias the task set up, or points it
+// back to its previous target.
+func rollbackAlias(t *state.Task, removed map[string]bool) (*state.TaskSet, []string, error) {
+	st := t.State()
+	snapsup, err := TaskSnapSetup(t)
+	if err != nil {
+		return nil, nil, err
+	}
+	name := snapsup.InstanceName()
+	if removed[name] {
+		return nil, nil, nil
+	}
+	var alias, target string
+	if err := t.Get("alias", &alias); err != nil {
+		return nil, nil, err
+	}
+	if err := t.Get("target", &target); err != nil {
+		return nil, nil, err
+	}
+	var oldAliases map[string]*AliasTarget
+	if err := t.Get("old-aliases-v2", &oldAliases); err != nil && err != state.ErrNoState {
+		return nil, nil, err
+	}
+
+	var snapst SnapState
+	if err := Get(st, name, &snapst); err != nil && err != state.ErrNoState {
+		return nil, nil, err
+	}
+	if cur := snapst.Aliases[alias]; cur == nil || cur.Manual != target {
+		return nil, nil, fmt.Errorf("alias %q no longer points to %s.%s", alias, name, target)
+	}
+
+	var ts *state.TaskSet
+	if old := oldAliases[alias]; old != nil && old.Manual != "" {
+		ts, err = Alias(st, name, old.Manual, alias)
+	} else {
+		ts, _, err = RemoveManualAlias(st, alias)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return ts, []string{name}, nil
+}
@@ -0,0 +1,221 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapstate_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snaptest"
+)
+
+func (s *snapmgrTestSuite) setRollbackSnapState(name string, typ snap.Type, current snap.Revision, revs ...snap.Revision) {
+	snapst := &snapstate.SnapState{Active: true, Current: current, SnapType: string(typ)}
+	for _, rev := range revs {
+		snapst.Sequence = append(snapst.Sequence, &snap.SideInfo{RealName: name, Revision: rev})
+	}
+	snapstate.Set(s.state, name, snapst)
+}
+
+func (s *snapmgrTestSuite) newDoneLinkSnapTask(name string, rev, oldCurrent snap.Revision) *state.Task {
+	t := s.state.NewTask("link-snap", "...")
+	t.Set("snap-setup", &snapstate.SnapSetup{
+		SideInfo: &snap.SideInfo{RealName: name, Revision: rev},
+	})
+	if !oldCurrent.Unset() {
+		t.Set("old-current", oldCurrent)
+	}
+	t.SetStatus(state.DoneStatus)
+	return t
+}
+
+func taskSetKinds(ts *state.TaskSet) []string {
+	var kinds []string
+	for _, t := range ts.Tasks() {
+		kinds = append(kinds, t.Kind())
+	}
+	return kinds
+}
+
+func taskSetSnap(c *C, ts *state.TaskSet) string {
+	snapsup, err := snapstate.TaskSnapSetup(ts.Tasks()[0])
+	c.Assert(err, IsNil)
+	return snapsup.InstanceName()
+}
+
+func (s *snapmgrTestSuite) TestRollbackRefreshAndInstall(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.setRollbackSnapState("some-snap", snap.TypeApp, snap.R(2), snap.R(1), snap.R(2))
+	s.setRollbackSnapState("other-snap", snap.TypeApp, snap.R(3), snap.R(3))
+	chg := s.state.NewChange("refresh-snap", "...")
+	chg.AddTask(s.newDoneLinkSnapTask("some-snap", snap.R(2), snap.R(1)))
+	chg.AddTask(s.newDoneLinkSnapTask("other-snap", snap.R(3), snap.R(0)))
+
+	tss, affected, err := snapstate.Rollback(s.state, chg)
+	c.Assert(err, IsNil)
+	c.Check(affected, DeepEquals, []string{"other-snap", "some-snap"})
+	c.Assert(tss, HasLen, 2)
+
+	// the last thing done is undone first
+	c.Check(taskSetSnap(c, tss[0]), Equals, "other-snap")
+	c.Check(taskSetKinds(tss[0]), DeepEquals, []string{"stop-snap-services", "run-hook", "auto-disconnect", "remove-aliases", "unlink-snap", "remove-profiles", "clear-snap", "discard-snap"})
+	c.Check(taskSetSnap(c, tss[1]), Equals, "some-snap")
+	c.Check(taskSetKinds(tss[1]), DeepEquals, []string{"prerequisites", "prepare-snap", "stop-snap-services", "remove-aliases", "unlink-current-snap", "setup-profiles", "link-snap", "auto-connect", "set-auto-aliases", "setup-aliases", "start-snap-services", "run-hook"})
+	c.Check(tss[1].Tasks()[0].WaitTasks(), DeepEquals, tss[0].Tasks())
+}
+
+func (s *snapmgrTestSuite) TestRollbackKeepsBaseInUse(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	// some-snap was installed with some-base as its prerequisite
+	si := &snap.SideInfo{RealName: "some-snap", Revision: snap.R(1)}
+	snaptest.MockSnap(c, "name: some-snap\nversion: 1.0\nbase: some-base", si)
+	s.setRollbackSnapState("some-snap", snap.TypeApp, snap.R(1), snap.R(1))
+	s.setRollbackSnapState("some-base", snap.TypeBase, snap.R(2), snap.R(2))
+	chg := s.state.NewChange("install-snap", "...")
+	chg.AddTask(s.newDoneLinkSnapTask("some-snap", snap.R(1), snap.R(0)))
+	chg.AddTask(s.newDoneLinkSnapTask("some-base", snap.R(2), snap.R(0)))
+
+	tss, affected, err := snapstate.Rollback(s.state, chg)
+	c.Assert(err, IsNil)
+	c.Check(affected, DeepEquals, []string{"some-snap"})
+	c.Assert(tss, HasLen, 1)
+	c.Check(taskSetSnap(c, tss[0]), Equals, "some-snap")
+
+	// a base nothing uses is removed
+	chg = s.state.NewChange("install-snap", "...")
+	chg.AddTask(s.newDoneLinkSnapTask("some-base", snap.R(2), snap.R(0)))
+	snapstate.Set(s.state, "some-snap", nil)
+
+	tss, affected, err = snapstate.Rollback(s.state, chg)
+	c.Assert(err, IsNil)
+	c.Check(affected, DeepEquals, []string{"some-base"})
+	c.Assert(tss, HasLen, 1)
+	c.Check(taskSetSnap(c, tss[0]), Equals, "some-base")
+}
+
+func (s *snapmgrTestSuite) TestRollbackErrors(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.setRollbackSnapState("some-snap", snap.TypeApp, snap.R(3), snap.R(1), snap.R(2), snap.R(3))
+	refresh := s.state.NewChange("refresh-snap", "...")
+	refresh.AddTask(s.newDoneLinkSnapTask("some-snap", snap.R(2), snap.R(1)))
+	remove := s.state.NewChange("remove-snap", "...")
+	remove.AddTask(s.newDoneLinkSnapTask("some-snap", snap.R(2), snap.R(1)))
+	inProgress := s.state.NewChange("refresh-snap", "...")
+	inProgress.AddTask(s.state.NewTask("link-snap", "..."))
+	nothing := s.state.NewChange("connect-snap", "...")
+	t := s.state.NewTask("run-hook", "...")
+	t.SetStatus(state.DoneStatus)
+	nothing.AddTask(t)
+	gone := s.state.NewChange("install-snap", "...")
+	gone.AddTask(s.newDoneLinkSnapTask("other-snap", snap.R(1), snap.R(0)))
+
+	for _, t := range []struct {
+		chg *state.Change
+		err string
+	}{
+		{refresh, `snap "some-snap" is no longer at revision 2`},
+		{remove, `"remove-snap" changes cannot be rolled back`},
+		{inProgress, `change is not done`},
+		{nothing, `nothing to roll back`},
+		{gone, `snap "other-snap" was removed since`},
+	} {
+		_, _, err := snapstate.Rollback(s.state, t.chg)
+		c.Check(err, ErrorMatches, t.err)
+	}
+}
+
+func (s *snapmgrTestSuite) TestRollbackByKind(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	var seen []map[string]bool
+	snapstate.AddRollbackByKind("rollback-test", func(t *state.Task, removed map[string]bool) (*state.TaskSet, []string, error) {
+		seen = append(seen, removed)
+		return state.NewTaskSet(t.State().NewTask("undo-rollback-test", "...")), []string{"other-snap"}, nil
+	})
+
+	s.setRollbackSnapState("some-snap", snap.TypeApp, snap.R(1), snap.R(1))
+	chg := s.state.NewChange("install-snap", "...")
+	chg.AddTask(s.newDoneLinkSnapTask("some-snap", snap.R(1), snap.R(0)))
+	t := s.state.NewTask("rollback-test", "...")
+	t.SetStatus(state.DoneStatus)
+	chg.AddTask(t)
+
+	tss, affected, err := snapstate.Rollback(s.state, chg)
+	c.Assert(err, IsNil)
+	c.Check(seen, DeepEquals, []map[string]bool{{"some-snap": true}})
+	c.Check(affected, DeepEquals, []string{"other-snap", "some-snap"})
+	c.Assert(tss, HasLen, 2)
+	c.Check(taskSetKinds(tss[0]), DeepEquals, []string{"undo-rollback-test"})
+}
+
+func (s *snapmgrTestSuite) TestRollbackAlias(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.Set(s.state, "alias-snap", &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{{RealName: "alias-snap", Revision: snap.R(11)}},
+		Current:  snap.R(11),
+		Aliases: map[string]*snapstate.AliasTarget{
+			"new":        {Manual: "cmd1"},
+			"retargeted": {Manual: "cmd2"},
+		},
+	})
+	chg := s.state.NewChange("alias", "...")
+	for _, alias := range []struct {
+		alias, target string
+		old           map[string]*snapstate.AliasTarget
+	}{
+		{"new", "cmd1", nil},
+		{"retargeted", "cmd2", map[string]*snapstate.AliasTarget{"retargeted": {Manual: "cmd1"}}},
+	} {
+		t := s.state.NewTask("alias", "...")
+		t.Set("snap-setup", &snapstate.SnapSetup{SideInfo: &snap.SideInfo{RealName: "alias-snap"}})
+		t.Set("alias", alias.alias)
+		t.Set("target", alias.target)
+		t.Set("old-aliases-v2", alias.old)
+		t.SetStatus(state.DoneStatus)
+		chg.AddTask(t)
+	}
+
+	tss, affected, err := snapstate.Rollback(s.state, chg)
+	c.Assert(err, IsNil)
+	c.Check(affected, DeepEquals, []string{"alias-snap"})
+	c.Assert(tss, HasLen, 2)
+	c.Check(taskSetKinds(tss[0]), DeepEquals, []string{"alias"})
+	var alias, target string
+	t := tss[0].Tasks()[0]
+	c.Assert(t.Get("alias", &alias), IsNil)
+	c.Assert(t.Get("target", &target), IsNil)
+	c.Check(alias, Equals, "retargeted")
+	c.Check(target, Equals, "cmd1")
+	c.Check(taskSetKinds(tss[1]), DeepEquals, []string{"unalias"})
+	c.Assert(tss[1].Tasks()[0].Get("alias", &alias), IsNil)
+	c.Check(alias, Equals, "new")
+}
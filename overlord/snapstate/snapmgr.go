@@ -48,6 +48,7 @@ var errtrackerReport = errtracker.Report
 // SnapManager is responsible for the installation and removal of snaps.
 type SnapManager struct {
 	state   *state.State
+	runner  *state.TaskRunner
 	backend managerBackend
 
 	autoRefresh    *autoRefresh
@@ -139,6 +140,10 @@ type SnapState struct {
 	// InstanceKey is set by the user during installation and differs for
 	// each instance of given snap
 	InstanceKey string `json:"instance-key,omitempty"`
+
+	// RefreshHold is set when auto-refreshes of the snap are held,
+	// see holds.go
+	RefreshHold *RefreshHold `json:"refresh-hold,omitempty"`
 }
 
 // Type returns the type of the snap or an error.
@@ -330,6 +335,7 @@ func Store(st *state.State) StoreService {
 func Manager(st *state.State, runner *state.TaskRunner) (*SnapManager, error) {
 	m := &SnapManager{
 		state:          st,
+		runner:         runner,
 		backend:        backend.Backend{},
 		autoRefresh:    newAutoRefresh(st),
 		refreshHints:   newRefreshHints(st),
@@ -365,6 +371,7 @@ func Manager(st *state.State, runner *state.TaskRunner) (*SnapManager, error) {
 	runner.AddHandler("switch-snap-channel", m.doSwitchSnapChannel, nil)
 	runner.AddHandler("toggle-snap-flags", m.doToggleSnapFlags, nil)
 	runner.AddHandler("check-rerefresh", m.doCheckReRefresh, nil)
+	runner.AddHandlerWithRetryPolicy("check-snap-health", m.doCheckSnapHealth, nil, healthCheckRetryPolicy)
 
 	// FIXME: drop the task entirely after a while
 	// (having this wart here avoids yet-another-patch)
@@ -656,6 +663,7 @@ func (m *SnapManager) Ensure() error {
 		m.refreshHints.Ensure(),
 		m.catalogRefresh.Ensure(),
 		m.localInstallCleanup(),
+		m.ensureTaskPolicy(),
 	}
 
 	//FIXME: use firstErr helper
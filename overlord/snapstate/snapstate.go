@@ -360,6 +360,10 @@ var SetupRemoveHook = func(st *state.State, snapName string) *state.Task {
 	panic("internal error: snapstate.SetupRemoveHook is unset")
 }
 
+var SetupCheckHealthHook = func(st *state.State, snapName string) *state.Task {
+	panic("internal error: snapstate.SetupCheckHealthHook is unset")
+}
+
 // WaitRestart will return a Retry error if there is a pending restart
 // and a real error if anything went wrong (like a rollback across
 // restarts)
@@ -861,6 +865,13 @@ func doUpdate(ctx context.Context, st *state.State, names []string, updates []*s
 		reportUpdated[snapName] = true
 	}
 
+	batchSize, err := refreshBatchSize(st)
+	if err != nil {
+		return nil, nil, err
+	}
+	// refreshes of non-prereq snaps staged in batches
+	var staged []*state.TaskSet
+
 	// first snapd, core, bases, then rest
 	sort.Stable(snap.ByType(updates))
 	prereqs := make(map[string]*state.TaskSet)
@@ -923,12 +934,18 @@ func doUpdate(ctx context.Context, st *state.State, names []string, updates []*s
 			}
 			return nil, nil, err
 		}
+
+		isPrereq := update.Type == snap.TypeOS || update.Type == snap.TypeBase || update.InstanceName() == "snapd"
+		if batchSize > 0 && !isPrereq {
+			addHealthChecks(st, ts, update.InstanceName())
+			staged = append(staged, ts)
+		}
 		ts.JoinLane(st.NewLane())
 
 		// because of the sorting of updates we fill prereqs
 		// first (if branch) and only then use it to setup
 		// waits (else branch)
-		if update.Type == snap.TypeOS || update.Type == snap.TypeBase || update.InstanceName() == "snapd" {
+		if isPrereq {
 			// prereq types come first in updates, we
 			// also assume bases don't have hooks, otherwise
 			// they would need to wait on core or snapd
@@ -948,6 +965,10 @@ func doUpdate(ctx context.Context, st *state.State, names []string, updates []*s
 		tasksets = append(tasksets, ts)
 	}
 
+	if batchSize > 0 {
+		batchRefreshes(staged, batchSize)
+	}
+
 	if len(newAutoAliases) != 0 {
 		addAutoAliasesTs, err := applyAutoAliasesDelta(st, newAutoAliases, "refresh", refreshAll, scheduleUpdate)
 		if err != nil {
@@ -1338,8 +1359,8 @@ func infoForUpdate(st *state.State, snapst *SnapState, name, channel string, rev
 var AutoRefreshAssertions func(st *state.State, userID int) error
 
 // AutoRefresh is the wrapper that will do a refresh of all the installed
-// snaps on the system. In addition to that it will also refresh important
-// assertions.
+// snaps on the system, skipping the ones whose refreshes are held. In
+// addition to that it will also refresh important assertions.
 func AutoRefresh(ctx context.Context, st *state.State) ([]string, []*state.TaskSet, error) {
 	userID := 0
 
@@ -1349,7 +1370,7 @@ func AutoRefresh(ctx context.Context, st *state.State) ([]string, []*state.TaskS
 		}
 	}
 
-	return UpdateMany(ctx, st, nil, userID, &Flags{IsAutoRefresh: true})
+	return updateManyFiltered(ctx, st, nil, userID, notHeldFilter(time.Now()), &Flags{IsAutoRefresh: true}, "")
 }
 
 // Enable sets a snap to the active state
@@ -1587,9 +1608,24 @@ func canRemove(st *state.State, si *snap.Info, snapst *SnapState, removeAll bool
 	return true
 }
 
+// RemoveFlags are used to pass additional flags to the Remove operation.
+type RemoveFlags struct {
+	// Remove the snap without creating an automatic snapshot
+	Purge bool
+}
+
+// AutomaticSnapshot allows to hook taking an automatic snapshot of
+// the data of a snap into its removal. It returns a nil TaskSet if
+// automatic snapshots are disabled.
+var AutomaticSnapshot func(st *state.State, instanceName string) (ts *state.TaskSet, err error)
+
+// DiscardSnapHealth allows to hook dropping the health a snap reported
+// into its removal.
+var DiscardSnapHealth func(st *state.State, instanceName string) error
+
 // Remove returns a set of tasks for removing snap.
 // Note that the state must be locked by the caller.
-func Remove(st *state.State, name string, revision snap.Revision) (*state.TaskSet, error) {
+func Remove(st *state.State, name string, revision snap.Revision, flags *RemoveFlags) (*state.TaskSet, error) {
 	var snapst SnapState
 	err := Get(st, name, &snapst)
 	if err != nil && err != state.ErrNoState {
@@ -1673,8 +1709,20 @@ func Remove(st *state.State, name string, revision snap.Revision) (*state.TaskSe
 		prev = stopSnapServices
 	}
 
-	// only run remove hook if uninstalling the snap completely
 	if removeAll {
+		// take an automatic snapshot of the data before the remove
+		// hook gets to change it, unless asked not to
+		if AutomaticSnapshot != nil && (flags == nil || !flags.Purge) {
+			ts, err := AutomaticSnapshot(st, name)
+			if err != nil {
+				return nil, err
+			}
+			if ts != nil {
+				addNext(ts)
+			}
+		}
+
+		// only run remove hook if uninstalling the snap completely
 		removeHook := SetupRemoveHook(st, snapsup.InstanceName())
 		addNext(state.NewTaskSet(removeHook))
 		prev = removeHook
@@ -1750,7 +1798,7 @@ func RemoveMany(st *state.State, names []string) ([]string, []*state.TaskSet, er
 	removed := make([]string, 0, len(names))
 	tasksets := make([]*state.TaskSet, 0, len(names))
 	for _, name := range names {
-		ts, err := Remove(st, name, snap.R(0))
+		ts, err := Remove(st, name, snap.R(0), nil)
 		// FIXME: is this expected behavior?
 		if _, ok := err.(*snap.NotInstalledError); ok {
 			continue
@@ -1893,8 +1941,9 @@ func TransitionCore(st *state.State, oldName, newName string) ([]*state.TaskSet,
 		},
 	})
 
-	// then remove the old snap
-	tsRm, err := Remove(st, oldName, snap.R(0))
+	// then remove the old snap; its data lives on in the new one, so
+	// there is no point in an automatic snapshot
+	tsRm, err := Remove(st, oldName, snap.R(0), &RemoveFlags{Purge: true})
 	if err != nil {
 		return nil, err
 	}
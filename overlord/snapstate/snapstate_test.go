@@ -107,10 +107,12 @@ func (s *snapmgrTestSuite) SetUpTest(c *C) {
 	oldSetupPreRefreshHook := snapstate.SetupPreRefreshHook
 	oldSetupPostRefreshHook := snapstate.SetupPostRefreshHook
 	oldSetupRemoveHook := snapstate.SetupRemoveHook
+	oldSetupCheckHealthHook := snapstate.SetupCheckHealthHook
 	snapstate.SetupInstallHook = hookstate.SetupInstallHook
 	snapstate.SetupPreRefreshHook = hookstate.SetupPreRefreshHook
 	snapstate.SetupPostRefreshHook = hookstate.SetupPostRefreshHook
 	snapstate.SetupRemoveHook = hookstate.SetupRemoveHook
+	snapstate.SetupCheckHealthHook = hookstate.SetupCheckHealthHook
 
 	var err error
 	s.snapmgr, err = snapstate.Manager(s.state, s.o.TaskRunner())
@@ -140,6 +142,7 @@ func (s *snapmgrTestSuite) SetUpTest(c *C) {
 		snapstate.SetupPreRefreshHook = oldSetupPreRefreshHook
 		snapstate.SetupPostRefreshHook = oldSetupPostRefreshHook
 		snapstate.SetupRemoveHook = oldSetupRemoveHook
+		snapstate.SetupCheckHealthHook = oldSetupCheckHealthHook
 
 		dirs.SetRootDir("/")
 	})
@@ -185,6 +188,8 @@ func (s *snapmgrTestSuite) TearDownTest(c *C) {
 	snapstate.AutoAliases = nil
 	snapstate.CanAutoRefresh = nil
 	snapstate.Model = nil
+	snapstate.AutomaticSnapshot = nil
+	snapstate.DiscardSnapHealth = nil
 }
 
 type ForeignTaskTracker interface {
@@ -2197,13 +2202,95 @@ func (s *snapmgrTestSuite) TestRemoveTasks(c *C) {
 		SnapType: "app",
 	})
 
-	ts, err := snapstate.Remove(s.state, "foo", snap.R(0))
+	ts, err := snapstate.Remove(s.state, "foo", snap.R(0), nil)
 	c.Assert(err, IsNil)
 
 	c.Assert(s.state.TaskCount(), Equals, len(ts.Tasks()))
 	verifyRemoveTasks(c, ts)
 }
 
+func (s *snapmgrTestSuite) testRemoveAutomaticSnapshot(c *C, flags *snapstate.RemoveFlags, revision snap.Revision, snapshotErr error) (*state.TaskSet, []string, error) {
+	var snapshotted []string
+	snapstate.AutomaticSnapshot = func(st *state.State, instanceName string) (*state.TaskSet, error) {
+		snapshotted = append(snapshotted, instanceName)
+		if snapshotErr != nil {
+			return nil, snapshotErr
+		}
+		return state.NewTaskSet(st.NewTask("save-snapshot", "...")), nil
+	}
+
+	snapstate.Set(s.state, "foo", &snapstate.SnapState{
+		Active: true,
+		Sequence: []*snap.SideInfo{
+			{RealName: "foo", Revision: snap.R(11)},
+			{RealName: "foo", Revision: snap.R(12)},
+		},
+		Current:  snap.R(12),
+		SnapType: "app",
+	})
+
+	ts, err := snapstate.Remove(s.state, "foo", revision, flags)
+	return ts, snapshotted, err
+}
+
+func (s *snapmgrTestSuite) TestRemoveTasksAutomaticSnapshot(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	ts, snapshotted, err := s.testRemoveAutomaticSnapshot(c, nil, snap.R(0), nil)
+	c.Assert(err, IsNil)
+	c.Check(snapshotted, DeepEquals, []string{"foo"})
+
+	c.Assert(s.state.TaskCount(), Equals, len(ts.Tasks()))
+	c.Assert(taskKinds(ts.Tasks()), DeepEquals, []string{
+		"stop-snap-services",
+		"save-snapshot",
+		"run-hook[remove]",
+		"auto-disconnect",
+		"remove-aliases",
+		"unlink-snap",
+		"remove-profiles",
+		"clear-snap",
+		"discard-snap",
+		"clear-snap",
+		"discard-snap",
+	})
+	// the snapshot is taken once the services are stopped, and
+	// before the remove hook can touch the data
+	tasks := ts.Tasks()
+	c.Check(tasks[1].WaitTasks(), DeepEquals, []*state.Task{tasks[0]})
+	c.Check(tasks[2].WaitTasks(), DeepEquals, []*state.Task{tasks[1]})
+	c.Check(tasks[3].WaitTasks(), testutil.Contains, tasks[2])
+}
+
+func (s *snapmgrTestSuite) TestRemovePurgeSkipsAutomaticSnapshot(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	ts, snapshotted, err := s.testRemoveAutomaticSnapshot(c, &snapstate.RemoveFlags{Purge: true}, snap.R(0), nil)
+	c.Assert(err, IsNil)
+	c.Check(snapshotted, HasLen, 0)
+	c.Check(tasksWithKind(ts, "save-snapshot"), HasLen, 0)
+}
+
+func (s *snapmgrTestSuite) TestRemoveRevisionSkipsAutomaticSnapshot(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	ts, snapshotted, err := s.testRemoveAutomaticSnapshot(c, nil, snap.R(11), nil)
+	c.Assert(err, IsNil)
+	c.Check(snapshotted, HasLen, 0)
+	c.Check(tasksWithKind(ts, "save-snapshot"), HasLen, 0)
+}
+
+func (s *snapmgrTestSuite) TestRemoveAutomaticSnapshotError(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	_, _, err := s.testRemoveAutomaticSnapshot(c, nil, snap.R(0), errors.New("bzzt"))
+	c.Check(err, ErrorMatches, "bzzt")
+}
+
 func (s *snapmgrTestSuite) TestRemoveHookNotExecutedIfNotLastRevison(c *C) {
 	s.state.Lock()
 	defer s.state.Unlock()
@@ -2217,7 +2304,7 @@ func (s *snapmgrTestSuite) TestRemoveHookNotExecutedIfNotLastRevison(c *C) {
 		Current: snap.R(12),
 	})
 
-	ts, err := snapstate.Remove(s.state, "foo", snap.R(11))
+	ts, err := snapstate.Remove(s.state, "foo", snap.R(11), nil)
 	c.Assert(err, IsNil)
 
 	runHooks := tasksWithKind(ts, "run-hook")
@@ -2235,12 +2322,12 @@ func (s *snapmgrTestSuite) TestRemoveConflict(c *C) {
 		Current:  snap.R(11),
 	})
 
-	ts, err := snapstate.Remove(s.state, "some-snap", snap.R(0))
+	ts, err := snapstate.Remove(s.state, "some-snap", snap.R(0), nil)
 	c.Assert(err, IsNil)
 	// need a change to make the tasks visible
 	s.state.NewChange("remove", "...").AddAll(ts)
 
-	_, err = snapstate.Remove(s.state, "some-snap", snap.R(0))
+	_, err = snapstate.Remove(s.state, "some-snap", snap.R(0), nil)
 	c.Assert(err, ErrorMatches, `snap "some-snap" has "remove" change in progress`)
 }
 
@@ -6430,6 +6517,54 @@ version: 1.0`)
 	c.Assert(snapst.Required, Equals, true)
 }
 
+func (s *snapmgrTestSuite) TestRemoveDiscardsHealth(c *C) {
+	var discarded []string
+	snapstate.DiscardSnapHealth = func(st *state.State, instanceName string) error {
+		discarded = append(discarded, instanceName)
+		return nil
+	}
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active: true,
+		Sequence: []*snap.SideInfo{
+			{RealName: "some-snap", SnapID: "some-snap-id", Revision: snap.R(3)},
+			{RealName: "some-snap", SnapID: "some-snap-id", Revision: snap.R(7)},
+		},
+		Current:  snap.R(7),
+		SnapType: "app",
+	})
+
+	// removing a revision keeps the health
+	chg := s.state.NewChange("remove", "remove a revision")
+	ts, err := snapstate.Remove(s.state, "some-snap", snap.R(3), nil)
+	c.Assert(err, IsNil)
+	chg.AddAll(ts)
+
+	s.state.Unlock()
+	defer s.se.Stop()
+	s.settle(c)
+	s.state.Lock()
+
+	c.Assert(chg.Err(), IsNil)
+	c.Check(discarded, HasLen, 0)
+
+	// removing the snap drops it
+	chg = s.state.NewChange("remove", "remove a snap")
+	ts, err = snapstate.Remove(s.state, "some-snap", snap.R(0), nil)
+	c.Assert(err, IsNil)
+	chg.AddAll(ts)
+
+	s.state.Unlock()
+	s.settle(c)
+	s.state.Lock()
+
+	c.Assert(chg.Err(), IsNil)
+	c.Check(discarded, DeepEquals, []string{"some-snap"})
+}
+
 func (s *snapmgrTestSuite) TestRemoveRunThrough(c *C) {
 	c.Assert(snapstate.KeepAuxStoreInfo("some-snap-id", nil), IsNil)
 	c.Check(snapstate.AuxStoreInfoFilename("some-snap-id"), testutil.FilePresent)
@@ -6450,7 +6585,7 @@ func (s *snapmgrTestSuite) TestRemoveRunThrough(c *C) {
 	})
 
 	chg := s.state.NewChange("remove", "remove a snap")
-	ts, err := snapstate.Remove(s.state, "some-snap", snap.R(0))
+	ts, err := snapstate.Remove(s.state, "some-snap", snap.R(0), nil)
 	c.Assert(err, IsNil)
 	chg.AddAll(ts)
 
@@ -6585,7 +6720,7 @@ func (s *snapmgrTestSuite) TestParallelInstanceRemoveRunThrough(c *C) {
 	})
 
 	chg := s.state.NewChange("remove", "remove a snap")
-	ts, err := snapstate.Remove(s.state, "some-snap_instance", snap.R(0))
+	ts, err := snapstate.Remove(s.state, "some-snap_instance", snap.R(0), nil)
 	c.Assert(err, IsNil)
 	chg.AddAll(ts)
 
@@ -6725,7 +6860,7 @@ func (s *snapmgrTestSuite) TestParallelInstanceRemoveRunThroughOtherInstances(c
 	})
 
 	chg := s.state.NewChange("remove", "remove a snap")
-	ts, err := snapstate.Remove(s.state, "some-snap_instance", snap.R(0))
+	ts, err := snapstate.Remove(s.state, "some-snap_instance", snap.R(0), nil)
 	c.Assert(err, IsNil)
 	chg.AddAll(ts)
 
@@ -6827,7 +6962,7 @@ func (s *snapmgrTestSuite) TestRemoveWithManyRevisionsRunThrough(c *C) {
 	})
 
 	chg := s.state.NewChange("remove", "remove a snap")
-	ts, err := snapstate.Remove(s.state, "some-snap", snap.R(0))
+	ts, err := snapstate.Remove(s.state, "some-snap", snap.R(0), nil)
 	c.Assert(err, IsNil)
 	chg.AddAll(ts)
 
@@ -6986,7 +7121,7 @@ func (s *snapmgrTestSuite) TestRemoveOneRevisionRunThrough(c *C) {
 	})
 
 	chg := s.state.NewChange("remove", "remove a snap")
-	ts, err := snapstate.Remove(s.state, "some-snap", snap.R(3))
+	ts, err := snapstate.Remove(s.state, "some-snap", snap.R(3), nil)
 	c.Assert(err, IsNil)
 	chg.AddAll(ts)
 
@@ -7051,7 +7186,7 @@ func (s *snapmgrTestSuite) TestRemoveLastRevisionRunThrough(c *C) {
 	})
 
 	chg := s.state.NewChange("remove", "remove a snap")
-	ts, err := snapstate.Remove(s.state, "some-snap", snap.R(2))
+	ts, err := snapstate.Remove(s.state, "some-snap", snap.R(2), nil)
 	c.Assert(err, IsNil)
 	chg.AddAll(ts)
 
@@ -7146,7 +7281,7 @@ func (s *snapmgrTestSuite) TestRemoveCurrentActiveRevisionRefused(c *C) {
 		SnapType: "app",
 	})
 
-	_, err := snapstate.Remove(s.state, "some-snap", snap.R(2))
+	_, err := snapstate.Remove(s.state, "some-snap", snap.R(2), nil)
 
 	c.Check(err, ErrorMatches, `cannot remove active revision 2 of snap "some-snap"`)
 }
@@ -7167,7 +7302,7 @@ func (s *snapmgrTestSuite) TestRemoveCurrentRevisionOfSeveralRefused(c *C) {
 		SnapType: "app",
 	})
 
-	_, err := snapstate.Remove(s.state, "some-snap", snap.R(2))
+	_, err := snapstate.Remove(s.state, "some-snap", snap.R(2), nil)
 	c.Assert(err, NotNil)
 	c.Check(err.Error(), Equals, `cannot remove active revision 2 of snap "some-snap" (revert first?)`)
 }
@@ -7188,7 +7323,7 @@ func (s *snapmgrTestSuite) TestRemoveMissingRevisionRefused(c *C) {
 		SnapType: "app",
 	})
 
-	_, err := snapstate.Remove(s.state, "some-snap", snap.R(1))
+	_, err := snapstate.Remove(s.state, "some-snap", snap.R(1), nil)
 
 	c.Check(err, ErrorMatches, `revision 1 of snap "some-snap" is not installed`)
 }
@@ -7209,7 +7344,7 @@ func (s *snapmgrTestSuite) TestRemoveRefused(c *C) {
 		SnapType: "app",
 	})
 
-	_, err := snapstate.Remove(s.state, "gadget", snap.R(0))
+	_, err := snapstate.Remove(s.state, "gadget", snap.R(0), nil)
 
 	c.Check(err, ErrorMatches, `snap "gadget" is not removable`)
 }
@@ -7230,7 +7365,7 @@ func (s *snapmgrTestSuite) TestRemoveRefusedLastRevision(c *C) {
 		SnapType: "app",
 	})
 
-	_, err := snapstate.Remove(s.state, "gadget", snap.R(7))
+	_, err := snapstate.Remove(s.state, "gadget", snap.R(7), nil)
 
 	c.Check(err, ErrorMatches, `snap "gadget" is not removable`)
 }
@@ -7273,7 +7408,7 @@ func (s *snapmgrTestSuite) TestRemoveDeletesConfigOnLastRevision(c *C) {
 	c.Assert(tr.Get("another-snap", "bar", &res), IsNil)
 
 	chg := s.state.NewChange("remove", "remove a snap")
-	ts, err := snapstate.Remove(s.state, "some-snap", snap.R(0))
+	ts, err := snapstate.Remove(s.state, "some-snap", snap.R(0), nil)
 	c.Assert(err, IsNil)
 	chg.AddAll(ts)
 
@@ -7326,7 +7461,7 @@ func (s *snapmgrTestSuite) TestRemoveDoesntDeleteConfigIfNotLastRevision(c *C) {
 	c.Assert(tr.Get("some-snap", "foo", &res), IsNil)
 
 	chg := s.state.NewChange("remove", "remove a snap")
-	ts, err := snapstate.Remove(s.state, "some-snap", si1.Revision)
+	ts, err := snapstate.Remove(s.state, "some-snap", si1.Revision, nil)
 	c.Assert(err, IsNil)
 	chg.AddAll(ts)
 
@@ -9153,6 +9288,125 @@ func (s *snapmgrTestSuite) TestEnsureRefreshesWithUpdate(c *C) {
 	checkIsAutoRefresh(c, chg.Tasks(), true)
 }
 
+func (s *snapmgrTestSuite) TestEnsureRefreshesSkipsHeldSnap(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+	snapstate.CanAutoRefresh = func(*state.State) (bool, error) { return true, nil }
+
+	makeTestRefreshConfig(s.state)
+
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active: true,
+		Sequence: []*snap.SideInfo{
+			{RealName: "some-snap", SnapID: "some-snap-id", Revision: snap.R(1)},
+		},
+		Current:  snap.R(1),
+		SnapType: "app",
+	})
+	err := snapstate.HoldRefreshes(s.state, []string{"some-snap"}, time.Time{})
+	c.Assert(err, IsNil)
+
+	// Ensure() also runs ensureRefreshes() and our test setup has an
+	// update for the "some-snap" in our fake store, but it is held
+	s.state.Unlock()
+	s.snapmgr.Ensure()
+	s.state.Lock()
+
+	c.Check(s.state.Changes(), HasLen, 0)
+	s.verifyRefreshLast(c)
+
+	// the hold is indefinite so it is still there
+	var snapst snapstate.SnapState
+	c.Assert(snapstate.Get(s.state, "some-snap", &snapst), IsNil)
+	c.Check(snapst.RefreshHold, DeepEquals, &snapstate.RefreshHold{})
+}
+
+func (s *snapmgrTestSuite) TestEnsureRefreshesExpiredSnapHold(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+	snapstate.CanAutoRefresh = func(*state.State) (bool, error) { return true, nil }
+
+	makeTestRefreshConfig(s.state)
+
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active: true,
+		Sequence: []*snap.SideInfo{
+			{RealName: "some-snap", SnapID: "some-snap-id", Revision: snap.R(1)},
+		},
+		Current:     snap.R(1),
+		SnapType:    "app",
+		RefreshHold: &snapstate.RefreshHold{Until: time.Now().Add(-time.Hour)},
+	})
+
+	s.state.Unlock()
+	s.snapmgr.Ensure()
+	s.state.Lock()
+
+	// the hold expired so the snap is refreshed and the hold dropped
+	c.Assert(s.state.Changes(), HasLen, 1)
+	chg := s.state.Changes()[0]
+	c.Check(chg.Kind(), Equals, "auto-refresh")
+
+	var snapst snapstate.SnapState
+	c.Assert(snapstate.Get(s.state, "some-snap", &snapst), IsNil)
+	c.Check(snapst.RefreshHold, IsNil)
+}
+
+func (s *snapmgrTestSuite) TestHoldUnholdRefreshes(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active: true,
+		Sequence: []*snap.SideInfo{
+			{RealName: "some-snap", SnapID: "some-snap-id", Revision: snap.R(1)},
+		},
+		Current:  snap.R(1),
+		SnapType: "app",
+	})
+
+	until := time.Now().Add(48 * time.Hour).UTC()
+	err := snapstate.HoldRefreshes(s.state, []string{"some-snap"}, until)
+	c.Assert(err, IsNil)
+
+	var snapst snapstate.SnapState
+	c.Assert(snapstate.Get(s.state, "some-snap", &snapst), IsNil)
+	c.Assert(snapst.RefreshHold, NotNil)
+	c.Check(snapst.RefreshHold.Until.Equal(until), Equals, true)
+	c.Check(snapst.RefreshHold.Held(time.Now()), Equals, true)
+	c.Check(snapst.RefreshHold.Held(until.Add(time.Second)), Equals, false)
+
+	err = snapstate.UnholdRefreshes(s.state, []string{"some-snap"})
+	c.Assert(err, IsNil)
+	c.Assert(snapstate.Get(s.state, "some-snap", &snapst), IsNil)
+	c.Check(snapst.RefreshHold, IsNil)
+}
+
+func (s *snapmgrTestSuite) TestHoldRefreshesNotInstalled(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active: true,
+		Sequence: []*snap.SideInfo{
+			{RealName: "some-snap", SnapID: "some-snap-id", Revision: snap.R(1)},
+		},
+		Current:  snap.R(1),
+		SnapType: "app",
+	})
+
+	err := snapstate.HoldRefreshes(s.state, []string{"some-snap", "other-snap"}, time.Time{})
+	c.Check(err, ErrorMatches, `snap "other-snap" is not installed`)
+
+	// nothing was held
+	var snapst snapstate.SnapState
+	c.Assert(snapstate.Get(s.state, "some-snap", &snapst), IsNil)
+	c.Check(snapst.RefreshHold, IsNil)
+
+	err = snapstate.UnholdRefreshes(s.state, []string{"other-snap"})
+	c.Check(err, ErrorMatches, `snap "other-snap" is not installed`)
+}
+
 func (s *snapmgrTestSuite) TestEnsureRefreshesImmediateWithUpdate(c *C) {
 	r := release.MockOnClassic(false)
 	defer r()
@@ -0,0 +1,112 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapstate
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+// defaultConcurrencyLimits are the concurrency limits of tasks, by
+// kind, unless configured otherwise: parallel downloads share the
+// bandwidth and the disk, too many of them just slow down all.
+var defaultConcurrencyLimits = map[string]int{
+	"download-snap": 4,
+}
+
+// defaultChangePriorities are the priorities of changes, by kind,
+// unless configured otherwise: changes the user asked for go before
+// auto-refreshes.
+var defaultChangePriorities = map[string]int{
+	"auto-refresh": -10,
+}
+
+// intOptions returns the integer values of the options nested under
+// the given core option, by name.
+func intOptions(tr *config.Transaction, option string) (map[string]int, error) {
+	var values map[string]interface{}
+	if err := tr.Get("core", option, &values); err != nil && !config.IsNoOption(err) {
+		return nil, err
+	}
+	ints := make(map[string]int, len(values))
+	for name, value := range values {
+		if value == nil || value == "" {
+			// unset
+			continue
+		}
+		n, err := strconv.Atoi(fmt.Sprintf("%v", value))
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s must be an integer, not %q", option, name, value)
+		}
+		ints[name] = n
+	}
+	return ints, nil
+}
+
+// withDefaults returns the values of both maps, those of configured
+// taking precedence.
+func withDefaults(defaults, configured map[string]int) map[string]int {
+	values := make(map[string]int, len(defaults)+len(configured))
+	for kind, value := range defaults {
+		values[kind] = value
+	}
+	for kind, value := range configured {
+		values[kind] = value
+	}
+	return values
+}
+
+// taskPolicy returns the concurrency limits of tasks and priorities of
+// changes, by kind, as configured via the tasks.max-concurrent.<kind>
+// and changes.priority.<kind> core options, on top of the defaults.
+// Setting a limit to 0 lifts it.
+func taskPolicy(st *state.State) (limits, priorities map[string]int, err error) {
+	tr := config.NewTransaction(st)
+	configuredLimits, err := intOptions(tr, "tasks.max-concurrent")
+	if err != nil {
+		return nil, nil, err
+	}
+	configuredPriorities, err := intOptions(tr, "changes.priority")
+	if err != nil {
+		return nil, nil, err
+	}
+	limits = withDefaults(defaultConcurrencyLimits, configuredLimits)
+	priorities = withDefaults(defaultChangePriorities, configuredPriorities)
+	return limits, priorities, nil
+}
+
+// ensureTaskPolicy makes the task runner follow the configured
+// concurrency limits and priorities.
+func (m *SnapManager) ensureTaskPolicy() error {
+	m.state.Lock()
+	limits, priorities, err := taskPolicy(m.state)
+	m.state.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// the runner lock is to be taken before the state one
+	m.runner.SetConcurrencyLimits(limits)
+	m.runner.SetChangePriorities(priorities)
+	return nil
+}
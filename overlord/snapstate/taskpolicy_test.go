@@ -0,0 +1,107 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapstate_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+type taskPolicySuite struct {
+	state *state.State
+}
+
+var _ = Suite(&taskPolicySuite{})
+
+func (s *taskPolicySuite) SetUpTest(c *C) {
+	s.state = state.New(nil)
+}
+
+func (s *taskPolicySuite) TestDefaults(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	limits, priorities, err := snapstate.TaskPolicy(s.state)
+	c.Assert(err, IsNil)
+	c.Check(limits, DeepEquals, map[string]int{"download-snap": 4})
+	c.Check(priorities, DeepEquals, map[string]int{"auto-refresh": -10})
+}
+
+func (s *taskPolicySuite) TestConfigured(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	tr := config.NewTransaction(s.state)
+	c.Assert(tr.Set("core", "tasks.max-concurrent.download-snap", 2), IsNil)
+	c.Assert(tr.Set("core", "tasks.max-concurrent.link-snap", "1"), IsNil)
+	c.Assert(tr.Set("core", "tasks.max-concurrent.mount-snap", nil), IsNil)
+	c.Assert(tr.Set("core", "tasks.max-concurrent.unlink-snap", ""), IsNil)
+	c.Assert(tr.Set("core", "changes.priority.auto-refresh", -20), IsNil)
+	c.Assert(tr.Set("core", "changes.priority.install-snap", 5), IsNil)
+	c.Assert(tr.Set("core", "changes.priority.remove-snap", ""), IsNil)
+	tr.Commit()
+
+	limits, priorities, err := snapstate.TaskPolicy(s.state)
+	c.Assert(err, IsNil)
+	c.Check(limits, DeepEquals, map[string]int{"download-snap": 2, "link-snap": 1})
+	c.Check(priorities, DeepEquals, map[string]int{"auto-refresh": -20, "install-snap": 5})
+}
+
+func (s *taskPolicySuite) TestConfiguredLiftsDefaultLimit(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	tr := config.NewTransaction(s.state)
+	c.Assert(tr.Set("core", "tasks.max-concurrent.download-snap", 0), IsNil)
+	tr.Commit()
+
+	limits, _, err := snapstate.TaskPolicy(s.state)
+	c.Assert(err, IsNil)
+	c.Check(limits, DeepEquals, map[string]int{"download-snap": 0})
+}
+
+func (s *taskPolicySuite) TestBadConfig(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	tr := config.NewTransaction(s.state)
+	c.Assert(tr.Set("core", "tasks.max-concurrent.download-snap", "many"), IsNil)
+	tr.Commit()
+
+	_, _, err := snapstate.TaskPolicy(s.state)
+	c.Check(err, ErrorMatches, `tasks.max-concurrent.download-snap must be an integer, not "many"`)
+}
+
+func (s *taskPolicySuite) TestUnsetDefaultLimit(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	// as done by "snap set core tasks.max-concurrent.download-snap="
+	tr := config.NewTransaction(s.state)
+	c.Assert(tr.Set("core", "tasks.max-concurrent.download-snap", ""), IsNil)
+	tr.Commit()
+
+	limits, _, err := snapstate.TaskPolicy(s.state)
+	c.Assert(err, IsNil)
+	c.Check(limits, DeepEquals, map[string]int{"download-snap": 4})
+}
@@ -124,6 +124,7 @@ type Change struct {
 	data    customData
 	taskIDs []string
 	lanes   int
+	paused  bool
 	ready   chan struct{}
 
 	spawnTime time.Time
@@ -158,6 +159,7 @@ type marshalledChange struct {
 	Data    map[string]*json.RawMessage `json:"data,omitempty"`
 	TaskIDs []string                    `json:"task-ids,omitempty"`
 	Lanes   int                         `json:"lanes,omitempty"`
+	Paused  bool                        `json:"paused,omitempty"`
 
 	SpawnTime time.Time  `json:"spawn-time"`
 	ReadyTime *time.Time `json:"ready-time,omitempty"`
@@ -179,6 +181,7 @@ func (c *Change) MarshalJSON() ([]byte, error) {
 		Data:    c.data,
 		TaskIDs: c.taskIDs,
 		Lanes:   c.lanes,
+		Paused:  c.paused,
 
 		SpawnTime: c.spawnTime,
 		ReadyTime: readyTime,
@@ -188,7 +191,7 @@ func (c *Change) MarshalJSON() ([]byte, error) {
 // UnmarshalJSON makes Change a json.Unmarshaller
 func (c *Change) UnmarshalJSON(data []byte) error {
 	if c.state != nil {
-		c.state.writing()
+		c.state.writingChange(c.id)
 	}
 	var unmarshalled marshalledChange
 	err := json.Unmarshal(data, &unmarshalled)
@@ -207,6 +210,7 @@ func (c *Change) UnmarshalJSON(data []byte) error {
 	c.data = custData
 	c.taskIDs = unmarshalled.TaskIDs
 	c.lanes = unmarshalled.Lanes
+	c.paused = unmarshalled.Paused
 	c.ready = make(chan struct{})
 	c.spawnTime = unmarshalled.SpawnTime
 	if unmarshalled.ReadyTime != nil {
@@ -240,7 +244,7 @@ func (c *Change) Summary() string {
 // Set associates value with key for future consulting by managers.
 // The provided value must properly marshal and unmarshal with encoding/json.
 func (c *Change) Set(key string, value interface{}) {
-	c.state.writing()
+	c.state.writingChange(c.id)
 	c.data.set(key, value)
 }
 
@@ -300,11 +304,30 @@ func (c *Change) Status() Status {
 
 // SetStatus sets the change status, overriding the default behavior (see Status method).
 func (c *Change) SetStatus(s Status) {
-	c.state.writing()
+	c.state.writingChange(c.id)
+	var old Status
+	if len(c.state.changeStatusHandlers) > 0 {
+		old = c.Status()
+	}
 	c.status = s
 	if s.Ready() {
 		c.markReady()
 	}
+	if len(c.state.changeStatusHandlers) > 0 {
+		c.notifyStatusChanged(old)
+	}
+}
+
+// notifyStatusChanged calls the change status handlers if the status
+// of the change is no longer the given old one.
+func (c *Change) notifyStatusChanged(old Status) {
+	new := c.Status()
+	if new == old {
+		return
+	}
+	for _, f := range c.state.changeStatusHandlers {
+		f(c, old, new)
+	}
 }
 
 func (c *Change) markReady() {
@@ -314,7 +337,11 @@ func (c *Change) markReady() {
 		close(c.ready)
 	}
 	if c.readyTime.IsZero() {
+		c.state.writingChange(c.id)
 		c.readyTime = timeNow()
+		for _, f := range c.state.changeReadyHandlers {
+			f(c)
+		}
 	}
 }
 
@@ -379,6 +406,7 @@ func (c *Change) taskCleanChanged() {
 			return
 		}
 	}
+	c.state.writingChange(c.id)
 	c.clean = true
 }
 
@@ -454,7 +482,8 @@ func (c *Change) State() *State {
 // AddTask registers a task as required for the state change to
 // be accomplished.
 func (c *Change) AddTask(t *Task) {
-	c.state.writing()
+	c.state.writingChange(c.id)
+	c.state.writingTask(t.id)
 	if t.change != "" {
 		panic(fmt.Sprintf("internal error: cannot add one %q task to multiple changes", t.Kind()))
 	}
@@ -465,7 +494,7 @@ func (c *Change) AddTask(t *Task) {
 // AddAll registers all tasks in the set as required for the state
 // change to be accomplished.
 func (c *Change) AddAll(ts *TaskSet) {
-	c.state.writing()
+	c.state.writingChange(c.id)
 	for _, t := range ts.tasks {
 		c.AddTask(t)
 	}
@@ -501,10 +530,33 @@ func (c *Change) LaneTasks(lanes ...int) []*Task {
 	return tasks
 }
 
+// Pause holds off the change: no further tasks of it are started,
+// while those already running are left to finish, until Resume is
+// called.
+func (c *Change) Pause() {
+	c.state.writingChange(c.id)
+	c.paused = true
+}
+
+// Resume lets the tasks of a paused change be started again, at the
+// next ensure pass.
+func (c *Change) Resume() {
+	c.state.writingChange(c.id)
+	c.paused = false
+}
+
+// IsPaused returns whether the change was paused.
+func (c *Change) IsPaused() bool {
+	c.state.reading()
+	return c.paused
+}
+
 // Abort flags the change for cancellation, whether in progress or not.
-// Cancellation will proceed at the next ensure pass.
+// Cancellation will proceed at the next ensure pass, even if the change
+// was paused.
 func (c *Change) Abort() {
-	c.state.writing()
+	c.state.writingChange(c.id)
+	c.paused = false
 	tasks := make([]*Task, len(c.taskIDs))
 	for i, tid := range c.taskIDs {
 		tasks[i] = c.state.tasks[tid]
@@ -516,7 +568,7 @@ func (c *Change) Abort() {
 // except for tasks that are also in a healthy lane (not aborted, and not waiting
 // on aborted).
 func (c *Change) AbortLanes(lanes []int) {
-	c.state.writing()
+	c.state.writingChange(c.id)
 	c.abortLanes(lanes, make(map[int]bool), make(map[string]bool))
 }
 
@@ -27,6 +27,7 @@ import (
 	"time"
 
 	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/testutil"
 
 	. "gopkg.in/check.v1"
 )
@@ -67,6 +68,62 @@ func (cs *changeSuite) TestReadyTime(c *C) {
 	c.Check(t.Before(now.Add(5*time.Second)), Equals, true)
 }
 
+func (cs *changeSuite) TestChangeReadyHandler(c *C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	var ready []string
+	st.AddChangeReadyHandler(func(chg *state.Change) {
+		c.Check(chg.ReadyTime().IsZero(), Equals, false)
+		ready = append(ready, chg.ID())
+	})
+
+	chg := st.NewChange("install", "summary...")
+	t1 := st.NewTask("download", "1...")
+	t2 := st.NewTask("activate", "2...")
+	chg.AddTask(t1)
+	chg.AddTask(t2)
+
+	t1.SetStatus(state.DoneStatus)
+	c.Check(ready, HasLen, 0)
+	t2.SetStatus(state.ErrorStatus)
+	c.Check(ready, DeepEquals, []string{chg.ID()})
+
+	// only the first time
+	t2.SetStatus(state.DoneStatus)
+	c.Check(ready, DeepEquals, []string{chg.ID()})
+}
+
+func (cs *changeSuite) TestChangeStatusChangedHandler(c *C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	var changes []string
+	st.AddChangeStatusChangedHandler(func(chg *state.Change, old, new state.Status) {
+		changes = append(changes, fmt.Sprintf("%s->%s", old, new))
+	})
+
+	chg := st.NewChange("install", "summary...")
+	t1 := st.NewTask("download", "1...")
+	t2 := st.NewTask("activate", "2...")
+	chg.AddTask(t1)
+	chg.AddTask(t2)
+
+	t1.SetStatus(state.DoingStatus)
+	c.Check(changes, DeepEquals, []string{"Do->Doing"})
+	t1.SetStatus(state.DoneStatus)
+	// still Do overall, as t2 is pending
+	c.Check(changes, DeepEquals, []string{"Do->Doing", "Doing->Do"})
+	t2.SetStatus(state.DoneStatus)
+	c.Check(changes, DeepEquals, []string{"Do->Doing", "Doing->Do", "Do->Done"})
+
+	// explicitly set
+	chg.SetStatus(state.ErrorStatus)
+	c.Check(changes, DeepEquals, []string{"Do->Doing", "Doing->Do", "Do->Done", "Done->Error"})
+}
+
 func (cs *changeSuite) TestStatusString(c *C) {
 	for s := state.Status(0); s < state.ErrorStatus+1; s++ {
 		c.Assert(s.String(), Matches, ".+")
@@ -461,6 +518,32 @@ func (cs *changeSuite) TestAbort(c *C) {
 	}
 }
 
+func (cs *changeSuite) TestPauseResume(c *C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	chg := st.NewChange("install", "...")
+	c.Check(chg.IsPaused(), Equals, false)
+
+	chg.Pause()
+	c.Check(chg.IsPaused(), Equals, true)
+	d, err := chg.MarshalJSON()
+	c.Assert(err, IsNil)
+	c.Check(string(d), testutil.Contains, `"paused":true`)
+
+	chg.Resume()
+	c.Check(chg.IsPaused(), Equals, false)
+	d, err = chg.MarshalJSON()
+	c.Assert(err, IsNil)
+	c.Check(string(d), Not(testutil.Contains), `"paused"`)
+
+	// aborting resumes the change, for it to be undone
+	chg.Pause()
+	chg.Abort()
+	c.Check(chg.IsPaused(), Equals, false)
+}
+
 func (cs *changeSuite) TestAbortCircular(c *C) {
 	st := state.New(nil)
 	st.Lock()
@@ -66,6 +66,14 @@ func (t *Task) AccumulateUndoingTime(duration time.Duration) {
 	t.accumulateUndoingTime(duration)
 }
 
+func (t *Task) AccumulateDoingRetries() int {
+	return t.accumulateDoingRetries()
+}
+
+func (t *Task) AccumulateUndoingRetries() int {
+	return t.accumulateUndoingRetries()
+}
+
 var (
 	ErrNoWarningMessage     = errNoWarningMessage
 	ErrBadWarningMessage    = errBadWarningMessage
@@ -73,3 +81,21 @@ var (
 	ErrNoWarningExpireAfter = errNoWarningExpireAfter
 	ErrNoWarningRepeatAfter = errNoWarningRepeatAfter
 )
+
+func MockJournalMinCompactSize(size int64) (restore func()) {
+	old := journalMinCompactSize
+	journalMinCompactSize = size
+	return func() {
+		journalMinCompactSize = old
+	}
+}
+
+func MockRandFloat64(f func() float64) (restore func()) {
+	old := randFloat64
+	randFloat64 = f
+	return func() { randFloat64 = old }
+}
+
+func (p *RetryPolicy) DelayFor(retry int) time.Duration {
+	return p.delay(retry)
+}
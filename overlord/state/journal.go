@@ -0,0 +1,417 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package state
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/osutil"
+)
+
+// journalMinCompactSize is the size the journal can always grow to
+// before being compacted, however small the snapshot.
+var journalMinCompactSize int64 = 256 * 1024
+
+// journalSections are the parts of the serialized state that are
+// journaled entry by entry, rather than as a whole.
+var journalSections = []string{"data", "changes", "tasks"}
+
+// A Journal checkpoints the state incrementally. Next to a snapshot of
+// the state, in the same format as written by any other Backend, it
+// keeps a journal to which each checkpoint appends only the data
+// entries, changes and tasks that the State reports as modified since
+// the previous one. Once the journal grows bigger than the snapshot,
+// the snapshot is rewritten and the journal emptied.
+//
+// A Journal is meant to provide the Checkpoint and CheckpointDelta
+// methods of an IncrementalBackend, and to read the state back when
+// starting up.
+type Journal struct {
+	snapshotPath string
+	journalPath  string
+
+	// mu serializes checkpointing with compacting and closing, which
+	// can happen without the state being locked
+	mu sync.Mutex
+
+	// entries are those of the state as of the last checkpoint, or
+	// nil if the state was not read nor checkpointed as a whole yet
+	entries      map[string]json.RawMessage
+	snapshotSum  string
+	snapshotSize int64
+	journalSize  int64
+
+	// noSnapshot is set if there is no snapshot yet, in which case
+	// the next checkpoint writes one instead of journaling
+	noSnapshot bool
+	// closed is set once the journal was closed, after which every
+	// checkpoint rewrites the snapshot
+	closed bool
+}
+
+// journalHeader is the first record of a journal, tying it to the
+// snapshot it applies to.
+type journalHeader struct {
+	Snapshot string `json:"snapshot"`
+}
+
+// journalRecord is what changed in the state from one checkpoint to
+// the next.
+type journalRecord struct {
+	Set    map[string]json.RawMessage `json:"set,omitempty"`
+	Delete []string                   `json:"delete,omitempty"`
+}
+
+// NewJournal returns a Journal keeping the snapshot and the journal of
+// the state in the given files.
+func NewJournal(snapshotPath, journalPath string) *Journal {
+	return &Journal{
+		snapshotPath: snapshotPath,
+		journalPath:  journalPath,
+	}
+}
+
+// flattenState splits the serialized state into entries, keyed by
+// section and key (e.g. "tasks/42") for the journaled sections and by
+// name for the rest.
+func flattenState(data []byte) (map[string]json.RawMessage, error) {
+	var top map[string]json.RawMessage
+	if err := json.Unmarshal(data, &top); err != nil {
+		return nil, err
+	}
+	entries := make(map[string]json.RawMessage, len(top))
+	for name, value := range top {
+		if !isJournalSection(name) {
+			entries[name] = value
+			continue
+		}
+		var section map[string]json.RawMessage
+		if err := json.Unmarshal(value, &section); err != nil {
+			return nil, err
+		}
+		for key, value := range section {
+			entries[name+"/"+key] = value
+		}
+	}
+	return entries, nil
+}
+
+// unflattenState serializes the state made of the given entries.
+func unflattenState(entries map[string]json.RawMessage) ([]byte, error) {
+	top := make(map[string]interface{}, len(journalSections))
+	for _, name := range journalSections {
+		top[name] = map[string]json.RawMessage{}
+	}
+	for key, value := range entries {
+		idx := strings.IndexByte(key, '/')
+		if idx < 0 {
+			top[key] = value
+			continue
+		}
+		top[key[:idx]].(map[string]json.RawMessage)[key[idx+1:]] = value
+	}
+	return json.Marshal(top)
+}
+
+func isJournalSection(name string) bool {
+	for _, section := range journalSections {
+		if name == section {
+			return true
+		}
+	}
+	return false
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// ReadState returns the state as of the last complete checkpoint, as
+// found in the snapshot and the journal. An incomplete record at the
+// end of the journal, left by a crash while writing it, is discarded.
+func (j *Journal) ReadState(backend Backend) (*State, error) {
+	data, err := ioutil.ReadFile(j.snapshotPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("cannot read the state file: %s", err)
+	}
+	entries := make(map[string]json.RawMessage)
+	if len(data) > 0 {
+		entries, err = flattenState(data)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read state: %s", err)
+		}
+	}
+	j.snapshotSum = checksum(data)
+	j.snapshotSize = int64(len(data))
+	j.noSnapshot = data == nil
+
+	if err := j.replay(entries); err != nil {
+		return nil, err
+	}
+
+	full, err := unflattenState(entries)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read state: %s", err)
+	}
+	s, err := ReadState(backend, bytes.NewReader(full))
+	if err != nil {
+		return nil, err
+	}
+	j.entries = entries
+	return s, nil
+}
+
+// replay applies the records of the journal to the given entries.
+func (j *Journal) replay(entries map[string]json.RawMessage) error {
+	journal, err := ioutil.ReadFile(j.journalPath)
+	if os.IsNotExist(err) {
+		j.journalSize = 0
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cannot read the state journal: %s", err)
+	}
+
+	var good, records int
+	for n := 0; good < len(journal); n++ {
+		end := bytes.IndexByte(journal[good:], '\n')
+		if end < 0 {
+			break
+		}
+		line := journal[good : good+end]
+		if n == 0 {
+			var header journalHeader
+			if err := json.Unmarshal(line, &header); err != nil {
+				break
+			}
+			if header.Snapshot != j.snapshotSum {
+				// the snapshot was rewritten after this
+				// journal was last written to, and so
+				// includes all of it
+				break
+			}
+		} else {
+			var record journalRecord
+			if err := json.Unmarshal(line, &record); err != nil {
+				break
+			}
+			applyRecord(entries, &record)
+			records++
+		}
+		good += end + 1
+	}
+	if records == 0 {
+		// a header alone is no use, the next record writes it again
+		good = 0
+	}
+	if good < len(journal) {
+		logger.Noticef("Discarding the last %d bytes of the state journal.", len(journal)-good)
+		if err := os.Truncate(j.journalPath, int64(good)); err != nil {
+			return fmt.Errorf("cannot truncate the state journal: %s", err)
+		}
+	}
+	j.journalSize = int64(good)
+	return nil
+}
+
+// Checkpoint records the given serialized state as a whole, rewriting
+// the snapshot.
+func (j *Journal) Checkpoint(data []byte) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entries, err := flattenState(data)
+	if err != nil {
+		return fmt.Errorf("cannot journal state: %v", err)
+	}
+	return j.writeSnapshot(data, entries)
+}
+
+// CheckpointDelta records the given modifications of the state,
+// appending them to the journal, or rewriting the snapshot if the
+// journal got too big.
+func (j *Journal) CheckpointDelta(delta *Delta) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if delta.Full {
+		data, err := unflattenState(delta.Set)
+		if err != nil {
+			return fmt.Errorf("cannot journal state: %v", err)
+		}
+		return j.writeSnapshot(data, delta.Set)
+	}
+	if j.entries == nil {
+		return fmt.Errorf("internal error: cannot journal state modifications before the state was read")
+	}
+
+	var record journalRecord
+	for key, value := range delta.Set {
+		if old, ok := j.entries[key]; ok && bytes.Equal(old, value) {
+			continue
+		}
+		if record.Set == nil {
+			record.Set = make(map[string]json.RawMessage)
+		}
+		record.Set[key] = value
+	}
+	for _, key := range delta.Delete {
+		if _, ok := j.entries[key]; ok {
+			record.Delete = append(record.Delete, key)
+		}
+	}
+	if record.Set == nil && record.Delete == nil {
+		return nil
+	}
+
+	buf, err := json.Marshal(&record)
+	if err != nil {
+		return fmt.Errorf("cannot journal state: %v", err)
+	}
+	buf = append(buf, '\n')
+	if j.journalSize == 0 {
+		header, err := json.Marshal(&journalHeader{Snapshot: j.snapshotSum})
+		if err != nil {
+			return fmt.Errorf("cannot journal state: %v", err)
+		}
+		buf = append(append(header, '\n'), buf...)
+	}
+
+	limit := j.snapshotSize
+	if limit < journalMinCompactSize {
+		limit = journalMinCompactSize
+	}
+	if j.noSnapshot || j.closed || j.journalSize+int64(len(buf)) > limit {
+		entries := make(map[string]json.RawMessage, len(j.entries)+len(record.Set))
+		for key, value := range j.entries {
+			entries[key] = value
+		}
+		applyRecord(entries, &record)
+		data, err := unflattenState(entries)
+		if err != nil {
+			return fmt.Errorf("cannot journal state: %v", err)
+		}
+		return j.writeSnapshot(data, entries)
+	}
+
+	if err := j.append(buf); err != nil {
+		return err
+	}
+	applyRecord(j.entries, &record)
+	return nil
+}
+
+func applyRecord(entries map[string]json.RawMessage, record *journalRecord) {
+	for key, value := range record.Set {
+		entries[key] = value
+	}
+	for _, key := range record.Delete {
+		delete(entries, key)
+	}
+}
+
+// append writes the given records at the end of the journal; if that
+// fails, anything written is cut off again, so that the next records
+// do not end up after a broken one.
+func (j *Journal) append(buf []byte) error {
+	f, err := os.OpenFile(j.journalPath, os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteAt(buf, j.journalSize)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		f.Truncate(j.journalSize)
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	j.journalSize += int64(len(buf))
+	return nil
+}
+
+// writeSnapshot replaces the snapshot with the given serialized state
+// and empties the journal.
+func (j *Journal) writeSnapshot(data []byte, entries map[string]json.RawMessage) error {
+	// if interrupted before the journal is emptied, its header no
+	// longer matches the snapshot and it is ignored
+	if err := osutil.AtomicWriteFile(j.snapshotPath, data, 0600, 0); err != nil {
+		return err
+	}
+	if err := os.Remove(j.journalPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	j.entries = entries
+	j.snapshotSum = checksum(data)
+	j.snapshotSize = int64(len(data))
+	j.noSnapshot = false
+	j.journalSize = 0
+	return nil
+}
+
+// Compact rewrites the snapshot with the state as of the last
+// checkpoint, and removes the journal.
+func (j *Journal) Compact() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.compact()
+}
+
+// Close compacts the journal, and has every later checkpoint rewrite
+// the snapshot instead of journaling. This keeps the snapshot current
+// for whatever reads it next, including a snapd that knows nothing of
+// the journal, e.g. after a revert.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.closed = true
+	if j.entries == nil {
+		// nothing was journaled
+		return nil
+	}
+	return j.compact()
+}
+
+func (j *Journal) compact() error {
+	if j.entries == nil {
+		return fmt.Errorf("internal error: cannot compact a state journal that was not read")
+	}
+	data, err := unflattenState(j.entries)
+	if err != nil {
+		return err
+	}
+	return j.writeSnapshot(data, j.entries)
+}
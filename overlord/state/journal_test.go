@@ -0,0 +1,405 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package state_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+type journalSuite struct {
+	snapshotPath string
+	journalPath  string
+}
+
+var _ = Suite(&journalSuite{})
+
+func (s *journalSuite) SetUpTest(c *C) {
+	dir := c.MkDir()
+	s.snapshotPath = filepath.Join(dir, "state.json")
+	s.journalPath = filepath.Join(dir, "state.journal")
+}
+
+// journalBackend checkpoints into a journal, keeping track of the
+// deltas, of the full state and of the size of the journal after each
+// checkpoint.
+type journalBackend struct {
+	fakeStateBackend
+	st           *state.State
+	journal      *state.Journal
+	journalPath  string
+	deltas       []*state.Delta
+	journalSizes []int64
+}
+
+func (b *journalBackend) CheckpointDelta(delta *state.Delta) error {
+	if err := b.journal.CheckpointDelta(delta); err != nil {
+		return err
+	}
+	// the state is still locked while being checkpointed
+	data, err := b.st.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	b.deltas = append(b.deltas, delta)
+	b.checkpoints = append(b.checkpoints, data)
+	var size int64
+	if fi, err := os.Stat(b.journalPath); err == nil {
+		size = fi.Size()
+	}
+	b.journalSizes = append(b.journalSizes, size)
+	return nil
+}
+
+// mutateState changes the state in some way, depending on the step.
+func mutateState(st *state.State, step int) {
+	st.Lock()
+	defer st.Unlock()
+
+	switch step % 5 {
+	case 0:
+		chg := st.NewChange("install", fmt.Sprintf("install %d", step))
+		t1 := st.NewTask("download", "1...")
+		t2 := st.NewTask("link", "2...")
+		t2.WaitFor(t1)
+		chg.AddTask(t1)
+		chg.AddTask(t2)
+		st.Set(fmt.Sprintf("key-%d", step), map[string]interface{}{"step": step})
+	case 1:
+		for _, chg := range st.Changes() {
+			for _, t := range chg.Tasks() {
+				if t.Status() == state.DoStatus {
+					t.SetStatus(state.DoingStatus)
+					t.Logf("step %d", step)
+					break
+				}
+			}
+		}
+	case 2:
+		st.Set(fmt.Sprintf("key-%d", step-2), nil)
+		st.Set("counter", step)
+	case 3:
+		st.Warnf("warning %d", step)
+		for _, chg := range st.Changes() {
+			for _, t := range chg.Tasks() {
+				if t.Status() == state.DoingStatus {
+					t.SetStatus(state.DoneStatus)
+				}
+			}
+		}
+	case 4:
+		// a task without a change
+		st.NewTask("orphan", fmt.Sprintf("orphan %d", step))
+		st.Set("counter", step)
+	}
+}
+
+// readBack returns the state as read from the journal, serialized.
+func (s *journalSuite) readBack(c *C) []byte {
+	st, err := state.NewJournal(s.snapshotPath, s.journalPath).ReadState(nil)
+	c.Assert(err, IsNil)
+	st.Lock()
+	defer st.Unlock()
+	data, err := st.MarshalJSON()
+	c.Assert(err, IsNil)
+	return data
+}
+
+// reread returns the given full checkpoint as read by ReadState,
+// serialized again.
+func reread(c *C, checkpoint []byte) []byte {
+	st, err := state.ReadState(nil, bytes.NewReader(checkpoint))
+	c.Assert(err, IsNil)
+	st.Lock()
+	defer st.Unlock()
+	data, err := st.MarshalJSON()
+	c.Assert(err, IsNil)
+	return data
+}
+
+func (s *journalSuite) runSteps(c *C, steps int) *journalBackend {
+	b := &journalBackend{
+		journal:     state.NewJournal(s.snapshotPath, s.journalPath),
+		journalPath: s.journalPath,
+	}
+	st := state.New(b)
+	b.st = st
+	for i := 0; i < steps; i++ {
+		mutateState(st, i)
+	}
+	return b
+}
+
+func (s *journalSuite) TestCheckpointAndRead(c *C) {
+	b := s.runSteps(c, 20)
+	c.Assert(b.checkpoints, HasLen, 20)
+
+	// the first checkpoint wrote the snapshot, the rest the journal
+	c.Check(b.deltas[0].Full, Equals, true)
+	snapshot, err := ioutil.ReadFile(s.snapshotPath)
+	c.Assert(err, IsNil)
+	c.Check(string(reread(c, snapshot)), Equals, string(reread(c, b.checkpoints[0])))
+	c.Check(b.journalSizes[0], Equals, int64(0))
+	for i := 1; i < len(b.journalSizes); i++ {
+		grown := b.journalSizes[i] - b.journalSizes[i-1]
+		c.Check(grown > 0, Equals, true)
+		// each record is smaller than the full state
+		c.Check(grown < int64(len(b.checkpoints[i])), Equals, true, Commentf("step %d", i))
+	}
+
+	c.Check(string(s.readBack(c)), Equals, string(reread(c, b.checkpoints[19])))
+}
+
+func (s *journalSuite) TestNothingChanged(c *C) {
+	b := s.runSteps(c, 3)
+	sizeBefore := b.journalSizes[2]
+
+	c.Assert(b.journal.CheckpointDelta(b.deltas[2]), IsNil)
+	fi, err := os.Stat(s.journalPath)
+	c.Assert(err, IsNil)
+	c.Check(fi.Size(), Equals, sizeBefore)
+}
+
+func (s *journalSuite) TestCrashRecovery(c *C) {
+	b := s.runSteps(c, 12)
+	snapshot, err := ioutil.ReadFile(s.snapshotPath)
+	c.Assert(err, IsNil)
+	journal, err := ioutil.ReadFile(s.journalPath)
+	c.Assert(err, IsNil)
+	c.Assert(int64(len(journal)), Equals, b.journalSizes[11])
+
+	expected := make([]string, len(b.checkpoints))
+	for i, checkpoint := range b.checkpoints {
+		expected[i] = string(reread(c, checkpoint))
+	}
+
+	for off := 0; off <= len(journal); off++ {
+		dir := c.MkDir()
+		s.snapshotPath = filepath.Join(dir, "state.json")
+		s.journalPath = filepath.Join(dir, "state.journal")
+		c.Assert(ioutil.WriteFile(s.snapshotPath, snapshot, 0600), IsNil)
+		c.Assert(ioutil.WriteFile(s.journalPath, journal[:off], 0600), IsNil)
+
+		// the last checkpoint completely in the journal
+		last := 0
+		for i, size := range b.journalSizes {
+			if size <= int64(off) {
+				last = i
+			}
+		}
+		comment := Commentf("journal cut at %d, expecting checkpoint %d", off, last)
+
+		j := state.NewJournal(s.snapshotPath, s.journalPath)
+		st, err := j.ReadState(nil)
+		c.Assert(err, IsNil, comment)
+		st.Lock()
+		data, err := st.MarshalJSON()
+		st.Unlock()
+		c.Assert(err, IsNil)
+		c.Assert(string(data), Equals, expected[last], comment)
+
+		// the broken record is gone
+		fi, err := os.Stat(s.journalPath)
+		c.Assert(err, IsNil)
+		c.Assert(fi.Size(), Equals, b.journalSizes[last], comment)
+
+		// and journaling can go on after it
+		if last+1 < len(b.checkpoints) {
+			c.Assert(j.CheckpointDelta(b.deltas[last+1]), IsNil, comment)
+			c.Assert(string(s.readBack(c)), Equals, expected[last+1], comment)
+		}
+	}
+}
+
+func (s *journalSuite) TestCompaction(c *C) {
+	restore := state.MockJournalMinCompactSize(0)
+	defer restore()
+
+	b := s.runSteps(c, 30)
+
+	// the journal never grows bigger than the snapshot it applies to
+	compacted := 0
+	for i := 1; i < len(b.journalSizes); i++ {
+		if b.journalSizes[i] == 0 {
+			compacted++
+		}
+	}
+	c.Check(compacted > 0, Equals, true)
+
+	c.Check(string(s.readBack(c)), Equals, string(reread(c, b.checkpoints[29])))
+}
+
+func (s *journalSuite) TestStaleJournalIgnored(c *C) {
+	b := s.runSteps(c, 5)
+	staleJournal, err := ioutil.ReadFile(s.journalPath)
+	c.Assert(err, IsNil)
+
+	// rewrite the snapshot, and pretend that removing the journal
+	// after that was interrupted
+	c.Assert(b.journal.Compact(), IsNil)
+	_, err = os.Stat(s.journalPath)
+	c.Check(os.IsNotExist(err), Equals, true)
+	c.Assert(ioutil.WriteFile(s.journalPath, staleJournal, 0600), IsNil)
+
+	c.Check(string(s.readBack(c)), Equals, string(reread(c, b.checkpoints[4])))
+	fi, err := os.Stat(s.journalPath)
+	c.Assert(err, IsNil)
+	c.Check(fi.Size(), Equals, int64(0))
+}
+
+func (s *journalSuite) TestReadStateFromPlainSnapshot(c *C) {
+	// a state file written without a journal
+	b := new(fakeStateBackend)
+	st := state.New(b)
+	mutateState(st, 0)
+	c.Assert(ioutil.WriteFile(s.snapshotPath, b.checkpoints[0], 0600), IsNil)
+
+	c.Check(string(s.readBack(c)), Equals, string(reread(c, b.checkpoints[0])))
+}
+
+func (s *journalSuite) TestDeltaOnlyModified(c *C) {
+	b := s.runSteps(c, 1)
+	st := b.st
+
+	st.Lock()
+	st.Set("counter", 42)
+	st.Unlock()
+	delta := b.deltas[len(b.deltas)-1]
+	c.Check(delta.Full, Equals, false)
+	c.Check(delta.Set, DeepEquals, map[string]json.RawMessage{
+		"data/counter": json.RawMessage("42"),
+	})
+	c.Check(delta.Delete, HasLen, 0)
+
+	st.Lock()
+	t := st.Tasks()[0]
+	t.Set("foo", "bar")
+	st.Set("counter", nil)
+	st.Unlock()
+	delta = b.deltas[len(b.deltas)-1]
+	c.Check(delta.Set, HasLen, 1)
+	c.Check(delta.Set["tasks/"+t.ID()], NotNil)
+	c.Check(delta.Delete, DeepEquals, []string{"data/counter"})
+
+	// nothing to checkpoint at all
+	st.Lock()
+	st.Unlock()
+	c.Check(b.deltas, HasLen, 3)
+
+	st.Lock()
+	orphan := st.NewTask("orphan", "...")
+	st.Unlock()
+	c.Check(b.deltas[3].Set["tasks/"+orphan.ID()], NotNil)
+	c.Check(b.deltas[3].Set["last-task-id"], NotNil)
+
+	st.Lock()
+	st.Prune(0, time.Hour, 100)
+	st.Unlock()
+	c.Check(b.deltas[4].Delete, DeepEquals, []string{"tasks/" + orphan.ID()})
+	c.Check(string(s.readBack(c)), Equals, string(reread(c, b.checkpoints[4])))
+}
+
+func (s *journalSuite) TestReadStateNothing(c *C) {
+	b := &journalBackend{
+		journal:     state.NewJournal(s.snapshotPath, s.journalPath),
+		journalPath: s.journalPath,
+	}
+	st, err := b.journal.ReadState(b)
+	c.Assert(err, IsNil)
+	b.st = st
+	st.Lock()
+	st.Set("foo", "bar")
+	st.Unlock()
+
+	// the first checkpoint writes the snapshot, even from a delta
+	c.Assert(b.deltas, HasLen, 1)
+	c.Check(b.deltas[0].Full, Equals, false)
+	snapshot, err := ioutil.ReadFile(s.snapshotPath)
+	c.Assert(err, IsNil)
+	c.Check(string(reread(c, snapshot)), Equals, string(reread(c, b.checkpoints[0])))
+	c.Check(b.journalSizes[0], Equals, int64(0))
+
+	// and the next one the journal
+	st.Lock()
+	st.Set("foo", "baz")
+	st.Unlock()
+	c.Check(b.journalSizes[1] > 0, Equals, true)
+	c.Check(string(s.readBack(c)), Equals, string(reread(c, b.checkpoints[1])))
+}
+
+func (s *journalSuite) TestCheckpointWhole(c *C) {
+	b := s.runSteps(c, 5)
+	c.Assert(b.journalSizes[4] > 0, Equals, true)
+
+	c.Assert(b.journal.Checkpoint(b.checkpoints[4]), IsNil)
+	snapshot, err := ioutil.ReadFile(s.snapshotPath)
+	c.Assert(err, IsNil)
+	c.Check(snapshot, DeepEquals, b.checkpoints[4])
+	_, err = os.Stat(s.journalPath)
+	c.Check(os.IsNotExist(err), Equals, true)
+}
+
+func (s *journalSuite) TestCheckpointDeltaNotRead(c *C) {
+	j := state.NewJournal(s.snapshotPath, s.journalPath)
+	err := j.CheckpointDelta(&state.Delta{Set: map[string]json.RawMessage{"data/foo": json.RawMessage(`"bar"`)}})
+	c.Check(err, ErrorMatches, "internal error: cannot journal state modifications before the state was read")
+}
+
+func (s *journalSuite) TestCompactNotRead(c *C) {
+	j := state.NewJournal(s.snapshotPath, s.journalPath)
+	c.Check(j.Compact(), ErrorMatches, "internal error: cannot compact a state journal that was not read")
+}
+
+func (s *journalSuite) TestClose(c *C) {
+	b := s.runSteps(c, 5)
+	c.Assert(b.journalSizes[4] > 0, Equals, true)
+
+	// closing brings the snapshot up to date
+	c.Assert(b.journal.Close(), IsNil)
+	snapshot, err := ioutil.ReadFile(s.snapshotPath)
+	c.Assert(err, IsNil)
+	c.Check(reread(c, snapshot), DeepEquals, reread(c, b.checkpoints[4]))
+	_, err = os.Stat(s.journalPath)
+	c.Check(os.IsNotExist(err), Equals, true)
+
+	// and keeps it so from then on
+	mutateState(b.st, 5)
+	c.Assert(b.deltas, HasLen, 6)
+	c.Check(b.journalSizes[5], Equals, int64(0))
+	snapshot, err = ioutil.ReadFile(s.snapshotPath)
+	c.Assert(err, IsNil)
+	c.Check(reread(c, snapshot), DeepEquals, reread(c, b.checkpoints[5]))
+}
+
+func (s *journalSuite) TestCloseNotRead(c *C) {
+	j := state.NewJournal(s.snapshotPath, s.journalPath)
+	c.Check(j.Close(), IsNil)
+	_, err := os.Stat(s.snapshotPath)
+	c.Check(os.IsNotExist(err), Equals, true)
+}
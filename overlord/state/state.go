@@ -43,6 +43,49 @@ type Backend interface {
 	RequestRestart(t RestartType)
 }
 
+// An IncrementalBackend is a Backend that can checkpoint the state
+// from only what was modified in it since the previous checkpoint.
+// State uses CheckpointDelta instead of Checkpoint with such backends.
+type IncrementalBackend interface {
+	Backend
+	CheckpointDelta(delta *Delta) error
+}
+
+// A Delta holds what was modified in the state since its previous
+// checkpoint, as serialized entries. Data entries, changes and tasks
+// are keyed as "data/<key>", "changes/<id>" and "tasks/<id>", the
+// other entries by their name in the serialized state.
+type Delta struct {
+	// Full is set if Set holds all the entries of the state, and
+	// not only those that were modified.
+	Full bool
+	// Set holds the entries that were added or modified.
+	Set map[string]json.RawMessage
+	// Delete lists the keys of the entries that were removed.
+	Delete []string
+}
+
+// dirtyEntries tracks the entries of the state modified since the
+// previous checkpoint, for an IncrementalBackend.
+type dirtyEntries struct {
+	// all is set if the whole state must be checkpointed
+	all bool
+	// other is set if any entry other than data entries, changes
+	// and tasks was modified
+	other   bool
+	data    map[string]bool
+	changes map[string]bool
+	tasks   map[string]bool
+}
+
+func markDirty(set map[string]bool, key string) map[string]bool {
+	if set == nil {
+		set = make(map[string]bool)
+	}
+	set[key] = true
+	return set
+}
+
 type customData map[string]*json.RawMessage
 
 func (data customData) get(key string, value interface{}) error {
@@ -108,16 +151,24 @@ type State struct {
 	warnings map[string]*Warning
 
 	modified bool
+	// dirty is only tracked with an IncrementalBackend
+	dirty *dirtyEntries
 
 	cache map[interface{}]interface{}
 
+	changeReadyHandlers  []func(chg *Change)
+	changeStatusHandlers []func(chg *Change, old, new Status)
+	taskStatusHandlers   []func(t *Task, old, new Status)
+	taskProgressHandlers []func(t *Task)
+	warningAddedHandlers []func(w *Warning)
+
 	restarting RestartType
 	restartLck sync.Mutex
 }
 
 // New returns a new empty state.
 func New(backend Backend) *State {
-	return &State{
+	s := &State{
 		backend:  backend,
 		data:     make(customData),
 		changes:  make(map[string]*Change),
@@ -126,6 +177,10 @@ func New(backend Backend) *State {
 		modified: true,
 		cache:    make(map[interface{}]interface{}),
 	}
+	if _, ok := backend.(IncrementalBackend); ok {
+		s.dirty = &dirtyEntries{all: true}
+	}
+	return s
 }
 
 // Modified returns whether the state was modified since the last checkpoint.
@@ -152,6 +207,38 @@ func (s *State) writing() {
 	}
 }
 
+// writingData is writing for modifying the data entry with the given key.
+func (s *State) writingData(key string) {
+	s.writing()
+	if s.dirty != nil {
+		s.dirty.data = markDirty(s.dirty.data, key)
+	}
+}
+
+// writingChange is writing for modifying the change with the given ID.
+func (s *State) writingChange(id string) {
+	s.writing()
+	if s.dirty != nil {
+		s.dirty.changes = markDirty(s.dirty.changes, id)
+	}
+}
+
+// writingTask is writing for modifying the task with the given ID.
+func (s *State) writingTask(id string) {
+	s.writing()
+	if s.dirty != nil {
+		s.dirty.tasks = markDirty(s.dirty.tasks, id)
+	}
+}
+
+// writingOther is writing for modifying the warnings or the last IDs.
+func (s *State) writingOther() {
+	s.writing()
+	if s.dirty != nil {
+		s.dirty.other = true
+	}
+}
+
 func (s *State) unlock() {
 	atomic.AddInt32(&s.muC, -1)
 	s.mu.Unlock()
@@ -186,6 +273,9 @@ func (s *State) MarshalJSON() ([]byte, error) {
 // UnmarshalJSON makes State a json.Unmarshaller
 func (s *State) UnmarshalJSON(data []byte) error {
 	s.writing()
+	if s.dirty != nil {
+		s.dirty.all = true
+	}
 	var unmarshalled marshalledState
 	err := json.Unmarshal(data, &unmarshalled)
 	if err != nil {
@@ -218,6 +308,81 @@ func (s *State) checkpointData() []byte {
 	return data
 }
 
+func mustMarshalEntry(key string, value interface{}) json.RawMessage {
+	data, err := json.Marshal(value)
+	if err != nil {
+		logger.Panicf("internal error: could not marshal state entry %q for checkpointing: %v", key, err)
+	}
+	return data
+}
+
+// checkpointDelta returns the entries of the state modified since the
+// previous checkpoint.
+func (s *State) checkpointDelta() *Delta {
+	delta := &Delta{
+		Full: s.dirty.all,
+		Set:  make(map[string]json.RawMessage),
+	}
+	data, changes, tasks := s.dirty.data, s.dirty.changes, s.dirty.tasks
+	if s.dirty.all {
+		data = make(map[string]bool, len(s.data))
+		for key := range s.data {
+			data[key] = true
+		}
+		changes = make(map[string]bool, len(s.changes))
+		for id := range s.changes {
+			changes[id] = true
+		}
+		tasks = make(map[string]bool, len(s.tasks))
+		for id := range s.tasks {
+			tasks[id] = true
+		}
+	}
+	for key := range data {
+		if entry := s.data[key]; entry != nil {
+			delta.Set["data/"+key] = *entry
+		} else {
+			delta.Delete = append(delta.Delete, "data/"+key)
+		}
+	}
+	for id := range changes {
+		if chg := s.changes[id]; chg != nil {
+			delta.Set["changes/"+id] = mustMarshalEntry("changes/"+id, chg)
+		} else {
+			delta.Delete = append(delta.Delete, "changes/"+id)
+		}
+	}
+	for id := range tasks {
+		if t := s.tasks[id]; t != nil {
+			delta.Set["tasks/"+id] = mustMarshalEntry("tasks/"+id, t)
+		} else {
+			delta.Delete = append(delta.Delete, "tasks/"+id)
+		}
+	}
+	if s.dirty.all || s.dirty.other {
+		if warnings := s.flattenWarnings(); len(warnings) > 0 {
+			delta.Set["warnings"] = mustMarshalEntry("warnings", warnings)
+		} else if !s.dirty.all {
+			delta.Delete = append(delta.Delete, "warnings")
+		}
+		delta.Set["last-change-id"] = mustMarshalEntry("last-change-id", s.lastChangeId)
+		delta.Set["last-task-id"] = mustMarshalEntry("last-task-id", s.lastTaskId)
+		delta.Set["last-lane-id"] = mustMarshalEntry("last-lane-id", s.lastLaneId)
+	}
+	sort.Strings(delta.Delete)
+	return delta
+}
+
+// checkpoint hands the modified state to the backend.
+func (s *State) checkpoint() func() error {
+	if backend, ok := s.backend.(IncrementalBackend); ok && s.dirty != nil {
+		delta := s.checkpointDelta()
+		return func() error { return backend.CheckpointDelta(delta) }
+	}
+	data := s.checkpointData()
+	return func() error { return s.backend.Checkpoint(data) }
+}
+
 // unlock checkpoint retry parameters (5 mins of retries by default)
 var (
 	unlockCheckpointRetryMaxTime  = 5 * time.Minute
@@ -234,12 +399,15 @@ func (s *State) Unlock() {
 		return
 	}
 
-	data := s.checkpointData()
+	checkpoint := s.checkpoint()
 	var err error
 	start := time.Now()
 	for time.Since(start) <= unlockCheckpointRetryMaxTime {
-		if err = s.backend.Checkpoint(data); err == nil {
+		if err = checkpoint(); err == nil {
 			s.modified = false
+			if s.dirty != nil {
+				s.dirty = &dirtyEntries{}
+			}
 			return
 		}
 		time.Sleep(unlockCheckpointRetryInterval)
@@ -293,7 +461,7 @@ func (s *State) Get(key string, value interface{}) error {
 // Set associates value with key for future consulting by managers.
 // The provided value must properly marshal and unmarshal with encoding/json.
 func (s *State) Set(key string, value interface{}) {
-	s.writing()
+	s.writingData(key)
 	s.data.set(key, value)
 }
 
@@ -315,11 +483,49 @@ func (s *State) Cache(key, value interface{}) {
 	}
 }
 
+// AddChangeReadyHandler adds a function to be called when a change
+// becomes ready for the first time. It is called with the state locked.
+func (s *State) AddChangeReadyHandler(f func(chg *Change)) {
+	s.reading()
+	s.changeReadyHandlers = append(s.changeReadyHandlers, f)
+}
+
+// AddChangeStatusChangedHandler adds a function to be called whenever
+// the status of a change changes, either because it was set explicitly
+// or because the status of one of its tasks changed. It is called with
+// the state locked.
+func (s *State) AddChangeStatusChangedHandler(f func(chg *Change, old, new Status)) {
+	s.reading()
+	s.changeStatusHandlers = append(s.changeStatusHandlers, f)
+}
+
+// AddTaskStatusChangedHandler adds a function to be called whenever the
+// status of a task changes. It is called with the state locked.
+func (s *State) AddTaskStatusChangedHandler(f func(t *Task, old, new Status)) {
+	s.reading()
+	s.taskStatusHandlers = append(s.taskStatusHandlers, f)
+}
+
+// AddTaskProgressHandler adds a function to be called whenever the
+// progress of a task is set. It is called with the state locked.
+func (s *State) AddTaskProgressHandler(f func(t *Task)) {
+	s.reading()
+	s.taskProgressHandlers = append(s.taskProgressHandlers, f)
+}
+
+// AddWarningAddedHandler adds a function to be called whenever a
+// warning is added, or added again. It is called with the state locked.
+func (s *State) AddWarningAddedHandler(f func(w *Warning)) {
+	s.reading()
+	s.warningAddedHandlers = append(s.warningAddedHandlers, f)
+}
+
 // NewChange adds a new change to the state.
 func (s *State) NewChange(kind, summary string) *Change {
-	s.writing()
+	s.writingOther()
 	s.lastChangeId++
 	id := strconv.Itoa(s.lastChangeId)
+	s.writingChange(id)
 	chg := newChange(s, id, kind, summary)
 	s.changes[id] = chg
 	return chg
@@ -327,7 +533,7 @@ func (s *State) NewChange(kind, summary string) *Change {
 
 // NewLane creates a new lane in the state.
 func (s *State) NewLane() int {
-	s.writing()
+	s.writingOther()
 	s.lastLaneId++
 	return s.lastLaneId
 }
@@ -352,9 +558,10 @@ func (s *State) Change(id string) *Change {
 // It usually will be registered with a Change using AddTask or
 // through a TaskSet.
 func (s *State) NewTask(kind, summary string) *Task {
-	s.writing()
+	s.writingOther()
 	s.lastTaskId++
 	id := strconv.Itoa(s.lastTaskId)
+	s.writingTask(id)
 	t := newTask(s, id, kind, summary)
 	s.tasks[id] = t
 	return t
@@ -431,6 +638,7 @@ func (s *State) Prune(pruneWait, abortWait time.Duration, maxReadyChanges int) {
 
 	for k, w := range s.warnings {
 		if w.ExpiredBefore(now) {
+			s.writingOther()
 			delete(s.warnings, k)
 		}
 	}
@@ -441,6 +649,7 @@ func (s *State) Prune(pruneWait, abortWait time.Duration, maxReadyChanges int) {
 		if readyTime.IsZero() {
 			if spawnTime.Before(pruneLimit) && len(chg.Tasks()) == 0 {
 				chg.Abort()
+				s.writingChange(chg.ID())
 				delete(s.changes, chg.ID())
 			} else if spawnTime.Before(abortLimit) {
 				chg.Abort()
@@ -449,10 +658,11 @@ func (s *State) Prune(pruneWait, abortWait time.Duration, maxReadyChanges int) {
 		}
 		// change old or we have too many changes
 		if readyTime.Before(pruneLimit) || readyChangesCount > maxReadyChanges {
-			s.writing()
 			for _, t := range chg.Tasks() {
+				s.writingTask(t.ID())
 				delete(s.tasks, t.ID())
 			}
+			s.writingChange(chg.ID())
 			delete(s.changes, chg.ID())
 			readyChangesCount--
 		}
@@ -461,7 +671,7 @@ func (s *State) Prune(pruneWait, abortWait time.Duration, maxReadyChanges int) {
 	for tid, t := range s.tasks {
 		// TODO: this could be done more aggressively
 		if t.Change() == nil && t.SpawnTime().Before(pruneLimit) {
-			s.writing()
+			s.writingTask(tid)
 			delete(s.tasks, tid)
 		}
 	}
@@ -479,6 +689,9 @@ func ReadState(backend Backend, r io.Reader) (*State, error) {
 	}
 	s.backend = backend
 	s.modified = false
+	if _, ok := backend.(IncrementalBackend); ok {
+		s.dirty = &dirtyEntries{}
+	}
 	s.cache = make(map[interface{}]interface{})
 	return s, err
 }
@@ -56,11 +56,13 @@ type Task struct {
 	readyTime time.Time
 
 	// TODO: add:
-	// {,Un}DoingRetries - number of retries
 	// Retry{,Un}DoingTimes - time spend to figure out a retry is needed
 	doingTime   time.Duration
 	undoingTime time.Duration
 
+	doingRetries   int
+	undoingRetries int
+
 	atTime time.Time
 }
 
@@ -96,6 +98,9 @@ type marshalledTask struct {
 	DoingTime   time.Duration `json:"doing-time,omitempty"`
 	UndoingTime time.Duration `json:"undoing-time,omitempty"`
 
+	DoingRetries   int `json:"doing-retries,omitempty"`
+	UndoingRetries int `json:"undoing-retries,omitempty"`
+
 	AtTime *time.Time `json:"at-time,omitempty"`
 }
 
@@ -130,6 +135,9 @@ func (t *Task) MarshalJSON() ([]byte, error) {
 		DoingTime:   t.doingTime,
 		UndoingTime: t.undoingTime,
 
+		DoingRetries:   t.doingRetries,
+		UndoingRetries: t.undoingRetries,
+
 		AtTime: atTime,
 	})
 }
@@ -137,7 +145,7 @@ func (t *Task) MarshalJSON() ([]byte, error) {
 // UnmarshalJSON makes Task a json.Unmarshaller
 func (t *Task) UnmarshalJSON(data []byte) error {
 	if t.state != nil {
-		t.state.writing()
+		t.state.writingTask(t.id)
 	}
 	var unmarshalled marshalledTask
 	err := json.Unmarshal(data, &unmarshalled)
@@ -169,6 +177,8 @@ func (t *Task) UnmarshalJSON(data []byte) error {
 	}
 	t.doingTime = unmarshalled.DoingTime
 	t.undoingTime = unmarshalled.UndoingTime
+	t.doingRetries = unmarshalled.DoingRetries
+	t.undoingRetries = unmarshalled.UndoingRetries
 	return nil
 }
 
@@ -198,16 +208,29 @@ func (t *Task) Status() Status {
 
 // SetStatus sets the task status, overriding the default behavior (see Status method).
 func (t *Task) SetStatus(new Status) {
-	t.state.writing()
+	t.state.writingTask(t.id)
 	old := t.status
+	oldStatus := t.Status()
+	chg := t.Change()
+	var oldChgStatus Status
+	if chg != nil && len(t.state.changeStatusHandlers) > 0 {
+		oldChgStatus = chg.Status()
+	}
 	t.status = new
 	if !old.Ready() && new.Ready() {
 		t.readyTime = timeNow()
 	}
-	chg := t.Change()
 	if chg != nil {
 		chg.taskStatusChanged(t, old, new)
 	}
+	if newStatus := t.Status(); newStatus != oldStatus {
+		for _, f := range t.state.taskStatusHandlers {
+			f(t, oldStatus, newStatus)
+		}
+	}
+	if chg != nil && len(t.state.changeStatusHandlers) > 0 {
+		chg.notifyStatusChanged(oldChgStatus)
+	}
 }
 
 // IsClean returns whether the task has been cleaned. See SetClean.
@@ -220,7 +243,7 @@ func (t *Task) IsClean() bool {
 //
 // Cleaning a task must only be done after the change is ready.
 func (t *Task) SetClean() {
-	t.state.writing()
+	t.state.writingTask(t.id)
 	if t.clean {
 		return
 	}
@@ -260,7 +283,7 @@ func (t *Task) Progress() (label string, done, total int) {
 func (t *Task) SetProgress(label string, done, total int) {
 	// Only mark state for checkpointing if progress is final.
 	if total > 0 && done == total {
-		t.state.writing()
+		t.state.writingTask(t.id)
 	} else {
 		t.state.reading()
 	}
@@ -270,6 +293,9 @@ func (t *Task) SetProgress(label string, done, total int) {
 	} else {
 		t.progress = &progress{Label: label, Done: done, Total: total}
 	}
+	for _, f := range t.state.taskProgressHandlers {
+		f(t)
+	}
 }
 
 // SpawnTime returns the time when the change was created.
@@ -291,12 +317,12 @@ func (t *Task) AtTime() time.Time {
 }
 
 func (t *Task) accumulateDoingTime(duration time.Duration) {
-	t.state.writing()
+	t.state.writingTask(t.id)
 	t.doingTime += duration
 }
 
 func (t *Task) accumulateUndoingTime(duration time.Duration) {
-	t.state.writing()
+	t.state.writingTask(t.id)
 	t.undoingTime += duration
 }
 
@@ -310,6 +336,32 @@ func (t *Task) UndoingTime() time.Duration {
 	return t.undoingTime
 }
 
+func (t *Task) accumulateDoingRetries() int {
+	t.state.writingTask(t.id)
+	t.doingRetries++
+	return t.doingRetries
+}
+
+func (t *Task) accumulateUndoingRetries() int {
+	t.state.writingTask(t.id)
+	t.undoingRetries++
+	return t.undoingRetries
+}
+
+// DoingRetries returns how many times the do handler of the task asked
+// to be retried.
+func (t *Task) DoingRetries() int {
+	t.state.reading()
+	return t.doingRetries
+}
+
+// UndoingRetries returns how many times the undo handler of the task
+// asked to be retried.
+func (t *Task) UndoingRetries() int {
+	t.state.reading()
+	return t.undoingRetries
+}
+
 const (
 	// Messages logged in tasks are guaranteed to use the time formatted
 	// per RFC3339 plus the following strings as a prefix, so these may
@@ -355,20 +407,20 @@ func (t *Task) Log() []string {
 
 // Logf logs information about the progress of the task.
 func (t *Task) Logf(format string, args ...interface{}) {
-	t.state.writing()
+	t.state.writingTask(t.id)
 	t.addLog(LogInfo, format, args)
 }
 
 // Errorf logs error information about the progress of the task.
 func (t *Task) Errorf(format string, args ...interface{}) {
-	t.state.writing()
+	t.state.writingTask(t.id)
 	t.addLog(LogError, format, args)
 }
 
 // Set associates value with key for future consulting by managers.
 // The provided value must properly marshal and unmarshal with encoding/json.
 func (t *Task) Set(key string, value interface{}) {
-	t.state.writing()
+	t.state.writingTask(t.id)
 	t.data.set(key, value)
 }
 
@@ -387,7 +439,7 @@ func (t *Task) Has(key string) bool {
 
 // Clear disassociates the value from key.
 func (t *Task) Clear(key string) {
-	t.state.writing()
+	t.state.writingTask(t.id)
 	delete(t.data, key)
 }
 
@@ -402,7 +454,8 @@ func addOnce(set []string, s string) []string {
 
 // WaitFor registers another task as a requirement for t to make progress.
 func (t *Task) WaitFor(another *Task) {
-	t.state.writing()
+	t.state.writingTask(t.id)
+	t.state.writingTask(another.id)
 	t.waitTasks = addOnce(t.waitTasks, another.id)
 	another.haltTasks = addOnce(another.haltTasks, t.id)
 }
@@ -444,13 +497,13 @@ func (t *Task) Lanes() []int {
 // JoinLane registers the task in the provided lane. Tasks in different lanes
 // abort independently on errors. See Change.AbortLane for details.
 func (t *Task) JoinLane(lane int) {
-	t.state.writing()
+	t.state.writingTask(t.id)
 	t.lanes = append(t.lanes, lane)
 }
 
 // At schedules the task, if it's not ready, to happen no earlier than when, if when is the zero time any previous special scheduling is suppressed.
 func (t *Task) At(when time.Time) {
-	t.state.writing()
+	t.state.writingTask(t.id)
 	iszero := when.IsZero()
 	if t.Status().Ready() && !iszero {
 		return
@@ -465,6 +518,17 @@ func (t *Task) At(when time.Time) {
 	}
 }
 
+// Discard forgets about the task, which must not have been added to a
+// change. It is meant for tasks built only to be inspected, e.g. to
+// report what an operation would do.
+func (t *Task) Discard() {
+	t.state.writingTask(t.id)
+	if t.change != "" {
+		panic(fmt.Sprintf("internal error: cannot discard task %s of change %s", t.id, t.change))
+	}
+	delete(t.state.tasks, t.id)
+}
+
 // A TaskSet holds a set of tasks.
 type TaskSet struct {
 	tasks []*Task
@@ -211,6 +211,42 @@ func (ts *taskSuite) TestProgressAndSetProgress(c *C) {
 	c.Check(tot, Equals, 42)
 }
 
+func (ts *taskSuite) TestTaskProgressHandler(c *C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	var progress []string
+	st.AddTaskProgressHandler(func(t *state.Task) {
+		label, done, total := t.Progress()
+		progress = append(progress, fmt.Sprintf("%s:%s:%d/%d", t.ID(), label, done, total))
+	})
+
+	t := st.NewTask("download", "1...")
+	t.SetProgress("foo", 1, 10)
+	t.SetProgress("foo", 10, 10)
+	c.Check(progress, DeepEquals, []string{t.ID() + ":foo:1/10", t.ID() + ":foo:10/10"})
+}
+
+func (ts *taskSuite) TestTaskStatusChangedHandler(c *C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	var changes []string
+	st.AddTaskStatusChangedHandler(func(t *state.Task, old, new state.Status) {
+		changes = append(changes, fmt.Sprintf("%s:%s->%s", t.ID(), old, new))
+	})
+
+	t := st.NewTask("download", "1...")
+	t.SetStatus(state.DoStatus)
+	c.Check(changes, HasLen, 0)
+	t.SetStatus(state.DoingStatus)
+	t.SetStatus(state.DoingStatus)
+	t.SetStatus(state.DoneStatus)
+	c.Check(changes, DeepEquals, []string{t.ID() + ":Do->Doing", t.ID() + ":Doing->Done"})
+}
+
 func (ts *taskSuite) TestProgressDefaults(c *C) {
 	st := state.New(nil)
 	st.Lock()
@@ -280,6 +316,22 @@ func (ts *taskSuite) TestTaskMarshalsDoingUndoingTime(c *C) {
 	c.Assert(string(d), testutil.Contains, `"undoing-time":654321`)
 }
 
+func (ts *taskSuite) TestTaskMarshalsRetries(c *C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	t := st.NewTask("download", "1...")
+	c.Check(t.AccumulateDoingRetries(), Equals, 1)
+	c.Check(t.AccumulateDoingRetries(), Equals, 2)
+	c.Check(t.AccumulateUndoingRetries(), Equals, 1)
+
+	d, err := t.MarshalJSON()
+	c.Assert(err, IsNil)
+	c.Assert(string(d), testutil.Contains, `"doing-retries":2`)
+	c.Assert(string(d), testutil.Contains, `"undoing-retries":1`)
+}
+
 func (ts *taskSuite) TestTaskWaitFor(c *C) {
 	st := state.New(nil)
 	st.Lock()
@@ -314,6 +366,26 @@ func (ts *taskSuite) TestAt(c *C) {
 	c.Check(b.ensureBefore, Equals, 10*time.Second)
 }
 
+func (ts *taskSuite) TestDiscard(c *C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	t1 := st.NewTask("download", "1...")
+	t2 := st.NewTask("install", "2...")
+	t2.WaitFor(t1)
+
+	t1.Discard()
+	t2.Discard()
+	c.Check(st.Task(t1.ID()), IsNil)
+	c.Check(st.Task(t2.ID()), IsNil)
+
+	chg := st.NewChange("install", "...")
+	t3 := st.NewTask("download", "3...")
+	chg.AddTask(t3)
+	c.Check(t3.Discard, PanicMatches, `internal error: cannot discard task 3 of change 1`)
+}
+
 func (ts *taskSuite) TestAtPast(c *C) {
 	b := new(fakeStateBackend)
 	b.ensureBefore = time.Hour
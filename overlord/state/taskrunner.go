@@ -20,6 +20,10 @@
 package state
 
 import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
 	"sync"
 	"time"
 
@@ -46,6 +50,46 @@ func (r *Retry) Error() string {
 	return "task should be retried"
 }
 
+// RetryPolicy controls how tasks of a kind are retried when their
+// handler returns a *Retry.
+type RetryPolicy struct {
+	// MaxAttempts is how many times the handler is run at most before
+	// the task errors out, or 0 for no limit.
+	MaxAttempts int
+	// Delay is how long to wait before the first retry, unless the
+	// handler asked for a specific delay.
+	Delay time.Duration
+	// Multiplier is by how much the delay grows with every further
+	// retry; values below 1 leave it as it is.
+	Multiplier float64
+	// MaxDelay caps the delay between retries, if not 0.
+	MaxDelay time.Duration
+	// Jitter is the fraction of the delay, between 0 and 1, by which
+	// it is randomly shortened or lengthened.
+	Jitter float64
+}
+
+var randFloat64 = rand.Float64
+
+// delay returns how long to wait before the given retry, the first
+// one being 1.
+func (p *RetryPolicy) delay(retry int) time.Duration {
+	d := float64(p.Delay)
+	if p.Multiplier > 1 {
+		d *= math.Pow(p.Multiplier, float64(retry-1))
+	}
+	if p.MaxDelay > 0 && d > float64(p.MaxDelay) {
+		d = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (2*randFloat64() - 1)
+	}
+	if d > math.MaxInt64 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(d)
+}
+
 type blockedFunc func(t *Task, running []*Task) bool
 
 // TaskRunner controls the running of goroutines to execute known task kinds.
@@ -57,11 +101,20 @@ type TaskRunner struct {
 	handlers map[string]handlerPair
 	optional []optionalHandler
 	cleanups map[string]HandlerFunc
+	retries  map[string]*RetryPolicy
 	stopped  bool
 
 	blocked     []blockedFunc
 	someBlocked bool
 
+	// limits is how many tasks of a kind can run at the same time
+	limits map[string]int
+	// priorities are those of changes, by kind
+	priorities map[string]int
+	// waiting is how many tasks could not run yet, as of the last
+	// Ensure
+	waiting int
+
 	// go-routines lifecycle
 	tombs map[string]*tomb.Tomb
 }
@@ -81,17 +134,34 @@ func NewTaskRunner(s *State) *TaskRunner {
 		state:    s,
 		handlers: make(map[string]handlerPair),
 		cleanups: make(map[string]HandlerFunc),
+		retries:  make(map[string]*RetryPolicy),
 		tombs:    make(map[string]*tomb.Tomb),
 	}
 }
 
 // AddHandler registers the functions to concurrently call for doing and
-// undoing tasks of the given kind. The undo handler may be nil.
+// undoing tasks of the given kind. The undo handler may be nil. The
+// tasks are retried for as long, and as often, as the handlers ask.
 func (r *TaskRunner) AddHandler(kind string, do, undo HandlerFunc) {
+	r.AddHandlerWithRetryPolicy(kind, do, undo, nil)
+}
+
+// AddHandlerWithRetryPolicy is like AddHandler, but when the handlers
+// ask for the tasks to be retried this follows the given policy: the
+// tasks are retried after the delay the policy gives, unless the
+// handlers asked for a specific one, and error out once the policy
+// does not allow for more attempts. Retries because the task runner is
+// stopping, or the task is aborted, do not count as attempts.
+func (r *TaskRunner) AddHandlerWithRetryPolicy(kind string, do, undo HandlerFunc, policy *RetryPolicy) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	r.handlers[kind] = handlerPair{do, undo}
+	if policy != nil {
+		r.retries[kind] = policy
+	} else {
+		delete(r.retries, kind)
+	}
 }
 
 // AddOptionalHandler register functions for doing and undoing tasks that match
@@ -158,10 +228,86 @@ func (r *TaskRunner) AddBlocked(pred func(t *Task, running []*Task) bool) {
 	r.blocked = append(r.blocked, pred)
 }
 
+// SetConcurrencyLimits sets, by task kind, how many tasks of that kind
+// can run at the same time, replacing any limits set before. Kinds
+// missing from limits, or with a limit of zero or less, are not limited.
+//
+// Tasks over the limit are not failed, they stay waiting and are
+// considered again by the next Ensure, in the order SetChangePriorities
+// describes. Tasks already running when a lower limit is set are left
+// to finish.
+func (r *TaskRunner) SetConcurrencyLimits(limits map[string]int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.limits = limits
+}
+
+// SetChangePriorities sets, by change kind, the priority of changes,
+// replacing any priorities set before. Changes of kinds missing from
+// priorities, and tasks without a change, have a priority of zero, and
+// priorities can be negative to go after those.
+//
+// On every Ensure the tasks of changes with a higher priority are
+// considered first, and so get to run first when concurrency limits
+// or blocked predicates do not let all of them run. Tasks with the same
+// priority are considered oldest first, that is in the order they were
+// created. Priorities only order tasks that are ready to run, they do
+// not make tasks wait for others.
+func (r *TaskRunner) SetChangePriorities(priorities map[string]int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.priorities = priorities
+}
+
+func (r *TaskRunner) priority(t *Task) int {
+	if chg := t.Change(); chg != nil {
+		return r.priorities[chg.Kind()]
+	}
+	return 0
+}
+
+// byPriority sorts tasks by decreasing priority, and then by age.
+type byPriority struct {
+	tasks      []*Task
+	priorities []int
+}
+
+func (bp byPriority) Len() int { return len(bp.tasks) }
+func (bp byPriority) Swap(i, j int) {
+	bp.tasks[i], bp.tasks[j] = bp.tasks[j], bp.tasks[i]
+	bp.priorities[i], bp.priorities[j] = bp.priorities[j], bp.priorities[i]
+}
+func (bp byPriority) Less(i, j int) bool {
+	if bp.priorities[i] != bp.priorities[j] {
+		return bp.priorities[i] > bp.priorities[j]
+	}
+	// ids are increasing numbers
+	idi, idj := bp.tasks[i].ID(), bp.tasks[j].ID()
+	if len(idi) != len(idj) {
+		return len(idi) < len(idj)
+	}
+	return idi < idj
+}
+
+// tasksByPriority returns the tasks in the state in the order they
+// should be considered for running.
+func (r *TaskRunner) tasksByPriority() []*Task {
+	tasks := r.state.Tasks()
+	priorities := make([]int, len(tasks))
+	for i, t := range tasks {
+		priorities[i] = r.priority(t)
+	}
+	sort.Sort(byPriority{tasks, priorities})
+	return tasks
+}
+
 // run must be called with the state lock in place
 func (r *TaskRunner) run(t *Task) {
 	var handler HandlerFunc
 	var accuRuntime func(dur time.Duration)
+	var accuRetries func() int
 	switch t.Status() {
 	case DoStatus:
 		t.SetStatus(DoingStatus)
@@ -169,6 +315,7 @@ func (r *TaskRunner) run(t *Task) {
 	case DoingStatus:
 		handler = r.handlerPair(t).do
 		accuRuntime = t.accumulateDoingTime
+		accuRetries = t.accumulateDoingRetries
 
 	case UndoStatus:
 		t.SetStatus(UndoingStatus)
@@ -176,6 +323,7 @@ func (r *TaskRunner) run(t *Task) {
 	case UndoingStatus:
 		handler = r.handlerPair(t).undo
 		accuRuntime = t.accumulateUndoingTime
+		accuRetries = t.accumulateUndoingRetries
 
 	default:
 		panic("internal error: attempted to run task in status " + t.Status().String())
@@ -192,7 +340,11 @@ func (r *TaskRunner) run(t *Task) {
 		// use tomb.Err uniformily to consider both it or a
 		// overriding previous Kill reason.
 		t0 := time.Now()
-		tomb.Kill(handler(t, tomb))
+		res := handler(t, tomb)
+		// retries due to the task being stopped or aborted
+		// do not count
+		interrupted := !tomb.Alive()
+		tomb.Kill(res)
 		t1 := time.Now()
 
 		// Locks must be acquired in the same order everywhere.
@@ -231,8 +383,23 @@ func (r *TaskRunner) run(t *Task) {
 			if t.Status() == AbortStatus {
 				// Would work without it but might take two ensures.
 				r.tryUndo(t)
-			} else if x.After != 0 {
-				t.At(timeNow().Add(x.After))
+				break
+			}
+			after := x.After
+			if !interrupted {
+				retries := accuRetries()
+				if policy := r.retries[t.Kind()]; policy != nil {
+					if policy.MaxAttempts > 0 && retries >= policy.MaxAttempts {
+						r.giveUp(t, retries, x.Reason)
+						break
+					}
+					if after == 0 {
+						after = policy.delay(retries)
+					}
+				}
+			}
+			if after != 0 {
+				t.At(timeNow().Add(after))
 			}
 		case nil:
 			var next []*Task
@@ -265,6 +432,19 @@ func (r *TaskRunner) run(t *Task) {
 	})
 }
 
+// giveUp errors out the task once its handler asked to be retried more
+// times than its retry policy allows.
+func (r *TaskRunner) giveUp(t *Task, attempts int, reason string) {
+	msg := fmt.Sprintf("giving up after %d attempts", attempts)
+	if reason != "" {
+		msg += ": " + reason
+	}
+	logger.Noticef("Task %s (%s) %s", t.ID(), t.Kind(), msg)
+	r.abortLanes(t.Change(), t.Lanes())
+	t.SetStatus(ErrorStatus)
+	t.Errorf("%s", msg)
+}
+
 func (r *TaskRunner) clean(t *Task) {
 	if !t.Change().IsReady() {
 		// Whole Change is not ready so don't run cleanups yet.
@@ -349,17 +529,20 @@ func (r *TaskRunner) Ensure() error {
 
 	r.someBlocked = false
 	running := make([]*Task, 0, len(r.tombs))
+	runningByKind := make(map[string]int)
 	for tid := range r.tombs {
 		t := r.state.Task(tid)
 		if t != nil {
 			running = append(running, t)
+			runningByKind[t.Kind()]++
 		}
 	}
 
+	r.waiting = 0
 	ensureTime := timeNow()
 	nextTaskTime := time.Time{}
 ConsiderTasks:
-	for _, t := range r.state.Tasks() {
+	for _, t := range r.tasksByPriority() {
 		handlers := r.handlerPair(t)
 		if handlers.do == nil {
 			// Handled by a different runner instance.
@@ -389,8 +572,14 @@ ConsiderTasks:
 			continue
 		}
 
+		if chg := t.Change(); chg != nil && chg.IsPaused() {
+			// Held until the change is resumed.
+			continue
+		}
+
 		if mustWait(t) {
 			// Dependencies still unhandled.
+			r.waiting++
 			continue
 		}
 
@@ -411,6 +600,15 @@ ConsiderTasks:
 			if nextTaskTime.IsZero() || nextTaskTime.After(tWhen) {
 				nextTaskTime = tWhen
 			}
+			r.waiting++
+			continue
+		}
+
+		// skip tasks of kinds with as many tasks running as
+		// they are limited to
+		if limit := r.limits[t.Kind()]; limit > 0 && runningByKind[t.Kind()] >= limit {
+			r.someBlocked = true
+			r.waiting++
 			continue
 		}
 
@@ -419,6 +617,7 @@ ConsiderTasks:
 		for _, blocked := range r.blocked {
 			if blocked(t, running) {
 				r.someBlocked = true
+				r.waiting++
 				continue ConsiderTasks
 			}
 		}
@@ -427,6 +626,7 @@ ConsiderTasks:
 		r.run(t)
 
 		running = append(running, t)
+		runningByKind[t.Kind()]++
 	}
 
 	// schedule next Ensure no later than the next task time
@@ -490,6 +690,17 @@ func (r *TaskRunner) Wait() {
 	r.wait()
 }
 
+// QueueDepth returns how many tasks are running, and how many could not
+// run yet as of the last Ensure, because they wait for other tasks,
+// are scheduled for later, are blocked or are over their kind's
+// concurrency limit.
+func (r *TaskRunner) QueueDepth() (running, waiting int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.tombs), r.waiting
+}
+
 // StopKinds kills all concurrent tasks of the given kinds and returns
 // after that's done.
 func (r *TaskRunner) StopKinds(kind ...string) {
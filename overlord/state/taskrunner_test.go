@@ -447,6 +447,43 @@ func (ts *taskRunnerSuite) TestStopKinds(c *C) {
 	c.Check(t2.Status(), Equals, state.DoneStatus)
 }
 
+func (ts *taskRunnerSuite) TestQueueDepth(c *C) {
+	sb := &stateBackend{}
+	st := state.New(sb)
+	r := state.NewTaskRunner(st)
+	defer r.Stop()
+
+	ch := make(chan bool)
+	r.AddHandler("blocking", func(t *state.Task, tb *tomb.Tomb) error {
+		ch <- true
+		<-tb.Dying()
+		return nil
+	}, nil)
+
+	running, waiting := r.QueueDepth()
+	c.Check(running, Equals, 0)
+	c.Check(waiting, Equals, 0)
+
+	st.Lock()
+	chg := st.NewChange("install", "...")
+	t1 := st.NewTask("blocking", "...")
+	t2 := st.NewTask("blocking", "...")
+	t2.WaitFor(t1)
+	t3 := st.NewTask("blocking", "...")
+	t3.At(time.Now().Add(time.Hour))
+	chg.AddTask(t1)
+	chg.AddTask(t2)
+	chg.AddTask(t3)
+	st.Unlock()
+
+	r.Ensure()
+	<-ch
+
+	running, waiting = r.QueueDepth()
+	c.Check(running, Equals, 1)
+	c.Check(waiting, Equals, 2)
+}
+
 func (ts *taskRunnerSuite) TestErrorsOnStopAreRetried(c *C) {
 	sb := &stateBackend{}
 	st := state.New(sb)
@@ -505,6 +542,8 @@ func (ts *taskRunnerSuite) TestStopAskForRetry(c *C) {
 	defer st.Unlock()
 	c.Check(t.Status(), Equals, state.DoingStatus)
 	c.Check(t.AtTime().IsZero(), Equals, false)
+	// asked to stop, not a retry of its own
+	c.Check(t.DoingRetries(), Equals, 0)
 }
 
 func (ts *taskRunnerSuite) TestRetryAfterDuration(c *C) {
@@ -582,6 +621,149 @@ func (ts *taskRunnerSuite) TestRetryAfterDuration(c *C) {
 	c.Check(ask, Equals, 2)
 	c.Check(sb.ensureBefore, Equals, time.Hour)
 	c.Check(t.AtTime().IsZero(), Equals, true)
+	c.Check(t.DoingRetries(), Equals, 1)
+}
+
+func (ts *taskRunnerSuite) TestRetryPolicyDelay(c *C) {
+	jitter := 0.0
+	restore := state.MockRandFloat64(func() float64 { return jitter })
+	defer restore()
+
+	policy := &state.RetryPolicy{
+		Delay:      time.Second,
+		Multiplier: 2,
+		MaxDelay:   time.Minute,
+	}
+	c.Check(policy.DelayFor(1), Equals, time.Second)
+	c.Check(policy.DelayFor(2), Equals, 2*time.Second)
+	c.Check(policy.DelayFor(3), Equals, 4*time.Second)
+	c.Check(policy.DelayFor(10), Equals, time.Minute)
+	c.Check(policy.DelayFor(1000), Equals, time.Minute)
+
+	policy.Jitter = 0.5
+	// between half and one and a half times the delay
+	c.Check(policy.DelayFor(2), Equals, time.Second)
+	jitter = 1
+	c.Check(policy.DelayFor(2), Equals, 3*time.Second)
+	jitter = 0.5
+	c.Check(policy.DelayFor(2), Equals, 2*time.Second)
+
+	// without a multiplier the delay stays the same
+	policy = &state.RetryPolicy{Delay: time.Second}
+	c.Check(policy.DelayFor(5), Equals, time.Second)
+}
+
+func (ts *taskRunnerSuite) TestRetryPolicyBackoff(c *C) {
+	sb := &stateBackend{}
+	st := state.New(sb)
+	r := state.NewTaskRunner(st)
+	defer r.Stop()
+
+	r.AddHandlerWithRetryPolicy("ask-for-retry", func(t *state.Task, _ *tomb.Tomb) error {
+		return &state.Retry{}
+	}, nil, &state.RetryPolicy{
+		Delay:      time.Minute,
+		Multiplier: 3,
+	})
+
+	st.Lock()
+	chg := st.NewChange("install", "...")
+	t := st.NewTask("ask-for-retry", "...")
+	chg.AddTask(t)
+	st.Unlock()
+
+	now := time.Now()
+	restore := state.MockTime(now)
+	defer restore()
+	for i, delay := range []time.Duration{time.Minute, 3 * time.Minute, 9 * time.Minute} {
+		r.Ensure()
+		r.Wait()
+
+		st.Lock()
+		c.Check(t.Status(), Equals, state.DoingStatus)
+		c.Check(t.DoingRetries(), Equals, i+1)
+		c.Check(t.AtTime().Equal(now.Add(delay)), Equals, true, Commentf("retry %d", i+1))
+		st.Unlock()
+
+		now = now.Add(delay)
+		state.MockTime(now)
+	}
+}
+
+func (ts *taskRunnerSuite) TestRetryPolicyMaxAttempts(c *C) {
+	sb := &stateBackend{}
+	st := state.New(sb)
+	r := state.NewTaskRunner(st)
+	defer r.Stop()
+
+	attempts := 0
+	r.AddHandlerWithRetryPolicy("ask-for-retry", func(t *state.Task, _ *tomb.Tomb) error {
+		attempts++
+		return &state.Retry{Reason: "store is busy"}
+	}, nil, &state.RetryPolicy{MaxAttempts: 3})
+
+	st.Lock()
+	chg := st.NewChange("install", "...")
+	t1 := st.NewTask("ask-for-retry", "...")
+	t2 := st.NewTask("ask-for-retry", "...")
+	t2.WaitFor(t1)
+	chg.AddAll(state.NewTaskSet(t1, t2))
+	st.Unlock()
+
+	for i := 0; i < 5; i++ {
+		r.Ensure()
+		r.Wait()
+	}
+
+	st.Lock()
+	defer st.Unlock()
+	c.Check(attempts, Equals, 3)
+	c.Check(t1.Status(), Equals, state.ErrorStatus)
+	c.Check(t1.DoingRetries(), Equals, 3)
+	c.Check(t1.Log(), HasLen, 1)
+	c.Check(t1.Log()[0], Matches, `.* ERROR giving up after 3 attempts: store is busy`)
+	c.Check(t2.Status(), Equals, state.HoldStatus)
+	c.Check(chg.Status(), Equals, state.ErrorStatus)
+}
+
+func (ts *taskRunnerSuite) TestRetryPolicyHandlerDelay(c *C) {
+	sb := &stateBackend{}
+	st := state.New(sb)
+	r := state.NewTaskRunner(st)
+	defer r.Stop()
+
+	r.AddHandlerWithRetryPolicy("ask-for-retry", func(t *state.Task, _ *tomb.Tomb) error {
+		return &state.Retry{After: time.Second}
+	}, nil, &state.RetryPolicy{Delay: time.Minute})
+	// registering the handlers again without a policy drops it
+	r.AddHandlerWithRetryPolicy("no-policy", nil, nil, &state.RetryPolicy{MaxAttempts: 1})
+	r.AddHandler("no-policy", func(t *state.Task, _ *tomb.Tomb) error {
+		return &state.Retry{}
+	}, nil)
+
+	st.Lock()
+	chg := st.NewChange("install", "...")
+	t1 := st.NewTask("ask-for-retry", "...")
+	t2 := st.NewTask("no-policy", "...")
+	chg.AddAll(state.NewTaskSet(t1, t2))
+	st.Unlock()
+
+	now := time.Now()
+	restore := state.MockTime(now)
+	defer restore()
+	for i := 0; i < 2; i++ {
+		r.Ensure()
+		r.Wait()
+		now = now.Add(time.Second)
+		state.MockTime(now)
+	}
+
+	st.Lock()
+	defer st.Unlock()
+	// the delay the handler asks for wins over the one of the policy
+	c.Check(t1.AtTime().Equal(now), Equals, true)
+	c.Check(t2.Status(), Equals, state.DoingStatus)
+	c.Check(t2.DoingRetries(), Equals, 2)
 }
 
 func (ts *taskRunnerSuite) testTaskSerialization(c *C, setupBlocked func(r *state.TaskRunner)) {
@@ -660,6 +842,128 @@ func (ts *taskRunnerSuite) testTaskSerialization(c *C, setupBlocked func(r *stat
 	c.Check(ensureBeforeTick, HasLen, 0)
 }
 
+// limitedRunner returns a task runner with handlers for "download" and
+// "other" tasks, which report that they started and then wait to be
+// released, through the channel for their summary.
+func limitedRunner(st *state.State, summaries ...string) (r *state.TaskRunner, started chan string, release map[string]chan bool) {
+	r = state.NewTaskRunner(st)
+	started = make(chan string, len(summaries))
+	release = make(map[string]chan bool, len(summaries))
+	for _, summary := range summaries {
+		release[summary] = make(chan bool)
+	}
+	handler := func(t *state.Task, tb *tomb.Tomb) error {
+		started <- t.Summary()
+		select {
+		case <-release[t.Summary()]:
+		case <-tb.Dying():
+		}
+		return nil
+	}
+	r.AddHandler("download", handler, nil)
+	r.AddHandler("other", handler, nil)
+	return r, started, release
+}
+
+func waitStarted(c *C, started chan string, n int) []string {
+	var summaries []string
+	for i := 0; i < n; i++ {
+		select {
+		case summary := <-started:
+			summaries = append(summaries, summary)
+		case <-time.After(2 * time.Second):
+			c.Fatalf("only %d tasks started, expected %d", i, n)
+		}
+	}
+	sort.Strings(summaries)
+	return summaries
+}
+
+func waitRunning(c *C, r *state.TaskRunner, n int) {
+	for i := 0; i < 200; i++ {
+		if running, _ := r.QueueDepth(); running == n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Fatalf("tasks running never got down to %d", n)
+}
+
+func (ts *taskRunnerSuite) TestConcurrencyLimits(c *C) {
+	sb := &stateBackend{ensureBefore: time.Hour}
+	st := state.New(sb)
+	r, started, release := limitedRunner(st, "d1", "d2", "d3", "o1", "o2")
+	defer r.Stop()
+	r.SetConcurrencyLimits(map[string]int{"download": 2, "other": 0})
+
+	st.Lock()
+	chg := st.NewChange("install", "...")
+	for _, summary := range []string{"d1", "d2", "d3"} {
+		chg.AddTask(st.NewTask("download", summary))
+	}
+	chg.AddTask(st.NewTask("other", "o1"))
+	chg.AddTask(st.NewTask("other", "o2"))
+	st.Unlock()
+
+	r.Ensure()
+	// the oldest downloads, and everything else
+	c.Check(waitStarted(c, started, 4), DeepEquals, []string{"d1", "d2", "o1", "o2"})
+	running, waiting := r.QueueDepth()
+	c.Check(running, Equals, 4)
+	c.Check(waiting, Equals, 1)
+
+	// another task finishing does not let the last download start
+	release["o1"] <- true
+	waitRunning(c, r, 3)
+	r.Ensure()
+	running, waiting = r.QueueDepth()
+	c.Check(running, Equals, 3)
+	c.Check(waiting, Equals, 1)
+
+	// a download finishing does, and asked for an ensure for that
+	sb.mu.Lock()
+	sb.ensureBefore = time.Hour
+	sb.mu.Unlock()
+	release["d1"] <- true
+	waitRunning(c, r, 2)
+	sb.mu.Lock()
+	c.Check(sb.ensureBefore, Equals, time.Duration(0))
+	sb.mu.Unlock()
+	r.Ensure()
+	c.Check(waitStarted(c, started, 1), DeepEquals, []string{"d3"})
+	running, waiting = r.QueueDepth()
+	c.Check(running, Equals, 3)
+	c.Check(waiting, Equals, 0)
+}
+
+func (ts *taskRunnerSuite) TestChangePriorities(c *C) {
+	sb := &stateBackend{ensureBefore: time.Hour}
+	st := state.New(sb)
+	r, started, release := limitedRunner(st, "auto-refresh", "refresh", "install")
+	defer r.Stop()
+	r.SetConcurrencyLimits(map[string]int{"download": 1})
+	r.SetChangePriorities(map[string]int{"install": 10, "auto-refresh": -10})
+
+	st.Lock()
+	for _, kind := range []string{"auto-refresh", "refresh", "install"} {
+		chg := st.NewChange(kind, "...")
+		chg.AddTask(st.NewTask("download", kind))
+	}
+	st.Unlock()
+
+	var order []string
+	for i := 0; i < 3; i++ {
+		r.Ensure()
+		summaries := waitStarted(c, started, 1)
+		order = append(order, summaries...)
+		release[summaries[0]] <- true
+		r.Wait()
+	}
+	// the user's changes overtake the auto-refresh, even though they
+	// came later
+	c.Check(order, DeepEquals, []string{"install", "refresh", "auto-refresh"})
+}
+
 func (ts *taskRunnerSuite) TestTaskSerializationSetBlocked(c *C) {
 	// start first do1, and then do2 when nothing else is running
 	startedDo1 := false
@@ -766,6 +1070,61 @@ func (ts *taskRunnerSuite) TestOptionalHandler(c *C) {
 	c.Assert(strings.Join(t1.Log(), ""), Matches, `.*optional handler error for "an unknown task"`)
 }
 
+func (ts *taskRunnerSuite) TestPausedChange(c *C) {
+	sb := &stateBackend{}
+	st := state.New(sb)
+	r := state.NewTaskRunner(st)
+	defer r.Stop()
+
+	started := make(chan string, 2)
+	release := make(chan bool)
+	r.AddHandler("foo", func(t *state.Task, _ *tomb.Tomb) error {
+		st.Lock()
+		summary := t.Summary()
+		st.Unlock()
+		started <- summary
+		<-release
+		return nil
+	}, nil)
+
+	st.Lock()
+	chg := st.NewChange("install", "...")
+	t1 := st.NewTask("foo", "t1")
+	t2 := st.NewTask("foo", "t2")
+	t2.WaitFor(t1)
+	chg.AddAll(state.NewTaskSet(t1, t2))
+	st.Unlock()
+
+	r.Ensure()
+	c.Check(<-started, Equals, "t1")
+
+	// the running task finishes, the next one is held
+	st.Lock()
+	chg.Pause()
+	st.Unlock()
+	release <- true
+	r.Wait()
+	r.Ensure()
+	r.Wait()
+
+	st.Lock()
+	c.Check(t1.Status(), Equals, state.DoneStatus)
+	c.Check(t2.Status(), Equals, state.DoStatus)
+	c.Check(chg.Status(), Equals, state.DoStatus)
+	chg.Resume()
+	st.Unlock()
+
+	r.Ensure()
+	c.Check(<-started, Equals, "t2")
+	release <- true
+	r.Wait()
+
+	st.Lock()
+	defer st.Unlock()
+	c.Check(t2.Status(), Equals, state.DoneStatus)
+	c.Check(chg.Status(), Equals, state.DoneStatus)
+}
+
 func (ts *taskRunnerSuite) TestUndoSequence(c *C) {
 	sb := &stateBackend{}
 	st := state.New(sb)
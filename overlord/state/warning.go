@@ -156,6 +156,8 @@ func (s *State) flattenWarnings() []*Warning {
 		}
 		flat = append(flat, w)
 	}
+	// keep the serialized state stable from one checkpoint to the next
+	sort.Sort(byLastAdded(flat))
 	return flat
 }
 
@@ -192,7 +194,7 @@ func (s *State) Warnf(template string, args ...interface{}) {
 }
 
 func (s *State) addWarning(w Warning, t time.Time) {
-	s.writing()
+	s.writingOther()
 
 	if s.warnings[w.message] == nil {
 		w.firstAdded = t
@@ -204,6 +206,9 @@ func (s *State) addWarning(w Warning, t time.Time) {
 		s.warnings[w.message] = &w
 	}
 	s.warnings[w.message].lastAdded = t
+	for _, f := range s.warningAddedHandlers {
+		f(s.warnings[w.message])
+	}
 }
 
 type byLastAdded []*Warning
@@ -226,7 +231,7 @@ func (s *State) AllWarnings() []*Warning {
 // OkayWarnings marks warnings that were showable at the given time as shown.
 func (s *State) OkayWarnings(t time.Time) int {
 	t = t.UTC()
-	s.writing()
+	s.writingOther()
 
 	n := 0
 	for _, w := range s.warnings {
@@ -285,7 +290,7 @@ func (s *State) WarningsSummary() (int, time.Time) {
 // UnshowAllWarnings clears the lastShown timestamp from all the
 // warnings. For use in debugging.
 func (s *State) UnshowAllWarnings() {
-	s.writing()
+	s.writingOther()
 	for _, w := range s.warnings {
 		w.lastShown = time.Time{}
 	}
@@ -133,6 +133,22 @@ func (stateSuite) TestEmptyStateWarnings(c *check.C) {
 	c.Check(ws, check.HasLen, 0)
 }
 
+func (stateSuite) TestWarningAddedHandler(c *check.C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	var added []string
+	st.AddWarningAddedHandler(func(w *state.Warning) {
+		added = append(added, w.String())
+	})
+
+	st.Warnf("hello")
+	st.Warnf("hello %s", "again")
+	st.Warnf("hello")
+	c.Check(added, check.DeepEquals, []string{"hello", "hello again", "hello"})
+}
+
 func (stateSuite) TestDeleteExpired(c *check.C) {
 	const dt = 20 * time.Millisecond
 	oldTime := time.Now()
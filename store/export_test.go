@@ -58,6 +58,9 @@ var (
 
 	JsonContentType  = jsonContentType
 	SnapActionFields = snapActionFields
+
+	RequestDuration = requestDuration
+	RequestErrors   = requestErrors
 )
 
 // MockDefaultRetryStrategy mocks the retry strategy used by several store requests
@@ -51,6 +51,7 @@ import (
 	"github.com/snapcore/snapd/i18n"
 	"github.com/snapcore/snapd/jsonutil"
 	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/metrics"
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/overlord/auth"
 	"github.com/snapcore/snapd/progress"
@@ -103,6 +104,12 @@ var connCheckStrategy = retry.LimitCount(3, retry.LimitTime(38*time.Second,
 	},
 ))
 
+var (
+	requestDuration = metrics.NewHistogram("snapd_store_request_duration_seconds", "Time taken by requests to the store, by host.", metrics.DefaultBuckets, "host")
+	requestErrors   = metrics.NewCounter("snapd_store_request_errors_total", "Failed requests to the store, by host and reason (either \"network\" or the HTTP status code).", "host", "reason")
+	downloadBytes   = metrics.NewCounter("snapd_store_download_bytes_total", "Bytes downloaded from the store.")
+)
+
 // Config represents the configuration to access the snap store
 type Config struct {
 	// Store API base URLs. The assertions url is only separate because it can
@@ -304,6 +311,8 @@ func init() {
 	}
 	defaultConfig.DetailFields = jsonutil.StructFields((*snapDetails)(nil), "snap_yaml_raw")
 	defaultConfig.InfoFields = jsonutil.StructFields((*storeSnap)(nil), "snap-yaml")
+
+	metrics.Register(requestDuration, requestErrors, downloadBytes)
 }
 
 type searchResults struct {
@@ -767,10 +776,16 @@ func (s *Store) doRequest(ctx context.Context, client *http.Client, reqOptions *
 			req = req.WithContext(ctx)
 		}
 
+		start := time.Now()
 		resp, err := client.Do(req)
+		requestDuration.ObserveDuration(time.Since(start), req.URL.Host)
 		if err != nil {
+			requestErrors.Inc(req.URL.Host, "network")
 			return nil, err
 		}
+		if resp.StatusCode >= 400 {
+			requestErrors.Inc(req.URL.Host, strconv.Itoa(resp.StatusCode))
+		}
 
 		wwwAuth := resp.Header.Get("WWW-Authenticate")
 		if resp.StatusCode == 401 && authRefreshes < 4 {
@@ -1519,7 +1534,9 @@ func downloadImpl(ctx context.Context, name, sha3_384, downloadURL string, user
 			bucket := ratelimit.NewBucketWithRate(float64(limit), 2*limit)
 			limiter = ratelimitReader(resp.Body, bucket)
 		}
-		_, finalErr = io.Copy(mw, limiter)
+		var n int64
+		n, finalErr = io.Copy(mw, limiter)
+		downloadBytes.Add(float64(n))
 		pbar.Finished()
 		if finalErr != nil {
 			if httputil.ShouldRetryError(attempt, finalErr) {
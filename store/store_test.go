@@ -1124,6 +1124,35 @@ func (s *storeTestSuite) TestDoRequestDoesNotSetAuthForLocalOnlyUser(c *C) {
 	c.Check(string(responseData), Equals, "response-data")
 }
 
+func (s *storeTestSuite) TestDoRequestMetrics(c *C) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(503)
+	}))
+	c.Assert(mockServer, NotNil)
+	defer mockServer.Close()
+
+	endpoint, _ := url.Parse(mockServer.URL)
+	host := endpoint.Host
+	requests := store.RequestDuration.Count(host)
+	failed := store.RequestErrors.Value(host, "503")
+
+	sto := store.New(&store.Config{}, nil)
+	response, err := sto.DoRequest(context.TODO(), sto.Client(), store.NewRequestOptions("GET", endpoint), nil)
+	c.Assert(err, IsNil)
+	response.Body.Close()
+
+	c.Check(store.RequestDuration.Count(host), Equals, requests+1)
+	c.Check(store.RequestErrors.Value(host, "503"), Equals, failed+1)
+
+	// and one that does not get through
+	mockServer.Close()
+	failed = store.RequestErrors.Value(host, "network")
+	_, err = sto.DoRequest(context.TODO(), sto.Client(), store.NewRequestOptions("GET", endpoint), nil)
+	c.Assert(err, NotNil)
+	c.Check(store.RequestDuration.Count(host), Equals, requests+2)
+	c.Check(store.RequestErrors.Value(host, "network"), Equals, failed+1)
+}
+
 func (s *storeTestSuite) TestDoRequestAuthNoSerial(c *C) {
 	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		c.Check(r.UserAgent(), Equals, userAgent)
@@ -0,0 +1,98 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package strutil_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/strutil"
+)
+
+type diffSuite struct{}
+
+var _ = Suite(&diffSuite{})
+
+const diffOld = "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n"
+const diffNew = "a\nB\nc\nd\ne\nf\ng\nh\nj\nk\n"
+
+func (s *diffSuite) TestUnifiedDiffSame(c *C) {
+	c.Check(strutil.UnifiedDiff("old", "new", diffOld, diffOld, 3), Equals, "")
+	c.Check(strutil.UnifiedDiff("old", "new", "", "", 3), Equals, "")
+}
+
+func (s *diffSuite) TestUnifiedDiffSingleHunk(c *C) {
+	c.Check(strutil.UnifiedDiff("old", "new", diffOld, diffNew, 3), Equals, `--- old
++++ new
+@@ -1,10 +1,10 @@
+ a
+-b
++B
+ c
+ d
+ e
+ f
+ g
+ h
+-i
+ j
++k
+`)
+}
+
+func (s *diffSuite) TestUnifiedDiffSeveralHunks(c *C) {
+	c.Check(strutil.UnifiedDiff("old", "new", diffOld, diffNew, 1), Equals, `--- old
++++ new
+@@ -1,3 +1,3 @@
+ a
+-b
++B
+ c
+@@ -8,3 +8,3 @@
+ h
+-i
+ j
++k
+`)
+	c.Check(strutil.UnifiedDiff("old", "new", diffOld, diffNew, 0), Equals, `--- old
++++ new
+@@ -2 +2 @@
+-b
++B
+@@ -9 +8,0 @@
+-i
+@@ -10,0 +10 @@
++k
+`)
+}
+
+func (s *diffSuite) TestUnifiedDiffAddedAndRemoved(c *C) {
+	c.Check(strutil.UnifiedDiff("old", "new", "", "a\nb\n", 3), Equals, `--- old
++++ new
+@@ -0,0 +1,2 @@
++a
++b
+`)
+	c.Check(strutil.UnifiedDiff("old", "new", "a\nb\n", "", 3), Equals, `--- old
++++ new
+@@ -1,2 +0,0 @@
+-a
+-b
+`)
+}
@@ -22,9 +22,11 @@ package systemd
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"log/syslog"
 	"net"
 	"os"
+	"strconv"
 )
 
 var journalStdoutPath = "/run/systemd/journal/stdout"
@@ -70,3 +72,33 @@ func NewJournalStreamFile(identifier string, priority syslog.Priority, levelPref
 
 	return conn.File()
 }
+
+// jctlKernel calls journalctl to get the JSON kernel and audit logs,
+// either those after the given cursor or the last n.
+var jctlKernel = func(afterCursor string, n int) (io.ReadCloser, error) {
+	args := []string{"-o", "json", "--no-pager"}
+	if afterCursor != "" {
+		args = append(args, "--after-cursor", afterCursor)
+	} else {
+		args = append(args, "-n", strconv.Itoa(n))
+	}
+	// matches on the same field are ORed by journalctl
+	args = append(args, "_TRANSPORT=kernel", "_TRANSPORT=audit")
+
+	return osutilStreamCommand("journalctl", args...)
+}
+
+func MockKernelJournalctl(f func(afterCursor string, n int) (io.ReadCloser, error)) func() {
+	oldJctlKernel := jctlKernel
+	jctlKernel = f
+	return func() {
+		jctlKernel = oldJctlKernel
+	}
+}
+
+// KernelLogReader returns a reader of the kernel and audit messages in
+// the journal, as JSON, logged after the given cursor or, without one,
+// the last n of them. Use Log.Cursor to continue where a read stopped.
+func KernelLogReader(afterCursor string, n int) (io.ReadCloser, error) {
+	return jctlKernel(afterCursor, n)
+}
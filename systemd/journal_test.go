@@ -20,6 +20,7 @@
 package systemd_test
 
 import (
+	"io"
 	"log/syslog"
 	"net"
 	"path"
@@ -87,3 +88,26 @@ func (j *journalTestSuite) TestStreamFileHeader(c *C) {
 
 	<-doneCh
 }
+
+func (j *journalTestSuite) TestKernelLogReader(c *C) {
+	var args []string
+	restore := MockOsutilStreamCommand(func(name string, myargs ...string) (io.ReadCloser, error) {
+		c.Check(name, Equals, "journalctl")
+		args = myargs
+		return nil, nil
+	})
+	defer restore()
+
+	_, err := KernelLogReader("", 100)
+	c.Assert(err, IsNil)
+	c.Check(args, DeepEquals, []string{"-o", "json", "--no-pager", "-n", "100", "_TRANSPORT=kernel", "_TRANSPORT=audit"})
+
+	_, err = KernelLogReader("s=1234;i=42", 100)
+	c.Assert(err, IsNil)
+	c.Check(args, DeepEquals, []string{"-o", "json", "--no-pager", "--after-cursor", "s=1234;i=42", "_TRANSPORT=kernel", "_TRANSPORT=audit"})
+}
+
+func (j *journalTestSuite) TestLogCursor(c *C) {
+	c.Check(Log{}.Cursor(), Equals, "")
+	c.Check(Log{"__CURSOR": "s=1234;i=42"}.Cursor(), Equals, "s=1234;i=42")
+}
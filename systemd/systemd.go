@@ -531,6 +531,11 @@ func (l Log) PID() string {
 	return "-"
 }
 
+// Cursor is the journal cursor of the Log, if any; otherwise, "".
+func (l Log) Cursor() string {
+	return l["__CURSOR"]
+}
+
 // MountUnitPath returns the path of a {,auto}mount unit
 func MountUnitPath(baseDir string) string {
 	escapedPath := EscapeUnitNamePath(baseDir)
@@ -38,3 +38,5 @@ func MockTimeNow(nowFunc func() time.Time) func() {
 		timeNow = old
 	}
 }
+
+var TaskDuration = taskDuration
@@ -24,20 +24,23 @@ import (
 	"time"
 
 	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/metrics"
 	"github.com/snapcore/snapd/overlord/state"
 )
 
-// timingJson and rootTimingsJson aid in marshalling of flattened timings into state.
-type timingJson struct {
+// Timing is a single flattened measurement, as kept in the state.
+type Timing struct {
 	Level    int           `json:"level,omitempty"`
 	Label    string        `json:"label,omitempty"`
 	Summary  string        `json:"summary,omitempty"`
 	Duration time.Duration `json:"duration"`
 }
 
-type rootTimingsJson struct {
+// TimingsInfo is a Timings tree flattened into a list of measurements,
+// as kept in the state.
+type TimingsInfo struct {
 	Tags          map[string]string `json:"tags,omitempty"`
-	NestedTimings []*timingJson     `json:"timings,omitempty"`
+	NestedTimings []*Timing         `json:"timings,omitempty"`
 	// start time of the first timing
 	StartTime time.Time `json:"start-time"`
 	// the most recent stop time of all timings
@@ -55,10 +58,33 @@ var timeDuration = func(start, end time.Time) time.Duration {
 	return end.Sub(start)
 }
 
+var taskDuration = metrics.NewHistogram("snapd_task_duration_seconds", "Time taken by the measured runs of tasks, by task kind.", []float64{.01, .1, .5, 1, 5, 10, 30, 60, 300, 900}, "kind")
+
+func init() {
+	metrics.Register(taskDuration)
+}
+
+// duration returns the time from the start of the first measurement to
+// the most recent stop time of all of them.
+func (t *Timings) duration() time.Duration {
+	var maxStopTime time.Time
+	maxStopRecursive(t.timings, &maxStopTime)
+	return timeDuration(t.timings[0].start, maxStopTime)
+}
+
+func maxStopRecursive(timings []*Span, maxStopTime *time.Time) {
+	for _, tm := range timings {
+		if tm.stop.After(*maxStopTime) {
+			*maxStopTime = tm.stop
+		}
+		maxStopRecursive(tm.timings, maxStopTime)
+	}
+}
+
 // flatten flattens nested measurements into a single list within rootTimingJson.NestedTimings
 // and calculates total duration.
 func (t *Timings) flatten() interface{} {
-	data := &rootTimingsJson{
+	data := &TimingsInfo{
 		Tags: t.tags,
 	}
 	var maxStopTime time.Time
@@ -73,11 +99,11 @@ func (t *Timings) flatten() interface{} {
 	return data
 }
 
-func flattenRecursive(data *rootTimingsJson, timings []*Span, nestLevel int, maxStopTime *time.Time) {
+func flattenRecursive(data *TimingsInfo, timings []*Span, nestLevel int, maxStopTime *time.Time) {
 	for _, tm := range timings {
 		dur := timeDuration(tm.start, tm.stop)
 		if dur >= DurationThreshold {
-			data.NestedTimings = append(data.NestedTimings, &timingJson{
+			data.NestedTimings = append(data.NestedTimings, &Timing{
 				Level:    nestLevel,
 				Label:    tm.label,
 				Summary:  tm.summary,
@@ -98,6 +124,10 @@ func flattenRecursive(data *rootTimingsJson, timings []*Span, nestLevel int, max
 // than or equal to DurationThreshold.
 // It's responsibility of the caller to lock the state before calling this function.
 func (t *Timings) Save(st *state.State) {
+	if kind := t.tags["task-kind"]; kind != "" && len(t.timings) > 0 {
+		taskDuration.ObserveDuration(t.duration(), kind)
+	}
+
 	var stateTimings []*json.RawMessage
 	if err := st.Get("timings", &stateTimings); err != nil && err != state.ErrNoState {
 		logger.Noticef("could not get timings data from the state: %v", err)
@@ -121,3 +151,21 @@ func (t *Timings) Save(st *state.State) {
 	}
 	st.Set("timings", stateTimings)
 }
+
+// Get returns the timings kept in the state whose tags match the given
+// filter, oldest first.
+// It's responsibility of the caller to lock the state before calling this function.
+func Get(st *state.State, filter func(tags map[string]string) bool) ([]*TimingsInfo, error) {
+	var stateTimings []*TimingsInfo
+	if err := st.Get("timings", &stateTimings); err != nil && err != state.ErrNoState {
+		return nil, err
+	}
+
+	var result []*TimingsInfo
+	for _, tm := range stateTimings {
+		if filter(tm.Tags) {
+			result = append(result, tm)
+		}
+	}
+	return result, nil
+}
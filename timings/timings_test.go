@@ -155,6 +155,37 @@ func (s *timingsSuite) TestSave(c *C) {
 			}}})
 }
 
+func (s *timingsSuite) TestGet(c *C) {
+	s.mockDuration(c)
+
+	s.st.Lock()
+	defer s.st.Unlock()
+
+	for _, chg := range []string{"1", "2", "1"} {
+		timing := timings.New(map[string]string{"change-id": chg})
+		timing.StartSpan("doing something", "for change "+chg).Stop()
+		timing.Save(s.st)
+	}
+
+	tms, err := timings.Get(s.st, func(tags map[string]string) bool {
+		return tags["change-id"] == "1"
+	})
+	c.Assert(err, IsNil)
+	c.Assert(tms, HasLen, 2)
+	c.Check(tms[0].Tags, DeepEquals, map[string]string{"change-id": "1"})
+	c.Check(tms[0].NestedTimings, DeepEquals, []*timings.Timing{
+		{Label: "doing something", Summary: "for change 1", Duration: time.Millisecond},
+	})
+	c.Check(tms[1].NestedTimings[0].Duration, Equals, 3*time.Millisecond)
+
+	st := state.New(nil)
+	st.Lock()
+	tms, err = timings.Get(st, func(map[string]string) bool { return true })
+	st.Unlock()
+	c.Assert(err, IsNil)
+	c.Check(tms, HasLen, 0)
+}
+
 func (s *timingsSuite) TestDuration(c *C) {
 	s.st.Lock()
 	defer s.st.Unlock()
@@ -323,11 +354,16 @@ func (s *timingsSuite) TestNewForTask(c *C) {
 	chg := s.st.NewChange("change", "...")
 	chg.AddTask(task)
 
+	observed := timings.TaskDuration.Count("kind")
+
 	troot := timings.NewForTask(task)
 	span := troot.StartSpan("foo", "bar")
 	span.Stop()
 	troot.Save(s.st)
 
+	// the run of the task was observed for the metrics
+	c.Check(timings.TaskDuration.Count("kind"), Equals, observed+1)
+
 	var stateTimings []interface{}
 	c.Assert(s.st.Get("timings", &stateTimings), IsNil)
 	c.Assert(stateTimings, DeepEquals, []interface{}{